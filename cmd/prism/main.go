@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"crypto/subtle"
 	"crypto/tls"
 	"errors"
 	"fmt"
@@ -10,6 +11,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -17,8 +19,10 @@ import (
 	"golang.org/x/sync/errgroup"
 
 	"github.com/zsiec/prism/certs"
+	"github.com/zsiec/prism/demux"
 	"github.com/zsiec/prism/distribution"
 	"github.com/zsiec/prism/ingest"
+	hlsingest "github.com/zsiec/prism/ingest/hls"
 	srtingest "github.com/zsiec/prism/ingest/srt"
 	"github.com/zsiec/prism/pipeline"
 	"github.com/zsiec/prism/stream"
@@ -55,9 +59,37 @@ func main() {
 		cancel()
 	}()
 
+	defaultThresholds := distribution.IngestThresholds{
+		LowKbps:  envFloat("INGEST_LOW_KBPS", 0),
+		HighKbps: envFloat("INGEST_HIGH_KBPS", 0),
+	}
+	if err := defaultThresholds.Validate(); err != nil {
+		slog.Warn("ignoring invalid INGEST_LOW_KBPS/INGEST_HIGH_KBPS", "error", err)
+		defaultThresholds = distribution.IngestThresholds{}
+	}
+
 	a := &app{
-		mgr: stream.NewManager(nil),
+		defaultIngestThreshold: defaultThresholds,
+		ingestThresholds:       parseStreamThresholds(os.Getenv("INGEST_STREAM_KBPS")),
+		corruptLogInterval:     envDuration("CORRUPT_LOG_INTERVAL", time.Second),
+		discontinuityThreshold: envDuration("DISCONTINUITY_THRESHOLD", time.Second),
+		audioSkewThreshold:     envDuration("AUDIO_SKEW_THRESHOLD", 500*time.Millisecond),
+		aacChannelCorrection:   envBool("AAC_CHANNEL_CORRECTION", true),
+		privateTimecodeTag:     privateTimecodeTag(os.Getenv("TS_TIMECODE_TAG")),
+		reorderWindow:          envInt("TS_REORDER_WINDOW", 0),
+		reorderWait:            envDuration("TS_REORDER_WAIT", 50*time.Millisecond),
+		scte35PTSOffset:        envDuration("SCTE35_PTS_OFFSET", 0),
+		repairEPB:              envBool("TS_REPAIR_EMULATION_PREVENTION", false),
+		gopMinFrames:           envInt("GOP_MIN_FRAMES", 0),
+		gopMaxFrames:           envInt("GOP_MAX_FRAMES", 0),
+		captionChannels:        parseCaptionChannels(os.Getenv("CAPTION_SERVICE_CHANNELS")),
 	}
+	a.mgr = stream.NewManager(nil,
+		stream.WithIdleTTL(envDuration("STREAM_IDLE_TTL", 0)),
+		stream.WithOnEvict(a.evictStream),
+		stream.WithDuplicatePolicy(duplicatePolicy(os.Getenv("DUPLICATE_STREAM_POLICY"))),
+		stream.WithOnReplace(a.replaceStream),
+	)
 
 	wtAddr := envOr("WT_ADDR", ":4443")
 	webDir := envOr("WEB_DIR", "web/dist")
@@ -76,29 +108,62 @@ func main() {
 
 	// Create registry and SRT caller after errgroup so closures capture the
 	// errgroup-derived context, ensuring streams shut down when any component fails.
-	a.registry = ingest.NewRegistry(func(key string, input io.Reader, format ingest.InputFormat) {
-		a.handleNewStream(ctx, key, input, format)
+	a.registry = ingest.NewRegistry(func(key string, input io.Reader, format ingest.InputFormat, protocol string) {
+		a.handleNewStream(ctx, key, input, format, protocol)
 	})
 	a.srtCaller = srtingest.NewCaller(a.registry, nil)
+	a.srtCaller.SetReconnect(srtingest.ReconnectPolicy{
+		MaxAttempts: envInt("SRT_PULL_RECONNECT_ATTEMPTS", 5),
+		MinInterval: envDuration("SRT_PULL_RECONNECT_INTERVAL", 0),
+	})
 
 	var distErr error
 	a.distSrv, distErr = distribution.NewServer(distribution.ServerConfig{
 		Addr:   wtAddr,
 		WebDir: webDir,
 		Cert:   cert,
-		SRTPull: func(address, streamKey, streamID string) error {
+		SRTPull: func(req distribution.SRTPullInfo) error {
 			return a.srtCaller.Pull(ctx, srtingest.PullRequest{
-				Address:   address,
-				StreamKey: streamKey,
-				StreamID:  streamID,
+				Address:   req.Address,
+				StreamKey: req.StreamKey,
+				StreamID:  req.StreamID,
+				Resource:  req.Resource,
+				User:      req.User,
 			})
 		},
 		SRTStop: func(streamKey string) error {
 			return a.srtCaller.Stop(streamKey)
 		},
-		SRTList:      a.listSRTPulls,
-		StreamLister: a.listStreams,
-		IngestLookup: a.lookupIngest,
+		SRTList:            a.listSRTPulls,
+		StreamLister:       a.listStreams,
+		IngestLookup:       a.lookupIngest,
+		DVRWindow:          envDuration("DVR_WINDOW", 0),
+		GOPCacheLimit:      a.gopMaxFrames,
+		ViewerWriteTimeout: envDuration("VIEWER_WRITE_TIMEOUT", 0),
+		AudioFirst:         envBool("AUDIO_FIRST", false),
+		TrackPriorities:    parseTrackPriorities(os.Getenv("TRACK_PRIORITIES")),
+		CatalogRetries:     envInt("CATALOG_RETRIES", 0),
+		VideoOverflow:      videoOverflowPolicy(os.Getenv("VIDEO_OVERFLOW")),
+		VideoBlockTimeout:  envDuration("VIDEO_BLOCK_TIMEOUT", 0),
+		VideoObjects:       videoObjectMode(os.Getenv("VIDEO_OBJECTS")),
+		Timestamps:         timestampMode(os.Getenv("CAPTURE_TIMESTAMPS")),
+		QUIC:               quicTuning(),
+		ShutdownGrace:      envDuration("SHUTDOWN_GRACE", 0),
+		Recorder:           a.recorder(os.Getenv("RECORD_DIR")),
+
+		SubscribeAuthorizer:    subscribeTokens(os.Getenv("SUBSCRIBE_TOKENS")),
+		AdminAuthorizer:        adminTokens(os.Getenv("ADMIN_TOKENS")),
+		EndTrackOnWriteTimeout: envBool("VIEWER_WRITE_TIMEOUT_END_TRACK", false),
+		OpenUnalignedGroups:    envBool("MOQ_OPEN_UNALIGNED_GROUPS", false),
+		PlainCaptions:          envBool("MOQ_PLAIN_CAPTIONS", false),
+		CaptionChannels:        a.captionChannels,
+		ObjectDatagrams:        envBool("MOQ_OBJECT_DATAGRAMS", false),
+		AudioAlignHold:         envDuration("AUDIO_ALIGN_HOLD", 0),
+		AudioFramesPerObject:   envInt("AUDIO_FRAMES_PER_OBJECT", 0),
+		DropRateThreshold:      envFloat("DROP_RATE_HINT_THRESHOLD", 0),
+		DropRateWindow:         envDuration("DROP_RATE_HINT_WINDOW", 0),
+		VideoShedding:          shedLevel(os.Getenv("VIDEO_SHED_LEVEL")),
+		MaxRequestID:           uint64(max(envInt("MOQ_MAX_REQUEST_ID", 0), 0)),
 	})
 	if distErr != nil {
 		slog.Error("failed to create distribution server", "error", distErr)
@@ -107,6 +172,15 @@ func main() {
 
 	srtSrv := srtingest.NewServer(srtAddr, a.registry, nil)
 
+	hlsPuller := hlsingest.NewPuller(a.registry, nil, nil)
+	for _, req := range parseHLSPulls(os.Getenv("HLS_PULL")) {
+		go func() {
+			if err := hlsPuller.Pull(ctx, req); err != nil {
+				slog.Error("HLS pull failed", "stream_key", req.StreamKey, "url", req.URL, "error", err)
+			}
+		}()
+	}
+
 	apiSrv := &http.Server{
 		Addr:    apiAddr,
 		Handler: a.distSrv.APIHandler(),
@@ -138,6 +212,11 @@ func main() {
 		return a.distSrv.Start(ctx)
 	})
 
+	g.Go(func() error {
+		a.mgr.Run(ctx)
+		return nil
+	})
+
 	if err := g.Wait(); err != nil {
 		slog.Error("server error", "error", err)
 		os.Exit(1)
@@ -149,6 +228,74 @@ type app struct {
 	registry  *ingest.Registry
 	srtCaller *srtingest.Caller
 	distSrv   *distribution.Server
+
+	// defaultIngestThreshold applies to streams without an entry in
+	// ingestThresholds, which is keyed by stream key.
+	defaultIngestThreshold distribution.IngestThresholds
+	ingestThresholds       map[string]distribution.IngestThresholds
+
+	// corruptLogInterval spaces the demuxer's corrupt-packet log lines.
+	corruptLogInterval time.Duration
+
+	// discontinuityThreshold is the backward video PTS jump treated as a
+	// splice.
+	discontinuityThreshold time.Duration
+
+	// audioSkewThreshold is the audio-to-video PTS skew beyond which a
+	// track is flagged as out of sync.
+	audioSkewThreshold time.Duration
+
+	// aacChannelCorrection derives AAC channel counts from the program
+	// config element rather than the ADTS header alone.
+	aacChannelCorrection bool
+
+	// privateTimecodeTag selects the adaptation field private data field
+	// read for timecode; 0 disables it.
+	privateTimecodeTag uint8
+
+	// reorderWindow is how many TS packets per PID the demuxer holds to
+	// put out-of-order packets back in order, for up to reorderWait; 0
+	// disables it.
+	reorderWindow int
+	reorderWait   time.Duration
+
+	// scte35PTSOffset is added to the PTS of every SCTE-35 event.
+	scte35PTSOffset time.Duration
+
+	// repairEPB repairs video NAL units with missing emulation
+	// prevention bytes before they are forwarded.
+	repairEPB bool
+
+	// gopMinFrames and gopMaxFrames bound the GOP length, in frames,
+	// outside which a GOP is counted as abnormal; 0 disables a bound. A
+	// GOP longer than gopMaxFrames also stops being cached for late
+	// joiners.
+	gopMinFrames int
+	gopMaxFrames int
+
+	// captionChannels maps CEA-708 services to caption channels; nil
+	// keeps demux.DefaultCaptionChannel.
+	captionChannels demux.CaptionChannelFunc
+}
+
+// ingestThresholdsFor returns the expected ingest bitrate range for a
+// stream key, falling back to the process-wide default.
+func (a *app) ingestThresholdsFor(key string) distribution.IngestThresholds {
+	if th, ok := a.ingestThresholds[key]; ok {
+		return th
+	}
+	return a.defaultIngestThreshold
+}
+
+// recorder returns the controller for the recording API, writing to dir,
+// or nil to disable recording when dir is empty.
+func (a *app) recorder(dir string) distribution.RecordController {
+	if dir == "" {
+		return nil
+	}
+	return distribution.NewTSRecorder(dir, func(key string) *distribution.Relay {
+		return a.distSrv.GetRelay(key)
+	})
 }
 
 func (a *app) listSRTPulls() []distribution.SRTPullInfo {
@@ -159,6 +306,12 @@ func (a *app) listSRTPulls() []distribution.SRTPullInfo {
 			Address:   p.Address,
 			StreamKey: p.StreamKey,
 			StreamID:  p.StreamID,
+			Resource:  p.Resource,
+			User:      p.User,
+			Attempts:  p.Attempts,
+		}
+		if !p.NextRetry.IsZero() {
+			out[i].NextRetryAt = p.NextRetry.UnixMilli()
 		}
 	}
 	return out
@@ -191,6 +344,8 @@ func (a *app) listStreams() []distribution.StreamInfo {
 			info.HasCaptions = snap.Captions.TotalFrames > 0
 			info.CaptionChannels = snap.Captions.ActiveChannels
 			info.HasSCTE35 = snap.SCTE35.TotalEvents > 0
+			info.IngestHealth = snap.IngestHealth
+			info.IngestBreaches = snap.IngestBreaches
 			info.Protocol = snap.Protocol
 			info.UptimeMs = snap.UptimeMs
 			info.Description = buildStreamDescription(info)
@@ -213,22 +368,64 @@ func (a *app) lookupIngest(key string) *distribution.IngestDebugStats {
 		ConnectedAt:   s.ConnectedAt,
 		UptimeMs:      s.UptimeMs,
 		RemoteAddr:    s.RemoteAddr,
+		ReadErrors:    s.ReadErrors,
+		ReadTimeouts:  s.ReadTimeouts,
+		ReadResets:    s.ReadResets,
+		LastError:     s.LastError,
+		EndReason:     s.EndReason,
 	}
 }
 
-func (a *app) handleNewStream(ctx context.Context, key string, input io.Reader, format ingest.InputFormat) {
-	slog.Info("new stream from ingest", "key", key)
+func (a *app) handleNewStream(ctx context.Context, key string, input io.Reader, format ingest.InputFormat, protocol string) {
+	slog.Info("new stream from ingest", "key", key, "protocol", protocol)
 
-	if _, created := a.mgr.Create(key); !created {
+	s, created := a.mgr.Create(key)
+	if !created {
 		slog.Warn("rejecting duplicate stream connection", "key", key)
+		closeInput(input)
+		return
+	}
+	key = s.Key // differs from the publisher's key when aliased
+	defer a.teardownStream(s)
+
+	// A publisher that replaces this one removes it from the manager;
+	// closing the input then ends the pipeline.
+	go func() {
+		<-s.Done()
+		closeInput(input)
+	}()
+
+	// Only MPEG-TS can be demuxed; close anything else before it reaches
+	// the demuxer, which would report every packet as corrupt.
+	detected, input, err := ingest.Sniff(input)
+	if err == nil && detected != ingest.FormatMPEGTS {
+		err = fmt.Errorf("no demuxer for %v", detected)
+	}
+	if err != nil {
+		slog.Error("rejecting stream", "key", key, "declared_format", format, "error", err)
+		closeInput(input)
 		return
 	}
-	defer a.teardownStream(key)
 
 	relay := a.distSrv.RegisterStream(key)
 
-	p := pipeline.New(key, input, relay)
-	p.SetProtocol("SRT")
+	p := pipeline.New(key, s.TrackReads(input), relay)
+	p.SetProtocol(protocol)
+	p.SetCorruptLogSampler(demux.NewIntervalSampler(a.corruptLogInterval))
+	p.SetDiscontinuityThreshold(a.discontinuityThreshold)
+	p.SetAudioSkewThreshold(a.audioSkewThreshold)
+	p.SetAACChannelCorrection(a.aacChannelCorrection)
+	p.SetPrivateDataTimecode(a.privateTimecodeTag)
+	p.SetReorderWindow(a.reorderWindow, a.reorderWait)
+	p.SetSCTE35PTSOffset(a.scte35PTSOffset)
+	p.SetEmulationPreventionRepair(a.repairEPB)
+	p.SetGOPLimits(a.gopMinFrames, a.gopMaxFrames)
+	if a.captionChannels != nil {
+		p.SetCaptionChannels(a.captionChannels)
+	}
+	if err := p.SetIngestThresholds(a.ingestThresholdsFor(key)); err != nil {
+		slog.Warn("ignoring invalid ingest thresholds", "stream", key, "error", err)
+	}
 	a.distSrv.SetPipeline(key, p)
 
 	if err := p.Run(ctx); err != nil {
@@ -238,10 +435,34 @@ func (a *app) handleNewStream(ctx context.Context, key string, input io.Reader,
 }
 
 // teardownStream removes all resources for a stream across the distribution
-// server and stream manager in a single call.
-func (a *app) teardownStream(key string) {
+// server and stream manager in a single call. A stream that was replaced
+// has already released them, and the key now belongs to its replacement.
+func (a *app) teardownStream(s *stream.Stream) {
+	if a.mgr.RemoveStream(s) {
+		a.distSrv.UnregisterStream(s.Key)
+	}
+}
+
+// replaceStream releases the distribution resources of a stream a new
+// publisher replaced, ending it for its viewers so they reconnect to the
+// replacement rather than to a relay fed by two sources.
+func (a *app) replaceStream(old *stream.Stream) {
+	a.distSrv.UnregisterStream(old.Key)
+}
+
+// closeInput closes an ingest input, which disconnects its publisher.
+func closeInput(input io.Reader) {
+	if c, ok := input.(io.Closer); ok {
+		c.Close()
+	}
+}
+
+// evictStream releases the distribution resources of a stream the manager
+// evicted for inactivity. Eviction also closes the stream's Done channel,
+// on which handleNewStream closes the ingest input; that disconnects the
+// publisher, whose ingest stream is then released by its own connection.
+func (a *app) evictStream(key string) {
 	a.distSrv.UnregisterStream(key)
-	a.mgr.Remove(key)
 }
 
 func envOr(key, fallback string) string {
@@ -251,6 +472,342 @@ func envOr(key, fallback string) string {
 	return fallback
 }
 
+// envFloat parses a float environment variable, logging and falling back
+// to the default if the value is malformed.
+func envFloat(key string, fallback float64) float64 {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		slog.Warn("ignoring invalid numeric env var", "key", key, "value", v, "error", err)
+		return fallback
+	}
+	return f
+}
+
+// envInt parses an integer environment variable, logging and falling back
+// to the default if the value is malformed.
+func envInt(key string, fallback int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		slog.Warn("ignoring invalid numeric env var", "key", key, "value", v, "error", err)
+		return fallback
+	}
+	return n
+}
+
+// envBool parses a boolean environment variable, logging and falling back
+// to the default if the value is malformed.
+func envBool(key string, fallback bool) bool {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		slog.Warn("ignoring invalid boolean env var", "key", key, "value", v, "error", err)
+		return fallback
+	}
+	return b
+}
+
+// envDuration parses a time.Duration environment variable such as "90s",
+// logging and falling back to the default if the value is malformed.
+func envDuration(key string, fallback time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		slog.Warn("ignoring invalid duration env var", "key", key, "value", v, "error", err)
+		return fallback
+	}
+	return d
+}
+
+// quicTuning reads the QUIC transport overrides. Unset, invalid or
+// negative values keep the quic-go defaults.
+func quicTuning() distribution.QUICTuning {
+	size := func(key string) int64 { return int64(max(envInt(key, 0), 0)) }
+	return distribution.QUICTuning{
+		InitialStreamReceiveWindow:     uint64(size("QUIC_STREAM_WINDOW")),
+		MaxStreamReceiveWindow:         uint64(size("QUIC_MAX_STREAM_WINDOW")),
+		InitialConnectionReceiveWindow: uint64(size("QUIC_CONN_WINDOW")),
+		MaxConnectionReceiveWindow:     uint64(size("QUIC_MAX_CONN_WINDOW")),
+		MaxIncomingStreams:             size("QUIC_MAX_STREAMS"),
+		MaxIncomingUniStreams:          size("QUIC_MAX_UNI_STREAMS"),
+	}
+}
+
+// parseStreamThresholds parses per-stream ingest bitrate ranges of the form
+// "key=low:high,key2=low:high". Either bound may be empty to leave that side
+// unchecked. Malformed or invalid entries are logged and skipped.
+func parseStreamThresholds(v string) map[string]distribution.IngestThresholds {
+	out := make(map[string]distribution.IngestThresholds)
+	for _, entry := range strings.Split(v, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		key, bounds, ok := strings.Cut(entry, "=")
+		lowStr, highStr, ok2 := strings.Cut(bounds, ":")
+		if !ok || !ok2 || key == "" {
+			slog.Warn("ignoring malformed INGEST_STREAM_KBPS entry", "entry", entry)
+			continue
+		}
+		var th distribution.IngestThresholds
+		var err error
+		if lowStr != "" {
+			th.LowKbps, err = strconv.ParseFloat(lowStr, 64)
+		}
+		if err == nil && highStr != "" {
+			th.HighKbps, err = strconv.ParseFloat(highStr, 64)
+		}
+		if err == nil {
+			err = th.Validate()
+		}
+		if err != nil {
+			slog.Warn("ignoring invalid INGEST_STREAM_KBPS entry", "entry", entry, "error", err)
+			continue
+		}
+		out[key] = th
+	}
+	return out
+}
+
+// privateTimecodeTag parses the TS_TIMECODE_TAG data field tag, in
+// decimal or 0x-prefixed hex, logging and disabling the feature if it is
+// not a byte.
+func privateTimecodeTag(v string) uint8 {
+	if v == "" {
+		return 0
+	}
+	tag, err := strconv.ParseUint(v, 0, 8)
+	if err != nil {
+		slog.Warn("ignoring invalid TS_TIMECODE_TAG", "value", v, "error", err)
+		return 0
+	}
+	return uint8(tag)
+}
+
+// videoObjectMode parses the VIDEO_OBJECTS mode name, logging and falling
+// back to one object per frame if it is not recognized.
+func videoObjectMode(v string) distribution.VideoObjectMode {
+	if v == "" {
+		return distribution.VideoObjectPerFrame
+	}
+	m, err := distribution.ParseVideoObjectMode(v)
+	if err != nil {
+		slog.Warn("ignoring invalid VIDEO_OBJECTS", "error", err)
+		return distribution.VideoObjectPerFrame
+	}
+	return m
+}
+
+// shedLevel parses the VIDEO_SHED_LEVEL name, logging and falling back to
+// no shedding if it is not recognized.
+func shedLevel(v string) distribution.ShedLevel {
+	if v == "" {
+		return distribution.ShedNone
+	}
+	l, err := distribution.ParseShedLevel(v)
+	if err != nil {
+		slog.Warn("ignoring invalid VIDEO_SHED_LEVEL", "error", err)
+		return distribution.ShedNone
+	}
+	return l
+}
+
+// timestampMode parses the CAPTURE_TIMESTAMPS name, logging and falling
+// back to the media clock if it is not recognized.
+func timestampMode(v string) distribution.TimestampMode {
+	if v == "" {
+		return distribution.TimestampMediaClock
+	}
+	m, err := distribution.ParseTimestampMode(v)
+	if err != nil {
+		slog.Warn("ignoring invalid CAPTURE_TIMESTAMPS", "error", err)
+		return distribution.TimestampMediaClock
+	}
+	return m
+}
+
+// duplicatePolicy parses the DUPLICATE_STREAM_POLICY name, logging and
+// falling back to the default if it is not recognized.
+func duplicatePolicy(v string) stream.DuplicatePolicy {
+	if v == "" {
+		return stream.DuplicateReject
+	}
+	p, err := stream.ParseDuplicatePolicy(v)
+	if err != nil {
+		slog.Warn("ignoring invalid DUPLICATE_STREAM_POLICY", "error", err)
+		return stream.DuplicateReject
+	}
+	return p
+}
+
+// videoOverflowPolicy parses the VIDEO_OVERFLOW policy name, logging and
+// falling back to the default if it is not recognized.
+func videoOverflowPolicy(v string) distribution.VideoOverflowPolicy {
+	if v == "" {
+		return distribution.VideoOverflowDropFrame
+	}
+	p, err := distribution.ParseVideoOverflowPolicy(v)
+	if err != nil {
+		slog.Warn("ignoring invalid VIDEO_OVERFLOW", "error", err)
+		return distribution.VideoOverflowDropFrame
+	}
+	return p
+}
+
+// parseHLSPulls parses HLS sources to pull at startup, of the form
+// "key=url,key2=url2". Malformed entries are logged and skipped.
+func parseHLSPulls(v string) []hlsingest.PullRequest {
+	var out []hlsingest.PullRequest
+	for _, entry := range strings.Split(v, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		key, u, ok := strings.Cut(entry, "=")
+		key, u = strings.TrimSpace(key), strings.TrimSpace(u)
+		if !ok || key == "" || u == "" {
+			slog.Warn("ignoring malformed HLS_PULL entry", "entry", entry)
+			continue
+		}
+		out = append(out, hlsingest.PullRequest{URL: u, StreamKey: key})
+	}
+	return out
+}
+
+// subscribeTokens returns an authorizer that accepts a viewer SUBSCRIBE
+// only if it carries one of the comma-separated tokens in v, or nil to
+// accept every SUBSCRIBE if v lists none.
+func subscribeTokens(v string) distribution.SubscribeAuthorizer {
+	check := tokenChecker(v, "invalid subscribe token")
+	if check == nil {
+		return nil
+	}
+	return func(_, _, token string) error { return check(token) }
+}
+
+// adminTokens returns an authorizer that accepts a control request only if
+// it carries one of the comma-separated tokens in v, or nil to accept
+// every request if v lists none.
+func adminTokens(v string) distribution.AdminAuthorizer {
+	return tokenChecker(v, "invalid admin token")
+}
+
+// tokenChecker returns a function that accepts one of the comma-separated
+// tokens in v and rejects anything else with reason, or nil if v lists
+// none.
+func tokenChecker(v, reason string) func(token string) error {
+	var tokens [][]byte
+	for _, t := range strings.Split(v, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			tokens = append(tokens, []byte(t))
+		}
+	}
+	if len(tokens) == 0 {
+		return nil
+	}
+	return func(token string) error {
+		for _, t := range tokens {
+			if subtle.ConstantTimeCompare([]byte(token), t) == 1 {
+				return nil
+			}
+		}
+		return errors.New(reason)
+	}
+}
+
+// parseCaptionChannels parses CEA-708 service to caption channel
+// overrides of the form "1=20:English,2=21", each mapping a service, 1 to
+// 6, to a channel and an optional label. Services not listed keep
+// demux.DefaultCaptionChannel. Malformed entries, and those that would
+// put a service on a CEA-608 channel or another service's channel, are
+// logged and skipped. It returns nil if nothing is overridden.
+func parseCaptionChannels(v string) demux.CaptionChannelFunc {
+	var channels [7]demux.CaptionChannel
+	for service := 1; service <= 6; service++ {
+		channels[service] = demux.DefaultCaptionChannel(service)
+	}
+	overridden := false
+	for _, entry := range strings.Split(v, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		svc, target, ok := strings.Cut(entry, "=")
+		chStr, label, _ := strings.Cut(target, ":")
+		service, err := strconv.Atoi(strings.TrimSpace(svc))
+		ch, err2 := strconv.Atoi(strings.TrimSpace(chStr))
+		if !ok || err != nil || err2 != nil || service < 1 || service > 6 || ch <= 4 || ch > 255 {
+			slog.Warn("ignoring malformed CAPTION_SERVICE_CHANNELS entry", "entry", entry)
+			continue
+		}
+		taken := false
+		for other := 1; other <= 6; other++ {
+			taken = taken || other != service && channels[other].Channel == ch
+		}
+		if taken {
+			slog.Warn("ignoring CAPTION_SERVICE_CHANNELS entry for a channel already in use", "entry", entry)
+			continue
+		}
+		channels[service] = demux.CaptionChannel{Channel: ch, Label: strings.TrimSpace(label)}
+		if channels[service].Label == "" {
+			channels[service].Label = demux.DefaultCaptionChannel(service).Label
+		}
+		overridden = true
+	}
+	if !overridden {
+		return nil
+	}
+	return func(service int) demux.CaptionChannel {
+		if service < 1 || service > 6 {
+			return demux.DefaultCaptionChannel(service)
+		}
+		return channels[service]
+	}
+}
+
+// parseTrackPriorities parses publisher priority overrides of the form
+// "audio=64,captions=100". Valid tracks are video, audio, captions, scte35
+// and stats; priorities run from 1 (highest) to 255. Malformed entries are
+// logged and skipped.
+func parseTrackPriorities(v string) distribution.TrackPriorities {
+	var p distribution.TrackPriorities
+	fields := map[string]*byte{
+		"video":    &p.Video,
+		"audio":    &p.Audio,
+		"captions": &p.Captions,
+		"scte35":   &p.SCTE35,
+		"stats":    &p.Stats,
+	}
+	for _, entry := range strings.Split(v, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		track, value, ok := strings.Cut(entry, "=")
+		dst, known := fields[strings.TrimSpace(track)]
+		n, err := strconv.ParseUint(strings.TrimSpace(value), 10, 8)
+		if !ok || !known || err != nil || n == 0 {
+			slog.Warn("ignoring malformed TRACK_PRIORITIES entry", "entry", entry)
+			continue
+		}
+		*dst = byte(n)
+	}
+	return p
+}
+
 func buildStreamDescription(info distribution.StreamInfo) string {
 	var parts []string
 
@@ -1,21 +1,70 @@
 package demux
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 // ErrInvalidADTS is returned when the ADTS sync word or header is malformed.
 var ErrInvalidADTS = errors.New("invalid ADTS header")
 
+// errInvalidASC is returned when an AudioSpecificConfig is truncated or
+// names an unknown sample rate.
+var errInvalidASC = errors.New("invalid AudioSpecificConfig")
+
 // AAC sample rate index table (ISO 14496-3)
 var aacSampleRates = [...]int{
 	96000, 88200, 64000, 48000, 44100, 32000, 24000, 22050,
 	16000, 12000, 11025, 8000, 7350,
 }
 
+// aacChannelCounts maps an ADTS channel_configuration to its channel
+// count. Configuration 0 defers to a program config element in the frame;
+// 7 is 7.1, so eight channels.
+var aacChannelCounts = [8]int{0, 1, 2, 3, 4, 5, 6, 8}
+
+// aacElementPCE is the syntactic element ID of a program_config_element.
+const aacElementPCE = 5
+
+// aacFrameSamples is the number of samples an AAC core frame codes. ADTS
+// always describes the core layer, so an HE-AAC frame whose SBR layer
+// doubles the output rate still spans 1024 samples at the ADTS rate.
+const aacFrameSamples = 1024
+
 // AACFrame represents a single AAC audio frame parsed from ADTS.
 type AACFrame struct {
 	Data       []byte // complete ADTS frame (header + payload)
 	SampleRate int
-	Channels   int
+
+	// Channels is the channel count. For channel configuration 0 it comes
+	// from the program config element the frame carries, such as a
+	// dual-mono pair of single channel elements, and is 0 if there is
+	// none.
+	Channels int
+
+	// ChannelConfig is the channel_configuration from the ADTS header.
+	ChannelConfig int
+
+	// SamplesPerFrame is the number of samples the frame spans at
+	// SampleRate.
+	SamplesPerFrame int
+}
+
+// frameDurationUS returns the playback duration of samples at sampleRate
+// in microseconds, or 0 if the sample rate is unknown.
+func frameDurationUS(samples, sampleRate int) int64 {
+	if sampleRate <= 0 {
+		return 0
+	}
+	return int64(samples) * 1_000_000 / int64(sampleRate)
+}
+
+// frameDuration90k is frameDurationUS in 90kHz ticks.
+func frameDuration90k(samples, sampleRate int) int64 {
+	if sampleRate <= 0 {
+		return 0
+	}
+	return int64(samples) * 90_000 / int64(sampleRate)
 }
 
 // ParseADTS parses an ADTS byte stream into individual AAC frames.
@@ -57,10 +106,17 @@ func ParseADTS(data []byte) ([]AACFrame, error) {
 			break // truncated
 		}
 
+		channels := aacChannelCounts[channelCfg]
+		if channelCfg == 0 {
+			channels, _ = pceChannels(data[offset+headerSize : offset+frameLen])
+		}
+
 		frames = append(frames, AACFrame{
-			Data:       data[offset : offset+frameLen],
-			SampleRate: aacSampleRates[sampleRateIdx],
-			Channels:   int(channelCfg),
+			Data:            data[offset : offset+frameLen],
+			SampleRate:      aacSampleRates[sampleRateIdx],
+			Channels:        channels,
+			ChannelConfig:   int(channelCfg),
+			SamplesPerFrame: aacFrameSamples,
 		})
 
 		offset += frameLen
@@ -68,3 +124,243 @@ func ParseADTS(data []byte) ([]AACFrame, error) {
 
 	return frames, nil
 }
+
+// pceChannels returns the channel count described by the
+// program_config_element (ISO 14496-3 4.4.1.1) at the start of raw, an
+// ADTS frame's raw_data_block. It reports false if raw does not start
+// with one or it is truncated.
+func pceChannels(raw []byte) (int, bool) {
+	br := newBitReader(raw)
+	var err error
+	read := func(n int) int {
+		if err != nil {
+			return 0
+		}
+		var v uint
+		v, err = br.readBits(n)
+		return int(v)
+	}
+
+	if read(3) != aacElementPCE {
+		return 0, false
+	}
+	read(4 + 2 + 4) // element_instance_tag, object_type, sampling_frequency_index
+	front, side, back := read(4), read(4), read(4)
+	lfe := read(2)
+	read(3 + 4) // num_assoc_data_elements, num_valid_cc_elements
+
+	// Optional mono, stereo and matrix mixdown fields.
+	for _, n := range []int{4, 4, 3} {
+		if read(1) == 1 {
+			read(n)
+		}
+	}
+
+	channels := lfe
+	for range front + side + back {
+		if read(1) == 1 { // is_cpe: a channel pair
+			channels += 2
+		} else {
+			channels++
+		}
+		read(4) // element_tag_select
+	}
+	if err != nil {
+		return 0, false
+	}
+	return channels, true
+}
+
+// ADTSHeader holds the fixed ADTS header fields needed to describe an AAC
+// stream to a decoder.
+type ADTSHeader struct {
+	ObjectType      int // MPEG-4 audio object type: ADTS profile + 1 (2 = AAC-LC)
+	SampleRateIndex int
+	SampleRate      int
+	ChannelConfig   int
+}
+
+// ParseADTSHeader parses the fixed header of the ADTS frame at the start
+// of data.
+func ParseADTSHeader(data []byte) (ADTSHeader, error) {
+	if len(data) < 7 || data[0] != 0xFF || data[1]&0xF0 != 0xF0 {
+		return ADTSHeader{}, ErrInvalidADTS
+	}
+	sampleRateIdx := int(data[2]>>2) & 0x0F
+	if sampleRateIdx >= len(aacSampleRates) {
+		return ADTSHeader{}, ErrInvalidADTS
+	}
+	return ADTSHeader{
+		ObjectType:      int(data[2]>>6) + 1,
+		SampleRateIndex: sampleRateIdx,
+		SampleRate:      aacSampleRates[sampleRateIdx],
+		ChannelConfig:   int(data[2]&0x01)<<2 | int(data[3]>>6),
+	}, nil
+}
+
+// AudioSpecificConfig returns the MPEG-4 AudioSpecificConfig (ISO 14496-3
+// 1.6.2.1) for the stream, the decoder configuration a WebCodecs
+// AudioDecoder needs for raw AAC.
+func (h ADTSHeader) AudioSpecificConfig() []byte {
+	return BuildAudioSpecificConfig(h.ObjectType, h.SampleRate, h.ChannelConfig)
+}
+
+// BuildAudioSpecificConfig encodes an AudioSpecificConfig with a default
+// GASpecificConfig (1024-sample frames, no core coder, no extension). The
+// common case is two bytes; object types of 31 and above use the escaped
+// form, and sample rates outside the standard table are written as an
+// explicit 24-bit frequency, lengthening the config accordingly.
+func BuildAudioSpecificConfig(objectType, sampleRate, channelConfig int) []byte {
+	var w bitWriter
+	if objectType >= 31 {
+		w.write(31, 5)
+		w.write(uint32(objectType-32), 6)
+	} else {
+		w.write(uint32(objectType), 5)
+	}
+
+	idx := -1
+	for i, r := range aacSampleRates {
+		if r == sampleRate {
+			idx = i
+			break
+		}
+	}
+	if idx >= 0 {
+		w.write(uint32(idx), 4)
+	} else {
+		w.write(0x0F, 4)
+		w.write(uint32(sampleRate), 24)
+	}
+
+	w.write(uint32(channelConfig), 4)
+	w.write(0, 3) // frameLengthFlag, dependsOnCoreCoder, extensionFlag
+	return w.bytes()
+}
+
+// MPEG-4 audio object types that signal SBR explicitly in an
+// AudioSpecificConfig (ISO 14496-3 1.6.2.1).
+const (
+	aotSBR = 5  // HE-AAC
+	aotPS  = 29 // HE-AAC v2
+)
+
+// audioConfig describes an AAC stream as signalled by an
+// AudioSpecificConfig. For HE-AAC, SampleRate and SamplesPerFrame describe
+// the SBR output, which runs at twice the core rate with twice the samples
+// per frame, so the frame duration matches the core layer's.
+type audioConfig struct {
+	ObjectType      int // core object type; 2 for AAC-LC and HE-AAC
+	SampleRate      int // output sample rate
+	ChannelConfig   int
+	SBR             bool // explicit SBR (HE-AAC or HE-AAC v2)
+	PS              bool // explicit PS (HE-AAC v2)
+	SamplesPerFrame int  // at SampleRate: 1024 or 960, doubled with SBR
+}
+
+// AACCodecString returns the RFC 6381 codec parameter string (e.g.
+// "mp4a.40.02") of the AAC stream an AudioSpecificConfig describes. Its
+// object type is the signalled one, so HE-AAC reads as "mp4a.40.05" and
+// HE-AAC v2 as "mp4a.40.29".
+func AACCodecString(asc []byte) (string, error) {
+	c, err := parseAudioSpecificConfig(asc)
+	if err != nil {
+		return "", err
+	}
+	aot := c.ObjectType
+	switch {
+	case c.PS:
+		aot = aotPS
+	case c.SBR:
+		aot = aotSBR
+	}
+	return fmt.Sprintf("mp4a.40.%02d", aot), nil
+}
+
+// parseAudioSpecificConfig parses the leading fields of an
+// AudioSpecificConfig, following explicit hierarchical SBR/PS signalling
+// to the core object type and output sample rate. Backward-compatible
+// (sync extension) signalling is not inspected; such streams read as
+// their core layer, which still yields the correct frame duration.
+func parseAudioSpecificConfig(data []byte) (audioConfig, error) {
+	br := newBitReader(data)
+	readObjectType := func() (int, error) {
+		aot, err := br.readBits(5)
+		if err != nil || aot != 31 {
+			return int(aot), err
+		}
+		ext, err := br.readBits(6)
+		return 32 + int(ext), err
+	}
+	readSampleRate := func() (int, error) {
+		idx, err := br.readBits(4)
+		if err != nil {
+			return 0, err
+		}
+		if idx == 0x0F {
+			rate, err := br.readBits(24)
+			return int(rate), err
+		}
+		if int(idx) >= len(aacSampleRates) {
+			return 0, errInvalidASC
+		}
+		return aacSampleRates[idx], nil
+	}
+
+	var c audioConfig
+	var err error
+	if c.ObjectType, err = readObjectType(); err != nil {
+		return audioConfig{}, errInvalidASC
+	}
+	if c.SampleRate, err = readSampleRate(); err != nil {
+		return audioConfig{}, errInvalidASC
+	}
+	channels, err := br.readBits(4)
+	if err != nil {
+		return audioConfig{}, errInvalidASC
+	}
+	c.ChannelConfig = int(channels)
+	if c.ObjectType == aotSBR || c.ObjectType == aotPS {
+		c.SBR, c.PS = true, c.ObjectType == aotPS
+		if c.SampleRate, err = readSampleRate(); err != nil {
+			return audioConfig{}, errInvalidASC
+		}
+		if c.ObjectType, err = readObjectType(); err != nil {
+			return audioConfig{}, errInvalidASC
+		}
+	}
+	frameLengthFlag, err := br.readBit()
+	if err != nil || c.SampleRate == 0 {
+		return audioConfig{}, errInvalidASC
+	}
+
+	c.SamplesPerFrame = aacFrameSamples
+	if frameLengthFlag == 1 {
+		c.SamplesPerFrame = 960
+	}
+	if c.SBR {
+		c.SamplesPerFrame *= 2
+	}
+	return c, nil
+}
+
+// bitWriter packs MSB-first bit fields into bytes.
+type bitWriter struct {
+	buf   []byte
+	nbits int
+}
+
+func (w *bitWriter) write(v uint32, n int) {
+	for i := n - 1; i >= 0; i-- {
+		if w.nbits%8 == 0 {
+			w.buf = append(w.buf, 0)
+		}
+		if v>>uint(i)&1 != 0 {
+			w.buf[len(w.buf)-1] |= 0x80 >> uint(w.nbits%8)
+		}
+		w.nbits++
+	}
+}
+
+// bytes returns the written bits, zero-padded to a whole byte.
+func (w *bitWriter) bytes() []byte { return w.buf }
@@ -1,6 +1,7 @@
 package demux
 
 import (
+	"bytes"
 	"testing"
 )
 
@@ -64,6 +65,94 @@ func TestParseADTS(t *testing.T) {
 	}
 }
 
+// buildADTS wraps payload in a 7-byte ADTS header (AAC-LC, 48kHz) with the
+// given channel configuration.
+func buildADTS(channelCfg int, payload []byte) []byte {
+	frameLen := 7 + len(payload)
+	return append([]byte{
+		0xFF, 0xF1,
+		1<<6 | 3<<2 | byte(channelCfg>>2),
+		byte(channelCfg&0x03)<<6 | byte(frameLen>>11)&0x03,
+		byte(frameLen >> 3),
+		byte(frameLen&0x07)<<5 | 0x1F,
+		0xFC,
+	}, payload...)
+}
+
+// packBits packs {value, width} pairs MSB first, zero-padding the last
+// byte.
+func packBits(fields ...[2]int) []byte {
+	var out []byte
+	n := 0
+	for _, f := range fields {
+		for i := f[1] - 1; i >= 0; i-- {
+			if n%8 == 0 {
+				out = append(out, 0)
+			}
+			out[len(out)-1] |= byte(f[0]>>i&1) << (7 - n%8)
+			n++
+		}
+	}
+	return out
+}
+
+// pce builds a raw data block starting with a program config element
+// with the given front and back elements (true for a channel pair) and
+// LFE count.
+func pce(front, back []bool, lfe int) []byte {
+	fields := [][2]int{
+		{aacElementPCE, 3},
+		{0, 4}, {1, 2}, {3, 4}, // tag, object type, sample rate
+		{len(front), 4}, {0, 4}, {len(back), 4}, {lfe, 2},
+		{0, 3}, {0, 4}, // assoc data, valid cc
+		{0, 1}, {0, 1}, {0, 1}, // no mixdowns
+	}
+	for i, cpe := range append(front, back...) {
+		isCPE := 0
+		if cpe {
+			isCPE = 1
+		}
+		fields = append(fields, [2]int{isCPE, 1}, [2]int{i, 4})
+	}
+	for i := range lfe {
+		fields = append(fields, [2]int{i, 4})
+	}
+	return append(packBits(fields...), 0xE0) // ID_END
+}
+
+func TestParseADTSChannels(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		frame        []byte
+		wantChannels int
+	}{
+		{"stereo", buildADTS(2, []byte{0x21, 0x00}), 2},
+		{"7.1", buildADTS(7, []byte{0x21, 0x00}), 8},
+		{"dual-mono PCE", buildADTS(0, pce([]bool{false, false}, nil, 0)), 2},
+		{"5.1 PCE", buildADTS(0, pce([]bool{false, true}, []bool{true}, 1)), 6},
+		{"no PCE", buildADTS(0, []byte{0x00, 0x00}), 0}, // starts with an SCE
+		{"truncated PCE", buildADTS(0, []byte{0xA0}), 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			frames, err := ParseADTS(tt.frame)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(frames) != 1 {
+				t.Fatalf("parsed %d frames, want 1", len(frames))
+			}
+			if frames[0].Channels != tt.wantChannels {
+				t.Errorf("Channels = %d, want %d", frames[0].Channels, tt.wantChannels)
+			}
+		})
+	}
+}
+
 func TestParseADTSEmpty(t *testing.T) {
 	t.Parallel()
 	frames, err := ParseADTS(nil)
@@ -88,3 +177,189 @@ func TestParseADTSTruncated(t *testing.T) {
 		t.Errorf("expected 0 frames for truncated input, got %d", len(frames))
 	}
 }
+
+func TestParseADTSHeader(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		header  []byte
+		want    ADTSHeader
+		wantASC []byte
+	}{
+		{
+			name:    "AAC-LC 48kHz stereo",
+			header:  []byte{0xFF, 0xF1, 0x4C, 0x80, 0x01, 0x7F, 0xFC},
+			want:    ADTSHeader{ObjectType: 2, SampleRateIndex: 3, SampleRate: 48000, ChannelConfig: 2},
+			wantASC: []byte{0x11, 0x90},
+		},
+		{
+			name:    "AAC-LC 44.1kHz 5.1",
+			header:  []byte{0xFF, 0xF9, 0x51, 0x80, 0x01, 0x7F, 0xFC},
+			want:    ADTSHeader{ObjectType: 2, SampleRateIndex: 4, SampleRate: 44100, ChannelConfig: 6},
+			wantASC: []byte{0x12, 0x30},
+		},
+		{
+			name:    "AAC Main 22.05kHz mono",
+			header:  []byte{0xFF, 0xF1, 0x1C, 0x40, 0x01, 0x7F, 0xFC},
+			want:    ADTSHeader{ObjectType: 1, SampleRateIndex: 7, SampleRate: 22050, ChannelConfig: 1},
+			wantASC: []byte{0x0B, 0x88},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := ParseADTSHeader(tt.header)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("ParseADTSHeader = %+v, want %+v", got, tt.want)
+			}
+			if asc := got.AudioSpecificConfig(); !bytes.Equal(asc, tt.wantASC) {
+				t.Fatalf("AudioSpecificConfig = % x, want % x", asc, tt.wantASC)
+			}
+		})
+	}
+}
+
+func TestParseADTSHeaderInvalid(t *testing.T) {
+	t.Parallel()
+
+	for _, data := range [][]byte{
+		nil,
+		{0xFF, 0xF1, 0x4C}, // truncated
+		{0x00, 0xF1, 0x4C, 0x80, 0x01, 0x7F, 0xFC}, // bad sync word
+		{0xFF, 0xF1, 0x7C, 0x80, 0x01, 0x7F, 0xFC}, // reserved sample rate index 15
+	} {
+		if _, err := ParseADTSHeader(data); err != ErrInvalidADTS {
+			t.Errorf("ParseADTSHeader(% x) error = %v, want ErrInvalidADTS", data, err)
+		}
+	}
+}
+
+func TestBuildAudioSpecificConfig(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		objectType int
+		sampleRate int
+		channels   int
+		want       []byte
+	}{
+		{"LC 48kHz stereo", 2, 48000, 2, []byte{0x11, 0x90}},
+		{"LC 44.1kHz stereo", 2, 44100, 2, []byte{0x12, 0x10}},
+		{"LC 22.05kHz mono", 2, 22050, 1, []byte{0x13, 0x88}},
+		{"LC 8kHz 5.1", 2, 8000, 6, []byte{0x15, 0xB0}},
+		{"SBR 24kHz stereo", 5, 24000, 2, []byte{0x2B, 0x10}},
+		{"Main 96kHz 7.1", 1, 96000, 7, []byte{0x08, 0x38}},
+		{"explicit frequency", 2, 50000, 2, []byte{0x17, 0x80, 0x61, 0xA8, 0x10}},
+		{"escaped object type", 42, 48000, 2, []byte{0xF9, 0x46, 0x40}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got := BuildAudioSpecificConfig(tt.objectType, tt.sampleRate, tt.channels)
+			if !bytes.Equal(got, tt.want) {
+				t.Fatalf("BuildAudioSpecificConfig(%d, %d, %d) = % x, want % x",
+					tt.objectType, tt.sampleRate, tt.channels, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseAudioSpecificConfig(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		asc        []byte
+		want       audioConfig
+		durationUS int64
+	}{
+		{
+			name:       "LC 48kHz stereo",
+			asc:        []byte{0x11, 0x90},
+			want:       audioConfig{ObjectType: 2, SampleRate: 48000, ChannelConfig: 2, SamplesPerFrame: 1024},
+			durationUS: 21333,
+		},
+		{
+			name:       "LC 960-sample frames",
+			asc:        []byte{0x11, 0x94},
+			want:       audioConfig{ObjectType: 2, SampleRate: 48000, ChannelConfig: 2, SamplesPerFrame: 960},
+			durationUS: 20000,
+		},
+		{
+			name:       "HE-AAC 24kHz core, 48kHz output",
+			asc:        []byte{0x2B, 0x11, 0x88, 0x00},
+			want:       audioConfig{ObjectType: 2, SampleRate: 48000, ChannelConfig: 2, SBR: true, SamplesPerFrame: 2048},
+			durationUS: 42666,
+		},
+		{
+			name:       "HE-AAC v2 mono core",
+			asc:        []byte{0xEB, 0x09, 0x88, 0x00},
+			want:       audioConfig{ObjectType: 2, SampleRate: 48000, ChannelConfig: 1, SBR: true, PS: true, SamplesPerFrame: 2048},
+			durationUS: 42666,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := parseAudioSpecificConfig(tt.asc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("parseAudioSpecificConfig(% x) = %+v, want %+v", tt.asc, got, tt.want)
+			}
+			if d := frameDurationUS(got.SamplesPerFrame, got.SampleRate); d != tt.durationUS {
+				t.Errorf("frame duration = %d, want %d", d, tt.durationUS)
+			}
+		})
+	}
+}
+
+func TestAACCodecString(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		asc  []byte
+		want string
+	}{
+		{"AAC-LC", []byte{0x11, 0x90}, "mp4a.40.02"},
+		{"AAC Main", []byte{0x09, 0x90}, "mp4a.40.01"},
+		{"HE-AAC", []byte{0x2B, 0x11, 0x88, 0x00}, "mp4a.40.05"},
+		{"HE-AAC v2", []byte{0xEB, 0x09, 0x88, 0x00}, "mp4a.40.29"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := AACCodecString(tt.asc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("AACCodecString(% x) = %q, want %q", tt.asc, got, tt.want)
+			}
+		})
+	}
+	if _, err := AACCodecString(nil); err == nil {
+		t.Error("AACCodecString(nil) succeeded")
+	}
+}
+
+func TestParseAudioSpecificConfigInvalid(t *testing.T) {
+	t.Parallel()
+	for _, asc := range [][]byte{
+		nil,
+		{0x11},       // truncated before the channel config
+		{0x16, 0x90}, // reserved sample rate index 13
+		{0x2B, 0x11}, // SBR without its extension fields
+	} {
+		if _, err := parseAudioSpecificConfig(asc); err != errInvalidASC {
+			t.Errorf("parseAudioSpecificConfig(% x) error = %v, want errInvalidASC", asc, err)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package demux
+
+import "errors"
+
+// ErrInvalidAC3 is returned when an AC-3 or E-AC-3 sync frame header is
+// malformed.
+var ErrInvalidAC3 = errors.New("invalid AC-3 header")
+
+// ac3SyncWord starts every AC-3 and E-AC-3 sync frame.
+const ac3SyncWord = 0x0B77
+
+// AC-3 sample rates by fscod (ATSC A/52 5.4.1.3). E-AC-3 adds the
+// reduced rates, selected by fscod2 when fscod is 3 (A/52 E.1.3.1.2).
+var (
+	ac3SampleRates     = [3]int{48000, 44100, 32000}
+	eac3ReducedRates   = [3]int{24000, 22050, 16000}
+	ac3BitratesKbps    = [19]int{32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384, 448, 512, 576, 640}
+	eac3BlocksPerFrame = [4]int{1, 2, 3, 6}
+)
+
+// ac3ChannelCounts maps acmod to the number of full-bandwidth channels;
+// acmod 0 is a dual-mono pair (A/52 5.4.2.3).
+var ac3ChannelCounts = [8]int{2, 1, 2, 3, 3, 4, 4, 5}
+
+// Bitstream identifiers: AC-3 uses 10 and below, E-AC-3 11 through 16.
+const (
+	ac3MaxBSID  = 10
+	eac3MaxBSID = 16
+)
+
+// eac3StreamDependent is the E-AC-3 strmtyp of a dependent substream,
+// which extends the independent substream before it (such as the extra
+// channels of 7.1) and is not decodable alone.
+const eac3StreamDependent = 1
+
+// ac3BlockSamples is the number of samples one audio block codes. An
+// AC-3 frame always holds six blocks; an E-AC-3 frame one to six.
+const ac3BlockSamples = 256
+
+// AC3Frame represents a single AC-3 or E-AC-3 sync frame.
+type AC3Frame struct {
+	// Data is the complete sync frame. For E-AC-3 it includes any
+	// dependent substreams that follow it, which belong to the same
+	// access unit.
+	Data       []byte
+	SampleRate int
+
+	// Channels is the channel count of the independent substream,
+	// including the LFE channel.
+	Channels int
+
+	// Enhanced reports an E-AC-3 frame.
+	Enhanced bool
+
+	// SamplesPerFrame is the number of samples the frame spans at
+	// SampleRate.
+	SamplesPerFrame int
+}
+
+// DurationUS returns the playback duration of the frame in microseconds,
+// or 0 if the sample rate is unknown.
+func (f AC3Frame) DurationUS() int64 {
+	return frameDurationUS(f.SamplesPerFrame, f.SampleRate)
+}
+
+// ParseAC3 parses a byte stream of AC-3 or E-AC-3 sync frames, such as
+// the payload of an ATSC AC-3 (stream type 0x81) or E-AC-3 (0x87) PES
+// packet. Bytes before a sync word are skipped and a truncated final
+// frame is dropped.
+func ParseAC3(data []byte) ([]AC3Frame, error) {
+	var frames []AC3Frame
+	offset, end := 0, 0 // end is where frames' last entry ends
+
+	for offset < len(data) {
+		if len(data)-offset < 8 {
+			break // not enough for the header
+		}
+		if int(data[offset])<<8|int(data[offset+1]) != ac3SyncWord {
+			offset++
+			continue
+		}
+
+		frame, frameLen, dependent, err := parseAC3Header(data[offset:])
+		if err != nil {
+			return frames, err
+		}
+		if offset+frameLen > len(data) {
+			break // truncated
+		}
+
+		if dependent {
+			// Dependent substreams extend the frame directly before them;
+			// one without such an E-AC-3 frame cannot be decoded.
+			if n := len(frames); n > 0 && frames[n-1].Enhanced && end == offset {
+				prev := &frames[n-1]
+				prev.Data = prev.Data[:len(prev.Data)+frameLen]
+				end = offset + frameLen
+			}
+		} else {
+			frame.Data = data[offset : offset+frameLen]
+			frames = append(frames, frame)
+			end = offset + frameLen
+		}
+		offset += frameLen
+	}
+
+	return frames, nil
+}
+
+// parseAC3Header parses the sync frame header at the start of data, which
+// starts with the sync word, returning the frame's parameters, its length
+// in bytes and whether it is an E-AC-3 dependent substream.
+func parseAC3Header(data []byte) (AC3Frame, int, bool, error) {
+	bsid := int(data[5] >> 3)
+	switch {
+	case bsid <= ac3MaxBSID:
+		return parseAC3SyncInfo(data)
+	case bsid <= eac3MaxBSID:
+		return parseEAC3SyncInfo(data)
+	}
+	return AC3Frame{}, 0, false, ErrInvalidAC3
+}
+
+// parseAC3SyncInfo parses an AC-3 syncinfo and the start of its bsi
+// (A/52 5.3.1, 5.3.2).
+func parseAC3SyncInfo(data []byte) (AC3Frame, int, bool, error) {
+	br := newBitReader(data[4:])
+	var err error
+	read := func(n int) int {
+		if err != nil {
+			return 0
+		}
+		var v uint
+		v, err = br.readBits(n)
+		return int(v)
+	}
+
+	fscod, frmsizecod := read(2), read(6)
+	read(5 + 3) // bsid, bsmod
+	acmod := read(3)
+	if acmod&1 != 0 && acmod != 1 {
+		read(2) // cmixlev
+	}
+	if acmod&4 != 0 {
+		read(2) // surmixlev
+	}
+	if acmod == 2 {
+		read(2) // dsurmod
+	}
+	lfeon := read(1)
+	if err != nil || fscod >= len(ac3SampleRates) || frmsizecod/2 >= len(ac3BitratesKbps) {
+		return AC3Frame{}, 0, false, ErrInvalidAC3
+	}
+
+	return AC3Frame{
+		SampleRate:      ac3SampleRates[fscod],
+		Channels:        ac3ChannelCounts[acmod] + lfeon,
+		SamplesPerFrame: 6 * ac3BlockSamples,
+	}, ac3FrameSize(fscod, frmsizecod), false, nil
+}
+
+// ac3FrameSize returns the length in bytes of an AC-3 frame (A/52 Table
+// 5.18). A frame carries 1536 samples, so its size in 16-bit words is
+// the bitrate times 1536 / 16 over the sample rate; at 44.1kHz that is
+// fractional and frames alternate between the sizes either side of it.
+func ac3FrameSize(fscod, frmsizecod int) int {
+	kbps := ac3BitratesKbps[frmsizecod/2]
+	var words int
+	switch fscod {
+	case 0: // 48kHz
+		words = kbps * 2
+	case 1: // 44.1kHz
+		words = kbps*96000/44100 + frmsizecod&1
+	default: // 32kHz
+		words = kbps * 3
+	}
+	return words * 2
+}
+
+// parseEAC3SyncInfo parses the start of an E-AC-3 bsi (A/52 E.1.2.2).
+func parseEAC3SyncInfo(data []byte) (AC3Frame, int, bool, error) {
+	br := newBitReader(data[2:])
+	var err error
+	read := func(n int) int {
+		if err != nil {
+			return 0
+		}
+		var v uint
+		v, err = br.readBits(n)
+		return int(v)
+	}
+
+	strmtyp := read(2)
+	read(3) // substreamid
+	frmsiz := read(11)
+	fscod := read(2)
+	sampleRate, blocks := 0, 6
+	if fscod == 3 {
+		fscod2 := read(2)
+		if fscod2 < len(eac3ReducedRates) {
+			sampleRate = eac3ReducedRates[fscod2]
+		}
+	} else {
+		sampleRate = ac3SampleRates[fscod]
+		blocks = eac3BlocksPerFrame[read(2)]
+	}
+	acmod, lfeon := read(3), read(1)
+	if err != nil || sampleRate == 0 {
+		return AC3Frame{}, 0, false, ErrInvalidAC3
+	}
+
+	return AC3Frame{
+		SampleRate:      sampleRate,
+		Channels:        ac3ChannelCounts[acmod] + lfeon,
+		Enhanced:        true,
+		SamplesPerFrame: blocks * ac3BlockSamples,
+	}, (frmsiz + 1) * 2, strmtyp == eac3StreamDependent, nil
+}
@@ -0,0 +1,224 @@
+package demux
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/zsiec/prism/media"
+	"github.com/zsiec/prism/mpegts"
+)
+
+// ac3SyncFrame returns an AC-3 sync frame with the given syncinfo and
+// channel layout, zero-filled to its full frmsizecod length.
+func ac3SyncFrame(fscod, frmsizecod, acmod, lfeon uint32) []byte {
+	var w bitWriter
+	w.write(ac3SyncWord, 16)
+	w.write(0, 16) // crc1
+	w.write(fscod, 2)
+	w.write(frmsizecod, 6)
+	w.write(8, 5) // bsid
+	w.write(0, 3) // bsmod
+	w.write(acmod, 3)
+	if acmod&1 != 0 && acmod != 1 {
+		w.write(0, 2) // cmixlev
+	}
+	if acmod&4 != 0 {
+		w.write(0, 2) // surmixlev
+	}
+	if acmod == 2 {
+		w.write(0, 2) // dsurmod
+	}
+	w.write(lfeon, 1)
+	hdr := w.bytes()
+
+	size := 256 // enough for the header when frmsizecod is out of range
+	if fscod < 3 && frmsizecod < 38 {
+		size = ac3FrameSize(int(fscod), int(frmsizecod))
+	}
+	return append(hdr, make([]byte, size-len(hdr))...)
+}
+
+// eac3SyncFrame returns an E-AC-3 sync frame of size bytes. fscod 3
+// selects the reduced rate fscod2 in place of numblkscod.
+func eac3SyncFrame(strmtyp, fscod, fscod2OrBlocks, acmod, lfeon uint32, size int) []byte {
+	var w bitWriter
+	w.write(ac3SyncWord, 16)
+	w.write(strmtyp, 2)
+	w.write(0, 3) // substreamid
+	w.write(uint32(size/2-1), 11)
+	w.write(fscod, 2)
+	w.write(fscod2OrBlocks, 2)
+	w.write(acmod, 3)
+	w.write(lfeon, 1)
+	w.write(16, 5) // bsid
+	hdr := w.bytes()
+	return append(hdr, make([]byte, size-len(hdr))...)
+}
+
+func TestParseAC3(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		data     []byte
+		rate     int
+		channels int
+		samples  int
+		enhanced bool
+		size     int
+	}{
+		{"AC-3 48kHz stereo", ac3SyncFrame(0, 28, 2, 0), 48000, 2, 1536, false, 1536},
+		{"AC-3 48kHz 2.1", ac3SyncFrame(0, 28, 2, 1), 48000, 3, 1536, false, 1536},
+		{"AC-3 32kHz 5.1", ac3SyncFrame(2, 30, 7, 1), 32000, 6, 1536, false, 2688},
+		{"AC-3 44.1kHz mono padded", ac3SyncFrame(1, 1, 1, 0), 44100, 1, 1536, false, 140},
+		{"AC-3 dual mono", ac3SyncFrame(0, 0, 0, 0), 48000, 2, 1536, false, 128},
+		{"E-AC-3 48kHz 5.1", eac3SyncFrame(0, 0, 3, 7, 1, 1024), 48000, 6, 1536, true, 1024},
+		{"E-AC-3 one block", eac3SyncFrame(0, 0, 0, 2, 0, 256), 48000, 2, 256, true, 256},
+		{"E-AC-3 22.05kHz", eac3SyncFrame(0, 3, 1, 2, 0, 512), 22050, 2, 1536, true, 512},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			frames, err := ParseAC3(tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(frames) != 1 {
+				t.Fatalf("frames = %d, want 1", len(frames))
+			}
+			f := frames[0]
+			if f.SampleRate != tt.rate || f.Channels != tt.channels || f.SamplesPerFrame != tt.samples ||
+				f.Enhanced != tt.enhanced || len(f.Data) != tt.size {
+				t.Errorf("frame = {rate %d, channels %d, samples %d, enhanced %v, %d bytes}, want {%d, %d, %d, %v, %d bytes}",
+					f.SampleRate, f.Channels, f.SamplesPerFrame, f.Enhanced, len(f.Data),
+					tt.rate, tt.channels, tt.samples, tt.enhanced, tt.size)
+			}
+		})
+	}
+}
+
+func TestParseAC3Stream(t *testing.T) {
+	t.Parallel()
+
+	first, second := ac3SyncFrame(0, 8, 2, 0), ac3SyncFrame(0, 8, 2, 0)
+	second[4+3] = 0xAA // tell the frames apart
+	var data []byte
+	data = append(data, 0x00, 0x0B) // junk before the first sync word
+	data = append(data, first...)
+	data = append(data, second...)
+	data = append(data, ac3SyncFrame(0, 8, 2, 0)[:100]...) // truncated
+
+	frames, err := ParseAC3(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) != 2 {
+		t.Fatalf("frames = %d, want 2", len(frames))
+	}
+	if !bytes.Equal(frames[0].Data, first) || !bytes.Equal(frames[1].Data, second) {
+		t.Error("frame data does not match the sync frames")
+	}
+	if got := frames[0].DurationUS(); got != 32000 {
+		t.Errorf("DurationUS = %d, want 32000", got)
+	}
+}
+
+func TestParseAC3DependentSubstream(t *testing.T) {
+	t.Parallel()
+
+	independent := eac3SyncFrame(0, 0, 3, 7, 1, 512)
+	dependent := eac3SyncFrame(eac3StreamDependent, 0, 3, 2, 0, 256)
+	data := append(append(append([]byte(nil), independent...), dependent...), independent...)
+
+	frames, err := ParseAC3(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) != 2 {
+		t.Fatalf("frames = %d, want 2", len(frames))
+	}
+	if want := len(independent) + len(dependent); len(frames[0].Data) != want {
+		t.Errorf("first frame = %d bytes, want %d with its dependent substream", len(frames[0].Data), want)
+	}
+	if frames[0].Channels != 6 {
+		t.Errorf("channels = %d, want the independent substream's 6", frames[0].Channels)
+	}
+
+	// A dependent substream with no frame before it is dropped.
+	frames, err = ParseAC3(dependent)
+	if err != nil || len(frames) != 0 {
+		t.Errorf("lone dependent substream: %d frames, err %v; want none", len(frames), err)
+	}
+}
+
+func TestParseAC3Invalid(t *testing.T) {
+	t.Parallel()
+
+	badRate := ac3SyncFrame(0, 8, 2, 0)
+	badRate[4] |= 0xC0 // fscod 3 is reserved in AC-3
+	badSize := ac3SyncFrame(0, 8, 2, 0)
+	badSize[4] = badSize[4]&0xC0 | 38 // frmsizecod beyond the table
+	badBSID := ac3SyncFrame(0, 8, 2, 0)
+	badBSID[5] = 20 << 3
+
+	for name, data := range map[string][]byte{
+		"reserved fscod":  badRate,
+		"bad frmsizecod":  badSize,
+		"unknown bsid":    badBSID,
+		"reserved fscod2": eac3SyncFrame(0, 3, 3, 2, 0, 256),
+	} {
+		if _, err := ParseAC3(data); !errors.Is(err, ErrInvalidAC3) {
+			t.Errorf("%s: err = %v, want ErrInvalidAC3", name, err)
+		}
+	}
+}
+
+func TestDemuxerAC3(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		streamType uint8
+		frame      []byte
+		codec      string
+		step       int64 // microseconds between frames
+	}{
+		{"AC-3", mpegts.StreamTypeAC3, ac3SyncFrame(0, 8, 7, 1), media.AudioCodecAC3, 32000},
+		{"E-AC-3", mpegts.StreamTypeEAC3, eac3SyncFrame(0, 0, 1, 2, 0, 256), media.AudioCodecEAC3, 10666},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var buf bytes.Buffer
+			mux := mpegts.NewMuxer(&buf, mpegts.MuxStream{PID: 0x101, StreamType: tt.streamType})
+			if err := mux.WritePSI(); err != nil {
+				t.Fatal(err)
+			}
+			pes := append(append([]byte(nil), tt.frame...), tt.frame...)
+			if err := mux.WriteAccessUnit(0x101, 90000, 90000, false, pes); err != nil {
+				t.Fatal(err)
+			}
+
+			d := NewDemuxer(&buf, nil)
+			if err := d.Run(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if tracks := d.AudioTrackChannels(); len(tracks) != 1 || tracks[0].Codec != tt.codec {
+				t.Fatalf("audio tracks = %+v, want one %s track", tracks, tt.codec)
+			}
+			for i := range 2 {
+				f := <-d.Audio()
+				if f.Codec != tt.codec || !bytes.Equal(f.Data, tt.frame) {
+					t.Errorf("frame %d: codec %q, %d bytes; want %q, %d bytes", i, f.Codec, len(f.Data), tt.codec, len(tt.frame))
+				}
+				if want := 1_000_000 + int64(i)*tt.step; f.PTS != want {
+					t.Errorf("frame %d: PTS = %d, want %d", i, f.PTS, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package demux
+
+import "fmt"
+
+// AFD is an Active Format Description code (SMPTE ST 2016-1): the aspect
+// ratio and position of the active picture within the coded frame, so a
+// player can letterbox or pillarbox it rather than stretch it.
+type AFD uint8
+
+const (
+	AFDBox16x9Top      AFD = 2
+	AFDBox14x9Top      AFD = 3
+	AFDBoxWideCenter   AFD = 4
+	AFDFullFrame       AFD = 8
+	AFD4x3Center       AFD = 9
+	AFD16x9Center      AFD = 10
+	AFD14x9Center      AFD = 11
+	AFD4x3Protect14x9  AFD = 13
+	AFD16x9Protect14x9 AFD = 14
+	AFD16x9Protect4x3  AFD = 15
+)
+
+var afdNames = map[AFD]string{
+	AFDBox16x9Top:      "16:9 top",
+	AFDBox14x9Top:      "14:9 top",
+	AFDBoxWideCenter:   ">16:9 center",
+	AFDFullFrame:       "full frame",
+	AFD4x3Center:       "4:3 center",
+	AFD16x9Center:      "16:9 center",
+	AFD14x9Center:      "14:9 center",
+	AFD4x3Protect14x9:  "4:3, 14:9 protected",
+	AFD16x9Protect14x9: "16:9, 14:9 protected",
+	AFD16x9Protect4x3:  "16:9, 4:3 protected",
+}
+
+// String describes the active picture, such as "4:3 center" for a 4:3
+// picture pillarboxed in a 16:9 frame.
+func (a AFD) String() string {
+	if name, ok := afdNames[a]; ok {
+		return name
+	}
+	return fmt.Sprintf("AFD(%d)", uint8(a))
+}
+
+// BarData is the ATSC A/53 bar_data of a picture: the extent of the
+// letterbox bars above and below the active picture, or of the pillarbox
+// bars beside it. A bar the data does not signal is -1.
+type BarData struct {
+	TopEnd      int `json:"topEnd"`      // last line of the top bar
+	BottomStart int `json:"bottomStart"` // first line of the bottom bar
+	LeftEnd     int `json:"leftEnd"`     // last pixel of the left bar
+	RightStart  int `json:"rightStart"`  // first pixel of the right bar
+}
+
+// user_identifiers of ITU-T T.35 SEI messages registered by ATSC, and the
+// A/53 user_data_type_code of bar data.
+const (
+	userIdentifierATSC = "GA94" // A/53 captions and bar data
+	userIdentifierAFD  = "DTG1" // active format description
+
+	userDataTypeBarData = 0x06
+)
+
+// ParseAFDSEI extracts the active_format of an AFD message in an H.264 or
+// H.265 SEI NAL unit whose header is hdrLen bytes. It returns false if
+// there is no AFD message or it leaves the format unset.
+func ParseAFDSEI(seiNALU []byte, hdrLen int) (AFD, bool) {
+	var afd AFD
+	var found bool
+	forEachATSCUserData(seiNALU, hdrLen, func(userID string, data []byte) bool {
+		if userID != userIdentifierAFD || len(data) < 1 {
+			return true
+		}
+		// afd_data: '0', active_format_flag, then '000001'; with the flag,
+		// '1111' and the 4-bit active_format.
+		if data[0]&0x40 != 0 && len(data) >= 2 {
+			afd, found = AFD(data[1]&0x0F), true
+		}
+		return false
+	})
+	return afd, found
+}
+
+// ParseBarDataSEI extracts the A/53 bar_data of an H.264 or H.265 SEI NAL
+// unit whose header is hdrLen bytes. It returns false if there is none or
+// it signals no bars.
+func ParseBarDataSEI(seiNALU []byte, hdrLen int) (BarData, bool) {
+	var bars BarData
+	var found bool
+	forEachATSCUserData(seiNALU, hdrLen, func(userID string, data []byte) bool {
+		if userID != userIdentifierATSC || len(data) < 2 || data[0] != userDataTypeBarData {
+			return true
+		}
+		bars, found = parseBarData(data[1:])
+		return false
+	})
+	return bars, found
+}
+
+// parseBarData parses a bar_data() structure: four flags for the top,
+// bottom, left and right bars, then a '11' marker and 14-bit value for each
+// bar flagged.
+func parseBarData(b []byte) (BarData, bool) {
+	bars := BarData{TopEnd: -1, BottomStart: -1, LeftEnd: -1, RightStart: -1}
+	flags := b[0] >> 4
+	if flags == 0 {
+		return bars, false
+	}
+	b = b[1:]
+	for i, v := range []*int{&bars.TopEnd, &bars.BottomStart, &bars.LeftEnd, &bars.RightStart} {
+		if flags&(0x8>>i) == 0 {
+			continue
+		}
+		if len(b) < 2 {
+			return bars, false
+		}
+		*v = int(b[0]&0x3F)<<8 | int(b[1])
+		b = b[2:]
+	}
+	return bars, true
+}
+
+// forEachATSCUserData walks the user_data_registered_itu_t_t35 messages
+// of an SEI NAL unit whose header is hdrLen bytes, calling fn with the
+// user_identifier and the data after it of each one registered by ATSC,
+// until fn returns false.
+func forEachATSCUserData(seiNALU []byte, hdrLen int, fn func(userID string, data []byte) bool) {
+	if len(seiNALU) <= hdrLen {
+		return
+	}
+	forEachSEIMessage(seiNALU[hdrLen:], func(payloadType int, payload []byte) bool {
+		if payloadType != seiPayloadUserDataRegistered {
+			return true
+		}
+		// itu_t_t35_country_code United States, then the ATSC provider
+		// code and a 4-byte user_identifier.
+		if len(payload) < 7 || payload[0] != 0xB5 || payload[1] != 0x00 || payload[2] != 0x31 {
+			return true
+		}
+		return fn(string(payload[3:7]), payload[7:])
+	})
+}
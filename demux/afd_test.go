@@ -0,0 +1,89 @@
+package demux
+
+import "testing"
+
+// t35SEI returns an SEI NAL unit with the given header holding one
+// user_data_registered_itu_t_t35 message registered by ATSC.
+func t35SEI(header []byte, userID string, data ...byte) []byte {
+	payload := append([]byte{0xB5, 0x00, 0x31}, userID...)
+	payload = append(payload, data...)
+	nal := append(append([]byte(nil), header...), seiPayloadUserDataRegistered, byte(len(payload)))
+	nal = append(nal, payload...)
+	return append(nal, 0x80)
+}
+
+func TestParseAFDSEI(t *testing.T) {
+	t.Parallel()
+	h264 := []byte{0x06}
+	hevc := []byte{0x4E, 0x01}
+
+	tests := []struct {
+		name   string
+		nal    []byte
+		hdrLen int
+		want   AFD
+		ok     bool
+		str    string
+	}{
+		{"4:3 center", t35SEI(h264, "DTG1", 0x41, 0xF9), 1, AFD4x3Center, true, "4:3 center"},
+		{"H.265", t35SEI(hevc, "DTG1", 0x41, 0xF8), 2, AFDFullFrame, true, "full frame"},
+		{"flag clear", t35SEI(h264, "DTG1", 0x01), 1, 0, false, ""},
+		{"captions only", t35SEI(h264, "GA94", 0x03, 0x40, 0xFF), 1, 0, false, ""},
+		{"other provider", []byte{0x06, 0x04, 0x06, 0xB5, 0x00, 0x2F, 'D', 'T', 'G', 0x80}, 1, 0, false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, ok := ParseAFDSEI(tt.nal, tt.hdrLen)
+			if ok != tt.ok || got != tt.want {
+				t.Fatalf("got %d, %v; want %d, %v", got, ok, tt.want, tt.ok)
+			}
+			if ok && got.String() != tt.str {
+				t.Errorf("String() = %q, want %q", got.String(), tt.str)
+			}
+		})
+	}
+}
+
+func TestParseBarDataSEI(t *testing.T) {
+	t.Parallel()
+	h264 := []byte{0x06}
+
+	tests := []struct {
+		name string
+		nal  []byte
+		want BarData
+		ok   bool
+	}{
+		{
+			// 1080-line letterbox of a 2.39:1 picture: bars end at line 131
+			// and start at line 948.
+			name: "letterbox",
+			nal:  t35SEI(h264, "GA94", 0x06, 0xCF, 0xC0, 0x83, 0xC3, 0xB4),
+			want: BarData{TopEnd: 131, BottomStart: 948, LeftEnd: -1, RightStart: -1},
+			ok:   true,
+		},
+		{
+			// 4:3 pillarbox in 1920 pixels.
+			name: "pillarbox",
+			nal:  t35SEI(h264, "GA94", 0x06, 0x3F, 0xC0, 0xEF, 0xC6, 0x90),
+			want: BarData{TopEnd: -1, BottomStart: -1, LeftEnd: 239, RightStart: 1680},
+			ok:   true,
+		},
+		{"no bars", t35SEI(h264, "GA94", 0x06, 0x0F), BarData{}, false},
+		{"truncated", t35SEI(h264, "GA94", 0x06, 0xCF, 0xC0, 0x83), BarData{}, false},
+		{"captions", t35SEI(h264, "GA94", 0x03, 0x40, 0xFF), BarData{}, false},
+		{"AFD", t35SEI(h264, "DTG1", 0x41, 0xF9), BarData{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, ok := ParseBarDataSEI(tt.nal, 1)
+			if ok != tt.ok || ok && got != tt.want {
+				t.Fatalf("got %+v, %v; want %+v, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
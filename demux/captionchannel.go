@@ -0,0 +1,22 @@
+package demux
+
+import "fmt"
+
+// CaptionChannel is where the captions of a CEA-708 service are emitted:
+// the Channel of their caption frames, numbered alongside the CEA-608
+// channels CC1 to CC4, and a label for players to show.
+type CaptionChannel struct {
+	Channel int    `json:"channel"`
+	Label   string `json:"label,omitempty"`
+}
+
+// CaptionChannelFunc maps a CEA-708 service number, 1 to 6, to its
+// caption channel. It must not map two services to the same channel, or
+// to a CEA-608 channel, 1 to 4.
+type CaptionChannelFunc func(service int) CaptionChannel
+
+// DefaultCaptionChannel maps CEA-708 service N to channel N+6, labeled
+// "Service N".
+func DefaultCaptionChannel(service int) CaptionChannel {
+	return CaptionChannel{Channel: service + 6, Label: fmt.Sprintf("Service %d", service)}
+}
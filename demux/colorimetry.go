@@ -0,0 +1,87 @@
+package demux
+
+import "fmt"
+
+// Colorimetry describes how a video's samples map to colour, from the
+// colour description of an H.264 or H.265 SPS VUI. The code points are
+// those of ITU-T H.273.
+type Colorimetry struct {
+	Primaries uint8
+	Transfer  uint8
+	Matrix    uint8
+	FullRange bool
+}
+
+// H.273 code points with a WebCodecs VideoColorSpace name.
+var (
+	colourPrimariesNames = map[uint8]string{
+		1: "bt709", 5: "bt470bg", 6: "smpte170m", 9: "bt2020", 12: "smpte432",
+	}
+	transferNames = map[uint8]string{
+		1: "bt709", 6: "smpte170m", 8: "linear", 13: "iec61966-2-1", 14: "bt709", 15: "bt709",
+		16: "pq", 18: "hlg",
+	}
+	matrixNames = map[uint8]string{
+		0: "rgb", 1: "bt709", 5: "bt470bg", 6: "smpte170m", 9: "bt2020-ncl",
+	}
+)
+
+// Known reports whether the SPS carried a colour description. The zero
+// value, with reserved primaries 0, is unknown.
+func (c Colorimetry) Known() bool {
+	return c.Primaries != 0
+}
+
+// PrimariesName returns the WebCodecs name of the colour primaries, or ""
+// if they have none.
+func (c Colorimetry) PrimariesName() string { return colourPrimariesNames[c.Primaries] }
+
+// TransferName returns the WebCodecs name of the transfer characteristics,
+// or "" if they have none. The 10- and 12-bit BT.2020 transfers share
+// BT.709's curve and name.
+func (c Colorimetry) TransferName() string { return transferNames[c.Transfer] }
+
+// MatrixName returns the WebCodecs name of the matrix coefficients, or ""
+// if they have none.
+func (c Colorimetry) MatrixName() string { return matrixNames[c.Matrix] }
+
+// HDR reports whether the transfer is a high dynamic range one, PQ or HLG.
+func (c Colorimetry) HDR() bool {
+	return c.Transfer == 16 || c.Transfer == 18
+}
+
+// String returns the primaries and transfer, as in "bt2020/pq", with the
+// H.273 code point for any that WebCodecs does not name.
+func (c Colorimetry) String() string {
+	name := func(n string, v uint8) string {
+		if n == "" {
+			return fmt.Sprint(v)
+		}
+		return n
+	}
+	return name(c.PrimariesName(), c.Primaries) + "/" + name(c.TransferName(), c.Transfer)
+}
+
+// readVideoSignalType reads a VUI video_signal_type, which H.264 and
+// H.265 share, after its present flag, into c. Only a colour description
+// sets the code points.
+func (c *Colorimetry) readVideoSignalType(br *bitReader) error {
+	if _, err := br.readBits(3); err != nil { // video_format
+		return err
+	}
+	fullRange, err := br.readBits(1)
+	if err != nil {
+		return err
+	}
+	c.FullRange = fullRange == 1
+	desc, err := br.readBits(1)
+	if err != nil || desc == 0 {
+		return err
+	}
+	v, err := br.readBits(24)
+	if err != nil {
+		return err
+	}
+	c.Primaries, c.Transfer, c.Matrix = uint8(v>>16), uint8(v>>8), uint8(v)
+	return nil
+}
@@ -0,0 +1,233 @@
+package demux
+
+import "testing"
+
+// writeUE writes v as an unsigned Exp-Golomb code.
+func writeUE(w *bitWriter, v uint32) {
+	n := 0
+	for (v+1)>>uint(n+1) != 0 {
+		n++
+	}
+	w.write(0, n)
+	w.write(v+1, n+1)
+}
+
+// writeVideoSignalType writes a VUI video_signal_type with a colour
+// description, including its present flag.
+func writeVideoSignalType(w *bitWriter, c Colorimetry) {
+	w.write(1, 1) // video_signal_type_present_flag
+	w.write(5, 3) // video_format: unspecified
+	if c.FullRange {
+		w.write(1, 1)
+	} else {
+		w.write(0, 1)
+	}
+	w.write(1, 1) // colour_description_present_flag
+	w.write(uint32(c.Primaries), 8)
+	w.write(uint32(c.Transfer), 8)
+	w.write(uint32(c.Matrix), 8)
+}
+
+// h264SPSWithColour returns a 1920x1080 Baseline SPS whose VUI carries
+// the colour description c.
+func h264SPSWithColour(c Colorimetry) []byte {
+	var w bitWriter
+	w.write(0x67, 8) // NAL header
+	w.write(66, 8)   // profile_idc: Baseline
+	w.write(0, 8)    // constraint flags
+	w.write(40, 8)   // level_idc
+	writeUE(&w, 0)   // seq_parameter_set_id
+	writeUE(&w, 0)   // log2_max_frame_num_minus4
+	writeUE(&w, 2)   // pic_order_cnt_type
+	writeUE(&w, 1)   // max_num_ref_frames
+	w.write(0, 1)    // gaps_in_frame_num_value_allowed_flag
+	writeUE(&w, 119) // pic_width_in_mbs_minus1
+	writeUE(&w, 67)  // pic_height_in_map_units_minus1
+	w.write(1, 1)    // frame_mbs_only_flag
+	w.write(1, 1)    // direct_8x8_inference_flag
+	w.write(1, 1)    // frame_cropping_flag
+	writeUE(&w, 0)
+	writeUE(&w, 0)
+	writeUE(&w, 0)
+	writeUE(&w, 4)
+	w.write(1, 1) // vui_parameters_present_flag
+	w.write(0, 1) // aspect_ratio_info_present_flag
+	w.write(0, 1) // overscan_info_present_flag
+	writeVideoSignalType(&w, c)
+	w.write(0, 5) // chroma_loc, timing, NAL and VCL HRD, pic_struct
+	w.write(0, 1) // bitstream_restriction_flag
+	w.write(1, 1) // rbsp_stop_one_bit
+	return w.bytes()
+}
+
+// hevcSPSWithColour returns a 3840x2160 Main 10 SPS whose VUI carries the
+// colour description c. full exercises the optional structures before
+// the VUI: a scaling list, PCM, inter-predicted reference picture sets
+// and long-term reference pictures.
+func hevcSPSWithColour(c Colorimetry, full bool) []byte {
+	var w bitWriter
+	w.write(0x4201, 16) // NAL header
+	w.write(0x01, 8)    // vps_id, max_sub_layers_minus1 0, temporal_id_nesting
+	w.write(0x02, 8)    // profile_space, tier, profile_idc: Main 10
+	w.write(0x20000000, 32)
+	w.write(0x9000, 16) // progressive and frame-only constraint flags
+	w.write(0, 32)
+	w.write(153, 8) // level_idc: 5.1
+	writeUE(&w, 0)  // sps_seq_parameter_set_id
+	writeUE(&w, 1)  // chroma_format_idc: 4:2:0
+	writeUE(&w, 3840)
+	writeUE(&w, 2160)
+	w.write(0, 1)  // conformance_window_flag
+	writeUE(&w, 2) // bit_depth_luma_minus8
+	writeUE(&w, 2) // bit_depth_chroma_minus8
+	writeUE(&w, 4) // log2_max_pic_order_cnt_lsb_minus4
+	w.write(1, 1)  // sps_sub_layer_ordering_info_present_flag
+	writeUE(&w, 4)
+	writeUE(&w, 2)
+	writeUE(&w, 0)
+	for _, v := range []uint32{0, 3, 0, 3, 2, 2} { // block sizes and depths
+		writeUE(&w, v)
+	}
+
+	if full {
+		w.write(1, 1) // scaling_list_enabled_flag
+		w.write(1, 1) // sps_scaling_list_data_present_flag
+		for sizeID := range 4 {
+			for matrixID := 0; matrixID < 6; matrixID += 1 + 2*(sizeID/3) {
+				if sizeID < 2 || matrixID > 0 {
+					w.write(0, 1) // scaling_list_pred_mode_flag
+					writeUE(&w, 0)
+					continue
+				}
+				w.write(1, 1)
+				if sizeID > 1 {
+					w.write(0x2, 3) // scaling_list_dc_coef_minus8: se(1)
+				}
+				for range 64 {
+					w.write(1, 1) // scaling_list_delta_coef: se(0)
+				}
+			}
+		}
+	} else {
+		w.write(0, 1)
+	}
+	w.write(0x1, 2) // amp_enabled_flag, sample_adaptive_offset_enabled_flag
+	if full {
+		w.write(1, 1)    // pcm_enabled_flag
+		w.write(0x77, 8) // pcm sample bit depths
+		writeUE(&w, 0)
+		writeUE(&w, 1)
+		w.write(0, 1) // pcm_loop_filter_disabled_flag
+	} else {
+		w.write(0, 1)
+	}
+
+	writeUE(&w, 3) // num_short_term_ref_pic_sets
+	writeUE(&w, 2) // num_negative_pics
+	writeUE(&w, 1) // num_positive_pics
+	for range 3 {
+		writeUE(&w, 0) // delta_poc_minus1
+		w.write(1, 1)  // used_by_curr_pic_flag
+	}
+	for _, refPics := range []int{3, 4} { // predicted from the set before
+		w.write(1, 1) // inter_ref_pic_set_prediction_flag
+		w.write(0, 1) // delta_rps_sign
+		writeUE(&w, 0)
+		for range refPics + 1 {
+			w.write(0, 1) // used_by_curr_pic_flag
+			w.write(1, 1) // use_delta_flag
+		}
+	}
+
+	if full {
+		w.write(1, 1) // long_term_ref_pics_present_flag
+		writeUE(&w, 2)
+		for range 2 {
+			w.write(0x55, 8) // lt_ref_pic_poc_lsb_sps
+			w.write(1, 1)    // used_by_curr_pic_lt_sps_flag
+		}
+	} else {
+		w.write(0, 1)
+	}
+	w.write(0x3, 2) // temporal MVP, strong intra smoothing
+	w.write(1, 1)   // vui_parameters_present_flag
+	w.write(1, 1)   // aspect_ratio_info_present_flag
+	w.write(1, 8)   // aspect_ratio_idc: 1:1
+	w.write(0, 1)   // overscan_info_present_flag
+	writeVideoSignalType(&w, c)
+	w.write(0x80, 8) // the rest of the VUI is cut short
+	return w.bytes()
+}
+
+func TestParseSPSColorimetry(t *testing.T) {
+	t.Parallel()
+
+	hdr10 := Colorimetry{Primaries: 9, Transfer: 16, Matrix: 9}
+	hlg := Colorimetry{Primaries: 9, Transfer: 18, Matrix: 9, FullRange: true}
+
+	info, err := ParseSPS(h264SPSWithColour(hlg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Width != 1920 || info.Height != 1080 {
+		t.Errorf("H.264 resolution = %dx%d, want 1920x1080", info.Width, info.Height)
+	}
+	if info.Colorimetry != hlg {
+		t.Errorf("H.264 colorimetry = %+v, want %+v", info.Colorimetry, hlg)
+	}
+
+	for _, full := range []bool{false, true} {
+		info, err := ParseHEVCSPS(hevcSPSWithColour(hdr10, full))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Width != 3840 || info.BitDepthLumaMinus8 != 2 {
+			t.Errorf("full %v: H.265 width %d, luma depth %d; want 3840, 10 bits", full, info.Width, info.BitDepthLumaMinus8+8)
+		}
+		if info.Colorimetry != hdr10 {
+			t.Errorf("full %v: H.265 colorimetry = %+v, want %+v", full, info.Colorimetry, hdr10)
+		}
+	}
+
+	// An SPS cut short before the VUI keeps its other fields.
+	sps := hevcSPSWithColour(hdr10, false)
+	info2, err := ParseHEVCSPS(sps[:len(sps)-8])
+	if err != nil || info2.Width != 3840 {
+		t.Fatalf("truncated H.265 SPS: width %d, err %v", info2.Width, err)
+	}
+	if info2.Colorimetry.Known() {
+		t.Errorf("truncated H.265 SPS: colorimetry = %+v, want unknown", info2.Colorimetry)
+	}
+}
+
+func TestColorimetryNames(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		c                           Colorimetry
+		str                         string
+		primaries, transfer, matrix string
+		hdr                         bool
+	}{
+		{Colorimetry{9, 16, 9, false}, "bt2020/pq", "bt2020", "pq", "bt2020-ncl", true},
+		{Colorimetry{9, 18, 9, false}, "bt2020/hlg", "bt2020", "hlg", "bt2020-ncl", true},
+		{Colorimetry{1, 1, 1, false}, "bt709/bt709", "bt709", "bt709", "bt709", false},
+		{Colorimetry{6, 6, 6, false}, "smpte170m/smpte170m", "smpte170m", "smpte170m", "smpte170m", false},
+		{Colorimetry{9, 14, 9, false}, "bt2020/bt709", "bt2020", "bt709", "bt2020-ncl", false},
+		{Colorimetry{10, 17, 0, false}, "10/17", "", "", "rgb", false},
+	}
+	for _, tt := range tests {
+		if got := tt.c.String(); got != tt.str {
+			t.Errorf("%+v: String = %q, want %q", tt.c, got, tt.str)
+		}
+		if p, tr, m := tt.c.PrimariesName(), tt.c.TransferName(), tt.c.MatrixName(); p != tt.primaries || tr != tt.transfer || m != tt.matrix {
+			t.Errorf("%+v: names = %q, %q, %q; want %q, %q, %q", tt.c, p, tr, m, tt.primaries, tt.transfer, tt.matrix)
+		}
+		if got := tt.c.HDR(); got != tt.hdr {
+			t.Errorf("%+v: HDR = %v, want %v", tt.c, got, tt.hdr)
+		}
+	}
+	if (Colorimetry{}).Known() {
+		t.Error("zero Colorimetry is known")
+	}
+}
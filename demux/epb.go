@@ -0,0 +1,54 @@
+package demux
+
+// ValidEmulationPrevention reports whether an H.264 or H.265 NAL unit,
+// without its start code, is correctly escaped for carriage without start
+// codes, as in the length-prefixed AVC1 form sent to viewers: no two zero
+// bytes are followed by a byte <= 2, which would need an
+// emulation_prevention_three_byte between them, and it does not end in a
+// zero byte. A NAL unit split from an Annex B stream ends in a zero byte
+// when the zero_byte of the next start code or trailing_zero_8bits are
+// left attached to it.
+func ValidEmulationPrevention(nal []byte) bool {
+	if len(nal) > 0 && nal[len(nal)-1] == 0 {
+		return false
+	}
+	zeros := 0
+	for _, b := range nal {
+		if zeros >= 2 && b <= 2 {
+			return false
+		}
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+	}
+	return true
+}
+
+// RepairEmulationPrevention returns a copy of nal escaped as
+// ValidEmulationPrevention requires: trailing zero bytes are dropped and
+// an emulation_prevention_three_byte is inserted wherever one is missing.
+// Bytes already escaped are kept, so the RBSP a decoder reads back is
+// unchanged.
+func RepairEmulationPrevention(nal []byte) []byte {
+	end := len(nal)
+	for end > 0 && nal[end-1] == 0 {
+		end--
+	}
+	out := make([]byte, 0, end+end/64+1)
+	zeros := 0
+	for _, b := range nal[:end] {
+		if zeros >= 2 && b <= 2 {
+			out = append(out, 3)
+			zeros = 0
+		}
+		out = append(out, b)
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+	}
+	return out
+}
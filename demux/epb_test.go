@@ -0,0 +1,67 @@
+package demux
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRepairEmulationPrevention(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		nal   []byte
+		valid bool
+		want  []byte
+	}{
+		{
+			name:  "no zeros",
+			nal:   []byte{0x65, 0x88, 0x84, 0x21},
+			valid: true,
+			want:  []byte{0x65, 0x88, 0x84, 0x21},
+		},
+		{
+			name:  "escaped",
+			nal:   []byte{0x65, 0x00, 0x00, 0x03, 0x00, 0x00, 0x03, 0x01, 0x00, 0x00, 0x03, 0x03, 0x80},
+			valid: true,
+			want:  []byte{0x65, 0x00, 0x00, 0x03, 0x00, 0x00, 0x03, 0x01, 0x00, 0x00, 0x03, 0x03, 0x80},
+		},
+		{
+			name:  "cabac zero word",
+			nal:   []byte{0x65, 0x88, 0x80, 0x00, 0x00, 0x03},
+			valid: true,
+			want:  []byte{0x65, 0x88, 0x80, 0x00, 0x00, 0x03},
+		},
+		{
+			name: "missing escapes",
+			nal:  []byte{0x65, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x02, 0x80},
+			want: []byte{0x65, 0x00, 0x00, 0x03, 0x00, 0x00, 0x03, 0x01, 0x00, 0x00, 0x03, 0x02, 0x80},
+		},
+		{
+			name: "trailing zeros",
+			nal:  []byte{0x41, 0x9A, 0x80, 0x00, 0x00},
+			want: []byte{0x41, 0x9A, 0x80},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := ValidEmulationPrevention(tt.nal); got != tt.valid {
+				t.Errorf("ValidEmulationPrevention = %v, want %v", got, tt.valid)
+			}
+			got := RepairEmulationPrevention(tt.nal)
+			if !bytes.Equal(got, tt.want) {
+				t.Fatalf("RepairEmulationPrevention = % x, want % x", got, tt.want)
+			}
+			if !ValidEmulationPrevention(got) {
+				t.Errorf("repaired NAL unit % x is not valid", got)
+			}
+			// Repair never changes the RBSP a decoder reads.
+			src := bytes.TrimRight(tt.nal, "\x00")
+			if rbsp, want := removeEmulationPrevention(got), removeEmulationPrevention(src); !bytes.Equal(rbsp, want) {
+				t.Errorf("RBSP = % x, want % x", rbsp, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package demux
+
+import "time"
+
+// DemuxEventType identifies the kind of anomaly a DemuxEvent reports.
+type DemuxEventType string
+
+// Demux event types.
+const (
+	// EventCorruptPacket reports a TS packet the parser rejected.
+	EventCorruptPacket DemuxEventType = "corrupt_packet"
+
+	// EventParseError reports an elementary stream payload that failed
+	// to parse, such as a malformed ADTS or SCTE-35 section.
+	EventParseError DemuxEventType = "parse_error"
+
+	// EventDiscontinuity reports a backward video PTS jump.
+	EventDiscontinuity DemuxEventType = "discontinuity"
+
+	// EventUnsupportedStream reports a PMT stream type the demuxer
+	// ignores. It is emitted once per type.
+	EventUnsupportedStream DemuxEventType = "unsupported_stream"
+
+	// EventConditionalAccess reports a CA system scrambling the program
+	// or one of its streams. It is emitted once per CA system.
+	EventConditionalAccess DemuxEventType = "conditional_access"
+)
+
+// eventBufferSize is the capacity of the Events channel. Events beyond it
+// are dropped until the reader catches up.
+const eventBufferSize = 64
+
+// DemuxEvent is a discrete demuxing anomaly, for embedders that surface
+// them in their own monitoring alongside the aggregate stats.
+type DemuxEvent struct {
+	Type DemuxEventType `json:"type"`
+
+	// PID is the transport stream PID the event concerns, or 0 when it
+	// is not known, as for a packet too damaged to read.
+	PID    uint16    `json:"pid,omitempty"`
+	Detail string    `json:"detail"`
+	Time   time.Time `json:"time"`
+}
+
+// emitEvent queues an event on the Events channel, dropping it if the
+// channel is full so an unread channel never stalls demuxing.
+func (d *Demuxer) emitEvent(typ DemuxEventType, pid uint16, detail string) {
+	select {
+	case d.eventCh <- DemuxEvent{Type: typ, PID: pid, Detail: detail, Time: time.Now()}:
+	default:
+	}
+}
@@ -0,0 +1,46 @@
+package demux
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDemuxerCorruptPacketEvent(t *testing.T) {
+	t.Parallel()
+
+	// A packet without the 0x47 sync byte is rejected by the TS parser.
+	d := NewDemuxer(bytes.NewReader(make([]byte, 188)), nil)
+	before := time.Now()
+	if err := d.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	var events []DemuxEvent
+	for e := range d.Events() {
+		events = append(events, e)
+	}
+	if len(events) == 0 {
+		t.Fatal("no events for a corrupt packet")
+	}
+	e := events[0]
+	if e.Type != EventCorruptPacket || e.Detail == "" || e.Time.Before(before) {
+		t.Errorf("event = %+v, want a corrupt_packet event with detail and time", e)
+	}
+}
+
+func TestDemuxerEventsDropWhenFull(t *testing.T) {
+	t.Parallel()
+
+	d := NewDemuxer(nil, nil)
+	for range eventBufferSize + 10 {
+		d.emitEvent(EventParseError, 0x101, "ADTS: bad header") // must not block
+	}
+	if n := len(d.Events()); n != eventBufferSize {
+		t.Errorf("queued events = %d, want %d", n, eventBufferSize)
+	}
+	if e := <-d.Events(); e.Type != EventParseError || e.PID != 0x101 {
+		t.Errorf("event = %+v, want the first parse error", e)
+	}
+}
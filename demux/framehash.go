@@ -0,0 +1,118 @@
+package demux
+
+import (
+	"encoding/binary"
+	"hash"
+	"hash/fnv"
+	"sync"
+
+	"github.com/zsiec/prism/media"
+)
+
+// FrameHashes summarizes everything a Demuxer emitted, for conformance
+// tests that pin the exact output for a known input: a change in NAL unit
+// splitting, emulation prevention handling or ADTS stripping changes the
+// hashes. Video and Audio are rolling 64-bit FNV-1a hashes over the
+// frames in emission order, covering timestamps, flags and payloads.
+type FrameHashes struct {
+	Video       uint64
+	Audio       uint64
+	VideoFrames int64
+	AudioFrames int64
+}
+
+// frameHasher accumulates FrameHashes. It is safe for concurrent use so
+// that hashes can be read while Run is still going.
+type frameHasher struct {
+	mu          sync.Mutex
+	video       hash.Hash64
+	audio       hash.Hash64
+	videoFrames int64
+	audioFrames int64
+	scratch     []byte
+}
+
+func newFrameHasher() *frameHasher {
+	return &frameHasher{video: fnv.New64a(), audio: fnv.New64a()}
+}
+
+// SetFrameHashing sets whether the demuxer hashes the frames it emits;
+// see FrameHashes. It is off by default, costing nothing, and is meant
+// for tests rather than production. Call it before Run.
+func (d *Demuxer) SetFrameHashing(on bool) {
+	if !on {
+		d.hasher = nil
+		return
+	}
+	if d.hasher == nil {
+		d.hasher = newFrameHasher()
+	}
+}
+
+// FrameHashes returns the hashes of the frames emitted so far, or the
+// zero FrameHashes if hashing is off.
+func (d *Demuxer) FrameHashes() FrameHashes {
+	h := d.hasher
+	if h == nil {
+		return FrameHashes{}
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return FrameHashes{
+		Video:       h.video.Sum64(),
+		Audio:       h.audio.Sum64(),
+		VideoFrames: h.videoFrames,
+		AudioFrames: h.audioFrames,
+	}
+}
+
+// addVideo folds a video frame into the video hash: its codec,
+// timestamps, keyframe and discontinuity flags, group, and each NAL unit
+// with its length so that a different split of the same bytes hashes
+// differently.
+func (h *frameHasher) addVideo(f *media.VideoFrame) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	b := append(h.scratch[:0], byte(len(f.Codec)))
+	b = append(b, f.Codec...)
+	b = binary.BigEndian.AppendUint64(b, uint64(f.PTS))
+	b = binary.BigEndian.AppendUint64(b, uint64(f.DTS))
+	b = binary.BigEndian.AppendUint32(b, f.GroupID)
+	b = append(b, boolByte(f.IsKeyframe), boolByte(f.Discontinuity))
+	b = binary.BigEndian.AppendUint32(b, uint32(len(f.NALUs)))
+	h.video.Write(b)
+	for _, nalu := range f.NALUs {
+		b = binary.BigEndian.AppendUint32(b[:0], uint32(len(nalu)))
+		h.video.Write(b)
+		h.video.Write(nalu)
+	}
+	h.scratch = b
+	h.videoFrames++
+}
+
+// addAudio folds an audio frame into the audio hash: its codec, track,
+// timestamp, format and payload.
+func (h *frameHasher) addAudio(f *media.AudioFrame) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	b := append(h.scratch[:0], byte(len(f.Codec)))
+	b = append(b, f.Codec...)
+	b = binary.BigEndian.AppendUint32(b, uint32(f.TrackIndex))
+	b = binary.BigEndian.AppendUint64(b, uint64(f.PTS))
+	b = binary.BigEndian.AppendUint32(b, uint32(f.SampleRate))
+	b = binary.BigEndian.AppendUint32(b, uint32(f.Channels))
+	b = binary.BigEndian.AppendUint32(b, uint32(len(f.Data)))
+	h.audio.Write(b)
+	h.audio.Write(f.Data)
+	h.scratch = b
+	h.audioFrames++
+}
+
+func boolByte(b bool) byte {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,79 @@
+package demux
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/zsiec/prism/mpegts"
+)
+
+// conformanceTS returns a small H.264 and AAC transport stream exercising
+// the paths frame hashing guards: parameter sets ahead of an IDR, an
+// emulation prevention byte, mixed start code lengths, an AUD to drop,
+// and several ADTS frames per PES packet.
+func conformanceTS(t *testing.T) []byte {
+	t.Helper()
+
+	sps := []byte{0x67, 0x42, 0x00, 0x1E, 0x95, 0xA8}
+	pps := []byte{0x68, 0xCE, 0x38, 0x80}
+	idr := []byte{0x65, 0x88, 0x84, 0x00, 0x00, 0x03, 0x01, 0x21}
+	aud := []byte{0x09, 0xF0}
+	slice := []byte{0x41, 0x9A, 0x02, 0x00, 0x00, 0x03, 0x00, 0x7F}
+	key := append(annexB(aud, sps, pps), 0x00, 0x00, 0x01)
+	key = append(key, idr...)
+
+	var buf bytes.Buffer
+	mux := mpegts.NewMuxer(&buf,
+		mpegts.MuxStream{PID: 0x100, StreamType: mpegts.StreamTypeH264},
+		mpegts.MuxStream{PID: 0x101, StreamType: mpegts.StreamTypeAAC},
+	)
+	if err := mux.WritePSI(); err != nil {
+		t.Fatal(err)
+	}
+	for i := range int64(6) {
+		video := annexB(aud, slice)
+		if i%3 == 0 {
+			video = key
+		}
+		pts := 900_000 + i*3003
+		if err := mux.WriteAccessUnit(0x100, pts+3003, pts, i%3 == 0, video); err != nil {
+			t.Fatal(err)
+		}
+		audio := append(adtsFrame(3, 2, []byte{byte(i), 0x21, 0x10}), adtsFrame(3, 2, []byte{byte(i), 0x42})...)
+		if err := mux.WriteAccessUnit(0x101, pts, pts, true, audio); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.Bytes()
+}
+
+func TestDemuxerFrameHashes(t *testing.T) {
+	t.Parallel()
+
+	ts := conformanceTS(t)
+	run := func(hashing bool) FrameHashes {
+		d := NewDemuxer(bytes.NewReader(ts), nil)
+		d.SetFrameHashing(hashing)
+		if err := d.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		return d.FrameHashes()
+	}
+
+	if got := run(false); got != (FrameHashes{}) {
+		t.Errorf("hashing off: FrameHashes = %+v, want zero", got)
+	}
+
+	// Pinned for conformanceTS; a change to what the demuxer emits for
+	// it changes these.
+	want := FrameHashes{
+		Video:       0x35c9b753c53769d1,
+		Audio:       0xd30b9763aed95fc3,
+		VideoFrames: 6,
+		AudioFrames: 12,
+	}
+	if got := run(true); got != want {
+		t.Errorf("FrameHashes = %+v (video %#x, audio %#x), want %+v", got, got.Video, got.Audio, want)
+	}
+}
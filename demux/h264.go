@@ -1,8 +1,11 @@
 package demux
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+
+	"github.com/zsiec/prism/media"
 )
 
 // H.264 NAL unit type constants as defined in ITU-T H.264 Table 7-1.
@@ -30,6 +33,10 @@ type SPSInfo struct {
 	CpbRemovalDelayLen int
 	DpbOutputDelayLen  int
 	TimeOffsetLen      int
+
+	// Colorimetry is the VUI colour description; it is unknown when the
+	// SPS does not carry one.
+	Colorimetry Colorimetry
 }
 
 // CodecString returns the RFC 6381 codec parameter string (e.g. "avc1.42E01E")
@@ -39,18 +46,8 @@ func (s SPSInfo) CodecString() string {
 }
 
 // Timecode represents a SMPTE 12M timecode extracted from an H.264 pic_timing
-// SEI message.
-type Timecode struct {
-	Hours   int
-	Minutes int
-	Seconds int
-	Frames  int
-}
-
-// String formats the timecode as HH:MM:SS:FF.
-func (tc Timecode) String() string {
-	return fmt.Sprintf("%02d:%02d:%02d:%02d", tc.Hours, tc.Minutes, tc.Seconds, tc.Frames)
-}
+// SEI message. It is the time address video frames carry.
+type Timecode = media.Timecode
 
 var errSPSTooShort = errors.New("SPS data too short")
 
@@ -374,11 +371,7 @@ func ParseSPS(nalu []byte) (SPSInfo, error) {
 
 	videoSignal, _ := br.readBits(1)
 	if videoSignal == 1 {
-		br.readBits(4) // video_format + video_full_range
-		colourDesc, _ := br.readBits(1)
-		if colourDesc == 1 {
-			br.readBits(24)
-		}
+		info.Colorimetry.readVideoSignalType(br)
 	}
 
 	chromaLoc, _ := br.readBits(1)
@@ -432,7 +425,18 @@ func ParseSPS(nalu []byte) (SPSInfo, error) {
 	return info, nil
 }
 
+// emulationPrevention is the byte pattern that may hold an
+// emulation_prevention_three_byte.
+var emulationPrevention = []byte{0, 0, 3}
+
+// removeEmulationPrevention returns the RBSP of a NAL unit payload,
+// dropping each emulation_prevention_three_byte. Payloads without one,
+// which is most of them, are returned as is rather than copied, so the
+// result must be treated as read-only.
 func removeEmulationPrevention(data []byte) []byte {
+	if !bytes.Contains(data, emulationPrevention) {
+		return data
+	}
 	out := make([]byte, 0, len(data))
 	for i := 0; i < len(data); i++ {
 		if i+2 < len(data) && data[i] == 0 && data[i+1] == 0 && data[i+2] == 3 &&
@@ -456,73 +460,101 @@ type NALUnit struct {
 // NAL units. The nalTypeFunc extracts the codec-specific NAL type from the raw
 // NAL data. Both 3-byte (0x000001) and 4-byte (0x00000001) start codes are
 // recognized. minNALBytes is the minimum NAL data length (1 for H.264, 2 for HEVC).
+// The result is sized in a first pass, so it is the only allocation.
 func parseAnnexBGeneric(data []byte, minNALBytes int, nalTypeFunc func([]byte) byte) []NALUnit {
-	var units []NALUnit
+	count := 0
+	forEachAnnexBNAL(data, minNALBytes, nalTypeFunc, func(NALUnit) bool {
+		count++
+		return true
+	})
+	if count == 0 {
+		return nil
+	}
+
+	units := make([]NALUnit, 0, count)
+	forEachAnnexBNAL(data, minNALBytes, nalTypeFunc, func(nalu NALUnit) bool {
+		units = append(units, nalu)
+		return true
+	})
+	return units
+}
+
+// forEachAnnexBNAL yields the NAL units of an Annex B byte stream in
+// order without allocating; see parseAnnexBGeneric for the arguments.
+// Iteration stops when fn returns false.
+func forEachAnnexBNAL(data []byte, minNALBytes int, nalTypeFunc func([]byte) byte, fn func(NALUnit) bool) {
 	n := len(data)
 	if n < 4 {
-		return nil
+		return
 	}
 
-	type scPos struct {
-		scStart   int
-		dataStart int
+	// emit yields data[start:end] as a NAL unit if it is long enough.
+	emit := func(start, end int) bool {
+		if start >= end || end-start < minNALBytes {
+			return true
+		}
+		nalData := data[start:end]
+		return fn(NALUnit{Type: nalTypeFunc(nalData), Data: nalData})
 	}
 
-	var positions []scPos
+	dataStart := -1
 	i := 0
 	for i < n-2 {
 		if data[i] == 0 && data[i+1] == 0 {
+			scLen := 0
 			if i < n-3 && data[i+2] == 0 && data[i+3] == 1 {
-				positions = append(positions, scPos{scStart: i, dataStart: i + 4})
-				i += 4
-				continue
+				scLen = 4
+			} else if data[i+2] == 1 {
+				scLen = 3
 			}
-			if data[i+2] == 1 {
-				positions = append(positions, scPos{scStart: i, dataStart: i + 3})
-				i += 3
+			if scLen > 0 {
+				if dataStart >= 0 && !emit(dataStart, i) {
+					return
+				}
+				dataStart = i + scLen
+				i += scLen
 				continue
 			}
 		}
 		i++
 	}
-
-	for idx, pos := range positions {
-		if pos.dataStart >= n {
-			continue
-		}
-		end := n
-		if idx+1 < len(positions) {
-			end = positions[idx+1].scStart
-		}
-		if pos.dataStart >= end {
-			continue
-		}
-
-		nalData := data[pos.dataStart:end]
-		if len(nalData) < minNALBytes {
-			continue
-		}
-
-		units = append(units, NALUnit{
-			Type: nalTypeFunc(nalData),
-			Data: nalData,
-		})
+	if dataStart >= 0 && dataStart < n {
+		emit(dataStart, n)
 	}
-
-	return units
 }
 
 // ParseAnnexB parses H.264 Annex B byte stream into individual NAL units.
 // It recognizes both 3-byte (0x000001) and 4-byte (0x00000001) start codes.
 func ParseAnnexB(data []byte) []NALUnit {
-	return parseAnnexBGeneric(data, 1, func(d []byte) byte { return d[0] & 0x1F })
+	return parseAnnexBGeneric(data, 1, h264NALType)
 }
 
+// ParseAnnexBFunc calls fn for each NAL unit ParseAnnexB would return, in
+// order, until fn returns false. It allocates nothing, which matters on
+// the per-frame demux path. NALUnit.Data aliases data.
+func ParseAnnexBFunc(data []byte, fn func(NALUnit) bool) {
+	forEachAnnexBNAL(data, 1, h264NALType, fn)
+}
+
+func h264NALType(d []byte) byte { return d[0] & 0x1F }
+
 // IsKeyframe returns true if the NAL type is an IDR slice (type 5).
 func IsKeyframe(nalType byte) bool {
 	return nalType == NALTypeIDR
 }
 
+// IsVCL returns true if the NAL type carries slice data (types 1-5).
+func IsVCL(nalType byte) bool {
+	return nalType >= NALTypeSlice && nalType <= NALTypeIDR
+}
+
+// IsReference returns true if an H.264 NAL unit has a nonzero
+// nal_ref_idc, so that it may be used to predict other pictures. nalu
+// includes the header byte.
+func IsReference(nalu []byte) bool {
+	return len(nalu) > 0 && nalu[0]&0x60 != 0
+}
+
 // IsSPS returns true if the NAL type is SPS (type 7).
 func IsSPS(nalType byte) bool {
 	return nalType == NALTypeSPS
@@ -533,23 +565,31 @@ func IsPPS(nalType byte) bool {
 	return nalType == NALTypePPS
 }
 
-// ParsePicTimingSEI extracts a SMPTE 12M timecode from an H.264 pic_timing
-// SEI message. Returns the timecode and true if extraction succeeded, or a
-// zero value and false if the SEI doesn't contain valid clock timestamps.
-// Requires HRD parameters from the SPS for correct bitstream parsing.
-func ParsePicTimingSEI(seiNALU []byte, sps SPSInfo) (Timecode, bool) {
+// SEI payload types (ITU-T H.264 Annex D).
+const (
+	seiPayloadPicTiming          = 1
+	seiPayloadUserDataRegistered = 4 // user_data_registered_itu_t_t35: A/53 captions, AFD
+	seiPayloadRecoveryPoint      = 6
+)
+
+// forEachSEIPayload walks the sei_message()s of an H.264 SEI NAL unit,
+// calling fn with each payload type and body until fn returns false or
+// the RBSP trailing bits are reached.
+func forEachSEIPayload(seiNALU []byte, fn func(payloadType int, payload []byte) bool) {
 	if len(seiNALU) < 2 {
-		return Timecode{}, false
-	}
-	if !sps.PicStructPresent || !sps.HRDPresent {
-		return Timecode{}, false
+		return
 	}
+	forEachSEIMessage(seiNALU[1:], fn)
+}
 
-	rbsp := removeEmulationPrevention(seiNALU[1:])
+// forEachSEIMessage walks the sei_message()s of an SEI NAL unit body, the
+// bytes following the NAL header, which H.264 and H.265 share.
+func forEachSEIMessage(body []byte, fn func(payloadType int, payload []byte) bool) {
+	rbsp := removeEmulationPrevention(body)
 	i := 0
 	for i < len(rbsp) {
 		if rbsp[i] == 0x80 {
-			break
+			return
 		}
 
 		payloadType := 0
@@ -558,7 +598,7 @@ func ParsePicTimingSEI(seiNALU []byte, sps SPSInfo) (Timecode, bool) {
 			i++
 		}
 		if i >= len(rbsp) {
-			break
+			return
 		}
 		payloadType += int(rbsp[i])
 		i++
@@ -569,25 +609,113 @@ func ParsePicTimingSEI(seiNALU []byte, sps SPSInfo) (Timecode, bool) {
 			i++
 		}
 		if i >= len(rbsp) {
-			break
+			return
 		}
 		payloadSize += int(rbsp[i])
 		i++
 
 		if i+payloadSize > len(rbsp) {
-			break
+			return
 		}
-
-		if payloadType == 1 {
-			tc, ok := parsePicTimingPayload(rbsp[i:i+payloadSize], sps)
-			if ok {
-				return tc, true
-			}
+		if !fn(payloadType, rbsp[i:i+payloadSize]) {
+			return
 		}
 		i += payloadSize
 	}
+}
 
-	return Timecode{}, false
+// splitCaptionSEI returns the SEI NAL units to hand to the caption
+// extractor. An SEI NAL unit holding a single message is returned as is;
+// otherwise each user_data_registered_itu_t_t35 message is rebuilt as a
+// NAL unit of its own, since encoders commonly pack captions after
+// pic_timing or buffering_period. hdrLen is the NAL header size: 1 for
+// H.264, 2 for H.265.
+func splitCaptionSEI(seiNALU []byte, hdrLen int) [][]byte {
+	if len(seiNALU) <= hdrLen {
+		return nil
+	}
+	var (
+		msgs  [][]byte
+		count int
+	)
+	forEachSEIMessage(seiNALU[hdrLen:], func(payloadType int, payload []byte) bool {
+		count++
+		if payloadType != seiPayloadUserDataRegistered {
+			return true
+		}
+		rbsp := appendSEIValue(nil, payloadType)
+		rbsp = appendSEIValue(rbsp, len(payload))
+		rbsp = append(rbsp, payload...)
+		rbsp = append(rbsp, 0x80) // rbsp_trailing_bits
+		msg := append([]byte(nil), seiNALU[:hdrLen]...)
+		msgs = append(msgs, addEmulationPrevention(msg, rbsp))
+		return true
+	})
+	if count <= 1 {
+		return [][]byte{seiNALU}
+	}
+	return msgs
+}
+
+// appendSEIValue appends an SEI payload type or size in its 0xFF-extended
+// form.
+func appendSEIValue(b []byte, v int) []byte {
+	for ; v >= 255; v -= 255 {
+		b = append(b, 0xFF)
+	}
+	return append(b, byte(v))
+}
+
+// addEmulationPrevention appends rbsp to dst, inserting an
+// emulation_prevention_three_byte wherever two zero bytes are followed by a
+// byte <= 3. It is the inverse of removeEmulationPrevention.
+func addEmulationPrevention(dst, rbsp []byte) []byte {
+	zeros := 0
+	for _, b := range rbsp {
+		if zeros >= 2 && b <= 3 {
+			dst = append(dst, 3)
+			zeros = 0
+		}
+		dst = append(dst, b)
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+	}
+	return dst
+}
+
+// ParsePicTimingSEI extracts a SMPTE 12M timecode from an H.264 pic_timing
+// SEI message. Returns the timecode and true if extraction succeeded, or a
+// zero value and false if the SEI doesn't contain valid clock timestamps.
+// Requires HRD parameters from the SPS for correct bitstream parsing.
+func ParsePicTimingSEI(seiNALU []byte, sps SPSInfo) (Timecode, bool) {
+	if !sps.PicStructPresent || !sps.HRDPresent {
+		return Timecode{}, false
+	}
+
+	var tc Timecode
+	var found bool
+	forEachSEIPayload(seiNALU, func(payloadType int, payload []byte) bool {
+		if payloadType == seiPayloadPicTiming {
+			tc, found = parsePicTimingPayload(payload, sps)
+		}
+		return !found
+	})
+	return tc, found
+}
+
+// HasRecoveryPointSEI reports whether an H.264 SEI NAL unit carries a
+// recovery_point message (payload type 6). Open-GOP encoders mark non-IDR
+// I-frames this way to flag them as random access points.
+func HasRecoveryPointSEI(seiNALU []byte) bool {
+	found := false
+	forEachSEIPayload(seiNALU, func(payloadType int, _ []byte) bool {
+		found = payloadType == seiPayloadRecoveryPoint
+		return !found
+	})
+	return found
 }
 
 func parsePicTimingPayload(payload []byte, sps SPSInfo) (Timecode, bool) {
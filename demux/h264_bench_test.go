@@ -1,6 +1,10 @@
 package demux
 
-import "testing"
+import (
+	"bytes"
+	"context"
+	"testing"
+)
 
 var benchAnnexBData = []byte{
 	0x00, 0x00, 0x00, 0x01, 0x67, 0x42, 0xE0, 0x1E,
@@ -17,11 +21,68 @@ var benchSPSData = []byte{
 
 func BenchmarkParseAnnexB(b *testing.B) {
 	b.SetBytes(int64(len(benchAnnexBData)))
+	b.ReportAllocs()
 	for b.Loop() {
 		ParseAnnexB(benchAnnexBData)
 	}
 }
 
+func BenchmarkParseAnnexBFunc(b *testing.B) {
+	b.SetBytes(int64(len(benchAnnexBData)))
+	b.ReportAllocs()
+	for b.Loop() {
+		ParseAnnexBFunc(benchAnnexBData, func(NALUnit) bool { return true })
+	}
+}
+
+func BenchmarkHandleVideoH264(b *testing.B) {
+	// A typical sliced access unit: AUD, SEI and eight slice NAL units.
+	delta := []byte{0x00, 0x00, 0x00, 0x01, 0x09, 0xF0}
+	delta = append(delta, 0x00, 0x00, 0x00, 0x01, 0x06, 0x05, 0x01, 0xAA, 0x80)
+	for range 8 {
+		delta = append(delta, 0x00, 0x00, 0x01, 0x41)
+		delta = append(delta, bytes.Repeat([]byte{0x9A}, 1500)...)
+	}
+
+	// The same with parameter sets and IDR slices, as at a group start.
+	keyframe := []byte{0x00, 0x00, 0x00, 0x01}
+	keyframe = append(keyframe, benchSPSData...)
+	keyframe = append(keyframe, 0x00, 0x00, 0x00, 0x01, 0x68, 0xCE, 0x38, 0x80)
+	for range 8 {
+		keyframe = append(keyframe, 0x00, 0x00, 0x01, 0x65)
+		keyframe = append(keyframe, bytes.Repeat([]byte{0x9A}, 1500)...)
+	}
+
+	for _, bc := range []struct {
+		name string
+		au   []byte
+	}{
+		{"delta", delta},
+		{"keyframe", keyframe},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			d := NewDemuxer(bytes.NewReader(nil), nil)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go func() {
+				for {
+					select {
+					case <-d.Video():
+					case <-ctx.Done():
+						return
+					}
+				}
+			}()
+
+			b.SetBytes(int64(len(bc.au)))
+			b.ReportAllocs()
+			for b.Loop() {
+				d.handleVideoH264(ctx, bc.au, 0, 0)
+			}
+		})
+	}
+}
+
 func BenchmarkParseSPS(b *testing.B) {
 	b.SetBytes(int64(len(benchSPSData)))
 	for b.Loop() {
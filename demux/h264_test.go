@@ -1,6 +1,8 @@
 package demux
 
 import (
+	"bytes"
+	"math/rand"
 	"testing"
 )
 
@@ -339,6 +341,127 @@ func TestParsePicTimingSEI(t *testing.T) {
 	}
 }
 
+func TestHasRecoveryPointSEI(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		nal  []byte
+		want bool
+	}{
+		{
+			// recovery_frame_cnt=0, exact_match=1, broken_link=0, changing_slice_group_idc=0.
+			name: "recovery point only",
+			nal:  []byte{0x06, 0x06, 0x01, 0xC4, 0x80},
+			want: true,
+		},
+		{
+			name: "after another payload",
+			nal:  []byte{0x06, 0x05, 0x01, 0x00, 0x06, 0x01, 0xC4, 0x80},
+			want: true,
+		},
+		{
+			name: "pic timing only",
+			nal:  []byte{0x06, 0x01, 0x03, 0x00, 0x02, 0x02, 0x80},
+			want: false,
+		},
+		{
+			name: "truncated payload",
+			nal:  []byte{0x06, 0x06, 0x05, 0xC4},
+			want: false,
+		},
+		{
+			name: "too short",
+			nal:  []byte{0x06},
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := HasRecoveryPointSEI(tt.nal); got != tt.want {
+				t.Errorf("HasRecoveryPointSEI = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitCaptionSEI(t *testing.T) {
+	t.Parallel()
+	// ATSC A/53 user_data_registered_itu_t_t35 payload with one CEA-608 pair.
+	a53 := []byte{0xB5, 0x00, 0x31, 'G', 'A', '9', '4', 0x03, 0xC1, 0xFF, 0xFC, 0x94, 0x20, 0xFF}
+	captionMsg := append([]byte{0x04, byte(len(a53))}, a53...)
+	captionNAL := func(header ...byte) []byte {
+		return append(append(header, captionMsg...), 0x80)
+	}
+	picTiming := []byte{0x01, 0x03, 0x00, 0x02, 0x02}
+
+	tests := []struct {
+		name   string
+		nal    []byte
+		hdrLen int
+		want   [][]byte
+	}{
+		{
+			name:   "single caption message",
+			nal:    captionNAL(0x06),
+			hdrLen: 1,
+			want:   [][]byte{captionNAL(0x06)},
+		},
+		{
+			name:   "captions after pic timing",
+			nal:    append(append([]byte{0x06}, picTiming...), captionNAL()...),
+			hdrLen: 1,
+			want:   [][]byte{captionNAL(0x06)},
+		},
+		{
+			name:   "two caption messages",
+			nal:    append(append([]byte{0x06}, captionMsg...), captionNAL()...),
+			hdrLen: 1,
+			want:   [][]byte{captionNAL(0x06), captionNAL(0x06)},
+		},
+		{
+			name:   "hevc captions after time code",
+			nal:    append([]byte{0x4E, 0x01, 0x88, 0x01, 0x00}, captionNAL()...),
+			hdrLen: 2,
+			want:   [][]byte{captionNAL(0x4E, 0x01)},
+		},
+		{
+			name:   "emulation prevention kept",
+			nal:    append(append([]byte{0x06}, picTiming...), 0x04, 0x06, 0xB5, 0x00, 0x31, 0x00, 0x00, 0x03, 0x01, 0x80),
+			hdrLen: 1,
+			want:   [][]byte{{0x06, 0x04, 0x06, 0xB5, 0x00, 0x31, 0x00, 0x00, 0x03, 0x01, 0x80}},
+		},
+		{
+			name:   "no captions",
+			nal:    append(append([]byte{0x06}, picTiming...), 0x06, 0x01, 0xC4, 0x80),
+			hdrLen: 1,
+			want:   nil,
+		},
+		{
+			name:   "too short",
+			nal:    []byte{0x06},
+			hdrLen: 1,
+			want:   nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got := splitCaptionSEI(tt.nal, tt.hdrLen)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d NAL units, want %d", len(got), len(tt.want))
+			}
+			for i := range got {
+				if !bytes.Equal(got[i], tt.want[i]) {
+					t.Errorf("NAL unit %d = % X, want % X", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
 func TestTimecodeString(t *testing.T) {
 	t.Parallel()
 	tc := Timecode{Hours: 1, Minutes: 2, Seconds: 3, Frames: 4}
@@ -347,3 +470,80 @@ func TestTimecodeString(t *testing.T) {
 		t.Errorf("String(): got %q, want %q", tc.String(), want)
 	}
 }
+
+func TestParseAnnexBFuncMatchesParseAnnexB(t *testing.T) {
+	t.Parallel()
+
+	inputs := [][]byte{
+		nil,
+		{0x00, 0x01},
+		{0x00, 0x00, 0x00, 0x01},
+		{0x00, 0x00, 0x01, 0x67},
+		{0x00, 0x00, 0x00, 0x01, 0x67, 0x42, 0x00, 0x00, 0x01, 0x68, 0xCE},
+		{0x00, 0x00, 0x00, 0x01, 0x06, 0xAA, 0xBB, 0x00, 0x00, 0x00, 0x01, 0x41, 0x9A},
+		{0x00, 0x00, 0x01, 0x00, 0x00, 0x01, 0x65, 0x88},                         // empty NAL between start codes
+		{0xFF, 0xEE, 0x00, 0x00, 0x01, 0x41, 0x9A, 0x00, 0x00, 0x00, 0x00, 0x01}, // leading junk, trailing start code
+		{0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x40, 0x01, 0x0C, 0x00, 0x00, 0x01, 0x42},
+		benchAnnexBData,
+	}
+
+	// Random streams biased towards zero and one bytes exercise start code
+	// boundaries the hand-written cases miss.
+	rng := rand.New(rand.NewSource(1))
+	for range 500 {
+		b := make([]byte, rng.Intn(64))
+		for i := range b {
+			switch rng.Intn(4) {
+			case 0, 1:
+				b[i] = 0
+			case 2:
+				b[i] = 1
+			default:
+				b[i] = byte(rng.Intn(256))
+			}
+		}
+		inputs = append(inputs, b)
+	}
+
+	collect := func(iter func([]byte, func(NALUnit) bool), data []byte) []NALUnit {
+		var out []NALUnit
+		iter(data, func(n NALUnit) bool {
+			out = append(out, n)
+			return true
+		})
+		return out
+	}
+	equal := func(a, b []NALUnit) bool {
+		if len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if a[i].Type != b[i].Type || !bytes.Equal(a[i].Data, b[i].Data) {
+				return false
+			}
+		}
+		return true
+	}
+
+	for _, in := range inputs {
+		if got, want := collect(ParseAnnexBFunc, in), ParseAnnexB(in); !equal(got, want) {
+			t.Fatalf("ParseAnnexBFunc(% x) = %v, want %v", in, got, want)
+		}
+		if got, want := collect(ParseAnnexBHEVCFunc, in), ParseAnnexBHEVC(in); !equal(got, want) {
+			t.Fatalf("ParseAnnexBHEVCFunc(% x) = %v, want %v", in, got, want)
+		}
+	}
+}
+
+func TestParseAnnexBFuncStopsEarly(t *testing.T) {
+	t.Parallel()
+
+	var types []byte
+	ParseAnnexBFunc(benchAnnexBData, func(n NALUnit) bool {
+		types = append(types, n.Type)
+		return n.Type != NALTypePPS
+	})
+	if !bytes.Equal(types, []byte{NALTypeSPS, NALTypePPS}) {
+		t.Fatalf("visited types %v, want [SPS PPS]", types)
+	}
+}
@@ -19,6 +19,9 @@ const (
 	HEVCNALSEIPrefix  = 39
 )
 
+// hevcSEIPayloadTimeCode is the time_code SEI message (H.265 D.2.27).
+const hevcSEIPayloadTimeCode = 136
+
 // HEVCNALType extracts the NAL unit type from the first byte of an HEVC
 // 2-byte NAL header: forbidden(1) | type(6) | layerID_high(1).
 func HEVCNALType(firstByte byte) byte {
@@ -31,6 +34,20 @@ func IsHEVCKeyframe(nalType byte) bool {
 	return nalType >= HEVCNALBlaWLP && nalType <= HEVCNALCraNut
 }
 
+// IsHEVCVCL returns true if the NAL type carries slice segment data
+// (types 0-31).
+func IsHEVCVCL(nalType byte) bool { return nalType < 32 }
+
+// IsHEVCSubLayerNonReference returns true if the NAL type is a VCL type
+// whose picture no other picture of the same temporal sub-layer
+// references (TRAIL_N, TSA_N, STSA_N, RADL_N, RASL_N and the reserved
+// RSV_VCL_N types: the even types below 16). Pictures of higher
+// sub-layers may still reference it, so it is unreferenced altogether
+// only at the highest TemporalId the SPS allows.
+func IsHEVCSubLayerNonReference(nalType byte) bool {
+	return nalType < 16 && nalType%2 == 0
+}
+
 // IsHEVCVPS returns true if the NAL type is a Video Parameter Set.
 func IsHEVCVPS(nalType byte) bool { return nalType == HEVCNALVPS }
 
@@ -44,9 +61,17 @@ func IsHEVCPPS(nalType byte) bool { return nalType == HEVCNALPPS }
 // HEVC 2-byte NAL header for type extraction. Start codes are identical
 // to H.264 (00 00 01 or 00 00 00 01).
 func ParseAnnexBHEVC(data []byte) []NALUnit {
-	return parseAnnexBGeneric(data, 2, func(d []byte) byte { return HEVCNALType(d[0]) })
+	return parseAnnexBGeneric(data, 2, hevcNALType)
 }
 
+// ParseAnnexBHEVCFunc is the allocation-free iterator form of
+// ParseAnnexBHEVC; see ParseAnnexBFunc.
+func ParseAnnexBHEVCFunc(data []byte, fn func(NALUnit) bool) {
+	forEachAnnexBNAL(data, 2, hevcNALType, fn)
+}
+
+func hevcNALType(d []byte) byte { return HEVCNALType(d[0]) }
+
 // HEVCSPSInfo holds parameters extracted from an HEVC SPS NAL unit.
 type HEVCSPSInfo struct {
 	Width      int
@@ -61,6 +86,23 @@ type HEVCSPSInfo struct {
 	ChromaFormatIdc      byte
 	BitDepthLumaMinus8   byte
 	BitDepthChromaMinus8 byte
+
+	// Colorimetry is the VUI colour description; it is unknown when the
+	// SPS does not carry one or could not be parsed that far.
+	Colorimetry Colorimetry
+
+	// MaxSubLayersMinus1 is sps_max_sub_layers_minus1: the highest
+	// TemporalId of the pictures the SPS applies to.
+	MaxSubLayersMinus1 byte
+}
+
+// HEVCTemporalID returns the TemporalId from an HEVC 2-byte NAL header,
+// or 0 if nal is shorter than one.
+func HEVCTemporalID(nal []byte) byte {
+	if len(nal) < 2 || nal[1]&0x07 == 0 {
+		return 0
+	}
+	return nal[1]&0x07 - 1
 }
 
 // CodecString returns the RFC 6381 codec parameter string (e.g.
@@ -124,7 +166,7 @@ func ParseHEVCSPS(nalu []byte) (HEVCSPSInfo, error) {
 	}
 
 	// profile_tier_level
-	info := HEVCSPSInfo{}
+	info := HEVCSPSInfo{MaxSubLayersMinus1: byte(maxSubLayersMinus1)}
 	if err := parseHEVCProfileTierLevel(br, &info, maxSubLayersMinus1); err != nil {
 		return HEVCSPSInfo{}, err
 	}
@@ -215,9 +257,151 @@ func ParseHEVCSPS(nalu []byte) (HEVCSPSInfo, error) {
 	}
 	info.BitDepthChromaMinus8 = byte(bdc)
 
+	// The colour description sits in the VUI at the end of the SPS. A
+	// malformed tail leaves it unknown but keeps the fields above.
+	parseHEVCSPSColorimetry(br, &info, maxSubLayersMinus1)
+
 	return info, nil
 }
 
+// parseHEVCSPSColorimetry reads the rest of an SPS, from
+// log2_max_pic_order_cnt_lsb_minus4, through to the VUI colour
+// description (H.265 7.3.2.2.1, E.2.1).
+func parseHEVCSPSColorimetry(br *bitReader, info *HEVCSPSInfo, maxSubLayersMinus1 uint) {
+	var err error
+	read := func(n int) uint {
+		if err != nil {
+			return 0
+		}
+		var v uint
+		v, err = br.readBits(n)
+		return v
+	}
+	readUE := func() uint {
+		if err != nil {
+			return 0
+		}
+		var v uint
+		v, err = br.readUE()
+		return v
+	}
+
+	log2MaxPOCLsb := readUE() + 4
+	first := maxSubLayersMinus1
+	if read(1) == 1 { // sps_sub_layer_ordering_info_present_flag
+		first = 0
+	}
+	for i := first; i <= maxSubLayersMinus1; i++ {
+		readUE() // sps_max_dec_pic_buffering_minus1
+		readUE() // sps_max_num_reorder_pics
+		readUE() // sps_max_latency_increase_plus1
+	}
+	for range 6 { // coding and transform block sizes and depths
+		readUE()
+	}
+	if read(1) == 1 && read(1) == 1 { // scaling list enabled and present
+		if err == nil {
+			err = skipHEVCScalingListData(br)
+		}
+	}
+	read(2)           // amp_enabled_flag, sample_adaptive_offset_enabled_flag
+	if read(1) == 1 { // pcm_enabled_flag
+		read(8) // pcm sample bit depths
+		readUE()
+		readUE()
+		read(1) // pcm_loop_filter_disabled_flag
+	}
+
+	numSets := readUE()
+	if numSets > 64 {
+		return
+	}
+	numDeltaPocs := make([]uint, numSets)
+	for i := range numDeltaPocs {
+		if err != nil {
+			return
+		}
+		if i > 0 && read(1) == 1 { // inter_ref_pic_set_prediction_flag
+			read(1)  // delta_rps_sign
+			readUE() // abs_delta_rps_minus1
+			for range numDeltaPocs[i-1] + 1 {
+				used := read(1)
+				if used == 1 || read(1) == 1 { // use_delta_flag
+					numDeltaPocs[i]++
+				}
+			}
+			continue
+		}
+		neg, pos := readUE(), readUE()
+		if neg > 16 || pos > 16 {
+			return
+		}
+		for range neg + pos {
+			readUE() // delta_poc_minus1
+			read(1)  // used_by_curr_pic_flag
+		}
+		numDeltaPocs[i] = neg + pos
+	}
+
+	if read(1) == 1 { // long_term_ref_pics_present_flag
+		n := readUE()
+		if n > 32 {
+			return
+		}
+		for range n {
+			read(int(log2MaxPOCLsb) + 1) // lt_ref_pic_poc_lsb_sps, used flag
+		}
+	}
+	read(2) // sps_temporal_mvp_enabled_flag, strong_intra_smoothing_enabled_flag
+
+	if read(1) == 0 || err != nil { // vui_parameters_present_flag
+		return
+	}
+	if read(1) == 1 { // aspect_ratio_info_present_flag
+		if read(8) == 255 {
+			read(32) // sar_width, sar_height
+		}
+	}
+	if read(1) == 1 { // overscan_info_present_flag
+		read(1)
+	}
+	if read(1) == 1 && err == nil { // video_signal_type_present_flag
+		info.Colorimetry.readVideoSignalType(br)
+	}
+}
+
+// skipHEVCScalingListData skips an SPS scaling_list_data (H.265 7.3.4).
+func skipHEVCScalingListData(br *bitReader) error {
+	for sizeID := range 4 {
+		step := 1
+		if sizeID == 3 {
+			step = 3
+		}
+		for matrixID := 0; matrixID < 6; matrixID += step {
+			predMode, err := br.readBits(1)
+			if err != nil {
+				return err
+			}
+			if predMode == 0 {
+				if _, err := br.readUE(); err != nil { // scaling_list_pred_matrix_id_delta
+					return err
+				}
+				continue
+			}
+			coefNum := min(64, 1<<(4+sizeID<<1))
+			if sizeID > 1 {
+				coefNum++ // scaling_list_dc_coef_minus8
+			}
+			for range coefNum {
+				if _, err := br.readSE(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
 func parseHEVCProfileTierLevel(br *bitReader, info *HEVCSPSInfo, maxSubLayersMinus1 uint) error {
 	// general_profile_space (2 bits)
 	if _, err := br.readBits(2); err != nil {
@@ -314,3 +498,81 @@ func parseHEVCProfileTierLevel(br *bitReader, info *HEVCSPSInfo, maxSubLayersMin
 
 	return nil
 }
+
+// ParseHEVCTimeCodeSEI extracts a SMPTE 12M timecode from the first clock
+// timestamp of a time_code message in an HEVC prefix SEI NAL unit. It
+// returns false if the NAL unit carries no time_code message or none of
+// its timestamps are set.
+func ParseHEVCTimeCodeSEI(seiNALU []byte) (Timecode, bool) {
+	if len(seiNALU) < 3 {
+		return Timecode{}, false
+	}
+
+	var tc Timecode
+	var found bool
+	forEachSEIMessage(seiNALU[2:], func(payloadType int, payload []byte) bool {
+		if payloadType == hevcSEIPayloadTimeCode {
+			tc, found = parseHEVCTimeCodePayload(payload)
+		}
+		return !found
+	})
+	return tc, found
+}
+
+func parseHEVCTimeCodePayload(payload []byte) (Timecode, bool) {
+	br := newBitReader(payload)
+
+	numClockTS, err := br.readBits(2)
+	if err != nil {
+		return Timecode{}, false
+	}
+
+	for c := uint(0); c < numClockTS; c++ {
+		clockTSFlag, err := br.readBits(1)
+		if err != nil {
+			return Timecode{}, false
+		}
+		if clockTSFlag == 0 {
+			continue
+		}
+
+		br.readBits(1) // units_field_based_flag
+		br.readBits(5) // counting_type
+		fullTSFlag, _ := br.readBits(1)
+		br.readBits(1) // discontinuity_flag
+		br.readBits(1) // cnt_dropped_flag
+		nFrames, err := br.readBits(9)
+		if err != nil {
+			return Timecode{}, false
+		}
+
+		var secs, mins, hours uint
+		if fullTSFlag == 1 {
+			secs, _ = br.readBits(6)
+			mins, _ = br.readBits(6)
+			hours, _ = br.readBits(5)
+		} else {
+			secFlag, _ := br.readBits(1)
+			if secFlag == 1 {
+				secs, _ = br.readBits(6)
+				minFlag, _ := br.readBits(1)
+				if minFlag == 1 {
+					mins, _ = br.readBits(6)
+					hrFlag, _ := br.readBits(1)
+					if hrFlag == 1 {
+						hours, _ = br.readBits(5)
+					}
+				}
+			}
+		}
+
+		return Timecode{
+			Hours:   int(hours),
+			Minutes: int(mins),
+			Seconds: int(secs),
+			Frames:  int(nFrames),
+		}, true
+	}
+
+	return Timecode{}, false
+}
@@ -188,6 +188,25 @@ func TestHEVCSPSCodecStringHighTier(t *testing.T) {
 	}
 }
 
+func TestParseHEVCSPSSubLayers(t *testing.T) {
+	t.Parallel()
+	for _, tt := range []struct {
+		sps  []byte
+		want byte
+	}{
+		{hevcSPS, 0},
+		{hevcSPS3SubLayers, 2},
+	} {
+		info, err := ParseHEVCSPS(tt.sps)
+		if err != nil {
+			t.Fatalf("ParseHEVCSPS error: %v", err)
+		}
+		if info.MaxSubLayersMinus1 != tt.want || info.Width != 320 || info.Height != 240 {
+			t.Errorf("MaxSubLayersMinus1 = %d at %dx%d, want %d at 320x240", info.MaxSubLayersMinus1, info.Width, info.Height, tt.want)
+		}
+	}
+}
+
 func TestParseHEVCSPSTooShort(t *testing.T) {
 	t.Parallel()
 	_, err := ParseHEVCSPS([]byte{0x42, 0x01, 0x01})
@@ -224,3 +243,52 @@ func TestIsHEVCVPSSPSPPS(t *testing.T) {
 		t.Error("IsHEVCPPS should return false for VPS")
 	}
 }
+
+func TestParseHEVCTimeCodeSEI(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		nal  []byte
+		want Timecode
+		ok   bool
+	}{
+		{
+			name: "full timestamp 10:59:30:24",
+			nal:  []byte{0x4E, 0x01, 0x88, 0x06, 0x60, 0x40, 0xC3, 0xDD, 0xA8, 0x00, 0x80},
+			want: Timecode{Hours: 10, Minutes: 59, Seconds: 30, Frames: 24},
+			ok:   true,
+		},
+		{
+			name: "seconds only 00:00:07:05",
+			nal:  []byte{0x4E, 0x01, 0x88, 0x05, 0x60, 0x00, 0x2C, 0x70, 0x00, 0x80},
+			want: Timecode{Seconds: 7, Frames: 5},
+			ok:   true,
+		},
+		{
+			name: "no clock timestamp",
+			nal:  []byte{0x4E, 0x01, 0x88, 0x01, 0x40, 0x80},
+		},
+		{
+			name: "other SEI payload",
+			nal:  []byte{0x4E, 0x01, 0x06, 0x01, 0xC4, 0x80},
+		},
+		{
+			name: "too short",
+			nal:  []byte{0x4E, 0x01},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, ok := ParseHEVCTimeCodeSEI(tt.nal)
+			if ok != tt.ok {
+				t.Fatalf("ok: got %v, want %v", ok, tt.ok)
+			}
+			if ok && got != tt.want {
+				t.Errorf("timecode: got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package demux
+
+import (
+	"sync"
+	"time"
+)
+
+// LogSampler decides which occurrences of a repetitive event are logged,
+// so a burst such as a run of corrupt packets on a lossy feed does not
+// flood the log. Sample is called once per occurrence; when it reports
+// true, suppressed is the number of occurrences skipped since the last
+// one logged.
+type LogSampler interface {
+	Sample() (log bool, suppressed int64)
+}
+
+// defaultCorruptLogInterval spaces corrupt-packet log lines when no
+// sampler is configured.
+const defaultCorruptLogInterval = time.Second
+
+// IntervalSampler logs the first occurrence and then at most one per
+// interval. It is safe for concurrent use.
+type IntervalSampler struct {
+	interval time.Duration
+	now      func() time.Time
+
+	mu         sync.Mutex
+	last       time.Time
+	suppressed int64
+}
+
+// NewIntervalSampler returns a sampler that logs at most once per
+// interval. An interval <= 0 logs every occurrence.
+func NewIntervalSampler(interval time.Duration) *IntervalSampler {
+	return &IntervalSampler{interval: interval, now: time.Now}
+}
+
+func (s *IntervalSampler) Sample() (bool, int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	if !s.last.IsZero() && now.Sub(s.last) < s.interval {
+		s.suppressed++
+		return false, 0
+	}
+	s.last = now
+	suppressed := s.suppressed
+	s.suppressed = 0
+	return true, suppressed
+}
+
+// EveryNSampler logs the first occurrence and every nth after it. It is
+// safe for concurrent use.
+type EveryNSampler struct {
+	n int64
+
+	mu    sync.Mutex
+	count int64
+}
+
+// NewEveryNSampler returns a sampler that logs one occurrence in n. An
+// n <= 1 logs every occurrence.
+func NewEveryNSampler(n int) *EveryNSampler {
+	return &EveryNSampler{n: max(int64(n), 1)}
+}
+
+func (s *EveryNSampler) Sample() (bool, int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.count++
+	if (s.count-1)%s.n != 0 {
+		return false, 0
+	}
+	if s.count == 1 {
+		return true, 0
+	}
+	return true, s.n - 1
+}
@@ -0,0 +1,74 @@
+package demux
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIntervalSampler(t *testing.T) {
+	t.Parallel()
+	now := time.Unix(0, 0)
+	s := NewIntervalSampler(time.Second)
+	s.now = func() time.Time { return now }
+
+	steps := []struct {
+		advance        time.Duration
+		wantLog        bool
+		wantSuppressed int64
+	}{
+		{0, true, 0},
+		{100 * time.Millisecond, false, 0},
+		{500 * time.Millisecond, false, 0},
+		{400 * time.Millisecond, true, 2},
+		{999 * time.Millisecond, false, 0},
+		{5 * time.Second, true, 1},
+	}
+	for i, st := range steps {
+		now = now.Add(st.advance)
+		log, suppressed := s.Sample()
+		if log != st.wantLog || suppressed != st.wantSuppressed {
+			t.Fatalf("step %d: Sample() = (%v, %d), want (%v, %d)", i, log, suppressed, st.wantLog, st.wantSuppressed)
+		}
+	}
+}
+
+func TestEveryNSampler(t *testing.T) {
+	t.Parallel()
+	s := NewEveryNSampler(3)
+	var logged []int
+	for i := 1; i <= 7; i++ {
+		if ok, suppressed := s.Sample(); ok {
+			logged = append(logged, i)
+			if want := int64(2); i > 1 && suppressed != want {
+				t.Errorf("occurrence %d: suppressed = %d, want %d", i, suppressed, want)
+			}
+		}
+	}
+	if len(logged) != 3 || logged[0] != 1 || logged[1] != 4 || logged[2] != 7 {
+		t.Fatalf("logged occurrences = %v, want [1 4 7]", logged)
+	}
+}
+
+func TestDemuxerCorruptPacketSampling(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	log := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	d := NewDemuxer(bytes.NewReader(nil), log)
+	d.SetCorruptLogSampler(NewEveryNSampler(3))
+
+	for range 7 {
+		d.recordCorruptPacket(errors.New("bad sync byte"))
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("logged %d lines, want 3:\n%s", len(lines), buf.String())
+	}
+	if last := lines[2]; !strings.Contains(last, "suppressed=2") || !strings.Contains(last, "total=7") {
+		t.Errorf("last line = %q, want suppressed=2 and total=7", last)
+	}
+}
@@ -1,10 +1,14 @@
 package demux
 
 import (
+	"cmp"
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"log/slog"
+	"slices"
+	"sync"
 	"time"
 
 	"github.com/zsiec/ccx"
@@ -17,14 +21,42 @@ const (
 	streamTypeH264            = 0x1B
 	streamTypeH265            = 0x24
 	streamTypeAAC             = 0x0F
+	streamTypeAC3             = 0x81 // ATSC A/52
+	streamTypeEAC3            = 0x87 // ATSC A/52 Annex G
+	streamTypeSCTE35          = 0x86
 	scte35PIDWellKnown uint16 = 500
+
+	// scte35BufferSize bounds the SCTE-35 event channel. Cues are rare, so
+	// a handful of slots is plenty; a consumer that stops draining loses
+	// cues rather than stalling the demuxer.
+	scte35BufferSize = 8
+
+	// scte35DedupWindow is how long after its last repeat an identical
+	// SCTE-35 cue is still treated as a duplicate. Encoders commonly
+	// resend a cue every second or so ahead of its splice time.
+	scte35DedupWindow = 10 * time.Second
+
+	// defaultDiscontinuityThreshold is how far video PTS must jump
+	// backward to be treated as a discontinuity. It comfortably exceeds
+	// B-frame reordering, which steps PTS back by a few frame intervals.
+	defaultDiscontinuityThreshold = time.Second
+
+	// ptsWrapUS is the span of the 33-bit 90kHz PTS in microseconds. A
+	// backward jump of more than half of it is a wrap, not a splice.
+	ptsWrapUS = (1 << 33) * 1_000_000 / 90_000
+
+	// pts90kMask keeps a PTS in 90kHz ticks within its 33 bits.
+	pts90kMask = 1<<33 - 1
 )
 
 // AudioTrackInfo associates an MPEG-TS PID with its zero-based track index,
 // used to distinguish multiple audio programs within a single transport stream.
+// Indices are assigned in PID order as PMTs declare new audio streams, and
+// never change once assigned.
 type AudioTrackInfo struct {
 	PID        uint16
 	TrackIndex int
+	Codec      string // media.AudioCodecAAC, AudioCodecAC3 or AudioCodecEAC3
 }
 
 // StatsRecorder is the interface accepted by Demuxer for recording stream
@@ -33,16 +65,35 @@ type StatsRecorder interface {
 	RecordVideoFrame(bytes int64, isKeyframe bool, pts int64)
 	RecordAudioFrame(trackIdx int, bytes int64, pts int64, sampleRate, channels int)
 	RecordCaption(channel int)
+	RecordCaptionService(service int, ch CaptionChannel)
 	RecordResolution(width, height int)
+	RecordColorimetry(c Colorimetry)
+	RecordPicStruct(ps PicStruct)
+	RecordAFD(afd AFD)
+	RecordBarData(bars BarData)
 	RecordTimecode(tc string)
 	RecordSCTE35(event SCTE35Event)
+	RecordDuplicateSCTE35()
 	RecordVideoCodec(codec string)
+	RecordHasVideo(hasVideo bool)
+	RecordCorruptPacket()
+	RecordReorderedPacket()
+	RecordDiscontinuity()
+	RecordVideoPTSReset()
+	RecordAudioPTSReset(trackIdx int)
+	RecordUnsupportedStreamType(streamType uint8)
+	RecordConditionalAccess(systemID uint16)
+	RecordPacketSize(size int)
 }
 
 // SCTE35Event represents a parsed SCTE-35 splice information event extracted
 // from the transport stream, including splice inserts, time signals, and
 // segmentation descriptors used for ad insertion and content identification.
 type SCTE35Event struct {
+	// PTS is the splice time of a time_signal, with the section's
+	// pts_adjustment and any offset set by SetSCTE35PTSOffset applied, in
+	// microseconds like the PTS of video and audio frames; zero when the
+	// cue has none.
 	PTS                int64   `json:"pts"`
 	CommandType        string  `json:"commandType"`
 	CommandTypeID      uint32  `json:"commandTypeId"`
@@ -50,43 +101,120 @@ type SCTE35Event struct {
 	SegmentationType   string  `json:"segmentationType,omitempty"`
 	SegmentationTypeID uint32  `json:"segmentationTypeId,omitempty"`
 	Duration           float64 `json:"duration,omitempty"`
+	AutoReturn         bool    `json:"autoReturn,omitempty"`
 	OutOfNetwork       bool    `json:"outOfNetwork,omitempty"`
 	Immediate          bool    `json:"immediate,omitempty"`
+	Cancel             bool    `json:"cancel,omitempty"`
 	Description        string  `json:"description"`
 	ReceivedAt         int64   `json:"receivedAt"`
+
+	// Section is the raw splice_info_section the event was parsed from,
+	// for clients that run their own SCTE-35 parser.
+	Section []byte `json:"section,omitempty"`
 }
 
 // Demuxer splits an MPEG-TS byte stream into video frames, audio frames,
 // closed captions (CEA-608/708), and SCTE-35 events. It supports both H.264
 // and H.265 video with multiple AAC audio tracks. Parsed output is delivered
-// through channels obtained via the Video, Audio, and Captions methods.
+// through channels obtained via the Video, Audio, Captions, and SCTE35 methods.
 type Demuxer struct {
 	log         *slog.Logger
 	reader      io.Reader
 	videoCh     chan *media.VideoFrame
 	audioCh     chan *media.AudioFrame
-	captionCh   chan *ccx.CaptionFrame
+	captionCh   chan *media.CaptionFrame
+	scte35Ch    chan *SCTE35Event
+	eventCh     chan DemuxEvent
 	cea608Decs  map[int]*ccx.CEA608Decoder
 	cea708Svcs  map[int]*ccx.CEA708Service
+	captionChan CaptionChannelFunc
 	dtvccBuf    []byte
 	videoPID    uint16
 	audioPIDs   map[uint16]int
 	audioTracks []AudioTrackInfo
 	pmtReady    chan struct{}
 	pmtDone     bool
+
+	// tracksMu guards videoPID, audioTracks, unsupportedTypes and
+	// caSystems for readers outside Run, which is their only writer. tracksChanged is
+	// signalled when videoPID or audioTracks changes.
+	tracksMu      sync.Mutex
+	tracksChanged chan struct{}
+
+	// unsupportedTypes lists, in order of discovery, the PMT stream types
+	// the demuxer does not handle, each reported once.
+	unsupportedTypes []uint8
+
+	// caSystems lists, in order of discovery, the CA systems the PMT
+	// declares scrambling the program or its streams.
+	caSystems []uint16
+
 	isHEVC      bool
 	sps         []byte
 	pps         []byte
 	vps         []byte
 	spsInfo     SPSInfo
 	hevcSPSInfo HEVCSPSInfo
+	hevcSPSSet  bool // hevcSPSInfo was parsed from an SPS
 	groupID     uint32
 	videoCount  int64
+	arrivedAt   time.Time // when the video PES being handled reached the demuxer
+	pts90k      int64     // PTS of the video PES being handled, in 90kHz ticks
+	dts90k      int64     // DTS of the video PES being handled, in 90kHz ticks
+	has90k      bool      // the video PES being handled carried a PTS
 	stats       StatsRecorder
+	au          auBuilder
+
+	// timecode is the SEI timecode of the access unit being handled, or
+	// nil if it carries none.
+	timecode *media.Timecode
+
+	// privateTimecodeTag is the adaptation field private data tag read
+	// for timecode, or 0 to ignore private data. privateTimecode is the
+	// timecode found there for the video PES being handled, used when
+	// the access unit has no SEI timecode.
+	privateTimecodeTag uint8
+	privateTimecode    *Timecode
+
+	corruptLog     LogSampler
+	corruptPackets int64
+
+	// repairEPB enables emulation prevention repair of egress NAL units,
+	// logged through epbLog; see SetEmulationPreventionRepair.
+	repairEPB bool
+	epbLog    LogSampler
+
+	// reorderWindow and reorderWait configure the TS packet reorder
+	// window; see SetReorderWindow.
+	reorderWindow int
+	reorderWait   time.Duration
+
+	discontinuityThreshold time.Duration // 0 disables detection
+	lastVideoPTS           int64
+	discontinuity          bool // awaiting the keyframe after a backward jump
+	signaledDiscontinuity  bool // discontinuity_indicator set on the video PES being handled
+
+	// aacChannelFix enables AAC channel count correction; aacChannels
+	// holds each audio track's count from its last program config
+	// element. See audioChannels.
+	aacChannelFix bool
+	aacChannels   map[int]int
+
+	// scte35Offset is added to every SCTE-35 splice time; see
+	// SetSCTE35PTSOffset.
+	scte35Offset time.Duration
+
+	// scte35Seen holds when each recent SCTE-35 cue was last received,
+	// for dropping repeats. See duplicateSCTE35.
+	scte35Seen map[scte35Key]time.Time
 
 	lastCCCtrl      [2][2]byte
 	lastCCWasCtrl   [2]bool
 	lastCCCtrlFrame [2]int64
+
+	// hasher hashes emitted frames for conformance tests; nil when
+	// hashing is off. See SetFrameHashing.
+	hasher *frameHasher
 }
 
 // NewDemuxer creates a Demuxer that reads MPEG-TS packets from r. Call Run
@@ -97,13 +225,18 @@ func NewDemuxer(r io.Reader, log *slog.Logger) *Demuxer {
 		log = slog.Default()
 	}
 	return &Demuxer{
-		log:       log.With("component", "demux"),
-		reader:    r,
-		videoCh:   make(chan *media.VideoFrame, media.VideoBufferSize),
-		audioCh:   make(chan *media.AudioFrame, media.AudioBufferSize),
-		captionCh: make(chan *ccx.CaptionFrame, media.CaptionBufferSize),
-		audioPIDs: make(map[uint16]int),
-		pmtReady:  make(chan struct{}),
+		log:           log.With("component", "demux"),
+		reader:        r,
+		videoCh:       make(chan *media.VideoFrame, media.VideoBufferSize),
+		audioCh:       make(chan *media.AudioFrame, media.AudioBufferSize),
+		captionCh:     make(chan *media.CaptionFrame, media.CaptionBufferSize),
+		scte35Ch:      make(chan *SCTE35Event, scte35BufferSize),
+		eventCh:       make(chan DemuxEvent, eventBufferSize),
+		audioPIDs:     make(map[uint16]int),
+		corruptLog:    NewIntervalSampler(defaultCorruptLogInterval),
+		epbLog:        NewIntervalSampler(defaultCorruptLogInterval),
+		pmtReady:      make(chan struct{}),
+		tracksChanged: make(chan struct{}, 1),
 		cea708Svcs: map[int]*ccx.CEA708Service{
 			1: ccx.NewCEA708Service(),
 			2: ccx.NewCEA708Service(),
@@ -112,12 +245,16 @@ func NewDemuxer(r io.Reader, log *slog.Logger) *Demuxer {
 			5: ccx.NewCEA708Service(),
 			6: ccx.NewCEA708Service(),
 		},
+		captionChan: DefaultCaptionChannel,
 		cea608Decs: map[int]*ccx.CEA608Decoder{
 			1: ccx.NewCEA608Decoder(),
 			2: ccx.NewCEA608Decoder(),
 			3: ccx.NewCEA608Decoder(),
 			4: ccx.NewCEA608Decoder(),
 		},
+		discontinuityThreshold: defaultDiscontinuityThreshold,
+		aacChannelFix:          true,
+		aacChannels:            make(map[int]int),
 	}
 }
 
@@ -133,13 +270,64 @@ func (d *Demuxer) Audio() <-chan *media.AudioFrame {
 
 // Captions returns the channel on which decoded CEA-608/708 caption frames
 // are delivered.
-func (d *Demuxer) Captions() <-chan *ccx.CaptionFrame {
+func (d *Demuxer) Captions() <-chan *media.CaptionFrame {
 	return d.captionCh
 }
 
+// SCTE35 returns the channel on which parsed SCTE-35 events are delivered.
+// Events are dropped, not queued, if the channel is full.
+func (d *Demuxer) SCTE35() <-chan *SCTE35Event {
+	return d.scte35Ch
+}
+
+// Events returns the channel on which demuxing anomalies are reported:
+// corrupt packets, payloads that fail to parse, discontinuities and
+// unsupported streams. Like SCTE35, events are dropped rather than queued
+// if the channel is full, so it need not be read.
+func (d *Demuxer) Events() <-chan DemuxEvent {
+	return d.eventCh
+}
+
+// HasVideo reports whether the PMT declared a supported video elementary
+// stream. It is only meaningful once PMTReady has been closed.
+func (d *Demuxer) HasVideo() bool {
+	d.tracksMu.Lock()
+	defer d.tracksMu.Unlock()
+	return d.videoPID != 0
+}
+
 // AudioTrackChannels returns metadata for all discovered audio tracks.
 func (d *Demuxer) AudioTrackChannels() []AudioTrackInfo {
-	return d.audioTracks
+	d.tracksMu.Lock()
+	defer d.tracksMu.Unlock()
+	return slices.Clone(d.audioTracks)
+}
+
+// UnsupportedStreamTypes returns the stream types of elementary streams
+// the PMT declared but the demuxer ignores, such as MPEG-1 audio, in order
+// of discovery. Their tracks never reach viewers.
+func (d *Demuxer) UnsupportedStreamTypes() []uint8 {
+	d.tracksMu.Lock()
+	defer d.tracksMu.Unlock()
+	return slices.Clone(d.unsupportedTypes)
+}
+
+// ConditionalAccess returns the CA system IDs of the conditional access
+// descriptors in the PMT, in order of discovery, or nil if the program is
+// in the clear. A program under conditional access is DRM protected: its
+// scrambled streams demux as garbage that no decoder can play.
+func (d *Demuxer) ConditionalAccess() []uint16 {
+	d.tracksMu.Lock()
+	defer d.tracksMu.Unlock()
+	return slices.Clone(d.caSystems)
+}
+
+// TracksChanged returns a channel that receives a value when a PMT adds a
+// track: the video stream, or an audio stream beyond those already
+// found. Changes made while a value is pending are coalesced into it, so
+// a reader should re-read HasVideo and AudioTrackChannels on each receive.
+func (d *Demuxer) TracksChanged() <-chan struct{} {
+	return d.tracksChanged
 }
 
 // PMTReady returns a channel that is closed once the first PMT has been
@@ -154,6 +342,73 @@ func (d *Demuxer) SetStats(s StatsRecorder) {
 	d.stats = s
 }
 
+// SetCorruptLogSampler replaces the sampler that rate-limits the log line
+// for corrupt packets, which by default is written at most once per
+// second. Every corrupt packet is still counted by the StatsRecorder.
+func (d *Demuxer) SetCorruptLogSampler(s LogSampler) {
+	d.corruptLog = s
+}
+
+// SetDiscontinuityThreshold sets how far video PTS must jump backward to
+// be treated as a discontinuity; the default is one second. Zero disables
+// detection, leaving backward jumps to show up only as PTS errors.
+func (d *Demuxer) SetDiscontinuityThreshold(threshold time.Duration) {
+	d.discontinuityThreshold = threshold
+}
+
+// SetReorderWindow sets how many TS packets per PID, at most 7, are held
+// for up to wait when they arrive ahead of a continuity counter gap, so
+// packets delivered slightly out of order are reassembled in order
+// rather than breaking the PES they belong to. Each packet put back in
+// order is counted by the StatsRecorder. It is off by default; 0 packets
+// turns it off. Call it before Run.
+func (d *Demuxer) SetReorderWindow(packets int, wait time.Duration) {
+	d.reorderWindow = packets
+	d.reorderWait = wait
+}
+
+// SetAACChannelCorrection sets whether AAC channel counts are corrected;
+// it is on by default. Correction counts channel configuration 7 as the
+// eight channels of 7.1, and takes the count for configuration 0 from the
+// program config element, as for dual-mono. Off reports the ADTS
+// channel_configuration as-is.
+func (d *Demuxer) SetAACChannelCorrection(on bool) {
+	d.aacChannelFix = on
+}
+
+// SetPrivateDataTimecode enables reading timecode from the adaptation
+// field private data of video packets, for sources that carry it there
+// rather than in SEI; see ParsePrivateDataTimecode. tag selects the data
+// field holding it. It is off by default; a tag of 0 turns it off.
+func (d *Demuxer) SetPrivateDataTimecode(tag uint8) {
+	d.privateTimecodeTag = tag
+}
+
+// SetSCTE35PTSOffset sets an offset added to the PTS of every SCTE-35
+// event, after the cue's pts_adjustment, for sources whose cues are known
+// to lead or lag the frames they mark. It is zero by default.
+func (d *Demuxer) SetSCTE35PTSOffset(offset time.Duration) {
+	d.scte35Offset = offset
+}
+
+// SetCaptionChannels sets the caption channel each CEA-708 service's
+// captions are emitted on. The default, DefaultCaptionChannel, puts
+// service N on channel N+6. The service number itself is reported with
+// its channel through StatsRecorder.RecordCaptionService, as caption
+// frames carry only the channel.
+func (d *Demuxer) SetCaptionChannels(fn CaptionChannelFunc) {
+	d.captionChan = fn
+}
+
+// SetEmulationPreventionRepair sets whether each video NAL unit is checked
+// with ValidEmulationPrevention before it is forwarded, and repaired with
+// RepairEmulationPrevention if it fails, so a source that leaves bytes
+// unescaped, or zero bytes trailing a NAL unit, does not reach viewers as
+// undecodable AVC1. It is off by default.
+func (d *Demuxer) SetEmulationPreventionRepair(on bool) {
+	d.repairEPB = on
+}
+
 // Run starts the demuxing loop, reading MPEG-TS packets from the underlying
 // reader until EOF or context cancellation. Parsed frames are sent to the
 // Video, Audio, and Captions channels. Run closes all output channels on return.
@@ -161,6 +416,8 @@ func (d *Demuxer) Run(ctx context.Context) error {
 	defer close(d.videoCh)
 	defer close(d.audioCh)
 	defer close(d.captionCh)
+	defer close(d.scte35Ch)
+	defer close(d.eventCh)
 
 	scte35Parser := func(ps []*mpegts.Packet) (ds []*mpegts.DemuxerData, skip bool, err error) {
 		if len(ps) == 0 {
@@ -189,8 +446,11 @@ func (d *Demuxer) Run(ctx context.Context) error {
 	}
 
 	dmx := mpegts.NewDemuxer(ctx, d.reader,
-		mpegts.DemuxerOptPacketSize(188),
+		mpegts.DemuxerOptDetectPacketSize(d.recordPacketSize),
 		mpegts.DemuxerOptPacketsParser(scte35Parser),
+		mpegts.DemuxerOptCorruptHandler(d.recordCorruptPacket),
+		mpegts.DemuxerOptReorderWindow(d.reorderWindow, d.reorderWait),
+		mpegts.DemuxerOptReorderHandler(d.recordReorderedPacket),
 	)
 
 	for {
@@ -202,40 +462,83 @@ func (d *Demuxer) Run(ctx context.Context) error {
 			if errors.Is(err, io.EOF) {
 				return nil
 			}
-			d.log.Debug("skipping corrupt packet", "error", err)
+			d.recordCorruptPacket(err)
 			continue
 		}
 
 		if data.PMT != nil {
-			audioIdx := len(d.audioTracks)
+			d.tracksMu.Lock()
+			d.noteConditionalAccess(0, data.PMT.CA)
+			changed := false
+			// newAudio collects the audio streams this PMT adds, indexed
+			// once the whole PMT is read.
+			var newAudio []*mpegts.PMTElementaryStream
 			for _, es := range data.PMT.ElementaryStreams {
+				d.noteConditionalAccess(es.ElementaryPID, es.CA)
 				switch es.StreamType {
 				case streamTypeH264:
 					if d.videoPID == 0 {
 						d.videoPID = es.ElementaryPID
 						d.isHEVC = false
+						changed = true
 						d.log.Info("found video PID", "pid", es.ElementaryPID, "codec", "H.264")
 					}
 				case streamTypeH265:
 					if d.videoPID == 0 {
 						d.videoPID = es.ElementaryPID
 						d.isHEVC = true
+						changed = true
 						d.log.Info("found video PID", "pid", es.ElementaryPID, "codec", "H.265")
 					}
-				case streamTypeAAC:
-					if _, exists := d.audioPIDs[es.ElementaryPID]; !exists {
-						d.audioPIDs[es.ElementaryPID] = audioIdx
-						d.audioTracks = append(d.audioTracks, AudioTrackInfo{
-							PID:        es.ElementaryPID,
-							TrackIndex: audioIdx,
-						})
-						d.log.Info("found audio PID", "pid", es.ElementaryPID, "trackIndex", audioIdx)
-						audioIdx++
+				case streamTypeAAC, streamTypeAC3, streamTypeEAC3:
+					// A PID the PMT lists twice is still one track.
+					pid := es.ElementaryPID
+					_, exists := d.audioPIDs[pid]
+					if !exists && !slices.ContainsFunc(newAudio, func(n *mpegts.PMTElementaryStream) bool {
+						return n.ElementaryPID == pid
+					}) {
+						newAudio = append(newAudio, es)
+					}
+				case streamTypeSCTE35:
+					// SCTE-35 is only read from its well-known PID.
+					if es.ElementaryPID != scte35PIDWellKnown {
+						d.noteUnsupported(es)
 					}
+				default:
+					d.noteUnsupported(es)
+				}
+			}
+			// Audio tracks are indexed in PID order rather than PMT
+			// order, so a source that declares its streams in a varying
+			// order still maps each PID to the same audioN track. An
+			// index, once assigned, never changes.
+			slices.SortFunc(newAudio, func(a, b *mpegts.PMTElementaryStream) int {
+				return cmp.Compare(a.ElementaryPID, b.ElementaryPID)
+			})
+			for _, es := range newAudio {
+				audioIdx := len(d.audioTracks)
+				codec := audioStreamCodec(es.StreamType)
+				d.audioPIDs[es.ElementaryPID] = audioIdx
+				d.audioTracks = append(d.audioTracks, AudioTrackInfo{
+					PID:        es.ElementaryPID,
+					TrackIndex: audioIdx,
+					Codec:      codec,
+				})
+				changed = true
+				d.log.Info("found audio PID", "pid", es.ElementaryPID, "trackIndex", audioIdx, "codec", codec)
+			}
+			d.tracksMu.Unlock()
+			if changed {
+				select {
+				case d.tracksChanged <- struct{}{}:
+				default:
 				}
 			}
 			if !d.pmtDone {
 				d.pmtDone = true
+				if d.stats != nil {
+					d.stats.RecordHasVideo(d.videoPID != 0)
+				}
 				if d.stats != nil && d.videoPID != 0 {
 					if d.isHEVC {
 						d.stats.RecordVideoCodec("H.265")
@@ -253,8 +556,12 @@ func (d *Demuxer) Run(ctx context.Context) error {
 		}
 
 		pid := data.FirstPacket.Header.PID
+		if data.FirstPacket.Header.DiscontinuityIndicator {
+			d.handleSignaledDiscontinuity(pid)
+		}
 
 		if pid == d.videoPID {
+			d.readPrivateTimecode(data.FirstPacket)
 			d.handleVideo(ctx, data.PES)
 		} else if trackIdx, ok := d.audioPIDs[pid]; ok {
 			d.handleAudio(ctx, data.PES, trackIdx)
@@ -262,19 +569,38 @@ func (d *Demuxer) Run(ctx context.Context) error {
 	}
 }
 
+// readPrivateTimecode looks for timecode in the private data of the
+// packet starting a video PES, where TS 101 154 places per-access-unit
+// data, if enabled.
+func (d *Demuxer) readPrivateTimecode(first *mpegts.Packet) {
+	d.privateTimecode = nil
+	if d.privateTimecodeTag == 0 || first == nil {
+		return
+	}
+	if tc, ok := ParsePrivateDataTimecode(first.PrivateData, d.privateTimecodeTag); ok {
+		d.privateTimecode = &tc
+	}
+}
+
 func (d *Demuxer) handleVideo(ctx context.Context, pes *mpegts.PESData) {
 	if len(pes.Data) == 0 {
 		return
 	}
 
+	d.arrivedAt = time.Now()
+
 	var pts, dts int64
+	d.pts90k, d.dts90k, d.has90k = 0, 0, false
 	if pes.Header != nil && pes.Header.OptionalHeader != nil {
 		if pes.Header.OptionalHeader.PTS != nil {
-			pts = pes.Header.OptionalHeader.PTS.Base * 1000000 / 90000
+			d.pts90k, d.has90k = pes.Header.OptionalHeader.PTS.Base, true
+			pts = d.pts90k * 1000000 / 90000
 		}
 		if pes.Header.OptionalHeader.DTS != nil {
-			dts = pes.Header.OptionalHeader.DTS.Base * 1000000 / 90000
+			d.dts90k = pes.Header.OptionalHeader.DTS.Base
+			dts = d.dts90k * 1000000 / 90000
 		} else {
+			d.dts90k = d.pts90k
 			dts = pts
 		}
 	}
@@ -287,29 +613,36 @@ func (d *Demuxer) handleVideo(ctx context.Context, pes *mpegts.PESData) {
 }
 
 func (d *Demuxer) handleVideoH264(ctx context.Context, data []byte, pts, dts int64) {
-	nalus := ParseAnnexB(data)
-	if len(nalus) == 0 {
-		return
-	}
-
 	isKeyframe := false
-	var naluBytes [][]byte
-
-	for _, nalu := range nalus {
+	recoveryPoint := false
+	hasPicture := false
+	reference := false
+	found := false
+	d.au.reset()
+	d.timecode = nil
+
+	ParseAnnexBFunc(data, func(nalu NALUnit) bool {
+		found = true
 		// Skip AUD and filler data NALUs — unnecessary for clients.
 		if nalu.Type == NALTypeAUD || nalu.Type == NALTypeFillerData {
-			continue
+			return true
+		}
+
+		if IsVCL(nalu.Type) && IsReference(nalu.Data) {
+			reference = true
 		}
 
 		switch {
+		case nalu.Type == NALTypeSlice:
+			hasPicture = true
 		case IsSPS(nalu.Type):
 			d.sps = make([]byte, len(nalu.Data))
 			copy(d.sps, nalu.Data)
-			isKeyframe = true
 			if info, err := ParseSPS(nalu.Data); err == nil {
 				d.spsInfo = info
 				if d.stats != nil {
 					d.stats.RecordResolution(info.Width, info.Height)
+					d.stats.RecordColorimetry(info.Colorimetry)
 				}
 			}
 		case IsPPS(nalu.Type):
@@ -317,41 +650,62 @@ func (d *Demuxer) handleVideoH264(ctx context.Context, data []byte, pts, dts int
 			copy(d.pps, nalu.Data)
 		case IsKeyframe(nalu.Type):
 			isKeyframe = true
+			hasPicture = true
 		case nalu.Type == NALTypeSEI:
-			if d.stats != nil && d.spsInfo.PicStructPresent {
+			if HasRecoveryPointSEI(nalu.Data) {
+				recoveryPoint = true
+			}
+			if d.spsInfo.PicStructPresent {
 				if tc, ok := ParsePicTimingSEI(nalu.Data, d.spsInfo); ok {
-					d.stats.RecordTimecode(tc.String())
+					d.recordTimecode(tc)
+				}
+				if ps, ok := ParsePicStruct(nalu.Data, d.spsInfo); ok && d.stats != nil {
+					d.stats.RecordPicStruct(ps)
 				}
 			}
 
-			d.handleCaptionSEI(ctx, nalu.Data, pts)
+			d.recordActiveFormat(nalu.Data, 1)
+			d.handleCaptionSEI(ctx, nalu.Data, 1, pts)
 		}
 
-		annexB := make([]byte, 4+len(nalu.Data))
-		annexB[0] = 0
-		annexB[1] = 0
-		annexB[2] = 0
-		annexB[3] = 1
-		copy(annexB[4:], nalu.Data)
-		naluBytes = append(naluBytes, annexB)
+		d.addNAL(nalu)
+		return true
+	})
+	// An access unit with no picture, such as parameter sets some
+	// encoders send just ahead of the IDR, only updates state: the sets
+	// are kept for the next keyframe, which starts the group.
+	if !found || !hasPicture {
+		return
 	}
 
-	d.buildAndEmitFrame(ctx, isKeyframe, naluBytes, "h264", pts, dts)
+	// A recovery point SEI on a non-IDR picture marks an open-GOP random
+	// access point. Start a new group there so viewers can join, but only
+	// once parameter sets are known or the client could not decode it.
+	if recoveryPoint && d.sps != nil && d.pps != nil {
+		isKeyframe = true
+	}
+
+	d.buildAndEmitFrame(ctx, isKeyframe, !reference, d.au.nalus(), "h264", pts, dts)
 }
 
 func (d *Demuxer) handleVideoHEVC(ctx context.Context, data []byte, pts, dts int64) {
-	nalus := ParseAnnexBHEVC(data)
-	if len(nalus) == 0 {
-		return
-	}
-
 	isKeyframe := false
-	var naluBytes [][]byte
-
-	for _, nalu := range nalus {
+	hasPicture := false
+	reference := false
+	found := false
+	d.au.reset()
+	d.timecode = nil
+
+	ParseAnnexBHEVCFunc(data, func(nalu NALUnit) bool {
+		found = true
 		// Skip AUD and filler data NALUs — unnecessary for clients.
 		if nalu.Type == HEVCNALAUD || nalu.Type == HEVCNALFillerData {
-			continue
+			return true
+		}
+
+		if IsHEVCVCL(nalu.Type) {
+			hasPicture = true
+			reference = reference || !d.hevcUnreferenced(nalu)
 		}
 
 		switch {
@@ -363,8 +717,10 @@ func (d *Demuxer) handleVideoHEVC(ctx context.Context, data []byte, pts, dts int
 			copy(d.sps, nalu.Data)
 			if info, err := ParseHEVCSPS(nalu.Data); err == nil {
 				d.hevcSPSInfo = info
+				d.hevcSPSSet = true
 				if d.stats != nil {
 					d.stats.RecordResolution(info.Width, info.Height)
+					d.stats.RecordColorimetry(info.Colorimetry)
 				}
 			}
 		case IsHEVCPPS(nalu.Type):
@@ -373,27 +729,224 @@ func (d *Demuxer) handleVideoHEVC(ctx context.Context, data []byte, pts, dts int
 		case IsHEVCKeyframe(nalu.Type):
 			isKeyframe = true
 		case nalu.Type == HEVCNALSEIPrefix:
+			if tc, ok := ParseHEVCTimeCodeSEI(nalu.Data); ok {
+				d.recordTimecode(tc)
+			}
 			if len(nalu.Data) > 2 {
-				d.handleCaptionSEI(ctx, nalu.Data, pts)
+				d.recordActiveFormat(nalu.Data, 2)
+				d.handleCaptionSEI(ctx, nalu.Data, 2, pts)
 			}
 		}
 
-		annexB := make([]byte, 4+len(nalu.Data))
-		annexB[0] = 0
-		annexB[1] = 0
-		annexB[2] = 0
-		annexB[3] = 1
-		copy(annexB[4:], nalu.Data)
-		naluBytes = append(naluBytes, annexB)
+		d.addNAL(nalu)
+		return true
+	})
+	// As for H.264, an access unit without a picture only updates the
+	// parameter sets, rather than emitting an empty frame.
+	if !found || !hasPicture {
+		return
+	}
+
+	d.buildAndEmitFrame(ctx, isKeyframe, !reference, d.au.nalus(), "h265", pts, dts)
+}
+
+// hevcUnreferenced reports whether an HEVC slice belongs to a picture no
+// other picture references: a sub-layer non-reference picture in the
+// highest temporal sub-layer of the current SPS. Until an SPS has been
+// parsed the highest sub-layer is unknown, so every picture is treated as
+// referenced.
+func (d *Demuxer) hevcUnreferenced(nalu NALUnit) bool {
+	return d.hevcSPSSet && IsHEVCSubLayerNonReference(nalu.Type) &&
+		HEVCTemporalID(nalu.Data) == d.hevcSPSInfo.MaxSubLayersMinus1
+}
+
+// addNAL adds nalu to the access unit being built, repairing its
+// emulation prevention first if SetEmulationPreventionRepair enabled it.
+func (d *Demuxer) addNAL(nalu NALUnit) {
+	data := nalu.Data
+	if d.repairEPB && !ValidEmulationPrevention(data) {
+		data = RepairEmulationPrevention(data)
+		if ok, suppressed := d.epbLog.Sample(); ok {
+			d.log.Debug("repaired NAL unit emulation prevention",
+				"nalType", nalu.Type, "suppressed", suppressed)
+		}
 	}
+	d.au.add(data)
+}
 
-	d.buildAndEmitFrame(ctx, isKeyframe, naluBytes, "h265", pts, dts)
+// auBuilder re-frames the NAL units of one access unit with 4-byte start
+// codes. They are accumulated in a scratch buffer reused across frames;
+// since emitted frames outlive the call (the relay caches GOPs), nalus
+// copies the result into one exact-size allocation per access unit
+// instead of one per NAL unit.
+type auBuilder struct {
+	buf  []byte
+	ends []int
 }
 
-func (d *Demuxer) buildAndEmitFrame(ctx context.Context, isKeyframe bool, naluBytes [][]byte, codec string, pts, dts int64) {
+func (b *auBuilder) reset() {
+	b.buf = b.buf[:0]
+	b.ends = b.ends[:0]
+}
+
+func (b *auBuilder) add(nal []byte) {
+	b.buf = append(b.buf, 0, 0, 0, 1)
+	b.buf = append(b.buf, nal...)
+	b.ends = append(b.ends, len(b.buf))
+}
+
+// nalus returns the accumulated NAL units, each with its start code, or
+// nil if none were added.
+func (b *auBuilder) nalus() [][]byte {
+	if len(b.ends) == 0 {
+		return nil
+	}
+	out := make([]byte, len(b.buf))
+	copy(out, b.buf)
+	nalus := make([][]byte, len(b.ends))
+	start := 0
+	for i, end := range b.ends {
+		nalus[i] = out[start:end:end]
+		start = end
+	}
+	return nalus
+}
+
+// recordTimecode attaches tc to the access unit being handled and reports
+// it as the stream's current timecode.
+func (d *Demuxer) recordTimecode(tc Timecode) {
+	d.timecode = &tc
+	if d.stats != nil {
+		d.stats.RecordTimecode(tc.String())
+	}
+}
+
+// recordActiveFormat reports the AFD and bar data carried by an SEI NAL
+// unit whose header is hdrLen bytes.
+func (d *Demuxer) recordActiveFormat(seiNALU []byte, hdrLen int) {
+	if d.stats == nil {
+		return
+	}
+	if afd, ok := ParseAFDSEI(seiNALU, hdrLen); ok {
+		d.stats.RecordAFD(afd)
+	}
+	if bars, ok := ParseBarDataSEI(seiNALU, hdrLen); ok {
+		d.stats.RecordBarData(bars)
+	}
+}
+
+// recordCorruptPacket counts and reports a packet the TS parser rejected
+// and logs it if the sampler allows, with the number skipped since the
+// last log line.
+func (d *Demuxer) recordCorruptPacket(err error) {
+	d.corruptPackets++
+	if d.stats != nil {
+		d.stats.RecordCorruptPacket()
+	}
+	d.emitEvent(EventCorruptPacket, 0, err.Error())
+	if ok, suppressed := d.corruptLog.Sample(); ok {
+		d.log.Debug("skipping corrupt packet",
+			"error", err,
+			"suppressed", suppressed,
+			"total", d.corruptPackets)
+	}
+}
+
+// recordPacketSize reports the packet size detected at the start of the
+// stream.
+func (d *Demuxer) recordPacketSize(size int) {
+	if d.stats != nil {
+		d.stats.RecordPacketSize(size)
+	}
+	if size != mpegts.PacketSizeTS {
+		d.log.Info("reading non-standard TS packets", "packetSize", size)
+	}
+}
+
+// recordReorderedPacket counts a TS packet the reorder window put back
+// in order.
+func (d *Demuxer) recordReorderedPacket() {
+	if d.stats != nil {
+		d.stats.RecordReorderedPacket()
+	}
+}
+
+// checkDiscontinuity records a backward video PTS jump beyond the
+// configured threshold, such as a splice resetting the source's clock, and
+// reports whether video is waiting for the keyframe that follows it.
+func (d *Demuxer) checkDiscontinuity(pts int64) bool {
+	last := d.lastVideoPTS
+	d.lastVideoPTS = pts
+	if d.discontinuityThreshold <= 0 || last <= 0 || pts <= 0 {
+		return d.discontinuity
+	}
+	if back := last - pts; back > d.discontinuityThreshold.Microseconds() && back < ptsWrapUS/2 {
+		d.discontinuity = true
+		if d.stats != nil {
+			d.stats.RecordDiscontinuity()
+		}
+		d.log.Info("video discontinuity",
+			"previousPTS", last,
+			"pts", pts)
+		d.emitEvent(EventDiscontinuity, d.videoPID,
+			fmt.Sprintf("video PTS jumped back from %d to %d", last, pts))
+	}
+	return d.discontinuity
+}
+
+// handleSignaledDiscontinuity resets PTS continuity for an elementary
+// stream whose packet set the adaptation field discontinuity_indicator, as
+// at a splice or PCR reset, so the timestamp jump that follows is not
+// counted as a PTS error or wrap. On video the access unit it starts is
+// marked as the discontinuity if it is a keyframe.
+func (d *Demuxer) handleSignaledDiscontinuity(pid uint16) {
+	switch trackIdx, audio := d.audioPIDs[pid]; {
+	case pid == d.videoPID:
+		d.lastVideoPTS = 0
+		d.signaledDiscontinuity = true
+		if d.stats != nil {
+			d.stats.RecordDiscontinuity()
+			d.stats.RecordVideoPTSReset()
+		}
+	case audio:
+		if d.stats != nil {
+			d.stats.RecordAudioPTSReset(trackIdx)
+		}
+	default:
+		return
+	}
+	d.log.Info("signaled discontinuity", "pid", pid)
+	d.emitEvent(EventDiscontinuity, pid, "discontinuity_indicator set")
+}
+
+// buildAndEmitFrame wraps an access unit in a VideoFrame. isKeyframe marks
+// any random access point (IDR, or a recovery-point picture in open-GOP
+// H.264) and starts a new MoQ group. nonReference marks an access unit
+// none of whose slices is a reference, which is flagged Disposable unless
+// it is a keyframe.
+//
+// After a discontinuity, delta frames are dropped until the next keyframe,
+// since they predict from pictures on the far side of the splice. That
+// keyframe is flagged as the discontinuity, starting a fresh group that
+// carries the decoder configuration. A keyframe whose PES signaled a
+// discontinuity is flagged the same way.
+func (d *Demuxer) buildAndEmitFrame(ctx context.Context, isKeyframe, nonReference bool, naluBytes [][]byte, codec string, pts, dts int64) {
+	discontinuity := d.checkDiscontinuity(pts)
+	if discontinuity && !isKeyframe {
+		return
+	}
+	d.discontinuity = false
+	if d.signaledDiscontinuity {
+		discontinuity = discontinuity || isKeyframe
+		d.signaledDiscontinuity = false
+	}
+
 	if isKeyframe {
 		d.groupID++
 	}
+	if d.timecode == nil && d.privateTimecode != nil {
+		d.recordTimecode(*d.privateTimecode)
+	}
 
 	frame := &media.VideoFrame{
 		PTS:        pts,
@@ -402,26 +955,46 @@ func (d *Demuxer) buildAndEmitFrame(ctx context.Context, isKeyframe bool, naluBy
 		NALUs:      naluBytes,
 		Codec:      codec,
 		GroupID:    d.groupID,
-	}
+		ArrivedAt:  d.arrivedAt,
 
-	if d.sps != nil {
-		frame.SPS = make([]byte, len(d.sps))
-		copy(frame.SPS, d.sps)
-	}
-	if d.pps != nil {
-		frame.PPS = make([]byte, len(d.pps))
-		copy(frame.PPS, d.pps)
-	}
-	if d.vps != nil {
-		frame.VPS = make([]byte, len(d.vps))
-		copy(frame.VPS, d.vps)
+		Timecode:      d.timecode,
+		Discontinuity: discontinuity,
+		Disposable:    nonReference && !isKeyframe,
+
+		PTS90k: d.pts90k,
+		DTS90k: d.dts90k,
+		Has90k: d.has90k,
 	}
 
+	// Parameter sets are shared rather than copied per frame: a new set
+	// replaces d.sps, d.pps or d.vps with a fresh copy and never writes
+	// into the old one, so frames already emitted keep theirs intact.
+	frame.SPS = d.sps
+	frame.PPS = d.pps
+	frame.VPS = d.vps
+
 	d.emitVideoFrame(ctx, frame, naluBytes, pts)
 }
 
-func (d *Demuxer) handleCaptionSEI(ctx context.Context, seiData []byte, pts int64) {
-	cd := ccx.ExtractCaptions(seiData)
+// handleCaptionSEI decodes the captions carried by an SEI NAL unit whose
+// header is hdrLen bytes. Each caption message is extracted on its own, so
+// captions sharing the NAL unit with pic_timing or other SEI messages are
+// not missed.
+func (d *Demuxer) handleCaptionSEI(ctx context.Context, seiData []byte, hdrLen int, pts int64) {
+	for _, msg := range splitCaptionSEI(seiData, hdrLen) {
+		d.extractCaptions(ctx, msg, hdrLen, pts)
+	}
+}
+
+// extractCaptions decodes the captions in one SEI NAL unit whose header is
+// hdrLen bytes: 1 for H.264, 2 for H.265.
+func (d *Demuxer) extractCaptions(ctx context.Context, seiData []byte, hdrLen int, pts int64) {
+	var cd *ccx.CaptionData
+	if hdrLen == 2 {
+		cd = ccx.ExtractCaptionsHEVC(seiData)
+	} else {
+		cd = ccx.ExtractCaptions(seiData)
+	}
 	if cd == nil {
 		return
 	}
@@ -451,7 +1024,7 @@ func (d *Demuxer) handleCaptionSEI(ctx context.Context, seiData []byte, pts int6
 		}
 		text := dec.Decode(cc1, cc2)
 		if text != "" {
-			frame := &ccx.CaptionFrame{PTS: pts, Text: text, Channel: pair.Channel}
+			frame := &media.CaptionFrame{PTS: pts, Text: text, Channel: pair.Channel}
 			frame.Regions = dec.StyledRegions()
 			if d.stats != nil {
 				d.stats.RecordCaption(pair.Channel)
@@ -483,6 +1056,9 @@ func (d *Demuxer) emitVideoFrame(ctx context.Context, frame *media.VideoFrame, n
 		}
 		d.stats.RecordVideoFrame(totalBytes, frame.IsKeyframe, pts)
 	}
+	if d.hasher != nil {
+		d.hasher.addVideo(frame)
+	}
 
 	select {
 	case d.videoCh <- frame:
@@ -508,11 +1084,15 @@ func (d *Demuxer) drainDTVCC(ctx context.Context, pts int64) {
 		if svc.ProcessBlock(block.Data) {
 			text := svc.DisplayText()
 			if text != "" {
-				channel := block.ServiceNum + 6
-				frame := &ccx.CaptionFrame{PTS: pts, Text: text, Channel: channel}
+				ch := d.captionChan(block.ServiceNum)
+				frame := &media.CaptionFrame{
+					PTS: pts, Text: text, Channel: ch.Channel,
+					Service: block.ServiceNum, Label: ch.Label,
+				}
 				frame.Regions = svc.StyledRegions()
 				if d.stats != nil {
-					d.stats.RecordCaption(channel)
+					d.stats.RecordCaption(ch.Channel)
+					d.stats.RecordCaptionService(block.ServiceNum, ch)
 				}
 				select {
 				case d.captionCh <- frame:
@@ -525,19 +1105,56 @@ func (d *Demuxer) drainDTVCC(ctx context.Context, pts int64) {
 	d.dtvccBuf = d.dtvccBuf[packetSize:]
 }
 
+// noteUnsupported records the stream type of an elementary stream the
+// demuxer ignores, logging each type once. The caller holds tracksMu.
+func (d *Demuxer) noteUnsupported(es *mpegts.PMTElementaryStream) {
+	if slices.Contains(d.unsupportedTypes, es.StreamType) {
+		return
+	}
+	d.unsupportedTypes = append(d.unsupportedTypes, es.StreamType)
+	d.log.Warn("ignoring unsupported stream type",
+		"pid", es.ElementaryPID, "stream_type", fmt.Sprintf("0x%02X", es.StreamType))
+	if d.stats != nil {
+		d.stats.RecordUnsupportedStreamType(es.StreamType)
+	}
+	d.emitEvent(EventUnsupportedStream, es.ElementaryPID, fmt.Sprintf("stream type 0x%02X", es.StreamType))
+}
+
+// noteConditionalAccess records the CA systems of the descriptors cas
+// found for pid, or for the whole program if pid is 0, warning of each
+// system once. The caller holds tracksMu.
+func (d *Demuxer) noteConditionalAccess(pid uint16, cas []mpegts.CADescriptor) {
+	for _, ca := range cas {
+		if slices.Contains(d.caSystems, ca.SystemID) {
+			continue
+		}
+		d.caSystems = append(d.caSystems, ca.SystemID)
+		system := fmt.Sprintf("0x%04X", ca.SystemID)
+		d.log.Warn("stream is DRM protected: the PMT declares conditional access, so its scrambled streams cannot be played",
+			"ca_system_id", system, "pid", pid)
+		if d.stats != nil {
+			d.stats.RecordConditionalAccess(ca.SystemID)
+		}
+		d.emitEvent(EventConditionalAccess, pid, "CA system "+system)
+	}
+}
+
 func (d *Demuxer) handleSCTE35(section []byte) {
-	if d.stats == nil || len(section) == 0 {
+	if len(section) == 0 {
 		return
 	}
 
 	sis, err := scte35.DecodeBytes(section)
 	if err != nil {
 		d.log.Warn("failed to parse SCTE-35", "error", err)
+		d.emitEvent(EventParseError, scte35PIDWellKnown, "SCTE-35: "+err.Error())
 		return
 	}
 
+	now := time.Now()
 	event := SCTE35Event{
-		ReceivedAt: time.Now().UnixMilli(),
+		ReceivedAt: now.UnixMilli(),
+		Section:    append([]byte(nil), section...),
 	}
 
 	if sis.SpliceCommand == nil {
@@ -549,21 +1166,29 @@ func (d *Demuxer) handleSCTE35(section []byte) {
 		event.CommandType = "splice_insert"
 		event.CommandTypeID = scte35.SpliceInsertType
 		event.EventID = cmd.SpliceEventID
+		event.Cancel = cmd.SpliceEventCancelIndicator
 		event.OutOfNetwork = cmd.OutOfNetworkIndicator
 		event.Immediate = cmd.SpliceImmediateFlag
+		if !cmd.SpliceImmediateFlag && cmd.SpliceTime.PTSTime != nil {
+			event.PTS = d.spliceTimeUS(*cmd.SpliceTime.PTSTime, sis.PTSAdjustment)
+		}
 		if cmd.BreakDuration != nil {
 			event.Duration = float64(cmd.BreakDuration.Duration) / 90000.0
+			event.AutoReturn = cmd.BreakDuration.AutoReturn
 		}
-		if event.OutOfNetwork {
+		switch {
+		case event.Cancel:
+			event.Description = "Splice Cancel"
+		case event.OutOfNetwork:
 			event.Description = "Splice Out (Ad Insertion)"
-		} else {
+		default:
 			event.Description = "Splice In (Return to Program)"
 		}
 	case *scte35.TimeSignal:
 		event.CommandType = "time_signal"
 		event.CommandTypeID = scte35.TimeSignalType
 		if cmd.SpliceTime.PTSTime != nil {
-			event.PTS = int64(*cmd.SpliceTime.PTSTime)
+			event.PTS = d.spliceTimeUS(*cmd.SpliceTime.PTSTime, sis.PTSAdjustment)
 		}
 		event.Description = "Time Signal"
 	case *scte35.SpliceNull:
@@ -584,12 +1209,84 @@ func (d *Demuxer) handleSCTE35(section []byte) {
 				event.Duration = float64(*sd.SegmentationDuration) / 90000.0
 			}
 			event.Description = sd.Name()
+			if sd.SegmentationEventCancelIndicator {
+				event.Cancel = true
+				event.Description = "Segmentation Cancel"
+			}
 			break
 		}
 	}
 
-	d.log.Debug("SCTE-35", "command", event.CommandType, "desc", event.Description, "eventID", event.EventID)
-	d.stats.RecordSCTE35(event)
+	if d.duplicateSCTE35(&event, now) {
+		d.log.Debug("duplicate SCTE-35 dropped", "command", event.CommandType, "eventID", event.EventID)
+		if d.stats != nil {
+			d.stats.RecordDuplicateSCTE35()
+		}
+		return
+	}
+
+	d.log.Debug("SCTE-35", "command", event.CommandType, "desc", event.Description, "eventID", event.EventID, "cancel", event.Cancel)
+	if d.stats != nil {
+		d.stats.RecordSCTE35(event)
+	}
+
+	select {
+	case d.scte35Ch <- &event:
+	default:
+		d.log.Debug("SCTE-35 channel full, dropping event", "eventID", event.EventID)
+	}
+}
+
+// spliceTimeUS converts a splice pts_time to the microsecond PTS domain of
+// video and audio frames. The section's pts_adjustment is added modulo
+// 2^33, as the splicer does, and then the configured offset.
+func (d *Demuxer) spliceTimeUS(ptsTime, ptsAdjustment uint64) int64 {
+	pts := (ptsTime + ptsAdjustment) & (1<<33 - 1)
+	us := int64(pts)*1_000_000/90_000 + d.scte35Offset.Microseconds()
+	if us < 0 {
+		us += ptsWrapUS
+	}
+	return us
+}
+
+// scte35Key identifies a SCTE-35 cue for duplicate detection: two cues
+// with the same key announce the same splice.
+type scte35Key struct {
+	commandType      uint32
+	eventID          uint32
+	segmentationType uint32
+	outOfNetwork     bool
+	cancel           bool
+	pts              int64
+}
+
+// duplicateSCTE35 reports whether event repeats a cue received within
+// scte35DedupWindow, recording it as seen at now either way. Heartbeat
+// splice_null commands are never duplicates. A cancel differs from the
+// cue it cancels, so it always passes.
+func (d *Demuxer) duplicateSCTE35(event *SCTE35Event, now time.Time) bool {
+	if event.CommandTypeID == scte35.SpliceNullType {
+		return false
+	}
+	if d.scte35Seen == nil {
+		d.scte35Seen = make(map[scte35Key]time.Time)
+	}
+	for k, seen := range d.scte35Seen {
+		if now.Sub(seen) > scte35DedupWindow {
+			delete(d.scte35Seen, k)
+		}
+	}
+	key := scte35Key{
+		commandType:      event.CommandTypeID,
+		eventID:          event.EventID,
+		segmentationType: event.SegmentationTypeID,
+		outOfNetwork:     event.OutOfNetwork,
+		cancel:           event.Cancel,
+		pts:              event.PTS,
+	}
+	_, dup := d.scte35Seen[key]
+	d.scte35Seen[key] = now
+	return dup
 }
 
 func (d *Demuxer) handleAudio(ctx context.Context, pes *mpegts.PESData, trackIndex int) {
@@ -597,41 +1294,150 @@ func (d *Demuxer) handleAudio(ctx context.Context, pes *mpegts.PESData, trackInd
 		return
 	}
 
-	var pts int64
+	var pts, pts90k int64
+	has90k := false
 	if pes.Header != nil && pes.Header.OptionalHeader != nil {
 		if pes.Header.OptionalHeader.PTS != nil {
-			pts = pes.Header.OptionalHeader.PTS.Base * 1000000 / 90000
+			pts90k, has90k = pes.Header.OptionalHeader.PTS.Base, true
+			pts = pts90k * 1000000 / 90000
 		}
 	}
 
+	if d.audioTrackCodec(trackIndex) != media.AudioCodecAAC {
+		d.handleAC3(ctx, pes.Data, pts, pts90k, has90k, trackIndex)
+		return
+	}
+
 	aacFrames, err := ParseADTS(pes.Data)
 	if err != nil {
 		d.log.Warn("failed to parse ADTS", "error", err)
+		d.emitEvent(EventParseError, d.audioTrackPID(trackIndex), "ADTS: "+err.Error())
 		return
 	}
 
-	for i, aac := range aacFrames {
-		framePTS := pts
-		if aac.SampleRate > 0 {
-			framePTS += int64(i) * 1024 * 1_000_000 / int64(aac.SampleRate)
-		}
-
+	// Frames after the first in a PES carry no PTS of their own; offset
+	// each by the samples preceding it. Each frame's own sample count and
+	// rate keep this right for HE-AAC as well as AAC-LC, and summing
+	// samples rather than rounded durations avoids drift at rates such as
+	// 44.1kHz.
+	samples := 0
+	for _, aac := range aacFrames {
+		framePTS := pts + frameDurationUS(samples, aac.SampleRate)
+		framePTS90k := (pts90k + frameDuration90k(samples, aac.SampleRate)) & pts90kMask
+		samples += aac.SamplesPerFrame
+
+		channels := d.audioChannels(trackIndex, aac)
 		frame := &media.AudioFrame{
 			PTS:        framePTS,
 			Data:       aac.Data,
 			SampleRate: aac.SampleRate,
-			Channels:   aac.Channels,
+			Channels:   channels,
 			TrackIndex: trackIndex,
+			Codec:      media.AudioCodecAAC,
+			PTS90k:     framePTS90k,
+			Has90k:     has90k,
 		}
-
-		if d.stats != nil {
-			d.stats.RecordAudioFrame(trackIndex, int64(len(aac.Data)), framePTS, aac.SampleRate, aac.Channels)
+		if !d.emitAudio(ctx, frame) {
+			return
 		}
+	}
+}
+
+// handleAC3 emits the AC-3 or E-AC-3 sync frames of an audio PES. As with
+// AAC, frames after the first are offset from the PES PTS by the samples
+// before them.
+func (d *Demuxer) handleAC3(ctx context.Context, data []byte, pts, pts90k int64, has90k bool, trackIndex int) {
+	ac3Frames, err := ParseAC3(data)
+	if err != nil {
+		d.log.Warn("failed to parse AC-3", "error", err)
+		d.emitEvent(EventParseError, d.audioTrackPID(trackIndex), "AC-3: "+err.Error())
+		return
+	}
 
-		select {
-		case d.audioCh <- frame:
-		case <-ctx.Done():
+	samples := 0
+	for _, f := range ac3Frames {
+		framePTS := pts + frameDurationUS(samples, f.SampleRate)
+		framePTS90k := (pts90k + frameDuration90k(samples, f.SampleRate)) & pts90kMask
+		samples += f.SamplesPerFrame
+
+		codec := media.AudioCodecAC3
+		if f.Enhanced {
+			codec = media.AudioCodecEAC3
+		}
+		frame := &media.AudioFrame{
+			PTS:        framePTS,
+			Data:       f.Data,
+			SampleRate: f.SampleRate,
+			Channels:   f.Channels,
+			TrackIndex: trackIndex,
+			Codec:      codec,
+			PTS90k:     framePTS90k,
+			Has90k:     has90k,
+		}
+		if !d.emitAudio(ctx, frame) {
 			return
 		}
 	}
 }
+
+// emitAudio records an audio frame's stats and delivers it, reporting
+// false if ctx ended first.
+func (d *Demuxer) emitAudio(ctx context.Context, frame *media.AudioFrame) bool {
+	if d.stats != nil {
+		d.stats.RecordAudioFrame(frame.TrackIndex, int64(len(frame.Data)), frame.PTS, frame.SampleRate, frame.Channels)
+	}
+	if d.hasher != nil {
+		d.hasher.addAudio(frame)
+	}
+	select {
+	case d.audioCh <- frame:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// audioTrackCodec returns the codec of audio track trackIndex, AAC if the
+// PMT has not declared it.
+func (d *Demuxer) audioTrackCodec(trackIndex int) string {
+	if trackIndex < len(d.audioTracks) {
+		return d.audioTracks[trackIndex].Codec
+	}
+	return media.AudioCodecAAC
+}
+
+// audioTrackPID returns the PID of an audio track, or 0 if it is unknown.
+func (d *Demuxer) audioTrackPID(trackIndex int) uint16 {
+	if trackIndex < len(d.audioTracks) {
+		return d.audioTracks[trackIndex].PID
+	}
+	return 0
+}
+
+// audioStreamCodec returns the codec of a supported audio stream type.
+func audioStreamCodec(streamType uint8) string {
+	switch streamType {
+	case streamTypeAC3:
+		return media.AudioCodecAC3
+	case streamTypeEAC3:
+		return media.AudioCodecEAC3
+	}
+	return media.AudioCodecAAC
+}
+
+// audioChannels returns the channel count to report for an AAC frame on
+// trackIndex. With correction on, a channel configuration 0 frame without
+// a program config element takes the count from the track's last one,
+// since encoders need not repeat it in every frame.
+func (d *Demuxer) audioChannels(trackIndex int, aac AACFrame) int {
+	switch {
+	case !d.aacChannelFix:
+		return aac.ChannelConfig
+	case aac.ChannelConfig != 0:
+		return aac.Channels
+	case aac.Channels > 0:
+		d.aacChannels[trackIndex] = aac.Channels
+		return aac.Channels
+	}
+	return d.aacChannels[trackIndex]
+}
@@ -0,0 +1,1385 @@
+package demux
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/zsiec/prism/media"
+	"github.com/zsiec/prism/mpegts"
+	"github.com/zsiec/prism/scte35"
+)
+
+func TestHandleSCTE35EmitsEvent(t *testing.T) {
+	t.Parallel()
+
+	pts := uint64(900000)
+	sis := scte35.SpliceInfoSection{
+		SAPType:       3,
+		Tier:          0xFFF,
+		SpliceCommand: &scte35.TimeSignal{SpliceTime: scte35.SpliceTime{PTSTime: &pts}},
+	}
+	section, err := sis.Encode()
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+
+	// No stats recorder attached: events must still be delivered.
+	d := NewDemuxer(bytes.NewReader(nil), nil)
+	d.handleSCTE35(section)
+
+	select {
+	case ev := <-d.SCTE35():
+		if ev.CommandType != "time_signal" {
+			t.Errorf("CommandType = %q, want time_signal", ev.CommandType)
+		}
+		if ev.PTS != 10_000_000 {
+			t.Errorf("PTS = %d, want 10s in microseconds", ev.PTS)
+		}
+		if !bytes.Equal(ev.Section, section) {
+			t.Error("Section does not match the input splice_info_section")
+		}
+	default:
+		t.Fatal("expected an event on the SCTE35 channel")
+	}
+}
+
+func TestHandleSCTE35AppliesPTSAdjustment(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		ptsTime    uint64
+		adjustment uint64
+		offset     time.Duration
+		want       int64 // microseconds
+	}{
+		{"adjusted", 900_000, 2_700_000, 0, 40_000_000},
+		{"wraps", 1<<33 - 90_000, 180_000, 0, 1_000_000},
+		{"offset", 900_000, 90_000, -200 * time.Millisecond, 10_800_000},
+		{"offset before zero", 0, 9_000, -200 * time.Millisecond, ptsWrapUS - 100_000},
+	}
+	for _, tt := range tests {
+		commands := []scte35.SpliceCommand{
+			&scte35.TimeSignal{SpliceTime: scte35.SpliceTime{PTSTime: &tt.ptsTime}},
+			&scte35.SpliceInsert{SpliceEventID: 1, OutOfNetworkIndicator: true, SpliceTime: scte35.SpliceTime{PTSTime: &tt.ptsTime}},
+		}
+		for _, cmd := range commands {
+			t.Run(fmt.Sprintf("%s/%T", tt.name, cmd), func(t *testing.T) {
+				t.Parallel()
+				section, err := (&scte35.SpliceInfoSection{
+					SAPType:       3,
+					PTSAdjustment: tt.adjustment,
+					Tier:          0xFFF,
+					SpliceCommand: cmd,
+				}).Encode()
+				if err != nil {
+					t.Fatalf("Encode: %v", err)
+				}
+
+				d := NewDemuxer(bytes.NewReader(nil), nil)
+				d.SetSCTE35PTSOffset(tt.offset)
+				d.handleSCTE35(section)
+				if ev := <-d.SCTE35(); ev.PTS != tt.want {
+					t.Errorf("PTS = %d, want %d", ev.PTS, tt.want)
+				}
+			})
+		}
+	}
+}
+
+func TestHandleSCTE35DropsWhenFull(t *testing.T) {
+	t.Parallel()
+
+	section, err := (&scte35.SpliceInfoSection{SpliceCommand: &scte35.SpliceNull{}}).Encode()
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+
+	d := NewDemuxer(bytes.NewReader(nil), nil)
+	for i := 0; i < scte35BufferSize+3; i++ {
+		d.handleSCTE35(section) // must not block once the channel is full
+	}
+	if got := len(d.SCTE35()); got != scte35BufferSize {
+		t.Errorf("channel depth = %d, want %d", got, scte35BufferSize)
+	}
+}
+
+// annexB joins NAL units with 4-byte start codes.
+func annexB(nalus ...[]byte) []byte {
+	var out []byte
+	for _, n := range nalus {
+		out = append(out, 0, 0, 0, 1)
+		out = append(out, n...)
+	}
+	return out
+}
+
+// scte35Recorder counts the SCTE-35 events and duplicates recorded by the
+// demuxer; its other methods are never called.
+type scte35Recorder struct {
+	StatsRecorder
+	events, dups int
+}
+
+func (r *scte35Recorder) RecordSCTE35(SCTE35Event) { r.events++ }
+func (r *scte35Recorder) RecordDuplicateSCTE35()   { r.dups++ }
+
+func TestHandleSCTE35DropsDuplicates(t *testing.T) {
+	t.Parallel()
+
+	encode := func(cmd scte35.SpliceCommand, descs ...scte35.SpliceDescriptor) []byte {
+		t.Helper()
+		section, err := (&scte35.SpliceInfoSection{
+			SAPType:           3,
+			Tier:              0xFFF,
+			SpliceCommand:     cmd,
+			SpliceDescriptors: descs,
+		}).Encode()
+		if err != nil {
+			t.Fatalf("Encode: %v", err)
+		}
+		return section
+	}
+	pts := uint64(900000)
+	out := encode(&scte35.SpliceInsert{SpliceEventID: 7, OutOfNetworkIndicator: true, SpliceImmediateFlag: true})
+	cancel := encode(&scte35.SpliceInsert{SpliceEventID: 7, SpliceEventCancelIndicator: true})
+	segStart := encode(&scte35.TimeSignal{SpliceTime: scte35.SpliceTime{PTSTime: &pts}},
+		&scte35.SegmentationDescriptor{SegmentationEventID: 9, SegmentationTypeID: scte35.SegmentationTypeProviderAdStart})
+	segCancel := encode(&scte35.TimeSignal{SpliceTime: scte35.SpliceTime{PTSTime: &pts}},
+		&scte35.SegmentationDescriptor{SegmentationEventID: 9, SegmentationEventCancelIndicator: true})
+	heartbeat := encode(&scte35.SpliceNull{})
+
+	rec := &scte35Recorder{}
+	d := NewDemuxer(bytes.NewReader(nil), nil)
+	d.SetStats(rec)
+
+	var events []*SCTE35Event
+	handle := func(section []byte) {
+		d.handleSCTE35(section)
+		for len(d.SCTE35()) > 0 {
+			events = append(events, <-d.SCTE35())
+		}
+	}
+	for _, section := range [][]byte{out, out, out, cancel, cancel, segStart, segStart, segCancel, heartbeat, heartbeat} {
+		handle(section)
+	}
+
+	var got []string
+	for _, ev := range events {
+		got = append(got, fmt.Sprintf("%s/%d/cancel=%v", ev.CommandType, ev.EventID, ev.Cancel))
+	}
+	want := []string{
+		"splice_insert/7/cancel=false",
+		"splice_insert/7/cancel=true",
+		"time_signal/9/cancel=false",
+		"time_signal/9/cancel=true",
+		"splice_null/0/cancel=false",
+		"splice_null/0/cancel=false",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("events = %v, want %v", got, want)
+	}
+	if rec.events != len(want) || rec.dups != 4 {
+		t.Errorf("recorded %d events and %d duplicates, want %d and 4", rec.events, rec.dups, len(want))
+	}
+
+	// Once the window has passed, the same cue is a new event.
+	for k, seen := range d.scte35Seen {
+		d.scte35Seen[k] = seen.Add(-scte35DedupWindow - time.Second)
+	}
+	events = nil
+	handle(out)
+	if len(events) != 1 {
+		t.Errorf("cue after the dedup window: %d events, want 1", len(events))
+	}
+}
+
+func TestHandleVideoH264ReframesNALUs(t *testing.T) {
+	t.Parallel()
+
+	aud := []byte{0x09, 0xF0}
+	idr := []byte{0x65, 0x88, 0x84}
+	slice := []byte{0x41, 0x9A, 0x02}
+
+	d := NewDemuxer(bytes.NewReader(nil), nil)
+	ctx := context.Background()
+	// Mixed 3- and 4-byte start codes; the AUD is dropped.
+	first := append(annexB(aud, idr), 0x00, 0x00, 0x01)
+	first = append(first, slice...)
+	d.handleVideoH264(ctx, first, 0, 0)
+	d.handleVideoH264(ctx, annexB(slice), 33_000, 33_000)
+
+	f1 := <-d.Video()
+	f2 := <-d.Video()
+
+	want1 := [][]byte{annexB(idr), annexB(slice)}
+	if len(f1.NALUs) != len(want1) {
+		t.Fatalf("frame 1 has %d NALUs, want %d", len(f1.NALUs), len(want1))
+	}
+	for i := range want1 {
+		if !bytes.Equal(f1.NALUs[i], want1[i]) {
+			t.Errorf("frame 1 NALU %d = % x, want % x", i, f1.NALUs[i], want1[i])
+		}
+	}
+	if len(f2.NALUs) != 1 || !bytes.Equal(f2.NALUs[0], annexB(slice)) {
+		t.Errorf("frame 2 NALUs = % x, want [% x]", f2.NALUs, annexB(slice))
+	}
+
+	// NALUs share one backing array per frame; appending to one must not
+	// overwrite its neighbour.
+	_ = append(f1.NALUs[0], 0xFF, 0xFF, 0xFF)
+	if !bytes.Equal(f1.NALUs[1], annexB(slice)) {
+		t.Errorf("append to NALU 0 clobbered NALU 1: % x", f1.NALUs[1])
+	}
+}
+
+// adtsFrame builds an AAC-LC ADTS frame (no CRC) around payload.
+func adtsFrame(sampleRateIdx, channels byte, payload []byte) []byte {
+	n := 7 + len(payload)
+	return append([]byte{
+		0xFF, 0xF1,
+		1<<6 | sampleRateIdx<<2 | channels>>2,
+		channels<<6 | byte(n>>11)&0x03,
+		byte(n >> 3),
+		byte(n&0x07)<<5 | 0x1F,
+		0xFC,
+	}, payload...)
+}
+
+func TestHandleAudioPTSStepping(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		sampleRateIdx byte
+		want          []int64 // microseconds after the PES PTS
+	}{
+		// HE-AAC in ADTS signals its 24kHz core; each frame is 2048
+		// samples at the 48kHz output rate, 42.67ms either way.
+		{"HE-AAC 24kHz core", 6, []int64{0, 42666, 85333}},
+		{"LC 48kHz", 3, []int64{0, 21333, 42666}},
+		{"LC 44.1kHz", 4, []int64{0, 23219, 46439}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var data []byte
+			for i := range tt.want {
+				data = append(data, adtsFrame(tt.sampleRateIdx, 2, []byte{byte(i)})...)
+			}
+			pes := &mpegts.PESData{
+				Data: data,
+				Header: &mpegts.PESHeader{OptionalHeader: &mpegts.PESOptionalHeader{
+					PTS: &mpegts.ClockReference{Base: 90000},
+				}},
+			}
+
+			d := NewDemuxer(bytes.NewReader(nil), nil)
+			d.handleAudio(context.Background(), pes, 0)
+
+			for i, off := range tt.want {
+				f := <-d.Audio()
+				if want := 1_000_000 + off; f.PTS != want {
+					t.Errorf("frame %d PTS = %d, want %d", i, f.PTS, want)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleRawPTS(t *testing.T) {
+	t.Parallel()
+
+	// Ticks that microseconds cannot hold exactly: converting back from
+	// the rounded-down microsecond PTS lands a tick early.
+	const pts, dts = 2_999_999_999, 2_999_996_996
+
+	t.Run("video", func(t *testing.T) {
+		t.Parallel()
+		d := NewDemuxer(bytes.NewReader(nil), nil)
+		d.handleVideo(context.Background(), &mpegts.PESData{
+			Data: annexB([]byte{0x65, 0x88, 0x84}),
+			Header: &mpegts.PESHeader{OptionalHeader: &mpegts.PESOptionalHeader{
+				PTS: &mpegts.ClockReference{Base: pts},
+				DTS: &mpegts.ClockReference{Base: dts},
+			}},
+		})
+		f := <-d.Video()
+		if f.PTS90k != pts || f.DTS90k != dts || !f.Has90k {
+			t.Errorf("PTS90k, DTS90k = %d, %d (set %v), want %d, %d", f.PTS90k, f.DTS90k, f.Has90k, pts, dts)
+		}
+		if back := f.PTS * 90_000 / 1_000_000; back == pts {
+			t.Errorf("PTS %dus converts back to %d exactly; pick ticks that drift", f.PTS, back)
+		}
+	})
+
+	tests := []struct {
+		name          string
+		base          int64
+		sampleRateIdx byte
+		want          []int64 // ticks, per frame
+	}{
+		{"LC 48kHz", pts, 3, []int64{pts, pts + 1920, pts + 3840}},
+		{"LC 44.1kHz", pts, 4, []int64{pts, pts + 2089, pts + 4179}},
+		{"wrap", 1<<33 - 1000, 3, []int64{1<<33 - 1000, 920, 2840}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var data []byte
+			for i := range tt.want {
+				data = append(data, adtsFrame(tt.sampleRateIdx, 2, []byte{byte(i)})...)
+			}
+			d := NewDemuxer(bytes.NewReader(nil), nil)
+			d.handleAudio(context.Background(), &mpegts.PESData{
+				Data: data,
+				Header: &mpegts.PESHeader{OptionalHeader: &mpegts.PESOptionalHeader{
+					PTS: &mpegts.ClockReference{Base: tt.base},
+				}},
+			}, 0)
+			for i, want := range tt.want {
+				if f := <-d.Audio(); f.PTS90k != want || !f.Has90k {
+					t.Errorf("frame %d PTS90k = %d (set %v), want %d", i, f.PTS90k, f.Has90k, want)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleVideoStampsArrival(t *testing.T) {
+	t.Parallel()
+	d := NewDemuxer(bytes.NewReader(nil), nil)
+	before := time.Now()
+	d.handleVideo(context.Background(), &mpegts.PESData{Data: annexB([]byte{0x65, 0x88, 0x84})})
+	after := time.Now()
+
+	f := <-d.Video()
+	if f.ArrivedAt.Before(before) || f.ArrivedAt.After(after) {
+		t.Fatalf("ArrivedAt = %v, want within [%v, %v]", f.ArrivedAt, before, after)
+	}
+}
+
+func TestHandleVideoH264RecoveryPoint(t *testing.T) {
+	t.Parallel()
+
+	sps := []byte{0x67, 0x42, 0x00, 0x1E, 0x95, 0xA8}
+	pps := []byte{0x68, 0xCE, 0x38, 0x80}
+	idr := []byte{0x65, 0x88, 0x84}
+	slice := []byte{0x41, 0x9A, 0x02}
+	recoverySEI := []byte{0x06, 0x06, 0x01, 0xC4, 0x80}
+
+	tests := []struct {
+		name     string
+		aus      [][]byte
+		wantKeys []bool
+	}{
+		{
+			name: "open GOP random access point",
+			aus: [][]byte{
+				annexB(sps, pps, idr),
+				annexB(slice),
+				annexB(recoverySEI, slice),
+				annexB(slice),
+			},
+			wantKeys: []bool{true, false, true, false},
+		},
+		{
+			name: "recovery point before parameter sets",
+			aus: [][]byte{
+				annexB(recoverySEI, slice),
+			},
+			wantKeys: []bool{false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			d := NewDemuxer(bytes.NewReader(nil), nil)
+			ctx := context.Background()
+			for i, au := range tt.aus {
+				d.handleVideoH264(ctx, au, int64(i)*33_000, int64(i)*33_000)
+			}
+
+			var lastGroup uint32
+			for i, want := range tt.wantKeys {
+				frame := <-d.Video()
+				if frame.IsKeyframe != want {
+					t.Errorf("frame %d: IsKeyframe = %v, want %v", i, frame.IsKeyframe, want)
+				}
+				if want && frame.GroupID == lastGroup {
+					t.Errorf("frame %d: keyframe should start a new group, still %d", i, frame.GroupID)
+				}
+				lastGroup = frame.GroupID
+			}
+		})
+	}
+}
+
+func TestHandleVideoH264StandaloneParamSets(t *testing.T) {
+	t.Parallel()
+
+	sps := []byte{0x67, 0x42, 0x00, 0x1E, 0x95, 0xA8}
+	pps := []byte{0x68, 0xCE, 0x38, 0x80}
+	idr := []byte{0x65, 0x88, 0x84}
+	slice := []byte{0x41, 0x9A, 0x02}
+
+	d := NewDemuxer(bytes.NewReader(nil), nil)
+	ctx := context.Background()
+	for i, au := range [][]byte{
+		annexB(sps, pps, idr),
+		annexB(slice),
+		annexB(sps, pps), // parameter sets in their own access unit
+		annexB(slice),    // still part of the first group
+		annexB(idr),
+		annexB(slice),
+	} {
+		d.handleVideoH264(ctx, au, int64(i)*33_000, int64(i)*33_000)
+	}
+
+	wantKeys := []bool{true, false, false, true, false}
+	wantGroups := []uint32{1, 1, 1, 2, 2}
+	for i := range wantKeys {
+		frame := <-d.Video()
+		if frame.IsKeyframe != wantKeys[i] || frame.GroupID != wantGroups[i] {
+			t.Errorf("frame %d: keyframe %v in group %d, want %v in group %d",
+				i, frame.IsKeyframe, frame.GroupID, wantKeys[i], wantGroups[i])
+		}
+		if frame.IsKeyframe && (!bytes.Equal(frame.SPS, sps) || !bytes.Equal(frame.PPS, pps)) {
+			t.Errorf("frame %d: SPS %x, PPS %x; want the preceding parameter sets", i, frame.SPS, frame.PPS)
+		}
+	}
+	select {
+	case f := <-d.Video():
+		t.Errorf("unexpected extra frame with %d NALUs", len(f.NALUs))
+	default:
+	}
+}
+
+func TestHandleVideoHEVCStandaloneParamSets(t *testing.T) {
+	t.Parallel()
+
+	vps := []byte{0x40, 0x01, 0x0C}
+	sps := []byte{0x42, 0x01, 0x01}
+	pps := []byte{0x44, 0x01, 0xC1}
+	idr := []byte{0x26, 0x01, 0xAF} // IDR_W_RADL
+	trail := []byte{0x02, 0x01, 0xD0}
+
+	d := NewDemuxer(bytes.NewReader(nil), nil)
+	ctx := context.Background()
+	for i, au := range [][]byte{
+		annexB(vps, sps, pps, idr),
+		annexB(trail),
+		annexB(sps), // an SPS alone in its PES
+		annexB(vps, sps, pps),
+		annexB(trail), // still part of the first group
+		annexB(idr),
+	} {
+		d.handleVideoHEVC(ctx, au, int64(i)*33_000, int64(i)*33_000)
+	}
+
+	wantKeys := []bool{true, false, false, true}
+	wantGroups := []uint32{1, 1, 1, 2}
+	for i := range wantKeys {
+		frame := <-d.Video()
+		if frame.IsKeyframe != wantKeys[i] || frame.GroupID != wantGroups[i] {
+			t.Errorf("frame %d: keyframe %v in group %d, want %v in group %d",
+				i, frame.IsKeyframe, frame.GroupID, wantKeys[i], wantGroups[i])
+		}
+		if frame.IsKeyframe && (!bytes.Equal(frame.VPS, vps) || !bytes.Equal(frame.SPS, sps) || !bytes.Equal(frame.PPS, pps)) {
+			t.Errorf("frame %d: VPS %x, SPS %x, PPS %x; want the preceding parameter sets", i, frame.VPS, frame.SPS, frame.PPS)
+		}
+	}
+	select {
+	case f := <-d.Video():
+		t.Errorf("unexpected extra frame with %d NALUs", len(f.NALUs))
+	default:
+	}
+}
+
+// hevcSPS is a Main profile 320x240 SPS with one temporal sub-layer, and
+// hevcSPS3SubLayers the same with three.
+var (
+	hevcSPS = []byte{
+		0x42, 0x01, 0x01, 0x01, 0x40, 0x00, 0x00, 0x00,
+		0xB0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x5D,
+		0xA0, 0x0A, 0x08, 0x0F, 0x16,
+	}
+	hevcSPS3SubLayers = []byte{
+		0x42, 0x01, 0x05, 0x01, 0x40, 0x00, 0x00, 0x00,
+		0xB0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x5D,
+		0x00, 0x00, // no sub-layer profile or level, reserved bits
+		0xA0, 0x0A, 0x08, 0x0F, 0x16,
+	}
+)
+
+func TestHandleVideoDisposable(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name           string
+		hevc           bool
+		aus            [][]byte
+		wantDisposable []bool
+	}{
+		{
+			name: "h264 nal_ref_idc",
+			aus: [][]byte{
+				annexB([]byte{0x65, 0x88, 0x84}), // IDR
+				annexB([]byte{0x41, 0x9A, 0x02}), // reference slice
+				annexB([]byte{0x01, 0x9E, 0x02}), // non-reference slice
+			},
+			wantDisposable: []bool{false, false, true},
+		},
+		{
+			name: "hevc sub-layer non-reference",
+			hevc: true,
+			aus: [][]byte{
+				annexB(hevcSPS, []byte{0x26, 0x01, 0xAF}), // SPS, IDR_W_RADL
+				annexB([]byte{0x02, 0x01, 0xD0}),          // TRAIL_R
+				annexB([]byte{0x00, 0x01, 0xD0}),          // TRAIL_N
+				annexB([]byte{0x10, 0x01, 0xD0}),          // RASL_N
+			},
+			wantDisposable: []bool{false, false, true, true},
+		},
+		{
+			name: "hevc temporal sub-layers",
+			hevc: true,
+			aus: [][]byte{
+				annexB(hevcSPS3SubLayers, []byte{0x26, 0x01, 0xAF}), // SPS, IDR_W_RADL
+				annexB([]byte{0x00, 0x01, 0xD0}),                    // TRAIL_N, TemporalId 0
+				annexB([]byte{0x04, 0x02, 0xD0}),                    // TSA_N, TemporalId 1
+				annexB([]byte{0x04, 0x03, 0xD0}),                    // TSA_N, TemporalId 2
+			},
+			wantDisposable: []bool{false, false, false, true},
+		},
+		{
+			name: "hevc before an SPS",
+			hevc: true,
+			aus: [][]byte{
+				annexB([]byte{0x26, 0x01, 0xAF}), // IDR_W_RADL
+				annexB([]byte{0x00, 0x01, 0xD0}), // TRAIL_N
+			},
+			wantDisposable: []bool{false, false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			d := NewDemuxer(bytes.NewReader(nil), nil)
+			ctx := context.Background()
+			for i, au := range tt.aus {
+				pts := int64(i) * 33_000
+				if tt.hevc {
+					d.handleVideoHEVC(ctx, au, pts, pts)
+				} else {
+					d.handleVideoH264(ctx, au, pts, pts)
+				}
+			}
+			for i, want := range tt.wantDisposable {
+				if frame := <-d.Video(); frame.Disposable != want {
+					t.Errorf("frame %d: Disposable = %v, want %v", i, frame.Disposable, want)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleVideoEmulationPreventionRepair(t *testing.T) {
+	t.Parallel()
+
+	// An IDR missing an emulation_prevention_three_byte, with zero bytes
+	// trailing it to the end of the PES.
+	idr := []byte{0x65, 0x88, 0x00, 0x00, 0x02, 0x84, 0x00, 0x00}
+
+	tests := []struct {
+		repair bool
+		want   []byte
+	}{
+		{false, idr},
+		{true, []byte{0x65, 0x88, 0x00, 0x00, 0x03, 0x02, 0x84}},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("repair=%v", tt.repair), func(t *testing.T) {
+			t.Parallel()
+			d := NewDemuxer(bytes.NewReader(nil), nil)
+			d.SetEmulationPreventionRepair(tt.repair)
+			d.handleVideoH264(context.Background(), annexB(idr), 0, 0)
+			frame := <-d.Video()
+			if len(frame.NALUs) != 1 {
+				t.Fatalf("frame has %d NAL units, want 1", len(frame.NALUs))
+			}
+			if got := frame.NALUs[0][4:]; !bytes.Equal(got, tt.want) {
+				t.Errorf("NAL unit = % x, want % x", got, tt.want)
+			}
+		})
+	}
+}
+
+// captionServiceRecorder records the caption channels and CEA-708
+// services reported by the demuxer; its other methods are never called.
+type captionServiceRecorder struct {
+	StatsRecorder
+	channels []int
+	services map[int]CaptionChannel
+}
+
+func (r *captionServiceRecorder) RecordCaption(channel int) { r.channels = append(r.channels, channel) }
+func (r *captionServiceRecorder) RecordCaptionService(service int, ch CaptionChannel) {
+	r.services[service] = ch
+}
+
+func TestDemuxerCaptionChannels(t *testing.T) {
+	t.Parallel()
+
+	// A DTVCC packet of 12 bytes carrying a service 1 block that defines
+	// a visible window and writes "Hi" in it.
+	packet := []byte{
+		0x06,
+		1<<5 | 9, 0x98, 0x20, 0x00, 0x00, 0x02, 0x1F, 0x11, 'H', 'i',
+		0x00,
+	}
+
+	tests := []struct {
+		name    string
+		mapping CaptionChannelFunc
+		want    CaptionChannel
+	}{
+		{name: "default", want: CaptionChannel{Channel: 7, Label: "Service 1"}},
+		{
+			name: "custom",
+			mapping: func(service int) CaptionChannel {
+				return CaptionChannel{Channel: 100 + service, Label: "English"}
+			},
+			want: CaptionChannel{Channel: 101, Label: "English"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			d := NewDemuxer(bytes.NewReader(nil), nil)
+			rec := &captionServiceRecorder{services: make(map[int]CaptionChannel)}
+			d.SetStats(rec)
+			if tt.mapping != nil {
+				d.SetCaptionChannels(tt.mapping)
+			}
+
+			d.dtvccBuf = append(d.dtvccBuf, packet...)
+			d.drainDTVCC(context.Background(), 90_000)
+
+			frame := <-d.Captions()
+			if frame.Channel != tt.want.Channel || frame.Text != "Hi" {
+				t.Errorf("caption on channel %d with text %q, want channel %d with \"Hi\"", frame.Channel, frame.Text, tt.want.Channel)
+			}
+			if frame.Service != 1 || frame.Label != tt.want.Label {
+				t.Errorf("caption from service %d labeled %q, want service 1 labeled %q", frame.Service, frame.Label, tt.want.Label)
+			}
+			if len(rec.channels) != 1 || rec.channels[0] != tt.want.Channel {
+				t.Errorf("recorded channels %v, want [%d]", rec.channels, tt.want.Channel)
+			}
+			if got := rec.services[1]; got != tt.want {
+				t.Errorf("service 1 recorded as %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractCaptions(t *testing.T) {
+	t.Parallel()
+
+	// An A/53 user_data_registered_itu_t_t35 SEI payload carrying the
+	// DTVCC packet of TestDemuxerCaptionChannels, which writes "Hi" in
+	// service 1, and the start of the next packet, which ends it.
+	packet := []byte{
+		0x06,
+		1<<5 | 9, 0x98, 0x20, 0x00, 0x00, 0x02, 0x1F, 0x11, 'H', 'i',
+		0x00,
+	}
+	payload := []byte{0xB5, 0x00, 0x31, 'G', 'A', '9', '4', 0x03, 0x40 | 7, 0xFF}
+	for i := 0; i < len(packet); i += 2 {
+		marker := byte(0xFE) // cc_valid, DTVCC packet data
+		if i == 0 {
+			marker = 0xFF // cc_valid, DTVCC packet start
+		}
+		payload = append(payload, marker, packet[i], packet[i+1])
+	}
+	payload = append(payload, 0xFF, 0x00, 0x00, 0xFF)
+	rbsp := append([]byte{seiPayloadUserDataRegistered, byte(len(payload))}, payload...)
+	rbsp = append(rbsp, 0x80)
+
+	tests := []struct {
+		name   string
+		header []byte
+	}{
+		{"H.264", []byte{0x06}},
+		{"H.265 prefix SEI", []byte{39 << 1, 0x01}},
+		{"H.265 suffix SEI", []byte{40 << 1, 0x01}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			d := NewDemuxer(bytes.NewReader(nil), nil)
+			nal := addEmulationPrevention(append([]byte(nil), tt.header...), rbsp)
+			d.handleCaptionSEI(context.Background(), nal, len(tt.header), 90_000)
+
+			select {
+			case frame := <-d.Captions():
+				if frame.Channel != 7 || frame.Text != "Hi" {
+					t.Errorf("caption on channel %d with text %q, want channel 7 with \"Hi\"", frame.Channel, frame.Text)
+				}
+			default:
+				t.Fatal("no caption decoded")
+			}
+		})
+	}
+}
+
+func TestHandleVideoDiscontinuity(t *testing.T) {
+	t.Parallel()
+
+	sps := []byte{0x67, 0x42, 0x00, 0x1E, 0x95, 0xA8}
+	pps := []byte{0x68, 0xCE, 0x38, 0x80}
+	idr := annexB(sps, pps, []byte{0x65, 0x88, 0x84})
+	slice := annexB([]byte{0x41, 0x9A, 0x02})
+
+	type au struct {
+		data []byte
+		pts  int64
+	}
+	tests := []struct {
+		name      string
+		threshold time.Duration // 0 keeps the default
+		disable   bool
+		aus       []au
+		// wantDiscont lists the emitted frames' Discontinuity flags.
+		wantDiscont []bool
+	}{
+		{
+			name:        "splice at keyframe",
+			aus:         []au{{idr, 10_000_000}, {slice, 10_033_000}, {idr, 2_000_000}, {slice, 2_033_000}},
+			wantDiscont: []bool{false, false, true, false},
+		},
+		{
+			name:        "delta frames before the keyframe are dropped",
+			aus:         []au{{idr, 10_000_000}, {slice, 2_000_000}, {slice, 2_033_000}, {idr, 2_066_000}},
+			wantDiscont: []bool{false, true},
+		},
+		{
+			name:        "B-frame reordering",
+			aus:         []au{{idr, 10_000_000}, {slice, 10_100_000}, {slice, 10_033_000}},
+			wantDiscont: []bool{false, false, false},
+		},
+		{
+			name:        "PTS wrap",
+			aus:         []au{{idr, ptsWrapUS - 33_000}, {slice, 1_000}},
+			wantDiscont: []bool{false, false},
+		},
+		{
+			name:        "below configured threshold",
+			threshold:   10 * time.Second,
+			aus:         []au{{idr, 10_000_000}, {idr, 2_000_000}},
+			wantDiscont: []bool{false, false},
+		},
+		{
+			name:        "disabled",
+			disable:     true,
+			aus:         []au{{idr, 10_000_000}, {slice, 2_000_000}},
+			wantDiscont: []bool{false, false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			d := NewDemuxer(bytes.NewReader(nil), nil)
+			switch {
+			case tt.disable:
+				d.SetDiscontinuityThreshold(0)
+			case tt.threshold > 0:
+				d.SetDiscontinuityThreshold(tt.threshold)
+			}
+			ctx := context.Background()
+			for _, a := range tt.aus {
+				d.handleVideoH264(ctx, a.data, a.pts, a.pts)
+			}
+			close(d.videoCh)
+
+			var frames []*media.VideoFrame
+			for f := range d.Video() {
+				frames = append(frames, f)
+			}
+			if len(frames) != len(tt.wantDiscont) {
+				t.Fatalf("emitted %d frames, want %d", len(frames), len(tt.wantDiscont))
+			}
+			for i, f := range frames {
+				if f.Discontinuity != tt.wantDiscont[i] {
+					t.Errorf("frame %d: Discontinuity = %v, want %v", i, f.Discontinuity, tt.wantDiscont[i])
+				}
+				if !f.Discontinuity {
+					continue
+				}
+				if !f.IsKeyframe || f.GroupID == frames[i-1].GroupID {
+					t.Errorf("frame %d: discontinuity should open a new group at a keyframe (group %d, previous %d)",
+						i, f.GroupID, frames[i-1].GroupID)
+				}
+				if f.SPS == nil || f.PPS == nil {
+					t.Errorf("frame %d: discontinuity keyframe should carry the decoder config", i)
+				}
+			}
+		})
+	}
+}
+
+func TestDemuxerSignaledDiscontinuity(t *testing.T) {
+	t.Parallel()
+
+	sps := []byte{0x67, 0x42, 0x00, 0x1E, 0x95, 0xA8}
+	pps := []byte{0x68, 0xCE, 0x38, 0x80}
+	idr := annexB(sps, pps, []byte{0x65, 0x88, 0x84})
+	slice := annexB([]byte{0x41, 0x9A, 0x02})
+
+	var buf bytes.Buffer
+	mux := mpegts.NewMuxer(&buf, mpegts.MuxStream{PID: 0x100, StreamType: mpegts.StreamTypeH264})
+	if err := mux.WritePSI(); err != nil {
+		t.Fatal(err)
+	}
+	var spliceAt int // offset of the first packet after the splice
+	for i, au := range []struct {
+		data []byte
+		pts  int64 // 90kHz
+		key  bool
+	}{
+		{idr, 900_000, true},
+		{slice, 903_000, false},
+		{idr, 9_000_000, true}, // PTS jumps 90s forward
+		{slice, 9_003_000, false},
+	} {
+		if i == 2 {
+			spliceAt = buf.Len()
+		}
+		if err := mux.WriteAccessUnit(0x100, au.pts, au.pts, au.key, au.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The video stream carries the PCR, so its first packet has an
+	// adaptation field; set its discontinuity_indicator.
+	ts := buf.Bytes()
+	if ts[spliceAt+3]&0x20 == 0 {
+		t.Fatal("splice packet has no adaptation field")
+	}
+	ts[spliceAt+5] |= 0x80
+
+	d := NewDemuxer(bytes.NewReader(ts), nil)
+	if err := d.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	var discont []bool
+	for f := range d.Video() {
+		discont = append(discont, f.Discontinuity)
+	}
+	if want := []bool{false, false, true, false}; !slices.Equal(discont, want) {
+		t.Errorf("Discontinuity flags = %v, want %v", discont, want)
+	}
+
+	var events []DemuxEvent
+	for e := range d.Events() {
+		events = append(events, e)
+	}
+	if len(events) != 1 || events[0].Type != EventDiscontinuity || events[0].PID != 0x100 {
+		t.Errorf("events = %+v, want one discontinuity on PID 0x100", events)
+	}
+}
+
+func TestHandleVideoTimecode(t *testing.T) {
+	t.Parallel()
+
+	picTiming := []byte{0x06, 0x01, 0x08, 0x00, 0x85, 0x04, 0x12, 0x00, 0x80, 0x00, 0x40, 0x80}
+	timeCode := []byte{0x4E, 0x01, 0x88, 0x06, 0x60, 0x40, 0xC3, 0xDD, 0xA8, 0x00, 0x80}
+
+	tests := []struct {
+		name string
+		hevc bool
+		au   []byte
+		want *media.Timecode
+	}{
+		{
+			name: "H.264 pic_timing",
+			au:   annexB(picTiming, []byte{0x41, 0x9A, 0x02}),
+			want: &media.Timecode{Hours: 1, Frames: 1},
+		},
+		{
+			name: "H.264 without SEI",
+			au:   annexB([]byte{0x41, 0x9A, 0x02}),
+		},
+		{
+			name: "HEVC time_code",
+			hevc: true,
+			au:   annexB(timeCode, []byte{0x02, 0x01, 0xD0}),
+			want: &media.Timecode{Hours: 10, Minutes: 59, Seconds: 30, Frames: 24},
+		},
+		{
+			name: "HEVC without SEI",
+			hevc: true,
+			au:   annexB([]byte{0x02, 0x01, 0xD0}),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			d := NewDemuxer(bytes.NewReader(nil), nil)
+			d.spsInfo = SPSInfo{
+				PicStructPresent:   true,
+				HRDPresent:         true,
+				CpbRemovalDelayLen: 10,
+				DpbOutputDelayLen:  7,
+			}
+			if tt.hevc {
+				d.handleVideoHEVC(context.Background(), tt.au, 0, 0)
+			} else {
+				d.handleVideoH264(context.Background(), tt.au, 0, 0)
+			}
+
+			got := (<-d.Video()).Timecode
+			switch {
+			case tt.want == nil && got != nil:
+				t.Errorf("Timecode = %+v, want nil", *got)
+			case tt.want != nil && (got == nil || *got != *tt.want):
+				t.Errorf("Timecode = %v, want %+v", got, *tt.want)
+			}
+		})
+	}
+}
+
+// privateDataPES returns a single-packet video PES on pid whose
+// adaptation field carries private.
+func privateDataPES(pid uint16, private, au []byte) []byte {
+	pes := []byte{0, 0, 1, 0xE0, 0, 0, 0x80, 0x80, 5, 0x21, 0, 0x01, 0, 0x01}
+	pes = append(pes, au...)
+
+	pkt := make([]byte, 188)
+	pkt[0] = 0x47
+	pkt[1] = 0x40 | byte(pid>>8)&0x1F
+	pkt[2] = byte(pid)
+	pkt[3] = 0x30
+	afLen := 188 - 5 - len(pes)
+	pkt[4] = byte(afLen)
+	pkt[5] = 0x02 // transport_private_data_flag
+	pkt[6] = byte(len(private))
+	copy(pkt[7:], private)
+	for i := 7 + len(private); i < 5+afLen; i++ {
+		pkt[i] = 0xFF
+	}
+	copy(pkt[5+afLen:], pes)
+	return pkt
+}
+
+func TestParsePrivateDataTimecode(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		data   []byte
+		want   Timecode
+		wantOK bool
+	}{
+		{"timecode", []byte{0xA0, 4, 0x10, 0x59, 0x30, 0x24}, Timecode{Hours: 10, Minutes: 59, Seconds: 30, Frames: 24}, true},
+		{"after another field", []byte{0x02, 2, 0xFF, 0xFF, 0xA0, 4, 0x01, 0x02, 0x03, 0x04}, Timecode{Hours: 1, Minutes: 2, Seconds: 3, Frames: 4}, true},
+		{"drop frame flag", []byte{0xA0, 4, 0x00, 0x00, 0x00, 0x40 | 0x12}, Timecode{Frames: 12}, true},
+		{"other tag", []byte{0xA1, 4, 0x10, 0x59, 0x30, 0x24}, Timecode{}, false},
+		{"not BCD", []byte{0xA0, 4, 0x1A, 0x00, 0x00, 0x00}, Timecode{}, false},
+		{"out of range", []byte{0xA0, 4, 0x25, 0x00, 0x00, 0x00}, Timecode{}, false},
+		{"short field", []byte{0xA0, 3, 0x10, 0x59, 0x30}, Timecode{}, false},
+		{"truncated", []byte{0xA0, 4, 0x10}, Timecode{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, ok := ParsePrivateDataTimecode(tt.data, 0xA0)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("ParsePrivateDataTimecode = %+v, %v, want %+v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestDemuxerPrivateDataTimecode(t *testing.T) {
+	t.Parallel()
+
+	private := []byte{0xA0, 4, 0x10, 0x59, 0x30, 0x24}
+	picTiming := []byte{0x06, 0x01, 0x08, 0x00, 0x85, 0x04, 0x12, 0x00, 0x80, 0x00, 0x40, 0x80}
+	slice := []byte{0x41, 0x9A, 0x02}
+
+	tests := []struct {
+		name string
+		tag  uint8
+		au   []byte
+		want *media.Timecode
+	}{
+		{"private data", 0xA0, annexB(slice), &media.Timecode{Hours: 10, Minutes: 59, Seconds: 30, Frames: 24}},
+		{"SEI preferred", 0xA0, annexB(picTiming, slice), &media.Timecode{Hours: 1, Frames: 1}},
+		{"disabled", 0, annexB(slice), nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var ts bytes.Buffer
+			video := mpegts.MuxStream{PID: 0x100, StreamType: mpegts.StreamTypeH264}
+			if err := mpegts.NewMuxer(&ts, video).WritePSI(); err != nil {
+				t.Fatal(err)
+			}
+			ts.Write(privateDataPES(video.PID, private, tt.au))
+
+			d := NewDemuxer(&ts, nil)
+			d.SetPrivateDataTimecode(tt.tag)
+			d.spsInfo = SPSInfo{
+				PicStructPresent:   true,
+				HRDPresent:         true,
+				CpbRemovalDelayLen: 10,
+				DpbOutputDelayLen:  7,
+			}
+			if err := d.Run(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			frame, ok := <-d.Video()
+			if !ok {
+				t.Fatal("no video frame demuxed")
+			}
+			got := frame.Timecode
+			switch {
+			case tt.want == nil && got != nil:
+				t.Errorf("Timecode = %+v, want nil", *got)
+			case tt.want != nil && (got == nil || *got != *tt.want):
+				t.Errorf("Timecode = %v, want %+v", got, *tt.want)
+			}
+		})
+	}
+}
+
+func TestDemuxerAudioChannels(t *testing.T) {
+	t.Parallel()
+
+	dualMono := AACFrame{Channels: 2, ChannelConfig: 0}
+	noPCE := AACFrame{Channels: 0, ChannelConfig: 0}
+	surround := AACFrame{Channels: 8, ChannelConfig: 7}
+
+	d := NewDemuxer(bytes.NewReader(nil), nil)
+	if got := d.audioChannels(0, noPCE); got != 0 {
+		t.Errorf("before any PCE: channels = %d, want 0", got)
+	}
+	if got := d.audioChannels(0, dualMono); got != 2 {
+		t.Errorf("with PCE: channels = %d, want 2", got)
+	}
+	if got := d.audioChannels(0, noPCE); got != 2 {
+		t.Errorf("after PCE: channels = %d, want 2 from the last PCE", got)
+	}
+	if got := d.audioChannels(1, noPCE); got != 0 {
+		t.Errorf("other track: channels = %d, want 0", got)
+	}
+	if got := d.audioChannels(0, surround); got != 8 {
+		t.Errorf("7.1: channels = %d, want 8", got)
+	}
+
+	d.SetAACChannelCorrection(false)
+	if got := d.audioChannels(0, dualMono); got != 0 {
+		t.Errorf("uncorrected dual-mono: channels = %d, want 0", got)
+	}
+	if got := d.audioChannels(0, surround); got != 7 {
+		t.Errorf("uncorrected 7.1: channels = %d, want 7", got)
+	}
+}
+
+// streamTypeRecorder records the unsupported stream types, CA systems
+// and packet size reported by the demuxer; its other methods are no-ops
+// or never called.
+type streamTypeRecorder struct {
+	StatsRecorder
+	unsupported []uint8
+	ca          []uint16
+	packetSize  int
+}
+
+func (r *streamTypeRecorder) RecordHasVideo(bool)                 {}
+func (r *streamTypeRecorder) RecordVideoCodec(string)             {}
+func (r *streamTypeRecorder) RecordPacketSize(size int)           { r.packetSize = size }
+func (r *streamTypeRecorder) RecordVideoFrame(int64, bool, int64) {}
+func (r *streamTypeRecorder) RecordUnsupportedStreamType(st uint8) {
+	r.unsupported = append(r.unsupported, st)
+}
+func (r *streamTypeRecorder) RecordConditionalAccess(id uint16) {
+	r.ca = append(r.ca, id)
+}
+
+func TestDemuxerUnsupportedStreamTypes(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	mux := mpegts.NewMuxer(&buf,
+		mpegts.MuxStream{PID: 0x100, StreamType: mpegts.StreamTypeH264},
+		mpegts.MuxStream{PID: 0x101, StreamType: mpegts.StreamTypeAAC},
+		mpegts.MuxStream{PID: 0x102, StreamType: streamTypeAC3},
+		mpegts.MuxStream{PID: 0x103, StreamType: 0x03}, // MPEG-1 audio
+		mpegts.MuxStream{PID: 0x104, StreamType: 0x03},
+		mpegts.MuxStream{PID: scte35PIDWellKnown, StreamType: streamTypeSCTE35},
+	)
+	for range 2 {
+		if err := mux.WritePSI(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rec := &streamTypeRecorder{}
+	d := NewDemuxer(&buf, nil)
+	d.SetStats(rec)
+	if err := d.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []uint8{0x03}
+	if got := d.UnsupportedStreamTypes(); !slices.Equal(got, want) {
+		t.Errorf("UnsupportedStreamTypes() = %#x, want %#x", got, want)
+	}
+	if !slices.Equal(rec.unsupported, want) {
+		t.Errorf("recorded %#x, want %#x reported once", rec.unsupported, want)
+	}
+	tracks := d.AudioTrackChannels()
+	if !d.HasVideo() || len(tracks) != 2 || tracks[1].Codec != media.AudioCodecAC3 {
+		t.Errorf("HasVideo = %v, audio tracks = %+v; want video, AAC and AC-3", d.HasVideo(), tracks)
+	}
+	if ca := d.ConditionalAccess(); ca != nil {
+		t.Errorf("ConditionalAccess() = %#x for a program in the clear", ca)
+	}
+}
+
+func TestDemuxerConditionalAccess(t *testing.T) {
+	t.Parallel()
+
+	// The program is scrambled by one CA system and its audio also by a
+	// second, and the PMT repeats.
+	var buf bytes.Buffer
+	mux := mpegts.NewMuxer(&buf,
+		mpegts.MuxStream{PID: 0x100, StreamType: mpegts.StreamTypeH264},
+		mpegts.MuxStream{PID: 0x101, StreamType: mpegts.StreamTypeAAC, Descriptors: []byte{
+			0x09, 4, 0x06, 0x04, 0xE1, 0x10,
+			0x09, 4, 0x0B, 0x00, 0xE1, 0x11,
+		}},
+	)
+	mux.SetProgramDescriptors([]byte{0x09, 4, 0x06, 0x04, 0xE1, 0x10})
+	for range 2 {
+		if err := mux.WritePSI(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rec := &streamTypeRecorder{}
+	d := NewDemuxer(&buf, nil)
+	d.SetStats(rec)
+	if err := d.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []uint16{0x0604, 0x0B00}
+	if got := d.ConditionalAccess(); !slices.Equal(got, want) {
+		t.Errorf("ConditionalAccess() = %#x, want %#x", got, want)
+	}
+	if !slices.Equal(rec.ca, want) {
+		t.Errorf("recorded %#x, want %#x reported once", rec.ca, want)
+	}
+	var events []DemuxEvent
+	for len(d.Events()) > 0 {
+		if e := <-d.Events(); e.Type == EventConditionalAccess {
+			events = append(events, e)
+		}
+	}
+	if len(events) != 2 || events[0].PID != 0 || events[1].PID != 0x101 || events[1].Detail != "CA system 0x0B00" {
+		t.Errorf("events = %+v, want the program's CA system, then the audio's", events)
+	}
+}
+
+func TestDemuxerPacketSize(t *testing.T) {
+	t.Parallel()
+
+	var ts bytes.Buffer
+	video := mpegts.MuxStream{PID: 0x100, StreamType: mpegts.StreamTypeH264}
+	mux := mpegts.NewMuxer(&ts, video)
+	if err := mux.WritePSI(); err != nil {
+		t.Fatal(err)
+	}
+	au := annexB([]byte{0x41, 0x9A, 0x02})
+	for i := range 3 {
+		if err := mux.WriteAccessUnit(video.PID, int64(90000+3000*i), int64(90000+3000*i), false, au); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		size int
+		lead int // bytes of a partial packet before the first
+	}{
+		{"TS", 188, 0},
+		{"M2TS", 192, 0},
+		{"M2TS joined mid-packet", 192, 100},
+		{"Reed-Solomon", 204, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var in []byte
+			for i, pkt := range slices.Collect(slices.Chunk(ts.Bytes(), 188)) {
+				if tt.size == 192 {
+					in = binary.BigEndian.AppendUint32(in, uint32(i*1000)&0x3FFFFFFF)
+				}
+				in = append(in, pkt...)
+				if tt.size == 204 {
+					in = append(in, bytes.Repeat([]byte{0xA5}, 16)...)
+				}
+			}
+
+			rec := &streamTypeRecorder{}
+			d := NewDemuxer(bytes.NewReader(append(make([]byte, tt.lead), in...)), nil)
+			d.SetStats(rec)
+			if err := d.Run(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if rec.packetSize != tt.size {
+				t.Errorf("packet size = %d, want %d", rec.packetSize, tt.size)
+			}
+			var pts []int64
+			for len(d.Video()) > 0 {
+				pts = append(pts, (<-d.Video()).PTS)
+			}
+			if want := []int64{1_000_000, 1_033_333, 1_066_666}; !slices.Equal(pts, want) {
+				t.Errorf("video PTS = %v, want %v", pts, want)
+			}
+		})
+	}
+}
+
+func TestDemuxerAudioTrackOrder(t *testing.T) {
+	t.Parallel()
+
+	aac := func(pid uint16) mpegts.MuxStream {
+		return mpegts.MuxStream{PID: pid, StreamType: mpegts.StreamTypeAAC}
+	}
+	ac3 := mpegts.MuxStream{PID: 0x102, StreamType: streamTypeAC3}
+	video := mpegts.MuxStream{PID: 0x100, StreamType: mpegts.StreamTypeH264}
+
+	tests := []struct {
+		name string
+		pmts [][]mpegts.MuxStream // successive PMTs
+		want []AudioTrackInfo
+	}{
+		{
+			name: "declared in PID order",
+			pmts: [][]mpegts.MuxStream{{video, aac(0x101), ac3, aac(0x103)}},
+			want: []AudioTrackInfo{{0x101, 0, media.AudioCodecAAC}, {0x102, 1, media.AudioCodecAC3}, {0x103, 2, media.AudioCodecAAC}},
+		},
+		{
+			name: "declared in reverse",
+			pmts: [][]mpegts.MuxStream{{aac(0x103), ac3, aac(0x101), video}},
+			want: []AudioTrackInfo{{0x101, 0, media.AudioCodecAAC}, {0x102, 1, media.AudioCodecAC3}, {0x103, 2, media.AudioCodecAAC}},
+		},
+		{
+			name: "reordered on repeat",
+			pmts: [][]mpegts.MuxStream{
+				{video, aac(0x101), ac3, aac(0x103)},
+				{video, aac(0x103), aac(0x101), ac3},
+			},
+			want: []AudioTrackInfo{{0x101, 0, media.AudioCodecAAC}, {0x102, 1, media.AudioCodecAC3}, {0x103, 2, media.AudioCodecAAC}},
+		},
+		{
+			// Indices are frozen: a stream added later with a lower PID
+			// is indexed after those already found.
+			name: "added later",
+			pmts: [][]mpegts.MuxStream{
+				{video, aac(0x103)},
+				{video, aac(0x103), ac3, aac(0x101)},
+			},
+			want: []AudioTrackInfo{{0x103, 0, media.AudioCodecAAC}, {0x101, 1, media.AudioCodecAAC}, {0x102, 2, media.AudioCodecAC3}},
+		},
+		{
+			name: "PID listed twice",
+			pmts: [][]mpegts.MuxStream{{video, aac(0x103), ac3, aac(0x103)}},
+			want: []AudioTrackInfo{{0x102, 0, media.AudioCodecAC3}, {0x103, 1, media.AudioCodecAAC}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var buf bytes.Buffer
+			for _, streams := range tt.pmts {
+				if err := mpegts.NewMuxer(&buf, streams...).WritePSI(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			d := NewDemuxer(&buf, nil)
+			if err := d.Run(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if got := d.AudioTrackChannels(); !slices.Equal(got, tt.want) {
+				t.Errorf("AudioTrackChannels() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDemuxerTracksChanged(t *testing.T) {
+	t.Parallel()
+
+	pr, pw := io.Pipe()
+	d := NewDemuxer(pr, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go d.Run(ctx)
+	defer pw.Close()
+
+	waitChanged := func(wantTracks int) {
+		t.Helper()
+		select {
+		case <-d.TracksChanged():
+		case <-time.After(2 * time.Second):
+			t.Fatalf("no track change signalled for %d audio tracks", wantTracks)
+		}
+		if got := len(d.AudioTrackChannels()); got != wantTracks {
+			t.Errorf("audio tracks = %d, want %d", got, wantTracks)
+		}
+	}
+
+	stereo := mpegts.MuxStream{PID: 0x101, StreamType: mpegts.StreamTypeAAC}
+	commentary := mpegts.MuxStream{PID: 0x102, StreamType: mpegts.StreamTypeAAC}
+	if err := mpegts.NewMuxer(pw, stereo).WritePSI(); err != nil {
+		t.Fatal(err)
+	}
+	waitChanged(1)
+
+	mux := mpegts.NewMuxer(pw, stereo, commentary)
+	if err := mux.WritePSI(); err != nil {
+		t.Fatal(err)
+	}
+	waitChanged(2)
+
+	if err := mux.WritePSI(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-d.TracksChanged():
+		t.Error("unchanged PMT signalled a track change")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,59 @@
+package demux
+
+// PicStruct is the pic_struct of an H.264 pic_timing SEI (Table D-1): how
+// a picture is displayed, as a frame or as one or more fields.
+type PicStruct uint8
+
+const (
+	PicStructFrame           PicStruct = 0
+	PicStructTopField        PicStruct = 1
+	PicStructBottomField     PicStruct = 2
+	PicStructTopBottom       PicStruct = 3
+	PicStructBottomTop       PicStruct = 4
+	PicStructTopBottomTop    PicStruct = 5
+	PicStructBottomTopBottom PicStruct = 6
+	PicStructFrameDoubling   PicStruct = 7
+	PicStructFrameTripling   PicStruct = 8
+)
+
+// Field reports whether the picture is a single field, so that each
+// access unit carries half a frame.
+func (p PicStruct) Field() bool {
+	return p == PicStructTopField || p == PicStructBottomField
+}
+
+// Interlaced reports whether the picture is interlaced: a single field,
+// or a frame of two fields displayed one after the other. The
+// three-field structures repeat a field for telecine pulldown of
+// progressive film and are not counted.
+func (p PicStruct) Interlaced() bool {
+	return p >= PicStructTopField && p <= PicStructBottomTop
+}
+
+// ParsePicStruct extracts the pic_struct of an H.264 pic_timing SEI
+// message. Unlike ParsePicTimingSEI it does not need HRD parameters: an
+// SPS without them has no delay fields ahead of pic_struct. It returns
+// false if the SPS does not signal pic_struct, the SEI has no pic_timing
+// message or the value is reserved.
+func ParsePicStruct(seiNALU []byte, sps SPSInfo) (PicStruct, bool) {
+	if !sps.PicStructPresent {
+		return 0, false
+	}
+
+	var ps PicStruct
+	var found bool
+	forEachSEIPayload(seiNALU, func(payloadType int, payload []byte) bool {
+		if payloadType != seiPayloadPicTiming {
+			return true
+		}
+		br := newBitReader(payload)
+		br.readBits(sps.CpbRemovalDelayLen)
+		br.readBits(sps.DpbOutputDelayLen)
+		v, err := br.readBits(4)
+		if err == nil && v <= uint(PicStructFrameTripling) {
+			ps, found = PicStruct(v), true
+		}
+		return false
+	})
+	return ps, found
+}
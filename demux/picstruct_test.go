@@ -0,0 +1,41 @@
+package demux
+
+import "testing"
+
+func TestParsePicStruct(t *testing.T) {
+	t.Parallel()
+	noHRD := SPSInfo{PicStructPresent: true}
+	hrd := SPSInfo{PicStructPresent: true, HRDPresent: true, CpbRemovalDelayLen: 10, DpbOutputDelayLen: 7}
+
+	tests := []struct {
+		name       string
+		nal        []byte
+		sps        SPSInfo
+		want       PicStruct
+		ok         bool
+		interlaced bool
+	}{
+		{"progressive frame", []byte{0x06, 0x01, 0x01, 0x00, 0x80}, noHRD, PicStructFrame, true, false},
+		{"top field", []byte{0x06, 0x01, 0x01, 0x10, 0x80}, noHRD, PicStructTopField, true, true},
+		{"bottom-top frame", []byte{0x06, 0x01, 0x01, 0x40, 0x80}, noHRD, PicStructBottomTop, true, true},
+		{"pulldown", []byte{0x06, 0x01, 0x01, 0x50, 0x80}, noHRD, PicStructTopBottomTop, true, false},
+		// 17 bits of HRD delays ahead of pic_struct 4.
+		{"after HRD delays", []byte{0x06, 0x01, 0x03, 0x00, 0x00, 0x20, 0x80}, hrd, PicStructBottomTop, true, true},
+		{"reserved", []byte{0x06, 0x01, 0x01, 0x90, 0x80}, noHRD, 0, false, false},
+		{"no pic_timing", []byte{0x06, 0x06, 0x01, 0xC4, 0x80}, noHRD, 0, false, false},
+		{"not signalled in SPS", []byte{0x06, 0x01, 0x01, 0x10, 0x80}, SPSInfo{}, 0, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, ok := ParsePicStruct(tt.nal, tt.sps)
+			if ok != tt.ok || got != tt.want {
+				t.Fatalf("got %d, %v; want %d, %v", got, ok, tt.want, tt.ok)
+			}
+			if got.Interlaced() != tt.interlaced {
+				t.Errorf("Interlaced() = %v, want %v", got.Interlaced(), tt.interlaced)
+			}
+		})
+	}
+}
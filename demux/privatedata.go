@@ -0,0 +1,43 @@
+package demux
+
+// ParsePrivateDataTimecode reads a timecode from MPEG-TS adaptation field
+// private data. The private data is taken to hold ETSI TS 101 154 Annex D
+// data fields, each a tag byte, a length byte and that many bytes; the
+// field tagged tag carries a SMPTE 12M time address as four BCD bytes in
+// the order hours, minutes, seconds, frames. The flag bits above each
+// time value, such as drop frame, are ignored. ok is false if there is no
+// such field or it does not hold a valid time.
+func ParsePrivateDataTimecode(data []byte, tag uint8) (tc Timecode, ok bool) {
+	for len(data) >= 2 {
+		fieldTag, n := data[0], int(data[1])
+		if 2+n > len(data) {
+			return Timecode{}, false
+		}
+		field := data[2 : 2+n]
+		data = data[2+n:]
+		if fieldTag != tag {
+			continue
+		}
+		if n < 4 {
+			return Timecode{}, false
+		}
+		hours, ok1 := bcd(field[0] & 0x3F)
+		minutes, ok2 := bcd(field[1] & 0x7F)
+		seconds, ok3 := bcd(field[2] & 0x7F)
+		frames, ok4 := bcd(field[3] & 0x3F)
+		if !ok1 || !ok2 || !ok3 || !ok4 || hours > 23 || minutes > 59 || seconds > 59 {
+			return Timecode{}, false
+		}
+		return Timecode{Hours: hours, Minutes: minutes, Seconds: seconds, Frames: frames}, true
+	}
+	return Timecode{}, false
+}
+
+// bcd decodes a two-digit binary-coded decimal byte.
+func bcd(b byte) (int, bool) {
+	hi, lo := b>>4, b&0x0F
+	if hi > 9 || lo > 9 {
+		return 0, false
+	}
+	return int(hi)*10 + int(lo), true
+}
@@ -0,0 +1,71 @@
+package distribution
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/zsiec/ccx"
+	"github.com/zsiec/prism/media"
+)
+
+// CaptionCodec is the catalog codec of the captions track. Each object is
+// one caption update for one channel, timestamped with its PTS, in one of
+// two layouts told apart by the first two bytes:
+//
+// Styled, starting with the magic 0xCC02, is ccx's binary caption format
+// (see ccx.CaptionFrame.Serialize): a version byte, CaptionFormatVersion,
+// then the channel and the decoded regions with their CEA-708 window
+// position, justification and fill, and rows of spans with their pen
+// colors, opacity, font, size and edge. Colors are 24-bit RGB.
+//
+// Plain is the channel byte followed by the caption's UTF-8 text, rows
+// separated by newlines. It is sent for an update without regions and,
+// with MoQSessionConfig.PlainCaptions, for every update. Either layout
+// with no text clears the channel.
+//
+// DecodeCaption decodes both.
+const CaptionCodec = "caption/v2"
+
+// styledCaptionHeader is the magic and version byte that start every
+// styled caption object, taken from ccx's own encoder, which does not
+// export them, so they cannot drift from the format it writes.
+var styledCaptionHeader = (&ccx.CaptionFrame{Regions: make([]ccx.CaptionRegion, 1)}).Serialize()[:3]
+
+// CaptionFormatVersion is the version of the styled caption layout ccx
+// writes. It changes only with an incompatible change to the layout.
+var CaptionFormatVersion = styledCaptionHeader[2]
+
+// ErrCaptionVersion reports a styled caption object of a version other
+// than CaptionFormatVersion.
+var ErrCaptionVersion = errors.New("unsupported caption format version")
+
+// encodeCaption returns the captions track object for frame. With plain,
+// a styled frame is sent as its plain text.
+func encodeCaption(frame *media.CaptionFrame, plain bool) []byte {
+	cf := &ccx.CaptionFrame{PTS: frame.PTS, Text: frame.Text, Channel: frame.Channel, Regions: frame.Regions}
+	if plain && len(cf.Regions) > 0 {
+		cf = &ccx.CaptionFrame{PTS: cf.PTS, Channel: cf.Channel, Text: cf.PlainText()}
+	}
+	return cf.Serialize()
+}
+
+// DecodeCaption decodes a captions track object in either layout
+// described at CaptionCodec. The frame's PTS is left zero, as it is
+// carried by the object's timestamp rather than its payload.
+func DecodeCaption(data []byte) (*ccx.CaptionFrame, error) {
+	switch {
+	case len(data) == 0:
+		return nil, errors.New("empty caption object")
+	case len(data) == 1:
+		// A plain clear: the channel alone.
+		return &ccx.CaptionFrame{Channel: int(data[0])}, nil
+	case len(data) >= 3 && bytes.Equal(data[:2], styledCaptionHeader[:2]) && data[2] != CaptionFormatVersion:
+		return nil, fmt.Errorf("%w %d", ErrCaptionVersion, data[2])
+	}
+	frame := ccx.DeserializeCaptionFrame(data)
+	if frame == nil {
+		return nil, errors.New("malformed caption object")
+	}
+	return frame, nil
+}
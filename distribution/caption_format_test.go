@@ -0,0 +1,140 @@
+package distribution
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/zsiec/ccx"
+	"github.com/zsiec/prism/media"
+)
+
+// styledCaption is a CEA-708 update with two windows: a bottom-centred
+// one with mixed pen styles over two rows, and a top-left one on a
+// translucent fill.
+func styledCaption() *ccx.CaptionFrame {
+	return &ccx.CaptionFrame{
+		Channel: 7,
+		Regions: []ccx.CaptionRegion{
+			{
+				ID: 0, Justify: 2, WordWrap: true, Priority: 1,
+				FillColor: "000000", BorderColor: "000000",
+				AnchorV: 74, AnchorH: 50, AnchorID: 7, RelativeToggle: true,
+				Rows: []ccx.CaptionRow{
+					{Row: 0, Spans: []ccx.CaptionSpan{
+						{Text: "Who's ", FgColor: "ffffff", BgColor: "000000", PenSize: 1, EdgeColor: "000000"},
+						{Text: "there?", FgColor: "ffff00", BgColor: "000000", Italic: true, PenSize: 1, FontTag: 4, EdgeType: 4, EdgeColor: "555555"},
+					}},
+					{Row: 1, Spans: []ccx.CaptionSpan{
+						{Text: "[door creaks]", FgColor: "00ffff", BgColor: "0000ff", BgOpacity: 2, Underline: true, PenSize: 2, Offset: 2, EdgeColor: "000000"},
+					}},
+				},
+			},
+			{
+				ID: 3, ScrollDirection: 3, PrintDirection: 1, FillOpacity: 2, BorderType: 1,
+				FillColor: "aa0000", BorderColor: "ffffff", Priority: 5,
+				Rows: []ccx.CaptionRow{
+					{Row: 0, Spans: []ccx.CaptionSpan{
+						{Text: "LIVE", FgColor: "ff0000", BgColor: "000000", FgOpacity: 1, Flash: true, PenSize: 0, FontTag: 1, Offset: 1, EdgeType: 1, EdgeColor: "ffffff"},
+					}},
+				},
+			},
+		},
+	}
+}
+
+func TestCaptionFormatRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		frame *ccx.CaptionFrame
+		plain bool
+		want  *ccx.CaptionFrame
+	}{
+		{
+			name:  "styled regions",
+			frame: styledCaption(),
+			want:  styledCaption(),
+		},
+		{
+			name:  "plain captions",
+			frame: styledCaption(),
+			plain: true,
+			want:  &ccx.CaptionFrame{Channel: 7, Text: "Who's there?\n[door creaks]\nLIVE"},
+		},
+		{
+			name:  "text only",
+			frame: &ccx.CaptionFrame{Channel: 1, Text: "HELLO\nWORLD"},
+			want:  &ccx.CaptionFrame{Channel: 1, Text: "HELLO\nWORLD"},
+		},
+		{
+			name:  "clear",
+			frame: &ccx.CaptionFrame{Channel: 3},
+			want:  &ccx.CaptionFrame{Channel: 3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			frame := &media.CaptionFrame{PTS: 90_000_000, Text: tt.frame.Text, Channel: tt.frame.Channel, Regions: tt.frame.Regions}
+			data := encodeCaption(frame, tt.plain)
+			if styled := len(data) >= 3 && data[0] == 0xCC && data[1] == 0x02; styled != (len(tt.want.Regions) > 0) {
+				t.Fatalf("styled = %v for % x", styled, data)
+			}
+			if len(tt.want.Regions) > 0 && data[2] != CaptionFormatVersion {
+				t.Errorf("version = %d, want %d", data[2], CaptionFormatVersion)
+			}
+
+			got, err := DecodeCaption(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DecodeCaption =\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStyledCaptionHeader(t *testing.T) {
+	t.Parallel()
+
+	// The web viewer (web/src/protocol.ts) checks for this header, so a
+	// ccx upgrade that changes it must update the viewer too.
+	if want := []byte{0xCC, 0x02, 2}; !bytes.Equal(styledCaptionHeader, want) {
+		t.Errorf("styled caption header = % x, want % x", styledCaptionHeader, want)
+	}
+}
+
+func TestDecodeCaptionErrors(t *testing.T) {
+	t.Parallel()
+
+	future := styledCaption().Serialize()
+	future[2] = CaptionFormatVersion + 1
+
+	tests := []struct {
+		name    string
+		data    []byte
+		version bool
+	}{
+		{name: "empty"},
+		{name: "future version", data: future, version: true},
+		{name: "truncated header", data: []byte{0xCC, 0x02, CaptionFormatVersion, 7}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			frame, err := DecodeCaption(tt.data)
+			if err == nil {
+				t.Fatalf("DecodeCaption = %+v, want error", frame)
+			}
+			if got := errors.Is(err, ErrCaptionVersion); got != tt.version {
+				t.Errorf("errors.Is(%v, ErrCaptionVersion) = %v, want %v", err, got, tt.version)
+			}
+		})
+	}
+}
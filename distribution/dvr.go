@@ -0,0 +1,108 @@
+package distribution
+
+import (
+	"time"
+
+	"github.com/zsiec/prism/media"
+)
+
+// dvrMaxBytes caps the wire bytes held by a DVR buffer regardless of the
+// configured window, so a high-bitrate stream cannot exhaust memory.
+const dvrMaxBytes = 256 << 20
+
+// dvrGroup is one cached GOP: a keyframe followed by its delta frames.
+type dvrGroup struct {
+	id       uint32
+	startPTS int64 // microseconds, PTS of the keyframe
+	frames   []*media.VideoFrame
+	bytes    int
+}
+
+// dvrBuffer is a memory-backed time-shift window of complete video GOPs,
+// keyed by MoQ group ID. Groups older than the window (measured from the
+// newest frame) or beyond the byte cap are discarded oldest-first; the
+// group currently being written is always retained. Not safe for
+// concurrent use; the Relay guards it with gopMu.
+type dvrBuffer struct {
+	window   time.Duration
+	maxBytes int
+	groups   []dvrGroup
+	bytes    int
+}
+
+func newDVRBuffer(window time.Duration, maxBytes int) *dvrBuffer {
+	return &dvrBuffer{window: window, maxBytes: maxBytes}
+}
+
+// add appends a frame, retaining it until it is evicted. A keyframe opens
+// a new group; delta frames join the current group if their GroupID
+// matches and are dropped otherwise, since they would be undecodable
+// without their keyframe.
+func (b *dvrBuffer) add(frame *media.VideoFrame) {
+	size := len(frame.WireData)
+	if frame.IsKeyframe {
+		b.groups = append(b.groups, dvrGroup{
+			id:       frame.GroupID,
+			startPTS: frame.PTS,
+		})
+	} else if len(b.groups) == 0 || b.groups[len(b.groups)-1].id != frame.GroupID {
+		return
+	}
+	frame.Retain()
+	g := &b.groups[len(b.groups)-1]
+	g.frames = append(g.frames, frame)
+	g.bytes += size
+	b.bytes += size
+	b.trim(frame.PTS)
+}
+
+// trim evicts the oldest groups that fall outside the window relative to
+// newestPTS or push the buffer past its byte cap.
+func (b *dvrBuffer) trim(newestPTS int64) {
+	windowUS := b.window.Microseconds()
+	drop := 0
+	for drop < len(b.groups)-1 {
+		g := b.groups[drop]
+		if newestPTS-g.startPTS <= windowUS && b.bytes <= b.maxBytes {
+			break
+		}
+		b.bytes -= g.bytes
+		media.ReleaseVideo(g.frames)
+		drop++
+	}
+	if drop > 0 {
+		clear(b.groups[:drop])
+		b.groups = b.groups[drop:]
+	}
+}
+
+// reset releases every cached frame and empties the buffer.
+func (b *dvrBuffer) reset() {
+	for _, g := range b.groups {
+		media.ReleaseVideo(g.frames)
+	}
+	b.groups = nil
+	b.bytes = 0
+}
+
+// bounds returns the oldest and newest group IDs held, or ok=false if the
+// buffer is empty.
+func (b *dvrBuffer) bounds() (oldest, newest uint32, ok bool) {
+	if len(b.groups) == 0 {
+		return 0, 0, false
+	}
+	return b.groups[0].id, b.groups[len(b.groups)-1].id, true
+}
+
+// frames returns every cached frame in groups start through end inclusive,
+// in decode order.
+func (b *dvrBuffer) frames(start, end uint32) []*media.VideoFrame {
+	var out []*media.VideoFrame
+	for _, g := range b.groups {
+		if g.id < start || g.id > end {
+			continue
+		}
+		out = append(out, g.frames...)
+	}
+	return out
+}
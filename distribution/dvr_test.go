@@ -0,0 +1,86 @@
+package distribution
+
+import (
+	"testing"
+	"time"
+
+	"github.com/zsiec/prism/media"
+)
+
+// dvrFrame builds a video frame at ptsMS milliseconds with size wire bytes.
+func dvrFrame(group uint32, key bool, ptsMS int64, size int) *media.VideoFrame {
+	return &media.VideoFrame{
+		PTS:        ptsMS * 1000,
+		DTS:        ptsMS * 1000,
+		IsKeyframe: key,
+		GroupID:    group,
+		WireData:   make([]byte, size),
+	}
+}
+
+func TestDVRBufferTrimsByWindow(t *testing.T) {
+	t.Parallel()
+	b := newDVRBuffer(2*time.Second, dvrMaxBytes)
+
+	// One GOP per second, two frames each.
+	for g := uint32(1); g <= 5; g++ {
+		base := int64(g) * 1000
+		b.add(dvrFrame(g, true, base, 10))
+		b.add(dvrFrame(g, false, base+500, 10))
+	}
+
+	oldest, newest, ok := b.bounds()
+	if !ok {
+		t.Fatal("bounds: buffer unexpectedly empty")
+	}
+	// Newest frame is at 5.5s; groups starting before 3.5s fall out.
+	if oldest != 4 || newest != 5 {
+		t.Errorf("bounds = (%d, %d), want (4, 5)", oldest, newest)
+	}
+	if b.bytes != 40 {
+		t.Errorf("bytes = %d, want 40", b.bytes)
+	}
+}
+
+func TestDVRBufferTrimsByBytes(t *testing.T) {
+	t.Parallel()
+	b := newDVRBuffer(time.Hour, 25)
+
+	for g := uint32(1); g <= 4; g++ {
+		b.add(dvrFrame(g, true, int64(g)*1000, 10))
+	}
+
+	oldest, newest, _ := b.bounds()
+	if oldest != 3 || newest != 4 {
+		t.Errorf("bounds = (%d, %d), want (3, 4)", oldest, newest)
+	}
+}
+
+func TestDVRBufferKeepsCurrentGroup(t *testing.T) {
+	t.Parallel()
+	b := newDVRBuffer(time.Second, 5)
+
+	b.add(dvrFrame(1, true, 0, 10))
+	b.add(dvrFrame(1, false, 5000, 10))
+
+	oldest, newest, ok := b.bounds()
+	if !ok || oldest != 1 || newest != 1 {
+		t.Errorf("bounds = (%d, %d, %v), want (1, 1, true)", oldest, newest, ok)
+	}
+}
+
+func TestDVRBufferDropsOrphanDeltas(t *testing.T) {
+	t.Parallel()
+	b := newDVRBuffer(time.Minute, dvrMaxBytes)
+
+	b.add(dvrFrame(1, false, 0, 10))
+	if _, _, ok := b.bounds(); ok {
+		t.Fatal("delta frame without a keyframe should not open a group")
+	}
+
+	b.add(dvrFrame(2, true, 100, 10))
+	b.add(dvrFrame(1, false, 200, 10))
+	if got := len(b.frames(0, 10)); got != 1 {
+		t.Errorf("frames = %d, want 1 (mismatched delta dropped)", got)
+	}
+}
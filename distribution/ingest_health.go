@@ -0,0 +1,188 @@
+package distribution
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Ingest health values reported in StreamSnapshot.IngestHealth. The field
+// is empty when no thresholds are configured for the stream.
+const (
+	IngestHealthOK   = "ok"
+	IngestHealthLow  = "low"
+	IngestHealthHigh = "high"
+)
+
+// ingestSmoothingTau is the time constant of the exponential moving average
+// applied to the ingest bitrate. Five seconds rides out GOP-sized bursts
+// while still reacting to a feed that genuinely drops.
+const ingestSmoothingTau = 5 * time.Second
+
+// ingestMinSampleInterval is the shortest interval between bitrate samples.
+// Closer samples reuse the previous result instead of feeding noise into
+// the average.
+const ingestMinSampleInterval = 250 * time.Millisecond
+
+// IngestSampleInterval is how often the owner of an IngestRateMonitor should
+// call Sample. Sampling on a fixed cadence keeps health and breach counts
+// current for streams nobody is watching or polling.
+const IngestSampleInterval = 1 * time.Second
+
+// Errors returned by IngestThresholds.Validate.
+var (
+	errNegativeThreshold = errors.New("distribution: ingest thresholds must not be negative")
+	errInvertedThreshold = errors.New("distribution: ingest low threshold must be below high threshold")
+)
+
+// IngestThresholds configures the expected ingest bitrate range for a
+// stream. A zero bound disables that side of the check.
+type IngestThresholds struct {
+	LowKbps  float64
+	HighKbps float64
+}
+
+// Enabled reports whether either bound is set.
+func (th IngestThresholds) Enabled() bool {
+	return th.LowKbps > 0 || th.HighKbps > 0
+}
+
+// Validate rejects negative bounds and a low bound at or above a non-zero
+// high bound, either of which would misclassify every rate.
+func (th IngestThresholds) Validate() error {
+	if th.LowKbps < 0 || th.HighKbps < 0 {
+		return errNegativeThreshold
+	}
+	if th.LowKbps > 0 && th.HighKbps > 0 && th.LowKbps >= th.HighKbps {
+		return errInvertedThreshold
+	}
+	return nil
+}
+
+// IngestRateMonitor tracks bytes received from an ingest source and derives
+// a smoothed bitrate and health classification against configurable
+// thresholds. Record is safe to call from the ingest goroutine while Sample
+// runs on the owner's ticker and Current is called from stats snapshots.
+type IngestRateMonitor struct {
+	bytes atomic.Int64
+
+	mu           sync.Mutex
+	thresholds   IngestThresholds
+	lastSample   time.Time
+	lastBytes    int64
+	smoothedKbps float64
+	sampled      bool
+	health       string
+	breaches     int64
+}
+
+// NewIngestRateMonitor creates a monitor with no thresholds configured.
+func NewIngestRateMonitor() *IngestRateMonitor {
+	return &IngestRateMonitor{
+		lastSample: time.Now(),
+	}
+}
+
+// SetThresholds replaces the low/high bitrate thresholds. Invalid
+// thresholds are rejected and the previous ones are kept.
+func (m *IngestRateMonitor) SetThresholds(th IngestThresholds) error {
+	if err := th.Validate(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.thresholds = th
+	if m.sampled {
+		m.health = m.classify(m.smoothedKbps)
+	} else if th.Enabled() {
+		m.health = IngestHealthOK
+	} else {
+		m.health = ""
+	}
+	m.mu.Unlock()
+	return nil
+}
+
+// Record adds n bytes to the ingest byte counter.
+func (m *IngestRateMonitor) Record(n int) {
+	m.bytes.Add(int64(n))
+}
+
+// IngestRateSample is a point-in-time view of ingest throughput and health.
+type IngestRateSample struct {
+	Bytes    int64
+	Kbps     float64
+	Health   string
+	Breaches int64
+}
+
+// Sample updates the smoothed bitrate with bytes received since the last
+// sample and returns the current totals. Breaches counts transitions from
+// ok into low or high, so a feed that stays out of range counts once.
+// Call it every IngestSampleInterval; a long gap between samples folds
+// the whole gap into a single averaging step.
+func (m *IngestRateMonitor) Sample(now time.Time) IngestRateSample {
+	total := m.bytes.Load()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dt := now.Sub(m.lastSample)
+	if dt >= ingestMinSampleInterval {
+		kbps := float64(total-m.lastBytes) * 8 / dt.Seconds() / 1000
+		if !m.sampled {
+			m.smoothedKbps = kbps
+			m.sampled = true
+		} else {
+			alpha := 1 - math.Exp(-dt.Seconds()/ingestSmoothingTau.Seconds())
+			m.smoothedKbps += alpha * (kbps - m.smoothedKbps)
+		}
+		m.lastSample = now
+		m.lastBytes = total
+
+		health := m.classify(m.smoothedKbps)
+		if isBreach(health) && !isBreach(m.health) {
+			m.breaches++
+		}
+		m.health = health
+	}
+
+	return m.currentLocked(total)
+}
+
+// Current returns the latest sampled values without advancing the average.
+// Bytes is always the live total.
+func (m *IngestRateMonitor) Current() IngestRateSample {
+	total := m.bytes.Load()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.currentLocked(total)
+}
+
+func (m *IngestRateMonitor) currentLocked(total int64) IngestRateSample {
+	return IngestRateSample{
+		Bytes:    total,
+		Kbps:     m.smoothedKbps,
+		Health:   m.health,
+		Breaches: m.breaches,
+	}
+}
+
+func isBreach(health string) bool {
+	return health == IngestHealthLow || health == IngestHealthHigh
+}
+
+func (m *IngestRateMonitor) classify(kbps float64) string {
+	switch {
+	case !m.thresholds.Enabled():
+		return ""
+	case m.thresholds.LowKbps > 0 && kbps < m.thresholds.LowKbps:
+		return IngestHealthLow
+	case m.thresholds.HighKbps > 0 && kbps > m.thresholds.HighKbps:
+		return IngestHealthHigh
+	default:
+		return IngestHealthOK
+	}
+}
@@ -0,0 +1,178 @@
+package distribution
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestIngestRateMonitorKbps(t *testing.T) {
+	t.Parallel()
+
+	m := NewIngestRateMonitor()
+	start := m.lastSample
+
+	// 125 KB in one second = 1000 kbps.
+	m.Record(125_000)
+	s := m.Sample(start.Add(time.Second))
+	if s.Bytes != 125_000 {
+		t.Errorf("Bytes = %d, want 125000", s.Bytes)
+	}
+	if math.Abs(s.Kbps-1000) > 0.01 {
+		t.Errorf("Kbps = %.2f, want 1000", s.Kbps)
+	}
+	if s.Health != "" {
+		t.Errorf("Health = %q, want empty without thresholds", s.Health)
+	}
+
+	// A second of silence pulls the average down but not to zero.
+	s = m.Sample(start.Add(2 * time.Second))
+	if s.Kbps <= 0 || s.Kbps >= 1000 {
+		t.Errorf("smoothed Kbps = %.2f, want between 0 and 1000", s.Kbps)
+	}
+}
+
+func TestIngestRateMonitorShortIntervalReusesSample(t *testing.T) {
+	t.Parallel()
+
+	m := NewIngestRateMonitor()
+	start := m.lastSample
+
+	m.Record(125_000)
+	first := m.Sample(start.Add(time.Second))
+
+	m.Record(1_000_000)
+	second := m.Sample(start.Add(time.Second + 10*time.Millisecond))
+	if second.Kbps != first.Kbps {
+		t.Errorf("Kbps changed within min interval: %.2f -> %.2f", first.Kbps, second.Kbps)
+	}
+	if second.Bytes != 1_125_000 {
+		t.Errorf("Bytes = %d, want running total 1125000", second.Bytes)
+	}
+}
+
+func TestIngestRateMonitorHealthAndBreaches(t *testing.T) {
+	t.Parallel()
+
+	m := NewIngestRateMonitor()
+	if err := m.SetThresholds(IngestThresholds{LowKbps: 500, HighKbps: 2000}); err != nil {
+		t.Fatalf("SetThresholds: %v", err)
+	}
+	if h := m.Current().Health; h != IngestHealthOK {
+		t.Fatalf("configured, unsampled health = %q, want ok", h)
+	}
+	now := m.lastSample
+
+	step := func(bytes int) IngestRateSample {
+		now = now.Add(time.Second)
+		m.Record(bytes)
+		return m.Sample(now)
+	}
+
+	if s := step(125_000); s.Health != IngestHealthOK || s.Breaches != 0 {
+		t.Fatalf("1000 kbps: health=%q breaches=%d, want ok/0", s.Health, s.Breaches)
+	}
+
+	// Drop to nothing until the smoothed rate falls below the low bound.
+	var s IngestRateSample
+	for i := 0; i < 10; i++ {
+		s = step(0)
+	}
+	if s.Health != IngestHealthLow {
+		t.Fatalf("after outage: health=%q, want %q", s.Health, IngestHealthLow)
+	}
+	if s.Breaches != 1 {
+		t.Fatalf("staying low should count one breach, got %d", s.Breaches)
+	}
+
+	// Burst well above the high bound.
+	for i := 0; i < 20; i++ {
+		s = step(1_000_000)
+	}
+	if s.Health != IngestHealthHigh {
+		t.Fatalf("after burst: health=%q, want %q", s.Health, IngestHealthHigh)
+	}
+	// The smoothed rate climbs back through the ok band on its way up,
+	// so the high excursion is a separate breach.
+	if s.Breaches != 2 {
+		t.Fatalf("breaches = %d, want 2", s.Breaches)
+	}
+
+	for i := 0; i < 20; i++ {
+		s = step(125_000)
+	}
+	if s.Health != IngestHealthOK {
+		t.Fatalf("after recovery: health=%q, want ok", s.Health)
+	}
+	for i := 0; i < 20; i++ {
+		s = step(0)
+	}
+	if s.Breaches != 3 {
+		t.Fatalf("third excursion: breaches = %d, want 3", s.Breaches)
+	}
+}
+
+func TestIngestThresholdsValidate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		th      IngestThresholds
+		wantErr bool
+	}{
+		{"unset", IngestThresholds{}, false},
+		{"low only", IngestThresholds{LowKbps: 500}, false},
+		{"high only", IngestThresholds{HighKbps: 2000}, false},
+		{"both", IngestThresholds{LowKbps: 500, HighKbps: 2000}, false},
+		{"inverted", IngestThresholds{LowKbps: 5000, HighKbps: 1000}, true},
+		{"equal", IngestThresholds{LowKbps: 1000, HighKbps: 1000}, true},
+		{"negative low", IngestThresholds{LowKbps: -1}, true},
+		{"negative high", IngestThresholds{HighKbps: -1}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			err := tt.th.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestIngestRateMonitorRejectsInvalidThresholds(t *testing.T) {
+	t.Parallel()
+
+	m := NewIngestRateMonitor()
+	if err := m.SetThresholds(IngestThresholds{LowKbps: 500, HighKbps: 2000}); err != nil {
+		t.Fatalf("SetThresholds: %v", err)
+	}
+	if err := m.SetThresholds(IngestThresholds{LowKbps: 5000, HighKbps: 1000}); err == nil {
+		t.Fatal("SetThresholds accepted low >= high")
+	}
+
+	// The previous, valid range is kept: 1000 kbps is within it.
+	m.Record(125_000)
+	if s := m.Sample(m.lastSample.Add(time.Second)); s.Health != IngestHealthOK {
+		t.Errorf("Health = %q, want ok under the retained thresholds", s.Health)
+	}
+}
+
+func TestIngestRateMonitorCurrentDoesNotAdvance(t *testing.T) {
+	t.Parallel()
+
+	m := NewIngestRateMonitor()
+	start := m.lastSample
+
+	m.Record(125_000)
+	first := m.Sample(start.Add(time.Second))
+
+	m.Record(500)
+	cur := m.Current()
+	if cur.Kbps != first.Kbps {
+		t.Errorf("Current changed Kbps: %.2f -> %.2f", first.Kbps, cur.Kbps)
+	}
+	if cur.Bytes != 125_500 {
+		t.Errorf("Current Bytes = %d, want live total 125500", cur.Bytes)
+	}
+}
@@ -0,0 +1,172 @@
+package distribution
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/zsiec/prism/moq"
+)
+
+// announceSub is a session's SUBSCRIBE_ANNOUNCES subscription.
+type announceSub struct {
+	requestID uint64
+	prefix    []string
+	cancel    context.CancelFunc
+}
+
+// streamChange is a stream starting (active) or ending.
+type streamChange struct {
+	key    string
+	active bool
+}
+
+// announceQueue buffers stream changes between the server, which reports
+// them without blocking, and the goroutine that writes them to the
+// client.
+type announceQueue struct {
+	mu      sync.Mutex
+	changes []streamChange
+	ready   chan struct{} // signalled when changes is non-empty
+}
+
+func newAnnounceQueue() *announceQueue {
+	return &announceQueue{ready: make(chan struct{}, 1)}
+}
+
+func (q *announceQueue) push(key string, active bool) {
+	q.mu.Lock()
+	q.changes = append(q.changes, streamChange{key: key, active: active})
+	q.mu.Unlock()
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+func (q *announceQueue) drain() []streamChange {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	changes := q.changes
+	q.changes = nil
+	return changes
+}
+
+// handleSubscribeAnnounces lets the client discover streams: it accepts a
+// prefix of ["prism", streamKey], announces each matching active stream as
+// ["prism", key], and then announces and unannounces streams as they start
+// and end until the subscription is cancelled. A session holds at most one
+// such subscription.
+func (m *MoQSession) handleSubscribeAnnounces(ctx context.Context, sa moq.SubscribeAnnounces) {
+	if !m.admitRequest(sa.RequestID) {
+		m.sendSubscribeAnnouncesError(sa.RequestID, moq.SubscribeErrorTooManyRequests, moq.ErrTooManyRequests.Error())
+		return
+	}
+	if m.watchStreams == nil {
+		m.sendSubscribeAnnouncesError(sa.RequestID, moq.SubscribeErrorNotSupported, "stream discovery not supported")
+		return
+	}
+	if len(sa.Prefix) > 2 || len(sa.Prefix) > 0 && sa.Prefix[0] != "prism" {
+		m.sendSubscribeAnnouncesError(sa.RequestID, moq.SubscribeErrorTrackDoesNotExist, moq.ErrUnknownNamespace.Error())
+		return
+	}
+
+	m.mu.Lock()
+	if m.announces != nil {
+		m.mu.Unlock()
+		m.sendSubscribeAnnouncesError(sa.RequestID, moq.SubscribeErrorNotSupported, "already subscribed to announces")
+		return
+	}
+	subCtx, cancel := context.WithCancel(ctx)
+	m.announces = &announceSub{requestID: sa.RequestID, prefix: sa.Prefix, cancel: cancel}
+	m.mu.Unlock()
+
+	q := newAnnounceQueue()
+	active, stop := m.watchStreams(q.push)
+
+	m.controlMu.Lock()
+	err := moq.WriteControlMsg(m.control, moq.MsgSubscribeAnnouncesOK, moq.SerializeSubscribeAnnouncesOK(sa.RequestID))
+	m.controlMu.Unlock()
+	if err != nil {
+		m.log.Warn("write SUBSCRIBE_ANNOUNCES_OK failed", "error", err)
+		stop()
+		m.handleUnsubscribeAnnounces(moq.UnsubscribeAnnounces{Prefix: sa.Prefix})
+		return
+	}
+
+	m.log.Debug("announces subscribed", "prefix", sa.Prefix, "requestID", sa.RequestID)
+	go m.writeAnnounceLoop(subCtx, sa.Prefix, active, q, stop)
+}
+
+// writeAnnounceLoop announces the streams active when the subscription
+// started, then each later change, until ctx is done.
+func (m *MoQSession) writeAnnounceLoop(ctx context.Context, prefix, active []string, q *announceQueue, stop func()) {
+	defer stop()
+
+	matches := func(key string) bool { return len(prefix) < 2 || prefix[1] == key }
+	for _, key := range active {
+		if matches(key) && !m.writeAnnounce(key, true) {
+			return
+		}
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.ready:
+			for _, c := range q.drain() {
+				if matches(c.key) && !m.writeAnnounce(c.key, c.active) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// writeAnnounce sends ANNOUNCE for a stream that started or UNANNOUNCE for
+// one that ended, reporting whether the write succeeded.
+func (m *MoQSession) writeAnnounce(key string, active bool) bool {
+	namespace := []string{"prism", key}
+	msgType, payload := moq.MsgUnannounce, moq.SerializeUnannounce(namespace)
+	if active {
+		reqID := 2*m.nextRequestID.Add(1) - 1
+		msgType, payload = moq.MsgAnnounce, moq.SerializeAnnounce(moq.Announce{RequestID: reqID, Namespace: namespace})
+	}
+
+	m.controlMu.Lock()
+	err := moq.WriteControlMsg(m.control, msgType, payload)
+	m.controlMu.Unlock()
+	if err != nil {
+		m.log.Debug("write announce failed", "stream", key, "error", err)
+		return false
+	}
+	return true
+}
+
+// handleUnsubscribeAnnounces cancels the announces subscription for the
+// given prefix, if there is one.
+func (m *MoQSession) handleUnsubscribeAnnounces(ua moq.UnsubscribeAnnounces) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.announces == nil || !slices.Equal(m.announces.prefix, ua.Prefix) {
+		return
+	}
+	m.announces.cancel()
+	m.announces = nil
+	m.log.Debug("announces unsubscribed", "prefix", ua.Prefix)
+}
+
+// sendSubscribeAnnouncesError sends a SUBSCRIBE_ANNOUNCES_ERROR on the
+// control stream.
+func (m *MoQSession) sendSubscribeAnnouncesError(requestID uint64, errorCode moq.SubscribeErrorCode, reason string) {
+	se := moq.SubscribeAnnouncesError{
+		RequestID:    requestID,
+		ErrorCode:    errorCode,
+		ReasonPhrase: reason,
+	}
+	m.controlMu.Lock()
+	defer m.controlMu.Unlock()
+	if err := moq.WriteControlMsg(m.control, moq.MsgSubscribeAnnouncesError, moq.SerializeSubscribeAnnouncesError(se)); err != nil {
+		m.log.Warn("write SUBSCRIBE_ANNOUNCES_ERROR failed", "error", err)
+	}
+}
@@ -2,12 +2,13 @@ package distribution
 
 import (
 	"context"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 
 	"github.com/quic-go/quic-go/quicvarint"
-	"github.com/zsiec/prism/webtransport"
 )
 
 // moqCatalog is the top-level catalog structure per draft-ietf-moq-catalogformat-01.
@@ -15,6 +16,7 @@ type moqCatalog struct {
 	Version                int               `json:"version"`
 	StreamingFormat        int               `json:"streamingFormat"`
 	StreamingFormatVersion string            `json:"streamingFormatVersion"`
+	Sequence               uint64            `json:"sequence"`
 	CommonTrackFields      moqCommonFields   `json:"commonTrackFields"`
 	Tracks                 []moqCatalogTrack `json:"tracks"`
 }
@@ -39,43 +41,62 @@ type moqSelectionParams struct {
 	InitData      string `json:"initData,omitempty"`
 	SampleRate    int    `json:"samplerate,omitempty"`
 	ChannelConfig string `json:"channelConfig,omitempty"`
+
+	// ConfigHash identifies InitData's video decoder configuration, so a
+	// client can skip reconfiguring its decoder when a refreshed catalog
+	// carries the same parameter sets.
+	ConfigHash string `json:"configHash,omitempty"`
 }
 
-// buildMoQCatalog assembles the catalog JSON for a stream.
-func buildMoQCatalog(streamKey string, relay *Relay) ([]byte, error) {
+// buildMoQCatalog assembles the catalog JSON for a stream. seq is the
+// relay's catalog sequence the content reflects; it increases whenever the
+// advertised tracks or their parameters change, so clients can tell a
+// refreshed catalog from a repeat. With deferVideo set, the video track is
+// left out until its real parameters are known rather than advertised
+// with placeholder ones; the relay bumps the sequence when they arrive.
+func buildMoQCatalog(streamKey string, relay *Relay, seq uint64, deferVideo bool) ([]byte, error) {
 	vi := relay.VideoInfo()
-	ai := relay.AudioInfo()
 
 	catalog := moqCatalog{
 		Version:                1,
 		StreamingFormat:        1,
 		StreamingFormatVersion: "0.2",
+		Sequence:               seq,
 		CommonTrackFields: moqCommonFields{
 			Namespace: fmt.Sprintf("prism/%s", streamKey),
 			Packaging: "loc",
 		},
 	}
 
-	// Video track
-	videoParams := moqSelectionParams{
-		Codec:  vi.Codec,
-		Width:  vi.Width,
-		Height: vi.Height,
-	}
-	if len(vi.DecoderConfig) > 0 {
-		videoParams.InitData = base64.StdEncoding.EncodeToString(vi.DecoderConfig)
+	// Video track, omitted for audio-only streams
+	if relay.HasVideo() && (!deferVideo || relay.HasVideoInfo()) {
+		videoParams := moqSelectionParams{
+			Codec:  vi.Codec,
+			Width:  vi.Width,
+			Height: vi.Height,
+		}
+		if len(vi.DecoderConfig) > 0 {
+			videoParams.InitData = base64.StdEncoding.EncodeToString(vi.DecoderConfig)
+			videoParams.ConfigHash = decoderConfigHash(vi.DecoderConfig)
+		}
+		catalog.Tracks = append(catalog.Tracks, moqCatalogTrack{
+			Name:            "video",
+			SelectionParams: videoParams,
+		})
 	}
-	catalog.Tracks = append(catalog.Tracks, moqCatalogTrack{
-		Name:            "video",
-		SelectionParams: videoParams,
-	})
 
-	// Audio tracks
+	// Audio tracks, each described by its own codec parameters
 	for i := 0; i < relay.AudioTrackCount(); i++ {
+		ai := relay.AudioInfo(i)
+		var audioInit string
+		if len(ai.Config) > 0 {
+			audioInit = base64.StdEncoding.EncodeToString(ai.Config)
+		}
 		catalog.Tracks = append(catalog.Tracks, moqCatalogTrack{
 			Name: fmt.Sprintf("audio%d", i),
 			SelectionParams: moqSelectionParams{
 				Codec:         ai.Codec,
+				InitData:      audioInit,
 				SampleRate:    ai.SampleRate,
 				ChannelConfig: fmt.Sprintf("%d", ai.Channels),
 			},
@@ -86,10 +107,21 @@ func buildMoQCatalog(streamKey string, relay *Relay) ([]byte, error) {
 	catalog.Tracks = append(catalog.Tracks, moqCatalogTrack{
 		Name: "captions",
 		SelectionParams: moqSelectionParams{
-			Codec: "caption/v2",
+			Codec: CaptionCodec,
 		},
 	})
 
+	// SCTE-35 track, advertised once the stream has carried a cue. Each
+	// object is a demux.SCTE35Event as JSON, including the raw section.
+	if relay.HasSCTE35() {
+		catalog.Tracks = append(catalog.Tracks, moqCatalogTrack{
+			Name: "scte35",
+			SelectionParams: moqSelectionParams{
+				Codec: "application/json",
+			},
+		})
+	}
+
 	// Stats track (server-side stream stats delivered as JSON)
 	catalog.Tracks = append(catalog.Tracks, moqCatalogTrack{
 		Name: "stats",
@@ -101,19 +133,29 @@ func buildMoQCatalog(streamKey string, relay *Relay) ([]byte, error) {
 	return json.Marshal(catalog)
 }
 
+// decoderConfigHash returns a short, stable hash of a decoder
+// configuration record: the first 8 bytes of its SHA-256, in hex. The
+// record holds the stream's parameter sets, so the hash changes exactly
+// when they do.
+func decoderConfigHash(config []byte) string {
+	sum := sha256.Sum256(config)
+	return hex.EncodeToString(sum[:8])
+}
+
 // writeCatalogObject opens a uni-stream and writes the catalog as a single
-// MoQ object (subgroup header + object with payload).
-func writeCatalogObject(ctx context.Context, session *webtransport.Session, catalogAlias uint64, catalogJSON []byte) error {
+// MoQ object (subgroup header + object with payload) in the given group.
+// Each catalog revision is sent as a new group.
+func writeCatalogObject(ctx context.Context, session uniStreamOpener, catalogAlias, groupID uint64, catalogJSON []byte) error {
 	stream, err := session.OpenUniStreamSync(ctx)
 	if err != nil {
 		return fmt.Errorf("open catalog stream: %w", err)
 	}
 
-	// Subgroup header: stream_type, track_alias, group_id=0, subgroup_id=0, publisher_priority=192
+	// Subgroup header: stream_type, track_alias, group_id, subgroup_id=0, publisher_priority=192
 	var hdr []byte
 	hdr = quicvarint.Append(hdr, moqStreamTypeSubgroupSIDExt)
 	hdr = quicvarint.Append(hdr, catalogAlias)
-	hdr = quicvarint.Append(hdr, 0) // group ID
+	hdr = quicvarint.Append(hdr, groupID)
 	hdr = quicvarint.Append(hdr, 0) // subgroup ID
 	hdr = append(hdr, 192)          // publisher priority (low for catalog)
 
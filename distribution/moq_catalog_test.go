@@ -3,12 +3,104 @@ package distribution
 import (
 	"encoding/json"
 	"testing"
+
+	"github.com/zsiec/prism/demux"
+	"github.com/zsiec/prism/moq"
 )
 
+func TestBuildMoQCatalogSCTE35Track(t *testing.T) {
+	t.Parallel()
+	relay := NewRelay()
+
+	hasTrack := func() bool {
+		data, err := buildMoQCatalog("teststream", relay, 0, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var cat moqCatalog
+		if err := json.Unmarshal(data, &cat); err != nil {
+			t.Fatal(err)
+		}
+		for _, tr := range cat.Tracks {
+			if tr.Name == "scte35" {
+				if tr.SelectionParams.Codec != "application/json" {
+					t.Errorf("scte35 codec = %q", tr.SelectionParams.Codec)
+				}
+				return true
+			}
+		}
+		return false
+	}
+
+	if hasTrack() {
+		t.Fatal("scte35 track advertised before any cue")
+	}
+	relay.BroadcastSCTE35(&demux.SCTE35Event{CommandType: "splice_insert"})
+	if !hasTrack() {
+		t.Fatal("scte35 track not advertised after a cue")
+	}
+}
+
+func TestBuildMoQCatalogAudioOnly(t *testing.T) {
+	t.Parallel()
+	relay := NewRelay()
+	relay.SetHasVideo(false)
+
+	data, err := buildMoQCatalog("radio", relay, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cat moqCatalog
+	if err := json.Unmarshal(data, &cat); err != nil {
+		t.Fatal(err)
+	}
+	for _, tr := range cat.Tracks {
+		if tr.Name == "video" {
+			t.Fatal("audio-only catalog advertises a video track")
+		}
+	}
+	if len(cat.Tracks) == 0 || cat.Tracks[0].Name != "audio0" {
+		t.Fatalf("tracks[0] = %+v, want audio0 first", cat.Tracks)
+	}
+}
+
+func TestBuildMoQCatalogDeferVideo(t *testing.T) {
+	t.Parallel()
+	relay := NewRelay()
+
+	// videoCodec returns the advertised video codec, or "" if the catalog
+	// has no video track.
+	videoCodec := func() string {
+		t.Helper()
+		data, err := buildMoQCatalog("live", relay, 0, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var cat moqCatalog
+		if err := json.Unmarshal(data, &cat); err != nil {
+			t.Fatal(err)
+		}
+		for _, tr := range cat.Tracks {
+			if tr.Name == "video" {
+				return tr.SelectionParams.Codec
+			}
+		}
+		return ""
+	}
+
+	if codec := videoCodec(); codec != "" {
+		t.Fatalf("video advertised as %q before its parameters are known", codec)
+	}
+	relay.SetVideoInfo(VideoInfo{Codec: "avc1.64001F", Width: 1280, Height: 720})
+	if codec := videoCodec(); codec != "avc1.64001F" {
+		t.Fatalf("video codec = %q, want avc1.64001F", codec)
+	}
+}
+
 func TestBuildMoQCatalogBasic(t *testing.T) {
 	t.Parallel()
 	relay := NewRelay()
-	data, err := buildMoQCatalog("teststream", relay)
+	data, err := buildMoQCatalog("teststream", relay, 0, false)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -82,8 +174,10 @@ func TestBuildMoQCatalogMultiAudio(t *testing.T) {
 	t.Parallel()
 	relay := NewRelay()
 	relay.SetAudioTrackCount(3)
+	relay.SetAudioInfo(0, AudioInfo{Codec: "mp4a.40.2", SampleRate: 48000, Channels: 2, Config: []byte{0x11, 0x90}})
+	relay.SetAudioInfo(1, AudioInfo{Codec: "ac-3", SampleRate: 48000, Channels: 6})
 
-	data, err := buildMoQCatalog("multi", relay)
+	data, err := buildMoQCatalog("multi", relay, 0, false)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -104,6 +198,18 @@ func TestBuildMoQCatalogMultiAudio(t *testing.T) {
 			t.Fatalf("tracks[%d].name = %q, want %q", i+1, cat.Tracks[i+1].Name, expected)
 		}
 	}
+
+	// Each track carries its own parameters; audio2 has none yet.
+	want := []moqSelectionParams{
+		{Codec: "mp4a.40.2", InitData: "EZA=", SampleRate: 48000, ChannelConfig: "2"},
+		{Codec: "ac-3", SampleRate: 48000, ChannelConfig: "6"},
+		{Codec: "mp4a.40.02", SampleRate: 48000, ChannelConfig: "2"},
+	}
+	for i, w := range want {
+		if got := cat.Tracks[i+1].SelectionParams; got != w {
+			t.Errorf("audio%d params = %+v, want %+v", i, got, w)
+		}
+	}
 }
 
 func TestBuildMoQCatalogCustomVideoInfo(t *testing.T) {
@@ -114,7 +220,7 @@ func TestBuildMoQCatalogCustomVideoInfo(t *testing.T) {
 	relay.videoInfoSet = true
 	relay.mu.Unlock()
 
-	data, err := buildMoQCatalog("4k", relay)
+	data, err := buildMoQCatalog("4k", relay, 0, false)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -136,7 +242,7 @@ func TestBuildMoQCatalogCustomVideoInfo(t *testing.T) {
 func TestBuildMoQCatalogJSONFieldNames(t *testing.T) {
 	t.Parallel()
 	relay := NewRelay()
-	data, err := buildMoQCatalog("test", relay)
+	data, err := buildMoQCatalog("test", relay, 7, false)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -147,12 +253,15 @@ func TestBuildMoQCatalogJSONFieldNames(t *testing.T) {
 	}
 
 	// Check that JSON keys match spec exactly
-	requiredKeys := []string{"version", "streamingFormat", "streamingFormatVersion", "commonTrackFields", "tracks"}
+	requiredKeys := []string{"version", "streamingFormat", "streamingFormatVersion", "sequence", "commonTrackFields", "tracks"}
 	for _, key := range requiredKeys {
 		if _, ok := raw[key]; !ok {
 			t.Fatalf("missing required JSON key: %q", key)
 		}
 	}
+	if seq := raw["sequence"].(float64); seq != 7 {
+		t.Fatalf("sequence = %v, want 7", seq)
+	}
 
 	ctf := raw["commonTrackFields"].(map[string]any)
 	if _, ok := ctf["namespace"]; !ok {
@@ -166,9 +275,9 @@ func TestBuildMoQCatalogJSONFieldNames(t *testing.T) {
 func TestBuildMoQCatalogCustomAudioInfo(t *testing.T) {
 	t.Parallel()
 	relay := NewRelay()
-	relay.SetAudioInfo(AudioInfo{Codec: "mp4a.40.05", SampleRate: 44100, Channels: 1})
+	relay.SetAudioInfo(0, AudioInfo{Codec: "mp4a.40.05", SampleRate: 44100, Channels: 1, Config: []byte{0x2A, 0x08}})
 
-	data, err := buildMoQCatalog("custom-audio", relay)
+	data, err := buildMoQCatalog("custom-audio", relay, 0, false)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -188,4 +297,51 @@ func TestBuildMoQCatalogCustomAudioInfo(t *testing.T) {
 	if ap.ChannelConfig != "1" {
 		t.Fatalf("audio channelConfig = %q", ap.ChannelConfig)
 	}
+	if ap.InitData != "Kgg=" {
+		t.Fatalf("audio initData = %q, want base64 of the AudioSpecificConfig", ap.InitData)
+	}
+}
+
+func TestBuildMoQCatalogConfigHash(t *testing.T) {
+	t.Parallel()
+
+	sps := []byte{0x67, 0x64, 0x00, 0x1F, 0xAC}
+	pps := []byte{0x68, 0xEE, 0x3C, 0x80}
+	relay := NewRelay()
+	videoParams := func(seq uint64) moqSelectionParams {
+		t.Helper()
+		data, err := buildMoQCatalog("test", relay, seq, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var cat moqCatalog
+		if err := json.Unmarshal(data, &cat); err != nil {
+			t.Fatal(err)
+		}
+		return cat.Tracks[0].SelectionParams
+	}
+
+	if h := videoParams(0).ConfigHash; h != "" {
+		t.Fatalf("hash without a decoder config = %q, want none", h)
+	}
+
+	relay.SetVideoInfo(VideoInfo{Codec: "avc1.64001F", Width: 1280, Height: 720,
+		DecoderConfig: moq.BuildAVCDecoderConfig(sps, pps)})
+	first := videoParams(1).ConfigHash
+	if len(first) != 16 {
+		t.Fatalf("hash = %q, want 16 hex digits", first)
+	}
+	relay.SetVideoInfo(VideoInfo{Codec: "avc1.64001F", Width: 1280, Height: 720,
+		DecoderConfig: moq.BuildAVCDecoderConfig(sps, pps)})
+	if h := videoParams(2).ConfigHash; h != first {
+		t.Errorf("hash with unchanged SPS = %q, want %q", h, first)
+	}
+
+	sps2 := append([]byte(nil), sps...)
+	sps2[3] = 0x28 // level 4.0
+	relay.SetVideoInfo(VideoInfo{Codec: "avc1.640028", Width: 1920, Height: 1080,
+		DecoderConfig: moq.BuildAVCDecoderConfig(sps2, pps)})
+	if h := videoParams(3).ConfigHash; h == first {
+		t.Errorf("hash unchanged after the SPS changed: %q", h)
+	}
 }
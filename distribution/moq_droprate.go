@@ -0,0 +1,82 @@
+package distribution
+
+import (
+	"context"
+	"time"
+)
+
+// defaultDropRateWindow is the window over which a viewer's video drop
+// rate is measured when MoQSessionConfig.DropRateWindow is zero.
+const defaultDropRateWindow = 5 * time.Second
+
+// dropRateMinFrames is the fewest video frames a window must offer a
+// viewer for its drop rate to count, so a couple of drops at a low frame
+// rate or in a stalled stream do not trigger a hint.
+const dropRateMinFrames = 10
+
+// DropRateHint recommends moving a viewer to a lower-bitrate rendition,
+// such as a simulcast layer or a thumbnail track, because it dropped too
+// much of its video over a whole measurement window to keep up.
+type DropRateHint struct {
+	SessionID string
+	StreamKey string
+
+	// DropRate is the fraction of video frames dropped over the window,
+	// from 0 to 1.
+	DropRate float64
+	Window   time.Duration
+}
+
+// DropRateHintFunc receives the DropRateHint for a viewer. It is called
+// from the viewer's session and must not block.
+type DropRateHintFunc func(DropRateHint)
+
+// monitorDropRate measures the session's video drop rate over each drop
+// rate window until ctx is done. When a window's rate reaches the
+// threshold, it logs a DropRateHint, counts it in the session's stats
+// and passes it to the hint callback, then stays quiet until a window
+// falls below the threshold. Windows with too few frames to judge are
+// skipped. The stream has a single rendition, so the hint is only a
+// recommendation; acting on it is up to the callback.
+func (m *MoQSession) monitorDropRate(ctx context.Context) {
+	ticker := time.NewTicker(m.dropRateWindow)
+	defer ticker.Stop()
+
+	lastSent, lastDropped := m.videoSent.Load(), m.videoDropped.Load()
+	hinted := false
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		sent, dropped := m.videoSent.Load(), m.videoDropped.Load()
+		frames := sent - lastSent + dropped - lastDropped
+		rate := float64(dropped-lastDropped) / float64(max(frames, 1))
+		lastSent, lastDropped = sent, dropped
+		if frames < dropRateMinFrames {
+			continue
+		}
+		if rate < m.dropRateThreshold {
+			hinted = false
+			continue
+		}
+		if hinted {
+			continue
+		}
+		hinted = true
+
+		m.dropRateHints.Add(1)
+		m.log.Info("viewer dropping video, lower bitrate recommended",
+			"dropRate", rate,
+			"window", m.dropRateWindow)
+		if m.onDropRateHint != nil {
+			m.onDropRateHint(DropRateHint{
+				SessionID: m.id,
+				StreamKey: m.streamKey,
+				DropRate:  rate,
+				Window:    m.dropRateWindow,
+			})
+		}
+	}
+}
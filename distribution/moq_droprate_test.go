@@ -0,0 +1,68 @@
+package distribution
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestMoQSessionDropRateHint(t *testing.T) {
+	t.Parallel()
+
+	const window = 20 * time.Millisecond
+	tests := []struct {
+		name          string
+		sent, dropped int64 // video frames per millisecond
+		wantHint      bool
+	}{
+		{"sustained drops", 1, 3, true},
+		{"occasional drops", 9, 1, false},
+		{"idle", 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			hints := make(chan DropRateHint, 10)
+			session := &MoQSession{
+				id:                "test-session",
+				streamKey:         "live",
+				log:               slog.With("session", "test-session"),
+				dropRateThreshold: 0.5,
+				dropRateWindow:    window,
+				onDropRateHint:    func(h DropRateHint) { hints <- h },
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go session.monitorDropRate(ctx)
+
+			// Keep the rate up for ten windows: a hint is issued once, not
+			// for every window.
+			for deadline := time.Now().Add(10 * window); time.Now().Before(deadline); {
+				session.videoSent.Add(tt.sent)
+				session.videoDropped.Add(tt.dropped)
+				time.Sleep(time.Millisecond)
+			}
+			cancel()
+
+			if !tt.wantHint {
+				if len(hints) > 0 {
+					t.Fatalf("hint = %+v, want none", <-hints)
+				}
+				return
+			}
+			if len(hints) != 1 {
+				t.Fatalf("%d hints, want 1", len(hints))
+			}
+			h := <-hints
+			if h.SessionID != "test-session" || h.StreamKey != "live" || h.Window != window || h.DropRate < 0.5 {
+				t.Errorf("hint = %+v, want a drop rate of about 0.75 over %v", h, window)
+			}
+			if got := session.Stats().DropRateHints; got != 1 {
+				t.Errorf("DropRateHints = %d, want 1", got)
+			}
+		})
+	}
+}
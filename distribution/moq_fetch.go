@@ -0,0 +1,231 @@
+package distribution
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/zsiec/prism/media"
+	"github.com/zsiec/prism/moq"
+)
+
+// joinFetchGrace is how long a new video subscription holds back its GOP
+// snapshot, waiting for a joining FETCH to claim it, before writing the
+// snapshot itself. The wait also ends as soon as the first live frame
+// arrives, so a viewer that never fetches is delayed by at most one frame
+// interval on an active stream.
+const joinFetchGrace = 100 * time.Millisecond
+
+// videoJoin is the GOP snapshot taken when a live video subscription was
+// registered with the relay. Exactly one of the subscription's write loop
+// or a joining FETCH delivers it; the other picks up where it ends. The
+// frames are retained by Relay.JoinVideo and released by whichever claims
+// them.
+type videoJoin struct {
+	frames  []*media.VideoFrame // keyframe first; immutable
+	objects uint64              // objects carrying frames
+
+	mu      sync.Mutex
+	claimed bool
+}
+
+// newVideoJoin returns the join for snapshot frames sent as mode selects.
+// The object count is taken now, while the frames are still retained.
+func newVideoJoin(frames []*media.VideoFrame, mode VideoObjectMode) *videoJoin {
+	j := &videoJoin{frames: frames}
+	for _, f := range frames {
+		j.objects += videoObjectCount(f, mode)
+	}
+	return j
+}
+
+// claim returns the snapshot to the first caller and nil to every later
+// one.
+func (j *videoJoin) claim() []*media.VideoFrame {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.claimed {
+		return nil
+	}
+	j.claimed = true
+	return j.frames
+}
+
+// largest returns the location of the last snapshot object, the point at
+// which live delivery takes over. ok is false for an empty snapshot.
+func (j *videoJoin) largest() (group, object uint64, ok bool) {
+	if len(j.frames) == 0 {
+		return 0, 0, false
+	}
+	return uint64(j.frames[0].GroupID), j.objects - 1, true
+}
+
+// handleFetch serves a joining FETCH for the video subscription: the
+// groups before the subscription's join point come from the DVR buffer and
+// the join group itself from the subscription's GOP snapshot, if the write
+// loop has not already sent it. Live delivery continues on the
+// subscription's own streams, so the two meet without a gap or overlap.
+// Standalone fetches are not supported.
+func (m *MoQSession) handleFetch(ctx context.Context, f moq.Fetch) {
+	if !m.admitRequest(f.RequestID) {
+		m.sendFetchError(f.RequestID, moq.SubscribeErrorTooManyRequests, moq.ErrTooManyRequests.Error())
+		return
+	}
+	if f.FetchType == moq.FetchStandalone {
+		m.sendFetchError(f.RequestID, moq.SubscribeErrorNotSupported, "standalone fetch not supported")
+		return
+	}
+
+	m.mu.RLock()
+	sub := m.subscriptions["video"]
+	m.mu.RUnlock()
+	if sub == nil || sub.requestID != f.JoiningRequestID || sub.join == nil {
+		m.sendFetchError(f.RequestID, moq.SubscribeErrorTrackDoesNotExist, "no joinable subscription")
+		return
+	}
+
+	joinGroup, _, ok := sub.join.largest()
+	if !ok {
+		m.sendFetchError(f.RequestID, moq.SubscribeErrorInvalidRange, moq.ErrInvalidRange.Error())
+		return
+	}
+	start := f.JoiningStart
+	if f.FetchType == moq.FetchRelativeJoining {
+		start = joinGroup - min(f.JoiningStart, joinGroup)
+	}
+	if start > joinGroup {
+		m.sendFetchError(f.RequestID, moq.SubscribeErrorInvalidRange, moq.ErrInvalidRange.Error())
+		return
+	}
+
+	var frames []*media.VideoFrame
+	if start < joinGroup {
+		oldest, _ := m.relay.DVRWindow()
+		if dvr, ok := m.relay.DVRFrames(max(start, oldest), joinGroup-1); ok {
+			frames = dvr
+		}
+	}
+	frames = append(frames, sub.join.claim()...)
+	if len(frames) == 0 {
+		m.sendFetchError(f.RequestID, moq.SubscribeErrorInvalidRange, moq.ErrInvalidRange.Error())
+		return
+	}
+
+	last := frames[len(frames)-1]
+	lastObj := videoObjectCount(last, m.videoObjects) - 1
+	for i := len(frames) - 2; i >= 0 && frames[i].GroupID == last.GroupID; i-- {
+		lastObj += videoObjectCount(frames[i], m.videoObjects)
+	}
+
+	fetchCtx, cancel := context.WithCancel(ctx)
+	m.mu.Lock()
+	if m.fetches == nil {
+		m.fetches = make(map[uint64]context.CancelFunc)
+	}
+	m.fetches[f.RequestID] = cancel
+	m.mu.Unlock()
+
+	m.sendFetchOK(moq.FetchOK{
+		RequestID:  f.RequestID,
+		GroupOrder: moq.GroupOrderAscending,
+		EndGroup:   uint64(last.GroupID),
+		EndObj:     lastObj,
+	})
+
+	m.log.Debug("joining fetch",
+		"requestID", f.RequestID,
+		"startGroup", start,
+		"frames", len(frames))
+
+	go func() {
+		defer func() {
+			media.ReleaseVideo(frames)
+			cancel()
+			m.mu.Lock()
+			delete(m.fetches, f.RequestID)
+			m.mu.Unlock()
+		}()
+		if err := m.writeFetch(fetchCtx, sub, f.RequestID, frames); err != nil && fetchCtx.Err() == nil {
+			m.log.Debug("fetch delivery failed", "requestID", f.RequestID, "error", err)
+		}
+	}()
+}
+
+// handleFetchCancel abandons an in-progress fetch.
+func (m *MoQSession) handleFetchCancel(fc moq.FetchCancel) {
+	m.mu.Lock()
+	cancel := m.fetches[fc.RequestID]
+	delete(m.fetches, fc.RequestID)
+	m.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+}
+
+// writeFetch delivers frames on a single fetch stream in ascending group
+// order. Object IDs count from the keyframe of each group, matching the
+// numbering of the subscription's own group streams.
+func (m *MoQSession) writeFetch(ctx context.Context, sub *moqTrackSub, requestID uint64, frames []*media.VideoFrame) error {
+	stream, err := m.session.OpenUniStreamSync(ctx)
+	if err != nil {
+		if isWriteTimeout(err) {
+			return m.abandonStream(nil, sub, err)
+		}
+		return fmt.Errorf("open fetch stream: %w", err)
+	}
+
+	if err := writeFetchHeader(stream, requestID); err != nil {
+		if isWriteTimeout(err) {
+			return m.abandonStream(stream, sub, err)
+		}
+		stream.Close()
+		return fmt.Errorf("write fetch header: %w", err)
+	}
+
+	priority := m.trackPriorities().Video
+	var objectID uint64
+	for i, frame := range frames {
+		if ctx.Err() != nil {
+			stream.CancelWrite(streamErrCancelled)
+			return nil
+		}
+		if i > 0 && frame.GroupID != frames[i-1].GroupID {
+			objectID = 0
+		}
+		n, objects, err := writeFetchVideoObjects(stream, uint64(frame.GroupID), objectID, priority, frame, m.videoObjects, m.relay.wallClock())
+		if err != nil {
+			if isWriteTimeout(err) {
+				return m.abandonStream(stream, sub, err)
+			}
+			stream.Close()
+			return fmt.Errorf("write fetch object: %w", err)
+		}
+		m.bytesSent.Add(n)
+		objectID += objects
+	}
+	return stream.Close()
+}
+
+// sendFetchOK sends a FETCH_OK on the control stream.
+func (m *MoQSession) sendFetchOK(fok moq.FetchOK) {
+	m.controlMu.Lock()
+	defer m.controlMu.Unlock()
+	if err := moq.WriteControlMsg(m.control, moq.MsgFetchOK, moq.SerializeFetchOK(fok)); err != nil {
+		m.log.Warn("write FETCH_OK failed", "error", err)
+	}
+}
+
+// sendFetchError sends a FETCH_ERROR on the control stream.
+func (m *MoQSession) sendFetchError(requestID uint64, errorCode moq.SubscribeErrorCode, reason string) {
+	fe := moq.FetchError{
+		RequestID:    requestID,
+		ErrorCode:    errorCode,
+		ReasonPhrase: reason,
+	}
+	m.controlMu.Lock()
+	defer m.controlMu.Unlock()
+	if err := moq.WriteControlMsg(m.control, moq.MsgFetchError, moq.SerializeFetchError(fe)); err != nil {
+		m.log.Warn("write FETCH_ERROR failed", "error", err)
+	}
+}
@@ -0,0 +1,76 @@
+package distribution
+
+import (
+	"sync"
+
+	"github.com/zsiec/prism/webtransport"
+)
+
+// lostObjects records where a subscription's frames were dropped before
+// reaching its write loop, so the loop can mark each loss in the stream
+// at the object IDs the frame would have had. Without the markers a
+// viewer cannot tell a dropped object from one that was never produced.
+type lostObjects struct {
+	mu     sync.Mutex
+	queued int64 // frames handed to the write loop
+	drops  []lostFrame
+}
+
+// lostFrame is a frame dropped after queued frames had been handed to the
+// write loop, which would have been sent as objects objects.
+type lostFrame struct {
+	queued  int64
+	objects int64
+}
+
+// queue records a frame handed to the write loop.
+func (l *lostObjects) queue() {
+	l.mu.Lock()
+	l.queued++
+	l.mu.Unlock()
+}
+
+// drop records a frame of objects objects dropped after the frames queued
+// so far.
+func (l *lostObjects) drop(objects int64) {
+	l.mu.Lock()
+	l.drops = append(l.drops, lostFrame{queued: l.queued, objects: objects})
+	l.mu.Unlock()
+}
+
+// take returns how many objects were dropped before the write loop's
+// received-th frame (counting from zero) was queued, forgetting them.
+func (l *lostObjects) take(received int64) int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var n int
+	var objects int64
+	for n < len(l.drops) && l.drops[n].queued <= received {
+		objects += l.drops[n].objects
+		n++
+	}
+	l.drops = l.drops[n:]
+	return objects
+}
+
+// writeLostObjects writes an "object does not exist" status for each of
+// lost dropped objects at the next object IDs on stream, followed by an
+// "end of group" status if endGroup is set.
+func (m *MoQSession) writeLostObjects(stream webtransport.SendStream, sub *moqTrackSub, lost int64, endGroup bool) error {
+	for range lost {
+		n, err := sub.writer.WriteObjectStatus(stream, ObjectStatusDoesNotExist)
+		if err != nil {
+			return err
+		}
+		m.bytesSent.Add(n)
+	}
+	if !endGroup {
+		return nil
+	}
+	n, err := sub.writer.WriteObjectStatus(stream, ObjectStatusEndOfGroup)
+	if err != nil {
+		return err
+	}
+	m.bytesSent.Add(n)
+	return nil
+}
@@ -4,15 +4,17 @@ import (
 	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"math"
 	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
-	"github.com/zsiec/ccx"
+	"github.com/zsiec/prism/demux"
 	"github.com/zsiec/prism/media"
 	"github.com/zsiec/prism/moq"
 	"github.com/zsiec/prism/webtransport"
@@ -26,9 +28,32 @@ type moqTrackSub struct {
 	writer          StreamFrameWriter
 	videoCh         chan *media.VideoFrame
 	audioCh         chan *media.AudioFrame
-	captionCh       chan *ccx.CaptionFrame
+	captionCh       chan *media.CaptionFrame
+	scte35Ch        chan *demux.SCTE35Event
 	audioTrackIndex int
 	cancel          context.CancelFunc
+
+	// backlog holds DVR frames written before any live frame for a video
+	// subscription that seeked into the time-shift buffer. When hasEnd is
+	// set, delivery stops after group endGroup.
+	backlog  []*media.VideoFrame
+	endGroup uint64
+	hasEnd   bool
+
+	// join holds the GOP cached when a live video subscription was
+	// registered. It is delivered by the write loop or, if claimed first,
+	// by a joining FETCH.
+	join *videoJoin
+
+	// lost records video and audio frames dropped before reaching the
+	// write loop, which marks them in the stream.
+	lost lostObjects
+
+	// streamCount is the number of data streams opened by the write loop,
+	// reported in SUBSCRIBE_DONE. Only the write loop goroutine touches it.
+	streamCount uint64
+	// done is closed when the write loop returns.
+	done chan struct{}
 }
 
 // Compile-time interface checks.
@@ -38,26 +63,107 @@ var _ Viewer = (*MoQSession)(nil)
 // since the pipeline may not exist when the MoQ session is created.
 type StatsProviderFunc func(streamKey string) StatsProvider
 
+// StreamWatchFunc returns the keys of the active streams and calls notify
+// as streams start and end, until stop is called. notify must not block.
+type StreamWatchFunc func(notify func(key string, active bool)) (active []string, stop func())
+
+// SubscribeAuthorizer decides whether a viewer may subscribe to trackName
+// of the stream streamKey, given the token from its SUBSCRIBE's
+// AUTHORIZATION TOKEN parameter ("" if it sent none). A non-nil error
+// rejects the subscription as unauthorized.
+type SubscribeAuthorizer func(streamKey, trackName, token string) error
+
+// AdminAuthorizer decides whether a request to a control endpoint, one
+// that starts or stops an SRT pull or a recording, may proceed, given the
+// bearer token from its Authorization header ("" if it sent none). A
+// non-nil error rejects the request as unauthorized.
+type AdminAuthorizer func(token string) error
+
 // MoQSession manages a single MoQ viewer connection. It implements the Viewer
 // interface so the Relay can fan out frames to it. Internally, it dispatches
 // frames to per-track subscriptions, each with its own write loop and moqWriter.
 type MoQSession struct {
-	id            string
-	log           *slog.Logger
-	streamKey     string
-	session       *webtransport.Session
-	control       webtransport.Stream
-	controlReader *bufio.Reader // persistent buffered reader for control stream
-	relay         *Relay
-	statsProvider StatsProviderFunc
-	controlMu     sync.Mutex
+	id             string
+	log            *slog.Logger
+	streamKey      string
+	session        uniStreamOpener // bounded by the write timeout
+	control        webtransport.Stream
+	controlReader  *bufio.Reader // persistent buffered reader for control stream
+	relay          *Relay
+	statsProvider  StatsProviderFunc
+	watchStreams   StreamWatchFunc
+	authorize      SubscribeAuthorizer
+	catalogRefresh time.Duration
+	catalogRetries int // extra attempts after a failed catalog write
+	audioFirst     bool
+	priorities     TrackPriorities // as configured; see trackPriorities
+	controlMu      sync.Mutex
+
+	videoOverflow     VideoOverflowPolicy
+	videoBlockTimeout time.Duration
+	videoObjects      VideoObjectMode
+
+	// endTrackOnWriteTimeout ends a track's subscription on its first
+	// write timeout instead of dropping the object.
+	endTrackOnWriteTimeout bool
+
+	// openUnalignedGroups opens a group at a delta frame whose keyframe
+	// never arrived instead of skipping to the next keyframe.
+	openUnalignedGroups bool
+
+	// plainCaptions sends captions as plain text, without styling.
+	plainCaptions bool
+
+	// objectDatagrams offers to send audio and caption objects as
+	// datagrams; useDatagrams is set at setup if the client accepts.
+	objectDatagrams bool
+	useDatagrams    bool
+	datagrams       datagramSender
+
+	// conn reports transport stats for ViewerStats.Transport; nil
+	// without a WebTransport session.
+	conn connStatsReporter
+
+	// audioAlignHold bounds how long audio waits for the first video
+	// keyframe; videoStarted is closed once that keyframe is written.
+	audioAlignHold   time.Duration
+	videoStarted     chan struct{}
+	videoStartedOnce sync.Once
+
+	audioFramesPerObject int
+
+	// dropRateThreshold, when positive, is the video drop rate over a
+	// dropRateWindow at which the session hints that the viewer needs a
+	// lower bitrate; see monitorDropRate.
+	dropRateThreshold float64
+	dropRateWindow    time.Duration
+	onDropRateHint    DropRateHintFunc
+
+	// maxShedLevel is the deepest the session sheds video when its viewer
+	// is saturated; shedLevel is the current level. See monitorShedding.
+	maxShedLevel ShedLevel
+	shedLevel    atomic.Int32
+
+	// maxRequests is how many request IDs the client is granted at a
+	// time; see MoQSessionConfig.MaxRequestID. requestIDLimit is the
+	// MAX_REQUEST_ID last sent, one above the largest request ID the
+	// client may use, or zero before the setup exchange.
+	maxRequests    uint64
+	requestIDLimit atomic.Uint64
 
 	mu             sync.RWMutex
-	subscriptions  map[string]*moqTrackSub // key: trackName
+	subscriptions  map[string]*moqTrackSub       // key: trackName
+	fetches        map[uint64]context.CancelFunc // key: fetch request ID
 	nextTrackAlias uint64
+	announces      *announceSub // nil until SUBSCRIBE_ANNOUNCES
+
+	// nextRequestID numbers server-initiated requests such as ANNOUNCE,
+	// which use odd request IDs.
+	nextRequestID atomic.Uint64
 
 	damagedGroup atomic.Uint32
 	closed       atomic.Bool
+	goAwaySent   atomic.Bool
 
 	videoSent      atomic.Int64
 	audioSent      atomic.Int64
@@ -66,8 +172,20 @@ type MoQSession struct {
 	audioDropped   atomic.Int64
 	captionDropped atomic.Int64
 	bytesSent      atomic.Int64
-	lastVideoTsMS  atomic.Int64
-	lastAudioTsMS  atomic.Int64
+	writeTimeouts  atomic.Int64
+	// skippedUntilKeyframe counts delta frames not sent because they
+	// would have started a group; see ViewerStats.SkippedUntilKeyframe.
+	skippedUntilKeyframe atomic.Int64
+	lastVideoTsMS        atomic.Int64
+	lastAudioTsMS        atomic.Int64
+	lastVideoGroup       atomic.Uint32
+	// serverLatencyUS is the demuxer-to-write latency of the most recent
+	// live video frame, in microseconds.
+	serverLatencyUS atomic.Int64
+	// dropRateHints counts the DropRateHints issued for this viewer.
+	dropRateHints atomic.Int64
+	// videoShed counts video frames shed to protect audio.
+	videoShed atomic.Int64
 }
 
 // MoQSessionConfig holds the parameters for creating a new MoQ session.
@@ -78,28 +196,198 @@ type MoQSessionConfig struct {
 	StreamKey     string
 	Relay         *Relay
 	StatsProvider StatsProviderFunc
+
+	// WatchStreams lets the client discover streams with
+	// SUBSCRIBE_ANNOUNCES. Nil rejects SUBSCRIBE_ANNOUNCES as unsupported.
+	WatchStreams StreamWatchFunc
+
+	// Authorize, if set, must accept every SUBSCRIBE before it is served.
+	Authorize SubscribeAuthorizer
+
+	// CatalogRefreshInterval is the minimum spacing between catalog
+	// updates pushed to this viewer. Zero uses one second.
+	CatalogRefreshInterval time.Duration
+
+	// WriteTimeout bounds each object write to this viewer, including
+	// opening the stream that carries it. An object that cannot be written
+	// in time is dropped and its stream reset, so a stalled viewer cannot
+	// block a write loop. Zero uses two seconds. A delivery timeout in
+	// the viewer's CLIENT_SETUP overrides it, up to 30 seconds.
+	WriteTimeout time.Duration
+
+	// AudioFirst publishes audio at a higher priority than video and
+	// leaves the video track out of the catalog until its parameters are
+	// known, for sessions started without waiting for video.
+	AudioFirst bool
+
+	// Priorities overrides the publisher priority of each track. Zero
+	// fields use the defaults.
+	Priorities TrackPriorities
+
+	// CatalogRetries is how many times a failed catalog write is retried
+	// before the catalog subscription fails. Zero uses one retry; a
+	// negative value disables retries.
+	CatalogRetries int
+
+	// VideoOverflow is what SendVideo does when the viewer's video queue
+	// is full. The zero value is VideoOverflowDropFrame.
+	VideoOverflow VideoOverflowPolicy
+
+	// VideoBlockTimeout bounds the wait for queue room under
+	// VideoOverflowBlock. Zero uses one second.
+	VideoBlockTimeout time.Duration
+
+	// VideoObjects selects whether video is sent as one object per frame,
+	// the default, or one per slice.
+	VideoObjects VideoObjectMode
+
+	// EndTrackOnWriteTimeout treats a write timeout as fatal to the track:
+	// its subscription ends with a TOO_FAR_BEHIND SUBSCRIBE_DONE rather
+	// than the object being dropped, for viewers that would rather
+	// resubscribe than play through gaps.
+	EndTrackOnWriteTimeout bool
+
+	// OpenUnalignedGroups opens a new group at a delta frame whose
+	// keyframe never arrived, such as the first frames after a
+	// discontinuity, instead of skipping delta frames until the next
+	// keyframe. It suits sources like periodic intra refresh encoders
+	// that rarely or never send keyframes; viewers see a broken picture
+	// until the stream refreshes it.
+	OpenUnalignedGroups bool
+
+	// PlainCaptions sends each caption update as its plain text, without
+	// the decoded regions' position and styling, for clients that render
+	// captions as text only. See CaptionCodec.
+	PlainCaptions bool
+
+	// ObjectDatagrams sends audio objects, and caption objects that fit,
+	// as QUIC datagrams (OBJECT_DATAGRAM) rather than on streams, to
+	// clients that offer moq.ParamObjectDatagrams in CLIENT_SETUP. A
+	// datagram is never retransmitted, so a late audio frame is lost
+	// rather than holding up those behind it. Objects too large for a
+	// datagram, and every object for other clients, go on streams.
+	ObjectDatagrams bool
+
+	// AudioAlignHold, when positive, holds back a viewer's audio until
+	// its first video keyframe has been written, for at most this long,
+	// so playback does not start on audio alone while video waits for a
+	// keyframe. Audio queues meanwhile, and frames beyond the viewer's
+	// audio buffer, about 2.5 seconds, are dropped. Streams without video
+	// are not held.
+	AudioAlignHold time.Duration
+
+	// AudioFramesPerObject batches this many audio frames into each
+	// object, cutting per-object overhead at the cost of holding the
+	// first frame of each object until the last arrives. Values below two
+	// send one frame per object, the default.
+	AudioFramesPerObject int
+
+	// DropRateThreshold, when positive, is the fraction of video frames
+	// dropped over a DropRateWindow, such as 0.2, at which the session
+	// recommends a lower-bitrate rendition for the viewer: it logs a
+	// DropRateHint, counts it in ViewerStats.DropRateHints and passes it
+	// to OnDropRateHint. A viewer is hinted again only after a window
+	// below the threshold. Zero disables the monitor.
+	DropRateThreshold float64
+
+	// DropRateWindow is how long the drop rate must stay at the threshold
+	// to issue a hint. Zero uses five seconds.
+	DropRateWindow time.Duration
+
+	// OnDropRateHint, if set, receives each DropRateHint, for example to
+	// move the viewer to another rendition. It must not block.
+	OnDropRateHint DropRateHintFunc
+
+	// VideoShedding, above ShedNone, sheds video when the viewer's
+	// connection is saturated, so that audio and captions keep flowing:
+	// when the viewer drops audio, hits a write timeout or falls behind on
+	// its queues, the session drops disposable video frames, then every
+	// delta frame, then whole groups, going no deeper than this level. It
+	// backs off a level at a time once the viewer keeps up. The current
+	// level is ViewerStats.ShedLevel. ShedNone, the zero value, leaves
+	// video to VideoOverflow alone.
+	VideoShedding ShedLevel
+
+	// MaxRequestID is how many request IDs the client is granted at a
+	// time. It is the MAX_REQUEST_ID sent at setup, and the limit is
+	// raised as the client uses IDs so that it has at least half as many
+	// left. A SUBSCRIBE, FETCH or SUBSCRIBE_ANNOUNCES with an ID at or
+	// above the limit is rejected. Zero uses 100.
+	MaxRequestID uint64
 }
 
 // NewMoQSession creates a new MoQ session for the given stream key.
 func NewMoQSession(cfg MoQSessionConfig) *MoQSession {
+	catalogRefresh := cfg.CatalogRefreshInterval
+	if catalogRefresh <= 0 {
+		catalogRefresh = defaultCatalogRefreshInterval
+	}
+	writeTimeout := cfg.WriteTimeout
+	if writeTimeout <= 0 {
+		writeTimeout = defaultWriteTimeout
+	}
+	catalogRetries := cfg.CatalogRetries
+	if catalogRetries == 0 {
+		catalogRetries = defaultCatalogRetries
+	}
+	videoBlockTimeout := cfg.VideoBlockTimeout
+	if videoBlockTimeout <= 0 {
+		videoBlockTimeout = defaultVideoBlockTimeout
+	}
+	dropRateWindow := cfg.DropRateWindow
+	if dropRateWindow <= 0 {
+		dropRateWindow = defaultDropRateWindow
+	}
+	var datagrams datagramSender
+	var conn connStatsReporter
+	if cfg.Session != nil {
+		datagrams = cfg.Session
+		conn = cfg.Session
+	}
 	return &MoQSession{
-		id:            cfg.ID,
-		log:           slog.With("session", cfg.ID, "stream", cfg.StreamKey),
-		streamKey:     cfg.StreamKey,
-		session:       cfg.Session,
-		control:       cfg.Control,
-		controlReader: bufio.NewReader(cfg.Control),
-		relay:         cfg.Relay,
-		statsProvider: cfg.StatsProvider,
-		subscriptions: make(map[string]*moqTrackSub),
+		catalogRefresh:    catalogRefresh,
+		catalogRetries:    max(catalogRetries, 0),
+		audioFirst:        cfg.AudioFirst,
+		priorities:        cfg.Priorities,
+		videoOverflow:     cfg.VideoOverflow,
+		videoBlockTimeout: videoBlockTimeout,
+		videoObjects:      cfg.VideoObjects,
+		id:                cfg.ID,
+		log:               slog.With("session", cfg.ID, "stream", cfg.StreamKey),
+		streamKey:         cfg.StreamKey,
+		session:           timedOpener{uniStreamOpener: cfg.Session, timeout: writeTimeout},
+		control:           cfg.Control,
+		controlReader:     bufio.NewReader(cfg.Control),
+		relay:             cfg.Relay,
+		statsProvider:     cfg.StatsProvider,
+		watchStreams:      cfg.WatchStreams,
+		authorize:         cfg.Authorize,
+		subscriptions:     make(map[string]*moqTrackSub),
+		fetches:           make(map[uint64]context.CancelFunc),
+
+		endTrackOnWriteTimeout: cfg.EndTrackOnWriteTimeout,
+		openUnalignedGroups:    cfg.OpenUnalignedGroups,
+		plainCaptions:          cfg.PlainCaptions,
+		objectDatagrams:        cfg.ObjectDatagrams,
+		datagrams:              datagrams,
+		conn:                   conn,
+		audioAlignHold:         cfg.AudioAlignHold,
+		videoStarted:           make(chan struct{}),
+		audioFramesPerObject:   cfg.AudioFramesPerObject,
+		dropRateThreshold:      cfg.DropRateThreshold,
+		dropRateWindow:         dropRateWindow,
+		onDropRateHint:         cfg.OnDropRateHint,
+		maxShedLevel:           cfg.VideoShedding,
+		maxRequests:            cfg.MaxRequestID,
 	}
 }
 
 // ID returns the unique identifier for this MoQ session.
 func (m *MoQSession) ID() string { return m.id }
 
-// handleSetup performs the CLIENT_SETUP / SERVER_SETUP exchange.
-// Returns the stream key from the PATH parameter if present.
+// handleSetup performs the CLIENT_SETUP / SERVER_SETUP exchange and
+// applies the client's delivery timeout, if it sent one, as the write
+// timeout. Returns the stream key from the PATH parameter if present.
 func (m *MoQSession) handleSetup() (string, error) {
 	msgType, payload, err := moq.ReadControlMsg(m.controlReader)
 	if err != nil {
@@ -127,9 +415,13 @@ func (m *MoQSession) handleSetup() (string, error) {
 	}
 
 	// Send SERVER_SETUP
+	limit := m.requestWindow()
+	m.requestIDLimit.Store(limit)
+	m.useDatagrams = m.objectDatagrams && cs.ObjectDatagrams && m.datagrams != nil
 	ss := moq.ServerSetup{
 		SelectedVersion: moq.Version,
-		MaxRequestID:    100,
+		MaxRequestID:    limit,
+		ObjectDatagrams: m.useDatagrams,
 	}
 
 	m.controlMu.Lock()
@@ -141,12 +433,20 @@ func (m *MoQSession) handleSetup() (string, error) {
 
 	// Send MAX_REQUEST_ID
 	m.controlMu.Lock()
-	err = moq.WriteControlMsg(m.control, moq.MsgMaxRequestID, moq.SerializeMaxRequestID(100))
+	err = moq.WriteControlMsg(m.control, moq.MsgMaxRequestID, moq.SerializeMaxRequestID(limit))
 	m.controlMu.Unlock()
 	if err != nil {
 		return "", fmt.Errorf("write MAX_REQUEST_ID: %w", err)
 	}
 
+	// A delivery timeout is how long an object stays useful to the
+	// client, so it replaces the configured per-object write deadline.
+	if opener, ok := m.session.(timedOpener); ok && cs.DeliveryTimeout > 0 {
+		opener.timeout = min(cs.DeliveryTimeout, maxClientDeliveryTimeout)
+		m.session = opener
+		m.log.Debug("using client delivery timeout", "timeout", opener.timeout)
+	}
+
 	pathKey := ""
 	if cs.HasPath {
 		pathKey = cs.Path
@@ -160,15 +460,17 @@ func (m *MoQSession) Run(ctx context.Context) error {
 	defer cancel()
 
 	go m.readControlLoop(ctx)
+	if m.dropRateThreshold > 0 {
+		go m.monitorDropRate(ctx)
+	}
+	if m.maxShedLevel > ShedNone {
+		go m.monitorShedding(ctx)
+	}
 
 	<-ctx.Done()
 
 	m.closed.Store(true)
-
-	// Send GOAWAY
-	m.controlMu.Lock()
-	_ = moq.WriteControlMsg(m.control, moq.MsgGoAway, moq.SerializeGoAway(moq.GoAway{}))
-	m.controlMu.Unlock()
+	m.goAway()
 
 	// Cancel all subscriptions
 	m.mu.Lock()
@@ -183,6 +485,42 @@ func (m *MoQSession) Run(ctx context.Context) error {
 	return ctx.Err()
 }
 
+// goAway sends GOAWAY, asking the client to move to a new session, unless
+// it was already sent.
+func (m *MoQSession) goAway() {
+	if m.goAwaySent.Swap(true) {
+		return
+	}
+	m.controlMu.Lock()
+	err := moq.WriteControlMsg(m.control, moq.MsgGoAway, moq.SerializeGoAway(moq.GoAway{}))
+	m.controlMu.Unlock()
+	if err != nil {
+		m.log.Debug("write GOAWAY failed", "error", err)
+	}
+}
+
+// endSubscriptions stops every subscription's write loop and tells the
+// client each one is done with status. The session is marked closed, so
+// no write loop reports its own SUBSCRIBE_DONE as well.
+func (m *MoQSession) endSubscriptions(status moq.SubscribeDoneStatus, reason string) {
+	m.closed.Store(true)
+
+	m.mu.Lock()
+	subs := m.subscriptions
+	m.subscriptions = make(map[string]*moqTrackSub)
+	m.mu.Unlock()
+
+	for _, sub := range subs {
+		if sub.cancel != nil {
+			sub.cancel()
+		}
+		if sub.done != nil {
+			<-sub.done // streamCount is final once the write loop returns
+		}
+		m.sendSubscribeDone(sub.requestID, status, sub.streamCount, reason)
+	}
+}
+
 // readControlLoop reads and dispatches control messages from the client.
 func (m *MoQSession) readControlLoop(ctx context.Context) {
 	for {
@@ -215,8 +553,44 @@ func (m *MoQSession) readControlLoop(ctx context.Context) {
 			}
 			m.handleUnsubscribe(unsub)
 
+		case moq.MsgFetch:
+			f, err := moq.ParseFetch(payload)
+			if err != nil {
+				m.log.Warn("bad FETCH", "error", err)
+				continue
+			}
+			m.handleFetch(ctx, f)
+
+		case moq.MsgFetchCancel:
+			fc, err := moq.ParseFetchCancel(payload)
+			if err != nil {
+				m.log.Warn("bad FETCH_CANCEL", "error", err)
+				continue
+			}
+			m.handleFetchCancel(fc)
+
+		case moq.MsgSubscribeAnnounces:
+			sa, err := moq.ParseSubscribeAnnounces(payload)
+			if err != nil {
+				m.log.Warn("bad SUBSCRIBE_ANNOUNCES", "error", err)
+				continue
+			}
+			m.handleSubscribeAnnounces(ctx, sa)
+
+		case moq.MsgUnsubscribeAnnounces:
+			ua, err := moq.ParseUnsubscribeAnnounces(payload)
+			if err != nil {
+				m.log.Warn("bad UNSUBSCRIBE_ANNOUNCES", "error", err)
+				continue
+			}
+			m.handleUnsubscribeAnnounces(ua)
+
+		case moq.MsgAnnounceOK, moq.MsgAnnounceError:
+			// Replies to our ANNOUNCEs need no action.
+			m.log.Debug("announce reply", "type", msgType)
+
 		case moq.MsgMaxRequestID:
-			// Acknowledge but don't enforce client quotas
+			// The server makes no requests that the client's quota limits.
 			m.log.Debug("MAX_REQUEST_ID from client")
 
 		default:
@@ -225,17 +599,86 @@ func (m *MoQSession) readControlLoop(ctx context.Context) {
 	}
 }
 
+// requestWindow returns how many request IDs the client is granted at a
+// time.
+func (m *MoQSession) requestWindow() uint64 {
+	if m.maxRequests == 0 {
+		return defaultMaxRequestID
+	}
+	return m.maxRequests
+}
+
+// admitRequest reports whether the client may use requestID under the
+// MAX_REQUEST_ID granted to it. Once fewer than half a window of IDs is
+// left above requestID, it grants another window with a new
+// MAX_REQUEST_ID. Requests are only checked after the setup exchange.
+func (m *MoQSession) admitRequest(requestID uint64) bool {
+	limit := m.requestIDLimit.Load()
+	if limit == 0 {
+		return true
+	}
+	if requestID >= limit {
+		m.log.Debug("request ID over limit", "request_id", requestID, "max_request_id", limit)
+		return false
+	}
+	window := m.requestWindow()
+	if limit-requestID-1 >= window/2 {
+		return true
+	}
+	next := requestID + 1 + window
+	if !m.requestIDLimit.CompareAndSwap(limit, next) {
+		return true // raised concurrently
+	}
+	m.controlMu.Lock()
+	err := moq.WriteControlMsg(m.control, moq.MsgMaxRequestID, moq.SerializeMaxRequestID(next))
+	m.controlMu.Unlock()
+	if err != nil {
+		m.log.Warn("write MAX_REQUEST_ID failed", "error", err)
+	}
+	return true
+}
+
 // handleSubscribe processes a SUBSCRIBE message.
 func (m *MoQSession) handleSubscribe(ctx context.Context, sub moq.Subscribe) {
-	// Validate namespace: must be ["prism", streamKey]
-	if len(sub.Namespace) != 2 || sub.Namespace[0] != "prism" || sub.Namespace[1] != m.streamKey {
-		m.sendSubscribeError(sub.RequestID, 404, moq.ErrUnknownNamespace.Error())
+	if !m.admitRequest(sub.RequestID) {
+		m.sendSubscribeError(sub.RequestID, moq.SubscribeErrorTooManyRequests, moq.ErrTooManyRequests.Error())
 		return
 	}
 
-	// Only support live filter types
-	if sub.FilterType != moq.FilterNextGroupStart && sub.FilterType != moq.FilterLatestObject {
-		m.sendSubscribeError(sub.RequestID, 400, moq.ErrUnsupportedFilter.Error())
+	// Validate namespace: must be ["prism", streamKey]. Discovery sessions
+	// have no stream to subscribe to.
+	if m.relay == nil || len(sub.Namespace) != 2 || sub.Namespace[0] != "prism" || sub.Namespace[1] != m.streamKey {
+		m.sendSubscribeError(sub.RequestID, moq.SubscribeErrorTrackDoesNotExist, moq.ErrUnknownNamespace.Error())
+		return
+	}
+
+	if m.authorize != nil {
+		if err := m.authorize(m.streamKey, sub.TrackName, sub.AuthToken); err != nil {
+			m.log.Debug("subscribe unauthorized", "track", sub.TrackName, "error", err)
+			m.sendSubscribeError(sub.RequestID, moq.SubscribeErrorUnauthorized, "unauthorized")
+			return
+		}
+	}
+
+	// A range that ends before it starts is malformed regardless of whether
+	// absolute filters are supported, so report it as such.
+	if sub.FilterType == moq.FilterAbsoluteRange && sub.EndGroup < sub.StartGroup {
+		m.sendSubscribeError(sub.RequestID, moq.SubscribeErrorInvalidRange, moq.ErrInvalidRange.Error())
+		return
+	}
+
+	// Absolute filters seek into the DVR buffer, which only holds video.
+	// Without it, an AbsoluteStart resumes from the GOP cache instead.
+	// Everything else must use a live filter.
+	absolute := sub.FilterType == moq.FilterAbsoluteStart || sub.FilterType == moq.FilterAbsoluteRange
+	dvr := absolute && m.relay.HasDVR()
+	if absolute {
+		if sub.TrackName != "video" || !dvr && sub.FilterType != moq.FilterAbsoluteStart {
+			m.sendSubscribeError(sub.RequestID, moq.SubscribeErrorNotSupported, moq.ErrUnsupportedFilter.Error())
+			return
+		}
+	} else if sub.FilterType != moq.FilterNextGroupStart && sub.FilterType != moq.FilterLatestObject {
+		m.sendSubscribeError(sub.RequestID, moq.SubscribeErrorNotSupported, moq.ErrUnsupportedFilter.Error())
 		return
 	}
 
@@ -252,11 +695,22 @@ func (m *MoQSession) handleSubscribe(ctx context.Context, sub moq.Subscribe) {
 		m.handleCatalogSubscribe(ctx, sub, alias)
 
 	case "video":
+		if !m.relay.HasVideo() {
+			m.sendSubscribeError(sub.RequestID, moq.SubscribeErrorTrackDoesNotExist, moq.ErrUnknownTrack.Error())
+			return
+		}
+		if dvr {
+			m.handleDVRSubscribe(ctx, sub, alias)
+			return
+		}
 		m.handleMediaSubscribe(ctx, sub, alias, trackName, "video", 0)
 
 	case "captions":
 		m.handleMediaSubscribe(ctx, sub, alias, trackName, "captions", 0)
 
+	case "scte35":
+		m.handleMediaSubscribe(ctx, sub, alias, trackName, "scte35", 0)
+
 	case "stats":
 		m.handleStatsSubscribe(ctx, sub, alias)
 
@@ -268,25 +722,45 @@ func (m *MoQSession) handleSubscribe(ctx context.Context, sub moq.Subscribe) {
 				return
 			}
 		}
-		m.sendSubscribeError(sub.RequestID, 404, moq.ErrUnknownTrack.Error())
+		m.sendSubscribeError(sub.RequestID, moq.SubscribeErrorTrackDoesNotExist, moq.ErrUnknownTrack.Error())
 	}
 }
 
-// handleCatalogSubscribe builds and delivers the catalog, then sends SUBSCRIBE_OK.
+// handleCatalogSubscribe builds and delivers the catalog, then sends
+// SUBSCRIBE_OK. The subscription stays open: whenever the relay reports a
+// catalog change, a refreshed copy is pushed as a new group.
 func (m *MoQSession) handleCatalogSubscribe(ctx context.Context, sub moq.Subscribe, alias uint64) {
-	catalogJSON, err := buildMoQCatalog(m.streamKey, m.relay)
+	seq, changed := m.relay.CatalogUpdates()
+	catalogJSON, err := buildMoQCatalog(m.streamKey, m.relay, seq, m.audioFirst)
 	if err != nil {
-		m.sendSubscribeError(sub.RequestID, 500, "catalog build failed")
+		m.sendSubscribeError(sub.RequestID, moq.SubscribeErrorInternal, "catalog build failed")
 		return
 	}
 
-	if err := writeCatalogObject(ctx, m.session, alias, catalogJSON); err != nil {
-		m.log.Warn("catalog delivery failed", "error", err)
-		m.sendSubscribeError(sub.RequestID, 500, "catalog delivery failed")
+	if err := m.deliverCatalog(ctx, alias, seq, catalogJSON); err != nil {
+		m.sendSubscribeError(sub.RequestID, moq.SubscribeErrorInternal, "catalog delivery failed")
 		return
 	}
 
-	m.sendSubscribeOK(sub.RequestID, alias, moq.GroupOrderAscending, true, 0, 0)
+	subCtx, subCancel := context.WithCancel(ctx)
+	trackSub := &moqTrackSub{
+		requestID:   sub.RequestID,
+		trackAlias:  alias,
+		trackName:   "catalog",
+		cancel:      subCancel,
+		done:        make(chan struct{}),
+		streamCount: 1,
+	}
+
+	m.mu.Lock()
+	m.subscriptions["catalog"] = trackSub
+	m.mu.Unlock()
+
+	m.sendSubscribeOK(sub.RequestID, alias, moq.GroupOrderAscending, true, seq, 0)
+
+	go m.runTrack(subCtx, trackSub, func(ctx context.Context, sub *moqTrackSub) error {
+		return m.writeCatalogLoop(ctx, sub, changed)
+	})
 }
 
 // handleMediaSubscribe creates a track subscription and starts the write loop.
@@ -299,41 +773,82 @@ func (m *MoQSession) handleMediaSubscribe(ctx context.Context, sub moq.Subscribe
 		trackName:       trackName,
 		audioTrackIndex: audioIdx,
 		cancel:          subCancel,
+		done:            make(chan struct{}),
+	}
+	register := func() {
+		m.mu.Lock()
+		m.subscriptions[trackName] = trackSub
+		m.mu.Unlock()
 	}
 
+	var contentExists bool
+	var largestGroup, largestObj uint64
+	priorities := m.trackPriorities()
+	clock := m.relay.wallClock()
+
 	switch mediaType {
 	case "video":
-		trackSub.writer = NewMoQWriter(alias, priorityVideo)
+		trackSub.writer = newMoQVideoWriter(alias, priorities.Video, m.videoObjects, clock)
 		trackSub.videoCh = make(chan *media.VideoFrame, media.VideoBufferSize)
-		// Replay the full cached GOP into the channel before starting the write
-		// loop. The client-side renderer skips to the latest decoded frame, so
-		// this provides immediate decodable content at the live edge.
-		if n := m.relay.ReplayFullGOPToChannel(trackSub.videoCh); n > 0 {
-			m.log.Debug("replayed GOP into video channel", "frames", n)
+		if sub.LiveEdge {
+			// The subscriber asked for the live edge: no snapshot, so
+			// the write loop skips live frames until the next keyframe.
+			// Nothing is ever sent late, at the cost of a startup delay
+			// of up to one GOP. SUBSCRIBE_OK still reports the cached
+			// group as the largest, so the client knows where live
+			// delivery will pick up.
+			largestGroup, largestObj, contentExists = m.relay.LargestVideo(m.videoObjects)
+			go m.runTrack(subCtx, trackSub, m.writeVideoLoop)
+			break
+		}
+		// Snapshot the cached GOP and register for live frames under the
+		// relay's GOP lock, so the snapshot and live delivery meet without
+		// a gap. The client-side renderer skips to the latest decoded frame,
+		// so the snapshot provides immediate decodable content at the live
+		// edge; a joining FETCH may claim it instead of the write loop.
+		// An AbsoluteStart from a client reconnecting after a brief drop
+		// resumes here too: from the cache if its group is the cached
+		// one, and at the cached group if its own was evicted, since a
+		// subscription delivers only from the largest group on.
+		trackSub.join = newVideoJoin(m.relay.JoinVideo(register), m.videoObjects)
+		largestGroup, largestObj, contentExists = trackSub.join.largest()
+		if sub.FilterType == moq.FilterAbsoluteStart && contentExists && sub.StartGroup > largestGroup {
+			// A reconnecting subscriber resuming after the cached group
+			// already has it, so it starts at the next keyframe as at
+			// the live edge. The empty join leaves nothing to fetch.
+			media.ReleaseVideo(trackSub.join.frames)
+			trackSub.join = &videoJoin{}
 		}
-		go m.writeVideoLoop(subCtx, trackSub)
+		go m.runTrack(subCtx, trackSub, m.writeVideoLoop)
 
 	case "audio":
-		trackSub.writer = NewMoQWriter(alias, priorityAudio)
+		trackSub.writer = newMoQWriter(alias, priorities.Audio, clock)
 		trackSub.audioCh = make(chan *media.AudioFrame, media.AudioBufferSize)
 		// Replay recent audio frames into the channel before starting the write
 		// loop, pre-filling the client's audio buffer for immediate playback.
 		if n := m.relay.ReplayAudioToChannel(audioIdx, trackSub.audioCh); n > 0 {
 			m.log.Debug("replayed audio into channel", "track", trackName, "frames", n)
 		}
-		go m.writeAudioLoop(subCtx, trackSub)
+		go m.runTrack(subCtx, trackSub, m.writeAudioLoop)
 
 	case "captions":
-		trackSub.writer = NewMoQWriter(alias, priorityCaptions)
-		trackSub.captionCh = make(chan *ccx.CaptionFrame, viewerCaptionBuffer)
-		go m.writeCaptionLoop(subCtx, trackSub)
+		trackSub.writer = newMoQWriter(alias, priorities.Captions, clock)
+		trackSub.captionCh = make(chan *media.CaptionFrame, viewerCaptionBuffer)
+		go m.runTrack(subCtx, trackSub, m.writeCaptionLoop)
+
+	case "scte35":
+		trackSub.writer = newMoQWriter(alias, priorities.SCTE35, clock)
+		trackSub.scte35Ch = make(chan *demux.SCTE35Event, viewerSCTE35Buffer)
+		go m.runTrack(subCtx, trackSub, m.writeSCTE35Loop)
 	}
 
-	m.mu.Lock()
-	m.subscriptions[trackName] = trackSub
-	m.mu.Unlock()
+	if trackSub.join == nil {
+		register()
+	}
 
-	m.sendSubscribeOK(sub.RequestID, alias, moq.GroupOrderAscending, false, 0, 0)
+	// Audio, caption and SCTE-35 objects are numbered per subscription
+	// from zero, so nothing precedes a new subscription on those tracks.
+	m.sendSubscribeOK(sub.RequestID, alias, moq.GroupOrderAscending, contentExists, largestGroup, largestObj)
 
 	m.log.Debug("track subscribed",
 		"track", trackName,
@@ -341,6 +856,54 @@ func (m *MoQSession) handleMediaSubscribe(ctx context.Context, sub moq.Subscribe
 		"requestID", sub.RequestID)
 }
 
+// handleDVRSubscribe starts a video subscription at an older group held in
+// the relay's DVR buffer. Cached groups are written first, in order, then
+// delivery continues with live frames; an AbsoluteRange subscription ends
+// after its EndGroup. Delivery always begins at a group boundary, so
+// StartObj is ignored.
+func (m *MoQSession) handleDVRSubscribe(ctx context.Context, sub moq.Subscribe, alias uint64) {
+	endGroup := uint64(math.MaxUint64)
+	if sub.FilterType == moq.FilterAbsoluteRange {
+		endGroup = sub.EndGroup
+	}
+	subCtx, subCancel := context.WithCancel(ctx)
+	trackSub := &moqTrackSub{
+		requestID:  sub.RequestID,
+		trackAlias: alias,
+		trackName:  "video",
+		writer:     newMoQVideoWriter(alias, m.trackPriorities().Video, m.videoObjects, m.relay.wallClock()),
+		videoCh:    make(chan *media.VideoFrame, media.VideoBufferSize),
+		cancel:     subCancel,
+		endGroup:   endGroup,
+		hasEnd:     sub.FilterType == moq.FilterAbsoluteRange,
+		done:       make(chan struct{}),
+	}
+	// Take the DVR frames and register for live frames under the relay's
+	// GOP lock, as a live subscription does, so no frame falls between
+	// them. Live frames the backlog already covers are skipped.
+	backlog, ok := m.relay.JoinDVR(sub.StartGroup, endGroup, func() {
+		m.mu.Lock()
+		m.subscriptions["video"] = trackSub
+		m.mu.Unlock()
+	})
+	if !ok {
+		subCancel()
+		m.sendSubscribeError(sub.RequestID, moq.SubscribeErrorInvalidRange, moq.ErrInvalidRange.Error())
+		return
+	}
+	trackSub.backlog = backlog
+	go m.runTrack(subCtx, trackSub, m.writeVideoLoop)
+
+	_, newest := m.relay.DVRWindow()
+	m.sendSubscribeOK(sub.RequestID, alias, moq.GroupOrderAscending, true, newest, 0)
+
+	m.log.Debug("video subscribed from DVR",
+		"alias", alias,
+		"startGroup", sub.StartGroup,
+		"frames", len(backlog),
+		"requestID", sub.RequestID)
+}
+
 // handleUnsubscribe cancels a track subscription.
 func (m *MoQSession) handleUnsubscribe(unsub moq.Unsubscribe) {
 	m.mu.Lock()
@@ -379,7 +942,7 @@ func (m *MoQSession) sendSubscribeOK(requestID, trackAlias uint64, groupOrder by
 }
 
 // sendSubscribeError sends a SUBSCRIBE_ERROR on the control stream.
-func (m *MoQSession) sendSubscribeError(requestID, errorCode uint64, reason string) {
+func (m *MoQSession) sendSubscribeError(requestID uint64, errorCode moq.SubscribeErrorCode, reason string) {
 	se := moq.SubscribeError{
 		RequestID:    requestID,
 		ErrorCode:    errorCode,
@@ -392,6 +955,21 @@ func (m *MoQSession) sendSubscribeError(requestID, errorCode uint64, reason stri
 	}
 }
 
+// sendSubscribeDone sends a SUBSCRIBE_DONE on the control stream.
+func (m *MoQSession) sendSubscribeDone(requestID uint64, status moq.SubscribeDoneStatus, streamCount uint64, reason string) {
+	sd := moq.SubscribeDone{
+		RequestID:    requestID,
+		StatusCode:   status,
+		StreamCount:  streamCount,
+		ReasonPhrase: reason,
+	}
+	m.controlMu.Lock()
+	defer m.controlMu.Unlock()
+	if err := moq.WriteControlMsg(m.control, moq.MsgSubscribeDone, moq.SerializeSubscribeDone(sd)); err != nil {
+		m.log.Warn("write SUBSCRIBE_DONE failed", "error", err)
+	}
+}
+
 // --- Viewer interface implementation ---
 
 // SendVideo dispatches a video frame to the video subscription if active.
@@ -404,7 +982,26 @@ func (m *MoQSession) SendVideo(frame *media.VideoFrame) {
 		return
 	}
 
-	trySendVideo(frame, sub.videoCh, &m.damagedGroup, &m.videoSent, &m.videoDropped)
+	// The queued frame holds a reference to its wire buffer until the
+	// write loop has written it.
+	frame.Retain()
+	var queued bool
+	switch {
+	case m.shedVideo(frame):
+	case m.videoOverflow == VideoOverflowDropGroup:
+		queued = sendVideoGroupwise(frame, sub.videoCh, 0, &m.damagedGroup, &m.videoSent, &m.videoDropped)
+	case m.videoOverflow == VideoOverflowBlock:
+		queued = sendVideoGroupwise(frame, sub.videoCh, m.videoBlockTimeout, &m.damagedGroup, &m.videoSent, &m.videoDropped)
+	default:
+		queued = trySendVideo(frame, sub.videoCh, &m.damagedGroup, &m.videoSent, &m.videoDropped)
+	}
+	if queued {
+		sub.lost.queue()
+	} else {
+		// In per-NAL mode the frame would have been several objects.
+		sub.lost.drop(int64(videoObjectCount(frame, m.videoObjects)))
+		frame.Release()
+	}
 }
 
 // SendAudio dispatches an audio frame to the matching audio subscription.
@@ -422,13 +1019,15 @@ func (m *MoQSession) SendAudio(frame *media.AudioFrame) {
 	select {
 	case sub.audioCh <- frame:
 		m.audioSent.Add(1)
+		sub.lost.queue()
 	default:
 		m.audioDropped.Add(1)
+		sub.lost.drop(1)
 	}
 }
 
 // SendCaptions dispatches a caption frame to the caption subscription.
-func (m *MoQSession) SendCaptions(frame *ccx.CaptionFrame) {
+func (m *MoQSession) SendCaptions(frame *media.CaptionFrame) {
 	m.mu.RLock()
 	sub := m.subscriptions["captions"]
 	m.mu.RUnlock()
@@ -445,27 +1044,134 @@ func (m *MoQSession) SendCaptions(frame *ccx.CaptionFrame) {
 	}
 }
 
+// SendSCTE35 dispatches a SCTE-35 event to the scte35 subscription.
+func (m *MoQSession) SendSCTE35(event *demux.SCTE35Event) {
+	m.mu.RLock()
+	sub := m.subscriptions["scte35"]
+	m.mu.RUnlock()
+
+	if sub == nil || sub.scte35Ch == nil {
+		return
+	}
+
+	select {
+	case sub.scte35Ch <- event:
+	default:
+		m.log.Debug("scte35 channel full, dropping event", "eventID", event.EventID)
+	}
+}
+
 // Stats returns delivery metrics for this MoQ session.
 func (m *MoQSession) Stats() ViewerStats {
+	var transport *TransportStats
+	if m.conn != nil {
+		transport = newTransportStats(m.conn.ConnectionStats())
+	}
 	return ViewerStats{
-		ID:             m.id,
-		VideoSent:      m.videoSent.Load(),
-		AudioSent:      m.audioSent.Load(),
-		CaptionSent:    m.captionSent.Load(),
-		VideoDropped:   m.videoDropped.Load(),
-		AudioDropped:   m.audioDropped.Load(),
-		CaptionDropped: m.captionDropped.Load(),
-		BytesSent:      m.bytesSent.Load(),
-		LastVideoTsMS:  m.lastVideoTsMS.Load(),
-		LastAudioTsMS:  m.lastAudioTsMS.Load(),
+		ID:              m.id,
+		VideoSent:       m.videoSent.Load(),
+		AudioSent:       m.audioSent.Load(),
+		CaptionSent:     m.captionSent.Load(),
+		VideoDropped:    m.videoDropped.Load(),
+		AudioDropped:    m.audioDropped.Load(),
+		CaptionDropped:  m.captionDropped.Load(),
+		BytesSent:       m.bytesSent.Load(),
+		WriteTimeouts:   m.writeTimeouts.Load(),
+		LastVideoTsMS:   m.lastVideoTsMS.Load(),
+		LastAudioTsMS:   m.lastAudioTsMS.Load(),
+		LastVideoGroup:  m.lastVideoGroup.Load(),
+		ServerLatencyMs: float64(m.serverLatencyUS.Load()) / 1000,
+
+		SkippedUntilKeyframe: m.skippedUntilKeyframe.Load(),
+		DropRateHints:        m.dropRateHints.Load(),
+		ShedLevel:            ShedLevel(m.shedLevel.Load()),
+		VideoShed:            m.videoShed.Load(),
+		Transport:            transport,
 	}
 }
 
 // --- Write loops ---
 
-func (m *MoQSession) writeVideoLoop(ctx context.Context, sub *moqTrackSub) {
+// errSubscriptionComplete is returned by a write loop that delivered
+// everything its subscription asked for, such as a bounded DVR range.
+var errSubscriptionComplete = errors.New("subscription complete")
+
+// errTrackEnded is returned by a write loop whose source channel closed.
+var errTrackEnded = errors.New("track ended")
+
+// errViewerStalled is returned by a write loop that hit a write timeout
+// when the session ends tracks on write timeouts.
+var errViewerStalled = errors.New("viewer stalled")
+
+// runTrack runs a track's write loop and reports how it ended. Loops exit
+// silently when their context is cancelled by UNSUBSCRIBE or session
+// teardown. Any other exit removes the subscription and sends
+// SUBSCRIBE_DONE so the client can resubscribe rather than watch the track
+// stall. sub.done is closed once the loop has returned.
+func (m *MoQSession) runTrack(ctx context.Context, sub *moqTrackSub, loop func(context.Context, *moqTrackSub) error) {
+	defer close(sub.done)
+
+	err := loop(ctx, sub)
+	if ctx.Err() != nil || m.closed.Load() {
+		return
+	}
+
+	status := moq.SubscribeDoneInternal
+	switch {
+	case errors.Is(err, errSubscriptionComplete):
+		status = moq.SubscribeDoneSubscriptionEnded
+	case errors.Is(err, errTrackEnded):
+		status = moq.SubscribeDoneTrackEnded
+	case errors.Is(err, errViewerStalled):
+		status = moq.SubscribeDoneTooFarBehind
+	case err == nil:
+		err = errTrackEnded
+		status = moq.SubscribeDoneTrackEnded
+	}
+
+	m.mu.Lock()
+	if m.subscriptions[sub.trackName] == sub {
+		delete(m.subscriptions, sub.trackName)
+	}
+	m.mu.Unlock()
+	sub.cancel()
+
+	if status == moq.SubscribeDoneInternal {
+		m.log.Warn("track write loop failed", "track", sub.trackName, "error", err)
+	}
+	m.sendSubscribeDone(sub.requestID, status, sub.streamCount, err.Error())
+}
+
+// trackPriorities returns the publisher priority of each track for this
+// viewer, with unset values filled from the defaults.
+func (m *MoQSession) trackPriorities() TrackPriorities {
+	return m.priorities.withDefaults(m.audioFirst)
+}
+
+// abandonStream handles a write that timed out: the object is dropped and
+// the stream carrying it, if any, is reset so the viewer's reader is
+// released. It returns nil if the write loop should carry on with the next
+// object, or, when the session ends tracks on write timeouts, an
+// errViewerStalled for the loop to return.
+func (m *MoQSession) abandonStream(stream webtransport.SendStream, sub *moqTrackSub, err error) error {
+	if stream != nil {
+		stream.CancelWrite(streamErrWriteTimeout)
+	}
+	m.writeTimeouts.Add(1)
+	if m.endTrackOnWriteTimeout {
+		return fmt.Errorf("%w: %w", errViewerStalled, err)
+	}
+	m.log.Debug("viewer write timed out, dropping object", "track", sub.trackName, "error", err)
+	return nil
+}
+
+func (m *MoQSession) writeVideoLoop(ctx context.Context, sub *moqTrackSub) error {
 	var currentStream webtransport.SendStream
 	var currentGroupID uint32
+	// groupDropped is set when the current group's stream was abandoned
+	// on a write timeout; its remaining delta frames are undecodable and
+	// are dropped until the next keyframe.
+	var groupDropped bool
 
 	closeStream := func() {
 		if currentStream != nil {
@@ -475,137 +1181,610 @@ func (m *MoQSession) writeVideoLoop(ctx context.Context, sub *moqTrackSub) {
 	}
 	defer closeStream()
 
-	for {
+	dropGroup := func(stream webtransport.SendStream, err error) error {
+		m.videoDropped.Add(1)
+		currentStream = nil
+		groupDropped = true
+		return m.abandonStream(stream, sub, err)
+	}
+
+	// awaitingKeyframe is set while delta frames are skipped because
+	// they would start a group, so the skip is logged once per episode.
+	var awaitingKeyframe bool
+
+	// live is set once cached frames have been written. Only live frames
+	// contribute to the server latency, since replayed ones are stale by
+	// design.
+	var live bool
+
+	// When a joining FETCH delivered the start of the current group,
+	// resumeGroup is that group and resumeObject the first object ID left
+	// for the live stream to carry.
+	var resumeGroup uint32
+	var resumeObject uint64
+
+	// openGroup opens the stream carrying frame's group, continuing from
+	// resumeObject when the fetch already sent the group's first objects.
+	openGroup := func(frame *media.VideoFrame, resume bool) error {
+		closeStream()
+		currentGroupID = frame.GroupID
+		groupDropped = false
+
+		stream, err := m.session.OpenUniStreamSync(ctx)
+		if err != nil {
+			if isWriteTimeout(err) {
+				return dropGroup(nil, err)
+			}
+			return fmt.Errorf("open video stream: %w", err)
+		}
+		sub.streamCount++
+
+		if resume {
+			err = sub.writer.ResumeStreamHeader(stream, currentGroupID, resumeObject)
+		} else {
+			err = sub.writer.WriteStreamHeader(stream, TrackIDVideo, currentGroupID, uint32(frame.PTS/1000))
+		}
+		if err != nil {
+			if isWriteTimeout(err) {
+				return dropGroup(stream, err)
+			}
+			stream.Close()
+			return fmt.Errorf("write video header: %w", err)
+		}
+		currentStream = stream
+		return nil
+	}
+
+	// writeFrame writes one frame, opening a new group stream on each
+	// keyframe. A delta frame that would start a group, because it comes
+	// before any keyframe or its own keyframe was lost, is skipped until
+	// the next keyframe rather than opening a group the viewer cannot
+	// decode, unless the session opens unaligned groups.
+	writeFrame := func(frame *media.VideoFrame) error {
+		// A group whose open timed out was already counted as dropped.
+		switch {
+		case frame.IsKeyframe:
+			resumeObject = 0
+			awaitingKeyframe = false
+			if err := openGroup(frame, false); err != nil || currentStream == nil {
+				return err
+			}
+		case resumeObject > 0 && frame.GroupID == resumeGroup:
+			err := openGroup(frame, true)
+			resumeObject = 0
+			if err != nil || currentStream == nil {
+				return err
+			}
+		case frame.GroupID != currentGroupID || currentStream == nil && !groupDropped:
+			if !awaitingKeyframe {
+				m.log.Warn("video group does not start with a keyframe",
+					"group", frame.GroupID, "open", m.openUnalignedGroups)
+				awaitingKeyframe = true
+			}
+			if m.openUnalignedGroups {
+				if err := openGroup(frame, false); err != nil || currentStream == nil {
+					return err
+				}
+				break
+			}
+			closeStream()
+			m.skippedUntilKeyframe.Add(1)
+			return nil
+		}
+
+		if currentStream == nil {
+			if groupDropped {
+				m.videoDropped.Add(1)
+			}
+			return nil
+		}
+
+		n, err := sub.writer.WriteVideoFrame(currentStream, frame)
+		if err != nil {
+			if isWriteTimeout(err) {
+				return dropGroup(currentStream, err)
+			}
+			closeStream()
+			return fmt.Errorf("write video frame: %w", err)
+		}
+		m.bytesSent.Add(n)
+		m.lastVideoTsMS.Store(frame.PTS / 1000)
+		m.lastVideoGroup.Store(frame.GroupID)
+		if !awaitingKeyframe {
+			m.markVideoStarted()
+		}
+		if live && !frame.ArrivedAt.IsZero() {
+			m.serverLatencyUS.Store(time.Since(frame.ArrivedAt).Microseconds())
+		}
+		return nil
+	}
+
+	// A live subscription starts from its GOP snapshot. Hold it back
+	// briefly so a joining FETCH can claim it; if the fetch does, live
+	// delivery resumes the snapshot's group after its last frame.
+	var lastReplayed *media.VideoFrame
+	var pending *media.VideoFrame
+	if sub.join != nil && len(sub.join.frames) > 0 {
+		grace := time.NewTimer(joinFetchGrace)
 		select {
 		case <-ctx.Done():
-			return
+			grace.Stop()
+			return nil
 		case frame, ok := <-sub.videoCh:
 			if !ok {
-				return
+				grace.Stop()
+				return errTrackEnded
 			}
+			pending = frame
+		case <-grace.C:
+		}
+		grace.Stop()
+
+		if frames := sub.join.claim(); frames != nil {
+			sub.backlog = frames
+		} else {
+			lastReplayed = sub.join.frames[len(sub.join.frames)-1]
+			resumeGroup = lastReplayed.GroupID
+			resumeObject = sub.join.objects
+		}
+	}
 
-			if frame.IsKeyframe {
-				closeStream()
-				currentGroupID = frame.GroupID
-
-				stream, err := m.session.OpenUniStreamSync(ctx)
-				if err != nil {
-					m.log.Debug("video stream open failed", "error", err)
-					return
-				}
-
-				tsMS := uint32(frame.PTS / 1000)
-				if err := sub.writer.WriteStreamHeader(stream, TrackIDVideo, currentGroupID, tsMS); err != nil {
-					stream.Close()
-					m.log.Debug("video header write failed", "error", err)
-					return
-				}
-				currentStream = stream
+	// markLost marks lost frames dropped ahead of frame in the current
+	// group. Frames lost before a keyframe, or before a frame of a later
+	// group, were cut from the end of the group, so it is ended too.
+	markLost := func(frame *media.VideoFrame, lost int64) error {
+		if currentStream == nil {
+			return nil
+		}
+		endOfGroup := frame.IsKeyframe || frame.GroupID != currentGroupID
+		if err := m.writeLostObjects(currentStream, sub, lost, endOfGroup); err != nil {
+			if isWriteTimeout(err) {
+				err = m.abandonStream(currentStream, sub, err)
+				currentStream = nil
+				groupDropped = true
+				return err
 			}
+			closeStream()
+			return fmt.Errorf("write video object status: %w", err)
+		}
+		return nil
+	}
 
-			if currentStream == nil {
-				continue
+	// received counts the live frames taken from videoCh.
+	var received int64
+
+	// deliver writes a live frame, skipping any already covered by the
+	// backlog, snapshot or fetch so no frame is sent twice. Frames lost
+	// ahead of a skipped frame were covered too.
+	deliver := func(frame *media.VideoFrame) error {
+		lost := sub.lost.take(received)
+		received++
+		if lastReplayed != nil && (frame.GroupID < lastReplayed.GroupID ||
+			frame.GroupID == lastReplayed.GroupID && frame.DTS <= lastReplayed.DTS) {
+			return nil
+		}
+		if sub.hasEnd && uint64(frame.GroupID) > sub.endGroup {
+			return errSubscriptionComplete
+		}
+		if lost > 0 {
+			if err := markLost(frame, lost); err != nil {
+				return err
 			}
+		}
+		return writeFrame(frame)
+	}
+
+	// Drain DVR frames or the GOP snapshot first. Each frame's reference
+	// is dropped once written; writers copy the payload before returning.
+	// lastReplayed is only used for its group and DTS afterwards.
+	backlog := sub.backlog
+	sub.backlog = nil
+	for i, frame := range backlog {
+		if ctx.Err() != nil {
+			media.ReleaseVideo(backlog[i:])
+			return nil
+		}
+		err := writeFrame(frame)
+		frame.Release()
+		if err != nil {
+			media.ReleaseVideo(backlog[i+1:])
+			return err
+		}
+		lastReplayed = frame
+	}
+	if sub.hasEnd && lastReplayed != nil && uint64(lastReplayed.GroupID) >= sub.endGroup {
+		return errSubscriptionComplete
+	}
+	live = true
+	if pending != nil {
+		err := deliver(pending)
+		pending.Release()
+		if err != nil {
+			return err
+		}
+	}
 
-			n, err := sub.writer.WriteVideoFrame(currentStream, frame)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case frame, ok := <-sub.videoCh:
+			if !ok {
+				return errTrackEnded
+			}
+			err := deliver(frame)
+			frame.Release()
 			if err != nil {
-				closeStream()
-				m.log.Debug("video frame write failed", "error", err)
-				return
+				return err
 			}
-			m.bytesSent.Add(n)
-			m.lastVideoTsMS.Store(frame.PTS / 1000)
 		}
 	}
 }
 
-func (m *MoQSession) writeAudioLoop(ctx context.Context, sub *moqTrackSub) {
+// markVideoStarted records that the viewer has been sent a video
+// keyframe, releasing audio held for it.
+func (m *MoQSession) markVideoStarted() {
+	if m.videoStarted != nil {
+		m.videoStartedOnce.Do(func() { close(m.videoStarted) })
+	}
+}
+
+// holdAudio waits, for at most audioAlignHold, until the viewer has been
+// sent a video keyframe. It returns at once if alignment is off or the
+// stream has no video.
+func (m *MoQSession) holdAudio(ctx context.Context) {
+	if m.audioAlignHold <= 0 || m.videoStarted == nil || !m.relay.HasVideo() {
+		return
+	}
+	timer := time.NewTimer(m.audioAlignHold)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-m.videoStarted:
+	case <-timer.C:
+		m.log.Debug("audio alignment timed out waiting for a video keyframe", "hold", m.audioAlignHold)
+	}
+}
+
+func (m *MoQSession) writeAudioLoop(ctx context.Context, sub *moqTrackSub) error {
+	m.holdAudio(ctx)
+
 	var stream webtransport.SendStream
+	// received counts the frames taken from audioCh.
+	var received int64
+	// nextObject is the next object ID when sending datagrams, which
+	// unlike a stream do not number their objects implicitly.
+	var nextObject uint64
 	defer func() {
 		if stream != nil {
 			stream.Close()
 		}
 	}()
 
+	// writeFrames writes frames as one object, preceded by lost status
+	// objects for frames dropped ahead of them.
+	writeFrames := func(frames []*media.AudioFrame, lost int64) error {
+		// On a write timeout the frames are dropped and the stream
+		// reset; the next object starts a fresh stream.
+		drop := func(err error) error {
+			m.audioDropped.Add(int64(len(frames)))
+			err = m.abandonStream(stream, sub, err)
+			stream = nil
+			return err
+		}
+
+		// Datagrams skip the IDs of frames dropped ahead of them rather
+		// than sending status objects.
+		var resume *uint64
+		if m.useDatagrams {
+			objectID := nextObject + uint64(lost)
+			nextObject, lost = objectID+1, 0
+			if d := sub.writer.AudioDatagram(frames, objectID, maxObjectDatagramSize); d != nil {
+				m.sendDatagram(d, int64(len(frames)), &m.audioDropped)
+				m.lastAudioTsMS.Store(int64(uint32(frames[len(frames)-1].PTS / 1000)))
+				return nil
+			}
+			// Too large for a datagram, the object goes alone on a
+			// stream resuming the group at its ID.
+			resume = &objectID
+			defer func() {
+				if stream != nil {
+					stream.Close()
+					stream = nil
+				}
+			}()
+		}
+
+		tsMS := uint32(frames[0].PTS / 1000)
+		if stream == nil {
+			var err error
+			stream, err = m.session.OpenUniStreamSync(ctx)
+			if err != nil {
+				if isWriteTimeout(err) {
+					return drop(err)
+				}
+				return fmt.Errorf("open audio stream: %w", err)
+			}
+			sub.streamCount++
+
+			trackID := AudioTrackID(sub.audioTrackIndex)
+			if resume != nil {
+				err = sub.writer.ResumeStreamHeader(stream, 0, *resume)
+			} else {
+				err = sub.writer.WriteStreamHeader(stream, trackID, 0, tsMS)
+			}
+			if err != nil {
+				if isWriteTimeout(err) {
+					return drop(err)
+				}
+				stream.Close()
+				stream = nil
+				return fmt.Errorf("write audio header: %w", err)
+			}
+		}
+
+		// Frames dropped ahead of these take the object IDs before them.
+		if lost > 0 {
+			if err := m.writeLostObjects(stream, sub, lost, false); err != nil {
+				if isWriteTimeout(err) {
+					return drop(err)
+				}
+				return fmt.Errorf("write audio object status: %w", err)
+			}
+		}
+
+		var n int64
+		var err error
+		if len(frames) == 1 {
+			n, err = sub.writer.WriteAudioFrame(stream, frames[0].Data, tsMS)
+		} else {
+			n, err = sub.writer.WriteAudioFrames(stream, frames)
+		}
+		if err != nil {
+			if isWriteTimeout(err) {
+				return drop(err)
+			}
+			return fmt.Errorf("write audio frame: %w", err)
+		}
+		m.bytesSent.Add(n)
+		m.lastAudioTsMS.Store(int64(uint32(frames[len(frames)-1].PTS / 1000)))
+		return nil
+	}
+
+	// batch holds frames waiting to fill an object, and batchLost the
+	// frames dropped ahead of them.
+	perObject := max(m.audioFramesPerObject, 1)
+	batch := make([]*media.AudioFrame, 0, perObject)
+	var batchLost int64
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		err := writeFrames(batch, batchLost)
+		clear(batch)
+		batch, batchLost = batch[:0], 0
+		return err
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
-			return
+			return nil
 		case frame, ok := <-sub.audioCh:
 			if !ok {
-				return
-			}
-
-			if stream == nil {
-				var err error
-				stream, err = m.session.OpenUniStreamSync(ctx)
-				if err != nil {
-					m.log.Debug("audio stream open failed", "error", err)
-					return
+				if err := flush(); err != nil {
+					return err
 				}
-
-				trackID := AudioTrackID(sub.audioTrackIndex)
-				tsMS := uint32(frame.PTS / 1000)
-				if err := sub.writer.WriteStreamHeader(stream, trackID, 0, tsMS); err != nil {
-					stream.Close()
-					stream = nil
-					m.log.Debug("audio header write failed", "error", err)
-					return
+				return errTrackEnded
+			}
+			// Frames dropped ahead of this one end the batch before it,
+			// so their status objects stay in order.
+			if lost := sub.lost.take(received); lost > 0 {
+				if err := flush(); err != nil {
+					return err
 				}
+				batchLost = lost
 			}
+			received++
 
-			tsMS := uint32(frame.PTS / 1000)
-			n, err := sub.writer.WriteAudioFrame(stream, frame.Data, tsMS)
-			if err != nil {
-				m.log.Debug("audio frame write failed", "error", err)
-				return
+			batch = append(batch, frame)
+			if len(batch) < perObject {
+				continue
+			}
+			if err := flush(); err != nil {
+				return err
 			}
-			m.bytesSent.Add(n)
-			m.lastAudioTsMS.Store(int64(tsMS))
 		}
 	}
 }
 
-func (m *MoQSession) writeCaptionLoop(ctx context.Context, sub *moqTrackSub) {
+// sendDatagram sends an object datagram carrying frames frames. One the
+// connection refuses, such as when its datagram queue is full, is
+// dropped and its frames counted in dropped.
+func (m *MoQSession) sendDatagram(d []byte, frames int64, dropped *atomic.Int64) {
+	if err := m.datagrams.SendDatagram(d); err != nil {
+		dropped.Add(frames)
+		m.log.Debug("object datagram dropped", "error", err)
+		return
+	}
+	m.bytesSent.Add(int64(len(d)))
+}
+
+// writeObjectStream writes a single-object group on a fresh uni-stream,
+// the delivery pattern shared by the caption, SCTE-35 and stats tracks.
+// An object whose write times out is dropped, counted in dropped if
+// non-nil, and reported as success so the loop moves on.
+func (m *MoQSession) writeObjectStream(ctx context.Context, sub *moqTrackSub, trackID byte, groupID, tsMS uint32, data []byte, dropped *atomic.Int64) error {
+	drop := func(stream webtransport.SendStream, err error) error {
+		if dropped != nil {
+			dropped.Add(1)
+		}
+		return m.abandonStream(stream, sub, err)
+	}
+
+	stream, err := m.session.OpenUniStreamSync(ctx)
+	if err != nil {
+		if isWriteTimeout(err) {
+			return drop(nil, err)
+		}
+		return fmt.Errorf("open %s stream: %w", sub.trackName, err)
+	}
+	sub.streamCount++
+
+	if err := sub.writer.WriteStreamHeader(stream, trackID, groupID, tsMS); err != nil {
+		if isWriteTimeout(err) {
+			return drop(stream, err)
+		}
+		stream.Close()
+		return fmt.Errorf("write %s header: %w", sub.trackName, err)
+	}
+
+	n, err := sub.writer.WriteCaptionFrame(stream, data, tsMS)
+	if err != nil {
+		if isWriteTimeout(err) {
+			return drop(stream, err)
+		}
+		stream.Close()
+		return fmt.Errorf("write %s object: %w", sub.trackName, err)
+	}
+	stream.Close()
+
+	m.bytesSent.Add(n + sub.writer.StreamHeaderSize())
+	return nil
+}
+
+func (m *MoQSession) writeCaptionLoop(ctx context.Context, sub *moqTrackSub) error {
 	var groupID uint32
 
 	for {
 		select {
 		case <-ctx.Done():
-			return
+			return nil
 		case frame, ok := <-sub.captionCh:
 			if !ok {
-				return
+				return errTrackEnded
 			}
 
-			stream, err := m.session.OpenUniStreamSync(ctx)
-			if err != nil {
-				m.log.Debug("caption stream open failed", "error", err)
-				return
+			tsMS := uint32(frame.PTS / 1000)
+			data := encodeCaption(frame, m.plainCaptions)
+			if m.useDatagrams {
+				if d := sub.writer.CaptionDatagram(groupID, data, tsMS, maxObjectDatagramSize); d != nil {
+					m.sendDatagram(d, 1, &m.captionDropped)
+					groupID++
+					continue
+				}
+			}
+			if err := m.writeObjectStream(ctx, sub, TrackIDCaptions, groupID, tsMS, data, &m.captionDropped); err != nil {
+				return err
 			}
+			groupID++
+		}
+	}
+}
 
-			tsMS := uint32(frame.PTS / 1000)
-			if err := sub.writer.WriteStreamHeader(stream, TrackIDCaptions, groupID, tsMS); err != nil {
-				stream.Close()
-				m.log.Debug("caption header write failed", "error", err)
-				return
+// writeSCTE35Loop sends each SCTE-35 event as JSON on its own uni-stream,
+// following the same pattern as writeCaptionLoop. The cue's splice PTS,
+// when present, is carried as the capture timestamp.
+func (m *MoQSession) writeSCTE35Loop(ctx context.Context, sub *moqTrackSub) error {
+	var groupID uint32
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-sub.scte35Ch:
+			if !ok {
+				return errTrackEnded
 			}
 
-			data := frame.Serialize()
-			n, err := sub.writer.WriteCaptionFrame(stream, data, tsMS)
+			data, err := json.Marshal(event)
 			if err != nil {
-				stream.Close()
-				m.log.Debug("caption frame write failed", "error", err)
-				return
+				continue
 			}
 
-			m.bytesSent.Add(n + sub.writer.StreamHeaderSize())
+			tsMS := uint32(event.PTS / 1000)
+			if err := m.writeObjectStream(ctx, sub, TrackIDSCTE35, groupID, tsMS, data, nil); err != nil {
+				return err
+			}
 			groupID++
-			stream.Close()
 		}
 	}
 }
 
+// writeCatalogLoop pushes a refreshed catalog each time the relay reports
+// a change, at most once per catalogRefresh so a flapping source cannot
+// flood the viewer. The catalog sequence number is used as the group ID.
+func (m *MoQSession) writeCatalogLoop(ctx context.Context, sub *moqTrackSub, changed <-chan struct{}) error {
+	var lastPush time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-changed:
+		}
+
+		if wait := m.catalogRefresh - time.Since(lastPush); wait > 0 {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(wait):
+			}
+		}
+
+		var seq uint64
+		seq, changed = m.relay.CatalogUpdates()
+		data, err := buildMoQCatalog(m.streamKey, m.relay, seq, m.audioFirst)
+		if err != nil {
+			return fmt.Errorf("build catalog: %w", err)
+		}
+		if err := m.deliverCatalog(ctx, sub.trackAlias, seq, data); err != nil {
+			if !isWriteTimeout(err) {
+				return err
+			}
+			// The viewer keeps its previous catalog; the next change
+			// pushes a fresh copy.
+			if err := m.abandonStream(nil, sub, err); err != nil {
+				return err
+			}
+			continue
+		}
+		sub.streamCount++
+		lastPush = time.Now()
+		m.log.Debug("catalog refreshed", "sequence", seq)
+	}
+}
+
+// deliverCatalog writes one catalog revision, retrying a failed attempt up
+// to m.catalogRetries times so a transient stream-open failure does not
+// leave the viewer without a catalog. When every attempt fails it logs the
+// final error with the stream, session, and revision.
+func (m *MoQSession) deliverCatalog(ctx context.Context, alias, seq uint64, data []byte) error {
+	var err error
+	for attempt := 0; attempt <= m.catalogRetries; attempt++ {
+		if attempt > 0 {
+			m.log.Debug("retrying catalog delivery", "sequence", seq, "attempt", attempt+1, "error", err)
+			select {
+			case <-ctx.Done():
+				return err
+			case <-time.After(catalogRetryDelay):
+			}
+		}
+		if err = writeCatalogObject(ctx, m.session, alias, seq, data); err == nil {
+			return nil
+		}
+		// A write timeout means the viewer has stalled, which a retry
+		// would only wait out again.
+		if ctx.Err() != nil || isWriteTimeout(err) {
+			return err
+		}
+	}
+	m.log.Warn("catalog delivery failed",
+		"sequence", seq,
+		"attempts", m.catalogRetries+1,
+		"error", err)
+	return err
+}
+
 // handleStatsSubscribe sets up the stats track subscription and starts the write loop.
 func (m *MoQSession) handleStatsSubscribe(ctx context.Context, sub moq.Subscribe, alias uint64) {
 	subCtx, subCancel := context.WithCancel(ctx)
@@ -614,8 +1793,9 @@ func (m *MoQSession) handleStatsSubscribe(ctx context.Context, sub moq.Subscribe
 		requestID:  sub.RequestID,
 		trackAlias: alias,
 		trackName:  "stats",
-		writer:     NewMoQWriter(alias, priorityStats),
+		writer:     NewMoQWriter(alias, m.trackPriorities().Stats),
 		cancel:     subCancel,
+		done:       make(chan struct{}),
 	}
 
 	m.mu.Lock()
@@ -624,16 +1804,31 @@ func (m *MoQSession) handleStatsSubscribe(ctx context.Context, sub moq.Subscribe
 
 	m.sendSubscribeOK(sub.RequestID, alias, moq.GroupOrderAscending, false, 0, 0)
 
-	go m.writeStatsLoop(subCtx, trackSub)
+	go m.runTrack(subCtx, trackSub, m.writeStatsLoop)
 
 	m.log.Debug("stats track subscribed",
 		"alias", alias,
 		"requestID", sub.RequestID)
 }
 
+// newStatsMessage wraps a stream snapshot with this viewer's delivery
+// stats and the relay-wide health of its stream.
+func (m *MoQSession) newStatsMessage(snap StreamSnapshot) statsMessage {
+	viewerStats := m.Stats()
+	msg := statsMessage{
+		Type:        "stats",
+		Stats:       snap,
+		ViewerStats: &viewerStats,
+	}
+	if m.relay != nil {
+		msg.Relay = m.relay.Snapshot()
+	}
+	return msg
+}
+
 // writeStatsLoop sends a StreamSnapshot as JSON every second on a new uni-stream,
 // following the same pattern as writeCaptionLoop (one stream per update, incrementing groupID).
-func (m *MoQSession) writeStatsLoop(ctx context.Context, sub *moqTrackSub) {
+func (m *MoQSession) writeStatsLoop(ctx context.Context, sub *moqTrackSub) error {
 	ticker := time.NewTicker(statsInterval)
 	defer ticker.Stop()
 
@@ -642,10 +1837,10 @@ func (m *MoQSession) writeStatsLoop(ctx context.Context, sub *moqTrackSub) {
 	for {
 		select {
 		case <-ctx.Done():
-			return
+			return nil
 		case <-ticker.C:
 			if m.closed.Load() {
-				return
+				return nil
 			}
 
 			if m.statsProvider == nil {
@@ -656,39 +1851,16 @@ func (m *MoQSession) writeStatsLoop(ctx context.Context, sub *moqTrackSub) {
 				continue
 			}
 
-			viewerStats := m.Stats()
-			data, err := json.Marshal(statsMessage{
-				Type:        "stats",
-				Stats:       provider.StreamSnapshot(),
-				ViewerStats: &viewerStats,
-			})
+			data, err := json.Marshal(m.newStatsMessage(provider.StreamSnapshot()))
 			if err != nil {
 				continue
 			}
 
-			stream, err := m.session.OpenUniStreamSync(ctx)
-			if err != nil {
-				m.log.Debug("stats stream open failed", "error", err)
-				return
-			}
-
 			tsMS := uint32(time.Now().UnixMilli())
-			if err := sub.writer.WriteStreamHeader(stream, 0, groupID, tsMS); err != nil {
-				stream.Close()
-				m.log.Debug("stats header write failed", "error", err)
-				return
+			if err := m.writeObjectStream(ctx, sub, 0, groupID, tsMS, data, nil); err != nil {
+				return err
 			}
-
-			n, err := sub.writer.WriteCaptionFrame(stream, data, tsMS)
-			if err != nil {
-				stream.Close()
-				m.log.Debug("stats write failed", "error", err)
-				return
-			}
-
-			m.bytesSent.Add(n + sub.writer.StreamHeaderSize())
 			groupID++
-			stream.Close()
 		}
 	}
 }
@@ -4,13 +4,19 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
+	"os"
+	"slices"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/quic-go/quic-go"
 	"github.com/quic-go/quic-go/quicvarint"
-	"github.com/zsiec/ccx"
+	"github.com/zsiec/prism/demux"
 	"github.com/zsiec/prism/media"
 	"github.com/zsiec/prism/moq"
 	"github.com/zsiec/prism/webtransport"
@@ -144,6 +150,52 @@ func TestMoQSessionHandleSetupWrongVersion(t *testing.T) {
 	}
 }
 
+func TestMoQSessionHandleSetupDeliveryTimeout(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		clientMS uint64 // 0 sends no delivery timeout
+		want     time.Duration
+	}{
+		{"none", 0, 750 * time.Millisecond},
+		{"shorter", 300, 300 * time.Millisecond},
+		{"longer", 5000, 5 * time.Second},
+		{"capped", 3_600_000, maxClientDeliveryTimeout},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			payload := buildClientSetupPayload([]uint64{moq.Version}, "", 0)
+			if tt.clientMS > 0 {
+				payload = payload[:len(payload)-1] // drop the zero param count
+				payload = quicvarint.Append(payload, 1)
+				payload = quicvarint.Append(payload, moq.ParamDeliveryTimeout)
+				payload = quicvarint.Append(payload, tt.clientMS)
+			}
+			var controlBuf bytes.Buffer
+			if err := moq.WriteControlMsg(&controlBuf, moq.MsgClientSetup, payload); err != nil {
+				t.Fatal(err)
+			}
+
+			session := NewMoQSession(MoQSessionConfig{
+				ID:           "test-session",
+				StreamKey:    "test",
+				Control:      &mockControlStream{Reader: &controlBuf, Writer: &bytes.Buffer{}},
+				Relay:        NewRelay(),
+				WriteTimeout: 750 * time.Millisecond,
+			})
+			if _, err := session.handleSetup(); err != nil {
+				t.Fatal(err)
+			}
+			if got := session.session.(timedOpener).timeout; got != tt.want {
+				t.Errorf("write timeout = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestMoQSessionHandleSubscribeVideo(t *testing.T) {
 	t.Parallel()
 	relay := NewRelay()
@@ -208,6 +260,102 @@ func TestMoQSessionHandleSubscribeVideo(t *testing.T) {
 	}
 }
 
+func TestMoQSessionAudioFirstPriority(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		audioFirst bool
+		want       byte
+	}{
+		{"balanced", false, priorityAudio},
+		{"audio first", true, priorityAudioFirst},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			session := &MoQSession{
+				id:            "test-session",
+				streamKey:     "live",
+				control:       &mockControlStream{Reader: &bytes.Buffer{}, Writer: &bytes.Buffer{}},
+				log:           slog.With("session", "test-session"),
+				relay:         NewRelay(),
+				audioFirst:    tt.audioFirst,
+				subscriptions: make(map[string]*moqTrackSub),
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			session.handleSubscribe(ctx, moq.Subscribe{
+				RequestID:  1,
+				Namespace:  []string{"prism", "live"},
+				TrackName:  "audio0",
+				FilterType: moq.FilterNextGroupStart,
+			})
+
+			session.mu.RLock()
+			audioSub := session.subscriptions["audio0"]
+			session.mu.RUnlock()
+			if audioSub == nil {
+				t.Fatal("audio subscription not created")
+			}
+			if got := audioSub.writer.(*moqWriter).publisherPriority; got != tt.want {
+				t.Fatalf("audio publisher priority = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoQSessionConfiguredPriorities(t *testing.T) {
+	t.Parallel()
+	session := &MoQSession{
+		id:            "test-session",
+		streamKey:     "live",
+		control:       &mockControlStream{Reader: &bytes.Buffer{}, Writer: &bytes.Buffer{}},
+		log:           slog.With("session", "test-session"),
+		relay:         NewRelay(),
+		audioFirst:    true,
+		priorities:    TrackPriorities{Video: 150, Audio: 20, Captions: 10},
+		subscriptions: make(map[string]*moqTrackSub),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tests := []struct {
+		track string
+		want  byte
+	}{
+		{"video", 150},
+		{"audio0", 20}, // overrides the audio-first default
+		{"captions", 10},
+		{"scte35", prioritySCTE35},
+	}
+	for i, tt := range tests {
+		session.handleSubscribe(ctx, moq.Subscribe{
+			RequestID:  uint64(i + 1),
+			Namespace:  []string{"prism", "live"},
+			TrackName:  tt.track,
+			FilterType: moq.FilterNextGroupStart,
+		})
+
+		session.mu.RLock()
+		sub := session.subscriptions[tt.track]
+		session.mu.RUnlock()
+		if sub == nil {
+			t.Fatalf("%s subscription not created", tt.track)
+		}
+
+		// The publisher priority is the last byte of the subgroup header.
+		var hdr bytes.Buffer
+		if err := sub.writer.WriteStreamHeader(&hdr, 0, 7, 0); err != nil {
+			t.Fatal(err)
+		}
+		if got := hdr.Bytes()[hdr.Len()-1]; got != tt.want {
+			t.Errorf("%s header priority = %d, want %d", tt.track, got, tt.want)
+		}
+	}
+}
+
 func TestMoQSessionHandleSubscribeAudio(t *testing.T) {
 	t.Parallel()
 	relay := NewRelay()
@@ -340,8 +488,274 @@ func TestMoQSessionHandleSubscribeUnknownTrack(t *testing.T) {
 	if reqID != 4 {
 		t.Fatalf("requestID = %d, want 4", reqID)
 	}
-	if errCode != 404 {
-		t.Fatalf("errorCode = %d, want 404", errCode)
+	if moq.SubscribeErrorCode(errCode) != moq.SubscribeErrorTrackDoesNotExist {
+		t.Fatalf("errorCode = %d, want %d", errCode, moq.SubscribeErrorTrackDoesNotExist)
+	}
+}
+
+func TestMoQSessionSubscribeErrorCodes(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		sub       moq.Subscribe
+		audioOnly bool
+		dvr       bool
+		want      moq.SubscribeErrorCode
+	}{
+		{
+			name: "unknown track",
+			sub:  moq.Subscribe{RequestID: 1, Namespace: []string{"prism", "live"}, TrackName: "bogus", FilterType: moq.FilterNextGroupStart},
+			want: moq.SubscribeErrorTrackDoesNotExist,
+		},
+		{
+			name: "bad audio index",
+			sub:  moq.Subscribe{RequestID: 2, Namespace: []string{"prism", "live"}, TrackName: "audio-1", FilterType: moq.FilterNextGroupStart},
+			want: moq.SubscribeErrorTrackDoesNotExist,
+		},
+		{
+			name: "wrong namespace",
+			sub:  moq.Subscribe{RequestID: 3, Namespace: []string{"other", "live"}, TrackName: "video", FilterType: moq.FilterNextGroupStart},
+			want: moq.SubscribeErrorTrackDoesNotExist,
+		},
+		{
+			name: "wrong stream key",
+			sub:  moq.Subscribe{RequestID: 4, Namespace: []string{"prism", "elsewhere"}, TrackName: "video", FilterType: moq.FilterNextGroupStart},
+			want: moq.SubscribeErrorTrackDoesNotExist,
+		},
+		{
+			name: "absolute start filter on audio",
+			sub:  moq.Subscribe{RequestID: 5, Namespace: []string{"prism", "live"}, TrackName: "audio0", FilterType: moq.FilterAbsoluteStart},
+			want: moq.SubscribeErrorNotSupported,
+		},
+		{
+			name: "absolute range filter",
+			sub:  moq.Subscribe{RequestID: 6, Namespace: []string{"prism", "live"}, TrackName: "video", FilterType: moq.FilterAbsoluteRange, StartGroup: 2, EndGroup: 5},
+			want: moq.SubscribeErrorNotSupported,
+		},
+		{
+			name: "inverted absolute range",
+			sub:  moq.Subscribe{RequestID: 7, Namespace: []string{"prism", "live"}, TrackName: "video", FilterType: moq.FilterAbsoluteRange, StartGroup: 5, EndGroup: 2},
+			want: moq.SubscribeErrorInvalidRange,
+		},
+		{
+			name:      "video on audio-only stream",
+			sub:       moq.Subscribe{RequestID: 8, Namespace: []string{"prism", "live"}, TrackName: "video", FilterType: moq.FilterNextGroupStart},
+			audioOnly: true,
+			want:      moq.SubscribeErrorTrackDoesNotExist,
+		},
+		{
+			name: "absolute start outside DVR window",
+			sub:  moq.Subscribe{RequestID: 9, Namespace: []string{"prism", "live"}, TrackName: "video", FilterType: moq.FilterAbsoluteStart, StartGroup: 50},
+			dvr:  true,
+			want: moq.SubscribeErrorInvalidRange,
+		},
+		{
+			name: "absolute filter on audio with DVR",
+			sub:  moq.Subscribe{RequestID: 10, Namespace: []string{"prism", "live"}, TrackName: "audio0", FilterType: moq.FilterAbsoluteStart},
+			dvr:  true,
+			want: moq.SubscribeErrorNotSupported,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			responseBuf := &bytes.Buffer{}
+			relay := NewRelay()
+			if tt.audioOnly {
+				relay.SetHasVideo(false)
+			}
+			if tt.dvr {
+				relay.SetDVRWindow(time.Minute)
+				relay.BroadcastVideo(&media.VideoFrame{IsKeyframe: true, GroupID: 1})
+			}
+			session := &MoQSession{
+				id:            "test-session",
+				streamKey:     "live",
+				control:       &mockControlStream{Reader: &bytes.Buffer{}, Writer: responseBuf},
+				log:           slog.With("session", "test-session"),
+				relay:         relay,
+				subscriptions: make(map[string]*moqTrackSub),
+			}
+
+			session.handleSubscribe(context.Background(), tt.sub)
+
+			msgType, payload, err := moq.ReadControlMsg(responseBuf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if msgType != moq.MsgSubscribeError {
+				t.Fatalf("response type = %#x, want SUBSCRIBE_ERROR", msgType)
+			}
+			reqID, off := readVarint(payload, 0)
+			code, _ := readVarint(payload, off)
+			if reqID != tt.sub.RequestID {
+				t.Errorf("requestID = %d, want %d", reqID, tt.sub.RequestID)
+			}
+			if got := moq.SubscribeErrorCode(code); got != tt.want {
+				t.Errorf("errorCode = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoQSessionRequestIDLimit(t *testing.T) {
+	t.Parallel()
+
+	var controlBuf bytes.Buffer
+	if err := moq.WriteControlMsg(&controlBuf, moq.MsgClientSetup, buildClientSetupPayload([]uint64{moq.Version}, "", 0)); err != nil {
+		t.Fatal(err)
+	}
+	responseBuf := &bytes.Buffer{}
+	control := &mockControlStream{Reader: &controlBuf, Writer: responseBuf}
+	session := &MoQSession{
+		id:            "test-session",
+		streamKey:     "live",
+		control:       control,
+		controlReader: bufio.NewReader(control),
+		log:           slog.With("session", "test-session"),
+		relay:         NewRelay(),
+		subscriptions: make(map[string]*moqTrackSub),
+		maxRequests:   4,
+	}
+	if _, err := session.handleSetup(); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []uint64{moq.MsgServerSetup, moq.MsgMaxRequestID} {
+		msgType, payload, err := moq.ReadControlMsg(responseBuf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msgType != want {
+			t.Fatalf("setup response type = %#x, want %#x", msgType, want)
+		}
+		if msgType == moq.MsgMaxRequestID {
+			if got, _ := readVarint(payload, 0); got != 4 {
+				t.Fatalf("initial MAX_REQUEST_ID = %d, want 4", got)
+			}
+		}
+	}
+
+	// Each request is for an unknown track, so one admitted under the
+	// limit fails with TRACK_DOES_NOT_EXIST instead of TOO_MANY_REQUESTS.
+	steps := []struct {
+		requestID uint64
+		wantMax   uint64 // MAX_REQUEST_ID sent first, or zero for none
+		want      moq.SubscribeErrorCode
+	}{
+		{requestID: 0, want: moq.SubscribeErrorTrackDoesNotExist},
+		{requestID: 4, want: moq.SubscribeErrorTooManyRequests},
+		{requestID: 2, wantMax: 7, want: moq.SubscribeErrorTrackDoesNotExist},
+		{requestID: 6, wantMax: 11, want: moq.SubscribeErrorTrackDoesNotExist},
+		{requestID: 12, want: moq.SubscribeErrorTooManyRequests},
+	}
+	for _, step := range steps {
+		session.handleSubscribe(context.Background(), moq.Subscribe{
+			RequestID:  step.requestID,
+			Namespace:  []string{"prism", "live"},
+			TrackName:  "bogus",
+			FilterType: moq.FilterNextGroupStart,
+		})
+
+		msgType, payload, err := moq.ReadControlMsg(responseBuf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if step.wantMax != 0 {
+			if msgType != moq.MsgMaxRequestID {
+				t.Fatalf("request %d: response type = %#x, want MAX_REQUEST_ID", step.requestID, msgType)
+			}
+			if got, _ := readVarint(payload, 0); got != step.wantMax {
+				t.Errorf("request %d: MAX_REQUEST_ID = %d, want %d", step.requestID, got, step.wantMax)
+			}
+			if msgType, payload, err = moq.ReadControlMsg(responseBuf); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if msgType != moq.MsgSubscribeError {
+			t.Fatalf("request %d: response type = %#x, want SUBSCRIBE_ERROR", step.requestID, msgType)
+		}
+		reqID, off := readVarint(payload, 0)
+		code, _ := readVarint(payload, off)
+		if reqID != step.requestID {
+			t.Errorf("requestID = %d, want %d", reqID, step.requestID)
+		}
+		if got := moq.SubscribeErrorCode(code); got != step.want {
+			t.Errorf("request %d: errorCode = %s, want %s", step.requestID, got, step.want)
+		}
+	}
+	if responseBuf.Len() != 0 {
+		t.Errorf("%d unexpected bytes left on the control stream", responseBuf.Len())
+	}
+}
+
+func TestMoQSessionSubscribeAuthorization(t *testing.T) {
+	t.Parallel()
+
+	authorize := func(streamKey, trackName, token string) error {
+		if streamKey != "live" || trackName != "captions" {
+			return fmt.Errorf("unexpected subscription %s/%s", streamKey, trackName)
+		}
+		if token != "good" {
+			return errors.New("bad token")
+		}
+		return nil
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		want  uint64
+	}{
+		{"accepted", "good", moq.MsgSubscribeOK},
+		{"rejected", "bad", moq.MsgSubscribeError},
+		{"missing", "", moq.MsgSubscribeError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			responseBuf := &bytes.Buffer{}
+			session := &MoQSession{
+				id:            "test-session",
+				streamKey:     "live",
+				control:       &mockControlStream{Reader: &bytes.Buffer{}, Writer: responseBuf},
+				log:           slog.With("session", "test-session"),
+				relay:         NewRelay(),
+				authorize:     authorize,
+				subscriptions: make(map[string]*moqTrackSub),
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			session.handleSubscribe(ctx, moq.Subscribe{
+				RequestID:  1,
+				Namespace:  []string{"prism", "live"},
+				TrackName:  "captions",
+				FilterType: moq.FilterNextGroupStart,
+				AuthToken:  tt.token,
+			})
+
+			msgType, payload, err := moq.ReadControlMsg(responseBuf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if msgType != tt.want {
+				t.Fatalf("response type = %#x, want %#x", msgType, tt.want)
+			}
+			if msgType == moq.MsgSubscribeError {
+				_, off := readVarint(payload, 0)
+				if code, _ := readVarint(payload, off); moq.SubscribeErrorCode(code) != moq.SubscribeErrorUnauthorized {
+					t.Errorf("errorCode = %s, want %s", moq.SubscribeErrorCode(code), moq.SubscribeErrorUnauthorized)
+				}
+				session.mu.RLock()
+				defer session.mu.RUnlock()
+				if len(session.subscriptions) != 0 {
+					t.Errorf("rejected SUBSCRIBE created %d subscriptions", len(session.subscriptions))
+				}
+			}
+		})
 	}
 }
 
@@ -381,6 +795,69 @@ func TestMoQSessionHandleSubscribeWrongNamespace(t *testing.T) {
 	}
 }
 
+func TestMoQSessionDVRSubscribe(t *testing.T) {
+	t.Parallel()
+	relay := NewRelay()
+	relay.SetDVRWindow(time.Minute)
+	for g := uint32(1); g <= 3; g++ {
+		base := int64(g) * 1_000_000
+		relay.BroadcastVideo(&media.VideoFrame{PTS: base, DTS: base, IsKeyframe: true, GroupID: g})
+		relay.BroadcastVideo(&media.VideoFrame{PTS: base + 33_000, DTS: base + 33_000, GroupID: g})
+	}
+
+	responseBuf := &bytes.Buffer{}
+	session := &MoQSession{
+		id:            "test-session",
+		streamKey:     "live",
+		control:       &mockControlStream{Reader: &bytes.Buffer{}, Writer: responseBuf},
+		log:           slog.With("session", "test-session"),
+		relay:         relay,
+		subscriptions: make(map[string]*moqTrackSub),
+	}
+
+	// A cancelled context stops the write loop before it touches the
+	// (absent) WebTransport session.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	session.handleSubscribe(ctx, moq.Subscribe{
+		RequestID:  1,
+		Namespace:  []string{"prism", "live"},
+		TrackName:  "video",
+		FilterType: moq.FilterAbsoluteRange,
+		StartGroup: 2,
+		EndGroup:   2,
+	})
+
+	msgType, payload, err := moq.ReadControlMsg(responseBuf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msgType != moq.MsgSubscribeOK {
+		t.Fatalf("response type = %#x, want SUBSCRIBE_OK", msgType)
+	}
+	// RequestID, TrackAlias, Expires, GroupOrder, ContentExists, LargestGroup.
+	_, off := readVarint(payload, 0)
+	_, off = readVarint(payload, off)
+	_, off = readVarint(payload, off)
+	off++ // group order
+	if payload[off] != 1 {
+		t.Fatal("SUBSCRIBE_OK should report existing content")
+	}
+	if largest, _ := readVarint(payload, off+1); largest != 3 {
+		t.Errorf("largest group = %d, want 3", largest)
+	}
+
+	session.mu.RLock()
+	videoSub := session.subscriptions["video"]
+	session.mu.RUnlock()
+	if videoSub == nil {
+		t.Fatal("video subscription not created")
+	}
+	if !videoSub.hasEnd || videoSub.endGroup != 2 {
+		t.Errorf("endGroup = %d (hasEnd=%v), want 2", videoSub.endGroup, videoSub.hasEnd)
+	}
+}
+
 func TestMoQSessionHandleSubscribeUnsupportedFilter(t *testing.T) {
 	t.Parallel()
 	relay := NewRelay()
@@ -403,7 +880,9 @@ func TestMoQSessionHandleSubscribeUnsupportedFilter(t *testing.T) {
 		RequestID:  6,
 		Namespace:  []string{"prism", "live"},
 		TrackName:  "video",
-		FilterType: moq.FilterAbsoluteStart,
+		FilterType: moq.FilterAbsoluteRange,
+		StartGroup: 1,
+		EndGroup:   2,
 	}
 
 	session.handleSubscribe(context.Background(), sub)
@@ -544,7 +1023,7 @@ func TestMoQSessionSendCaptionsNoSub(t *testing.T) {
 		subscriptions: make(map[string]*moqTrackSub),
 	}
 
-	frame := &ccx.CaptionFrame{PTS: 1000000, Text: "Hello"}
+	frame := &media.CaptionFrame{PTS: 1000000, Text: "Hello"}
 	session.SendCaptions(frame)
 
 	if session.captionSent.Load() != 0 {
@@ -552,6 +1031,1252 @@ func TestMoQSessionSendCaptionsNoSub(t *testing.T) {
 	}
 }
 
+func TestMoQSessionSendSCTE35(t *testing.T) {
+	t.Parallel()
+	session := &MoQSession{
+		id:            "test-session",
+		streamKey:     "live",
+		log:           slog.With("session", "test-session"),
+		subscriptions: make(map[string]*moqTrackSub),
+	}
+
+	event := &demux.SCTE35Event{PTS: 900000, CommandType: "time_signal"}
+
+	// No subscription: dropped silently.
+	session.SendSCTE35(event)
+
+	sub := &moqTrackSub{trackName: "scte35", scte35Ch: make(chan *demux.SCTE35Event, 1)}
+	session.subscriptions["scte35"] = sub
+
+	session.SendSCTE35(event)
+	session.SendSCTE35(event) // full: dropped, must not block
+
+	select {
+	case got := <-sub.scte35Ch:
+		if got != event {
+			t.Fatal("unexpected event on scte35 channel")
+		}
+	default:
+		t.Fatal("expected event on scte35 channel")
+	}
+	if len(sub.scte35Ch) != 0 {
+		t.Fatalf("channel depth = %d, want 0", len(sub.scte35Ch))
+	}
+}
+
+func TestMoQSessionRunTrackReportsExit(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		loopErr    error
+		cancel     bool
+		wantDone   bool
+		wantStatus moq.SubscribeDoneStatus
+	}{
+		{name: "write failure", loopErr: errors.New("open video stream: boom"), wantDone: true, wantStatus: moq.SubscribeDoneInternal},
+		{name: "range complete", loopErr: errSubscriptionComplete, wantDone: true, wantStatus: moq.SubscribeDoneSubscriptionEnded},
+		{name: "source closed", loopErr: errTrackEnded, wantDone: true, wantStatus: moq.SubscribeDoneTrackEnded},
+		{name: "viewer stalled", loopErr: fmt.Errorf("%w: %w", errViewerStalled, errWriteTimeout), wantDone: true, wantStatus: moq.SubscribeDoneTooFarBehind},
+		{name: "unsubscribed", cancel: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			responseBuf := &bytes.Buffer{}
+			session := &MoQSession{
+				id:            "test-session",
+				streamKey:     "live",
+				control:       &mockControlStream{Reader: &bytes.Buffer{}, Writer: responseBuf},
+				log:           slog.With("session", "test-session"),
+				subscriptions: make(map[string]*moqTrackSub),
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			sub := &moqTrackSub{requestID: 4, trackName: "video", cancel: cancel, done: make(chan struct{})}
+			session.subscriptions["video"] = sub
+
+			session.runTrack(ctx, sub, func(ctx context.Context, sub *moqTrackSub) error {
+				sub.streamCount = 3
+				if tt.cancel {
+					cancel()
+				}
+				return tt.loopErr
+			})
+
+			select {
+			case <-sub.done:
+			default:
+				t.Fatal("done channel not closed after loop exit")
+			}
+
+			if !tt.wantDone {
+				if responseBuf.Len() != 0 {
+					t.Fatal("cancelled loop should not send SUBSCRIBE_DONE")
+				}
+				return
+			}
+
+			msgType, payload, err := moq.ReadControlMsg(responseBuf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if msgType != moq.MsgSubscribeDone {
+				t.Fatalf("response type = %#x, want SUBSCRIBE_DONE", msgType)
+			}
+			reqID, off := readVarint(payload, 0)
+			status, off := readVarint(payload, off)
+			count, _ := readVarint(payload, off)
+			if reqID != 4 {
+				t.Errorf("requestID = %d, want 4", reqID)
+			}
+			if got := moq.SubscribeDoneStatus(status); got != tt.wantStatus {
+				t.Errorf("status = %s, want %s", got, tt.wantStatus)
+			}
+			if count != 3 {
+				t.Errorf("streamCount = %d, want 3", count)
+			}
+
+			session.mu.RLock()
+			_, still := session.subscriptions["video"]
+			session.mu.RUnlock()
+			if still {
+				t.Error("failed subscription should be removed so the client can resubscribe")
+			}
+		})
+	}
+}
+
+func TestMoQSessionWriteTimeoutDropsGroup(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		opener  *mockStreamOpener
+		stalled bool // the first stream opened should have been reset
+	}{
+		{name: "stalled write", opener: &mockStreamOpener{stallWrites: 1}, stalled: true},
+		{name: "stalled open", opener: &mockStreamOpener{stallOpens: 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			session := &MoQSession{
+				id:            "test-session",
+				streamKey:     "live",
+				log:           slog.With("session", "test-session"),
+				session:       timedOpener{uniStreamOpener: tt.opener, timeout: 20 * time.Millisecond},
+				subscriptions: make(map[string]*moqTrackSub),
+			}
+			sub := &moqTrackSub{
+				trackName: "video",
+				writer:    NewMoQWriter(1, priorityVideo),
+				videoCh:   make(chan *media.VideoFrame, 8),
+			}
+
+			// Group 1 hits the stalled viewer; group 2 must still arrive.
+			sub.videoCh <- &media.VideoFrame{GroupID: 1, IsKeyframe: true, PTS: 0, WireData: []byte{1}}
+			sub.videoCh <- &media.VideoFrame{GroupID: 1, PTS: 33000, WireData: []byte{2}}
+			sub.videoCh <- &media.VideoFrame{GroupID: 2, IsKeyframe: true, PTS: 66000, WireData: []byte{3}}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			loopErr := make(chan error, 1)
+			go func() { loopErr <- session.writeVideoLoop(ctx, sub) }()
+
+			deadline := time.After(5 * time.Second)
+			for !tt.opener.delivered() {
+				select {
+				case <-deadline:
+					t.Fatal("write loop did not recover from the stalled viewer")
+				case <-time.After(5 * time.Millisecond):
+				}
+			}
+			cancel()
+			if err := <-loopErr; err != nil {
+				t.Fatalf("writeVideoLoop = %v, want nil after cancel", err)
+			}
+
+			stats := session.Stats()
+			if stats.VideoDropped != 2 {
+				t.Errorf("VideoDropped = %d, want 2 (stalled keyframe and its delta)", stats.VideoDropped)
+			}
+			if stats.WriteTimeouts != 1 {
+				t.Errorf("WriteTimeouts = %d, want 1", stats.WriteTimeouts)
+			}
+			streams := tt.opener.opened()
+			if tt.stalled {
+				if len(streams) != 2 {
+					t.Fatalf("opened %d streams, want 2", len(streams))
+				}
+				if !streams[0].wasCancelled() {
+					t.Error("stalled stream was not reset")
+				}
+			} else if len(streams) != 1 {
+				t.Fatalf("opened %d streams, want 1", len(streams))
+			}
+		})
+	}
+}
+
+func TestMoQSessionWriteTimeoutEndsTrack(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		sub  func() *moqTrackSub
+		loop func(*MoQSession) func(context.Context, *moqTrackSub) error
+	}{
+		{
+			name: "video",
+			sub: func() *moqTrackSub {
+				sub := &moqTrackSub{trackName: "video", writer: NewMoQWriter(1, priorityVideo), videoCh: make(chan *media.VideoFrame, 4)}
+				sub.videoCh <- &media.VideoFrame{GroupID: 1, IsKeyframe: true, WireData: []byte{1}}
+				sub.videoCh <- &media.VideoFrame{GroupID: 2, IsKeyframe: true, PTS: 33000, WireData: []byte{2}}
+				return sub
+			},
+			loop: func(m *MoQSession) func(context.Context, *moqTrackSub) error { return m.writeVideoLoop },
+		},
+		{
+			name: "audio",
+			sub: func() *moqTrackSub {
+				sub := &moqTrackSub{trackName: "audio0", writer: NewMoQWriter(2, priorityAudio), audioCh: make(chan *media.AudioFrame, 4)}
+				sub.audioCh <- &media.AudioFrame{Data: []byte{1}}
+				sub.audioCh <- &media.AudioFrame{PTS: 21000, Data: []byte{2}}
+				return sub
+			},
+			loop: func(m *MoQSession) func(context.Context, *moqTrackSub) error { return m.writeAudioLoop },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			// The viewer never drains its first stream.
+			opener := &mockStreamOpener{stallWrites: 1}
+			responseBuf := &bytes.Buffer{}
+			session := &MoQSession{
+				id:                     "test-session",
+				streamKey:              "live",
+				control:                &mockControlStream{Reader: &bytes.Buffer{}, Writer: responseBuf},
+				log:                    slog.With("session", "test-session"),
+				session:                timedOpener{uniStreamOpener: opener, timeout: 20 * time.Millisecond},
+				subscriptions:          make(map[string]*moqTrackSub),
+				endTrackOnWriteTimeout: true,
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			sub := tt.sub()
+			sub.requestID, sub.cancel, sub.done = 3, cancel, make(chan struct{})
+			session.subscriptions[sub.trackName] = sub
+
+			finished := make(chan struct{})
+			go func() {
+				session.runTrack(ctx, sub, tt.loop(session))
+				close(finished)
+			}()
+			select {
+			case <-finished:
+			case <-time.After(5 * time.Second):
+				t.Fatal("write loop still blocked on the stalled viewer")
+			}
+
+			msgType, payload, err := moq.ReadControlMsg(responseBuf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if msgType != moq.MsgSubscribeDone {
+				t.Fatalf("response type = %#x, want SUBSCRIBE_DONE", msgType)
+			}
+			_, off := readVarint(payload, 0)
+			if status, _ := readVarint(payload, off); moq.SubscribeDoneStatus(status) != moq.SubscribeDoneTooFarBehind {
+				t.Errorf("status = %s, want %s", moq.SubscribeDoneStatus(status), moq.SubscribeDoneTooFarBehind)
+			}
+
+			streams := opener.opened()
+			if len(streams) != 1 {
+				t.Fatalf("opened %d streams, want 1: the track should end at the stalled one", len(streams))
+			}
+			if !streams[0].wasCancelled() {
+				t.Error("stalled stream was not reset")
+			}
+			if got := session.Stats().WriteTimeouts; got != 1 {
+				t.Errorf("WriteTimeouts = %d, want 1", got)
+			}
+			session.mu.RLock()
+			defer session.mu.RUnlock()
+			if _, still := session.subscriptions[sub.trackName]; still {
+				t.Error("subscription not removed after its track ended")
+			}
+		})
+	}
+}
+
+func TestMoQSessionSubscribeLiveEdge(t *testing.T) {
+	t.Parallel()
+	relay := NewRelay()
+	frame := func(group uint32, dts int64, key bool) *media.VideoFrame {
+		return &media.VideoFrame{GroupID: group, PTS: dts, DTS: dts, IsKeyframe: key, WireData: []byte{byte(dts / 1000)}}
+	}
+	relay.BroadcastVideo(frame(1, 1_000_000, true))
+	relay.BroadcastVideo(frame(1, 1_033_000, false))
+
+	opener := &mockStreamOpener{}
+	responseBuf := &bytes.Buffer{}
+	session := &MoQSession{
+		id:            "test-session",
+		streamKey:     "live",
+		session:       opener,
+		control:       &mockControlStream{Reader: &bytes.Buffer{}, Writer: responseBuf},
+		log:           slog.With("session", "test-session"),
+		relay:         relay,
+		subscriptions: make(map[string]*moqTrackSub),
+	}
+	relay.AddViewer(session)
+	defer relay.RemoveViewer(session.ID())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	session.handleSubscribe(ctx, moq.Subscribe{
+		RequestID:  1,
+		Namespace:  []string{"prism", "live"},
+		TrackName:  "video",
+		FilterType: moq.FilterNextGroupStart,
+		LiveEdge:   true,
+	})
+
+	msgType, payload, err := moq.ReadControlMsg(responseBuf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msgType != moq.MsgSubscribeOK {
+		t.Fatalf("response type = %#x, want SUBSCRIBE_OK", msgType)
+	}
+	_, off := readVarint(payload, 0)  // request ID
+	_, off = readVarint(payload, off) // track alias
+	_, off = readVarint(payload, off) // expires
+	if contentExists := payload[off+1]; contentExists != 1 {
+		t.Errorf("content exists = %d, want 1 with a cached group", contentExists)
+	}
+
+	// The rest of the cached group is skipped; delivery starts with the
+	// next keyframe.
+	relay.BroadcastVideo(frame(1, 1_066_000, false))
+	relay.BroadcastVideo(frame(2, 2_000_000, true))
+	relay.BroadcastVideo(frame(2, 2_033_000, false))
+
+	var objs [][2]uint64
+	deadline := time.After(5 * time.Second)
+	for len(objs) < 2 {
+		select {
+		case <-deadline:
+			t.Fatalf("objects = %v, want 2", objs)
+		case <-time.After(5 * time.Millisecond):
+		}
+		objs = nil
+		for _, s := range opener.opened() {
+			o, _ := parseVideoObjects(t, s.bytes())
+			objs = append(objs, o...)
+		}
+	}
+	if want := [][2]uint64{{2, 0}, {2, 1}}; !slices.Equal(objs, want) {
+		t.Errorf("objects = %v, want %v", objs, want)
+	}
+}
+
+func TestMoQSessionSubscribeOKLargest(t *testing.T) {
+	t.Parallel()
+	key := &media.VideoFrame{GroupID: 3, PTS: 3_000_000, DTS: 3_000_000, IsKeyframe: true,
+		NALUs: [][]byte{{0x65, 0x88, 0x80}, {0x65, 0x88, 0x40}}}
+	delta := func(dts int64) *media.VideoFrame {
+		return &media.VideoFrame{GroupID: 3, PTS: dts, DTS: dts, NALUs: [][]byte{{0x41, 0x9A}}}
+	}
+
+	tests := []struct {
+		name      string
+		track     string
+		mode      VideoObjectMode
+		liveEdge  bool
+		cached    bool
+		wantExist bool
+		wantGroup uint64
+		wantObj   uint64
+	}{
+		{name: "empty relay", track: "video"},
+		{name: "cached group", track: "video", cached: true, wantExist: true, wantGroup: 3, wantObj: 2},
+		{name: "object per slice", track: "video", mode: VideoObjectPerNAL, cached: true, wantExist: true, wantGroup: 3, wantObj: 3},
+		{name: "live edge", track: "video", liveEdge: true, cached: true, wantExist: true, wantGroup: 3, wantObj: 2},
+		{name: "live edge per slice", track: "video", mode: VideoObjectPerNAL, liveEdge: true, cached: true, wantExist: true, wantGroup: 3, wantObj: 3},
+		{name: "captions", track: "captions", cached: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			relay := NewRelay()
+			if tt.cached {
+				k := *key
+				relay.BroadcastVideo(&k)
+				relay.BroadcastVideo(delta(3_033_000))
+				relay.BroadcastVideo(delta(3_066_000))
+			}
+
+			responseBuf := &bytes.Buffer{}
+			session := &MoQSession{
+				id:            "test-session",
+				streamKey:     "live",
+				control:       &mockControlStream{Reader: &bytes.Buffer{}, Writer: responseBuf},
+				log:           slog.With("session", "test-session"),
+				relay:         relay,
+				videoObjects:  tt.mode,
+				subscriptions: make(map[string]*moqTrackSub),
+			}
+
+			// A cancelled context stops the write loop before it touches
+			// the (absent) WebTransport session.
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			session.handleSubscribe(ctx, moq.Subscribe{
+				RequestID:  1,
+				Namespace:  []string{"prism", "live"},
+				TrackName:  tt.track,
+				FilterType: moq.FilterNextGroupStart,
+				LiveEdge:   tt.liveEdge,
+			})
+
+			msgType, payload, err := moq.ReadControlMsg(responseBuf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if msgType != moq.MsgSubscribeOK {
+				t.Fatalf("response type = %#x, want SUBSCRIBE_OK", msgType)
+			}
+			_, off := readVarint(payload, 0)  // request ID
+			_, off = readVarint(payload, off) // track alias
+			_, off = readVarint(payload, off) // expires
+			off++                             // group order
+			if exists := payload[off] == 1; exists != tt.wantExist {
+				t.Fatalf("content exists = %v, want %v", exists, tt.wantExist)
+			}
+			if !tt.wantExist {
+				return
+			}
+			group, off := readVarint(payload, off+1)
+			obj, _ := readVarint(payload, off)
+			if group != tt.wantGroup || obj != tt.wantObj {
+				t.Errorf("largest = (%d, %d), want (%d, %d)", group, obj, tt.wantGroup, tt.wantObj)
+			}
+		})
+	}
+}
+
+func TestMoQSessionSubscribeResume(t *testing.T) {
+	t.Parallel()
+	frame := func(group uint32, dts int64, key bool) *media.VideoFrame {
+		return &media.VideoFrame{GroupID: group, PTS: dts, DTS: dts, IsKeyframe: key, WireData: []byte{byte(dts / 1000)}}
+	}
+
+	// Group 2 is cached when a client that dropped resubscribes.
+	tests := []struct {
+		name       string
+		startGroup uint64
+		want       [][2]uint64
+	}{
+		{"cached group", 2, [][2]uint64{{2, 0}, {2, 1}, {2, 2}, {3, 0}, {3, 1}}},
+		{"after cached group", 3, [][2]uint64{{3, 0}, {3, 1}}},
+		{"evicted group", 1, [][2]uint64{{2, 0}, {2, 1}, {2, 2}, {3, 0}, {3, 1}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			relay := NewRelay()
+			relay.BroadcastVideo(frame(1, 1_000_000, true))
+			relay.BroadcastVideo(frame(2, 2_000_000, true))
+			relay.BroadcastVideo(frame(2, 2_033_000, false))
+
+			opener := &mockStreamOpener{}
+			responseBuf := &bytes.Buffer{}
+			session := &MoQSession{
+				id:            "test-session",
+				streamKey:     "live",
+				session:       opener,
+				control:       &mockControlStream{Reader: &bytes.Buffer{}, Writer: responseBuf},
+				log:           slog.With("session", "test-session"),
+				relay:         relay,
+				subscriptions: make(map[string]*moqTrackSub),
+			}
+			relay.AddViewer(session)
+			defer relay.RemoveViewer(session.ID())
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			session.handleSubscribe(ctx, moq.Subscribe{
+				RequestID:  1,
+				Namespace:  []string{"prism", "live"},
+				TrackName:  "video",
+				FilterType: moq.FilterAbsoluteStart,
+				StartGroup: tt.startGroup,
+			})
+			if msgType, _, err := moq.ReadControlMsg(responseBuf); err != nil || msgType != moq.MsgSubscribeOK {
+				t.Fatalf("response type = %#x (%v), want SUBSCRIBE_OK", msgType, err)
+			}
+
+			relay.BroadcastVideo(frame(2, 2_066_000, false))
+			relay.BroadcastVideo(frame(3, 3_000_000, true))
+			relay.BroadcastVideo(frame(3, 3_033_000, false))
+
+			var objs [][2]uint64
+			deadline := time.After(5 * time.Second)
+			for len(objs) < len(tt.want) {
+				select {
+				case <-deadline:
+					t.Fatalf("objects = %v, want %v", objs, tt.want)
+				case <-time.After(5 * time.Millisecond):
+				}
+				objs = nil
+				for _, s := range opener.opened() {
+					o, _ := parseVideoObjects(t, s.bytes())
+					objs = append(objs, o...)
+				}
+			}
+			if !slices.Equal(objs, tt.want) {
+				t.Errorf("objects = %v, want %v", objs, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoQSessionJoiningFetchSeam(t *testing.T) {
+	t.Parallel()
+	relay := NewRelay()
+	frame := func(group uint32, dts int64, key bool) *media.VideoFrame {
+		return &media.VideoFrame{GroupID: group, PTS: dts, DTS: dts, IsKeyframe: key, WireData: []byte{byte(dts / 1000)}}
+	}
+	relay.BroadcastVideo(frame(1, 1_000_000, true))
+	relay.BroadcastVideo(frame(1, 1_033_000, false))
+	relay.BroadcastVideo(frame(1, 1_066_000, false))
+
+	opener := &mockStreamOpener{}
+	responseBuf := &bytes.Buffer{}
+	session := &MoQSession{
+		id:            "test-session",
+		streamKey:     "live",
+		session:       opener,
+		control:       &mockControlStream{Reader: &bytes.Buffer{}, Writer: responseBuf},
+		log:           slog.With("session", "test-session"),
+		relay:         relay,
+		subscriptions: make(map[string]*moqTrackSub),
+	}
+	relay.AddViewer(session)
+	defer relay.RemoveViewer(session.ID())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	session.handleSubscribe(ctx, moq.Subscribe{
+		RequestID:  1,
+		Namespace:  []string{"prism", "live"},
+		TrackName:  "video",
+		FilterType: moq.FilterLatestObject,
+	})
+	session.handleFetch(ctx, moq.Fetch{
+		RequestID:        2,
+		FetchType:        moq.FetchRelativeJoining,
+		JoiningRequestID: 1,
+		JoiningStart:     0,
+	})
+
+	for _, want := range []uint64{moq.MsgSubscribeOK, moq.MsgFetchOK} {
+		msgType, _, err := moq.ReadControlMsg(responseBuf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msgType != want {
+			t.Fatalf("response type = %#x, want %#x", msgType, want)
+		}
+	}
+
+	// The rest of group 1 and all of group 2 arrive live.
+	relay.BroadcastVideo(frame(1, 1_099_000, false))
+	relay.BroadcastVideo(frame(2, 2_000_000, true))
+	relay.BroadcastVideo(frame(2, 2_033_000, false))
+
+	var fetched, live [][2]uint64
+	deadline := time.After(5 * time.Second)
+	for len(fetched)+len(live) < 6 {
+		select {
+		case <-deadline:
+			t.Fatalf("fetched %v, live %v; want 6 objects in total", fetched, live)
+		case <-time.After(5 * time.Millisecond):
+		}
+		fetched, live = nil, nil
+		for _, s := range opener.opened() {
+			objs, isFetch := parseVideoObjects(t, s.bytes())
+			if isFetch {
+				fetched = append(fetched, objs...)
+			} else {
+				live = append(live, objs...)
+			}
+		}
+	}
+
+	wantFetched := [][2]uint64{{1, 0}, {1, 1}, {1, 2}}
+	if !slices.Equal(fetched, wantFetched) {
+		t.Errorf("fetched objects = %v, want %v", fetched, wantFetched)
+	}
+	all := append(fetched, live...)
+	for i := 1; i < len(all); i++ {
+		prev, cur := all[i-1], all[i]
+		next := cur[0] == prev[0] && cur[1] == prev[1]+1
+		newGroup := cur[0] == prev[0]+1 && cur[1] == 0
+		if !next && !newGroup {
+			t.Fatalf("objects not contiguous across the seam: %v", all)
+		}
+	}
+	if all[len(all)-1] != [2]uint64{2, 1} {
+		t.Errorf("last object = %v, want [2 1]", all[len(all)-1])
+	}
+}
+
+func TestMoQSessionMarksLostObjects(t *testing.T) {
+	t.Parallel()
+
+	normal := uint64(0)
+	missing := uint64(ObjectStatusDoesNotExist)
+	endOfGroup := uint64(ObjectStatusEndOfGroup)
+
+	tests := []struct {
+		name     string
+		track    string
+		mode     VideoObjectMode
+		send     func(m *MoQSession, i int) // sends the i-th frame
+		before   int                        // frames sent before the loop runs
+		after    int                        // frames sent once the first is written
+		loop     func(m *MoQSession, ctx context.Context, sub *moqTrackSub) error
+		wantObjs [][][2]uint64 // per stream: {object ID, status}
+	}{
+		{
+			name:   "audio",
+			track:  "audio0",
+			before: 2, // the second is dropped
+			after:  1,
+			send: func(m *MoQSession, i int) {
+				m.SendAudio(&media.AudioFrame{PTS: int64(i) * 21333, Data: []byte{byte(i)}})
+			},
+			loop: (*MoQSession).writeAudioLoop,
+			wantObjs: [][][2]uint64{
+				{{0, normal}, {1, missing}, {2, normal}},
+			},
+		},
+		{
+			name:   "video",
+			track:  "video",
+			before: 3, // the delta is dropped, damaging the rest of the group
+			after:  1,
+			send: func(m *MoQSession, i int) {
+				m.SendVideo(&media.VideoFrame{
+					GroupID: uint32(1 + i/3), IsKeyframe: i%3 == 0,
+					PTS: int64(i) * 33000, WireData: []byte{byte(i)},
+				})
+			},
+			loop: (*MoQSession).writeVideoLoop,
+			wantObjs: [][][2]uint64{
+				{{0, normal}, {1, missing}, {2, missing}, {3, endOfGroup}},
+				{{0, normal}},
+			},
+		},
+		{
+			name:   "video per slice",
+			track:  "video",
+			mode:   VideoObjectPerNAL,
+			before: 3, // each dropped delta would have been two objects
+			after:  1,
+			send: func(m *MoQSession, i int) {
+				slice := byte(0x41)
+				if i%3 == 0 {
+					slice = 0x65
+				}
+				m.SendVideo(&media.VideoFrame{
+					GroupID: uint32(1 + i/3), IsKeyframe: i%3 == 0, Codec: "h264",
+					PTS:      int64(i) * 33000,
+					WireData: []byte{0, 0, 0, 2, slice, byte(i), 0, 0, 0, 2, slice, byte(i)},
+				})
+			},
+			loop: (*MoQSession).writeVideoLoop,
+			wantObjs: [][][2]uint64{
+				{{0, normal}, {1, normal}, {2, missing}, {3, missing}, {4, missing}, {5, missing}, {6, endOfGroup}},
+				{{0, normal}, {1, normal}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			opener := &mockStreamOpener{}
+			session := &MoQSession{
+				id:            "test-session",
+				streamKey:     "live",
+				log:           slog.With("session", "test-session"),
+				session:       opener,
+				subscriptions: make(map[string]*moqTrackSub),
+				videoObjects:  tt.mode,
+			}
+			sub := &moqTrackSub{
+				trackName: tt.track,
+				writer:    newMoQVideoWriter(1, priorityVideo, tt.mode, nil),
+				videoCh:   make(chan *media.VideoFrame, 1),
+				audioCh:   make(chan *media.AudioFrame, 1),
+			}
+			session.subscriptions[tt.track] = sub
+
+			for i := range tt.before {
+				tt.send(session, i)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			loopErr := make(chan error, 1)
+			go func() { loopErr <- tt.loop(session, ctx, sub) }()
+
+			waitFor := func(what string, cond func() bool) {
+				t.Helper()
+				deadline := time.After(5 * time.Second)
+				for !cond() {
+					select {
+					case <-deadline:
+						t.Fatalf("timed out waiting for %s", what)
+					case <-time.After(time.Millisecond):
+					}
+				}
+			}
+			waitFor("first frame", opener.delivered)
+			for i := range tt.after {
+				tt.send(session, tt.before+i)
+			}
+			waitFor("all objects", func() bool {
+				streams := opener.opened()
+				if len(streams) != len(tt.wantObjs) {
+					return false
+				}
+				last := tt.wantObjs[len(tt.wantObjs)-1]
+				return len(parseObjectStatuses(t, streams[len(streams)-1].bytes())) == len(last)
+			})
+			cancel()
+			if err := <-loopErr; err != nil {
+				t.Fatal(err)
+			}
+
+			for i, s := range opener.opened() {
+				if got := parseObjectStatuses(t, s.bytes()); !slices.Equal(got, tt.wantObjs[i]) {
+					t.Errorf("stream %d objects = %v, want %v", i, got, tt.wantObjs[i])
+				}
+			}
+		})
+	}
+}
+
+func TestMoQSessionAudioAlignHold(t *testing.T) {
+	t.Parallel()
+
+	const videoAlias, audioAlias = 1, 2
+	tests := []struct {
+		name     string
+		hold     time.Duration
+		keyframe bool // a keyframe arrives once audio has queued
+		wantHeld bool // no audio is sent before the keyframe
+	}{
+		{name: "off", keyframe: true},
+		{name: "held until keyframe", hold: time.Minute, keyframe: true, wantHeld: true},
+		{name: "hold expires", hold: 100 * time.Millisecond, wantHeld: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			opener := &mockStreamOpener{}
+			session := &MoQSession{
+				id:             "test-session",
+				streamKey:      "live",
+				log:            slog.With("session", "test-session"),
+				session:        opener,
+				relay:          NewRelay(),
+				subscriptions:  make(map[string]*moqTrackSub),
+				audioAlignHold: tt.hold,
+				videoStarted:   make(chan struct{}),
+			}
+			video := &moqTrackSub{
+				trackName: "video",
+				writer:    NewMoQWriter(videoAlias, priorityVideo),
+				videoCh:   make(chan *media.VideoFrame, 4),
+			}
+			audio := &moqTrackSub{
+				trackName: "audio0",
+				writer:    NewMoQWriter(audioAlias, priorityAudio),
+				audioCh:   make(chan *media.AudioFrame, 4),
+			}
+			session.subscriptions["video"] = video
+			session.subscriptions["audio0"] = audio
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go session.writeVideoLoop(ctx, video)
+			go session.writeAudioLoop(ctx, audio)
+
+			start := time.Now()
+			for i := range 3 {
+				session.SendAudio(&media.AudioFrame{PTS: int64(i) * 21333, Data: []byte{byte(i)}})
+			}
+			time.Sleep(50 * time.Millisecond)
+			if held := len(opener.opened()) == 0; held != tt.wantHeld {
+				t.Fatalf("audio held = %v after 50ms, want %v", held, tt.wantHeld)
+			}
+			if tt.keyframe {
+				session.SendVideo(&media.VideoFrame{GroupID: 1, IsKeyframe: true, WireData: []byte{1}})
+			}
+
+			// Audio follows the keyframe, or the hold, once released.
+			deadline := time.After(5 * time.Second)
+			var aliases []byte
+			for !slices.Contains(aliases, audioAlias) {
+				select {
+				case <-deadline:
+					t.Fatalf("stream aliases = %v, want audio", aliases)
+				case <-time.After(time.Millisecond):
+				}
+				aliases = aliases[:0]
+				for _, s := range opener.opened() {
+					if b := s.bytes(); len(b) > 1 {
+						aliases = append(aliases, b[1])
+					}
+				}
+			}
+			if tt.keyframe && tt.wantHeld && aliases[0] != videoAlias {
+				t.Errorf("stream aliases = %v, want video first", aliases)
+			}
+			if !tt.keyframe && time.Since(start) < tt.hold {
+				t.Errorf("audio sent after %v, before the %v hold", time.Since(start), tt.hold)
+			}
+		})
+	}
+}
+
+func TestMoQSessionHandleSetupObjectDatagrams(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		server, offer bool
+		want          bool
+	}{
+		{name: "negotiated", server: true, offer: true, want: true},
+		{name: "not offered", server: true},
+		{name: "not enabled", offer: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			cs := buildClientSetupPayload([]uint64{moq.Version}, "", 0)
+			if tt.offer {
+				// Replace the parameter count with one datagram offer.
+				cs = cs[:len(cs)-1]
+				cs = quicvarint.Append(cs, 1)
+				cs = quicvarint.Append(cs, moq.ParamObjectDatagrams)
+				cs = quicvarint.Append(cs, 1)
+			}
+			var controlBuf bytes.Buffer
+			if err := moq.WriteControlMsg(&controlBuf, moq.MsgClientSetup, cs); err != nil {
+				t.Fatal(err)
+			}
+			responseBuf := &bytes.Buffer{}
+			controlStream := &mockControlStream{Reader: &controlBuf, Writer: responseBuf}
+			session := &MoQSession{
+				id:              "test-session",
+				control:         controlStream,
+				controlReader:   bufio.NewReader(controlStream),
+				subscriptions:   make(map[string]*moqTrackSub),
+				objectDatagrams: tt.server,
+				datagrams:       &mockDatagrams{},
+			}
+			if _, err := session.handleSetup(); err != nil {
+				t.Fatal(err)
+			}
+			if session.useDatagrams != tt.want {
+				t.Errorf("useDatagrams = %v, want %v", session.useDatagrams, tt.want)
+			}
+			_, payload, err := moq.ReadControlMsg(responseBuf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := moq.SerializeServerSetup(moq.ServerSetup{SelectedVersion: moq.Version, MaxRequestID: 100, ObjectDatagrams: tt.want})
+			if !bytes.Equal(payload, want) {
+				t.Errorf("SERVER_SETUP = % x, want % x", payload, want)
+			}
+		})
+	}
+}
+
+func TestMoQSessionObjectDatagrams(t *testing.T) {
+	t.Parallel()
+
+	const audioAlias, captionAlias = 2, 3
+	tests := []struct {
+		name          string
+		datagrams     bool
+		wantObjectIDs []uint64 // of audio datagrams
+		wantStreams   int
+	}{
+		// The oversized frame goes on a stream, between the datagrams.
+		{name: "datagrams", datagrams: true, wantObjectIDs: []uint64{0, 1, 3}, wantStreams: 1},
+		{name: "streams", wantStreams: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			opener := &mockStreamOpener{}
+			dgrams := &mockDatagrams{}
+			session := &MoQSession{
+				id:            "test-session",
+				log:           slog.With("session", "test-session"),
+				session:       opener,
+				relay:         NewRelay(),
+				subscriptions: make(map[string]*moqTrackSub),
+				useDatagrams:  tt.datagrams,
+				datagrams:     dgrams,
+			}
+			audio := &moqTrackSub{
+				trackName: "audio0",
+				writer:    NewMoQWriter(audioAlias, priorityAudio),
+				audioCh:   make(chan *media.AudioFrame, 4),
+			}
+			captions := &moqTrackSub{
+				trackName: "captions",
+				writer:    NewMoQWriter(captionAlias, priorityCaptions),
+				captionCh: make(chan *media.CaptionFrame, 1),
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go session.writeAudioLoop(ctx, audio)
+			go session.writeCaptionLoop(ctx, captions)
+
+			for i, size := range []int{200, 200, 2000, 200} {
+				audio.audioCh <- &media.AudioFrame{PTS: int64(i) * 21333, Data: make([]byte, size)}
+			}
+			captions.captionCh <- &media.CaptionFrame{PTS: 1_000_000, Channel: 1, Text: "HELLO"}
+
+			var sent []moq.ObjectDatagram
+			wantSent := len(tt.wantObjectIDs)
+			if tt.datagrams {
+				wantSent++ // the caption
+			}
+			for deadline := time.Now().Add(5 * time.Second); len(sent) < wantSent || len(opener.opened()) < tt.wantStreams; {
+				if time.Now().After(deadline) {
+					t.Fatalf("%d datagrams and %d streams sent, want %d and %d", len(sent), len(opener.opened()), wantSent, tt.wantStreams)
+				}
+				time.Sleep(time.Millisecond)
+				sent = sent[:0]
+				for _, b := range dgrams.sent() {
+					d, err := moq.ParseObjectDatagram(b)
+					if err != nil {
+						t.Fatal(err)
+					}
+					sent = append(sent, d)
+				}
+			}
+
+			var objectIDs []uint64
+			for _, d := range sent {
+				switch d.TrackAlias {
+				case audioAlias:
+					objectIDs = append(objectIDs, d.ObjectID)
+					if len(d.Payload) != 200 || d.GroupID != 0 || d.PublisherPriority != priorityAudio {
+						t.Errorf("audio datagram = %+v, want a 200-byte object in group 0", d)
+					}
+				case captionAlias:
+					if !d.EndOfGroup || d.ObjectID != 0 {
+						t.Errorf("caption datagram = %+v, want the only object of its group", d)
+					}
+				}
+			}
+			if !slices.Equal(objectIDs, tt.wantObjectIDs) {
+				t.Errorf("audio datagram object IDs = %v, want %v", objectIDs, tt.wantObjectIDs)
+			}
+			if n := len(opener.opened()); n != tt.wantStreams {
+				t.Errorf("%d streams opened, want %d", n, tt.wantStreams)
+			}
+		})
+	}
+}
+
+func TestMoQSessionAudioFramesPerObject(t *testing.T) {
+	t.Parallel()
+
+	// One second of 48 kHz AAC at 128 kb/s: 47 frames of ~340 bytes.
+	const frameCount, frameSize = 47, 340
+
+	tests := []struct {
+		perObject   int
+		wantObjects int
+	}{
+		{perObject: 0, wantObjects: frameCount},
+		{perObject: 1, wantObjects: frameCount},
+		{perObject: 4, wantObjects: 12}, // the last holds the remaining 3
+		{perObject: 8, wantObjects: 6},
+	}
+
+	wire := make(map[int]int64)
+	for _, tt := range tests {
+		opener := &mockStreamOpener{}
+		session := &MoQSession{
+			id:                   "test-session",
+			log:                  slog.With("session", "test-session"),
+			session:              opener,
+			audioFramesPerObject: tt.perObject,
+		}
+		sub := &moqTrackSub{
+			trackName: "audio0",
+			writer:    NewMoQWriter(1, priorityAudio),
+			audioCh:   make(chan *media.AudioFrame, frameCount),
+		}
+		for i := range frameCount {
+			sub.audioCh <- &media.AudioFrame{PTS: 90_000_000 + int64(i)*21333, Data: make([]byte, frameSize)}
+		}
+		close(sub.audioCh)
+
+		// A source that ends flushes the partial batch.
+		if err := session.writeAudioLoop(context.Background(), sub); !errors.Is(err, errTrackEnded) {
+			t.Fatalf("perObject %d: writeAudioLoop = %v, want errTrackEnded", tt.perObject, err)
+		}
+		streams := opener.opened()
+		if len(streams) != 1 {
+			t.Fatalf("perObject %d: opened %d streams, want 1", tt.perObject, len(streams))
+		}
+		data := streams[0].bytes()
+		if got := len(parseObjectStatuses(t, data)); got != tt.wantObjects {
+			t.Errorf("perObject %d: %d objects, want %d", tt.perObject, got, tt.wantObjects)
+		}
+		wire[tt.perObject] = int64(len(data))
+	}
+
+	payload := int64(frameCount * frameSize)
+	for _, n := range []int{4, 8} {
+		saved := wire[1] - wire[n]
+		t.Logf("%d frames per object: %d bytes on the wire, %d fewer than one per object (overhead %d -> %d bytes)",
+			n, wire[n], saved, wire[1]-payload, wire[n]-payload)
+		if saved <= 0 {
+			t.Errorf("%d frames per object sent %d bytes, no fewer than one per object's %d", n, wire[n], wire[1])
+		}
+	}
+}
+
+// parseObjectStatuses returns the object ID and status of each object on
+// a subgroup stream, with status 0 (normal) for objects with a payload.
+func parseObjectStatuses(t *testing.T, data []byte) [][2]uint64 {
+	t.Helper()
+	if len(data) == 0 {
+		return nil
+	}
+	_, off := readVarint(data, 0)  // stream type
+	_, off = readVarint(data, off) // track alias
+	_, off = readVarint(data, off) // group ID
+	_, off = readVarint(data, off) // subgroup ID
+	off++                          // publisher priority
+
+	var objs [][2]uint64
+	for off < len(data) {
+		var obj, extLen, payloadLen, status uint64
+		obj, off = readVarint(data, off)
+		extLen, off = readVarint(data, off)
+		payloadLen, off = readVarint(data, off+int(extLen))
+		if payloadLen == 0 {
+			status, off = readVarint(data, off)
+		}
+		off += int(payloadLen)
+		objs = append(objs, [2]uint64{obj, status})
+	}
+	return objs
+}
+
+// parseVideoObjects returns the (group, object) locations carried by a
+// subgroup or fetch stream, and whether it was a fetch stream. A trailing
+// partial object is ignored.
+func parseVideoObjects(t *testing.T, data []byte) (objs [][2]uint64, isFetch bool) {
+	t.Helper()
+	if len(data) == 0 {
+		return nil, false
+	}
+	streamType, off := readVarint(data, 0)
+	var group uint64
+	switch streamType {
+	case moqStreamTypeFetchHeader:
+		isFetch = true
+		_, off = readVarint(data, off) // request ID
+	case moqStreamTypeSubgroupSIDExt:
+		_, off = readVarint(data, off) // track alias
+		group, off = readVarint(data, off)
+		_, off = readVarint(data, off) // subgroup ID
+		off++                          // publisher priority
+	default:
+		t.Fatalf("unexpected stream type %#x", streamType)
+	}
+	for off < len(data) {
+		var obj uint64
+		if isFetch {
+			group, off = readVarint(data, off)
+			_, off = readVarint(data, off) // subgroup ID
+			obj, off = readVarint(data, off)
+			off++ // publisher priority
+		} else {
+			obj, off = readVarint(data, off)
+		}
+		extLen, o := readVarint(data, off)
+		payloadLen, o := readVarint(data, o+int(extLen))
+		off = o + int(payloadLen)
+		if off > len(data) {
+			break
+		}
+		objs = append(objs, [2]uint64{group, obj})
+	}
+	return objs, isFetch
+}
+
+func TestMoQSessionServerLatency(t *testing.T) {
+	t.Parallel()
+	opener := &mockStreamOpener{}
+	session := &MoQSession{
+		id:            "test-session",
+		streamKey:     "live",
+		log:           slog.With("session", "test-session"),
+		session:       opener,
+		subscriptions: make(map[string]*moqTrackSub),
+	}
+	sub := &moqTrackSub{
+		trackName: "video",
+		writer:    NewMoQWriter(1, priorityVideo),
+		videoCh:   make(chan *media.VideoFrame, 1),
+	}
+
+	const held = 5 * time.Millisecond
+	start := time.Now()
+	sub.videoCh <- &media.VideoFrame{GroupID: 1, IsKeyframe: true, WireData: []byte{1}, ArrivedAt: start.Add(-held)}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	loopErr := make(chan error, 1)
+	go func() { loopErr <- session.writeVideoLoop(ctx, sub) }()
+
+	deadline := time.After(5 * time.Second)
+	for session.Stats().ServerLatencyMs == 0 {
+		select {
+		case <-deadline:
+			t.Fatal("server latency was not recorded")
+		case <-time.After(time.Millisecond):
+		}
+	}
+	bound := time.Since(start) + held
+	cancel()
+	if err := <-loopErr; err != nil {
+		t.Fatal(err)
+	}
+
+	got := session.Stats().ServerLatencyMs
+	if got < float64(held.Milliseconds()) || got > float64(bound.Microseconds())/1000 {
+		t.Errorf("ServerLatencyMs = %.3f, want between %d and %.3f", got, held.Milliseconds(), float64(bound.Microseconds())/1000)
+	}
+}
+
+func TestMoQSessionSkipsUntilKeyframe(t *testing.T) {
+	t.Parallel()
+
+	// Two delta frames precede the first keyframe, and group 3's keyframe
+	// never arrives.
+	frames := []*media.VideoFrame{
+		{GroupID: 0, PTS: 0},
+		{GroupID: 0, PTS: 33000},
+		{GroupID: 1, IsKeyframe: true, PTS: 66000},
+		{GroupID: 1, PTS: 99000},
+		{GroupID: 3, PTS: 132000},
+		{GroupID: 3, PTS: 165000},
+		{GroupID: 4, IsKeyframe: true, PTS: 198000},
+	}
+
+	tests := []struct {
+		name        string
+		openGroups  bool
+		wantGroups  []uint64 // per stream
+		wantObjects []int    // per stream
+		wantSkipped int64
+	}{
+		{
+			name:        "skip",
+			wantGroups:  []uint64{1, 4},
+			wantObjects: []int{2, 1},
+			wantSkipped: 4,
+		},
+		{
+			name:        "open unaligned",
+			openGroups:  true,
+			wantGroups:  []uint64{0, 1, 3, 4},
+			wantObjects: []int{2, 2, 2, 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			opener := &mockStreamOpener{}
+			session := &MoQSession{
+				id:                  "test-session",
+				streamKey:           "live",
+				log:                 slog.With("session", "test-session"),
+				session:             opener,
+				subscriptions:       make(map[string]*moqTrackSub),
+				openUnalignedGroups: tt.openGroups,
+			}
+			sub := &moqTrackSub{
+				trackName: "video",
+				writer:    NewMoQWriter(1, priorityVideo),
+				videoCh:   make(chan *media.VideoFrame, len(frames)),
+			}
+			for i, f := range frames {
+				f := *f
+				f.WireData = []byte{byte(i)}
+				sub.videoCh <- &f
+			}
+			close(sub.videoCh)
+
+			if err := session.writeVideoLoop(context.Background(), sub); !errors.Is(err, errTrackEnded) {
+				t.Fatalf("writeVideoLoop = %v, want errTrackEnded", err)
+			}
+
+			streams := opener.opened()
+			if len(streams) != len(tt.wantGroups) {
+				t.Fatalf("opened %d streams, want %d", len(streams), len(tt.wantGroups))
+			}
+			for i, s := range streams {
+				objs, _ := parseVideoObjects(t, s.bytes())
+				if len(objs) != tt.wantObjects[i] || objs[0][0] != tt.wantGroups[i] {
+					t.Errorf("stream %d: objects %v, want %d in group %d", i, objs, tt.wantObjects[i], tt.wantGroups[i])
+				}
+			}
+			stats := session.Stats()
+			if stats.SkippedUntilKeyframe != tt.wantSkipped {
+				t.Errorf("SkippedUntilKeyframe = %d, want %d", stats.SkippedUntilKeyframe, tt.wantSkipped)
+			}
+			if stats.VideoDropped != 0 {
+				t.Errorf("VideoDropped = %d, want 0", stats.VideoDropped)
+			}
+		})
+	}
+}
+
 func TestMoQSessionSendVideoWithSub(t *testing.T) {
 	t.Parallel()
 	session := &MoQSession{
@@ -579,6 +2304,91 @@ func TestMoQSessionSendVideoWithSub(t *testing.T) {
 	}
 }
 
+func TestMoQSessionVideoOverflowPolicies(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		policy  VideoOverflowPolicy
+		timeout time.Duration
+		consume bool // free the queue shortly after the keyframe arrives
+
+		wantKeyframe bool
+		wantDelta    bool
+	}{
+		// The delta frame is queued though its keyframe was lost.
+		{name: "drop frame", policy: VideoOverflowDropFrame, wantDelta: true},
+		{name: "drop group", policy: VideoOverflowDropGroup},
+		{name: "block", policy: VideoOverflowBlock, timeout: 5 * time.Second, consume: true, wantKeyframe: true, wantDelta: true},
+		{name: "block timeout", policy: VideoOverflowBlock, timeout: 10 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			session := &MoQSession{
+				id:                "test-session",
+				streamKey:         "live",
+				subscriptions:     make(map[string]*moqTrackSub),
+				videoOverflow:     tt.policy,
+				videoBlockTimeout: tt.timeout,
+			}
+			ch := make(chan *media.VideoFrame, 1)
+			session.subscriptions["video"] = &moqTrackSub{trackName: "video", videoCh: ch}
+
+			// A queued frame from the previous group fills the queue.
+			ch <- &media.VideoFrame{IsKeyframe: true, GroupID: 1}
+			if tt.consume {
+				go func() {
+					time.Sleep(20 * time.Millisecond)
+					<-ch
+				}()
+			}
+
+			keyframe := &media.VideoFrame{IsKeyframe: true, GroupID: 2}
+			delta := &media.VideoFrame{GroupID: 2}
+			session.SendVideo(keyframe)
+			gotKeyframe := len(ch) == 1 && (<-ch) == keyframe
+			if !gotKeyframe && len(ch) == 1 {
+				<-ch // the filler, if nothing freed the queue
+			}
+			session.SendVideo(delta)
+			gotDelta := len(ch) == 1
+
+			if gotKeyframe != tt.wantKeyframe {
+				t.Errorf("keyframe queued = %v, want %v", gotKeyframe, tt.wantKeyframe)
+			}
+			if gotDelta != tt.wantDelta {
+				t.Errorf("delta queued = %v, want %v", gotDelta, tt.wantDelta)
+			}
+			wantDropped := int64(2)
+			if tt.wantKeyframe {
+				wantDropped--
+			}
+			if tt.wantDelta {
+				wantDropped--
+			}
+			if got := session.videoDropped.Load(); got != wantDropped {
+				t.Errorf("videoDropped = %d, want %d", got, wantDropped)
+			}
+		})
+	}
+}
+
+func TestParseVideoOverflowPolicy(t *testing.T) {
+	t.Parallel()
+
+	for _, p := range []VideoOverflowPolicy{VideoOverflowDropFrame, VideoOverflowDropGroup, VideoOverflowBlock} {
+		got, err := ParseVideoOverflowPolicy(p.String())
+		if err != nil || got != p {
+			t.Errorf("ParseVideoOverflowPolicy(%q) = %v, %v, want %v", p.String(), got, err, p)
+		}
+	}
+	if _, err := ParseVideoOverflowPolicy("drop"); err == nil {
+		t.Error("ParseVideoOverflowPolicy(\"drop\") succeeded, want an error")
+	}
+}
+
 func TestMoQSessionSendAudioWithSub(t *testing.T) {
 	t.Parallel()
 	session := &MoQSession{
@@ -642,10 +2452,147 @@ func TestMoQSessionStats(t *testing.T) {
 	if stats.LastVideoTsMS != 12345 {
 		t.Fatalf("LastVideoTsMS = %d", stats.LastVideoTsMS)
 	}
+	if stats.Transport != nil {
+		t.Fatalf("Transport = %+v without a connection, want nil", stats.Transport)
+	}
+}
+
+// fixedConnStats reports the same connection stats every time.
+type fixedConnStats webtransport.ConnectionStats
+
+func (f fixedConnStats) ConnectionStats() webtransport.ConnectionStats {
+	return webtransport.ConnectionStats(f)
+}
+
+func TestMoQSessionStatsTransport(t *testing.T) {
+	t.Parallel()
+	session := &MoQSession{
+		conn: fixedConnStats{
+			LatestRTT:        42 * time.Millisecond,
+			SmoothedRTT:      37500 * time.Microsecond,
+			MinRTT:           20 * time.Millisecond,
+			BytesInFlight:    60_000,
+			CongestionWindow: 64_000,
+			PacketsLost:      7,
+		},
+	}
+
+	want := TransportStats{
+		RTTMs:            42,
+		SmoothedRTTMs:    37.5,
+		MinRTTMs:         20,
+		BytesInFlight:    60_000,
+		CongestionWindow: 64_000,
+		PacketsLost:      7,
+	}
+	if got := session.Stats().Transport; got == nil || *got != want {
+		t.Errorf("Transport = %+v, want %+v", got, want)
+	}
 }
 
 // mockControlStream implements webtransport.Stream for test purposes.
 // It uses separate Reader/Writer to simulate the control stream.
+func TestMoQSessionCatalogRetry(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		failOpens int
+		retries   int
+		wantMsg   uint64
+	}{
+		{name: "retry succeeds", failOpens: 1, retries: 1, wantMsg: moq.MsgSubscribeOK},
+		{name: "retries exhausted", failOpens: 2, retries: 1, wantMsg: moq.MsgSubscribeError},
+		{name: "retries disabled", failOpens: 1, retries: 0, wantMsg: moq.MsgSubscribeError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			responseBuf := &bytes.Buffer{}
+			opener := &mockStreamOpener{failOpens: tt.failOpens}
+			session := &MoQSession{
+				id:             "test-session",
+				streamKey:      "live",
+				session:        opener,
+				control:        &mockControlStream{Reader: &bytes.Buffer{}, Writer: responseBuf},
+				log:            slog.With("session", "test-session"),
+				relay:          NewRelay(),
+				catalogRetries: tt.retries,
+				subscriptions:  make(map[string]*moqTrackSub),
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			session.handleCatalogSubscribe(ctx, moq.Subscribe{RequestID: 1, TrackName: "catalog"}, 0)
+
+			session.controlMu.Lock()
+			msgType, _, err := moq.ReadControlMsg(responseBuf)
+			session.controlMu.Unlock()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if msgType != tt.wantMsg {
+				t.Fatalf("response type = %#x, want %#x", msgType, tt.wantMsg)
+			}
+			if delivered := opener.delivered(); delivered != (tt.wantMsg == moq.MsgSubscribeOK) {
+				t.Errorf("catalog delivered = %v, want %v", delivered, !delivered)
+			}
+		})
+	}
+}
+
+func TestMoQSessionCatalogPushedOnTrackChange(t *testing.T) {
+	t.Parallel()
+
+	relay := NewRelay()
+	relay.SetAudioTrackCount(1)
+	opener := &mockStreamOpener{}
+	session := &MoQSession{
+		id:            "test-session",
+		streamKey:     "live",
+		session:       opener,
+		control:       &mockControlStream{Reader: &bytes.Buffer{}, Writer: &bytes.Buffer{}},
+		log:           slog.With("session", "test-session"),
+		relay:         relay,
+		subscriptions: make(map[string]*moqTrackSub),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	session.handleCatalogSubscribe(ctx, moq.Subscribe{RequestID: 1, TrackName: "catalog"}, 0)
+	if n := len(opener.opened()); n != 1 {
+		t.Fatalf("catalog streams after subscribe = %d, want 1", n)
+	}
+
+	// A second audio track appearing in the PMT reaches the relay as a
+	// new track count.
+	relay.SetAudioTrackCount(2)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(opener.opened()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	streams := opener.opened()
+	if len(streams) != 2 {
+		t.Fatalf("catalog streams after track change = %d, want 2", len(streams))
+	}
+
+	var groups [2]uint64
+	for i, s := range streams {
+		data := s.bytes()
+		_, off := readVarint(data, 0)  // stream type
+		_, off = readVarint(data, off) // track alias
+		groups[i], _ = readVarint(data, off)
+	}
+	if groups[1] <= groups[0] {
+		t.Errorf("pushed catalog group = %d, want > %d", groups[1], groups[0])
+	}
+	if !bytes.Contains(streams[1].bytes(), []byte(`"audio1"`)) {
+		t.Error("pushed catalog does not list the new audio track")
+	}
+}
+
 type mockControlStream struct {
 	Reader *bytes.Buffer
 	Writer *bytes.Buffer
@@ -662,3 +2609,267 @@ func (m *mockControlStream) SetDeadline(_ time.Time) error              { return
 func (m *mockControlStream) SetReadDeadline(_ time.Time) error          { return nil }
 func (m *mockControlStream) SetWriteDeadline(_ time.Time) error         { return nil }
 func (m *mockControlStream) StreamID() quic.StreamID                    { return 0 }
+
+// mockStreamOpener hands out mockSendStreams. The first stallOpens opens
+// block until their context ends, the next failOpens fail immediately, and
+// the first stallWrites streams block every Write until the write deadline
+// passes.
+type mockStreamOpener struct {
+	stallOpens  int
+	failOpens   int
+	stallWrites int
+
+	mu      sync.Mutex
+	opens   int
+	streams []*mockSendStream
+}
+
+func (o *mockStreamOpener) OpenUniStreamSync(ctx context.Context) (webtransport.SendStream, error) {
+	o.mu.Lock()
+	o.opens++
+	if o.opens <= o.stallOpens {
+		o.mu.Unlock()
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	if o.opens <= o.stallOpens+o.failOpens {
+		o.mu.Unlock()
+		return nil, errors.New("open failed")
+	}
+	s := &mockSendStream{stall: len(o.streams) < o.stallWrites}
+	o.streams = append(o.streams, s)
+	o.mu.Unlock()
+	return s, nil
+}
+
+func (o *mockStreamOpener) opened() []*mockSendStream {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]*mockSendStream(nil), o.streams...)
+}
+
+// delivered reports whether any non-stalled stream has received data.
+func (o *mockStreamOpener) delivered() bool {
+	for _, s := range o.opened() {
+		if s.written() > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// mockSendStream implements webtransport.SendStream, honouring write
+// deadlines when stalled.
+// mockDatagrams records the datagrams sent on a session.
+type mockDatagrams struct {
+	mu    sync.Mutex
+	dgram [][]byte
+}
+
+func (d *mockDatagrams) SendDatagram(b []byte) error {
+	d.mu.Lock()
+	d.dgram = append(d.dgram, b)
+	d.mu.Unlock()
+	return nil
+}
+
+func (d *mockDatagrams) sent() [][]byte {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return slices.Clone(d.dgram)
+}
+
+type mockSendStream struct {
+	stall bool
+
+	mu        sync.Mutex
+	buf       bytes.Buffer
+	deadline  time.Time
+	cancelled bool
+}
+
+var _ webtransport.SendStream = (*mockSendStream)(nil)
+
+func (s *mockSendStream) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stall {
+		if s.deadline.IsZero() {
+			return 0, errors.New("stalled write without deadline")
+		}
+		time.Sleep(time.Until(s.deadline))
+		return 0, os.ErrDeadlineExceeded
+	}
+	return s.buf.Write(p)
+}
+
+func (s *mockSendStream) SetWriteDeadline(t time.Time) error {
+	s.mu.Lock()
+	s.deadline = t
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *mockSendStream) CancelWrite(webtransport.StreamErrorCode) {
+	s.mu.Lock()
+	s.cancelled = true
+	s.mu.Unlock()
+}
+
+func (s *mockSendStream) Close() error            { return nil }
+func (s *mockSendStream) StreamID() quic.StreamID { return 0 }
+
+func (s *mockSendStream) written() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.buf.Len()
+}
+
+func (s *mockSendStream) bytes() []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return bytes.Clone(s.buf.Bytes())
+}
+
+func (s *mockSendStream) wasCancelled() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cancelled
+}
+
+func TestMoQSessionStatsMessageIncludesRelay(t *testing.T) {
+	t.Parallel()
+
+	relay := NewRelay()
+	slow := newMockViewer("slow")
+	slow.videoDropped.Add(1)
+	relay.AddViewer(slow)
+	relay.AddViewer(newMockViewer("fast"))
+	relay.BroadcastVideo(&media.VideoFrame{
+		PTS: 1_000_000, IsKeyframe: true, GroupID: 7, NALUs: [][]byte{make([]byte, 100)},
+	})
+	relay.BroadcastVideo(&media.VideoFrame{
+		PTS: 1_040_000, GroupID: 7, NALUs: [][]byte{make([]byte, 20)},
+	})
+
+	session := &MoQSession{id: "test-session", relay: relay}
+	session.videoSent.Add(3)
+	data, err := json.Marshal(session.newStatsMessage(StreamSnapshot{ViewerCount: 2}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var msg struct {
+		Type        string         `json:"type"`
+		Stats       StreamSnapshot `json:"stats"`
+		ViewerStats ViewerStats    `json:"viewerStats"`
+		Relay       RelaySnapshot  `json:"relay"`
+	}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != "stats" || msg.Stats.ViewerCount != 2 || msg.ViewerStats.VideoSent != 3 {
+		t.Errorf("existing fields = %q, %+v, %+v", msg.Type, msg.Stats, msg.ViewerStats)
+	}
+
+	want := RelaySnapshot{
+		ViewerCount:       2,
+		VideoSent:         4,
+		VideoDropped:      1,
+		DropRate:          0.2,
+		GOP:               GOPCacheStats{GroupID: 7, Frames: 2, Bytes: 120, DurationMs: 40},
+		LiveGroupID:       7,
+		CachedGroups:      1,
+		OldestViewerGroup: 7,
+	}
+	if msg.Relay != want {
+		t.Errorf("relay = %+v, want %+v", msg.Relay, want)
+	}
+}
+
+func TestMoQSessionSubscribeAnnounces(t *testing.T) {
+	t.Parallel()
+
+	srv := newTestServer(t)
+	srv.RegisterStream("a")
+
+	responseBuf := &bytes.Buffer{}
+	session := &MoQSession{
+		id:            "test-session",
+		control:       &mockControlStream{Reader: &bytes.Buffer{}, Writer: responseBuf},
+		log:           slog.With("session", "test-session"),
+		watchStreams:  srv.watchStreams,
+		subscriptions: make(map[string]*moqTrackSub),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	session.handleSubscribeAnnounces(ctx, moq.SubscribeAnnounces{RequestID: 2, Prefix: []string{"prism"}})
+	session.handleSubscribeAnnounces(ctx, moq.SubscribeAnnounces{RequestID: 4, Prefix: []string{"prism"}})
+	srv.RegisterStream("b")
+	srv.UnregisterStream("a")
+
+	type msg struct {
+		typ uint64
+		ns  string
+	}
+	want := []msg{
+		{moq.MsgSubscribeAnnouncesOK, ""},
+		{moq.MsgSubscribeAnnouncesError, ""},
+		{moq.MsgAnnounce, "a"},
+		{moq.MsgAnnounce, "b"},
+		{moq.MsgUnannounce, "a"},
+	}
+	var got []msg
+	deadline := time.Now().Add(2 * time.Second)
+	for len(got) < len(want) && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+		session.controlMu.Lock()
+		r := bytes.NewReader(responseBuf.Bytes())
+		session.controlMu.Unlock()
+
+		got = got[:0]
+		for {
+			typ, payload, err := moq.ReadControlMsg(r)
+			if err != nil {
+				break
+			}
+			m := msg{typ: typ}
+			switch typ {
+			case moq.MsgAnnounce:
+				_, off := readVarint(payload, 0)
+				m.ns = string(payload[off:])
+			case moq.MsgUnannounce:
+				m.ns = string(payload)
+			}
+			got = append(got, m)
+		}
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d control messages, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		wantNS := ""
+		if want[i].ns != "" {
+			wantNS = string(moq.AppendNamespaceTuple(nil, []string{"prism", want[i].ns}))
+			if want[i].typ == moq.MsgAnnounce {
+				wantNS += "\x00" // no params
+			}
+		}
+		if got[i].typ != want[i].typ || got[i].ns != wantNS {
+			t.Errorf("message %d = %#x %q, want %#x %q", i, got[i].typ, got[i].ns, want[i].typ, wantNS)
+		}
+	}
+
+	session.handleUnsubscribeAnnounces(moq.UnsubscribeAnnounces{Prefix: []string{"prism"}})
+	for time.Now().Before(deadline) {
+		srv.mu.RLock()
+		n := len(srv.watchers)
+		srv.mu.RUnlock()
+		if n == 0 {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Error("UNSUBSCRIBE_ANNOUNCES left the stream watcher registered")
+}
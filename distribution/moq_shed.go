@@ -0,0 +1,166 @@
+package distribution
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/zsiec/prism/media"
+)
+
+// ShedLevel is how much of its video a MoQ session sheds to keep a
+// saturated viewer's audio and captions flowing. Each level sheds
+// everything the levels below it do.
+type ShedLevel int
+
+const (
+	// ShedNone sends all video.
+	ShedNone ShedLevel = iota
+
+	// ShedDisposable drops disposable frames, pictures nothing predicts
+	// from, leaving the rest of each group decodable.
+	ShedDisposable
+
+	// ShedDeltas drops every delta frame, sending keyframes only.
+	ShedDeltas
+
+	// ShedVideo drops whole groups, keyframes included.
+	ShedVideo
+)
+
+// ParseShedLevel parses a level name: "none", "disposable", "deltas" or
+// "video".
+func ParseShedLevel(s string) (ShedLevel, error) {
+	switch s {
+	case "none":
+		return ShedNone, nil
+	case "disposable":
+		return ShedDisposable, nil
+	case "deltas":
+		return ShedDeltas, nil
+	case "video":
+		return ShedVideo, nil
+	}
+	return 0, fmt.Errorf("unknown shed level %q", s)
+}
+
+func (l ShedLevel) String() string {
+	switch l {
+	case ShedNone:
+		return "none"
+	case ShedDisposable:
+		return "disposable"
+	case ShedDeltas:
+		return "deltas"
+	case ShedVideo:
+		return "video"
+	}
+	return fmt.Sprintf("ShedLevel(%d)", int(l))
+}
+
+// shedInterval is how often a session shedding video judges whether its
+// viewer is saturated. A saturated interval raises the level by one.
+const shedInterval = 250 * time.Millisecond
+
+// shedRelaxIntervals is how many calm intervals in a row lower the level
+// by one, so shedding backs off more slowly than it escalates.
+const shedRelaxIntervals = 8
+
+// shedVideo reports whether frame is shed at the session's current level,
+// counting it as dropped if so. Shedding a frame other pictures predict
+// from damages its group, so the rest of the group is dropped too until
+// the next keyframe.
+func (m *MoQSession) shedVideo(frame *media.VideoFrame) bool {
+	level := ShedLevel(m.shedLevel.Load())
+	switch {
+	case level >= ShedVideo:
+	case level >= ShedDeltas && !frame.IsKeyframe:
+	case level >= ShedDisposable && frame.Disposable:
+	default:
+		return false
+	}
+	if !frame.Disposable {
+		m.damagedGroup.Store(frame.GroupID)
+	}
+	m.videoShed.Add(1)
+	m.videoDropped.Add(1)
+	return true
+}
+
+// monitorShedding adjusts the session's shed level every shedInterval
+// until ctx is done. An interval is saturated when the viewer dropped
+// audio or hit a write timeout, or when an audio queue or the video queue
+// is backing up; each raises the level by one, up to the configured
+// limit. Video drops alone do not count, as shedding causes them.
+func (m *MoQSession) monitorShedding(ctx context.Context) {
+	ticker := time.NewTicker(shedInterval)
+	defer ticker.Stop()
+
+	lastAudioDropped, lastTimeouts := m.audioDropped.Load(), m.writeTimeouts.Load()
+	calm := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		audioDropped, timeouts := m.audioDropped.Load(), m.writeTimeouts.Load()
+		saturated := audioDropped > lastAudioDropped || timeouts > lastTimeouts
+		lastAudioDropped, lastTimeouts = audioDropped, timeouts
+
+		backlog := m.queueBacklog()
+		level := ShedLevel(m.shedLevel.Load())
+		switch {
+		case saturated || backlog >= 0.5:
+			calm = 0
+			if level < m.maxShedLevel {
+				m.setShedLevel(level + 1)
+			}
+		case backlog < 0.25:
+			calm++
+			if level > ShedNone && calm >= shedRelaxIntervals {
+				calm = 0
+				m.setShedLevel(level - 1)
+			}
+		default:
+			calm = 0
+		}
+	}
+}
+
+// queueBacklog returns how full the session's fullest audio or video
+// queue is, from 0 to 1. Audio held back for the first video keyframe is
+// not backlog.
+func (m *MoQSession) queueBacklog() float64 {
+	holding := m.audioAlignHold > 0
+	if holding {
+		select {
+		case <-m.videoStarted:
+			holding = false
+		default:
+		}
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var backlog float64
+	for _, sub := range m.subscriptions {
+		switch {
+		case sub.videoCh != nil:
+			backlog = max(backlog, float64(len(sub.videoCh))/float64(cap(sub.videoCh)))
+		case sub.audioCh != nil && !holding:
+			backlog = max(backlog, float64(len(sub.audioCh))/float64(cap(sub.audioCh)))
+		}
+	}
+	return backlog
+}
+
+// setShedLevel changes the session's shed level and logs the change.
+func (m *MoQSession) setShedLevel(level ShedLevel) {
+	prev := ShedLevel(m.shedLevel.Swap(int32(level)))
+	if level > prev {
+		m.log.Info("viewer saturated, shedding video", "level", level)
+	} else {
+		m.log.Info("viewer recovering, shedding less video", "level", level)
+	}
+}
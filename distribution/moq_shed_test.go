@@ -0,0 +1,136 @@
+package distribution
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/zsiec/prism/media"
+)
+
+func TestMoQSessionShedVideo(t *testing.T) {
+	t.Parallel()
+
+	// A group of a keyframe, a reference delta frame, a disposable frame
+	// and a second reference delta frame.
+	group := func() []*media.VideoFrame {
+		return []*media.VideoFrame{
+			{IsKeyframe: true, GroupID: 1},
+			{GroupID: 1},
+			{GroupID: 1, Disposable: true},
+			{GroupID: 1},
+		}
+	}
+
+	tests := []struct {
+		level ShedLevel
+		want  []bool // queued, per frame of the group
+	}{
+		{ShedNone, []bool{true, true, true, true}},
+		{ShedDisposable, []bool{true, true, false, true}},
+		{ShedDeltas, []bool{true, false, false, false}},
+		{ShedVideo, []bool{false, false, false, false}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.level.String(), func(t *testing.T) {
+			t.Parallel()
+			session := &MoQSession{subscriptions: make(map[string]*moqTrackSub)}
+			session.shedLevel.Store(int32(tt.level))
+			ch := make(chan *media.VideoFrame, 10)
+			session.subscriptions["video"] = &moqTrackSub{trackName: "video", videoCh: ch}
+
+			var shed int64
+			for i, frame := range group() {
+				session.SendVideo(frame)
+				queued := len(ch) == 1
+				if queued {
+					<-ch
+				} else {
+					shed++
+				}
+				if queued != tt.want[i] {
+					t.Errorf("frame %d queued = %v, want %v", i, queued, tt.want[i])
+				}
+			}
+
+			stats := session.Stats()
+			if stats.ShedLevel != tt.level {
+				t.Errorf("ShedLevel = %v, want %v", stats.ShedLevel, tt.level)
+			}
+			if stats.VideoShed != shed || stats.VideoDropped != shed {
+				t.Errorf("VideoShed = %d, VideoDropped = %d, want %d", stats.VideoShed, stats.VideoDropped, shed)
+			}
+		})
+	}
+}
+
+func TestMoQSessionMonitorShedding(t *testing.T) {
+	t.Parallel()
+
+	session := &MoQSession{
+		log:           slog.With("session", "test-session"),
+		subscriptions: make(map[string]*moqTrackSub),
+		maxShedLevel:  ShedDeltas,
+	}
+	audioCh := make(chan *media.AudioFrame, 4)
+	session.subscriptions["audio0"] = &moqTrackSub{trackName: "audio0", audioCh: audioCh}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go session.monitorShedding(ctx)
+
+	// The viewer keeps dropping audio: shedding escalates to the limit
+	// and no further.
+	deadline := time.Now().Add(5 * time.Second)
+	for ShedLevel(session.shedLevel.Load()) < ShedDeltas {
+		if time.Now().After(deadline) {
+			t.Fatalf("shed level = %v, want %v", ShedLevel(session.shedLevel.Load()), ShedDeltas)
+		}
+		session.audioDropped.Add(1)
+		time.Sleep(10 * time.Millisecond)
+	}
+	for range 2 * shedInterval / (10 * time.Millisecond) {
+		session.audioDropped.Add(1)
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := ShedLevel(session.shedLevel.Load()); got != ShedDeltas {
+		t.Fatalf("shed level = %v past the limit, want %v", got, ShedDeltas)
+	}
+
+	// A backed-up audio queue holds the level.
+	for range cap(audioCh) {
+		audioCh <- &media.AudioFrame{}
+	}
+	time.Sleep(2 * shedInterval)
+	if got := ShedLevel(session.shedLevel.Load()); got != ShedDeltas {
+		t.Fatalf("shed level = %v with audio backed up, want %v", got, ShedDeltas)
+	}
+
+	// Once the viewer keeps up, shedding backs off a level at a time.
+	for len(audioCh) > 0 {
+		<-audioCh
+	}
+	deadline = time.Now().Add(shedRelaxIntervals*shedInterval + 2*time.Second)
+	for ShedLevel(session.shedLevel.Load()) != ShedDisposable {
+		if time.Now().After(deadline) {
+			t.Fatalf("shed level = %v after recovering, want %v", ShedLevel(session.shedLevel.Load()), ShedDisposable)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestParseShedLevel(t *testing.T) {
+	t.Parallel()
+
+	for _, level := range []ShedLevel{ShedNone, ShedDisposable, ShedDeltas, ShedVideo} {
+		got, err := ParseShedLevel(level.String())
+		if err != nil || got != level {
+			t.Errorf("ParseShedLevel(%q) = %v, %v, want %v", level.String(), got, err, level)
+		}
+	}
+	if _, err := ParseShedLevel("audio"); err == nil {
+		t.Error("ParseShedLevel(\"audio\") succeeded, want error")
+	}
+}
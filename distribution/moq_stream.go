@@ -0,0 +1,103 @@
+package distribution
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"time"
+
+	"github.com/zsiec/prism/webtransport"
+)
+
+// defaultWriteTimeout bounds how long a single object write (or the stream
+// open preceding it) may block on a slow viewer, unless overridden in the
+// config.
+const defaultWriteTimeout = 2 * time.Second
+
+// maxClientDeliveryTimeout caps the write timeout a viewer can request
+// with its CLIENT_SETUP delivery timeout, so a stalled viewer cannot pin
+// a write loop and the frames it holds indefinitely.
+const maxClientDeliveryTimeout = 30 * time.Second
+
+// streamErrWriteTimeout is the reset code sent on a data stream abandoned
+// because the viewer stopped reading.
+const streamErrWriteTimeout webtransport.StreamErrorCode = 1
+
+// streamErrCancelled is the reset code sent on a fetch stream abandoned
+// because the viewer sent FETCH_CANCEL.
+const streamErrCancelled webtransport.StreamErrorCode = 1
+
+// errWriteTimeout is returned when opening a data stream outlives the
+// write timeout, typically because the viewer has stopped granting
+// stream credit.
+var errWriteTimeout = errors.New("write timeout")
+
+// uniStreamOpener opens outgoing unidirectional streams. It is satisfied
+// by *webtransport.Session and lets tests substitute a fake session.
+type uniStreamOpener interface {
+	OpenUniStreamSync(ctx context.Context) (webtransport.SendStream, error)
+}
+
+// datagramSender sends QUIC datagrams on a WebTransport session. It is
+// satisfied by *webtransport.Session and lets tests capture datagrams.
+type datagramSender interface {
+	SendDatagram(b []byte) error
+}
+
+// connStatsReporter reports the stats of the QUIC connection under a
+// WebTransport session. It is satisfied by *webtransport.Session.
+type connStatsReporter interface {
+	ConnectionStats() webtransport.ConnectionStats
+}
+
+// maxObjectDatagramSize is the largest object datagram sent. Larger
+// objects go on a stream, as a datagram must fit in one QUIC packet,
+// whose payload can be as small as about 1,200 bytes.
+const maxObjectDatagramSize = 1000
+
+// timedOpener bounds each stream open by timeout and returns streams that
+// bound each Write the same way, so a stalled viewer fails a write loop's
+// current object instead of blocking the loop indefinitely.
+type timedOpener struct {
+	uniStreamOpener
+	timeout time.Duration
+}
+
+func (o timedOpener) OpenUniStreamSync(ctx context.Context) (webtransport.SendStream, error) {
+	openCtx, cancel := context.WithTimeout(ctx, o.timeout)
+	defer cancel()
+	stream, err := o.uniStreamOpener.OpenUniStreamSync(openCtx)
+	if err != nil {
+		if ctx.Err() == nil && errors.Is(openCtx.Err(), context.DeadlineExceeded) {
+			return nil, errWriteTimeout
+		}
+		return nil, err
+	}
+	return timedSendStream{SendStream: stream, timeout: o.timeout}, nil
+}
+
+// timedSendStream arms a fresh write deadline before every Write. The
+// MoQ writers issue one Write per object, so the deadline applies per
+// object rather than to the life of the stream.
+type timedSendStream struct {
+	webtransport.SendStream
+	timeout time.Duration
+}
+
+func (s timedSendStream) Write(p []byte) (int, error) {
+	if err := s.SendStream.SetWriteDeadline(time.Now().Add(s.timeout)); err != nil {
+		return 0, err
+	}
+	return s.SendStream.Write(p)
+}
+
+// isWriteTimeout reports whether err came from a write deadline or a
+// timed-out stream open rather than a broken session.
+func isWriteTimeout(err error) bool {
+	if errors.Is(err, errWriteTimeout) || errors.Is(err, os.ErrDeadlineExceeded) {
+		return true
+	}
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
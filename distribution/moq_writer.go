@@ -1,9 +1,12 @@
 package distribution
 
 import (
+	"encoding/binary"
+	"fmt"
 	"io"
 
 	"github.com/quic-go/quic-go/quicvarint"
+	"github.com/zsiec/prism/demux"
 	"github.com/zsiec/prism/media"
 	"github.com/zsiec/prism/moq"
 )
@@ -16,6 +19,9 @@ const (
 	// moqStreamTypeSubgroupSIDExt indicates a subgroup stream with an explicit
 	// Subgroup ID in the header and per-object extension headers.
 	moqStreamTypeSubgroupSIDExt uint64 = 0x0d
+
+	// moqStreamTypeFetchHeader opens the stream carrying a FETCH response.
+	moqStreamTypeFetchHeader uint64 = 0x05
 )
 
 // LOC header extension IDs (draft-ietf-moq-loc-01).
@@ -23,8 +29,65 @@ const (
 	locExtCaptureTimestamp  uint64 = 2  // even: varint value = microseconds
 	locExtVideoFrameMarking uint64 = 4  // even: varint value = RFC 9626 flags
 	locExtVideoConfig       uint64 = 13 // odd: length-prefixed byte string
+
+	// locExtTimecode is a Prism extension, not part of LOC, carrying the
+	// frame's SMPTE timecode so clients can render frame-accurate burn-in.
+	// Even: varint value packed as hours<<24 | minutes<<16 | seconds<<8 |
+	// frames.
+	locExtTimecode uint64 = 62
+
+	// locExtFrameObject is a Prism extension marking the objects of a
+	// frame sent one VCL NAL unit per object (VideoObjectPerNAL). Even:
+	// varint value packed as index<<1 | last, where index counts the
+	// frame's objects from zero and last is 1 on its final object.
+	locExtFrameObject uint64 = 64
+
+	// locExtAudioFrames is a Prism extension on an audio object carrying
+	// several frames (see MoQSessionConfig.AudioFramesPerObject), whose
+	// payload is the frames back to back. Odd: a byte string holding, for
+	// each frame in order, two varints: its payload size and its
+	// timestamp in microseconds after the object's capture timestamp.
+	locExtAudioFrames uint64 = 67
+
+	// locExtPTS90k and locExtDTS90k are Prism extensions carrying a video
+	// frame's PTS and DTS exactly as the source's PES header did, in
+	// 33-bit 90kHz ticks, for clients and tools that need them without
+	// the rounding of the microsecond capture timestamp. Even: varint
+	// value. They are sent on the frame's first object when the source
+	// carried a PTS, the DTS only when it differs from the PTS.
+	locExtPTS90k uint64 = 68
+	locExtDTS90k uint64 = 70
 )
 
+// VideoObjectMode selects how video frames map to MoQ objects.
+type VideoObjectMode int
+
+const (
+	// VideoObjectPerFrame sends each frame as one object. It is the
+	// default.
+	VideoObjectPerFrame VideoObjectMode = iota
+
+	// VideoObjectPerNAL sends each VCL NAL unit (slice) of a frame as its
+	// own object, so a client can start decoding before the whole frame
+	// arrives. Non-VCL units such as parameter sets and SEI travel with
+	// the slice that follows them. Only the first object of a frame
+	// carries the timecode and decoder configuration extensions; every
+	// object carries locExtFrameObject. A frame dropped before delivery is
+	// still marked by a single status object.
+	VideoObjectPerNAL
+)
+
+// ParseVideoObjectMode parses a mode name: "frame" or "nal".
+func ParseVideoObjectMode(s string) (VideoObjectMode, error) {
+	switch s {
+	case "frame":
+		return VideoObjectPerFrame, nil
+	case "nal":
+		return VideoObjectPerNAL, nil
+	}
+	return 0, fmt.Errorf("unknown video object mode %q", s)
+}
+
 // RFC 9626 Video Frame Marking flags (non-scalable).
 const (
 	vfmKeyframe    uint64 = 0xE0 // S=1, E=1, I=1 (independent/keyframe)
@@ -41,15 +104,35 @@ type moqWriter struct {
 	trackAlias        uint64
 	publisherPriority byte
 	objectID          uint64
+	videoObjects      VideoObjectMode
+	clock             *wallClock // nil sends media clock timestamps
 }
 
 // NewMoQWriter returns a StreamFrameWriter that produces MoQ-compliant data
 // stream framing. trackAlias is a session-scoped identifier for the track,
 // and publisherPriority sets the priority (0=highest, 255=lowest).
 func NewMoQWriter(trackAlias uint64, publisherPriority byte) StreamFrameWriter {
+	return newMoQWriter(trackAlias, publisherPriority, nil)
+}
+
+// newMoQWriter returns a moqWriter whose capture timestamps are mapped by
+// clock, which may be nil for the media clock.
+func newMoQWriter(trackAlias uint64, publisherPriority byte, clock *wallClock) *moqWriter {
+	return &moqWriter{
+		trackAlias:        trackAlias,
+		publisherPriority: publisherPriority,
+		clock:             clock,
+	}
+}
+
+// newMoQVideoWriter returns a moqWriter for a video track that maps frames
+// to objects as mode selects and capture timestamps by clock.
+func newMoQVideoWriter(trackAlias uint64, publisherPriority byte, mode VideoObjectMode, clock *wallClock) *moqWriter {
 	return &moqWriter{
 		trackAlias:        trackAlias,
 		publisherPriority: publisherPriority,
+		videoObjects:      mode,
+		clock:             clock,
 	}
 }
 
@@ -67,17 +150,49 @@ func (m *moqWriter) WriteStreamHeader(w io.Writer, _ byte, groupID uint32, _ uin
 	return err
 }
 
+func (m *moqWriter) ResumeStreamHeader(w io.Writer, groupID uint32, firstObjectID uint64) error {
+	if err := m.WriteStreamHeader(w, TrackIDVideo, groupID, 0); err != nil {
+		return err
+	}
+	m.objectID = firstObjectID
+	return nil
+}
+
 func (m *moqWriter) WriteVideoFrame(w io.Writer, frame *media.VideoFrame) (int64, error) {
-	payload := frame.WireData
-	if payload == nil {
-		payload = moq.AnnexBToAVC1(frame.NALUs)
+	payload := videoPayload(frame)
+	if m.videoObjects != VideoObjectPerNAL {
+		return m.writeObject(w, videoExts(frame, true, m.clock), payload)
 	}
 
-	var exts []byte
+	parts := splitVCL(payload, frame.Codec)
+	var total int64
+	for i, part := range parts {
+		exts := appendFrameObject(videoExts(frame, i == 0, m.clock), i, len(parts))
+		n, err := m.writeObject(w, exts, part)
+		if err != nil {
+			return total, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// videoPayload returns the AVC1 payload for a video frame.
+func videoPayload(frame *media.VideoFrame) []byte {
+	if frame.WireData != nil {
+		return frame.WireData
+	}
+	return moq.AnnexBToAVC1(frame.NALUs)
+}
 
+// videoExts returns the LOC extensions for an object of a video frame,
+// shared by subgroup and fetch delivery, with the capture timestamp mapped
+// by clock. The timecode and decoder configuration are included only if
+// first, the frame's first object.
+func videoExts(frame *media.VideoFrame, first bool, clock *wallClock) (exts []byte) {
 	// Capture Timestamp (ID 2, even → varint value)
 	exts = quicvarint.Append(exts, locExtCaptureTimestamp)
-	exts = quicvarint.Append(exts, uint64(frame.PTS))
+	exts = quicvarint.Append(exts, clock.captureTimestamp(frame.PTS))
 
 	// Video Frame Marking (ID 4, even → varint value)
 	exts = quicvarint.Append(exts, locExtVideoFrameMarking)
@@ -86,6 +201,25 @@ func (m *moqWriter) WriteVideoFrame(w io.Writer, frame *media.VideoFrame) (int64
 	} else {
 		exts = quicvarint.Append(exts, vfmNonKeyframe)
 	}
+	if !first {
+		return exts
+	}
+
+	// Timecode (ID 62, even → varint value)
+	if tc := frame.Timecode; tc != nil {
+		exts = quicvarint.Append(exts, locExtTimecode)
+		exts = quicvarint.Append(exts, packTimecode(*tc))
+	}
+
+	// Source PTS and DTS in 90kHz ticks (IDs 68 and 70, even → varint value)
+	if frame.Has90k {
+		exts = quicvarint.Append(exts, locExtPTS90k)
+		exts = quicvarint.Append(exts, uint64(frame.PTS90k))
+		if frame.DTS90k != frame.PTS90k {
+			exts = quicvarint.Append(exts, locExtDTS90k)
+			exts = quicvarint.Append(exts, uint64(frame.DTS90k))
+		}
+	}
 
 	// Video Config on keyframes (ID 13, odd → length-prefixed bytes)
 	if frame.IsKeyframe && frame.SPS != nil && frame.PPS != nil {
@@ -101,8 +235,63 @@ func (m *moqWriter) WriteVideoFrame(w io.Writer, frame *media.VideoFrame) (int64
 			exts = append(exts, configData...)
 		}
 	}
+	return exts
+}
 
-	return m.writeObject(w, exts, payload)
+// appendFrameObject appends the locExtFrameObject extension for object
+// index of a frame sent as count objects.
+func appendFrameObject(exts []byte, index, count int) []byte {
+	value := uint64(index) << 1
+	if index == count-1 {
+		value |= 1
+	}
+	exts = quicvarint.Append(exts, locExtFrameObject)
+	return quicvarint.Append(exts, value)
+}
+
+// splitVCL splits an AVC1 payload into one part per VCL NAL unit, each
+// preceded by the non-VCL units before it. Non-VCL units after the last
+// slice join the last part. A payload without slices, or one that does
+// not parse, is returned whole. The parts alias payload.
+func splitVCL(payload []byte, codec string) [][]byte {
+	var parts [][]byte
+	start, pos := 0, 0
+	for pos+4 <= len(payload) {
+		size := int(binary.BigEndian.Uint32(payload[pos:]))
+		end := pos + 4 + size
+		if size == 0 || end > len(payload) {
+			return [][]byte{payload}
+		}
+		h := payload[pos+4]
+		if codec == "h265" && demux.IsHEVCVCL((h>>1)&0x3F) || codec != "h265" && demux.IsVCL(h&0x1F) {
+			parts = append(parts, payload[start:end])
+			start = end
+		}
+		pos = end
+	}
+	if len(parts) == 0 {
+		return [][]byte{payload}
+	}
+	if start < len(payload) {
+		last := len(parts) - 1
+		parts[last] = parts[last][:len(parts[last])+len(payload)-start]
+	}
+	return parts
+}
+
+// videoObjectCount returns how many objects carry frame in mode.
+func videoObjectCount(frame *media.VideoFrame, mode VideoObjectMode) uint64 {
+	if mode != VideoObjectPerNAL {
+		return 1
+	}
+	return uint64(len(splitVCL(videoPayload(frame), frame.Codec)))
+}
+
+// packTimecode packs a timecode into the locExtTimecode value, one byte
+// per field.
+func packTimecode(tc media.Timecode) uint64 {
+	return uint64(tc.Hours&0xFF)<<24 | uint64(tc.Minutes&0xFF)<<16 |
+		uint64(tc.Seconds&0xFF)<<8 | uint64(tc.Frames&0xFF)
 }
 
 func (m *moqWriter) WriteAudioFrame(w io.Writer, data []byte, timestampMS uint32) (int64, error) {
@@ -110,19 +299,63 @@ func (m *moqWriter) WriteAudioFrame(w io.Writer, data []byte, timestampMS uint32
 
 	var exts []byte
 	exts = quicvarint.Append(exts, locExtCaptureTimestamp)
-	exts = quicvarint.Append(exts, uint64(timestampMS)*1000)
+	exts = quicvarint.Append(exts, m.clock.captureTimestamp(int64(timestampMS)*1000))
+
+	return m.writeObject(w, exts, payload)
+}
 
+func (m *moqWriter) WriteAudioFrames(w io.Writer, frames []*media.AudioFrame) (int64, error) {
+	exts, payload := m.audioFramesObject(frames)
 	return m.writeObject(w, exts, payload)
 }
 
+// audioFramesObject returns the extensions and payload of an object
+// carrying several audio frames.
+func (m *moqWriter) audioFramesObject(frames []*media.AudioFrame) (exts, payload []byte) {
+	first := uint32(frames[0].PTS / 1000)
+
+	var index []byte
+	for _, f := range frames {
+		data := moq.StripADTS(f.Data)
+		payload = append(payload, data...)
+		index = quicvarint.Append(index, uint64(len(data)))
+		index = quicvarint.Append(index, uint64(uint32(f.PTS/1000)-first)*1000)
+	}
+
+	exts = quicvarint.Append(exts, locExtCaptureTimestamp)
+	exts = quicvarint.Append(exts, m.clock.captureTimestamp(int64(first)*1000))
+	exts = quicvarint.Append(exts, locExtAudioFrames)
+	exts = quicvarint.Append(exts, uint64(len(index)))
+	exts = append(exts, index...)
+	return exts, payload
+}
+
 func (m *moqWriter) WriteCaptionFrame(w io.Writer, data []byte, timestampMS uint32) (int64, error) {
 	var exts []byte
 	exts = quicvarint.Append(exts, locExtCaptureTimestamp)
-	exts = quicvarint.Append(exts, uint64(timestampMS)*1000)
+	exts = quicvarint.Append(exts, m.clock.captureTimestamp(int64(timestampMS)*1000))
 
 	return m.writeObject(w, exts, data)
 }
 
+// WriteObjectStatus writes an object with no extensions and a zero
+// payload length, which draft-15 follows with the object status in place
+// of a payload.
+func (m *moqWriter) WriteObjectStatus(w io.Writer, status ObjectStatus) (int64, error) {
+	var buf []byte
+	buf = quicvarint.Append(buf, m.objectID)
+	buf = quicvarint.Append(buf, 0) // extensions length
+	buf = quicvarint.Append(buf, 0) // payload length
+	buf = quicvarint.Append(buf, uint64(status))
+
+	m.objectID++
+
+	if _, err := w.Write(buf); err != nil {
+		return 0, err
+	}
+	return int64(len(buf)), nil
+}
+
 func (m *moqWriter) StreamHeaderSize() int64 {
 	size := quicvarint.Len(moqStreamTypeSubgroupSIDExt) +
 		quicvarint.Len(m.trackAlias) +
@@ -132,6 +365,49 @@ func (m *moqWriter) StreamHeaderSize() int64 {
 	return int64(size)
 }
 
+func (m *moqWriter) AudioDatagram(frames []*media.AudioFrame, objectID uint64, maxSize int) []byte {
+	var exts, payload []byte
+	if len(frames) == 1 {
+		tsMS := uint32(frames[0].PTS / 1000)
+		exts = quicvarint.Append(exts, locExtCaptureTimestamp)
+		exts = quicvarint.Append(exts, m.clock.captureTimestamp(int64(tsMS)*1000))
+		payload = moq.StripADTS(frames[0].Data)
+	} else {
+		exts, payload = m.audioFramesObject(frames)
+	}
+
+	d := moq.AppendObjectDatagram(nil, moq.ObjectDatagram{
+		TrackAlias:        m.trackAlias,
+		ObjectID:          objectID,
+		PublisherPriority: m.publisherPriority,
+		Extensions:        exts,
+		Payload:           payload,
+	})
+	if len(d) > maxSize {
+		return nil
+	}
+	return d
+}
+
+func (m *moqWriter) CaptionDatagram(groupID uint32, data []byte, timestampMS uint32, maxSize int) []byte {
+	var exts []byte
+	exts = quicvarint.Append(exts, locExtCaptureTimestamp)
+	exts = quicvarint.Append(exts, m.clock.captureTimestamp(int64(timestampMS)*1000))
+
+	d := moq.AppendObjectDatagram(nil, moq.ObjectDatagram{
+		TrackAlias:        m.trackAlias,
+		GroupID:           uint64(groupID),
+		PublisherPriority: m.publisherPriority,
+		Extensions:        exts,
+		EndOfGroup:        true,
+		Payload:           data,
+	})
+	if len(d) > maxSize {
+		return nil
+	}
+	return d
+}
+
 // writeObject writes a MoQ object header (with extensions) and payload.
 func (m *moqWriter) writeObject(w io.Writer, exts []byte, payload []byte) (int64, error) {
 	var hdr []byte
@@ -151,3 +427,52 @@ func (m *moqWriter) writeObject(w io.Writer, exts []byte, payload []byte) (int64
 	}
 	return total, nil
 }
+
+// writeFetchHeader writes the header opening a FETCH response stream.
+func writeFetchHeader(w io.Writer, requestID uint64) error {
+	var buf []byte
+	buf = quicvarint.Append(buf, moqStreamTypeFetchHeader)
+	buf = quicvarint.Append(buf, requestID)
+	_, err := w.Write(buf)
+	return err
+}
+
+// writeFetchVideoObjects writes one video frame on a FETCH response
+// stream as objects firstObjectID onward, mapping it to objects as mode
+// selects and its capture timestamp by clock, and returns the bytes and
+// objects written. Unlike subgroup
+// objects, fetch objects carry their full location and priority since a
+// single stream spans many groups.
+func writeFetchVideoObjects(w io.Writer, groupID, firstObjectID uint64, priority byte, frame *media.VideoFrame, mode VideoObjectMode, clock *wallClock) (int64, uint64, error) {
+	payload := videoPayload(frame)
+	parts := [][]byte{payload}
+	if mode == VideoObjectPerNAL {
+		parts = splitVCL(payload, frame.Codec)
+	}
+
+	var total int64
+	for i, part := range parts {
+		exts := videoExts(frame, i == 0, clock)
+		if mode == VideoObjectPerNAL {
+			exts = appendFrameObject(exts, i, len(parts))
+		}
+
+		var hdr []byte
+		hdr = quicvarint.Append(hdr, groupID)
+		hdr = quicvarint.Append(hdr, 0) // subgroup ID
+		hdr = quicvarint.Append(hdr, firstObjectID+uint64(i))
+		hdr = append(hdr, priority)
+		hdr = quicvarint.Append(hdr, uint64(len(exts)))
+		hdr = append(hdr, exts...)
+		hdr = quicvarint.Append(hdr, uint64(len(part)))
+
+		if _, err := w.Write(hdr); err != nil {
+			return total, uint64(i), err
+		}
+		if _, err := w.Write(part); err != nil {
+			return total, uint64(i), err
+		}
+		total += int64(len(hdr) + len(part))
+	}
+	return total, uint64(len(parts)), nil
+}
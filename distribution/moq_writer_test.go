@@ -3,10 +3,12 @@ package distribution
 import (
 	"bytes"
 	"encoding/binary"
+	"slices"
 	"testing"
 
 	"github.com/quic-go/quic-go/quicvarint"
 	"github.com/zsiec/prism/media"
+	"github.com/zsiec/prism/moq"
 )
 
 func TestMoQWriterSubgroupHeader(t *testing.T) {
@@ -278,6 +280,239 @@ func TestMoQWriterVideoFrameDelta(t *testing.T) {
 	}
 }
 
+// writtenVideoExts returns the even (varint-valued) extensions of the single
+// object written for frame.
+func writtenVideoExts(t *testing.T, frame *media.VideoFrame) map[uint64]uint64 {
+	t.Helper()
+	var buf bytes.Buffer
+	if _, err := NewMoQWriter(1, 0).WriteVideoFrame(&buf, frame); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	_, pos, _ := quicvarint.Parse(data) // object ID
+	extLen, nn, _ := quicvarint.Parse(data[pos:])
+	pos += nn
+	exts := make(map[uint64]uint64)
+	for end := pos + int(extLen); pos < end; {
+		id, nn, _ := quicvarint.Parse(data[pos:])
+		pos += nn
+		val, nn, _ := quicvarint.Parse(data[pos:])
+		pos += nn
+		if id%2 == 1 {
+			pos += int(val)
+			continue
+		}
+		exts[id] = val
+	}
+	return exts
+}
+
+func TestMoQWriterVideoFrameTimecode(t *testing.T) {
+	t.Parallel()
+
+	frame := &media.VideoFrame{
+		PTS:      33000,
+		WireData: []byte{0, 0, 0, 1, 0x41},
+		Timecode: &media.Timecode{Hours: 10, Minutes: 59, Seconds: 30, Frames: 24},
+	}
+	got, ok := writtenVideoExts(t, frame)[locExtTimecode]
+	if !ok {
+		t.Fatal("timecode extension missing")
+	}
+	if want := uint64(10<<24 | 59<<16 | 30<<8 | 24); got != want {
+		t.Errorf("timecode = %#x, want %#x", got, want)
+	}
+
+	frame.Timecode = nil
+	if _, ok := writtenVideoExts(t, frame)[locExtTimecode]; ok {
+		t.Error("frame without a timecode should not carry the extension")
+	}
+}
+
+func TestMoQWriterVideoFramePTS90k(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name           string
+		pts90k, dts90k int64
+		wantPTS        bool
+		wantDTS        bool
+	}{
+		{name: "none"},
+		{name: "zero PTS", wantPTS: true},
+		{name: "PTS only", pts90k: 8_589_934_591, dts90k: 8_589_934_591, wantPTS: true},
+		{name: "PTS and DTS", pts90k: 2_999_999_999, dts90k: 2_999_996_996, wantPTS: true, wantDTS: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			exts := writtenVideoExts(t, &media.VideoFrame{
+				PTS:      tt.pts90k * 1_000_000 / 90_000,
+				PTS90k:   tt.pts90k,
+				DTS90k:   tt.dts90k,
+				Has90k:   tt.wantPTS,
+				WireData: []byte{0, 0, 0, 1, 0x41},
+			})
+			pts, ok := exts[locExtPTS90k]
+			if ok != tt.wantPTS || ok && int64(pts) != tt.pts90k {
+				t.Errorf("PTS extension = %d (present %v), want %d (present %v)", pts, ok, tt.pts90k, tt.wantPTS)
+			}
+			dts, ok := exts[locExtDTS90k]
+			if ok != tt.wantDTS || ok && int64(dts) != tt.dts90k {
+				t.Errorf("DTS extension = %d (present %v), want %d (present %v)", dts, ok, tt.dts90k, tt.wantDTS)
+			}
+		})
+	}
+}
+
+func TestMoQWriterVideoFramePerNAL(t *testing.T) {
+	t.Parallel()
+
+	sps := []byte{0x67, 0x42, 0x00, 0x1E, 0x95, 0xA8}
+	pps := []byte{0x68, 0xCE, 0x38, 0x80}
+	sei := []byte{0x06, 0x05, 0x01, 0x00, 0x80}
+	slices := [][]byte{{0x65, 0x88, 0x01}, {0x65, 0x88, 0x02, 0x02}, {0x65, 0x88, 0x03}}
+	nalus := [][]byte{sps, pps, sei, slices[0], slices[1], slices[2]}
+	for i, n := range nalus {
+		nalus[i] = append([]byte{0, 0, 0, 1}, n...)
+	}
+	frame := &media.VideoFrame{
+		PTS:        90000,
+		IsKeyframe: true,
+		NALUs:      nalus,
+		SPS:        sps,
+		PPS:        pps,
+		Codec:      "h264",
+		GroupID:    1,
+	}
+
+	var buf bytes.Buffer
+	w := newMoQVideoWriter(1, 0, VideoObjectPerNAL, nil)
+	n, err := w.WriteVideoFrame(&buf, frame)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(buf.Len()) {
+		t.Errorf("returned %d bytes, wrote %d", n, buf.Len())
+	}
+
+	type object struct {
+		id      uint64
+		exts    map[uint64]uint64 // even extensions
+		config  bool
+		payload []byte
+	}
+	var objects []object
+	for data := buf.Bytes(); len(data) > 0; {
+		var o object
+		var nn int
+		o.id, nn, _ = quicvarint.Parse(data)
+		data = data[nn:]
+		extLen, nn, _ := quicvarint.Parse(data)
+		data = data[nn:]
+		o.exts = make(map[uint64]uint64)
+		for exts := data[:extLen]; len(exts) > 0; {
+			id, nn, _ := quicvarint.Parse(exts)
+			exts = exts[nn:]
+			val, nn, _ := quicvarint.Parse(exts)
+			exts = exts[nn:]
+			if id%2 == 1 {
+				o.config = o.config || id == locExtVideoConfig
+				exts = exts[val:]
+				continue
+			}
+			o.exts[id] = val
+		}
+		data = data[extLen:]
+		size, nn, _ := quicvarint.Parse(data)
+		data = data[nn:]
+		o.payload = data[:size]
+		data = data[size:]
+		objects = append(objects, o)
+	}
+
+	if len(objects) != len(slices) {
+		t.Fatalf("objects = %d, want one per slice (%d)", len(objects), len(slices))
+	}
+	var joined []byte
+	for i, o := range objects {
+		if o.id != uint64(i) {
+			t.Errorf("object %d: ID = %d", i, o.id)
+		}
+		want := uint64(i) << 1
+		if i == len(objects)-1 {
+			want |= 1
+		}
+		if got, ok := o.exts[locExtFrameObject]; !ok || got != want {
+			t.Errorf("object %d: frame object extension = %d (present %v), want %d", i, got, ok, want)
+		}
+		if o.exts[locExtVideoFrameMarking] != vfmKeyframe || o.exts[locExtCaptureTimestamp] != 90000 {
+			t.Errorf("object %d: missing frame marking or capture timestamp: %v", i, o.exts)
+		}
+		if o.config != (i == 0) {
+			t.Errorf("object %d: video config present = %v, want only on the first object", i, o.config)
+		}
+		joined = append(joined, o.payload...)
+	}
+	if want := moq.AnnexBToAVC1(nalus[:4]); !bytes.Equal(objects[0].payload, want) {
+		t.Errorf("first object = % x, want parameter sets, SEI and first slice % x", objects[0].payload, want)
+	}
+	if !bytes.Equal(joined, moq.AnnexBToAVC1(nalus)) {
+		t.Error("objects do not reassemble into the frame")
+	}
+	if got := videoObjectCount(frame, VideoObjectPerNAL); got != uint64(len(slices)) {
+		t.Errorf("videoObjectCount = %d, want %d", got, len(slices))
+	}
+	if got := videoObjectCount(frame, VideoObjectPerFrame); got != 1 {
+		t.Errorf("videoObjectCount per frame = %d, want 1", got)
+	}
+}
+
+func TestSplitVCL(t *testing.T) {
+	t.Parallel()
+
+	avc1 := func(nalus ...[]byte) []byte {
+		var out []byte
+		for _, n := range nalus {
+			out = binary.BigEndian.AppendUint32(out, uint32(len(n)))
+			out = append(out, n...)
+		}
+		return out
+	}
+	slice, sei, filler := []byte{0x41, 0x9A}, []byte{0x06, 0x01}, []byte{0x0C, 0xFF}
+	hevcSlice, hevcSEI := []byte{0x02, 0x01, 0xD0}, []byte{0x4E, 0x01, 0x05}
+
+	tests := []struct {
+		name  string
+		codec string
+		data  []byte
+		want  [][]byte
+	}{
+		{"single slice", "h264", avc1(slice), [][]byte{avc1(slice)}},
+		{"trailing non-VCL joins last", "h264", avc1(slice, slice, filler), [][]byte{avc1(slice), avc1(slice, filler)}},
+		{"leading non-VCL joins first", "h264", avc1(sei, slice, slice), [][]byte{avc1(sei, slice), avc1(slice)}},
+		{"no slices", "h264", avc1(sei), [][]byte{avc1(sei)}},
+		{"HEVC", "h265", avc1(hevcSEI, hevcSlice, hevcSlice), [][]byte{avc1(hevcSEI, hevcSlice), avc1(hevcSlice)}},
+		{"malformed", "h264", []byte{0, 0, 0, 9, 0x41}, [][]byte{{0, 0, 0, 9, 0x41}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got := splitVCL(tt.data, tt.codec)
+			if len(got) != len(tt.want) {
+				t.Fatalf("parts = %d, want %d", len(got), len(tt.want))
+			}
+			for i := range got {
+				if !bytes.Equal(got[i], tt.want[i]) {
+					t.Errorf("part %d = % x, want % x", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
 func TestMoQWriterAudioFrame(t *testing.T) {
 	t.Parallel()
 	w := NewMoQWriter(2, 64)
@@ -351,6 +586,64 @@ func TestMoQWriterAudioFrame(t *testing.T) {
 	}
 }
 
+func TestMoQWriterAudioFrames(t *testing.T) {
+	t.Parallel()
+	w := NewMoQWriter(2, 64)
+	var buf bytes.Buffer
+
+	frames := []*media.AudioFrame{
+		{PTS: 5_000_000, Data: []byte{0xFF, 0xF1, 0x50, 0x80, 0x02, 0x00, 0xFC, 0xDE, 0xAD}}, // ADTS
+		{PTS: 5_021_333, Data: []byte{0xBE, 0xEF, 0x01}},
+		{PTS: 5_042_666, Data: []byte{0x02}},
+	}
+	n, err := w.WriteAudioFrames(&buf, frames)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(buf.Len()) {
+		t.Errorf("bytes written: got %d, actual buffer %d", n, buf.Len())
+	}
+
+	data := buf.Bytes()
+	_, pos, _ := quicvarint.Parse(data) // object ID
+	extLen, nn, _ := quicvarint.Parse(data[pos:])
+	pos += nn
+
+	var capture uint64
+	var index []uint64
+	for end := pos + int(extLen); pos < end; {
+		id, nn, _ := quicvarint.Parse(data[pos:])
+		pos += nn
+		val, nn, _ := quicvarint.Parse(data[pos:])
+		pos += nn
+		switch id {
+		case locExtCaptureTimestamp:
+			capture = val
+		case locExtAudioFrames:
+			for ext := data[pos : pos+int(val)]; len(ext) > 0; {
+				v, nn, _ := quicvarint.Parse(ext)
+				index = append(index, v)
+				ext = ext[nn:]
+			}
+			pos += int(val)
+		}
+	}
+	if capture != 5_000_000 {
+		t.Errorf("capture timestamp = %d, want 5000000", capture)
+	}
+	// Size and offset of each frame, with the ADTS header stripped and
+	// offsets at the millisecond precision of single-frame objects.
+	if want := []uint64{2, 0, 3, 21_000, 1, 42_000}; !slices.Equal(index, want) {
+		t.Errorf("frame index = %v, want %v", index, want)
+	}
+
+	payloadLen, nn, _ := quicvarint.Parse(data[pos:])
+	pos += nn
+	if payload := data[pos : pos+int(payloadLen)]; !bytes.Equal(payload, []byte{0xDE, 0xAD, 0xBE, 0xEF, 0x01, 0x02}) {
+		t.Errorf("payload = %x, want the frames back to back", payload)
+	}
+}
+
 func TestMoQWriterCaptionFrame(t *testing.T) {
 	t.Parallel()
 	w := NewMoQWriter(10, 200)
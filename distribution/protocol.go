@@ -16,6 +16,7 @@ import (
 const (
 	TrackIDVideo     byte = 0
 	TrackIDCaptions  byte = 2
+	TrackIDSCTE35    byte = 3
 	TrackIDAudioBase byte = 10
 )
 
@@ -24,21 +25,80 @@ const (
 // that fall behind should drop rather than accumulate stale text.
 const viewerCaptionBuffer = 10
 
-// Publisher priority values for MoQ track subscriptions. Lower values
-// indicate higher priority. Video and audio share the highest priority
-// so neither starves under congestion. Captions and stats are deprioritized.
+// Default publisher priority values for MoQ track subscriptions. Lower
+// values indicate higher priority. Video and audio share the highest
+// priority so neither starves under congestion, unless the server runs
+// audio-first, in which case audio is published ahead of video. Captions,
+// SCTE-35 cues and stats are deprioritized.
 const (
-	priorityVideo    = 128
-	priorityAudio    = 128
-	priorityCaptions = 200
-	priorityStats    = 220
+	priorityVideo      = 128
+	priorityAudio      = 128
+	priorityAudioFirst = 64
+	priorityCaptions   = 200
+	prioritySCTE35     = 200
+	priorityStats      = 220
 )
 
+// TrackPriorities overrides the publisher priority of each track type,
+// letting a deployment favour audio over video (radio-like) or captions
+// over audio (accessibility) under congestion. Lower values are sent
+// first. A zero field keeps the default, so 1 is the highest priority
+// that can be configured.
+type TrackPriorities struct {
+	Video    byte
+	Audio    byte
+	Captions byte
+	SCTE35   byte
+	Stats    byte
+}
+
+// withDefaults fills unset fields with the default priorities. Audio
+// defaults to priorityAudioFirst when audioFirst is set.
+func (p TrackPriorities) withDefaults(audioFirst bool) TrackPriorities {
+	audio := byte(priorityAudio)
+	if audioFirst {
+		audio = priorityAudioFirst
+	}
+	for _, f := range []struct {
+		dst *byte
+		def byte
+	}{
+		{&p.Video, priorityVideo},
+		{&p.Audio, audio},
+		{&p.Captions, priorityCaptions},
+		{&p.SCTE35, prioritySCTE35},
+		{&p.Stats, priorityStats},
+	} {
+		if *f.dst == 0 {
+			*f.dst = f.def
+		}
+	}
+	return p
+}
+
+// Per-viewer SCTE-35 channel buffer size. Cues arrive a few times per
+// break at most, so a small buffer suffices.
+const viewerSCTE35Buffer = 8
+
 // AudioTrackID converts a zero-based audio track index to its wire track ID.
 func AudioTrackID(trackIndex int) byte {
 	return TrackIDAudioBase + byte(trackIndex)
 }
 
+// ObjectStatus is the status of a payload-less object, telling the viewer
+// why an object ID carries no data (draft-ietf-moq-transport-15).
+type ObjectStatus uint64
+
+const (
+	// ObjectStatusDoesNotExist marks an object that was produced but
+	// dropped before it could be delivered.
+	ObjectStatusDoesNotExist ObjectStatus = 0x1
+
+	// ObjectStatusEndOfGroup marks the end of a group cut short: no
+	// objects with a larger ID follow in it.
+	ObjectStatusEndOfGroup ObjectStatus = 0x3
+)
+
 // StreamFrameWriter abstracts the wire format used to write media data to
 // WebTransport unidirectional streams. The MoQ writer implements this
 // interface using MoQ Transport subgroup/object framing with LOC extensions.
@@ -47,6 +107,12 @@ type StreamFrameWriter interface {
 	// at the start of a new unidirectional stream.
 	WriteStreamHeader(w io.Writer, trackID byte, groupID uint32, timestampMS uint32) error
 
+	// ResumeStreamHeader writes a subgroup header for a group whose
+	// earlier objects were delivered on another stream or as datagrams,
+	// such as a joining fetch. The next object written carries
+	// firstObjectID.
+	ResumeStreamHeader(w io.Writer, groupID uint32, firstObjectID uint64) error
+
 	// WriteVideoFrame writes a single video frame (header + payload) to w,
 	// returning the total bytes written.
 	WriteVideoFrame(w io.Writer, frame *media.VideoFrame) (int64, error)
@@ -55,11 +121,30 @@ type StreamFrameWriter interface {
 	// returning the total bytes written.
 	WriteAudioFrame(w io.Writer, data []byte, timestampMS uint32) (int64, error)
 
+	// WriteAudioFrames writes several audio frames of one track as a
+	// single object, each keeping its own timestamp, returning the total
+	// bytes written. frames must not be empty.
+	WriteAudioFrames(w io.Writer, frames []*media.AudioFrame) (int64, error)
+
 	// WriteCaptionFrame writes a single caption frame (header + payload) to w,
 	// returning the total bytes written.
 	WriteCaptionFrame(w io.Writer, data []byte, timestampMS uint32) (int64, error)
 
+	// WriteObjectStatus writes a payload-less object carrying status in
+	// place of the next object, returning the total bytes written.
+	WriteObjectStatus(w io.Writer, status ObjectStatus) (int64, error)
+
 	// StreamHeaderSize returns the byte size of the stream header written
 	// by WriteStreamHeader, used for accurate byte accounting.
 	StreamHeaderSize() int64
+
+	// AudioDatagram returns audio frames as object objectID of the audio
+	// track's group in an object datagram, or nil if it would exceed
+	// maxSize bytes.
+	AudioDatagram(frames []*media.AudioFrame, objectID uint64, maxSize int) []byte
+
+	// CaptionDatagram returns a caption frame as the only object of group
+	// groupID in an object datagram, or nil if it would exceed maxSize
+	// bytes.
+	CaptionDatagram(groupID uint32, data []byte, timestampMS uint32, maxSize int) []byte
 }
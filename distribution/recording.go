@@ -0,0 +1,107 @@
+package distribution
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+// Errors a RecordController returns for requests naming something that
+// does not exist. The recording API maps both to 404 Not Found.
+var (
+	ErrStreamNotFound    = errors.New("distribution: stream not found")
+	ErrRecordingNotFound = errors.New("distribution: recording not found")
+)
+
+// Recording describes one recording session of a stream, as returned by
+// the /api/streams/{key}/record endpoints.
+type Recording struct {
+	ID         string    `json:"id"`
+	StreamKey  string    `json:"streamKey"`
+	Path       string    `json:"path"`
+	StartedAt  time.Time `json:"startedAt"`
+	Bytes      int64     `json:"bytes"`
+	DurationMs int64     `json:"durationMs"`
+}
+
+// RecordController starts and stops recordings of live streams on behalf
+// of the recording API, giving operators DVR control over HTTP. TSRecorder
+// is the bundled implementation.
+type RecordController interface {
+	// StartRecording begins recording streamKey, returning the new
+	// recording. It returns ErrStreamNotFound if the stream is not live.
+	StartRecording(streamKey string) (Recording, error)
+
+	// StopRecording ends the recording id of streamKey, returning its
+	// final state. It returns ErrRecordingNotFound if there is no such
+	// recording.
+	StopRecording(streamKey, id string) (Recording, error)
+
+	// Recordings returns the recordings of streamKey in progress.
+	Recordings(streamKey string) []Recording
+}
+
+// recordErrorStatus maps a RecordController error to an HTTP status.
+func recordErrorStatus(err error) int {
+	if errors.Is(err, ErrStreamNotFound) || errors.Is(err, ErrRecordingNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusConflict
+}
+
+func (s *Server) handleRecordList(w http.ResponseWriter, r *http.Request) {
+	if s.config.Recorder == nil {
+		writeJSON(w, http.StatusOK, []Recording{})
+		return
+	}
+	recs := s.config.Recorder.Recordings(r.PathValue("key"))
+	if recs == nil {
+		recs = []Recording{}
+	}
+	writeJSON(w, http.StatusOK, recs)
+}
+
+func (s *Server) handleRecordStart(w http.ResponseWriter, r *http.Request) {
+	if s.config.Recorder == nil {
+		writeError(w, http.StatusNotImplemented, "recording not configured")
+		return
+	}
+	rec, err := s.config.Recorder.StartRecording(r.PathValue("key"))
+	if err != nil {
+		writeError(w, recordErrorStatus(err), err.Error())
+		return
+	}
+	writeJSON(w, http.StatusCreated, rec)
+}
+
+// handleRecordStop stops the recording named by the id query parameter,
+// or every recording of the stream if it is omitted.
+func (s *Server) handleRecordStop(w http.ResponseWriter, r *http.Request) {
+	if s.config.Recorder == nil {
+		writeError(w, http.StatusNotImplemented, "recording not configured")
+		return
+	}
+	streamKey := r.PathValue("key")
+	ids := []string{r.URL.Query().Get("id")}
+	if ids[0] == "" {
+		ids = ids[:0]
+		for _, rec := range s.config.Recorder.Recordings(streamKey) {
+			ids = append(ids, rec.ID)
+		}
+		if len(ids) == 0 {
+			writeError(w, http.StatusNotFound, ErrRecordingNotFound.Error())
+			return
+		}
+	}
+
+	stopped := make([]Recording, 0, len(ids))
+	for _, id := range ids {
+		rec, err := s.config.Recorder.StopRecording(streamKey, id)
+		if err != nil {
+			writeError(w, recordErrorStatus(err), err.Error())
+			return
+		}
+		stopped = append(stopped, rec)
+	}
+	writeJSON(w, http.StatusOK, stopped)
+}
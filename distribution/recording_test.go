@@ -0,0 +1,271 @@
+package distribution
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zsiec/prism/media"
+)
+
+// fakeRecorder is an in-memory RecordController for the API tests.
+type fakeRecorder struct {
+	mu     sync.Mutex
+	live   map[string]bool
+	active map[string]Recording
+	nextID int
+}
+
+func newFakeRecorder(streams ...string) *fakeRecorder {
+	f := &fakeRecorder{live: make(map[string]bool), active: make(map[string]Recording)}
+	for _, s := range streams {
+		f.live[s] = true
+	}
+	return f
+}
+
+func (f *fakeRecorder) StartRecording(streamKey string) (Recording, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.live[streamKey] {
+		return Recording{}, ErrStreamNotFound
+	}
+	f.nextID++
+	rec := Recording{ID: fmt.Sprintf("rec-%d", f.nextID), StreamKey: streamKey, StartedAt: time.Now()}
+	f.active[rec.ID] = rec
+	return rec, nil
+}
+
+func (f *fakeRecorder) StopRecording(streamKey, id string) (Recording, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	rec, ok := f.active[id]
+	if !ok || rec.StreamKey != streamKey {
+		return Recording{}, ErrRecordingNotFound
+	}
+	delete(f.active, id)
+	return rec, nil
+}
+
+func (f *fakeRecorder) Recordings(streamKey string) []Recording {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var recs []Recording
+	for _, rec := range f.active {
+		if rec.StreamKey == streamKey {
+			recs = append(recs, rec)
+		}
+	}
+	return recs
+}
+
+func doRecordRequest(t *testing.T, h http.Handler, method, url string) (int, []byte) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, url, nil))
+	return rec.Code, rec.Body.Bytes()
+}
+
+func TestRecordAPILifecycle(t *testing.T) {
+	t.Parallel()
+
+	srv := newTestServer(t)
+	srv.config.Recorder = newFakeRecorder("live")
+	h := srv.APIHandler()
+
+	code, body := doRecordRequest(t, h, http.MethodPost, "/api/streams/live/record")
+	if code != http.StatusCreated {
+		t.Fatalf("start status = %d, want %d: %s", code, http.StatusCreated, body)
+	}
+	var started Recording
+	if err := json.Unmarshal(body, &started); err != nil {
+		t.Fatal(err)
+	}
+	if started.ID == "" || started.StreamKey != "live" {
+		t.Fatalf("started = %+v, want an ID and stream live", started)
+	}
+
+	code, body = doRecordRequest(t, h, http.MethodGet, "/api/streams/live/record")
+	var list []Recording
+	if err := json.Unmarshal(body, &list); err != nil {
+		t.Fatal(err)
+	}
+	if code != http.StatusOK || len(list) != 1 || list[0].ID != started.ID {
+		t.Fatalf("list = %d %+v, want the started recording", code, list)
+	}
+
+	code, body = doRecordRequest(t, h, http.MethodDelete, "/api/streams/live/record?id="+started.ID)
+	var stopped []Recording
+	if err := json.Unmarshal(body, &stopped); err != nil {
+		t.Fatal(err)
+	}
+	if code != http.StatusOK || len(stopped) != 1 || stopped[0].ID != started.ID {
+		t.Fatalf("stop = %d %+v, want the started recording", code, stopped)
+	}
+
+	code, body = doRecordRequest(t, h, http.MethodGet, "/api/streams/live/record")
+	if code != http.StatusOK || strings.TrimSpace(string(body)) != "[]" {
+		t.Fatalf("list after stop = %d %s, want []", code, body)
+	}
+}
+
+func TestRecordAPIErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		recorder RecordController
+		method   string
+		url      string
+		want     int
+	}{
+		{"start not configured", nil, http.MethodPost, "/api/streams/live/record", http.StatusNotImplemented},
+		{"stop not configured", nil, http.MethodDelete, "/api/streams/live/record", http.StatusNotImplemented},
+		{"list not configured", nil, http.MethodGet, "/api/streams/live/record", http.StatusOK},
+		{"start unknown stream", newFakeRecorder("live"), http.MethodPost, "/api/streams/other/record", http.StatusNotFound},
+		{"stop unknown id", newFakeRecorder("live"), http.MethodDelete, "/api/streams/live/record?id=rec-9", http.StatusNotFound},
+		{"stop none active", newFakeRecorder("live"), http.MethodDelete, "/api/streams/live/record", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			srv := newTestServer(t)
+			srv.config.Recorder = tt.recorder
+			if code, body := doRecordRequest(t, srv.APIHandler(), tt.method, tt.url); code != tt.want {
+				t.Errorf("status = %d, want %d: %s", code, tt.want, body)
+			}
+		})
+	}
+}
+
+func TestTSRecorder(t *testing.T) {
+	t.Parallel()
+
+	srv := newTestServer(t)
+	relay := srv.RegisterStream("live")
+	rec := NewTSRecorder(t.TempDir(), srv.GetRelay)
+
+	if _, err := rec.StartRecording("missing"); err != ErrStreamNotFound {
+		t.Fatalf("start missing stream: err = %v, want ErrStreamNotFound", err)
+	}
+
+	started, err := rec.StartRecording("live")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := rec.Recordings("live"); len(got) != 1 || got[0].ID != started.ID {
+		t.Fatalf("Recordings = %+v, want the started recording", got)
+	}
+
+	relay.BroadcastVideo(&media.VideoFrame{
+		PTS:        1_000_000,
+		DTS:        1_000_000,
+		IsKeyframe: true,
+		NALUs:      [][]byte{{0, 0, 0, 1, 0x65, 0x88, 0x84}},
+		SPS:        []byte{0x67, 0x42, 0x00, 0x1E, 0x95, 0xA8},
+		PPS:        []byte{0x68, 0xCE, 0x38, 0x80},
+		Codec:      "h264",
+		GroupID:    1,
+	})
+	deadline := time.Now().Add(2 * time.Second)
+	for rec.Recordings("live")[0].Bytes == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("recording wrote nothing")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	stopped, err := rec.StopRecording("live", started.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.Recordings("live")) != 0 {
+		t.Error("recording still listed after stop")
+	}
+	data, err := os.ReadFile(stopped.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(len(data)) != stopped.Bytes || len(data)%188 != 0 || data[0] != 0x47 {
+		t.Errorf("file is %d bytes (reported %d), want whole TS packets", len(data), stopped.Bytes)
+	}
+	if _, err := rec.StopRecording("live", started.ID); err != ErrRecordingNotFound {
+		t.Errorf("second stop: err = %v, want ErrRecordingNotFound", err)
+	}
+}
+
+func TestAdminAuthorizer(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		auth   string
+		want   int
+	}{
+		{"start without token", http.MethodPost, "/api/streams/live/record", "", http.StatusUnauthorized},
+		{"start with wrong token", http.MethodPost, "/api/streams/live/record", "Bearer wrong", http.StatusUnauthorized},
+		{"start with token", http.MethodPost, "/api/streams/live/record", "Bearer secret", http.StatusCreated},
+		{"stop without token", http.MethodDelete, "/api/streams/live/record", "", http.StatusUnauthorized},
+		{"list without token", http.MethodGet, "/api/streams/live/record", "", http.StatusOK},
+		{"SRT pull without token", http.MethodPost, "/api/srt-pull", "", http.StatusUnauthorized},
+		{"SRT pull stop without token", http.MethodDelete, "/api/srt-pull?streamKey=live", "", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			srv := newTestServer(t)
+			srv.config.Recorder = newFakeRecorder("live")
+			srv.config.AdminAuthorizer = func(token string) error {
+				if token != "secret" {
+					return fmt.Errorf("bad token %q", token)
+				}
+				return nil
+			}
+
+			req := httptest.NewRequest(tt.method, tt.url, nil)
+			if tt.auth != "" {
+				req.Header.Set("Authorization", tt.auth)
+			}
+			rec := httptest.NewRecorder()
+			srv.APIHandler().ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+}
+
+func TestTSRecorderStreamEnd(t *testing.T) {
+	t.Parallel()
+
+	srv := newTestServer(t)
+	srv.RegisterStream("live")
+	rec := NewTSRecorder(t.TempDir(), srv.GetRelay)
+
+	started, err := rec.StartRecording("live")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.UnregisterStream("live")
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(rec.Recordings("live")) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("recording still listed after its stream ended")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if _, err := rec.StopRecording("live", started.ID); err != ErrRecordingNotFound {
+		t.Errorf("stop after the stream ended: err = %v, want ErrRecordingNotFound", err)
+	}
+}
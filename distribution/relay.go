@@ -1,11 +1,16 @@
 package distribution
 
 import (
+	"bytes"
 	"context"
 	"log/slog"
+	"math"
+	"slices"
 	"sync"
+	"sync/atomic"
+	"time"
 
-	"github.com/zsiec/ccx"
+	"github.com/zsiec/prism/demux"
 	"github.com/zsiec/prism/media"
 	"github.com/zsiec/prism/moq"
 )
@@ -16,7 +21,8 @@ type Viewer interface {
 	ID() string
 	SendVideo(frame *media.VideoFrame)
 	SendAudio(frame *media.AudioFrame)
-	SendCaptions(frame *ccx.CaptionFrame)
+	SendCaptions(frame *media.CaptionFrame)
+	SendSCTE35(event *demux.SCTE35Event)
 	Stats() ViewerStats
 }
 
@@ -30,12 +36,30 @@ type VideoInfo struct {
 	DecoderConfig []byte // AVCDecoderConfigurationRecord or HEVCDecoderConfigurationRecord
 }
 
+// Equal reports whether two VideoInfo values describe the same decoder
+// configuration.
+func (v VideoInfo) Equal(o VideoInfo) bool {
+	return v.Codec == o.Codec && v.Width == o.Width && v.Height == o.Height &&
+		bytes.Equal(v.DecoderConfig, o.DecoderConfig)
+}
+
 // AudioInfo holds the audio codec parameters for a single track, derived
-// from the first ADTS frame seen by the demuxer.
+// from the first audio frame seen by the demuxer.
 type AudioInfo struct {
-	Codec      string
+	Codec      string // catalog codec string: "mp4a.40.02", "ac-3" or "ec-3"
 	SampleRate int
 	Channels   int
+	// Config is the MPEG-4 AudioSpecificConfig derived from the ADTS
+	// header, advertised as the audio track's catalog init data. It is
+	// nil for AC-3 and E-AC-3, whose frames describe themselves.
+	Config []byte
+}
+
+// Equal reports whether two AudioInfo values describe the same decoder
+// configuration.
+func (a AudioInfo) Equal(o AudioInfo) bool {
+	return a.Codec == o.Codec && a.SampleRate == o.SampleRate && a.Channels == o.Channels &&
+		bytes.Equal(a.Config, o.Config)
 }
 
 // audioCacheSize is the number of recent audio frames cached per track
@@ -46,7 +70,9 @@ const audioCacheSize = 50
 // and caption frames from the pipeline to all connected MoQ viewers. It also
 // caches the current GOP so that late-joining viewers can start playback
 // immediately from the most recent keyframe, and recent audio frames so that
-// new audio subscribers can pre-fill their buffers.
+// new audio subscribers can pre-fill their buffers. Broadcasts fan out over
+// a snapshot of the viewers, so viewers joining and leaving never hold up
+// frame delivery.
 type Relay struct {
 	log             *slog.Logger
 	mu              sync.RWMutex
@@ -55,14 +81,48 @@ type Relay struct {
 	videoInfo       VideoInfo
 	videoInfoSet    bool
 	videoInfoReady  chan struct{}
-	audioInfo       AudioInfo
-	audioInfoSet    bool
+	videoReadyShut  bool // videoInfoReady has been closed
+	noVideo         bool // PMT declared no video elementary stream
+	audioInfo       map[int]AudioInfo
+	hasSCTE35       bool
+
+	// viewers is a copy-on-write snapshot of sessions, which the
+	// broadcast paths iterate without taking mu. AddViewer and
+	// RemoveViewer replace it under mu.
+	viewers atomic.Pointer[[]Viewer]
+
+	// catalogSeq counts changes to anything the catalog advertises;
+	// catalogChanged is closed and replaced on each change.
+	catalogSeq     uint64
+	catalogChanged chan struct{}
+
+	// closed is set by Close, after which no viewer can be added. done is
+	// closed with it; detached is closed once the relay is closed and its
+	// last viewer has left.
+	closed   bool
+	done     chan struct{}
+	detached chan struct{}
 
 	gopMu    sync.RWMutex
 	gopCache []*media.VideoFrame
+	dvr      *dvrBuffer // nil unless SetDVRWindow enabled time-shift
+
+	// paramSets holds the latest parameter sets seen on any video frame,
+	// under gopMu, for keyframes that arrive without them.
+	paramSets videoParamSets
+
+	// gopLimit caps the frames cached for one GOP, under gopMu; zero is
+	// unlimited. gopOverflow is set once the current GOP has passed it,
+	// until the next keyframe.
+	gopLimit    int
+	gopOverflow bool
 
 	audioMu    sync.RWMutex
 	audioCache map[int][]*media.AudioFrame
+
+	// clock maps PTS to wall-clock capture timestamps; nil in the
+	// default media clock mode. See SetTimestampMode.
+	clock atomic.Pointer[wallClock]
 }
 
 // NewRelay creates a Relay with no viewers.
@@ -71,36 +131,173 @@ func NewRelay() *Relay {
 		log:            slog.With("component", "relay"),
 		sessions:       make(map[string]Viewer),
 		videoInfoReady: make(chan struct{}),
+		catalogChanged: make(chan struct{}),
+		done:           make(chan struct{}),
+		detached:       make(chan struct{}),
 		audioCache:     make(map[int][]*media.AudioFrame),
+		audioInfo:      make(map[int]AudioInfo),
+	}
+}
+
+// Close stops the relay accepting viewers and closes Done, telling those
+// attached that the stream has ended. It is safe to call more than once.
+func (r *Relay) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return
+	}
+	r.closed = true
+	close(r.done)
+	if len(r.sessions) == 0 {
+		close(r.detached)
 	}
 }
 
-// SetVideoInfo stores the video codec parameters detected from the first
-// keyframe. Called by the pipeline once SPS parsing succeeds.
+// Done returns a channel that is closed when the relay is closed. Viewer
+// loops select on it to end with the stream.
+func (r *Relay) Done() <-chan struct{} {
+	return r.done
+}
+
+// WaitDetached blocks until the relay is closed and every viewer has been
+// removed, or ctx is done, reporting whether the viewers all left.
+func (r *Relay) WaitDetached(ctx context.Context) bool {
+	select {
+	case <-r.detached:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// relayContext returns a context that is also cancelled when relay is
+// closed, so a viewer's loop ends with its stream.
+func relayContext(parent context.Context, relay *Relay) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+	go func() {
+		select {
+		case <-relay.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// CatalogUpdates returns the current catalog sequence number and a channel
+// that is closed the next time the catalog content changes, for example
+// when the source switches resolution mid-stream.
+func (r *Relay) CatalogUpdates() (seq uint64, changed <-chan struct{}) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.catalogSeq, r.catalogChanged
+}
+
+// bumpCatalogLocked records a catalog change and wakes waiters. Callers
+// hold r.mu.
+func (r *Relay) bumpCatalogLocked() {
+	r.catalogSeq++
+	close(r.catalogChanged)
+	r.catalogChanged = make(chan struct{})
+}
+
+// RefreshCatalog bumps the catalog so subscribed viewers receive a fresh
+// copy even though nothing it advertises changed, for example at a source
+// discontinuity where clients reset their decoders.
+func (r *Relay) RefreshCatalog() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.bumpCatalogLocked()
+}
+
+// SetVideoInfo stores the video codec parameters detected from a keyframe.
+// Called by the pipeline once SPS parsing succeeds, and again whenever the
+// parameters change mid-stream; a change bumps the catalog so subscribed
+// viewers receive an updated copy.
 func (r *Relay) SetVideoInfo(info VideoInfo) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	if !r.videoInfoSet {
-		r.videoInfo = info
-		r.videoInfoSet = true
-		close(r.videoInfoReady)
+	if r.videoInfoSet && r.videoInfo.Equal(info) {
+		return
+	}
+	if r.videoInfoSet {
+		r.log.Info("video parameters changed",
+			"codec", info.Codec,
+			"width", info.Width,
+			"height", info.Height,
+			"previousWidth", r.videoInfo.Width,
+			"previousHeight", r.videoInfo.Height)
+	} else {
 		r.log.Debug("video info set",
 			"codec", info.Codec,
 			"width", info.Width,
 			"height", info.Height,
 			"decoderConfigLen", len(info.DecoderConfig))
 	}
+	r.videoInfo = info
+	r.videoInfoSet = true
+	r.noVideo = false
+	r.closeVideoReadyLocked()
+	r.bumpCatalogLocked()
+}
+
+// SetHasVideo records whether the stream carries video, as declared by the
+// PMT. Marking a stream audio-only releases viewers blocked in
+// WaitVideoInfo and drops the video track from the catalog.
+func (r *Relay) SetHasVideo(has bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	noVideo := !has && !r.videoInfoSet
+	if noVideo == r.noVideo {
+		return
+	}
+	r.noVideo = noVideo
+	r.bumpCatalogLocked()
+	if r.noVideo {
+		r.closeVideoReadyLocked()
+		r.log.Info("audio-only stream, skipping video wait")
+	}
+}
+
+// HasVideo reports whether the stream carries video. It returns true until
+// SetHasVideo(false) is called, so viewers of a stream whose PMT has not
+// been parsed yet still wait for video.
+func (r *Relay) HasVideo() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return !r.noVideo
+}
+
+// HasVideoInfo reports whether real video codec parameters have been
+// received, i.e. whether WaitVideoInfo would return true without blocking.
+func (r *Relay) HasVideoInfo() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.videoInfoSet
+}
+
+// closeVideoReadyLocked closes videoInfoReady once. Callers hold r.mu.
+func (r *Relay) closeVideoReadyLocked() {
+	if !r.videoReadyShut {
+		close(r.videoInfoReady)
+		r.videoReadyShut = true
+	}
 }
 
 // SetAudioTrackCount sets the number of audio tracks discovered by the demuxer,
 // used to advertise available tracks during viewer connection setup.
 func (r *Relay) SetAudioTrackCount(count int) {
+	if count == 0 {
+		count = 1
+	}
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	r.audioTrackCount = count
-	if count == 0 {
-		r.audioTrackCount = 1
+	if count == r.audioTrackCount {
+		return
 	}
+	r.audioTrackCount = count
+	r.bumpCatalogLocked()
 }
 
 // AudioTrackCount returns the number of audio tracks, defaulting to 1.
@@ -114,27 +311,41 @@ func (r *Relay) AudioTrackCount() int {
 }
 
 // SetAudioInfo stores the audio codec parameters detected from the first
-// audio frame. Called by the pipeline once ADTS header parsing succeeds.
-func (r *Relay) SetAudioInfo(info AudioInfo) {
+// frame of audio track track. Called by the pipeline once it sees a
+// frame's sample rate, and again whenever the parameters change
+// mid-stream; like SetVideoInfo, a change bumps the catalog.
+func (r *Relay) SetAudioInfo(track int, info AudioInfo) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	if !r.audioInfoSet {
-		r.audioInfo = info
-		r.audioInfoSet = true
+	prev, ok := r.audioInfo[track]
+	if ok && prev.Equal(info) {
+		return
+	}
+	if ok {
+		r.log.Info("audio parameters changed",
+			"track", track,
+			"sampleRate", info.SampleRate,
+			"channels", info.Channels,
+			"previousSampleRate", prev.SampleRate,
+			"previousChannels", prev.Channels)
+	} else {
 		r.log.Debug("audio info set",
+			"track", track,
 			"codec", info.Codec,
 			"sampleRate", info.SampleRate,
 			"channels", info.Channels)
 	}
+	r.audioInfo[track] = info
+	r.bumpCatalogLocked()
 }
 
-// AudioInfo returns the detected audio codec parameters, or sensible
-// defaults if no audio frame has been seen yet.
-func (r *Relay) AudioInfo() AudioInfo {
+// AudioInfo returns the detected codec parameters of audio track track,
+// or sensible defaults if no frame of it has been seen yet.
+func (r *Relay) AudioInfo(track int) AudioInfo {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
-	if r.audioInfoSet {
-		return r.audioInfo
+	if info, ok := r.audioInfo[track]; ok {
+		return info
 	}
 	return AudioInfo{Codec: "mp4a.40.02", SampleRate: 48000, Channels: 2}
 }
@@ -142,25 +353,65 @@ func (r *Relay) AudioInfo() AudioInfo {
 // AddViewer replays the cached GOP to the viewer, then registers it for
 // live frame delivery. Replay happens before registration so that
 // BroadcastVideo cannot interleave live frames before the replay completes.
-func (r *Relay) AddViewer(session Viewer) {
+// It reports false, leaving the viewer unregistered, if the relay is
+// closed.
+func (r *Relay) AddViewer(session Viewer) bool {
+	select {
+	case <-r.done:
+		return false
+	default:
+	}
 	r.replayGOP(session)
 
 	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return false
+	}
 	r.sessions[session.ID()] = session
+	r.publishViewersLocked()
 	r.mu.Unlock()
 
 	r.log.Info("viewer added", "session", session.ID(), "viewers", r.ViewerCount())
+	return true
 }
 
-// RemoveViewer unregisters a viewer by ID.
+// RemoveViewer unregisters a viewer by ID. A broadcast already under way
+// may still deliver its frame to the viewer.
 func (r *Relay) RemoveViewer(id string) {
 	r.mu.Lock()
+	_, ok := r.sessions[id]
 	delete(r.sessions, id)
+	if ok {
+		r.publishViewersLocked()
+	}
+	if ok && r.closed && len(r.sessions) == 0 {
+		close(r.detached)
+	}
 	r.mu.Unlock()
 
 	r.log.Info("viewer removed", "session", id, "viewers", r.ViewerCount())
 }
 
+// publishViewersLocked replaces the viewer snapshot with a fresh copy of
+// sessions. Callers hold r.mu.
+func (r *Relay) publishViewersLocked() {
+	viewers := make([]Viewer, 0, len(r.sessions))
+	for _, v := range r.sessions {
+		viewers = append(viewers, v)
+	}
+	r.viewers.Store(&viewers)
+}
+
+// viewerSnapshot returns the viewers registered as of the last add or
+// remove. The slice is shared and must not be modified.
+func (r *Relay) viewerSnapshot() []Viewer {
+	if p := r.viewers.Load(); p != nil {
+		return *p
+	}
+	return nil
+}
+
 // VideoInfo returns the detected video codec and resolution, or sensible
 // defaults if the first keyframe hasn't arrived yet.
 func (r *Relay) VideoInfo() VideoInfo {
@@ -172,19 +423,23 @@ func (r *Relay) VideoInfo() VideoInfo {
 	return VideoInfo{Codec: "avc1.42E01E", Width: 1920, Height: 1080}
 }
 
-// WaitVideoInfo blocks until the real video codec info is available, or until
-// ctx is cancelled. Returns true if info is ready.
+// WaitVideoInfo blocks until the real video codec info is available, the
+// stream is known to be audio-only, or ctx is cancelled. Returns true if
+// video info is ready.
 func (r *Relay) WaitVideoInfo(ctx context.Context) bool {
 	r.mu.RLock()
-	if r.videoInfoSet {
+	if r.videoInfoSet || r.noVideo {
+		set := r.videoInfoSet
 		r.mu.RUnlock()
-		return true
+		return set
 	}
 	r.mu.RUnlock()
 
 	select {
 	case <-r.videoInfoReady:
-		return true
+		r.mu.RLock()
+		defer r.mu.RUnlock()
+		return r.videoInfoSet
 	case <-ctx.Done():
 		return false
 	}
@@ -192,25 +447,169 @@ func (r *Relay) WaitVideoInfo(ctx context.Context) bool {
 
 // BroadcastVideo sends a video frame to all connected viewers and updates
 // the GOP cache. Codec detection is handled by the pipeline via SetVideoInfo.
+// The relay takes ownership of frame, which must be broadcast only once.
 func (r *Relay) BroadcastVideo(frame *media.VideoFrame) {
-	// Pre-compute AVC1 (length-prefixed) wire data once so all viewers share the same bytes.
+	// Pre-compute AVC1 (length-prefixed) wire data once so all viewers
+	// share the same bytes. The pooled buffer's first reference belongs to
+	// the GOP cache and is released when the next keyframe evicts the
+	// frame, or after fan-out when the GOP is too long to cache; viewers
+	// that queue it take their own.
 	if frame.WireData == nil {
-		frame.WireData = moq.AnnexBToAVC1(frame.NALUs)
+		buf := media.NewFrameBuffer(moq.AVC1Size(frame.NALUs))
+		frame.WireData = moq.AppendAVC1(buf.Bytes()[:0], frame.NALUs)
+		frame.WireBuffer = buf
+	}
+
+	if c := r.clock.Load(); c != nil {
+		c.observeVideo(frame)
 	}
 
 	r.gopMu.Lock()
+	r.paramSets.fill(frame)
 	if frame.IsKeyframe {
-		r.gopCache = r.gopCache[:0]
+		r.resetGOPCacheLocked()
+		r.gopOverflow = false
+	}
+	if r.gopLimit > 0 && len(r.gopCache) >= r.gopLimit && !r.gopOverflow {
+		r.log.Warn("GOP exceeds cache limit, not caching it", "frames", len(r.gopCache), "limit", r.gopLimit)
+		r.resetGOPCacheLocked()
+		r.gopOverflow = true
+	}
+	cached := !r.gopOverflow
+	if cached {
+		r.gopCache = append(r.gopCache, frame)
+	}
+	if r.dvr != nil {
+		r.dvr.add(frame)
 	}
-	r.gopCache = append(r.gopCache, frame)
 	r.gopMu.Unlock()
 
-	r.mu.RLock()
-	defer r.mu.RUnlock()
-
-	for _, session := range r.sessions {
+	for _, session := range r.viewerSnapshot() {
 		session.SendVideo(frame)
 	}
+	if !cached {
+		frame.Release()
+	}
+}
+
+// resetGOPCacheLocked releases and empties the GOP cache. Callers hold
+// gopMu.
+func (r *Relay) resetGOPCacheLocked() {
+	media.ReleaseVideo(r.gopCache)
+	clear(r.gopCache)
+	r.gopCache = r.gopCache[:0]
+}
+
+// SetGOPCacheLimit caps the frames the GOP cache holds for late-joining
+// viewers. A GOP that grows past frames, from an encoder sending
+// keyframes rarely or never, is dropped from the cache and no longer
+// cached, so viewers joining during it wait for the next keyframe. Zero
+// or less is unlimited.
+func (r *Relay) SetGOPCacheLimit(frames int) {
+	r.gopMu.Lock()
+	defer r.gopMu.Unlock()
+	r.gopLimit = max(frames, 0)
+}
+
+// SetDVRWindow enables a memory-backed time-shift buffer holding roughly
+// the last window of video, letting subscribers seek to older groups with
+// an absolute subscribe filter. A window <= 0 disables the buffer and
+// discards anything cached. Only video is retained.
+func (r *Relay) SetDVRWindow(window time.Duration) {
+	r.gopMu.Lock()
+	defer r.gopMu.Unlock()
+	if window <= 0 {
+		if r.dvr != nil {
+			r.dvr.reset()
+		}
+		r.dvr = nil
+		return
+	}
+	if r.dvr == nil {
+		r.dvr = newDVRBuffer(window, dvrMaxBytes)
+		return
+	}
+	r.dvr.window = window
+}
+
+// SetTimestampMode sets the clock of the capture timestamps viewers
+// receive. Viewers already subscribed keep the mode they started with.
+func (r *Relay) SetTimestampMode(mode TimestampMode) {
+	if mode == TimestampWallClock {
+		r.clock.CompareAndSwap(nil, &wallClock{})
+		return
+	}
+	r.clock.Store(nil)
+}
+
+// wallClock returns the relay's PTS to wall-clock mapping, or nil in the
+// media clock mode.
+func (r *Relay) wallClock() *wallClock {
+	return r.clock.Load()
+}
+
+// HasDVR reports whether the time-shift buffer is enabled.
+func (r *Relay) HasDVR() bool {
+	r.gopMu.RLock()
+	defer r.gopMu.RUnlock()
+	return r.dvr != nil
+}
+
+// DVRWindow returns the oldest and newest video group IDs available for
+// seeking. Both are zero when the buffer is disabled or empty.
+func (r *Relay) DVRWindow() (oldestGroup, newestGroup uint64) {
+	r.gopMu.RLock()
+	defer r.gopMu.RUnlock()
+	if r.dvr == nil {
+		return 0, 0
+	}
+	oldest, newest, _ := r.dvr.bounds()
+	return uint64(oldest), uint64(newest)
+}
+
+// DVRFrames returns the cached video frames for groups startGroup through
+// endGroup inclusive, in delivery order, each retained for the caller to
+// release once written. ok is false if the buffer is disabled or
+// startGroup is not within the current window.
+func (r *Relay) DVRFrames(startGroup, endGroup uint64) (frames []*media.VideoFrame, ok bool) {
+	r.gopMu.RLock()
+	defer r.gopMu.RUnlock()
+	return r.dvrFramesLocked(startGroup, endGroup)
+}
+
+// JoinDVR is DVRFrames for a subscriber that continues with live frames:
+// if the frames are available, it calls register, which should make the
+// subscriber visible to live fan-out, while still holding the GOP lock,
+// so the DVR frames and live delivery meet without a gap as in
+// JoinVideo.
+func (r *Relay) JoinDVR(startGroup, endGroup uint64, register func()) (frames []*media.VideoFrame, ok bool) {
+	r.gopMu.RLock()
+	defer r.gopMu.RUnlock()
+	frames, ok = r.dvrFramesLocked(startGroup, endGroup)
+	if ok {
+		register()
+	}
+	return frames, ok
+}
+
+// dvrFramesLocked implements DVRFrames. Callers hold gopMu.
+func (r *Relay) dvrFramesLocked(startGroup, endGroup uint64) (frames []*media.VideoFrame, ok bool) {
+	if r.dvr == nil {
+		return nil, false
+	}
+	oldest, newest, has := r.dvr.bounds()
+	if !has || startGroup < uint64(oldest) || startGroup > uint64(newest) {
+		return nil, false
+	}
+	end := uint32(math.MaxUint32)
+	if endGroup < math.MaxUint32 {
+		end = uint32(endGroup)
+	}
+	frames = r.dvr.frames(uint32(startGroup), end)
+	for _, f := range frames {
+		f.Retain()
+	}
+	return frames, true
 }
 
 func (r *Relay) replayGOP(session Viewer) {
@@ -218,34 +617,87 @@ func (r *Relay) replayGOP(session Viewer) {
 	defer r.gopMu.RUnlock()
 
 	for _, frame := range r.gopCache {
-		session.SendVideo(frame)
+		session.SendVideo(r.paramSets.configured(frame))
 	}
 }
 
-// ReplayFullGOPToChannel sends the entire cached GOP (keyframe + all delta
-// frames) into a channel, bypassing the Viewer interface. The client-side
-// renderer skips to the latest decoded frame, so replaying the full GOP
-// provides immediate decodable content at the live edge. Returns the
-// number of frames replayed.
-func (r *Relay) ReplayFullGOPToChannel(ch chan<- *media.VideoFrame) int {
+// JoinVideo snapshots the cached GOP and calls register, which should make
+// a subscriber visible to live fan-out, while holding the GOP lock. Every
+// frame is therefore either in the snapshot or delivered live, so a
+// subscriber that writes the snapshot before its live frames sees no gap.
+// A frame cached just before the snapshot may also arrive live; callers
+// skip those by group and DTS. The snapshot frames are retained for the
+// caller to release once written.
+func (r *Relay) JoinVideo(register func()) []*media.VideoFrame {
 	r.gopMu.RLock()
 	defer r.gopMu.RUnlock()
 
-	replayed := 0
-	for _, frame := range r.gopCache {
-		select {
-		case ch <- frame:
-			replayed++
-		default:
-			return replayed
-		}
+	snapshot := slices.Clone(r.gopCache)
+	for i, f := range snapshot {
+		snapshot[i] = r.paramSets.configured(f)
+		f.Retain()
 	}
-	return replayed
+	register()
+	return snapshot
+}
+
+// LargestVideo returns the location of the newest cached video object,
+// counting objects as mode sends them: the live edge a new subscription
+// reports in SUBSCRIBE_OK. ok is false while nothing is cached.
+func (r *Relay) LargestVideo(mode VideoObjectMode) (group, object uint64, ok bool) {
+	r.gopMu.RLock()
+	defer r.gopMu.RUnlock()
+
+	if len(r.gopCache) == 0 {
+		return 0, 0, false
+	}
+	var objects uint64
+	for _, f := range r.gopCache {
+		objects += videoObjectCount(f, mode)
+	}
+	return uint64(r.gopCache[0].GroupID), objects - 1, true
+}
+
+// videoParamSets tracks the latest SPS, PPS and, for H.265, VPS seen on
+// the video track. Some sources send them once at the start rather than
+// with every IDR, so a keyframe can reach the relay without them: after a
+// source reconnect, say, or when the cached keyframe predates them.
+type videoParamSets struct {
+	sps, pps, vps []byte
+}
+
+// fill records the parameter sets frame carries or, if it is a keyframe
+// without them, sets the latest known ones on it. It must be called
+// before frame is shared.
+func (p *videoParamSets) fill(frame *media.VideoFrame) {
+	if frame.SPS != nil && frame.PPS != nil {
+		p.sps, p.pps, p.vps = frame.SPS, frame.PPS, frame.VPS
+		return
+	}
+	if frame.IsKeyframe && p.sps != nil {
+		frame.SPS, frame.PPS, frame.VPS = p.sps, p.pps, p.vps
+	}
+}
+
+// configured returns frame, or for a keyframe without parameter sets a
+// copy carrying the latest known ones, so a late joiner's first keyframe
+// can always configure its decoder. The copy shares frame's wire buffer.
+func (p *videoParamSets) configured(frame *media.VideoFrame) *media.VideoFrame {
+	if !frame.IsKeyframe || frame.SPS != nil && frame.PPS != nil || p.sps == nil {
+		return frame
+	}
+	c := *frame
+	c.SPS, c.PPS, c.VPS = p.sps, p.pps, p.vps
+	return &c
 }
 
 // BroadcastAudio sends an audio frame to all connected viewers and updates
 // the per-track audio cache for late-joining subscriber replay.
 func (r *Relay) BroadcastAudio(frame *media.AudioFrame) {
+	if c := r.clock.Load(); c != nil {
+		c.observeAudio(frame)
+	}
+
 	r.audioMu.Lock()
 	cache := r.audioCache[frame.TrackIndex]
 	if len(cache) >= audioCacheSize {
@@ -257,10 +709,7 @@ func (r *Relay) BroadcastAudio(frame *media.AudioFrame) {
 	r.audioCache[frame.TrackIndex] = cache
 	r.audioMu.Unlock()
 
-	r.mu.RLock()
-	defer r.mu.RUnlock()
-
-	for _, session := range r.sessions {
+	for _, session := range r.viewerSnapshot() {
 		session.SendAudio(frame)
 	}
 }
@@ -287,29 +736,91 @@ func (r *Relay) ReplayAudioToChannel(trackIndex int, ch chan<- *media.AudioFrame
 }
 
 // BroadcastCaptions sends a caption frame to all connected viewers.
-func (r *Relay) BroadcastCaptions(frame *ccx.CaptionFrame) {
-	r.mu.RLock()
-	defer r.mu.RUnlock()
-
-	for _, session := range r.sessions {
+func (r *Relay) BroadcastCaptions(frame *media.CaptionFrame) {
+	for _, session := range r.viewerSnapshot() {
 		session.SendCaptions(frame)
 	}
 }
 
-// ViewerCount returns the number of currently connected viewers.
-func (r *Relay) ViewerCount() int {
+// BroadcastSCTE35 sends a SCTE-35 event to all connected viewers and marks
+// the stream as carrying SCTE-35 so the catalog advertises the track.
+func (r *Relay) BroadcastSCTE35(event *demux.SCTE35Event) {
+	r.mu.Lock()
+	if !r.hasSCTE35 {
+		r.hasSCTE35 = true
+		r.bumpCatalogLocked()
+	}
+	r.mu.Unlock()
+
+	for _, session := range r.viewerSnapshot() {
+		session.SendSCTE35(event)
+	}
+}
+
+// HasSCTE35 reports whether any SCTE-35 event has been broadcast.
+func (r *Relay) HasSCTE35() bool {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
-	return len(r.sessions)
+	return r.hasSCTE35
+}
+
+// ViewerCount returns the number of currently connected viewers.
+func (r *Relay) ViewerCount() int {
+	return len(r.viewerSnapshot())
 }
 
 // ViewerStatsAll returns delivery metrics for every connected viewer.
 func (r *Relay) ViewerStatsAll() []ViewerStats {
-	r.mu.RLock()
-	defer r.mu.RUnlock()
-	stats := make([]ViewerStats, 0, len(r.sessions))
-	for _, s := range r.sessions {
+	viewers := r.viewerSnapshot()
+	stats := make([]ViewerStats, 0, len(viewers))
+	for _, s := range viewers {
 		stats = append(stats, s.Stats())
 	}
 	return stats
 }
+
+// Snapshot returns relay-wide delivery totals across all connected viewers,
+// the state of the GOP cache and how far the slowest viewer trails the live
+// group.
+func (r *Relay) Snapshot() RelaySnapshot {
+	var snap RelaySnapshot
+	for _, v := range r.ViewerStatsAll() {
+		snap.ViewerCount++
+		if v.LastVideoGroup != 0 && (snap.OldestViewerGroup == 0 || v.LastVideoGroup < snap.OldestViewerGroup) {
+			snap.OldestViewerGroup = v.LastVideoGroup
+		}
+		snap.VideoSent += v.VideoSent
+		snap.AudioSent += v.AudioSent
+		snap.VideoDropped += v.VideoDropped
+		snap.AudioDropped += v.AudioDropped
+	}
+	dropped := snap.VideoDropped + snap.AudioDropped
+	if total := snap.VideoSent + snap.AudioSent + dropped; total > 0 {
+		snap.DropRate = float64(dropped) / float64(total)
+	}
+
+	r.gopMu.RLock()
+	defer r.gopMu.RUnlock()
+	if r.dvr != nil {
+		snap.CachedGroups = len(r.dvr.groups)
+	}
+	if len(r.gopCache) == 0 {
+		return snap
+	}
+	if r.dvr == nil {
+		snap.CachedGroups = 1
+	}
+	snap.LiveGroupID = r.gopCache[len(r.gopCache)-1].GroupID
+	first := r.gopCache[0]
+	lastPTS := first.PTS
+	snap.GOP.GroupID = first.GroupID
+	snap.GOP.Frames = len(r.gopCache)
+	for _, frame := range r.gopCache {
+		for _, nalu := range frame.NALUs {
+			snap.GOP.Bytes += int64(len(nalu))
+		}
+		lastPTS = max(lastPTS, frame.PTS)
+	}
+	snap.GOP.DurationMs = (lastPTS - first.PTS) / 1000
+	return snap
+}
@@ -0,0 +1,64 @@
+package distribution
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/zsiec/prism/demux"
+	"github.com/zsiec/prism/media"
+)
+
+// nopViewer discards everything sent to it.
+type nopViewer struct{ id string }
+
+func (v nopViewer) ID() string                     { return v.id }
+func (nopViewer) SendVideo(*media.VideoFrame)      {}
+func (nopViewer) SendAudio(*media.AudioFrame)      {}
+func (nopViewer) SendCaptions(*media.CaptionFrame) {}
+func (nopViewer) SendSCTE35(*demux.SCTE35Event)    {}
+func (v nopViewer) Stats() ViewerStats             { return ViewerStats{ID: v.id} }
+
+// BenchmarkRelayFanOut measures audio fan-out to many viewers, alone and
+// while other goroutines add and remove viewers and poll their stats as
+// the stats API does. Fan-out takes no lock those share, so churn should
+// barely slow it.
+func BenchmarkRelayFanOut(b *testing.B) {
+	for _, viewers := range []int{10, 1000} {
+		for _, churn := range []bool{false, true} {
+			b.Run(fmt.Sprintf("viewers=%d/churn=%v", viewers, churn), func(b *testing.B) {
+				r := NewRelay()
+				for i := range viewers {
+					r.AddViewer(nopViewer{fmt.Sprintf("v%d", i)})
+				}
+
+				ctx, cancel := context.WithCancel(context.Background())
+				var wg sync.WaitGroup
+				if churn {
+					for i := range 4 {
+						wg.Add(1)
+						go func() {
+							defer wg.Done()
+							v := nopViewer{fmt.Sprintf("churn%d", i)}
+							for ctx.Err() == nil {
+								r.AddViewer(v)
+								r.ViewerStatsAll()
+								r.RemoveViewer(v.id)
+							}
+						}()
+					}
+				}
+
+				frame := &media.AudioFrame{Data: make([]byte, 300)}
+				b.ResetTimer()
+				for b.Loop() {
+					r.BroadcastAudio(frame)
+				}
+				b.StopTimer()
+				cancel()
+				wg.Wait()
+			})
+		}
+	}
+}
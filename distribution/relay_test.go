@@ -1,12 +1,16 @@
 package distribution
 
 import (
+	"bytes"
 	"context"
+	"fmt"
+	"math"
 	"sync"
 	"sync/atomic"
 	"testing"
+	"time"
 
-	"github.com/zsiec/ccx"
+	"github.com/zsiec/prism/demux"
 	"github.com/zsiec/prism/media"
 )
 
@@ -16,7 +20,8 @@ type mockViewer struct {
 	mu       sync.Mutex
 	videos   []*media.VideoFrame
 	audios   []*media.AudioFrame
-	captions []*ccx.CaptionFrame
+	captions []*media.CaptionFrame
+	scte35   []*demux.SCTE35Event
 
 	videoSent      atomic.Int64
 	audioSent      atomic.Int64
@@ -46,14 +51,26 @@ func (m *mockViewer) SendAudio(frame *media.AudioFrame) {
 	m.audioSent.Add(1)
 }
 
-func (m *mockViewer) SendCaptions(frame *ccx.CaptionFrame) {
+func (m *mockViewer) SendCaptions(frame *media.CaptionFrame) {
 	m.mu.Lock()
 	m.captions = append(m.captions, frame)
 	m.mu.Unlock()
 	m.captionSent.Add(1)
 }
 
+func (m *mockViewer) SendSCTE35(event *demux.SCTE35Event) {
+	m.mu.Lock()
+	m.scte35 = append(m.scte35, event)
+	m.mu.Unlock()
+}
+
 func (m *mockViewer) Stats() ViewerStats {
+	m.mu.Lock()
+	var lastGroup uint32
+	if n := len(m.videos); n > 0 {
+		lastGroup = m.videos[n-1].GroupID
+	}
+	m.mu.Unlock()
 	return ViewerStats{
 		ID:             m.id,
 		VideoSent:      m.videoSent.Load(),
@@ -62,6 +79,7 @@ func (m *mockViewer) Stats() ViewerStats {
 		VideoDropped:   m.videoDropped.Load(),
 		AudioDropped:   m.audioDropped.Load(),
 		CaptionDropped: m.captionDropped.Load(),
+		LastVideoGroup: lastGroup,
 	}
 }
 
@@ -88,6 +106,117 @@ func TestRelayAddRemoveViewer(t *testing.T) {
 	}
 }
 
+func TestRelayClose(t *testing.T) {
+	t.Parallel()
+
+	r := NewRelay()
+	if !r.AddViewer(newMockViewer("v1")) {
+		t.Fatal("AddViewer on an open relay = false")
+	}
+
+	r.Close()
+	r.Close() // idempotent
+	select {
+	case <-r.Done():
+	default:
+		t.Fatal("Done not closed after Close")
+	}
+	if r.AddViewer(newMockViewer("v2")) {
+		t.Error("AddViewer on a closed relay = true")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if r.WaitDetached(ctx) {
+		t.Error("WaitDetached = true with a viewer still attached")
+	}
+
+	r.RemoveViewer("v1")
+	if !r.WaitDetached(context.Background()) {
+		t.Error("WaitDetached = false after the last viewer left")
+	}
+}
+
+func TestRelayCloseConcurrentViewers(t *testing.T) {
+	t.Parallel()
+
+	r := NewRelay()
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v := newMockViewer(fmt.Sprintf("v%d", i))
+			if !r.AddViewer(v) {
+				return
+			}
+			for {
+				select {
+				case <-r.Done():
+					r.RemoveViewer(v.ID())
+					return
+				default:
+					r.BroadcastVideo(&media.VideoFrame{PTS: int64(i), IsKeyframe: true})
+				}
+			}
+		}()
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	r.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if !r.WaitDetached(ctx) {
+		t.Fatalf("viewers still attached after Close: %d", r.ViewerCount())
+	}
+	wg.Wait()
+}
+
+func TestRelayViewerChurnDuringBroadcast(t *testing.T) {
+	t.Parallel()
+
+	r := NewRelay()
+	stable := newMockViewer("stable")
+	r.AddViewer(stable)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	for i := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := 0; ctx.Err() == nil; n++ {
+				v := newMockViewer(fmt.Sprintf("churn%d-%d", i, n))
+				r.AddViewer(v)
+				r.ViewerStatsAll()
+				r.RemoveViewer(v.ID())
+			}
+		}()
+	}
+
+	const frames = 500
+	for i := range frames {
+		r.BroadcastVideo(&media.VideoFrame{PTS: int64(i), GroupID: uint32(i / 10), IsKeyframe: i%10 == 0})
+		r.BroadcastAudio(&media.AudioFrame{PTS: int64(i)})
+		r.BroadcastCaptions(&media.CaptionFrame{PTS: int64(i)})
+	}
+	cancel()
+	wg.Wait()
+
+	if got := stable.videoSent.Load(); got != frames {
+		t.Errorf("stable viewer got %d video frames, want %d", got, frames)
+	}
+	if got := stable.audioSent.Load(); got != frames {
+		t.Errorf("stable viewer got %d audio frames, want %d", got, frames)
+	}
+	if got := stable.captionSent.Load(); got != frames {
+		t.Errorf("stable viewer got %d captions, want %d", got, frames)
+	}
+	if got := r.ViewerCount(); got != 1 {
+		t.Errorf("ViewerCount = %d after churn, want 1", got)
+	}
+}
+
 func TestRelayBroadcastVideo(t *testing.T) {
 	t.Parallel()
 
@@ -136,7 +265,7 @@ func TestRelayBroadcastCaptions(t *testing.T) {
 	v := newMockViewer("v1")
 	r.AddViewer(v)
 
-	frame := &ccx.CaptionFrame{PTS: 1000}
+	frame := &media.CaptionFrame{PTS: 1000}
 	r.BroadcastCaptions(frame)
 
 	if v.captionSent.Load() != 1 {
@@ -144,6 +273,30 @@ func TestRelayBroadcastCaptions(t *testing.T) {
 	}
 }
 
+func TestRelayBroadcastSCTE35(t *testing.T) {
+	t.Parallel()
+
+	r := NewRelay()
+	v := newMockViewer("v1")
+	r.AddViewer(v)
+
+	if r.HasSCTE35() {
+		t.Fatal("HasSCTE35 should be false before any event")
+	}
+
+	r.BroadcastSCTE35(&demux.SCTE35Event{PTS: 900000, CommandType: "time_signal"})
+
+	if !r.HasSCTE35() {
+		t.Error("HasSCTE35 should be true after an event")
+	}
+	v.mu.Lock()
+	n := len(v.scte35)
+	v.mu.Unlock()
+	if n != 1 {
+		t.Errorf("scte35 sent: got %d, want 1", n)
+	}
+}
+
 func TestRelayGOPReplayOrdering(t *testing.T) {
 	t.Parallel()
 
@@ -188,6 +341,55 @@ func TestRelayGOPReplayOrdering(t *testing.T) {
 	v.mu.Unlock()
 }
 
+func TestRelayGOPReplayOutOfBandParamSets(t *testing.T) {
+	t.Parallel()
+
+	sps, pps := []byte{0x67, 0x42, 0x00, 0x1f}, []byte{0x68, 0xce, 0x3c, 0x80}
+	idr := func(group uint32) *media.VideoFrame {
+		return &media.VideoFrame{PTS: int64(group) * 1000, IsKeyframe: true, GroupID: group, NALUs: [][]byte{{0x65, 0x00}}}
+	}
+
+	tests := []struct {
+		name   string
+		frames func() []*media.VideoFrame
+	}{
+		{"sent once at the start", func() []*media.VideoFrame {
+			first := idr(1)
+			first.SPS, first.PPS = sps, pps
+			return []*media.VideoFrame{first, idr(2)}
+		}},
+		{"learned after the cached keyframe", func() []*media.VideoFrame {
+			delta := &media.VideoFrame{PTS: 1500, GroupID: 1, NALUs: [][]byte{{0x41, 0x01}}, SPS: sps, PPS: pps}
+			return []*media.VideoFrame{idr(1), delta}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			r := NewRelay()
+			for _, f := range tt.frames() {
+				r.BroadcastVideo(f)
+			}
+
+			v := newMockViewer("late")
+			r.AddViewer(v)
+			v.mu.Lock()
+			first := v.videos[0]
+			v.mu.Unlock()
+			if !first.IsKeyframe || !bytes.Equal(first.SPS, sps) || !bytes.Equal(first.PPS, pps) {
+				t.Errorf("replayed keyframe: keyframe %v, SPS %x, PPS %x; want the out-of-band config", first.IsKeyframe, first.SPS, first.PPS)
+			}
+
+			snapshot := r.JoinVideo(func() {})
+			defer media.ReleaseVideo(snapshot)
+			if !bytes.Equal(snapshot[0].SPS, sps) || !bytes.Equal(snapshot[0].PPS, pps) {
+				t.Errorf("joined keyframe: SPS %x, PPS %x; want the out-of-band config", snapshot[0].SPS, snapshot[0].PPS)
+			}
+		})
+	}
+}
+
 func TestRelayGOPResetOnKeyframe(t *testing.T) {
 	t.Parallel()
 
@@ -218,6 +420,80 @@ func TestRelayGOPResetOnKeyframe(t *testing.T) {
 	}
 }
 
+func TestRelayGOPCacheLimit(t *testing.T) {
+	t.Parallel()
+
+	frame := func(pts int64, key bool, group uint32) *media.VideoFrame {
+		return &media.VideoFrame{PTS: pts, IsKeyframe: key, GroupID: group, NALUs: [][]byte{{0x41}}}
+	}
+
+	r := NewRelay()
+	r.SetGOPCacheLimit(3)
+	live := newMockViewer("live")
+	r.AddViewer(live)
+
+	r.BroadcastVideo(frame(1000, true, 1))
+	for i := range int64(5) {
+		r.BroadcastVideo(frame(2000+i*1000, false, 1))
+	}
+	if got := live.videoCount(); got != 6 {
+		t.Errorf("live viewer got %d frames, want 6", got)
+	}
+
+	// The GOP outgrew the cache, so a viewer joining during it waits for
+	// the next keyframe.
+	late := newMockViewer("late")
+	r.AddViewer(late)
+	if got := late.videoCount(); got != 0 {
+		t.Errorf("viewer joining a GOP past the limit got %d frames, want 0", got)
+	}
+
+	// The next keyframe is cached again.
+	r.BroadcastVideo(frame(8000, true, 2))
+	r.BroadcastVideo(frame(9000, false, 2))
+	later := newMockViewer("later")
+	r.AddViewer(later)
+	if got := later.videoCount(); got != 2 {
+		t.Errorf("viewer joining a GOP within the limit got %d frames, want 2", got)
+	}
+}
+
+func TestRelayAudioOnlyReleasesWaiters(t *testing.T) {
+	t.Parallel()
+
+	r := NewRelay()
+	if !r.HasVideo() {
+		t.Fatal("HasVideo should default to true before the PMT is known")
+	}
+
+	done := make(chan bool, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		done <- r.WaitVideoInfo(ctx)
+	}()
+
+	r.SetHasVideo(false)
+
+	select {
+	case ready := <-done:
+		if ready {
+			t.Error("WaitVideoInfo reported video info ready for an audio-only stream")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("SetHasVideo(false) did not release WaitVideoInfo")
+	}
+	if r.HasVideo() {
+		t.Error("HasVideo should be false after SetHasVideo(false)")
+	}
+
+	// Video appearing later (e.g. a PMT update) must not double-close.
+	r.SetVideoInfo(VideoInfo{Codec: "avc1.64001f", Width: 1280, Height: 720})
+	if !r.HasVideo() {
+		t.Error("HasVideo should be true once video info arrives")
+	}
+}
+
 func TestRelayWaitVideoInfo(t *testing.T) {
 	t.Parallel()
 
@@ -322,15 +598,20 @@ func TestRelayAudioInfo(t *testing.T) {
 	r := NewRelay()
 
 	// Default
-	ai := r.AudioInfo()
+	ai := r.AudioInfo(0)
 	if ai.Codec != "mp4a.40.02" {
 		t.Errorf("default codec: got %q, want mp4a.40.02", ai.Codec)
 	}
 
-	r.SetAudioInfo(AudioInfo{Codec: "mp4a.40.02", SampleRate: 44100, Channels: 1})
-	ai = r.AudioInfo()
+	r.SetAudioInfo(0, AudioInfo{Codec: "mp4a.40.02", SampleRate: 44100, Channels: 1})
+	r.SetAudioInfo(1, AudioInfo{Codec: "ac-3", SampleRate: 48000, Channels: 6})
+	ai = r.AudioInfo(0)
 	if ai.SampleRate != 44100 || ai.Channels != 1 {
-		t.Errorf("AudioInfo: got %d/%d, want 44100/1", ai.SampleRate, ai.Channels)
+		t.Errorf("AudioInfo(0): got %d/%d, want 44100/1", ai.SampleRate, ai.Channels)
+	}
+	ai = r.AudioInfo(1)
+	if ai.Codec != "ac-3" || ai.Channels != 6 {
+		t.Errorf("AudioInfo(1): got %s/%d, want ac-3/6", ai.Codec, ai.Channels)
 	}
 }
 
@@ -440,3 +721,189 @@ func TestRelayAudioCacheMultiTrack(t *testing.T) {
 		t.Errorf("track 2 replay: got %d frames, want 0", n2)
 	}
 }
+
+func TestRelayJoinSnapshotOutlivesGOP(t *testing.T) {
+	t.Parallel()
+
+	keyframe := func(group uint32, fill byte) *media.VideoFrame {
+		return &media.VideoFrame{
+			PTS: int64(group) * 1_000_000, IsKeyframe: true, GroupID: group,
+			NALUs: [][]byte{append([]byte{0, 0, 0, 1}, bytes.Repeat([]byte{fill}, 2000)...)},
+		}
+	}
+
+	r := NewRelay()
+	r.BroadcastVideo(keyframe(1, 0xAA))
+	snapshot := r.JoinVideo(func() {})
+	if len(snapshot) != 1 {
+		t.Fatalf("snapshot = %d frames, want 1", len(snapshot))
+	}
+	want := bytes.Clone(snapshot[0].WireData)
+
+	// Later GOPs evict the frame from the cache and recycle their own
+	// buffers; the snapshot's reference keeps its bytes intact.
+	for g := uint32(2); g <= 50; g++ {
+		r.BroadcastVideo(keyframe(g, 0x55))
+	}
+	if !bytes.Equal(snapshot[0].WireData, want) {
+		t.Fatal("snapshot wire data was overwritten while still retained")
+	}
+	media.ReleaseVideo(snapshot)
+}
+
+// stalledViewer is a viewer whose delivery stopped: it keeps reporting
+// the frames it already has but takes no more.
+type stalledViewer struct{ *mockViewer }
+
+func (stalledViewer) SendVideo(*media.VideoFrame) {}
+
+func TestRelaySnapshotGroups(t *testing.T) {
+	t.Parallel()
+
+	frame := func(group uint32, key bool) *media.VideoFrame {
+		return &media.VideoFrame{
+			PTS: int64(group) * 1_000_000, IsKeyframe: key, GroupID: group,
+			NALUs: [][]byte{{0, 0, 0, 1, 0x65}},
+		}
+	}
+
+	r := NewRelay()
+	if snap := r.Snapshot(); snap.LiveGroupID != 0 || snap.CachedGroups != 0 || snap.OldestViewerGroup != 0 {
+		t.Fatalf("empty relay snapshot = %+v, want zero groups", snap)
+	}
+
+	r.AddViewer(newMockViewer("live"))
+	r.AddViewer(stalledViewer{newMockViewer("idle")})
+	r.BroadcastVideo(frame(2, true))
+	r.BroadcastVideo(frame(2, false))
+
+	snap := r.Snapshot()
+	if snap.LiveGroupID != 2 || snap.GOP.GroupID != 2 || snap.CachedGroups != 1 {
+		t.Errorf("snapshot = %+v, want live group 2 with one cached GOP", snap)
+	}
+	if snap.OldestViewerGroup != 2 {
+		t.Errorf("OldestViewerGroup = %d, want 2, ignoring the viewer with no video", snap.OldestViewerGroup)
+	}
+
+	behind := newMockViewer("behind")
+	behind.SendVideo(frame(1, true))
+	r.AddViewer(stalledViewer{behind})
+	if got := r.Snapshot().OldestViewerGroup; got != 1 {
+		t.Errorf("OldestViewerGroup = %d, want the stalled viewer's 1", got)
+	}
+
+	r.SetDVRWindow(time.Minute)
+	r.BroadcastVideo(frame(3, true))
+	r.BroadcastVideo(frame(4, true))
+	if snap := r.Snapshot(); snap.CachedGroups != 2 || snap.LiveGroupID != 4 {
+		t.Errorf("DVR snapshot = %+v, want live group 4 with two cached groups", snap)
+	}
+}
+
+func TestRelayDVRSeek(t *testing.T) {
+	t.Parallel()
+	r := NewRelay()
+
+	if r.HasDVR() {
+		t.Fatal("DVR should be disabled by default")
+	}
+	if _, ok := r.DVRFrames(0, 0); ok {
+		t.Fatal("DVRFrames should fail when DVR is disabled")
+	}
+
+	r.SetDVRWindow(time.Minute)
+	for g := uint32(1); g <= 4; g++ {
+		base := int64(g) * 1_000_000
+		r.BroadcastVideo(&media.VideoFrame{PTS: base, DTS: base, IsKeyframe: true, GroupID: g})
+		r.BroadcastVideo(&media.VideoFrame{PTS: base + 33_000, DTS: base + 33_000, GroupID: g})
+		r.BroadcastVideo(&media.VideoFrame{PTS: base + 66_000, DTS: base + 66_000, GroupID: g})
+	}
+
+	oldest, newest := r.DVRWindow()
+	if oldest != 1 || newest != 4 {
+		t.Fatalf("DVRWindow = (%d, %d), want (1, 4)", oldest, newest)
+	}
+
+	frames, ok := r.DVRFrames(2, 3)
+	if !ok {
+		t.Fatal("DVRFrames(2, 3) should succeed")
+	}
+	if len(frames) != 6 {
+		t.Fatalf("frames = %d, want 6", len(frames))
+	}
+	if !frames[0].IsKeyframe || frames[0].GroupID != 2 {
+		t.Errorf("first frame should be the group 2 keyframe, got group %d key=%v", frames[0].GroupID, frames[0].IsKeyframe)
+	}
+	for i := 1; i < len(frames); i++ {
+		if frames[i].DTS <= frames[i-1].DTS {
+			t.Fatalf("frame %d out of order: DTS %d after %d", i, frames[i].DTS, frames[i-1].DTS)
+		}
+	}
+	if frames[len(frames)-1].GroupID != 3 {
+		t.Errorf("last frame group = %d, want 3", frames[len(frames)-1].GroupID)
+	}
+
+	if _, ok := r.DVRFrames(9, 10); ok {
+		t.Error("DVRFrames should reject a start group newer than the window")
+	}
+
+	registered := false
+	if _, ok := r.JoinDVR(9, 10, func() { registered = true }); ok || registered {
+		t.Error("JoinDVR should reject a start group newer than the window without registering")
+	}
+	frames, ok = r.JoinDVR(4, math.MaxUint64, func() { registered = true })
+	if !ok || !registered || len(frames) != 3 {
+		t.Errorf("JoinDVR(4) = %d frames, ok %v, registered %v; want 3 frames, registered", len(frames), ok, registered)
+	}
+
+	r.SetDVRWindow(0)
+	if r.HasDVR() {
+		t.Error("SetDVRWindow(0) should disable DVR")
+	}
+}
+
+func TestRelayCatalogUpdates(t *testing.T) {
+	t.Parallel()
+	r := NewRelay()
+
+	seq0, changed := r.CatalogUpdates()
+
+	info := VideoInfo{Codec: "avc1.64001f", Width: 1280, Height: 720}
+	r.SetVideoInfo(info)
+	select {
+	case <-changed:
+	default:
+		t.Fatal("first video info should signal a catalog change")
+	}
+	seq1, changed := r.CatalogUpdates()
+	if seq1 != seq0+1 {
+		t.Fatalf("sequence = %d, want %d", seq1, seq0+1)
+	}
+
+	r.SetVideoInfo(info)
+	select {
+	case <-changed:
+		t.Fatal("identical video info should not signal a change")
+	default:
+	}
+
+	r.SetVideoInfo(VideoInfo{Codec: "avc1.640028", Width: 1920, Height: 1080})
+	if vi := r.VideoInfo(); vi.Width != 1920 || vi.Height != 1080 {
+		t.Errorf("VideoInfo after change = %dx%d, want 1920x1080", vi.Width, vi.Height)
+	}
+	seq2, changed := r.CatalogUpdates()
+	if seq2 != seq1+1 {
+		t.Errorf("sequence after resolution change = %d, want %d", seq2, seq1+1)
+	}
+
+	r.BroadcastSCTE35(&demux.SCTE35Event{})
+	r.BroadcastSCTE35(&demux.SCTE35Event{})
+	select {
+	case <-changed:
+	default:
+		t.Fatal("first SCTE-35 cue should signal a catalog change")
+	}
+	if seq3, _ := r.CatalogUpdates(); seq3 != seq2+1 {
+		t.Errorf("sequence after SCTE-35 = %d, want %d", seq3, seq2+1)
+	}
+}
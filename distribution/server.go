@@ -7,13 +7,19 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
 	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/quic-go/quic-go"
 	"github.com/quic-go/quic-go/http3"
 	"github.com/zsiec/prism/certs"
+	"github.com/zsiec/prism/demux"
 	"github.com/zsiec/prism/moq"
 	"github.com/zsiec/prism/webtransport"
 )
@@ -45,11 +51,12 @@ type PipelineDebugStats struct {
 }
 
 // PipelineDebugSnapshot is the JSON response for /api/streams/{key}/debug,
-// aggregating ingest, demuxer, pipeline, and viewer diagnostics.
+// aggregating ingest, demuxer, pipeline, relay, and viewer diagnostics.
 type PipelineDebugSnapshot struct {
 	Ingest   *IngestDebugStats  `json:"ingest,omitempty"`
 	Demuxer  PTSDebugStats      `json:"demuxer"`
 	Pipeline PipelineDebugStats `json:"pipeline"`
+	Relay    RelaySnapshot      `json:"relay"`
 	Viewers  []ViewerStats      `json:"viewers"`
 }
 
@@ -60,6 +67,11 @@ type IngestDebugStats struct {
 	ConnectedAt   int64  `json:"connectedAt"`
 	UptimeMs      int64  `json:"uptimeMs"`
 	RemoteAddr    string `json:"remoteAddr"`
+	ReadErrors    int64  `json:"readErrors"`
+	ReadTimeouts  int64  `json:"readTimeouts"`
+	ReadResets    int64  `json:"readResets"`
+	LastError     string `json:"lastError,omitempty"`
+	EndReason     string `json:"endReason,omitempty"`
 }
 
 // StreamInfo is the JSON-serializable summary of a live stream, returned
@@ -76,6 +88,8 @@ type StreamInfo struct {
 	HasCaptions     bool   `json:"hasCaptions,omitempty"`
 	CaptionChannels []int  `json:"captionChannels,omitempty"`
 	HasSCTE35       bool   `json:"hasScte35,omitempty"`
+	IngestHealth    string `json:"ingestHealth,omitempty"`
+	IngestBreaches  int64  `json:"ingestBreaches,omitempty"`
 	Protocol        string `json:"protocol,omitempty"`
 	UptimeMs        int64  `json:"uptimeMs,omitempty"`
 }
@@ -88,7 +102,7 @@ type StreamLister func() []StreamInfo
 type IngestLookup func(key string) *IngestDebugStats
 
 // SRTPullFunc initiates an SRT caller-mode pull from a remote address.
-type SRTPullFunc func(address, streamKey, streamID string) error
+type SRTPullFunc func(req SRTPullInfo) error
 
 // SRTStopFunc stops an active SRT pull by stream key.
 type SRTStopFunc func(streamKey string) error
@@ -96,12 +110,28 @@ type SRTStopFunc func(streamKey string) error
 // SRTListFunc returns all active SRT pulls.
 type SRTListFunc func() []SRTPullInfo
 
-// SRTPullInfo describes an active SRT caller-mode pull, returned by the
-// /api/srt-pull GET endpoint.
+// StreamEventFunc is invoked on stream lifecycle transitions with the
+// affected stream key. Used to integrate with external systems such as
+// recorders, notification services, or DVR archival.
+type StreamEventFunc func(key string)
+
+// SRTPullInfo describes an SRT caller-mode pull, as accepted by the
+// /api/srt-pull POST endpoint and returned by the GET endpoint. StreamID
+// is sent verbatim; otherwise Resource and User, if given, build a
+// request-mode access control stream ID.
 type SRTPullInfo struct {
 	Address   string `json:"address"`
 	StreamKey string `json:"streamKey"`
 	StreamID  string `json:"streamId,omitempty"`
+	Resource  string `json:"resource,omitempty"`
+	User      string `json:"user,omitempty"`
+
+	// Attempts counts the redials of a pull whose connection dropped,
+	// since it was last healthy, and NextRetryAt is when the next one is
+	// due, in Unix milliseconds; zero while connected. The GET endpoint
+	// sets them.
+	Attempts    int   `json:"attempts,omitempty"`
+	NextRetryAt int64 `json:"nextRetryAt,omitempty"`
 }
 
 // WebTransport session close error codes sent to clients via CloseWithError.
@@ -113,9 +143,33 @@ const (
 	wtErrSetupFailed    webtransport.SessionErrorCode = 5
 )
 
-// videoInfoTimeout is how long a new viewer waits for the first keyframe
-// (and its SPS/PPS) before proceeding with default codec parameters.
-const videoInfoTimeout = 30 * time.Second
+// defaultVideoInfoTimeout is how long a new viewer waits for the first
+// keyframe (and its SPS/PPS) before proceeding with default codec
+// parameters, unless ServerConfig.VideoInfoTimeout overrides it.
+const defaultVideoInfoTimeout = 30 * time.Second
+
+// relayDrainTimeout bounds how long UnregisterStream waits for a stream's
+// viewers to detach from its relay.
+const relayDrainTimeout = 5 * time.Second
+
+// defaultCatalogRefreshInterval is the minimum spacing between catalog
+// updates pushed to a viewer, unless overridden in the config.
+const defaultCatalogRefreshInterval = 1 * time.Second
+
+// defaultCatalogRetries is how many times a failed catalog write is
+// retried, unless overridden in the config.
+const defaultCatalogRetries = 1
+
+// defaultMaxRequestID is how many request IDs a viewer is granted at a
+// time, unless overridden in the config.
+const defaultMaxRequestID = 100
+
+// defaultShutdownGrace is how long viewers have to leave after GOAWAY
+// before the server closes, unless overridden in the config.
+const defaultShutdownGrace = 2 * time.Second
+
+// catalogRetryDelay spaces catalog delivery attempts.
+const catalogRetryDelay = 50 * time.Millisecond
 
 // statsInterval is how often per-viewer stats snapshots are sent.
 const statsInterval = 1 * time.Second
@@ -131,6 +185,192 @@ type ServerConfig struct {
 	SRTPull      SRTPullFunc
 	SRTStop      SRTStopFunc
 	SRTList      SRTListFunc
+
+	// Recorder backs the /api/streams/{key}/record endpoints. Nil
+	// disables recording.
+	Recorder RecordController
+
+	// OnStreamStart is called when a new stream is registered. OnStreamEnd
+	// is called when a registered stream is unregistered. Either may be nil.
+	//
+	// Callbacks run on a dedicated dispatch goroutine, never on the caller
+	// of RegisterStream/UnregisterStream, so a slow hook cannot delay
+	// ingest. They are invoked one at a time, in the order the transitions
+	// happened: for a publisher that reconnects under the same key,
+	// OnStreamEnd for the old session always precedes OnStreamStart for
+	// the new one. A hook that blocks delays every later hook.
+	OnStreamStart StreamEventFunc
+	OnStreamEnd   StreamEventFunc
+
+	// VideoInfoTimeout bounds how long a new viewer waits for the first
+	// keyframe before the catalog is built with default video parameters.
+	// Audio-only streams skip the wait entirely. Zero uses 30 seconds.
+	VideoInfoTimeout time.Duration
+
+	// DVRWindow, when positive, gives every relay a memory-backed
+	// time-shift buffer of roughly this much video, which viewers can seek
+	// into with an absolute-range SUBSCRIBE. Zero disables DVR.
+	DVRWindow time.Duration
+
+	// GOPCacheLimit, when positive, caps the frames each relay caches of
+	// the current GOP for late joiners; a longer GOP is not cached. See
+	// Relay.SetGOPCacheLimit. Zero is unlimited.
+	GOPCacheLimit int
+
+	// SubscribeAuthorizer, if set, validates the authorization token of
+	// every viewer SUBSCRIBE; rejected subscriptions get an unauthorized
+	// SUBSCRIBE_ERROR. Nil accepts all subscriptions.
+	SubscribeAuthorizer SubscribeAuthorizer
+
+	// AdminAuthorizer, if set, validates the bearer token of every request
+	// that starts or stops an SRT pull or a recording; rejected requests
+	// get 401 Unauthorized. Nil leaves those endpoints open.
+	AdminAuthorizer AdminAuthorizer
+
+	// CatalogRefreshInterval is the minimum spacing between catalog
+	// updates pushed to a viewer when stream parameters change, such as a
+	// mid-stream resolution switch. Zero uses one second.
+	CatalogRefreshInterval time.Duration
+
+	// ViewerWriteTimeout bounds each object write to a viewer; objects a
+	// stalled viewer cannot accept in time are dropped. Zero uses two
+	// seconds.
+	ViewerWriteTimeout time.Duration
+
+	// EndTrackOnWriteTimeout ends a viewer's subscription to a track, with
+	// a TOO_FAR_BEHIND SUBSCRIBE_DONE, on its first timed-out write rather
+	// than dropping the object and carrying on.
+	EndTrackOnWriteTimeout bool
+
+	// OpenUnalignedGroups lets a viewer's video group start at a delta
+	// frame when its keyframe never arrived, instead of skipping to the
+	// next keyframe. See MoQSessionConfig.OpenUnalignedGroups.
+	OpenUnalignedGroups bool
+
+	// PlainCaptions sends viewers captions as plain text, without their
+	// position and styling. See MoQSessionConfig.PlainCaptions.
+	PlainCaptions bool
+
+	// CaptionChannels is the CEA-708 service to caption channel mapping
+	// the stream pipelines were given, used to resolve the serviceN
+	// channel names of caption egress. Nil is demux.DefaultCaptionChannel.
+	CaptionChannels demux.CaptionChannelFunc
+
+	// ObjectDatagrams sends audio and small caption objects as QUIC
+	// datagrams to viewers that offer to receive them. See
+	// MoQSessionConfig.ObjectDatagrams.
+	ObjectDatagrams bool
+
+	// AudioFirst starts viewer sessions without waiting for video
+	// parameters, so audio plays as soon as it arrives, and publishes
+	// audio ahead of video. The catalog omits the video track until its
+	// parameters are known and is then refreshed.
+	AudioFirst bool
+
+	// TrackPriorities overrides the publisher priority of each track for
+	// every viewer. Zero fields use the defaults.
+	TrackPriorities TrackPriorities
+
+	// CatalogRetries is how many times a failed catalog write to a viewer
+	// is retried. Zero uses one retry; a negative value disables retries.
+	CatalogRetries int
+
+	// VideoOverflow is what viewer sessions do with a video frame that
+	// arrives while their queue is full, and VideoBlockTimeout bounds the
+	// wait under VideoOverflowBlock (zero uses one second).
+	VideoOverflow     VideoOverflowPolicy
+	VideoBlockTimeout time.Duration
+
+	// VideoObjects selects whether viewers receive video as one MoQ
+	// object per frame, the default, or one per slice.
+	VideoObjects VideoObjectMode
+
+	// AudioAlignHold, when positive, holds each viewer's audio until its
+	// first video keyframe is sent, for at most this long. Zero sends
+	// audio as soon as it arrives. See MoQSessionConfig.AudioAlignHold.
+	AudioAlignHold time.Duration
+
+	// AudioFramesPerObject batches this many audio frames into each MoQ
+	// object sent to viewers, trading latency for fewer, larger writes.
+	// Zero or one sends one frame per object.
+	AudioFramesPerObject int
+
+	// DropRateThreshold, when positive, is the fraction of video frames a
+	// viewer may drop over DropRateWindow (zero uses five seconds) before
+	// a lower-bitrate rendition is recommended for it, and OnDropRateHint
+	// receives each recommendation. See MoQSessionConfig.DropRateThreshold.
+	DropRateThreshold float64
+	DropRateWindow    time.Duration
+	OnDropRateHint    DropRateHintFunc
+
+	// VideoShedding is the deepest level to which video is shed for a
+	// saturated viewer to keep its audio flowing. ShedNone disables
+	// shedding. See MoQSessionConfig.VideoShedding.
+	VideoShedding ShedLevel
+
+	// MaxRequestID is how many request IDs each viewer is granted at a
+	// time, bounding the subscriptions and fetches it can make before the
+	// server grants more. Zero uses 100.
+	MaxRequestID uint64
+
+	// Timestamps selects the clock of the capture timestamps viewers
+	// receive: the source's media clock, the default, or wall-clock time
+	// for aligning streams with each other and with real time.
+	Timestamps TimestampMode
+
+	// QUIC tunes the QUIC transport viewers connect over. Zero fields use
+	// the quic-go defaults.
+	QUIC QUICTuning
+
+	// ShutdownGrace is how long viewers are given to migrate or finish
+	// after the server sends GOAWAY on shutdown, before their remaining
+	// subscriptions are ended and the listener closes. Zero uses two
+	// seconds; a negative value closes without waiting.
+	ShutdownGrace time.Duration
+}
+
+// QUICTuning exposes the quic-go flow control and stream limits, so
+// operators can size them for their network, for example raising the
+// windows for viewers on high bandwidth-delay-product links. Zero fields
+// use the quic-go defaults. quic-go does not offer a choice of congestion
+// controller or initial congestion window, so neither can be tuned here.
+type QUICTuning struct {
+	// InitialStreamReceiveWindow and MaxStreamReceiveWindow bound the
+	// per-stream flow control window, which grows from the initial to the
+	// max size as the peer keeps up. In bytes.
+	InitialStreamReceiveWindow uint64
+	MaxStreamReceiveWindow     uint64
+
+	// InitialConnectionReceiveWindow and MaxConnectionReceiveWindow do the
+	// same for the connection as a whole. In bytes.
+	InitialConnectionReceiveWindow uint64
+	MaxConnectionReceiveWindow     uint64
+
+	// MaxIncomingStreams and MaxIncomingUniStreams limit the
+	// bidirectional and unidirectional streams a viewer may have open at
+	// once.
+	MaxIncomingStreams    int64
+	MaxIncomingUniStreams int64
+}
+
+// quicConfig returns the QUIC configuration for the WebTransport server.
+func (t QUICTuning) quicConfig() *quic.Config {
+	return &quic.Config{
+		MaxIdleTimeout:                 30 * time.Second,
+		Allow0RTT:                      true,
+		InitialStreamReceiveWindow:     t.InitialStreamReceiveWindow,
+		MaxStreamReceiveWindow:         t.MaxStreamReceiveWindow,
+		InitialConnectionReceiveWindow: t.InitialConnectionReceiveWindow,
+		MaxConnectionReceiveWindow:     t.MaxConnectionReceiveWindow,
+		MaxIncomingStreams:             t.MaxIncomingStreams,
+		MaxIncomingUniStreams:          t.MaxIncomingUniStreams,
+	}
+}
+
+// streamEvent is a queued lifecycle transition awaiting dispatch.
+type streamEvent struct {
+	key   string
+	start bool
 }
 
 // streamResources bundles the relay and stats provider for a single live
@@ -149,6 +389,24 @@ type Server struct {
 
 	mu      sync.RWMutex
 	streams map[string]*streamResources
+
+	// watchers are told, with mu held, of each stream registered or
+	// unregistered; see watchStreams.
+	watchers    map[int]func(key string, active bool)
+	nextWatcher int
+
+	// moqSessions are the connected MoQ sessions, told to go away on
+	// shutdown. drained is created when shutdown begins and closed once no
+	// sessions remain.
+	sessionsMu  sync.Mutex
+	moqSessions map[*MoQSession]struct{}
+	drained     chan struct{}
+
+	// eventMu guards the lifecycle event queue. Events are enqueued while
+	// s.mu is held so queue order matches the order of state transitions.
+	eventMu     sync.Mutex
+	events      []streamEvent
+	dispatching bool
 }
 
 // NewServer creates a distribution Server with the given configuration.
@@ -160,30 +418,138 @@ func NewServer(config ServerConfig) (*Server, error) {
 	if config.Addr == "" {
 		return nil, errors.New("distribution: Addr is required")
 	}
+	if config.WebDir != "" && !hasWebAssets(config.WebDir) {
+		slog.Warn("web viewer assets not found; the viewer is not served until they are built",
+			"dir", config.WebDir)
+	}
 	return &Server{
-		config:  config,
-		streams: make(map[string]*streamResources),
+		config:      config,
+		streams:     make(map[string]*streamResources),
+		moqSessions: make(map[*MoQSession]struct{}),
 	}, nil
 }
 
 // RegisterStream creates a Relay for the given stream key and returns it.
-// If the stream already has a relay, the existing one is returned.
+// If the stream already has a relay, the existing one is returned and
+// OnStreamStart is not queued again.
 func (s *Server) RegisterStream(streamKey string) *Relay {
 	s.mu.Lock()
-	defer s.mu.Unlock()
 	if sr, ok := s.streams[streamKey]; ok {
+		s.mu.Unlock()
 		return sr.relay
 	}
 	r := NewRelay()
+	r.SetDVRWindow(s.config.DVRWindow)
+	r.SetGOPCacheLimit(s.config.GOPCacheLimit)
+	r.SetTimestampMode(s.config.Timestamps)
 	s.streams[streamKey] = &streamResources{relay: r}
+	s.enqueueStreamEvent(streamEvent{key: streamKey, start: true})
+	s.notifyWatchersLocked(streamKey, true)
+	s.mu.Unlock()
 	return r
 }
 
-// UnregisterStream removes the relay and pipeline for a stream key.
+// UnregisterStream removes the relay and pipeline for a stream key,
+// queueing OnStreamEnd if the stream was registered. Teardown is ordered:
+// the relay stops accepting viewers, those attached are told the stream
+// ended, and UnregisterStream waits briefly for them to detach, so none is
+// left on a relay a re-registered stream has replaced.
 func (s *Server) UnregisterStream(streamKey string) {
+	s.mu.Lock()
+	sr, ok := s.streams[streamKey]
+	if ok {
+		delete(s.streams, streamKey)
+		s.enqueueStreamEvent(streamEvent{key: streamKey})
+		s.notifyWatchersLocked(streamKey, false)
+	}
+	s.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	sr.relay.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), relayDrainTimeout)
+	defer cancel()
+	if !sr.relay.WaitDetached(ctx) {
+		slog.Warn("viewers still attached after stream teardown",
+			"stream", streamKey, "viewers", sr.relay.ViewerCount())
+	}
+}
+
+// enqueueStreamEvent appends a lifecycle event to the dispatch queue and
+// starts the dispatch goroutine if one is not already draining it. The
+// caller must hold s.mu.
+func (s *Server) enqueueStreamEvent(ev streamEvent) {
+	if ev.start && s.config.OnStreamStart == nil {
+		return
+	}
+	if !ev.start && s.config.OnStreamEnd == nil {
+		return
+	}
+
+	s.eventMu.Lock()
+	s.events = append(s.events, ev)
+	if !s.dispatching {
+		s.dispatching = true
+		go s.dispatchStreamEvents()
+	}
+	s.eventMu.Unlock()
+}
+
+// dispatchStreamEvents invokes lifecycle callbacks in queue order until the
+// queue is empty, then exits.
+func (s *Server) dispatchStreamEvents() {
+	for {
+		s.eventMu.Lock()
+		if len(s.events) == 0 {
+			s.dispatching = false
+			s.eventMu.Unlock()
+			return
+		}
+		ev := s.events[0]
+		s.events = s.events[1:]
+		s.eventMu.Unlock()
+
+		if ev.start {
+			s.config.OnStreamStart(ev.key)
+		} else {
+			s.config.OnStreamEnd(ev.key)
+		}
+	}
+}
+
+// watchStreams returns the keys of the active streams and registers notify
+// to be called each time a stream is registered (active) or unregistered,
+// until stop is called. The snapshot and registration are atomic, so no
+// transition is missed or reported twice. notify is called with s.mu held
+// and must not block.
+func (s *Server) watchStreams(notify func(key string, active bool)) (active []string, stop func()) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	delete(s.streams, streamKey)
+	for key := range s.streams {
+		active = append(active, key)
+	}
+	slices.Sort(active)
+
+	if s.watchers == nil {
+		s.watchers = make(map[int]func(string, bool))
+	}
+	id := s.nextWatcher
+	s.nextWatcher++
+	s.watchers[id] = notify
+	return active, func() {
+		s.mu.Lock()
+		delete(s.watchers, id)
+		s.mu.Unlock()
+	}
+}
+
+// notifyWatchersLocked reports a stream transition to every watcher. The
+// caller must hold s.mu.
+func (s *Server) notifyWatchersLocked(key string, active bool) {
+	for _, notify := range s.watchers {
+		notify(key, active)
+	}
 }
 
 // SetPipeline associates a StatsProvider with a stream key. The stream
@@ -219,11 +585,18 @@ func (s *Server) GetRelay(streamKey string) *Relay {
 // registerAPIRoutes registers the REST API endpoints on the given mux.
 func (s *Server) registerAPIRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("GET /api/streams", s.handleListStreams)
+	mux.HandleFunc("GET /api/streams/debug", s.handleAllStreamsDebug)
 	mux.HandleFunc("GET /api/streams/{key}/debug", s.handleStreamDebug)
+	mux.HandleFunc("GET /api/streams/{key}/catalog", s.handleStreamCatalog)
+	mux.HandleFunc("GET /api/streams/{key}/live.ts", s.handleLiveTS)
+	mux.HandleFunc("GET /api/streams/{key}/captions.vtt", s.handleCaptionsVTT)
+	mux.HandleFunc("GET /api/streams/{key}/record", s.handleRecordList)
+	mux.HandleFunc("POST /api/streams/{key}/record", s.requireAdmin(s.handleRecordStart))
+	mux.HandleFunc("DELETE /api/streams/{key}/record", s.requireAdmin(s.handleRecordStop))
 	mux.HandleFunc("GET /api/cert-hash", s.handleCertHash)
 	mux.HandleFunc("GET /api/srt-pull", s.handleSRTPullList)
-	mux.HandleFunc("POST /api/srt-pull", s.handleSRTPullCreate)
-	mux.HandleFunc("DELETE /api/srt-pull", s.handleSRTPullStop)
+	mux.HandleFunc("POST /api/srt-pull", s.requireAdmin(s.handleSRTPullCreate))
+	mux.HandleFunc("DELETE /api/srt-pull", s.requireAdmin(s.handleSRTPullStop))
 	mux.HandleFunc("OPTIONS /api/srt-pull", s.handleSRTPullOptions)
 }
 
@@ -234,12 +607,37 @@ func (s *Server) APIHandler() http.Handler {
 	s.registerAPIRoutes(mux)
 
 	if s.config.WebDir != "" {
-		mux.Handle("/", http.FileServer(http.Dir(s.config.WebDir)))
+		mux.Handle("/", webHandler(s.config.WebDir))
+	} else {
+		mux.HandleFunc("GET /", func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "404 not found: no web viewer is configured on this server", http.StatusNotFound)
+		})
 	}
 
 	return corsMiddleware(crossOriginIsolationMiddleware(mux))
 }
 
+// webHandler serves the web viewer's static assets from dir. While dir
+// has no index.html, as when it is missing or the viewer has not been
+// built, every path gets a 503 saying so rather than a bare 404.
+func webHandler(dir string) http.Handler {
+	files := http.FileServer(http.Dir(dir))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !hasWebAssets(dir) {
+			http.Error(w, fmt.Sprintf("503 web viewer unavailable: no index.html in %s; build it with `make web-build`", dir),
+				http.StatusServiceUnavailable)
+			return
+		}
+		files.ServeHTTP(w, r)
+	})
+}
+
+// hasWebAssets reports whether dir holds a built web viewer.
+func hasWebAssets(dir string) bool {
+	info, err := os.Stat(filepath.Join(dir, "index.html"))
+	return err == nil && !info.IsDir()
+}
+
 func crossOriginIsolationMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Cross-Origin-Opener-Policy", "same-origin")
@@ -248,6 +646,24 @@ func crossOriginIsolationMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// requireAdmin wraps a control endpoint's handler so it runs only for
+// requests the configured AdminAuthorizer accepts.
+func (s *Server) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	authorize := s.config.AdminAuthorizer
+	if authorize == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if err := authorize(token); err != nil {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		next(w, r)
+	}
+}
+
 func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
@@ -280,13 +696,10 @@ func (s *Server) Start(ctx context.Context) error {
 
 	s.wtSrv = &webtransport.Server{
 		H3: http3.Server{
-			Addr:      s.config.Addr,
-			Handler:   corsMiddleware(wtMux),
-			TLSConfig: tlsConfig,
-			QUICConfig: &quic.Config{
-				MaxIdleTimeout: 30 * time.Second,
-				Allow0RTT:      true,
-			},
+			Addr:       s.config.Addr,
+			Handler:    corsMiddleware(wtMux),
+			TLSConfig:  tlsConfig,
+			QUICConfig: s.config.QUIC.quicConfig(),
 		},
 		// SECURITY: CheckOrigin accepts all origins. This is intentional for
 		// development and local-network use. Production deployments behind a
@@ -298,7 +711,7 @@ func (s *Server) Start(ctx context.Context) error {
 
 	slog.Info("WebTransport server listening", "addr", s.config.Addr)
 
-	stop := context.AfterFunc(ctx, func() { s.wtSrv.Close() })
+	stop := context.AfterFunc(ctx, s.shutdown)
 	defer stop()
 
 	err := s.wtSrv.ListenAndServe()
@@ -308,10 +721,80 @@ func (s *Server) Start(ctx context.Context) error {
 	return err
 }
 
+// shutdown closes the server gracefully: every MoQ session is sent
+// GOAWAY, then given the shutdown grace to leave on its own. Subscriptions
+// still open after that end with SUBSCRIBE_DONE (going away) before the
+// listener and its connections are closed.
+func (s *Server) shutdown() {
+	grace := s.config.ShutdownGrace
+	if grace == 0 {
+		grace = defaultShutdownGrace
+	}
+
+	s.sessionsMu.Lock()
+	s.drained = make(chan struct{})
+	if len(s.moqSessions) == 0 {
+		close(s.drained)
+	}
+	sessions := slices.Collect(maps.Keys(s.moqSessions))
+	s.sessionsMu.Unlock()
+
+	slog.Info("WebTransport server shutting down", "sessions", len(sessions), "grace", grace)
+	for _, m := range sessions {
+		m.goAway()
+	}
+
+	if grace > 0 {
+		timer := time.NewTimer(grace)
+		select {
+		case <-s.drained:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+
+	s.sessionsMu.Lock()
+	sessions = slices.Collect(maps.Keys(s.moqSessions))
+	s.sessionsMu.Unlock()
+	for _, m := range sessions {
+		m.endSubscriptions(moq.SubscribeDoneGoingAway, "server shutting down")
+	}
+
+	s.wtSrv.Close()
+}
+
+// addMoQSession tracks a connected session for shutdown. A session that
+// connects once shutdown has begun is sent GOAWAY straight away.
+func (s *Server) addMoQSession(m *MoQSession) {
+	s.sessionsMu.Lock()
+	s.moqSessions[m] = struct{}{}
+	draining := s.drained != nil
+	s.sessionsMu.Unlock()
+	if draining {
+		m.goAway()
+	}
+}
+
+// removeMoQSession stops tracking a session that has ended.
+func (s *Server) removeMoQSession(m *MoQSession) {
+	s.sessionsMu.Lock()
+	defer s.sessionsMu.Unlock()
+	delete(s.moqSessions, m)
+	if s.drained == nil || len(s.moqSessions) > 0 {
+		return
+	}
+	select {
+	case <-s.drained:
+	default:
+		close(s.drained)
+	}
+}
+
 type statsMessage struct {
 	Type        string         `json:"type"`
 	Stats       StreamSnapshot `json:"stats"`
 	ViewerStats *ViewerStats   `json:"viewerStats,omitempty"`
+	Relay       RelaySnapshot  `json:"relay"`
 }
 
 type certHashResponse struct {
@@ -329,16 +812,48 @@ func (s *Server) handleMoQ(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		return // setupMoQ already logged and closed the session
 	}
+	s.addMoQSession(moqSession)
+	defer s.removeMoQSession(moqSession)
+	if relay == nil {
+		if err := moqSession.Run(session.Context()); err != nil {
+			slog.Debug("moq discovery session ended", "session", moqSession.ID(), "error", err)
+		}
+		return
+	}
 
-	waitCtx, waitCancel := context.WithTimeout(r.Context(), videoInfoTimeout)
-	defer waitCancel()
-	relay.WaitVideoInfo(waitCtx)
+	// Audio-first sessions start straight away; the catalog advertises
+	// video once its parameters arrive.
+	if !s.config.AudioFirst {
+		timeout := s.config.VideoInfoTimeout
+		if timeout <= 0 {
+			timeout = defaultVideoInfoTimeout
+		}
+		waitCtx, waitCancel := context.WithTimeout(r.Context(), timeout)
+		defer waitCancel()
+		relay.WaitVideoInfo(waitCtx)
+	}
 
-	relay.AddViewer(moqSession)
+	if !relay.AddViewer(moqSession) {
+		slog.Warn("moq stream ended before viewer attached", "stream", streamKey)
+		session.CloseWithError(wtErrStreamNotFound, "stream not found")
+		return
+	}
 	defer relay.RemoveViewer(moqSession.ID())
 
-	_ = streamKey // used during setup; kept for clarity
-	if err := moqSession.Run(session.Context()); err != nil {
+	// When the stream ends, end its subscriptions before the session
+	// itself, so the client learns the tracks are over.
+	ctx, cancel := context.WithCancel(session.Context())
+	defer cancel()
+	go func() {
+		select {
+		case <-relay.Done():
+			moqSession.endSubscriptions(moq.SubscribeDoneTrackEnded, "stream ended")
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	if err := moqSession.Run(ctx); err != nil {
 		slog.Debug("moq session ended", "session", moqSession.ID(), "error", err)
 	}
 }
@@ -379,12 +894,33 @@ func (s *Server) setupMoQ(r *http.Request, session *webtransport.Session, contro
 	}
 
 	moqSession := NewMoQSession(MoQSessionConfig{
-		ID:            fmt.Sprintf("moq-%s-%s", streamKey, r.RemoteAddr),
-		Session:       session,
-		Control:       controlStream,
-		StreamKey:     streamKey,
-		Relay:         relay,
-		StatsProvider: s.GetPipeline,
+		ID:                     fmt.Sprintf("moq-%s-%s", streamKey, r.RemoteAddr),
+		Session:                session,
+		Control:                controlStream,
+		StreamKey:              streamKey,
+		Relay:                  relay,
+		StatsProvider:          s.GetPipeline,
+		WatchStreams:           s.watchStreams,
+		Authorize:              s.config.SubscribeAuthorizer,
+		CatalogRefreshInterval: s.config.CatalogRefreshInterval,
+		WriteTimeout:           s.config.ViewerWriteTimeout,
+		AudioFirst:             s.config.AudioFirst,
+		Priorities:             s.config.TrackPriorities,
+		CatalogRetries:         s.config.CatalogRetries,
+		VideoOverflow:          s.config.VideoOverflow,
+		VideoBlockTimeout:      s.config.VideoBlockTimeout,
+		VideoObjects:           s.config.VideoObjects,
+		EndTrackOnWriteTimeout: s.config.EndTrackOnWriteTimeout,
+		OpenUnalignedGroups:    s.config.OpenUnalignedGroups,
+		PlainCaptions:          s.config.PlainCaptions,
+		ObjectDatagrams:        s.config.ObjectDatagrams,
+		AudioAlignHold:         s.config.AudioAlignHold,
+		AudioFramesPerObject:   s.config.AudioFramesPerObject,
+		DropRateThreshold:      s.config.DropRateThreshold,
+		DropRateWindow:         s.config.DropRateWindow,
+		OnDropRateHint:         s.config.OnDropRateHint,
+		VideoShedding:          s.config.VideoShedding,
+		MaxRequestID:           s.config.MaxRequestID,
 	})
 
 	pathKey, err := moqSession.handleSetup()
@@ -407,12 +943,8 @@ func (s *Server) setupMoQ(r *http.Request, session *webtransport.Session, contro
 		moqSession.relay = relay
 	}
 
-	if streamKey == "" {
-		slog.Warn("moq no stream key provided")
-		session.CloseWithError(wtErrBadRequest, "missing stream key")
-		return "", nil, nil, fmt.Errorf("moq: missing stream key")
-	}
-
+	// A session without a stream key can only discover streams with
+	// SUBSCRIBE_ANNOUNCES; it has no tracks to subscribe to.
 	return streamKey, relay, moqSession, nil
 }
 
@@ -442,6 +974,49 @@ func (s *Server) handleStreamDebug(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	writeJSON(w, http.StatusOK, s.debugSnapshot(streamKey, sr))
+}
+
+// handleAllStreamsDebug returns the debug snapshot of every stream with a
+// pipeline, keyed by stream key, so a dashboard can fetch them in one
+// request.
+func (s *Server) handleAllStreamsDebug(w http.ResponseWriter, _ *http.Request) {
+	s.mu.RLock()
+	streams := make(map[string]streamResources, len(s.streams))
+	for key, sr := range s.streams {
+		if sr.pipeline != nil {
+			streams[key] = *sr
+		}
+	}
+	s.mu.RUnlock()
+
+	resp := make(map[string]PipelineDebugSnapshot, len(streams))
+	for key, sr := range streams {
+		resp[key] = s.debugSnapshot(key, &sr)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleStreamCatalog returns the catalog a MoQ subscriber to the stream
+// would receive now, for inspecting its tracks without a MoQ client.
+func (s *Server) handleStreamCatalog(w http.ResponseWriter, r *http.Request) {
+	relay := s.GetRelay(r.PathValue("key"))
+	if relay == nil {
+		writeError(w, http.StatusNotFound, "stream not found")
+		return
+	}
+
+	seq, _ := relay.CatalogUpdates()
+	catalog, err := buildMoQCatalog(r.PathValue("key"), relay, seq, false)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "catalog build failed")
+		return
+	}
+	writeJSON(w, http.StatusOK, json.RawMessage(catalog))
+}
+
+// debugSnapshot assembles the debug snapshot of one stream.
+func (s *Server) debugSnapshot(streamKey string, sr *streamResources) PipelineDebugSnapshot {
 	var snap PipelineDebugSnapshot
 
 	if dp, ok := sr.pipeline.(DebugProvider); ok {
@@ -449,13 +1024,13 @@ func (s *Server) handleStreamDebug(w http.ResponseWriter, r *http.Request) {
 		snap.Demuxer = dp.DemuxStats().PTSDebug()
 	}
 
+	snap.Relay = sr.relay.Snapshot()
 	snap.Viewers = sr.relay.ViewerStatsAll()
 
 	if s.config.IngestLookup != nil {
 		snap.Ingest = s.config.IngestLookup(streamKey)
 	}
-
-	writeJSON(w, http.StatusOK, snap)
+	return snap
 }
 
 func (s *Server) handleCertHash(w http.ResponseWriter, _ *http.Request) {
@@ -467,7 +1042,7 @@ func (s *Server) handleCertHash(w http.ResponseWriter, _ *http.Request) {
 
 func (s *Server) handleSRTPullOptions(w http.ResponseWriter, _ *http.Request) {
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -487,11 +1062,7 @@ func (s *Server) handleSRTPullCreate(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusNotImplemented, "SRT pull not configured")
 		return
 	}
-	var req struct {
-		Address   string `json:"address"`
-		StreamKey string `json:"streamKey"`
-		StreamID  string `json:"streamId,omitempty"`
-	}
+	var req SRTPullInfo
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		writeError(w, http.StatusBadRequest, err.Error())
 		return
@@ -500,7 +1071,7 @@ func (s *Server) handleSRTPullCreate(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusBadRequest, "address and streamKey are required")
 		return
 	}
-	if err := s.config.SRTPull(req.Address, req.StreamKey, req.StreamID); err != nil {
+	if err := s.config.SRTPull(req); err != nil {
 		writeError(w, http.StatusConflict, err.Error())
 		return
 	}
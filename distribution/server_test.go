@@ -1,13 +1,24 @@
 package distribution
 
 import (
+	"bytes"
 	"encoding/json"
+	"log/slog"
+	"maps"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/zsiec/prism/certs"
+	"github.com/zsiec/prism/media"
+	"github.com/zsiec/prism/moq"
+	"github.com/zsiec/prism/webtransport"
 )
 
 func newTestServer(t *testing.T) *Server {
@@ -126,11 +137,87 @@ func TestHandleStreamDebugNotFound(t *testing.T) {
 	}
 }
 
+// stubStats is a StatsProvider with no debug diagnostics.
+type stubStats struct{}
+
+func (stubStats) StreamSnapshot() StreamSnapshot { return StreamSnapshot{} }
+
+func TestHandleAllStreamsDebug(t *testing.T) {
+	t.Parallel()
+
+	srv := newTestServer(t)
+	for _, key := range []string{"cam1", "cam2", "no-pipeline"} {
+		srv.RegisterStream(key)
+	}
+	srv.SetPipeline("cam1", stubStats{})
+	srv.SetPipeline("cam2", stubStats{})
+	srv.GetRelay("cam2").AddViewer(newMockViewer("v1"))
+
+	req := httptest.NewRequest("GET", "/api/streams/debug", nil)
+	rec := httptest.NewRecorder()
+	srv.APIHandler().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	var resp map[string]PipelineDebugSnapshot
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got := slices.Sorted(maps.Keys(resp)); !slices.Equal(got, []string{"cam1", "cam2"}) {
+		t.Fatalf("streams = %v, want [cam1 cam2]", got)
+	}
+	if n := len(resp["cam2"].Viewers); n != 1 {
+		t.Errorf("cam2 viewers = %d, want 1", n)
+	}
+}
+
+func TestHandleStreamCatalog(t *testing.T) {
+	t.Parallel()
+
+	srv := newTestServer(t)
+	handler := srv.APIHandler()
+	get := func(key string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", "/api/streams/"+key+"/catalog", nil))
+		return rec
+	}
+
+	if rec := get("nonexistent"); rec.Code != http.StatusNotFound {
+		t.Fatalf("unknown stream: status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+
+	relay := srv.RegisterStream("cam1")
+	trackNames := func() []string {
+		t.Helper()
+		rec := get("cam1")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+		}
+		var cat moqCatalog
+		if err := json.NewDecoder(rec.Body).Decode(&cat); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		var names []string
+		for _, tr := range cat.Tracks {
+			names = append(names, tr.Name)
+		}
+		return names
+	}
+
+	before := trackNames()
+	relay.SetAudioTrackCount(2) // a second audio track appears mid-stream
+	after := trackNames()
+	if slices.Contains(before, "audio1") || !slices.Contains(after, "audio1") {
+		t.Errorf("tracks before = %v, after = %v; want audio1 added", before, after)
+	}
+}
+
 func TestHandleSRTPullCreateMissingFields(t *testing.T) {
 	t.Parallel()
 
 	srv := newTestServer(t)
-	srv.config.SRTPull = func(_, _, _ string) error { return nil }
+	srv.config.SRTPull = func(SRTPullInfo) error { return nil }
 	handler := srv.APIHandler()
 
 	req := httptest.NewRequest("POST", "/api/srt-pull", strings.NewReader(`{"address":""}`))
@@ -256,3 +343,305 @@ func TestNewServerValidation(t *testing.T) {
 		}
 	})
 }
+
+func TestQUICTuningConfig(t *testing.T) {
+	t.Parallel()
+
+	def := QUICTuning{}.quicConfig()
+	if def.MaxIdleTimeout != 30*time.Second || !def.Allow0RTT {
+		t.Errorf("default config = %+v, want 30s idle timeout and 0-RTT", def)
+	}
+	if def.InitialStreamReceiveWindow != 0 || def.MaxIncomingStreams != 0 {
+		t.Errorf("default config overrides quic-go defaults: %+v", def)
+	}
+
+	tuned := QUICTuning{
+		InitialStreamReceiveWindow:     1 << 20,
+		MaxStreamReceiveWindow:         8 << 20,
+		InitialConnectionReceiveWindow: 2 << 20,
+		MaxConnectionReceiveWindow:     32 << 20,
+		MaxIncomingStreams:             50,
+		MaxIncomingUniStreams:          200,
+	}.quicConfig()
+	if tuned.InitialStreamReceiveWindow != 1<<20 || tuned.MaxStreamReceiveWindow != 8<<20 ||
+		tuned.InitialConnectionReceiveWindow != 2<<20 || tuned.MaxConnectionReceiveWindow != 32<<20 {
+		t.Errorf("receive windows = %d/%d stream, %d/%d connection",
+			tuned.InitialStreamReceiveWindow, tuned.MaxStreamReceiveWindow,
+			tuned.InitialConnectionReceiveWindow, tuned.MaxConnectionReceiveWindow)
+	}
+	if tuned.MaxIncomingStreams != 50 || tuned.MaxIncomingUniStreams != 200 {
+		t.Errorf("stream limits = %d bidi, %d uni, want 50, 200", tuned.MaxIncomingStreams, tuned.MaxIncomingUniStreams)
+	}
+	if tuned.MaxIdleTimeout != 30*time.Second || !tuned.Allow0RTT {
+		t.Error("tuning dropped the idle timeout or 0-RTT")
+	}
+}
+
+func TestServerShutdownSendsGoAway(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		grace    time.Duration
+		leave    bool // the viewer leaves once it sees GOAWAY
+		wantMsgs []uint64
+	}{
+		{name: "grace expires", grace: 20 * time.Millisecond, wantMsgs: []uint64{moq.MsgGoAway, moq.MsgSubscribeDone}},
+		{name: "viewer leaves", grace: time.Minute, leave: true, wantMsgs: []uint64{moq.MsgGoAway}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			srv := newTestServer(t)
+			srv.config.ShutdownGrace = tt.grace
+			srv.wtSrv = &webtransport.Server{}
+
+			responseBuf := &bytes.Buffer{}
+			session := &MoQSession{
+				id:            "test-session",
+				log:           slog.With("session", "test-session"),
+				control:       &mockControlStream{Reader: &bytes.Buffer{}, Writer: responseBuf},
+				subscriptions: make(map[string]*moqTrackSub),
+			}
+			done := make(chan struct{})
+			close(done)
+			session.subscriptions["video"] = &moqTrackSub{requestID: 4, trackName: "video", streamCount: 3, done: done}
+			srv.addMoQSession(session)
+
+			if tt.leave {
+				go func() {
+					for !session.goAwaySent.Load() {
+						time.Sleep(time.Millisecond)
+					}
+					srv.removeMoQSession(session)
+				}()
+			}
+
+			finished := make(chan struct{})
+			go func() {
+				srv.shutdown()
+				close(finished)
+			}()
+			select {
+			case <-finished:
+			case <-time.After(5 * time.Second):
+				t.Fatal("shutdown did not finish")
+			}
+
+			session.controlMu.Lock()
+			r := bytes.NewReader(responseBuf.Bytes())
+			session.controlMu.Unlock()
+			var got []uint64
+			for {
+				typ, payload, err := moq.ReadControlMsg(r)
+				if err != nil {
+					break
+				}
+				got = append(got, typ)
+				if typ == moq.MsgSubscribeDone {
+					reqID, off := readVarint(payload, 0)
+					status, off := readVarint(payload, off)
+					streams, _ := readVarint(payload, off)
+					if reqID != 4 || moq.SubscribeDoneStatus(status) != moq.SubscribeDoneGoingAway || streams != 3 {
+						t.Errorf("SUBSCRIBE_DONE = request %d, status %d, %d streams; want 4, going away, 3",
+							reqID, status, streams)
+					}
+				}
+			}
+			if !slices.Equal(got, tt.wantMsgs) {
+				t.Errorf("control messages = %#x, want %#x", got, tt.wantMsgs)
+			}
+		})
+	}
+}
+
+func TestStreamLifecycleCallbacks(t *testing.T) {
+	t.Parallel()
+
+	cert, err := certs.Generate(24 * 60 * 60 * 1e9)
+	if err != nil {
+		t.Fatalf("certs.Generate: %v", err)
+	}
+
+	events := make(chan string, 16)
+	srv, err := NewServer(ServerConfig{
+		Addr:          ":0",
+		Cert:          cert,
+		OnStreamStart: func(key string) { events <- "start:" + key },
+		OnStreamEnd:   func(key string) { events <- "end:" + key },
+	})
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+
+	srv.RegisterStream("live1")
+	srv.RegisterStream("live1") // existing relay: no second start
+	srv.UnregisterStream("live1")
+	srv.UnregisterStream("live1") // already gone: no second end
+	srv.UnregisterStream("never-registered")
+
+	want := []string{"start:live1", "end:live1"}
+	for _, w := range want {
+		select {
+		case got := <-events:
+			if got != w {
+				t.Fatalf("event = %q, want %q", got, w)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timed out waiting for %q", w)
+		}
+	}
+	select {
+	case got := <-events:
+		t.Fatalf("unexpected extra event %q", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestUnregisterStreamDrainsViewers(t *testing.T) {
+	t.Parallel()
+
+	cert, err := certs.Generate(24 * 60 * 60 * 1e9)
+	if err != nil {
+		t.Fatalf("certs.Generate: %v", err)
+	}
+	srv, err := NewServer(ServerConfig{Addr: ":0", Cert: cert})
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+
+	relay := srv.RegisterStream("live1")
+	v := newMockViewer("v1")
+	if !relay.AddViewer(v) {
+		t.Fatal("AddViewer = false on a registered stream")
+	}
+
+	// The viewer keeps receiving frames until the relay closes, then
+	// detaches after a delay, as a session finishing its last write would.
+	var left atomic.Bool
+	go func() {
+		for i := int64(0); ; i++ {
+			select {
+			case <-relay.Done():
+				time.Sleep(20 * time.Millisecond)
+				left.Store(true)
+				relay.RemoveViewer(v.ID())
+				return
+			default:
+				relay.BroadcastVideo(&media.VideoFrame{PTS: i, IsKeyframe: true})
+			}
+		}
+	}()
+
+	srv.UnregisterStream("live1")
+	if !left.Load() {
+		t.Fatal("UnregisterStream returned before the viewer detached")
+	}
+	if n := relay.ViewerCount(); n != 0 {
+		t.Errorf("ViewerCount = %d after teardown, want 0", n)
+	}
+	if srv.GetRelay("live1") != nil {
+		t.Error("relay still registered after UnregisterStream")
+	}
+	if relay.AddViewer(newMockViewer("v2")) {
+		t.Error("AddViewer succeeded on a torn-down relay")
+	}
+}
+
+func TestStreamLifecycleCallbacksOrderedAndNonBlocking(t *testing.T) {
+	t.Parallel()
+
+	cert, err := certs.Generate(24 * 60 * 60 * 1e9)
+	if err != nil {
+		t.Fatalf("certs.Generate: %v", err)
+	}
+
+	release := make(chan struct{})
+	events := make(chan string, 16)
+	srv, err := NewServer(ServerConfig{
+		Addr: ":0",
+		Cert: cert,
+		OnStreamStart: func(key string) {
+			<-release // a slow webhook must not block RegisterStream
+			events <- "start:" + key
+		},
+		OnStreamEnd: func(key string) { events <- "end:" + key },
+	})
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+
+	// A publisher reconnecting under the same key while the first
+	// OnStreamStart is still running.
+	done := make(chan struct{})
+	go func() {
+		srv.RegisterStream("live1")
+		srv.UnregisterStream("live1")
+		srv.RegisterStream("live1")
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("RegisterStream blocked on OnStreamStart")
+	}
+	close(release)
+
+	want := []string{"start:live1", "end:live1", "start:live1"}
+	for _, w := range want {
+		select {
+		case got := <-events:
+			if got != w {
+				t.Fatalf("event = %q, want %q", got, w)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timed out waiting for %q", w)
+		}
+	}
+}
+
+func TestAPIHandlerWebDir(t *testing.T) {
+	t.Parallel()
+
+	built := t.TempDir()
+	if err := os.WriteFile(filepath.Join(built, "index.html"), []byte("<title>prism</title>"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cert, err := certs.Generate(24 * time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		webDir   string
+		path     string
+		want     int
+		wantBody string
+	}{
+		{"no UI configured", "", "/", http.StatusNotFound, "no web viewer is configured"},
+		{"missing directory", filepath.Join(built, "missing"), "/", http.StatusServiceUnavailable, "make web-build"},
+		{"directory not built", t.TempDir(), "/index.html", http.StatusServiceUnavailable, "no index.html"},
+		{"index", built, "/", http.StatusOK, "prism"},
+		{"file not found", built, "/missing.js", http.StatusNotFound, "404 page not found"},
+		{"API unaffected", filepath.Join(built, "missing"), "/api/cert-hash", http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			srv, err := NewServer(ServerConfig{Addr: ":0", Cert: cert, WebDir: tt.webDir})
+			if err != nil {
+				t.Fatal(err)
+			}
+			rec := httptest.NewRecorder()
+			srv.APIHandler().ServeHTTP(rec, httptest.NewRequest("GET", tt.path, nil))
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.want)
+			}
+			if !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Errorf("body = %q, want it to mention %q", rec.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
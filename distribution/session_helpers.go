@@ -1,36 +1,132 @@
 package distribution
 
 import (
+	"fmt"
 	"sync/atomic"
+	"time"
 
 	"github.com/zsiec/prism/media"
 )
 
+// VideoOverflowPolicy selects what a MoQ session does with a video frame
+// that arrives while the viewer's video queue is full.
+type VideoOverflowPolicy int
+
+const (
+	// VideoOverflowDropFrame drops the frame and, if it is a delta frame,
+	// the rest of its group. It is the default.
+	VideoOverflowDropFrame VideoOverflowPolicy = iota
+
+	// VideoOverflowDropGroup drops the frame and every later frame of its
+	// group, keyframe included, so the viewer never receives delta frames
+	// whose keyframe it missed.
+	VideoOverflowDropGroup
+
+	// VideoOverflowBlock waits for room in the queue, for archival clients
+	// that prefer delay to loss, and drops as VideoOverflowDropGroup once
+	// the block timeout passes. The wait stalls the relay's fan-out to
+	// every other viewer of the stream.
+	VideoOverflowBlock
+)
+
+// defaultVideoBlockTimeout bounds the wait for queue room under
+// VideoOverflowBlock unless overridden in the config.
+const defaultVideoBlockTimeout = time.Second
+
+// ParseVideoOverflowPolicy parses a policy name: "drop-frame", "drop-group"
+// or "block".
+func ParseVideoOverflowPolicy(s string) (VideoOverflowPolicy, error) {
+	switch s {
+	case "drop-frame":
+		return VideoOverflowDropFrame, nil
+	case "drop-group":
+		return VideoOverflowDropGroup, nil
+	case "block":
+		return VideoOverflowBlock, nil
+	}
+	return 0, fmt.Errorf("unknown video overflow policy %q", s)
+}
+
+func (p VideoOverflowPolicy) String() string {
+	switch p {
+	case VideoOverflowDropFrame:
+		return "drop-frame"
+	case VideoOverflowDropGroup:
+		return "drop-group"
+	case VideoOverflowBlock:
+		return "block"
+	}
+	return fmt.Sprintf("VideoOverflowPolicy(%d)", int(p))
+}
+
 // trySendVideo implements the damaged-group-aware video send logic shared
 // by both single-stream viewerSession and multiplexed muxStreamView.
 // It drops delta frames belonging to a GOP where an earlier frame was
-// dropped, preventing the client from receiving un-decodable data.
+// dropped, preventing the client from receiving un-decodable data. It
+// reports whether the frame was queued.
 func trySendVideo(
 	frame *media.VideoFrame,
 	videoCh chan *media.VideoFrame,
 	damagedGroup *atomic.Uint32,
 	videoSent *atomic.Int64,
 	videoDropped *atomic.Int64,
-) {
+) bool {
 	if frame.IsKeyframe {
 		damagedGroup.Store(0)
 	} else if damagedGroup.Load() == frame.GroupID {
 		videoDropped.Add(1)
-		return
+		return false
 	}
 
 	select {
 	case videoCh <- frame:
 		videoSent.Add(1)
+		return true
 	default:
 		videoDropped.Add(1)
 		if !frame.IsKeyframe {
 			damagedGroup.Store(frame.GroupID)
 		}
+		return false
+	}
+}
+
+// sendVideoGroupwise implements VideoOverflowDropGroup and, given a
+// positive wait, VideoOverflowBlock. Unlike trySendVideo it also damages
+// the group of a dropped keyframe. It reports whether the frame was
+// queued.
+func sendVideoGroupwise(
+	frame *media.VideoFrame,
+	videoCh chan *media.VideoFrame,
+	wait time.Duration,
+	damagedGroup *atomic.Uint32,
+	videoSent *atomic.Int64,
+	videoDropped *atomic.Int64,
+) bool {
+	if frame.IsKeyframe {
+		damagedGroup.Store(0)
+	} else if damagedGroup.Load() == frame.GroupID {
+		videoDropped.Add(1)
+		return false
+	}
+
+	select {
+	case videoCh <- frame:
+		videoSent.Add(1)
+		return true
+	default:
+	}
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case videoCh <- frame:
+			videoSent.Add(1)
+			return true
+		case <-timer.C:
+		}
 	}
+	videoDropped.Add(1)
+	damagedGroup.Store(frame.GroupID)
+	return false
 }
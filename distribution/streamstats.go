@@ -1,11 +1,14 @@
 package distribution
 
 import (
+	"encoding/json"
+	"slices"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/zsiec/prism/demux"
+	"github.com/zsiec/prism/webtransport"
 )
 
 // Compile-time interface check.
@@ -26,6 +29,49 @@ type VideoStats struct {
 	PTSErrors     int64   `json:"ptsErrors"`
 	TotalBytes    int64   `json:"totalBytes"`
 	Timecode      string  `json:"timecode,omitempty"`
+
+	// Discontinuities counts backward PTS jumps, such as splices, that
+	// restarted the video timeline.
+	Discontinuities int64 `json:"discontinuities"`
+
+	// AbnormalGOPs counts GOPs shorter or longer than the limits set with
+	// DemuxStats.SetGOPLimits, from an encoder sending keyframes too often
+	// or too rarely. A long GOP is counted once it passes the limit.
+	AbnormalGOPs int64 `json:"abnormalGOPs"`
+
+	// KeyframeBytes and DeltaBytes split TotalBytes by frame type, and
+	// AvgKeyframeBytes is the mean keyframe size, for sizing ABR ladders
+	// and client buffers.
+	KeyframeBytes    int64 `json:"keyframeBytes"`
+	DeltaBytes       int64 `json:"deltaBytes"`
+	AvgKeyframeBytes int64 `json:"avgKeyframeBytes"`
+
+	// ColorSpace summarizes the SPS colour description as primaries and
+	// transfer, such as "bt2020/pq" for HDR10 or "bt709/bt709" for SDR.
+	// It and the fields after it, named as in WebCodecs' VideoColorSpace
+	// so players can configure their decoder from them, are empty when
+	// the stream does not signal its colour.
+	ColorSpace     string `json:"colorSpace,omitempty"`
+	ColorPrimaries string `json:"colorPrimaries,omitempty"`
+	ColorTransfer  string `json:"colorTransfer,omitempty"`
+	ColorMatrix    string `json:"colorMatrix,omitempty"`
+	FullRange      bool   `json:"fullRange,omitempty"`
+	HDR            bool   `json:"hdr,omitempty"`
+
+	// Interlaced reports that the pic_timing SEI marks pictures as fields
+	// or as frames of two fields, and FieldRate is then the rate of
+	// fields, twice FrameRate. When each field is coded as its own
+	// picture, FrameRate counts the frames they pair into.
+	Interlaced bool    `json:"interlaced,omitempty"`
+	FieldRate  float64 `json:"fieldRate,omitempty"`
+
+	// AFD is the Active Format Description code of the latest AFD SEI
+	// and ActiveFormat describes it, such as "4:3 center"; Bars is the
+	// latest A/53 bar data. Together they tell a player how to letterbox
+	// or pillarbox the picture. Each is empty until the stream sends it.
+	AFD          int            `json:"afd,omitempty"`
+	ActiveFormat string         `json:"activeFormat,omitempty"`
+	Bars         *demux.BarData `json:"bars,omitempty"`
 }
 
 // AudioTrackStats holds per-track audio metrics for a stream.
@@ -38,12 +84,30 @@ type AudioTrackStats struct {
 	BitrateKbps float64 `json:"bitrateKbps"`
 	PTSErrors   int64   `json:"ptsErrors"`
 	TotalBytes  int64   `json:"totalBytes"`
+
+	// SkewMs is how far the track's latest PTS is ahead of the latest
+	// video PTS, negative when behind; for audio-only streams it is
+	// measured against the first audio track. OutOfSync flags a skew
+	// beyond the pipeline's threshold.
+	SkewMs    int64 `json:"skewMs"`
+	OutOfSync bool  `json:"outOfSync,omitempty"`
 }
 
 // CaptionStats tracks closed-caption activity across all channels.
 type CaptionStats struct {
 	ActiveChannels []int `json:"activeChannels"`
 	TotalFrames    int64 `json:"totalFrames"`
+
+	// Services lists the CEA-708 services seen, in service order, with
+	// the channel each is emitted on.
+	Services []CaptionServiceStats `json:"services,omitempty"`
+}
+
+// CaptionServiceStats maps a CEA-708 service number to the caption
+// channel its captions are emitted on. See demux.CaptionChannelFunc.
+type CaptionServiceStats struct {
+	Service int `json:"service"`
+	demux.CaptionChannel
 }
 
 // ViewerStats captures per-viewer delivery metrics including frame counts
@@ -57,31 +121,148 @@ type ViewerStats struct {
 	AudioDropped   int64  `json:"audioDropped"`
 	CaptionDropped int64  `json:"captionDropped"`
 	BytesSent      int64  `json:"bytesSent"`
+	WriteTimeouts  int64  `json:"writeTimeouts"`
 	LastVideoTsMS  int64  `json:"lastVideoTsMs,omitempty"`
 	LastAudioTsMS  int64  `json:"lastAudioTsMs,omitempty"`
+
+	// LastVideoGroup is the MoQ group of the most recent video frame
+	// written to this viewer, or 0 before the first.
+	LastVideoGroup uint32 `json:"lastVideoGroup,omitempty"`
+
+	// ServerLatencyMs is how long the most recent live video frame spent
+	// in the server, from reaching the demuxer to being written to this
+	// viewer's stream. It excludes network time.
+	ServerLatencyMs float64 `json:"serverLatencyMs,omitempty"`
+
+	// SkippedUntilKeyframe counts delta frames not sent because they
+	// would have started a group without a keyframe, such as those
+	// before the first keyframe or after a lost one. They are not
+	// counted in VideoDropped.
+	SkippedUntilKeyframe int64 `json:"skippedUntilKeyframe,omitempty"`
+
+	// DropRateHints counts the times this viewer's video drop rate
+	// reached the configured threshold and a lower bitrate was
+	// recommended. See MoQSessionConfig.DropRateThreshold.
+	DropRateHints int64 `json:"dropRateHints,omitempty"`
+
+	// ShedLevel is how much video is being shed to keep this viewer's
+	// audio flowing, from 0 for none to 3 for all of it, and VideoShed
+	// counts the frames shed, which are also counted in VideoDropped.
+	// See MoQSessionConfig.VideoShedding.
+	ShedLevel ShedLevel `json:"shedLevel,omitempty"`
+	VideoShed int64     `json:"videoShed,omitempty"`
+
+	// Transport is the state of the viewer's QUIC connection, the
+	// network-side view to set against the drops above, or nil when the
+	// viewer has no connection to report on.
+	Transport *TransportStats `json:"transport,omitempty"`
+}
+
+// TransportStats is the state of a viewer's QUIC connection. See
+// webtransport.ConnectionStats.
+type TransportStats struct {
+	RTTMs         float64 `json:"rttMs"`
+	SmoothedRTTMs float64 `json:"smoothedRttMs"`
+	MinRTTMs      float64 `json:"minRttMs"`
+
+	// BytesInFlight near CongestionWindow means the connection, rather
+	// than the server, limits delivery.
+	BytesInFlight    int64 `json:"bytesInFlight"`
+	CongestionWindow int64 `json:"congestionWindow"`
+	PacketsLost      int64 `json:"packetsLost"`
+}
+
+func newTransportStats(s webtransport.ConnectionStats) *TransportStats {
+	return &TransportStats{
+		RTTMs:            float64(s.LatestRTT.Microseconds()) / 1000,
+		SmoothedRTTMs:    float64(s.SmoothedRTT.Microseconds()) / 1000,
+		MinRTTMs:         float64(s.MinRTT.Microseconds()) / 1000,
+		BytesInFlight:    s.BytesInFlight,
+		CongestionWindow: s.CongestionWindow,
+		PacketsLost:      s.PacketsLost,
+	}
+}
+
+// RelaySnapshot summarizes a relay's fan-out health across all of its
+// viewers, for dashboards that render a stream from one subscription.
+type RelaySnapshot struct {
+	ViewerCount  int   `json:"viewerCount"`
+	VideoSent    int64 `json:"videoSent"`
+	AudioSent    int64 `json:"audioSent"`
+	VideoDropped int64 `json:"videoDropped"`
+	AudioDropped int64 `json:"audioDropped"`
+
+	// DropRate is the fraction of video and audio frames dropped across
+	// all viewers, from 0 to 1.
+	DropRate float64       `json:"dropRate"`
+	GOP      GOPCacheStats `json:"gop"`
+
+	// LiveGroupID is the group of the newest video frame broadcast, the
+	// live edge viewers should be delivering.
+	LiveGroupID uint32 `json:"liveGroupId"`
+
+	// CachedGroups is the number of complete or in-progress GOPs held for
+	// joining or seeking viewers: the DVR window's groups when time-shift
+	// is enabled, otherwise the single GOP cache.
+	CachedGroups int `json:"cachedGroups"`
+
+	// OldestViewerGroup is the lowest LastVideoGroup among viewers that
+	// have received video, or 0 if none have. Far behind LiveGroupID, it
+	// points at a viewer stuck on an old group.
+	OldestViewerGroup uint32 `json:"oldestViewerGroup"`
+}
+
+// GOPCacheStats describes the GOP cached for late-joining viewers.
+type GOPCacheStats struct {
+	GroupID    uint32 `json:"groupId"`
+	Frames     int    `json:"frames"`
+	Bytes      int64  `json:"bytes"`
+	DurationMs int64  `json:"durationMs"`
 }
 
 // SCTE35Stats summarizes SCTE-35 splice event activity for a stream.
 type SCTE35Stats struct {
 	TotalEvents int64               `json:"totalEvents"`
 	Recent      []demux.SCTE35Event `json:"recent,omitempty"`
+
+	// Duplicates counts repeated cues the demuxer dropped instead of
+	// recording them as new events.
+	Duplicates int64 `json:"duplicates"`
 }
 
 // StreamSnapshot is the top-level stats payload sent periodically to viewers
 // over the control stream. It aggregates video, audio, caption, SCTE-35,
 // and viewer metrics into a single JSON-serializable structure.
 type StreamSnapshot struct {
-	Timestamp   int64             `json:"ts"`
-	UptimeMs    int64             `json:"uptimeMs"`
-	Protocol    string            `json:"protocol"`
-	IngestBytes int64             `json:"ingestBytes"`
-	IngestKbps  float64           `json:"ingestKbps"`
-	Video       VideoStats        `json:"video"`
-	Audio       []AudioTrackStats `json:"audio"`
-	Captions    CaptionStats      `json:"captions"`
-	SCTE35      SCTE35Stats       `json:"scte35"`
-	ViewerCount int               `json:"viewerCount"`
-	Viewers     []ViewerStats     `json:"viewers,omitempty"`
+	Timestamp      int64             `json:"ts"`
+	UptimeMs       int64             `json:"uptimeMs"`
+	Protocol       string            `json:"protocol"`
+	IngestBytes    int64             `json:"ingestBytes"`
+	IngestKbps     float64           `json:"ingestKbps"`
+	IngestHealth   string            `json:"ingestHealth,omitempty"`
+	IngestBreaches int64             `json:"ingestBreaches,omitempty"`
+	HasVideo       bool              `json:"hasVideo"`
+	Video          VideoStats        `json:"video"`
+	Audio          []AudioTrackStats `json:"audio"`
+	Captions       CaptionStats      `json:"captions"`
+	SCTE35         SCTE35Stats       `json:"scte35"`
+	ViewerCount    int               `json:"viewerCount"`
+	Viewers        []ViewerStats     `json:"viewers,omitempty"`
+
+	// ConditionalAccess reports that the PMT declares the program or one
+	// of its streams scrambled by a CA system: the feed is DRM protected,
+	// which explains video and audio that never decode.
+	ConditionalAccess bool `json:"conditionalAccess,omitempty"`
+
+	// InAdBreak reports whether SCTE-35 cues place the stream inside an
+	// ad break at its current PTS. AdBreakRemainingMs is the time left
+	// until the break is due to end, or 0 if its cue gave no duration.
+	InAdBreak          bool  `json:"inAdBreak"`
+	AdBreakRemainingMs int64 `json:"adBreakRemainingMs,omitempty"`
+
+	// AudioSkewMs is the widest gap between the latest PTS of any two
+	// audio tracks, 0 with fewer than two.
+	AudioSkewMs int64 `json:"audioSkewMs"`
 }
 
 // PTSWrapEvent records a detected PTS wrap-around, which occurs when the
@@ -104,6 +285,35 @@ type PTSDebugStats struct {
 	VideoPTSWraps int64          `json:"videoPTSWraps"`
 	AudioPTSWraps int64          `json:"audioPTSWraps"`
 	RecentWraps   []PTSWrapEvent `json:"recentWraps,omitempty"`
+
+	// CorruptPackets counts TS packets the demuxer skipped as malformed.
+	CorruptPackets int64 `json:"corruptPackets"`
+
+	// ReorderedPackets counts TS packets that arrived out of order and
+	// were put back in order by the reorder window.
+	ReorderedPackets int64 `json:"reorderedPackets"`
+
+	// UnsupportedStreamTypes lists the PMT stream types the demuxer
+	// ignores, such as 0x03 for MPEG-1 audio, explaining tracks that never
+	// appear.
+	UnsupportedStreamTypes StreamTypes `json:"unsupportedStreamTypes,omitempty"`
+
+	// PacketSize is the TS packet size detected at the start of the
+	// stream: 188, 192 for M2TS or 204 with Reed-Solomon parity.
+	PacketSize int `json:"packetSize,omitempty"`
+}
+
+// StreamTypes is a list of MPEG-TS stream types that encodes to JSON as
+// an array of numbers.
+type StreamTypes []uint8
+
+// MarshalJSON implements json.Marshaler.
+func (t StreamTypes) MarshalJSON() ([]byte, error) {
+	ints := make([]int, len(t))
+	for i, v := range t {
+		ints[i] = int(v)
+	}
+	return json.Marshal(ints)
 }
 
 // DemuxStats accumulates stream telemetry from the demuxer in a
@@ -120,12 +330,17 @@ type PTSDebugStats struct {
 //   - bitrateWindowMu: video bitrate sliding window
 //   - fpsWindowMu: video FPS sliding window
 //   - videoCodecMu: video codec label
+//   - colorimetryMu: VUI colour description
+//   - activeFormatMu: AFD and bar data
+//   - streamTypesMu: unsupported stream types
 type DemuxStats struct {
 	// Atomic counters — no mutex needed
 	videoFrames    atomic.Int64
 	videoKeyframes atomic.Int64
 	videoDelta     atomic.Int64
 	videoBytes     atomic.Int64
+	keyframeBytes  atomic.Int64
+	deltaBytes     atomic.Int64
 	currentGOPLen  atomic.Int32
 	lastVideoPTS   atomic.Int64
 	ptsErrors      atomic.Int64
@@ -135,10 +350,24 @@ type DemuxStats struct {
 	firstAudioPTS  atomic.Int64
 	videoPTSWraps  atomic.Int64
 	audioPTSWraps  atomic.Int64
+	corruptPackets atomic.Int64
+	reordered      atomic.Int64
+	discontinuity  atomic.Int64
 	firstVideoSet  atomic.Bool
 	firstAudioSet  atomic.Bool
 	captionCount   atomic.Int64
 	scte35Total    atomic.Int64
+	scte35Dups     atomic.Int64
+	noVideo        atomic.Bool
+	scrambled      atomic.Bool
+	picStruct      atomic.Uint32
+	packetSize     atomic.Int32
+
+	// gopMin and gopMax are the GOP length limits in frames, zero when
+	// unset; abnormalGOPs counts GOPs outside them.
+	gopMin       atomic.Int32
+	gopMax       atomic.Int32
+	abnormalGOPs atomic.Int64
 
 	// ptsWrapMu guards ptsWrapLog
 	ptsWrapMu  sync.Mutex
@@ -148,10 +377,11 @@ type DemuxStats struct {
 	timecodeMu sync.RWMutex
 	timecode   string
 
-	// mu guards audioStats and captionChans
+	// mu guards audioStats, captionChans and captionSvcs
 	mu           sync.RWMutex
 	audioStats   map[int]*audioTrackAccum
 	captionChans map[int]bool
+	captionSvcs  map[int]demux.CaptionChannel
 
 	// scte35Mu guards scte35Events
 	scte35Mu     sync.RWMutex
@@ -168,6 +398,20 @@ type DemuxStats struct {
 	// videoCodecMu guards videoCodec
 	videoCodecMu sync.RWMutex
 	videoCodec   string
+
+	// colorimetryMu guards colorimetry
+	colorimetryMu sync.RWMutex
+	colorimetry   demux.Colorimetry
+
+	// activeFormatMu guards afd and bars; afd is nil until an AFD SEI
+	// arrives, as is bars until bar data does.
+	activeFormatMu sync.RWMutex
+	afd            *demux.AFD
+	bars           *demux.BarData
+
+	// streamTypesMu guards unsupportedTypes
+	streamTypesMu    sync.Mutex
+	unsupportedTypes StreamTypes
 }
 
 // audioTrackAccum is a per-track accumulator for audio frame statistics,
@@ -191,9 +435,18 @@ func NewDemuxStats() *DemuxStats {
 	return &DemuxStats{
 		audioStats:   make(map[int]*audioTrackAccum),
 		captionChans: make(map[int]bool),
+		captionSvcs:  make(map[int]demux.CaptionChannel),
 	}
 }
 
+// SetGOPLimits sets the shortest and longest GOP, in frames, counted as
+// normal in VideoStats.AbnormalGOPs. A limit of zero or less is not
+// checked.
+func (ds *DemuxStats) SetGOPLimits(minFrames, maxFrames int) {
+	ds.gopMin.Store(int32(max(minFrames, 0)))
+	ds.gopMax.Store(int32(max(maxFrames, 0)))
+}
+
 // RecordVideoFrame records a video frame's size, type, and PTS, updating
 // frame counters, GOP length, bitrate/FPS sliding windows, and PTS continuity.
 func (ds *DemuxStats) RecordVideoFrame(bytes int64, isKeyframe bool, pts int64) {
@@ -206,11 +459,19 @@ func (ds *DemuxStats) RecordVideoFrame(bytes int64, isKeyframe bool, pts int64)
 	}
 
 	if isKeyframe {
-		ds.videoKeyframes.Add(1)
-		ds.currentGOPLen.Store(1)
+		// The GOP this keyframe closes is judged unless it is the partial
+		// one before the first keyframe.
+		prevLen := ds.currentGOPLen.Swap(1)
+		if ds.videoKeyframes.Add(1) > 1 && prevLen < ds.gopMin.Load() {
+			ds.abnormalGOPs.Add(1)
+		}
+		ds.keyframeBytes.Add(bytes)
 	} else {
 		ds.videoDelta.Add(1)
-		ds.currentGOPLen.Add(1)
+		ds.deltaBytes.Add(bytes)
+		if n, hi := ds.currentGOPLen.Add(1), ds.gopMax.Load(); hi > 0 && n == hi+1 {
+			ds.abnormalGOPs.Add(1)
+		}
 	}
 
 	lastPTS := ds.lastVideoPTS.Swap(pts)
@@ -280,6 +541,24 @@ func (ds *DemuxStats) RecordAudioFrame(trackIdx int, bytes int64, pts int64, sam
 	}
 }
 
+// RecordVideoPTSReset starts a new video PTS baseline after the source
+// signaled a discontinuity, so the jump to the next frame's PTS is not
+// counted as an error or wrap.
+func (ds *DemuxStats) RecordVideoPTSReset() {
+	ds.lastVideoPTS.Store(0)
+}
+
+// RecordAudioPTSReset starts a new PTS baseline for an audio track, as
+// RecordVideoPTSReset does for video.
+func (ds *DemuxStats) RecordAudioPTSReset(trackIdx int) {
+	ds.mu.RLock()
+	acc := ds.audioStats[trackIdx]
+	ds.mu.RUnlock()
+	if acc != nil {
+		acc.LastPTS.Store(0)
+	}
+}
+
 const maxPTSWrapLog = 10
 
 func (ds *DemuxStats) recordPTSWrap(track string, oldPTS, newPTS int64) {
@@ -298,6 +577,43 @@ func (ds *DemuxStats) recordPTSWrap(track string, oldPTS, newPTS int64) {
 	ds.ptsWrapMu.Unlock()
 }
 
+// RecordCorruptPacket counts a TS packet the demuxer skipped as malformed.
+func (ds *DemuxStats) RecordCorruptPacket() {
+	ds.corruptPackets.Add(1)
+}
+
+// RecordReorderedPacket counts a TS packet the demuxer's reorder window
+// put back in order.
+func (ds *DemuxStats) RecordReorderedPacket() {
+	ds.reordered.Add(1)
+}
+
+// RecordDiscontinuity counts a backward video PTS jump the demuxer
+// treated as a splice.
+func (ds *DemuxStats) RecordDiscontinuity() {
+	ds.discontinuity.Add(1)
+}
+
+// RecordUnsupportedStreamType records a PMT stream type the demuxer
+// ignores. The demuxer reports each type once.
+func (ds *DemuxStats) RecordUnsupportedStreamType(streamType uint8) {
+	ds.streamTypesMu.Lock()
+	ds.unsupportedTypes = append(ds.unsupportedTypes, streamType)
+	ds.streamTypesMu.Unlock()
+}
+
+// RecordConditionalAccess records a CA system the PMT declares
+// scrambling the program or one of its streams.
+func (ds *DemuxStats) RecordConditionalAccess(uint16) {
+	ds.scrambled.Store(true)
+}
+
+// ConditionalAccess reports whether the PMT declared conditional access,
+// meaning the stream is DRM protected and cannot be played.
+func (ds *DemuxStats) ConditionalAccess() bool {
+	return ds.scrambled.Load()
+}
+
 // PTSDebug returns a snapshot of PTS debugging information.
 func (ds *DemuxStats) PTSDebug() PTSDebugStats {
 	ds.ptsWrapMu.Lock()
@@ -305,6 +621,10 @@ func (ds *DemuxStats) PTSDebug() PTSDebugStats {
 	copy(wraps, ds.ptsWrapLog)
 	ds.ptsWrapMu.Unlock()
 
+	ds.streamTypesMu.Lock()
+	unsupported := slices.Clone(ds.unsupportedTypes)
+	ds.streamTypesMu.Unlock()
+
 	lastAudioPTS := int64(0)
 	ds.mu.RLock()
 	for _, acc := range ds.audioStats {
@@ -316,16 +636,27 @@ func (ds *DemuxStats) PTSDebug() PTSDebugStats {
 	ds.mu.RUnlock()
 
 	return PTSDebugStats{
-		FirstVideoPTS: ds.firstVideoPTS.Load(),
-		FirstAudioPTS: ds.firstAudioPTS.Load(),
-		LastVideoPTS:  ds.lastVideoPTS.Load(),
-		LastAudioPTS:  lastAudioPTS,
-		VideoPTSWraps: ds.videoPTSWraps.Load(),
-		AudioPTSWraps: ds.audioPTSWraps.Load(),
-		RecentWraps:   wraps,
+		FirstVideoPTS:  ds.firstVideoPTS.Load(),
+		FirstAudioPTS:  ds.firstAudioPTS.Load(),
+		LastVideoPTS:   ds.lastVideoPTS.Load(),
+		LastAudioPTS:   lastAudioPTS,
+		VideoPTSWraps:  ds.videoPTSWraps.Load(),
+		AudioPTSWraps:  ds.audioPTSWraps.Load(),
+		RecentWraps:    wraps,
+		CorruptPackets: ds.corruptPackets.Load(),
+
+		ReorderedPackets:       ds.reordered.Load(),
+		UnsupportedStreamTypes: unsupported,
+		PacketSize:             int(ds.packetSize.Load()),
 	}
 }
 
+// RecordPacketSize records the TS packet size detected at the start of
+// the stream.
+func (ds *DemuxStats) RecordPacketSize(size int) {
+	ds.packetSize.Store(int32(size))
+}
+
 // RecordVideoCodec stores the detected video codec label (e.g. "H.264", "H.265").
 func (ds *DemuxStats) RecordVideoCodec(codec string) {
 	ds.videoCodecMu.Lock()
@@ -333,12 +664,49 @@ func (ds *DemuxStats) RecordVideoCodec(codec string) {
 	ds.videoCodecMu.Unlock()
 }
 
+// RecordHasVideo records whether the PMT declared a video stream.
+func (ds *DemuxStats) RecordHasVideo(hasVideo bool) {
+	ds.noVideo.Store(!hasVideo)
+}
+
+// HasVideo reports whether the stream carries video. It returns true until
+// the demuxer reports an audio-only PMT.
+func (ds *DemuxStats) HasVideo() bool {
+	return !ds.noVideo.Load()
+}
+
 // RecordResolution stores the detected video resolution from an SPS.
 func (ds *DemuxStats) RecordResolution(width, height int) {
 	ds.videoWidth.Store(int32(width))
 	ds.videoHeight.Store(int32(height))
 }
 
+// RecordColorimetry stores the video colour description from an SPS.
+func (ds *DemuxStats) RecordColorimetry(c demux.Colorimetry) {
+	ds.colorimetryMu.Lock()
+	ds.colorimetry = c
+	ds.colorimetryMu.Unlock()
+}
+
+// RecordPicStruct stores the pic_struct of the latest pic_timing SEI.
+func (ds *DemuxStats) RecordPicStruct(ps demux.PicStruct) {
+	ds.picStruct.Store(uint32(ps))
+}
+
+// RecordAFD stores the active format of the latest AFD SEI.
+func (ds *DemuxStats) RecordAFD(afd demux.AFD) {
+	ds.activeFormatMu.Lock()
+	ds.afd = &afd
+	ds.activeFormatMu.Unlock()
+}
+
+// RecordBarData stores the latest A/53 bar data.
+func (ds *DemuxStats) RecordBarData(bars demux.BarData) {
+	ds.activeFormatMu.Lock()
+	ds.bars = &bars
+	ds.activeFormatMu.Unlock()
+}
+
 // RecordTimecode stores the latest SMPTE 12M timecode string.
 func (ds *DemuxStats) RecordTimecode(tc string) {
 	ds.timecodeMu.Lock()
@@ -350,7 +718,9 @@ const maxRecentSCTE35 = 20
 const scte35ExpirySec = 30
 
 // RecordSCTE35 records a SCTE-35 event, maintaining a bounded recent-events window.
+// The raw section is dropped to keep the stats payload small.
 func (ds *DemuxStats) RecordSCTE35(event demux.SCTE35Event) {
+	event.Section = nil
 	ds.scte35Total.Add(1)
 	ds.scte35Mu.Lock()
 	ds.scte35Events = append(ds.scte35Events, event)
@@ -360,6 +730,11 @@ func (ds *DemuxStats) RecordSCTE35(event demux.SCTE35Event) {
 	ds.scte35Mu.Unlock()
 }
 
+// RecordDuplicateSCTE35 counts a repeated SCTE-35 cue the demuxer dropped.
+func (ds *DemuxStats) RecordDuplicateSCTE35() {
+	ds.scte35Dups.Add(1)
+}
+
 // RecordCaption records a caption frame on the given channel.
 func (ds *DemuxStats) RecordCaption(channel int) {
 	ds.captionCount.Add(1)
@@ -368,6 +743,14 @@ func (ds *DemuxStats) RecordCaption(channel int) {
 	ds.mu.Unlock()
 }
 
+// RecordCaptionService records the caption channel a CEA-708 service's
+// captions are emitted on.
+func (ds *DemuxStats) RecordCaptionService(service int, ch demux.CaptionChannel) {
+	ds.mu.Lock()
+	ds.captionSvcs[service] = ch
+	ds.mu.Unlock()
+}
+
 // VideoFPS computes the current frame rate from a 2-second sliding window.
 func (ds *DemuxStats) VideoFPS() float64 {
 	ds.fpsWindowMu.Lock()
@@ -422,7 +805,7 @@ func (ds *DemuxStats) Snapshot() (VideoStats, []AudioTrackStats, CaptionStats, S
 	ds.videoCodecMu.RLock()
 	codecLabel := ds.videoCodec
 	ds.videoCodecMu.RUnlock()
-	if codecLabel == "" {
+	if codecLabel == "" && ds.HasVideo() {
 		codecLabel = "H.264"
 	}
 
@@ -439,8 +822,49 @@ func (ds *DemuxStats) Snapshot() (VideoStats, []AudioTrackStats, CaptionStats, S
 		PTSErrors:     ds.ptsErrors.Load(),
 		TotalBytes:    ds.videoBytes.Load(),
 		Timecode:      tc,
+
+		Discontinuities: ds.discontinuity.Load(),
+		AbnormalGOPs:    ds.abnormalGOPs.Load(),
+
+		KeyframeBytes: ds.keyframeBytes.Load(),
+		DeltaBytes:    ds.deltaBytes.Load(),
+	}
+	if vs.KeyFrames > 0 {
+		vs.AvgKeyframeBytes = vs.KeyframeBytes / vs.KeyFrames
+	}
+	if ps := demux.PicStruct(ds.picStruct.Load()); ps.Interlaced() {
+		// Field pictures arrive one per access unit, so the measured
+		// rate is already the field rate.
+		if ps.Field() {
+			vs.FrameRate = fps / 2
+		}
+		vs.Interlaced = true
+		vs.FieldRate = vs.FrameRate * 2
+	}
+
+	ds.colorimetryMu.RLock()
+	color := ds.colorimetry
+	ds.colorimetryMu.RUnlock()
+	if color.Known() {
+		vs.ColorSpace = color.String()
+		vs.ColorPrimaries = color.PrimariesName()
+		vs.ColorTransfer = color.TransferName()
+		vs.ColorMatrix = color.MatrixName()
+		vs.FullRange = color.FullRange
+		vs.HDR = color.HDR()
 	}
 
+	ds.activeFormatMu.RLock()
+	if ds.afd != nil {
+		vs.AFD = int(*ds.afd)
+		vs.ActiveFormat = ds.afd.String()
+	}
+	if ds.bars != nil {
+		bars := *ds.bars
+		vs.Bars = &bars
+	}
+	ds.activeFormatMu.RUnlock()
+
 	ds.mu.RLock()
 	audioTracks := make([]AudioTrackStats, 0, len(ds.audioStats))
 	for idx, acc := range ds.audioStats {
@@ -469,11 +893,17 @@ func (ds *DemuxStats) Snapshot() (VideoStats, []AudioTrackStats, CaptionStats, S
 	for ch := range ds.captionChans {
 		activeChans = append(activeChans, ch)
 	}
+	var services []CaptionServiceStats
+	for svc, ch := range ds.captionSvcs {
+		services = append(services, CaptionServiceStats{Service: svc, CaptionChannel: ch})
+	}
 	ds.mu.RUnlock()
+	slices.SortFunc(services, func(a, b CaptionServiceStats) int { return a.Service - b.Service })
 
 	cs := CaptionStats{
 		ActiveChannels: activeChans,
 		TotalFrames:    ds.captionCount.Load(),
+		Services:       services,
 	}
 
 	ds.scte35Mu.RLock()
@@ -489,6 +919,7 @@ func (ds *DemuxStats) Snapshot() (VideoStats, []AudioTrackStats, CaptionStats, S
 	sc := SCTE35Stats{
 		TotalEvents: ds.scte35Total.Load(),
 		Recent:      recent,
+		Duplicates:  ds.scte35Dups.Load(),
 	}
 
 	return vs, audioTracks, cs, sc
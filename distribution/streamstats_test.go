@@ -1,8 +1,15 @@
 package distribution
 
 import (
+	"encoding/json"
+	"math"
+	"slices"
+	"strings"
 	"sync"
 	"testing"
+	"time"
+
+	"github.com/zsiec/prism/demux"
 )
 
 func TestDemuxStatsRecordVideoFrame(t *testing.T) {
@@ -45,6 +52,92 @@ func TestDemuxStatsRecordVideoFrameGOPReset(t *testing.T) {
 	}
 }
 
+func TestDemuxStatsAbnormalGOPs(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		min, max int
+		frames   []bool // keyframe, per frame
+		want     int64
+	}{
+		{
+			name:   "all keyframes",
+			min:    2,
+			frames: []bool{true, true, true, true, true},
+			want:   4,
+		},
+		{
+			name:   "all keyframes without limits",
+			frames: []bool{true, true, true, true, true},
+		},
+		{
+			name:   "partial GOP before first keyframe",
+			min:    3,
+			frames: []bool{false, true, false, false, true},
+		},
+		{
+			name:   "long GOP counted once",
+			max:    3,
+			frames: []bool{true, false, false, false, false, false, true, false},
+			want:   1,
+		},
+		{
+			name:   "never a keyframe",
+			max:    3,
+			frames: []bool{false, false, false, false, false},
+			want:   1,
+		},
+		{
+			name:   "within limits",
+			min:    2,
+			max:    3,
+			frames: []bool{true, false, true, false, false, true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			ds := NewDemuxStats()
+			ds.SetGOPLimits(tt.min, tt.max)
+			for i, key := range tt.frames {
+				ds.RecordVideoFrame(1000, key, int64(90000+i*3000))
+			}
+			vs, _, _, _ := ds.Snapshot()
+			if vs.AbnormalGOPs != tt.want {
+				t.Errorf("AbnormalGOPs = %d, want %d", vs.AbnormalGOPs, tt.want)
+			}
+		})
+	}
+}
+
+func TestDemuxStatsFrameTypeBytes(t *testing.T) {
+	t.Parallel()
+
+	ds := NewDemuxStats()
+
+	ds.RecordVideoFrame(4000, true, 90000)
+	ds.RecordVideoFrame(300, false, 93000)
+	ds.RecordVideoFrame(500, false, 96000)
+	ds.RecordVideoFrame(400, false, 99000)
+	ds.RecordVideoFrame(6000, true, 102000)
+
+	vs, _, _, _ := ds.Snapshot()
+	if vs.KeyframeBytes != 10000 {
+		t.Errorf("KeyframeBytes = %d, want 10000", vs.KeyframeBytes)
+	}
+	if vs.DeltaBytes != 1200 {
+		t.Errorf("DeltaBytes = %d, want 1200", vs.DeltaBytes)
+	}
+	if vs.KeyframeBytes+vs.DeltaBytes != vs.TotalBytes {
+		t.Errorf("KeyframeBytes + DeltaBytes = %d, want TotalBytes %d", vs.KeyframeBytes+vs.DeltaBytes, vs.TotalBytes)
+	}
+	if vs.AvgKeyframeBytes != 5000 {
+		t.Errorf("AvgKeyframeBytes = %d, want 5000", vs.AvgKeyframeBytes)
+	}
+}
+
 func TestDemuxStatsRecordAudioFrame(t *testing.T) {
 	t.Parallel()
 
@@ -90,6 +183,35 @@ func TestDemuxStatsRecordCaption(t *testing.T) {
 	if len(cs.ActiveChannels) != 2 {
 		t.Fatalf("ActiveChannels = %d, want 2", len(cs.ActiveChannels))
 	}
+	if cs.Services != nil {
+		t.Fatalf("Services = %+v without CEA-708 captions, want none", cs.Services)
+	}
+}
+
+func TestDemuxStatsRecordCaptionService(t *testing.T) {
+	t.Parallel()
+
+	ds := NewDemuxStats()
+	ds.RecordCaptionService(2, demux.CaptionChannel{Channel: 8, Label: "Spanish"})
+	ds.RecordCaptionService(1, demux.DefaultCaptionChannel(1))
+	ds.RecordCaptionService(1, demux.DefaultCaptionChannel(1))
+
+	_, _, cs, _ := ds.Snapshot()
+	want := []CaptionServiceStats{
+		{Service: 1, CaptionChannel: demux.CaptionChannel{Channel: 7, Label: "Service 1"}},
+		{Service: 2, CaptionChannel: demux.CaptionChannel{Channel: 8, Label: "Spanish"}},
+	}
+	if !slices.Equal(cs.Services, want) {
+		t.Errorf("Services = %+v, want %+v", cs.Services, want)
+	}
+
+	data, err := json.Marshal(cs.Services[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(data); got != `{"service":1,"channel":7,"label":"Service 1"}` {
+		t.Errorf("JSON = %s", got)
+	}
 }
 
 func TestDemuxStatsRecordResolution(t *testing.T) {
@@ -161,6 +283,48 @@ func TestDemuxStatsPTSWrap(t *testing.T) {
 	}
 }
 
+func TestDemuxStatsCorruptPackets(t *testing.T) {
+	t.Parallel()
+
+	ds := NewDemuxStats()
+	ds.RecordCorruptPacket()
+	ds.RecordCorruptPacket()
+
+	if got := ds.PTSDebug().CorruptPackets; got != 2 {
+		t.Fatalf("CorruptPackets = %d, want 2", got)
+	}
+}
+
+func TestDemuxStatsDiscontinuities(t *testing.T) {
+	t.Parallel()
+
+	ds := NewDemuxStats()
+	ds.RecordDiscontinuity()
+
+	if vs, _, _, _ := ds.Snapshot(); vs.Discontinuities != 1 {
+		t.Fatalf("Discontinuities = %d, want 1", vs.Discontinuities)
+	}
+}
+
+func TestDemuxStatsUnsupportedStreamTypes(t *testing.T) {
+	t.Parallel()
+
+	ds := NewDemuxStats()
+	if data, _ := json.Marshal(ds.PTSDebug()); strings.Contains(string(data), "unsupportedStreamTypes") {
+		t.Errorf("unsupportedStreamTypes present with none recorded: %s", data)
+	}
+
+	ds.RecordUnsupportedStreamType(0x03)
+	ds.RecordUnsupportedStreamType(0x06)
+	data, err := json.Marshal(ds.PTSDebug())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"unsupportedStreamTypes":[3,6]`) {
+		t.Errorf("PTSDebug JSON = %s, want unsupportedStreamTypes [3,6]", data)
+	}
+}
+
 func TestDemuxStatsConcurrentAccess(t *testing.T) {
 	t.Parallel()
 
@@ -219,3 +383,135 @@ func TestDemuxStatsFirstPTS(t *testing.T) {
 		t.Fatalf("LastVideoPTS = %d, want 93000", debug.LastVideoPTS)
 	}
 }
+
+func TestDemuxStatsPTSReset(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		reset         bool
+		wantPTSErrors int64
+	}{
+		{"jump counted as an error", false, 1},
+		{"signaled discontinuity", true, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			ds := NewDemuxStats()
+			ds.RecordVideoFrame(1000, true, 10_000_000)
+			ds.RecordAudioFrame(0, 200, 10_000_000, 48000, 2)
+			if tt.reset {
+				ds.RecordVideoPTSReset()
+				ds.RecordAudioPTSReset(0)
+				ds.RecordAudioPTSReset(5) // unknown track: ignored
+			}
+			ds.RecordVideoFrame(1000, true, 100_000_000)
+			ds.RecordAudioFrame(0, 200, 100_000_000, 48000, 2)
+
+			video, audio, _, _ := ds.Snapshot()
+			if video.PTSErrors != tt.wantPTSErrors {
+				t.Errorf("video PTSErrors = %d, want %d", video.PTSErrors, tt.wantPTSErrors)
+			}
+			if audio[0].PTSErrors != tt.wantPTSErrors {
+				t.Errorf("audio PTSErrors = %d, want %d", audio[0].PTSErrors, tt.wantPTSErrors)
+			}
+		})
+	}
+}
+
+func TestDemuxStatsRecordColorimetry(t *testing.T) {
+	t.Parallel()
+
+	ds := NewDemuxStats()
+	vs, _, _, _ := ds.Snapshot()
+	if vs.ColorSpace != "" || vs.HDR {
+		t.Fatalf("before an SPS: ColorSpace %q, HDR %v; want empty", vs.ColorSpace, vs.HDR)
+	}
+
+	ds.RecordColorimetry(demux.Colorimetry{Primaries: 9, Transfer: 16, Matrix: 9})
+	vs, _, _, _ = ds.Snapshot()
+	if vs.ColorSpace != "bt2020/pq" || vs.ColorPrimaries != "bt2020" || vs.ColorTransfer != "pq" ||
+		vs.ColorMatrix != "bt2020-ncl" || vs.FullRange || !vs.HDR {
+		t.Errorf("HDR10: %q, %q, %q, %q, full range %v, HDR %v", vs.ColorSpace, vs.ColorPrimaries,
+			vs.ColorTransfer, vs.ColorMatrix, vs.FullRange, vs.HDR)
+	}
+
+	// An SPS without a colour description clears it.
+	ds.RecordColorimetry(demux.Colorimetry{})
+	if vs, _, _, _ = ds.Snapshot(); vs.ColorSpace != "" {
+		t.Errorf("after SPS without colour: ColorSpace = %q, want empty", vs.ColorSpace)
+	}
+}
+
+func TestDemuxStatsRecordActiveFormat(t *testing.T) {
+	t.Parallel()
+
+	ds := NewDemuxStats()
+	vs, _, _, _ := ds.Snapshot()
+	if vs.AFD != 0 || vs.ActiveFormat != "" || vs.Bars != nil {
+		t.Fatalf("before any SEI: AFD %d %q, bars %v; want empty", vs.AFD, vs.ActiveFormat, vs.Bars)
+	}
+
+	bars := demux.BarData{TopEnd: -1, BottomStart: -1, LeftEnd: 239, RightStart: 1680}
+	ds.RecordAFD(demux.AFD4x3Center)
+	ds.RecordBarData(bars)
+	vs, _, _, _ = ds.Snapshot()
+	if vs.AFD != 9 || vs.ActiveFormat != "4:3 center" {
+		t.Errorf("AFD = %d %q, want 9 \"4:3 center\"", vs.AFD, vs.ActiveFormat)
+	}
+	if vs.Bars == nil || *vs.Bars != bars {
+		t.Errorf("Bars = %+v, want %+v", vs.Bars, bars)
+	}
+}
+
+func TestDemuxStatsInterlaced(t *testing.T) {
+	t.Parallel()
+
+	// pic_timing SEIs, without HRD delays, of a field picture and of a
+	// two-field frame.
+	sps := demux.SPSInfo{PicStructPresent: true}
+	topField := []byte{0x06, 0x01, 0x01, 0x10, 0x80}
+	topBottom := []byte{0x06, 0x01, 0x01, 0x30, 0x80}
+
+	tests := []struct {
+		name          string
+		sei           []byte
+		wantFrameRate float64
+		wantFieldRate float64
+	}{
+		{"progressive", nil, 60, 0},
+		{"field pictures", topField, 30, 60},
+		{"interlaced frames", topBottom, 60, 120},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			ds := NewDemuxStats()
+			// 60 pictures a second.
+			start := time.Now()
+			for i := range 61 {
+				ds.fpsWindow = append(ds.fpsWindow, start.Add(time.Duration(i)*time.Second/60))
+			}
+			if tt.sei != nil {
+				ps, ok := demux.ParsePicStruct(tt.sei, sps)
+				if !ok {
+					t.Fatal("ParsePicStruct failed")
+				}
+				ds.RecordPicStruct(ps)
+			}
+
+			vs, _, _, _ := ds.Snapshot()
+			if vs.Interlaced != (tt.wantFieldRate > 0) {
+				t.Errorf("Interlaced = %v, want %v", vs.Interlaced, tt.wantFieldRate > 0)
+			}
+			if math.Abs(vs.FrameRate-tt.wantFrameRate) > 0.01 {
+				t.Errorf("FrameRate = %.2f, want %v", vs.FrameRate, tt.wantFrameRate)
+			}
+			if math.Abs(vs.FieldRate-tt.wantFieldRate) > 0.01 {
+				t.Errorf("FieldRate = %.2f, want %v", vs.FieldRate, tt.wantFieldRate)
+			}
+		})
+	}
+}
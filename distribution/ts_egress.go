@@ -0,0 +1,299 @@
+package distribution
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/zsiec/prism/demux"
+	"github.com/zsiec/prism/media"
+	"github.com/zsiec/prism/mpegts"
+)
+
+// PIDs of the program written by the live TS egress.
+const (
+	tsVideoPID uint16 = 0x100
+	tsAudioPID uint16 = 0x101
+)
+
+// Access unit delimiters prefixed to every TS video access unit, which
+// H.264 and H.265 in MPEG-TS require. The demuxer strips the source's.
+var (
+	audH264 = []byte{0, 0, 0, 1, 0x09, 0xF0}
+	audH265 = []byte{0, 0, 0, 1, 0x46, 0x01, 0x50}
+)
+
+// tsViewer is a Viewer that re-muxes a relay's video and first audio track
+// into a continuous MPEG-TS byte stream, for tools that cannot speak MoQ.
+// Frames are queued by the relay and written by run; like a MoQ viewer, a
+// slow reader loses frames rather than stalling the relay.
+type tsViewer struct {
+	id      string
+	videoCh chan *media.VideoFrame
+	audioCh chan *media.AudioFrame
+
+	damagedGroup   atomic.Uint32
+	lastVideoGroup atomic.Uint32
+	videoSent      atomic.Int64
+	audioSent      atomic.Int64
+	videoDropped   atomic.Int64
+	audioDropped   atomic.Int64
+	bytesSent      atomic.Int64
+}
+
+func newTSViewer(id string) *tsViewer {
+	return &tsViewer{
+		id:      id,
+		videoCh: make(chan *media.VideoFrame, media.VideoBufferSize),
+		audioCh: make(chan *media.AudioFrame, media.AudioBufferSize),
+	}
+}
+
+func (v *tsViewer) ID() string { return v.id }
+
+func (v *tsViewer) SendVideo(frame *media.VideoFrame) {
+	trySendVideo(frame, v.videoCh, &v.damagedGroup, &v.videoSent, &v.videoDropped)
+}
+
+// SendAudio queues frames of the first audio track; the egress program
+// carries no others.
+func (v *tsViewer) SendAudio(frame *media.AudioFrame) {
+	if frame.TrackIndex != 0 {
+		return
+	}
+	select {
+	case v.audioCh <- frame:
+		v.audioSent.Add(1)
+	default:
+		v.audioDropped.Add(1)
+	}
+}
+
+// SendCaptions is a no-op: captions stay in the video SEI, which is
+// forwarded unchanged.
+func (v *tsViewer) SendCaptions(*media.CaptionFrame) {}
+
+// SendSCTE35 is a no-op: the egress program has no SCTE-35 stream.
+func (v *tsViewer) SendSCTE35(*demux.SCTE35Event) {}
+
+func (v *tsViewer) Stats() ViewerStats {
+	return ViewerStats{
+		ID:             v.id,
+		VideoSent:      v.videoSent.Load(),
+		AudioSent:      v.audioSent.Load(),
+		VideoDropped:   v.videoDropped.Load(),
+		AudioDropped:   v.audioDropped.Load(),
+		BytesSent:      v.bytesSent.Load(),
+		LastVideoGroup: v.lastVideoGroup.Load(),
+	}
+}
+
+// run muxes queued frames to w until ctx is done or a write fails, calling
+// flush after each access unit. Output opens with PAT/PMT at the first
+// keyframe, and they are repeated before every keyframe after it; frames
+// queued before the first keyframe are discarded. The PMT declares the
+// audio codec last seen; if audio arrives in another codec, it is dropped
+// until the next keyframe restarts the program with the new one.
+func (v *tsViewer) run(ctx context.Context, w io.Writer, flush func() error) error {
+	w = &countingWriter{w: w, n: &v.bytesSent}
+	var mux *mpegts.Muxer
+	audioType := mpegts.StreamTypeAAC
+	muxAudioType := audioType
+	for {
+		var err error
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case frame := <-v.videoCh:
+			if mux == nil || frame.IsKeyframe && audioType != muxAudioType {
+				if !frame.IsKeyframe {
+					continue
+				}
+				videoType := mpegts.StreamTypeH264
+				if frame.Codec == "h265" {
+					videoType = mpegts.StreamTypeH265
+				}
+				mux = mpegts.NewMuxer(w,
+					mpegts.MuxStream{PID: tsVideoPID, StreamType: videoType},
+					mpegts.MuxStream{PID: tsAudioPID, StreamType: audioType})
+				muxAudioType = audioType
+			}
+			if frame.IsKeyframe {
+				if err := mux.WritePSI(); err != nil {
+					return fmt.Errorf("write PSI: %w", err)
+				}
+			}
+			pts, dts := videoTicks(frame)
+			err = mux.WriteAccessUnit(tsVideoPID, pts, dts, frame.IsKeyframe, tsAccessUnit(frame))
+			if err == nil {
+				v.lastVideoGroup.Store(frame.GroupID)
+			}
+
+		case frame := <-v.audioCh:
+			audioType = tsAudioStreamType(frame.Codec)
+			if mux == nil || audioType != muxAudioType {
+				continue
+			}
+			pts := frame.PTS90k
+			if !frame.Has90k {
+				pts = usTo90kHz(frame.PTS)
+			}
+			err = mux.WriteAccessUnit(tsAudioPID, pts, pts, false, frame.Data)
+		}
+		if err != nil {
+			return fmt.Errorf("write access unit: %w", err)
+		}
+		if err := flush(); err != nil {
+			return fmt.Errorf("flush: %w", err)
+		}
+	}
+}
+
+// tsAudioStreamType returns the PMT stream type for an audio codec.
+func tsAudioStreamType(codec string) uint8 {
+	switch codec {
+	case media.AudioCodecAC3:
+		return mpegts.StreamTypeAC3
+	case media.AudioCodecEAC3:
+		return mpegts.StreamTypeEAC3
+	}
+	return mpegts.StreamTypeAAC
+}
+
+// usTo90kHz converts a timestamp in microseconds back to the 90kHz clock
+// of the source's PES headers.
+func usTo90kHz(us int64) int64 {
+	return us * 9 / 100
+}
+
+// videoTicks returns frame's PTS and DTS in 90kHz ticks: those the source
+// carried when known, which converting back from microseconds can miss by
+// a tick.
+func videoTicks(frame *media.VideoFrame) (pts, dts int64) {
+	if !frame.Has90k {
+		return usTo90kHz(frame.PTS), usTo90kHz(frame.DTS)
+	}
+	return frame.PTS90k, frame.DTS90k
+}
+
+// tsAccessUnit returns frame as an Annex B access unit for MPEG-TS:
+// an access unit delimiter, the parameter sets ahead of a keyframe that
+// does not carry them in-band, then the frame's NAL units.
+func tsAccessUnit(frame *media.VideoFrame) []byte {
+	hevc := frame.Codec == "h265"
+	aud := audH264
+	if hevc {
+		aud = audH265
+	}
+	size := len(aud)
+	for _, nalu := range frame.NALUs {
+		size += len(nalu)
+	}
+	out := make([]byte, 0, size)
+	out = append(out, aud...)
+	if frame.IsKeyframe && !hasInBandSPS(frame.NALUs, hevc) {
+		for _, ps := range [][]byte{frame.VPS, frame.SPS, frame.PPS} {
+			if len(ps) > 0 {
+				out = append(out, 0, 0, 0, 1)
+				out = append(out, ps...)
+			}
+		}
+	}
+	for _, nalu := range frame.NALUs {
+		out = append(out, nalu...)
+	}
+	return out
+}
+
+// hasInBandSPS reports whether an access unit of start-code-prefixed NAL
+// units includes a sequence parameter set.
+func hasInBandSPS(nalus [][]byte, hevc bool) bool {
+	for _, nalu := range nalus {
+		i := bytes.Index(nalu, []byte{0, 0, 1})
+		if i < 0 || i+3 >= len(nalu) {
+			continue
+		}
+		h := nalu[i+3]
+		if hevc && demux.IsHEVCSPS((h>>1)&0x3F) || !hevc && demux.IsSPS(h&0x1F) {
+			return true
+		}
+	}
+	return false
+}
+
+// countingWriter adds the bytes written through it to n.
+type countingWriter struct {
+	w io.Writer
+	n *atomic.Int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+// deadlineResponseWriter arms a fresh write deadline before every Write,
+// so a stalled HTTP client ends its own response instead of holding the
+// handler open. Connections that cannot set deadlines write without one.
+type deadlineResponseWriter struct {
+	w       io.Writer
+	rc      *http.ResponseController
+	timeout time.Duration
+}
+
+func (d deadlineResponseWriter) Write(p []byte) (int, error) {
+	err := d.rc.SetWriteDeadline(time.Now().Add(d.timeout))
+	if err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return 0, err
+	}
+	return d.w.Write(p)
+}
+
+// handleLiveTS streams the live edge of a stream as MPEG-TS in a chunked
+// HTTP response, starting at the most recent keyframe. The program holds
+// the video track and the first audio track, for interop with tools such
+// as ffmpeg. Audio-only streams are not supported.
+func (s *Server) handleLiveTS(w http.ResponseWriter, r *http.Request) {
+	streamKey := r.PathValue("key")
+	relay := s.GetRelay(streamKey)
+	if relay == nil {
+		writeError(w, http.StatusNotFound, "stream not found")
+		return
+	}
+	if !relay.HasVideo() {
+		writeError(w, http.StatusNotImplemented, "audio-only streams are not supported")
+		return
+	}
+
+	timeout := s.config.ViewerWriteTimeout
+	if timeout <= 0 {
+		timeout = defaultWriteTimeout
+	}
+	rc := http.NewResponseController(w)
+
+	viewer := newTSViewer(fmt.Sprintf("ts-%s-%s", streamKey, r.RemoteAddr))
+	if !relay.AddViewer(viewer) {
+		writeError(w, http.StatusNotFound, "stream not found")
+		return
+	}
+	defer relay.RemoveViewer(viewer.ID())
+
+	w.Header().Set("Content-Type", "video/mp2t")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+
+	ctx, cancel := relayContext(r.Context(), relay)
+	defer cancel()
+	out := deadlineResponseWriter{w: w, rc: rc, timeout: timeout}
+	if err := viewer.run(ctx, out, rc.Flush); err != nil {
+		slog.Debug("ts egress ended", "viewer", viewer.ID(), "error", err)
+	}
+}
@@ -0,0 +1,120 @@
+package distribution
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/zsiec/prism/media"
+)
+
+func TestHandleLiveTS(t *testing.T) {
+	t.Parallel()
+
+	srv := newTestServer(t)
+	relay := srv.RegisterStream("live")
+	sps := []byte{0x67, 0x42, 0x00, 0x1E, 0x95, 0xA8}
+	pps := []byte{0x68, 0xCE, 0x38, 0x80}
+	relay.BroadcastVideo(&media.VideoFrame{
+		PTS:        1_000_000,
+		DTS:        1_000_000,
+		IsKeyframe: true,
+		NALUs:      [][]byte{{0, 0, 0, 1, 0x65, 0x88, 0x84}},
+		SPS:        sps,
+		PPS:        pps,
+		Codec:      "h264",
+		GroupID:    1,
+	})
+
+	ts := httptest.NewServer(srv.APIHandler())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/api/streams/live/live.ts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "video/mp2t" {
+		t.Errorf("Content-Type = %q, want video/mp2t", ct)
+	}
+
+	// PAT, PMT, then the replayed keyframe.
+	buf := make([]byte, 3*188)
+	if _, err := io.ReadFull(resp.Body, buf); err != nil {
+		t.Fatal(err)
+	}
+	pat := buf[:188]
+	if pat[0] != 0x47 {
+		t.Fatalf("first byte = %#x, want TS sync byte", pat[0])
+	}
+	if pid := uint16(pat[1]&0x1F)<<8 | uint16(pat[2]); pid != 0 || pat[1]&0x40 == 0 {
+		t.Fatalf("first packet PID = %#x (unit start %v), want PAT", pid, pat[1]&0x40 != 0)
+	}
+	if pat[4] != 0 || pat[5] != 0x00 {
+		t.Errorf("pointer field %d, table ID %#x, want a PAT section", pat[4], pat[5])
+	}
+
+	video := buf[2*188:]
+	if pid := uint16(video[1]&0x1F)<<8 | uint16(video[2]); pid != tsVideoPID {
+		t.Fatalf("third packet PID = %#x, want video %#x", pid, tsVideoPID)
+	}
+	wantAU := append(append([]byte{}, audH264...), 0, 0, 0, 1)
+	wantAU = append(wantAU, sps...)
+	if !bytes.Contains(video, wantAU) {
+		t.Error("keyframe should open with an access unit delimiter and its SPS")
+	}
+}
+
+func TestHandleLiveTSNotFound(t *testing.T) {
+	t.Parallel()
+
+	srv := newTestServer(t)
+	req := httptest.NewRequest("GET", "/api/streams/missing/live.ts", nil)
+	rec := httptest.NewRecorder()
+	srv.APIHandler().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestVideoTicks(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		frame    *media.VideoFrame
+		pts, dts int64
+	}{
+		{
+			name:  "from microseconds",
+			frame: &media.VideoFrame{PTS: 1_000_000, DTS: 966_666},
+			pts:   90_000, dts: 86_999,
+		},
+		{
+			name:  "source ticks",
+			frame: &media.VideoFrame{PTS: 33_333_333, DTS: 33_300_000, PTS90k: 2_999_999_999, DTS90k: 2_997_000_000, Has90k: true},
+			pts:   2_999_999_999, dts: 2_997_000_000,
+		},
+		{
+			// Just past a wrap, where microseconds keep counting on.
+			name:  "source ticks at zero",
+			frame: &media.VideoFrame{PTS: 95_443_717_688, DTS: 95_443_717_688, Has90k: true},
+			pts:   0, dts: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if pts, dts := videoTicks(tt.frame); pts != tt.pts || dts != tt.dts {
+				t.Errorf("videoTicks = %d, %d, want %d, %d", pts, dts, tt.pts, tt.dts)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package distribution
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Compile-time interface check.
+var _ RecordController = (*TSRecorder)(nil)
+
+// TSRecorder is a RecordController that records streams to MPEG-TS files
+// in a directory, with the same program as the live TS egress: the video
+// track and the first audio track. A recording follows the relay it
+// started on and ends with its stream if it is not stopped first.
+type TSRecorder struct {
+	log    *slog.Logger
+	dir    string
+	relays func(streamKey string) *Relay
+
+	mu     sync.Mutex
+	nextID int
+	active map[string]*tsRecording // by recording ID, until it ends
+}
+
+// tsRecording is one recording in progress.
+type tsRecording struct {
+	info   Recording
+	viewer *tsViewer
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewTSRecorder returns a TSRecorder writing to dir, which is created if
+// needed. relays resolves a stream key to its relay, or nil if the stream
+// is not live; Server.GetRelay fits.
+func NewTSRecorder(dir string, relays func(streamKey string) *Relay) *TSRecorder {
+	return &TSRecorder{
+		log:    slog.With("component", "ts-recorder"),
+		dir:    dir,
+		relays: relays,
+		active: make(map[string]*tsRecording),
+	}
+}
+
+// StartRecording begins writing streamKey to a new file named after the
+// stream and the start time.
+func (t *TSRecorder) StartRecording(streamKey string) (Recording, error) {
+	relay := t.relays(streamKey)
+	if relay == nil {
+		return Recording{}, ErrStreamNotFound
+	}
+	if !relay.HasVideo() {
+		return Recording{}, errors.New("distribution: audio-only streams cannot be recorded")
+	}
+	if err := os.MkdirAll(t.dir, 0o755); err != nil {
+		return Recording{}, fmt.Errorf("create recording directory: %w", err)
+	}
+
+	t.mu.Lock()
+	t.nextID++
+	id := fmt.Sprintf("rec-%d", t.nextID)
+	t.mu.Unlock()
+
+	now := time.Now()
+	name := fmt.Sprintf("%s-%s-%s.ts",
+		strings.ReplaceAll(streamKey, "/", "_"), now.UTC().Format("20060102T150405Z"), id)
+	path := filepath.Join(t.dir, name)
+	f, err := os.Create(path)
+	if err != nil {
+		return Recording{}, fmt.Errorf("create recording: %w", err)
+	}
+
+	// The recording ends with the stream if it is not stopped first.
+	ctx, cancel := relayContext(context.Background(), relay)
+	rec := &tsRecording{
+		info:   Recording{ID: id, StreamKey: streamKey, Path: path, StartedAt: now},
+		viewer: newTSViewer("rec-" + streamKey + "-" + id),
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	if !relay.AddViewer(rec.viewer) {
+		cancel()
+		f.Close()
+		os.Remove(path)
+		return Recording{}, ErrStreamNotFound
+	}
+	t.mu.Lock()
+	t.active[id] = rec
+	t.mu.Unlock()
+	go func() {
+		defer close(rec.done)
+		defer relay.RemoveViewer(rec.viewer.ID())
+		if err := rec.viewer.run(ctx, f, func() error { return nil }); err != nil {
+			t.log.Warn("recording failed", "stream", streamKey, "id", id, "error", err)
+		}
+		if err := f.Close(); err != nil {
+			t.log.Warn("close recording", "stream", streamKey, "id", id, "error", err)
+		}
+		// A recording that ended with its stream is no longer listed;
+		// one being stopped was already removed by StopRecording.
+		t.mu.Lock()
+		if t.active[id] == rec {
+			delete(t.active, id)
+			t.log.Info("recording ended", "stream", streamKey, "id", id, "bytes", rec.viewer.bytesSent.Load())
+		}
+		t.mu.Unlock()
+	}()
+	t.log.Info("recording started", "stream", streamKey, "id", id, "path", path)
+	return rec.status(), nil
+}
+
+// StopRecording ends a recording once its file is closed.
+func (t *TSRecorder) StopRecording(streamKey, id string) (Recording, error) {
+	t.mu.Lock()
+	rec, ok := t.active[id]
+	if !ok || rec.info.StreamKey != streamKey {
+		t.mu.Unlock()
+		return Recording{}, ErrRecordingNotFound
+	}
+	delete(t.active, id)
+	t.mu.Unlock()
+
+	rec.cancel()
+	<-rec.done
+	status := rec.status()
+	t.log.Info("recording stopped", "stream", streamKey, "id", id, "bytes", status.Bytes)
+	return status, nil
+}
+
+// Recordings returns the recordings of streamKey in start order.
+func (t *TSRecorder) Recordings(streamKey string) []Recording {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var recs []Recording
+	for _, rec := range t.active {
+		if rec.info.StreamKey == streamKey {
+			recs = append(recs, rec.status())
+		}
+	}
+	slices.SortFunc(recs, func(a, b Recording) int { return a.StartedAt.Compare(b.StartedAt) })
+	return recs
+}
+
+// status returns the recording's description with its progress so far.
+func (r *tsRecording) status() Recording {
+	info := r.info
+	info.Bytes = r.viewer.bytesSent.Load()
+	info.DurationMs = time.Since(info.StartedAt).Milliseconds()
+	return info
+}
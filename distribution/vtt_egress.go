@@ -0,0 +1,169 @@
+package distribution
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/zsiec/prism/demux"
+	"github.com/zsiec/prism/media"
+)
+
+// vttViewer is a Viewer that writes one caption channel of a relay as a
+// live WebVTT document, for players that render captions through a
+// <track> element rather than the MoQ caption track. Cues are grouped as
+// WebVTTWriter does, so each is written once the caption after it
+// arrives.
+type vttViewer struct {
+	id      string
+	channel int
+	ch      chan *media.CaptionFrame
+
+	captionSent    atomic.Int64
+	captionDropped atomic.Int64
+	bytesSent      atomic.Int64
+}
+
+func newVTTViewer(id string, channel int) *vttViewer {
+	return &vttViewer{
+		id:      id,
+		channel: channel,
+		ch:      make(chan *media.CaptionFrame, viewerCaptionBuffer),
+	}
+}
+
+func (v *vttViewer) ID() string { return v.id }
+
+// SendVideo is a no-op: the document carries captions only.
+func (v *vttViewer) SendVideo(*media.VideoFrame) {}
+
+// SendAudio is a no-op: the document carries captions only.
+func (v *vttViewer) SendAudio(*media.AudioFrame) {}
+
+// SendCaptions queues frames of the viewer's channel.
+func (v *vttViewer) SendCaptions(frame *media.CaptionFrame) {
+	if frame.Channel != v.channel {
+		return
+	}
+	select {
+	case v.ch <- frame:
+		v.captionSent.Add(1)
+	default:
+		v.captionDropped.Add(1)
+	}
+}
+
+// SendSCTE35 is a no-op: the document carries captions only.
+func (v *vttViewer) SendSCTE35(*demux.SCTE35Event) {}
+
+func (v *vttViewer) Stats() ViewerStats {
+	return ViewerStats{
+		ID:             v.id,
+		CaptionSent:    v.captionSent.Load(),
+		CaptionDropped: v.captionDropped.Load(),
+		BytesSent:      v.bytesSent.Load(),
+	}
+}
+
+// run writes the WebVTT header and then the viewer's captions to w with a
+// WebVTTWriter until ctx is done or a write fails, calling flush after
+// each write. The last cue is written when ctx is done.
+func (v *vttViewer) run(ctx context.Context, w io.Writer, flush func() error) error {
+	vw := NewWebVTTWriter(&countingWriter{w: w, n: &v.bytesSent}, v.channel)
+	if err := vw.WriteHeader(); err != nil {
+		return err
+	}
+	if err := flush(); err != nil {
+		return fmt.Errorf("flush: %w", err)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			vw.Close()
+			return nil
+		case frame := <-v.ch:
+			sent := v.bytesSent.Load()
+			if err := vw.WriteFrame(frame); err != nil {
+				return err
+			}
+			if v.bytesSent.Load() == sent {
+				continue // grouped into the pending cue
+			}
+			if err := flush(); err != nil {
+				return fmt.Errorf("flush: %w", err)
+			}
+		}
+	}
+}
+
+// ParseCaptionChannel parses a caption channel name: CC1 to CC4 for the
+// CEA-608 channels, or service1 to service6 for the CEA-708 services,
+// ignoring case. An empty name selects CC1. A service resolves to the
+// channel channels maps it to, which should be the demuxer's mapping; nil
+// uses demux.DefaultCaptionChannel.
+func ParseCaptionChannel(s string, channels demux.CaptionChannelFunc) (int, error) {
+	name := strings.ToLower(s)
+	switch {
+	case name == "":
+		return 1, nil
+	case strings.HasPrefix(name, "cc"):
+		if n, err := strconv.Atoi(name[2:]); err == nil && n >= 1 && n <= 4 {
+			return n, nil
+		}
+	case strings.HasPrefix(name, "service"):
+		if n, err := strconv.Atoi(name[7:]); err == nil && n >= 1 && n <= 6 {
+			if channels == nil {
+				channels = demux.DefaultCaptionChannel
+			}
+			return channels(n).Channel, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown caption channel %q", s)
+}
+
+// handleCaptionsVTT streams one caption channel of a stream as live
+// WebVTT in a chunked HTTP response. The channel is chosen with the
+// channel query parameter and defaults to CC1.
+func (s *Server) handleCaptionsVTT(w http.ResponseWriter, r *http.Request) {
+	streamKey := r.PathValue("key")
+	channel, err := ParseCaptionChannel(r.URL.Query().Get("channel"), s.config.CaptionChannels)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	relay := s.GetRelay(streamKey)
+	if relay == nil {
+		writeError(w, http.StatusNotFound, "stream not found")
+		return
+	}
+
+	timeout := s.config.ViewerWriteTimeout
+	if timeout <= 0 {
+		timeout = defaultWriteTimeout
+	}
+	rc := http.NewResponseController(w)
+
+	viewer := newVTTViewer(fmt.Sprintf("vtt-%s-%s", streamKey, r.RemoteAddr), channel)
+	if !relay.AddViewer(viewer) {
+		writeError(w, http.StatusNotFound, "stream not found")
+		return
+	}
+	defer relay.RemoveViewer(viewer.ID())
+
+	w.Header().Set("Content-Type", "text/vtt; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+
+	ctx, cancel := relayContext(r.Context(), relay)
+	defer cancel()
+	out := deadlineResponseWriter{w: w, rc: rc, timeout: timeout}
+	if err := viewer.run(ctx, out, rc.Flush); err != nil {
+		slog.Debug("vtt egress ended", "viewer", viewer.ID(), "error", err)
+	}
+}
@@ -0,0 +1,113 @@
+package distribution
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/zsiec/prism/demux"
+	"github.com/zsiec/prism/media"
+)
+
+func TestHandleCaptionsVTT(t *testing.T) {
+	t.Parallel()
+
+	srv := newTestServer(t)
+	relay := srv.RegisterStream("live")
+
+	ts := httptest.NewServer(srv.APIHandler())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/api/streams/live/captions.vtt?channel=cc3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/vtt") {
+		t.Errorf("Content-Type = %q, want text/vtt", ct)
+	}
+
+	// The viewer is added before the response starts. Its cue is written
+	// once the next caption on the channel ends it.
+	relay.BroadcastCaptions(&media.CaptionFrame{PTS: 1_000_000, Text: "other channel", Channel: 1})
+	relay.BroadcastCaptions(&media.CaptionFrame{PTS: 1_500_000, Text: "HELLO <WORLD>\n\nSECOND", Channel: 3})
+	relay.BroadcastCaptions(&media.CaptionFrame{PTS: 3_250_000, Text: "NEXT", Channel: 3})
+
+	want := []string{
+		"WEBVTT",
+		"",
+		"00:00:01.500 --> 00:00:03.250",
+		"HELLO &lt;WORLD&gt;",
+		"SECOND",
+		"",
+	}
+	sc := bufio.NewScanner(resp.Body)
+	for i, w := range want {
+		if !sc.Scan() {
+			t.Fatalf("line %d: %v, want %q", i, sc.Err(), w)
+		}
+		if got := sc.Text(); got != w {
+			t.Fatalf("line %d = %q, want %q", i, got, w)
+		}
+	}
+}
+
+func TestHandleCaptionsVTTErrors(t *testing.T) {
+	t.Parallel()
+
+	srv := newTestServer(t)
+	srv.RegisterStream("live")
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/api/streams/missing/captions.vtt", http.StatusNotFound},
+		{"/api/streams/live/captions.vtt?channel=CC5", http.StatusBadRequest},
+		{"/api/streams/live/captions.vtt?channel=service0", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.path, nil)
+		rec := httptest.NewRecorder()
+		srv.APIHandler().ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.path, rec.Code, tt.want)
+		}
+	}
+}
+
+func TestParseCaptionChannel(t *testing.T) {
+	t.Parallel()
+
+	remap := func(service int) demux.CaptionChannel {
+		return demux.CaptionChannel{Channel: 100 + service, Label: "English"}
+	}
+	tests := []struct {
+		name     string
+		channels demux.CaptionChannelFunc
+		want     int
+		ok       bool
+	}{
+		{"", nil, 1, true},
+		{"CC1", nil, 1, true},
+		{"cc4", nil, 4, true},
+		{"service1", nil, 7, true},
+		{"Service6", nil, 12, true},
+		{"service1", remap, 101, true},
+		{"cc2", remap, 2, true},
+		{"CC0", nil, 0, false},
+		{"service7", nil, 0, false},
+		{"708", nil, 0, false},
+	}
+	for _, tt := range tests {
+		got, err := ParseCaptionChannel(tt.name, tt.channels)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("ParseCaptionChannel(%q) = %d, %v; want %d, ok %v", tt.name, got, err, tt.want, tt.ok)
+		}
+	}
+}
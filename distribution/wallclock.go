@@ -0,0 +1,79 @@
+package distribution
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/zsiec/prism/media"
+)
+
+// TimestampMode selects the clock of the LOC capture timestamps sent to
+// viewers.
+type TimestampMode int
+
+const (
+	// TimestampMediaClock sends each frame's PTS, in microseconds of the
+	// source's media clock. It is the default.
+	TimestampMediaClock TimestampMode = iota
+
+	// TimestampWallClock maps PTS onto wall-clock time, in microseconds
+	// since the Unix epoch, so clients can align several streams with
+	// each other and with real time. Each stream is anchored to the
+	// arrival time of its first frame and re-anchored at each video
+	// discontinuity.
+	TimestampWallClock
+)
+
+// ParseTimestampMode parses a mode name: "media" or "wallclock".
+func ParseTimestampMode(s string) (TimestampMode, error) {
+	switch s {
+	case "media":
+		return TimestampMediaClock, nil
+	case "wallclock":
+		return TimestampWallClock, nil
+	}
+	return 0, fmt.Errorf("unknown timestamp mode %q", s)
+}
+
+// wallClock maps a stream's PTS onto wall-clock time by a fixed offset,
+// the Unix time in microseconds at PTS zero. A nil *wallClock maps PTS to
+// itself, for the media clock mode. It is safe for concurrent use.
+type wallClock struct {
+	anchored atomic.Bool
+	offset   atomic.Int64
+}
+
+// observeVideo anchors the clock to frame's arrival if it is the first
+// frame seen, or marks a discontinuity after which PTS no longer follows
+// on from the earlier frames.
+func (c *wallClock) observeVideo(frame *media.VideoFrame) {
+	if c.anchored.Load() && !frame.Discontinuity {
+		return
+	}
+	at := frame.ArrivedAt
+	if at.IsZero() {
+		at = time.Now()
+	}
+	c.offset.Store(at.UnixMicro() - frame.PTS)
+	c.anchored.Store(true)
+}
+
+// observeAudio anchors the clock to the present if frame is the first
+// frame seen, as it is on audio-only streams.
+func (c *wallClock) observeAudio(frame *media.AudioFrame) {
+	if c.anchored.Load() {
+		return
+	}
+	c.offset.Store(time.Now().UnixMicro() - frame.PTS)
+	c.anchored.Store(true)
+}
+
+// captureTimestamp returns the LOC capture timestamp of a frame with PTS
+// pts, in microseconds.
+func (c *wallClock) captureTimestamp(pts int64) uint64 {
+	if c == nil {
+		return uint64(pts)
+	}
+	return uint64(pts + c.offset.Load())
+}
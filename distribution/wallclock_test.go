@@ -0,0 +1,140 @@
+package distribution
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go/quicvarint"
+	"github.com/zsiec/prism/media"
+)
+
+// objectCaptureTimestamp returns the capture timestamp extension of the
+// object at the start of data, which must be the first extension.
+func objectCaptureTimestamp(t *testing.T, data []byte) uint64 {
+	t.Helper()
+	_, pos, err := quicvarint.Parse(data) // object ID
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, n, _ := quicvarint.Parse(data[pos:]) // extensions length
+	pos += n
+	id, n, _ := quicvarint.Parse(data[pos:])
+	pos += n
+	if id != locExtCaptureTimestamp {
+		t.Fatalf("first extension = %d, want capture timestamp", id)
+	}
+	val, _, err := quicvarint.Parse(data[pos:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return val
+}
+
+func TestParseTimestampMode(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		in      string
+		want    TimestampMode
+		wantErr bool
+	}{
+		{in: "media", want: TimestampMediaClock},
+		{in: "wallclock", want: TimestampWallClock},
+		{in: "utc", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseTimestampMode(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseTimestampMode(%q) = %v, %v", tt.in, got, err)
+		}
+	}
+}
+
+func TestRelayTimestampModes(t *testing.T) {
+	t.Parallel()
+
+	arrived := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	const pts = 90_000_000 // 90s into the source's media clock
+
+	tests := []struct {
+		name      string
+		mode      TimestampMode
+		wantVideo uint64 // for a frame 40ms after the first
+		wantAudio uint64 // for a frame 20ms after the first video frame
+	}{
+		{
+			name:      "media clock",
+			mode:      TimestampMediaClock,
+			wantVideo: pts + 40_000,
+			wantAudio: pts + 20_000,
+		},
+		{
+			name:      "wall clock",
+			mode:      TimestampWallClock,
+			wantVideo: uint64(arrived.UnixMicro()) + 40_000,
+			wantAudio: uint64(arrived.UnixMicro()) + 20_000,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			relay := NewRelay()
+			relay.SetTimestampMode(tt.mode)
+			relay.BroadcastVideo(&media.VideoFrame{PTS: pts, IsKeyframe: true, GroupID: 1, ArrivedAt: arrived})
+
+			var buf bytes.Buffer
+			video := newMoQVideoWriter(1, 0, VideoObjectPerFrame, relay.wallClock())
+			if _, err := video.WriteVideoFrame(&buf, &media.VideoFrame{PTS: pts + 40_000, WireData: []byte{0, 0, 0, 1, 0x41}}); err != nil {
+				t.Fatal(err)
+			}
+			if got := objectCaptureTimestamp(t, buf.Bytes()); got != tt.wantVideo {
+				t.Errorf("video capture timestamp = %d, want %d", got, tt.wantVideo)
+			}
+
+			buf.Reset()
+			audio := newMoQWriter(2, 0, relay.wallClock())
+			if _, err := audio.WriteAudioFrame(&buf, []byte{0x21}, uint32((pts+20_000)/1000)); err != nil {
+				t.Fatal(err)
+			}
+			if got := objectCaptureTimestamp(t, buf.Bytes()); got != tt.wantAudio {
+				t.Errorf("audio capture timestamp = %d, want %d", got, tt.wantAudio)
+			}
+		})
+	}
+}
+
+func TestWallClockAnchoring(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	c := &wallClock{}
+	c.observeVideo(&media.VideoFrame{PTS: 5_000_000, ArrivedAt: start})
+
+	// Later frames keep the first frame's anchor, however late they are.
+	c.observeVideo(&media.VideoFrame{PTS: 6_000_000, ArrivedAt: start.Add(3 * time.Second)})
+	c.observeAudio(&media.AudioFrame{PTS: 6_000_000})
+	if got, want := c.captureTimestamp(6_000_000), uint64(start.Add(time.Second).UnixMicro()); got != want {
+		t.Errorf("capture timestamp = %d, want %d", got, want)
+	}
+
+	// A discontinuity re-anchors to the frame that resumes the source.
+	resumed := start.Add(10 * time.Second)
+	c.observeVideo(&media.VideoFrame{PTS: 1_000_000, ArrivedAt: resumed, Discontinuity: true})
+	if got, want := c.captureTimestamp(1_500_000), uint64(resumed.Add(500*time.Millisecond).UnixMicro()); got != want {
+		t.Errorf("capture timestamp after discontinuity = %d, want %d", got, want)
+	}
+
+	// Audio anchors a clock no video has reached, to the present.
+	before := time.Now().UnixMicro()
+	a := &wallClock{}
+	a.observeAudio(&media.AudioFrame{PTS: 2_000_000})
+	if got := int64(a.captureTimestamp(2_000_000)); got < before || got > time.Now().UnixMicro() {
+		t.Errorf("audio-anchored capture timestamp %d is not the present", got)
+	}
+
+	var mediaClock *wallClock
+	if got := mediaClock.captureTimestamp(1234); got != 1234 {
+		t.Errorf("nil clock capture timestamp = %d, want the PTS", got)
+	}
+}
@@ -0,0 +1,202 @@
+package distribution
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/zsiec/prism/media"
+)
+
+// maxCueDurationUS bounds how long a cue stays on screen when the caption
+// after it is late or never comes, in microseconds.
+const maxCueDurationUS = 10_000_000
+
+// CaptionCue is one caption shown from StartUS to EndUS, in PTS
+// microseconds.
+type CaptionCue struct {
+	StartUS int64
+	EndUS   int64
+	Text    string
+}
+
+// CaptionCueBuilder groups the caption frames of one channel into cues.
+// Each frame carries the whole caption on screen, and a cue lasts until
+// the caption changes. Updates that only add characters to the bottom
+// row, as roll-up and paint-on captions do while a row is typed, are
+// grouped into one cue showing the finished row. A new row scrolling up,
+// a pop-on caption replacing the one shown or any other change ends the
+// cue and starts another with the new text; an empty caption ends the cue
+// and leaves the screen blank.
+//
+// Frames report what captions show but not when they are erased, so a
+// cue with no caption after it, or one followed by a backward PTS jump,
+// ends MaxDurationUS after it starts.
+type CaptionCueBuilder struct {
+	// MaxDurationUS is the longest a cue lasts, in microseconds. Zero
+	// uses 10 seconds.
+	MaxDurationUS int64
+
+	// pending is the cue on screen, awaiting its end; empty text means
+	// none.
+	pending CaptionCue
+}
+
+// Add adds the caption shown from pts on, returning the cue it ends, if
+// any.
+func (b *CaptionCueBuilder) Add(pts int64, text string) (CaptionCue, bool) {
+	text = strings.TrimRight(text, " \r\n")
+	var ended CaptionCue
+	var ok bool
+	if b.pending.Text != "" {
+		switch {
+		case pts < b.pending.StartUS:
+			// PTS went backward, as at a discontinuity, so the change
+			// gives no end time.
+		case text == b.pending.Text:
+			return CaptionCue{}, false
+		case pts == b.pending.StartUS || extendsBottomRow(b.pending.Text, text):
+			b.pending.Text = text
+			return CaptionCue{}, false
+		}
+		ended, ok = b.Flush(pts)
+	}
+	b.pending = CaptionCue{StartUS: pts, Text: text}
+	return ended, ok
+}
+
+// Flush ends the pending cue at endUS, or MaxDurationUS after it starts
+// if that is sooner or endUS is not after its start, and returns it, if
+// there is one.
+func (b *CaptionCueBuilder) Flush(endUS int64) (CaptionCue, bool) {
+	c := b.pending
+	if c.Text == "" {
+		return CaptionCue{}, false
+	}
+	maxDur := b.MaxDurationUS
+	if maxDur <= 0 {
+		maxDur = maxCueDurationUS
+	}
+	c.EndUS = c.StartUS + maxDur
+	if endUS > c.StartUS {
+		c.EndUS = min(c.EndUS, endUS)
+	}
+	b.pending = CaptionCue{}
+	return c, true
+}
+
+// WebVTTWriter writes the caption frames of one channel as a WebVTT
+// document, such as a sidecar file for a recording. Cue times are the
+// frames' PTS, so they line up with media timestamped the same way.
+// Frames are grouped into cues as CaptionCueBuilder describes, so a cue
+// is written once the frame after it arrives, or by Close.
+type WebVTTWriter struct {
+	w       io.Writer
+	channel int
+	header  bool
+	cues    CaptionCueBuilder
+}
+
+// NewWebVTTWriter returns a WebVTTWriter writing the frames of caption
+// channel channel to w, numbered as in media.CaptionFrame.Channel. Frames
+// of other channels are ignored.
+func NewWebVTTWriter(w io.Writer, channel int) *WebVTTWriter {
+	return &WebVTTWriter{w: w, channel: channel}
+}
+
+// WriteHeader writes the WEBVTT header, if it has not been written. The
+// other methods write it first as needed, so calling it is only useful
+// to start a document before any cue is ready.
+func (vw *WebVTTWriter) WriteHeader() error {
+	if vw.header {
+		return nil
+	}
+	if _, err := io.WriteString(vw.w, "WEBVTT\n\n"); err != nil {
+		return fmt.Errorf("write header: %w", err)
+	}
+	vw.header = true
+	return nil
+}
+
+// WriteFrame adds frame to the document, writing the cue it ends, if any.
+func (vw *WebVTTWriter) WriteFrame(frame *media.CaptionFrame) error {
+	if err := vw.WriteHeader(); err != nil {
+		return err
+	}
+	if frame.Channel != vw.channel {
+		return nil
+	}
+	if c, ok := vw.cues.Add(frame.PTS, frame.Text); ok {
+		return vw.writeCue(c)
+	}
+	return nil
+}
+
+// Close writes the pending cue, if any, ending it maxCueDurationUS after
+// it starts, since no later frame marks its end. It does not close the
+// underlying writer.
+func (vw *WebVTTWriter) Close() error {
+	if err := vw.WriteHeader(); err != nil {
+		return err
+	}
+	if c, ok := vw.cues.Flush(math.MaxInt64); ok {
+		return vw.writeCue(c)
+	}
+	return nil
+}
+
+// Run writes the frames received on frames until the channel is closed or
+// ctx is done, then closes the writer.
+func (vw *WebVTTWriter) Run(ctx context.Context, frames <-chan *media.CaptionFrame) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return vw.Close()
+		case frame, ok := <-frames:
+			if !ok {
+				return vw.Close()
+			}
+			if err := vw.WriteFrame(frame); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// writeCue writes c.
+func (vw *WebVTTWriter) writeCue(c CaptionCue) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s --> %s\n", vttTimestamp(c.StartUS), vttTimestamp(c.EndUS))
+	for line := range strings.SplitSeq(c.Text, "\n") {
+		// A blank line would end the cue early.
+		if line = strings.TrimRight(line, " \r"); line != "" {
+			b.WriteString(vttEscaper.Replace(line))
+			b.WriteByte('\n')
+		}
+	}
+	b.WriteByte('\n')
+	if _, err := io.WriteString(vw.w, b.String()); err != nil {
+		return fmt.Errorf("write cue: %w", err)
+	}
+	return nil
+}
+
+// extendsBottomRow reports whether next is prev with characters added to
+// its last row, as a roll-up or paint-on row being typed.
+func extendsBottomRow(prev, next string) bool {
+	rest, ok := strings.CutPrefix(next, prev)
+	return ok && !strings.Contains(rest, "\n")
+}
+
+// vttEscaper escapes the characters WebVTT cue text reserves for markup.
+var vttEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// vttTimestamp formats a time in microseconds as a WebVTT timestamp,
+// hh:mm:ss.ttt, with as many hour digits as it needs.
+func vttTimestamp(us int64) string {
+	us = max(us, 0)
+	ms := us / 1000
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3_600_000, ms/60_000%60, ms/1000%60, ms%1000)
+}
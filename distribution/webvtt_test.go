@@ -0,0 +1,236 @@
+package distribution
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/zsiec/prism/media"
+)
+
+func TestWebVTTWriter(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		frames []media.CaptionFrame
+		want   string
+	}{
+		{
+			name: "empty document",
+			want: "WEBVTT\n\n",
+		},
+		{
+			name: "pop-on replacements",
+			frames: []media.CaptionFrame{
+				{PTS: 1_000_000, Text: "FIRST", Channel: 1},
+				{PTS: 2_500_000, Text: "SECOND\nCAPTION", Channel: 1},
+				{PTS: 4_000_000, Text: "", Channel: 1},
+				{PTS: 5_000_000, Text: "THIRD & LAST", Channel: 1},
+			},
+			want: "WEBVTT\n\n" +
+				"00:00:01.000 --> 00:00:02.500\nFIRST\n\n" +
+				"00:00:02.500 --> 00:00:04.000\nSECOND\nCAPTION\n\n" +
+				"00:00:05.000 --> 00:00:15.000\nTHIRD &amp; LAST\n\n",
+		},
+		{
+			name: "roll-up rows",
+			frames: []media.CaptionFrame{
+				{PTS: 1_000_000, Text: "HE", Channel: 1},
+				{PTS: 1_100_000, Text: "HELLO", Channel: 1},
+				{PTS: 1_200_000, Text: "HELLO", Channel: 1},
+				{PTS: 1_300_000, Text: "HELLO THERE", Channel: 1},
+				{PTS: 2_000_000, Text: "HELLO THERE\nHOW", Channel: 1},
+				{PTS: 2_200_000, Text: "HELLO THERE\nHOW ARE YOU", Channel: 1},
+				{PTS: 3_000_000, Text: "HOW ARE YOU\nFINE", Channel: 1},
+			},
+			want: "WEBVTT\n\n" +
+				"00:00:01.000 --> 00:00:02.000\nHELLO THERE\n\n" +
+				"00:00:02.000 --> 00:00:03.000\nHELLO THERE\nHOW ARE YOU\n\n" +
+				"00:00:03.000 --> 00:00:13.000\nHOW ARE YOU\nFINE\n\n",
+		},
+		{
+			name: "other channels ignored",
+			frames: []media.CaptionFrame{
+				{PTS: 1_000_000, Text: "MINE", Channel: 1},
+				{PTS: 1_500_000, Text: "THEIRS", Channel: 2},
+				{PTS: 2_000_000, Text: "", Channel: 1},
+			},
+			want: "WEBVTT\n\n00:00:01.000 --> 00:00:02.000\nMINE\n\n",
+		},
+		{
+			name: "long and backward gaps capped",
+			frames: []media.CaptionFrame{
+				{PTS: 1_000_000, Text: "STUCK", Channel: 1},
+				{PTS: 60_000_000, Text: "LATE", Channel: 1},
+				{PTS: 500_000, Text: "RESTARTED", Channel: 1},
+				{PTS: 1_000_000, Text: "", Channel: 1},
+			},
+			want: "WEBVTT\n\n" +
+				"00:00:01.000 --> 00:00:11.000\nSTUCK\n\n" +
+				"00:01:00.000 --> 00:01:10.000\nLATE\n\n" +
+				"00:00:00.500 --> 00:00:01.000\nRESTARTED\n\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var buf bytes.Buffer
+			vw := NewWebVTTWriter(&buf, 1)
+			for i := range tt.frames {
+				if err := vw.WriteFrame(&tt.frames[i]); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := vw.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("document =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWebVTTWriterRun(t *testing.T) {
+	t.Parallel()
+
+	frames := make(chan *media.CaptionFrame, 2)
+	frames <- &media.CaptionFrame{PTS: 1_000_000, Text: "ONE", Channel: 3}
+	frames <- &media.CaptionFrame{PTS: 2_000_000, Text: "TWO", Channel: 3}
+	close(frames)
+
+	var buf bytes.Buffer
+	if err := NewWebVTTWriter(&buf, 3).Run(context.Background(), frames); err != nil {
+		t.Fatal(err)
+	}
+	want := "WEBVTT\n\n" +
+		"00:00:01.000 --> 00:00:02.000\nONE\n\n" +
+		"00:00:02.000 --> 00:00:12.000\nTWO\n\n"
+	if got := buf.String(); got != want {
+		t.Errorf("document =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestCaptionCueBuilder(t *testing.T) {
+	t.Parallel()
+
+	type frame struct {
+		pts  int64
+		text string
+	}
+	tests := []struct {
+		name   string
+		frames []frame
+		endUS  int64
+		want   []CaptionCue
+	}{
+		{
+			name: "pop-on",
+			frames: []frame{
+				{1_000_000, "FIRST"},
+				{1_033_000, "FIRST"},
+				{3_000_000, "SECOND\nLINE"},
+			},
+			endUS: 4_000_000,
+			want: []CaptionCue{
+				{1_000_000, 3_000_000, "FIRST"},
+				{3_000_000, 4_000_000, "SECOND\nLINE"},
+			},
+		},
+		{
+			name: "roll-up",
+			frames: []frame{
+				{1_000_000, "HEL"},
+				{1_100_000, "HELLO"},
+				{2_000_000, "HELLO\nWOR"},
+				{2_100_000, "HELLO\nWORLD"},
+			},
+			endUS: 2_500_000,
+			want: []CaptionCue{
+				{1_000_000, 2_000_000, "HELLO"},
+				{2_000_000, 2_500_000, "HELLO\nWORLD"},
+			},
+		},
+		{
+			name: "capped",
+			frames: []frame{
+				{1_000_000, "STUCK"},
+				{30_000_000, "LATE"},
+			},
+			endUS: 31_000_000,
+			want: []CaptionCue{
+				{1_000_000, 11_000_000, "STUCK"},
+				{30_000_000, 31_000_000, "LATE"},
+			},
+		},
+		{
+			name: "erased",
+			frames: []frame{
+				{1_000_000, "GONE"},
+				{2_000_000, ""},
+				{3_000_000, ""},
+			},
+			endUS: 4_000_000,
+			want: []CaptionCue{
+				{1_000_000, 2_000_000, "GONE"},
+			},
+		},
+		{
+			name: "backward",
+			frames: []frame{
+				{5_000_000, "BEFORE"},
+				{1_000_000, "BEFORE"},
+			},
+			endUS: 2_000_000,
+			want: []CaptionCue{
+				{5_000_000, 15_000_000, "BEFORE"},
+				{1_000_000, 2_000_000, "BEFORE"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var b CaptionCueBuilder
+			var got []CaptionCue
+			for _, f := range tt.frames {
+				if c, ok := b.Add(f.pts, f.text); ok {
+					got = append(got, c)
+				}
+			}
+			if c, ok := b.Flush(tt.endUS); ok {
+				got = append(got, c)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("cues = %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("cue %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestVTTTimestamp(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		us   int64
+		want string
+	}{
+		{0, "00:00:00.000"},
+		{1_500_000, "00:00:01.500"},
+		{3_723_004_000, "01:02:03.004"},
+		{-5, "00:00:00.000"},
+	}
+	for _, tt := range tests {
+		if got := vttTimestamp(tt.us); got != tt.want {
+			t.Errorf("vttTimestamp(%d) = %q, want %q", tt.us, got, tt.want)
+		}
+	}
+}
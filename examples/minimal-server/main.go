@@ -41,7 +41,7 @@ func main() {
 
 	var distSrv *distribution.Server
 
-	registry := ingest.NewRegistry(func(key string, input io.Reader, _ ingest.InputFormat) {
+	registry := ingest.NewRegistry(func(key string, input io.Reader, _ ingest.InputFormat, protocol string) {
 		if _, created := mgr.Create(key); !created {
 			return
 		}
@@ -52,7 +52,7 @@ func main() {
 
 		relay := distSrv.RegisterStream(key)
 		p := pipeline.New(key, input, relay)
-		p.SetProtocol("SRT")
+		p.SetProtocol(protocol)
 		distSrv.SetPipeline(key, p)
 
 		if err := p.Run(ctx); err != nil {
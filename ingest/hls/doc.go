@@ -0,0 +1,6 @@
+// Package hls implements pulling an HLS source as ingest: a Puller polls a
+// media playlist, downloads its MPEG-TS segments in sequence and feeds
+// them to the ingest registry as one continuous transport stream, so the
+// source can be re-originated over MoQ. Segments in fragmented MP4 are not
+// supported.
+package hls
@@ -0,0 +1,166 @@
+package hls
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrUnsupported is returned for playlists the puller cannot ingest, such
+// as those with fragmented MP4 or encrypted segments.
+var ErrUnsupported = errors.New("unsupported HLS playlist")
+
+// segment is one media segment of a playlist.
+type segment struct {
+	seq uint64 // media sequence number
+	url string
+
+	// discontinuity reports an EXT-X-DISCONTINUITY before the segment:
+	// its timestamps and continuity counters need not follow on from the
+	// segment before.
+	discontinuity bool
+}
+
+// mediaPlaylist is a parsed HLS media playlist (RFC 8216 4.3.3).
+type mediaPlaylist struct {
+	targetDuration time.Duration
+	segments       []segment
+
+	// endList reports an EXT-X-ENDLIST: no segments will be added, as
+	// for video on demand or a live event that has finished.
+	endList bool
+}
+
+// variant is a variant stream of a multivariant (master) playlist.
+type variant struct {
+	url       string
+	bandwidth int
+}
+
+// parsePlaylist parses an HLS playlist, resolving URIs against base. A
+// media playlist is returned as such; a multivariant playlist yields its
+// variants instead.
+func parsePlaylist(r io.Reader, base *url.URL) (*mediaPlaylist, []variant, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	if !sc.Scan() || strings.TrimSpace(strings.TrimPrefix(sc.Text(), "\ufeff")) != "#EXTM3U" {
+		return nil, nil, errors.New("not an HLS playlist: missing #EXTM3U")
+	}
+
+	var (
+		pl            mediaPlaylist
+		variants      []variant
+		seq           uint64
+		discontinuity bool
+		bandwidth     = -1 // from EXT-X-STREAM-INF, for the URI after it
+	)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		tag, value, _ := strings.Cut(line, ":")
+		switch {
+		case line == "":
+		case tag == "#EXT-X-TARGETDURATION":
+			secs, err := strconv.Atoi(value)
+			if err != nil || secs <= 0 {
+				return nil, nil, fmt.Errorf("bad EXT-X-TARGETDURATION %q", value)
+			}
+			pl.targetDuration = time.Duration(secs) * time.Second
+		case tag == "#EXT-X-MEDIA-SEQUENCE":
+			n, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return nil, nil, fmt.Errorf("bad EXT-X-MEDIA-SEQUENCE %q", value)
+			}
+			seq = n
+		case tag == "#EXT-X-DISCONTINUITY":
+			discontinuity = true
+		case tag == "#EXT-X-ENDLIST":
+			pl.endList = true
+		case tag == "#EXT-X-STREAM-INF":
+			bandwidth = attribute(value, "BANDWIDTH")
+		case tag == "#EXT-X-MAP":
+			return nil, nil, fmt.Errorf("%w: fragmented MP4 segments", ErrUnsupported)
+		case tag == "#EXT-X-BYTERANGE":
+			return nil, nil, fmt.Errorf("%w: byte range segments", ErrUnsupported)
+		case tag == "#EXT-X-KEY" && !strings.Contains(value, "METHOD=NONE"):
+			return nil, nil, fmt.Errorf("%w: encrypted segments", ErrUnsupported)
+		case strings.HasPrefix(line, "#"):
+			// Other tags and comments do not affect ingest.
+		default:
+			u, err := base.Parse(line)
+			if err != nil {
+				return nil, nil, fmt.Errorf("bad URI %q: %w", line, err)
+			}
+			if bandwidth >= 0 {
+				variants = append(variants, variant{url: u.String(), bandwidth: bandwidth})
+				bandwidth = -1
+				continue
+			}
+			pl.segments = append(pl.segments, segment{
+				seq:           seq,
+				url:           u.String(),
+				discontinuity: discontinuity,
+			})
+			seq++
+			discontinuity = false
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	if len(variants) > 0 {
+		return nil, variants, nil
+	}
+	if pl.targetDuration == 0 {
+		return nil, nil, errors.New("media playlist has no EXT-X-TARGETDURATION")
+	}
+	return &pl, nil, nil
+}
+
+// attribute returns the decimal integer attribute name of an attribute
+// list such as `BANDWIDTH=1280000,CODECS="avc1.4d401f"`, or 0 if it is
+// missing or malformed.
+func attribute(list, name string) int {
+	for len(list) > 0 {
+		var kv string
+		kv, list = splitAttribute(list)
+		k, v, _ := strings.Cut(kv, "=")
+		if strings.TrimSpace(k) == name {
+			n, _ := strconv.Atoi(strings.TrimSpace(v))
+			return n
+		}
+	}
+	return 0
+}
+
+// splitAttribute returns the first attribute of list and the rest,
+// skipping commas inside quoted values.
+func splitAttribute(list string) (string, string) {
+	quoted := false
+	for i, c := range list {
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case c == ',' && !quoted:
+			return list[:i], list[i+1:]
+		}
+	}
+	return list, ""
+}
+
+// bestVariant returns the variant with the highest bandwidth, the first
+// of them on a tie.
+func bestVariant(variants []variant) variant {
+	best := variants[0]
+	for _, v := range variants[1:] {
+		if v.bandwidth > best.bandwidth {
+			best = v
+		}
+	}
+	return best
+}
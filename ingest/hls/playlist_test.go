@@ -0,0 +1,100 @@
+package hls
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParsePlaylistMedia(t *testing.T) {
+	t.Parallel()
+
+	base, _ := url.Parse("https://origin.example/live/cam1/index.m3u8?token=x")
+	pl, variants, err := parsePlaylist(strings.NewReader(`#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-TARGETDURATION:6
+#EXT-X-MEDIA-SEQUENCE:41
+#EXTINF:6.000,
+seg41.ts
+#EXTINF:5.960,
+#EXT-X-PROGRAM-DATE-TIME:2026-01-01T00:00:00Z
+/abs/seg42.ts
+#EXT-X-DISCONTINUITY
+#EXTINF:6.000,
+https://cdn.example/seg43.ts
+`), base)
+	if err != nil || variants != nil {
+		t.Fatalf("parsePlaylist: variants %v, err %v", variants, err)
+	}
+	if pl.targetDuration != 6*time.Second || pl.endList {
+		t.Errorf("target duration %v, endList %v; want 6s, false", pl.targetDuration, pl.endList)
+	}
+	want := []segment{
+		{seq: 41, url: "https://origin.example/live/cam1/seg41.ts"},
+		{seq: 42, url: "https://origin.example/abs/seg42.ts"},
+		{seq: 43, url: "https://cdn.example/seg43.ts", discontinuity: true},
+	}
+	if len(pl.segments) != len(want) {
+		t.Fatalf("segments = %+v, want %+v", pl.segments, want)
+	}
+	for i := range want {
+		if pl.segments[i] != want[i] {
+			t.Errorf("segment %d = %+v, want %+v", i, pl.segments[i], want[i])
+		}
+	}
+}
+
+func TestParsePlaylistMultivariant(t *testing.T) {
+	t.Parallel()
+
+	base, _ := url.Parse("https://origin.example/master.m3u8")
+	pl, variants, err := parsePlaylist(strings.NewReader(`#EXTM3U
+#EXT-X-STREAM-INF:BANDWIDTH=800000,CODECS="avc1.4d401f,mp4a.40.2",RESOLUTION=640x360
+low/index.m3u8
+#EXT-X-STREAM-INF:CODECS="avc1.640028,mp4a.40.2",BANDWIDTH=5000000
+high/index.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=2500000
+mid/index.m3u8
+`), base)
+	if err != nil || pl != nil {
+		t.Fatalf("parsePlaylist: playlist %v, err %v", pl, err)
+	}
+	if len(variants) != 3 {
+		t.Fatalf("variants = %+v, want 3", variants)
+	}
+	if got := bestVariant(variants); got.url != "https://origin.example/high/index.m3u8" || got.bandwidth != 5000000 {
+		t.Errorf("bestVariant = %+v, want high at 5000000", got)
+	}
+}
+
+func TestParsePlaylistInvalid(t *testing.T) {
+	t.Parallel()
+
+	base, _ := url.Parse("https://origin.example/index.m3u8")
+	tests := []struct {
+		name        string
+		playlist    string
+		unsupported bool
+	}{
+		{"no header", "#EXT-X-TARGETDURATION:6\nseg.ts\n", false},
+		{"no target duration", "#EXTM3U\n#EXTINF:6,\nseg.ts\n", false},
+		{"bad media sequence", "#EXTM3U\n#EXT-X-TARGETDURATION:6\n#EXT-X-MEDIA-SEQUENCE:x\n", false},
+		{"fMP4", "#EXTM3U\n#EXT-X-TARGETDURATION:6\n#EXT-X-MAP:URI=\"init.mp4\"\n", true},
+		{"encrypted", "#EXTM3U\n#EXT-X-TARGETDURATION:6\n#EXT-X-KEY:METHOD=AES-128,URI=\"k\"\n", true},
+		{"byte range", "#EXTM3U\n#EXT-X-TARGETDURATION:6\n#EXT-X-BYTERANGE:1000@0\nseg.ts\n", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			_, _, err := parsePlaylist(strings.NewReader(tt.playlist), base)
+			if err == nil {
+				t.Fatal("parsePlaylist succeeded, want an error")
+			}
+			if got := errors.Is(err, ErrUnsupported); got != tt.unsupported {
+				t.Errorf("err = %v; ErrUnsupported %v, want %v", err, got, tt.unsupported)
+			}
+		})
+	}
+}
@@ -0,0 +1,448 @@
+package hls
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/zsiec/prism/ingest"
+)
+
+const (
+	// liveStartSegments is how many segments from the end of a live
+	// playlist a pull starts, which RFC 8216 6.3.3 recommends so the
+	// player does not stall waiting for the next one.
+	liveStartSegments = 3
+
+	// maxPlaylistFailures is how many consecutive playlist reloads may
+	// fail before a pull gives up on the source.
+	maxPlaylistFailures = 5
+
+	// maxPlaylistSize and maxSegmentSize bound what is read from the
+	// origin for a playlist and a segment.
+	maxPlaylistSize = 4 << 20
+	maxSegmentSize  = 256 << 20
+
+	// defaultHTTPTimeout bounds each playlist and segment request of a
+	// Puller created without its own client.
+	defaultHTTPTimeout = 30 * time.Second
+
+	tsPacketSize = 188
+)
+
+// PullRequest describes a remote HLS source to pull from.
+type PullRequest struct {
+	// URL is the playlist to pull. A multivariant playlist is resolved
+	// to its highest-bandwidth variant.
+	URL       string `json:"url"`
+	StreamKey string `json:"streamKey"`
+}
+
+type activePull struct {
+	req    PullRequest
+	cancel context.CancelFunc
+}
+
+// Puller manages HLS pulls, polling remote media playlists and streaming
+// their segments into the ingest registry.
+type Puller struct {
+	log      *slog.Logger
+	registry *ingest.Registry
+	client   *http.Client
+
+	mu    sync.Mutex
+	pulls map[string]*activePull
+
+	// reloadWait, if set, replaces the target duration as the live
+	// playlist reload interval, for tests.
+	reloadWait time.Duration
+}
+
+// NewPuller creates a Puller that uses the given registry to register
+// pulled streams and client to fetch playlists and segments. If client is
+// nil, a client with a 30-second request timeout is used; if log is nil,
+// slog.Default() is used.
+func NewPuller(registry *ingest.Registry, client *http.Client, log *slog.Logger) *Puller {
+	if client == nil {
+		client = &http.Client{Timeout: defaultHTTPTimeout}
+	}
+	if log == nil {
+		log = slog.Default()
+	}
+	return &Puller{
+		log:      log.With("component", "hls-puller"),
+		registry: registry,
+		client:   client,
+		pulls:    make(map[string]*activePull),
+	}
+}
+
+// Pull fetches the playlist synchronously, returning an error if it cannot
+// be loaded or is not supported. On success, segments are streamed in a
+// background goroutine until the playlist ends, the source fails, ctx is
+// done or Stop is called.
+func (p *Puller) Pull(ctx context.Context, req PullRequest) error {
+	if req.URL == "" {
+		return fmt.Errorf("url is required")
+	}
+	if req.StreamKey == "" {
+		return fmt.Errorf("streamKey is required")
+	}
+
+	p.mu.Lock()
+	if _, exists := p.pulls[req.StreamKey]; exists {
+		p.mu.Unlock()
+		return fmt.Errorf("pull already active for stream key %q", req.StreamKey)
+	}
+	p.mu.Unlock()
+
+	mediaURL := req.URL
+	pl, variants, err := p.fetchPlaylist(ctx, mediaURL)
+	if err != nil {
+		return err
+	}
+	if variants != nil {
+		mediaURL = bestVariant(variants).url
+		p.log.Info("selected variant", "stream_key", req.StreamKey, "url", mediaURL)
+		if pl, variants, err = p.fetchPlaylist(ctx, mediaURL); err != nil {
+			return err
+		}
+		if variants != nil {
+			return fmt.Errorf("variant %s is not a media playlist", mediaURL)
+		}
+	}
+
+	pullCtx, cancel := context.WithCancel(ctx)
+
+	p.mu.Lock()
+	if _, exists := p.pulls[req.StreamKey]; exists {
+		p.mu.Unlock()
+		cancel()
+		return fmt.Errorf("pull already active for stream key %q", req.StreamKey)
+	}
+	p.pulls[req.StreamKey] = &activePull{req: req, cancel: cancel}
+	p.mu.Unlock()
+
+	p.log.Info("pulling", "url", mediaURL, "stream_key", req.StreamKey, "live", !pl.endList)
+
+	stream, writer := p.registry.Register(req.StreamKey, ingest.FormatMPEGTS, ingest.ProtocolHLS)
+	stream.SetRemoteAddr(mediaURL)
+
+	go func() {
+		var err error
+		defer func() {
+			cancel()
+			stream.RecordEnd(err)
+			stats := stream.IngestStats()
+			p.registry.Release(stream)
+			p.mu.Lock()
+			delete(p.pulls, req.StreamKey)
+			p.mu.Unlock()
+			p.log.Info("pull ended", "stream_key", req.StreamKey,
+				"bytes", stats.BytesReceived, "uptime_ms", stats.UptimeMs)
+		}()
+		err = p.run(pullCtx, req.StreamKey, mediaURL, pl, stream, writer)
+		if pullCtx.Err() != nil {
+			err = nil // stopped
+		}
+		if err != nil {
+			p.log.Warn("pull failed", "stream_key", req.StreamKey, "error", err)
+		}
+	}()
+
+	return nil
+}
+
+// run writes the segments of the media playlist at mediaURL, starting
+// from pl, its first load, to w in media sequence order, reloading the
+// playlist while it is live. Segments after a discontinuity, or after a
+// gap left by a failed fetch or by falling behind the playlist, are marked
+// as discontinuous for the demuxer.
+func (p *Puller) run(ctx context.Context, key, mediaURL string, pl *mediaPlaylist, s *ingest.Stream, w io.Writer) error {
+	next := startSequence(pl)
+	started, gap := false, false
+	failures := 0
+	for {
+		if !started {
+			// A live playlist can be empty when first loaded; start
+			// from the live edge of the first with segments.
+			next = max(next, startSequence(pl))
+		}
+		added := false
+		for _, seg := range pl.segments {
+			if seg.seq < next {
+				continue
+			}
+			if started && seg.seq > next {
+				p.log.Warn("segments expired before they were fetched",
+					"stream_key", key, "from", next, "to", seg.seq-1)
+				gap = true
+			}
+			data, err := p.fetchSegment(ctx, seg.url)
+			if err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				// Skip the segment, leaving a gap before the next.
+				p.log.Warn("segment fetch failed", "stream_key", key, "seq", seg.seq, "error", err)
+				next, added, gap = seg.seq+1, true, true
+				continue
+			}
+			s.RecordRead(len(data))
+			if started && (seg.discontinuity || gap) {
+				data = markDiscontinuity(data)
+			}
+			if _, err := w.Write(data); err != nil {
+				return fmt.Errorf("write segment: %w", err)
+			}
+			next, added, started, gap = seg.seq+1, true, true, false
+		}
+		if pl.endList {
+			return nil
+		}
+
+		// Reload after a target duration, or half of one if the playlist
+		// had nothing new (RFC 8216 6.3.4).
+		wait := pl.targetDuration
+		if p.reloadWait > 0 {
+			wait = p.reloadWait
+		}
+		if !added {
+			wait /= 2
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+
+		reloaded, variants, err := p.fetchPlaylist(ctx, mediaURL)
+		if err == nil && variants != nil {
+			err = errors.New("media playlist became a multivariant playlist")
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if failures++; failures >= maxPlaylistFailures {
+				return fmt.Errorf("playlist reload failed %d times: %w", failures, err)
+			}
+			p.log.Warn("playlist reload failed", "stream_key", key, "error", err)
+			continue
+		}
+		failures = 0
+
+		// A media sequence behind where the pull is means the origin
+		// restarted its playlist; start again from its live edge.
+		if n := len(reloaded.segments); n > 0 && reloaded.segments[n-1].seq+1 < next {
+			p.log.Warn("media sequence went backward; restarting from the live edge",
+				"stream_key", key, "expected", next, "last", reloaded.segments[n-1].seq)
+			next = startSequence(reloaded)
+			for i := range reloaded.segments {
+				if reloaded.segments[i].seq == next {
+					reloaded.segments[i].discontinuity = true
+				}
+			}
+		}
+		pl = reloaded
+	}
+}
+
+// startSequence returns the media sequence number a pull of pl starts at:
+// its first segment for a finished playlist, and otherwise a few segments
+// from its live edge.
+func startSequence(pl *mediaPlaylist) uint64 {
+	n := len(pl.segments)
+	if n == 0 {
+		return 0
+	}
+	if pl.endList || n <= liveStartSegments {
+		return pl.segments[0].seq
+	}
+	return pl.segments[n-liveStartSegments].seq
+}
+
+// fetchPlaylist loads and parses the playlist at rawURL.
+func (p *Puller) fetchPlaylist(ctx context.Context, rawURL string) (*mediaPlaylist, []variant, error) {
+	base, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("bad playlist URL: %w", err)
+	}
+	body, err := p.get(ctx, rawURL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("fetch playlist: %w", err)
+	}
+	defer body.Close()
+	return parsePlaylist(io.LimitReader(body, maxPlaylistSize), base)
+}
+
+// fetchSegment downloads the segment at rawURL. A trailing partial TS
+// packet is dropped.
+func (p *Puller) fetchSegment(ctx context.Context, rawURL string) ([]byte, error) {
+	body, err := p.get(ctx, rawURL)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	data, err := io.ReadAll(io.LimitReader(body, maxSegmentSize))
+	if err != nil {
+		return nil, err
+	}
+	return data[:len(data)-len(data)%tsPacketSize], nil
+}
+
+// get issues a GET for rawURL, returning the body of a 200 response.
+func (p *Puller) get(ctx context.Context, rawURL string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("GET %s: %s", rawURL, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// markDiscontinuity sets the adaptation field discontinuity_indicator on
+// the first packet of each PID in a segment that starts a PES packet. The
+// demuxer then resets timestamp continuity for those streams rather than
+// counting the jump across the segment boundary as an error. It returns
+// data, which grows by a packet for a PID whose packet had to make room
+// for the indicator with no stuffing to absorb the payload it displaced.
+func markDiscontinuity(data []byte) []byte {
+	seen := make(map[uint16]bool)
+	for off := 0; off+tsPacketSize <= len(data); off += tsPacketSize {
+		pkt := data[off : off+tsPacketSize]
+		if pkt[0] != 0x47 {
+			break
+		}
+		pid := packetPID(pkt)
+		pusi := pkt[1]&0x40 != 0
+		if !pusi || seen[pid] {
+			continue
+		}
+		seen[pid] = true
+		switch {
+		case pkt[3]&0x20 != 0 && pkt[4] > 0: // adaptation field with flags
+			pkt[5] |= 0x80
+		case pkt[3]&0x10 != 0:
+			data = insertDiscontinuity(data, off)
+		}
+	}
+	return data
+}
+
+// insertDiscontinuity gives the packet at off, which carries a payload but
+// no adaptation field flags, an adaptation field with the
+// discontinuity_indicator set. The payload bytes it displaces shift along
+// the rest of the PES packet in data into the stuffing of a later packet
+// of the PID or, when there is none, into a packet inserted after the
+// last, renumbering the continuity counters that follow it.
+func insertDiscontinuity(data []byte, off int) []byte {
+	pkt := data[off : off+tsPacketSize]
+	pid := packetPID(pkt)
+	need := 2 // adaptation_field_length and the flags
+	if pkt[3]&0x20 != 0 {
+		need = 1 // an empty adaptation field lacks only the flags
+	}
+	start := payloadOffset(pkt)
+	carry := slices.Clone(pkt[tsPacketSize-need:])
+	copy(pkt[start+need:], pkt[start:tsPacketSize-need])
+	pkt[3] |= 0x20
+	pkt[4], pkt[5] = 1, 0x80
+
+	last := off
+	for o := off + tsPacketSize; o+tsPacketSize <= len(data); o += tsPacketSize {
+		next := data[o : o+tsPacketSize]
+		if next[0] != 0x47 {
+			break
+		}
+		if packetPID(next) != pid || next[3]&0x10 == 0 {
+			continue
+		}
+		start := payloadOffset(next)
+		if next[1]&0x40 != 0 || start+need > tsPacketSize {
+			break // the next PES packet, or no payload to shift
+		}
+		if next[3]&0x20 != 0 && next[4] > byte(need) && next[5] == 0 {
+			// Stuffing only: shrink it to fit what was displaced.
+			next[4] -= byte(need)
+			copy(next[start-need:], carry)
+			return data
+		}
+		displaced := slices.Clone(next[tsPacketSize-need:])
+		copy(next[start+need:], next[start:tsPacketSize-need])
+		copy(next[start:], carry)
+		carry, last = displaced, o
+	}
+
+	extra := make([]byte, tsPacketSize)
+	extra[0], extra[1], extra[2] = 0x47, data[last+1]&0x1F, data[last+2]
+	extra[3] = 0x30 | (data[last+3]+1)&0x0F
+	extra[4] = byte(tsPacketSize - 5 - need)
+	for i := 6; i < tsPacketSize-need; i++ {
+		extra[i] = 0xFF
+	}
+	copy(extra[tsPacketSize-need:], carry)
+	for o := last + tsPacketSize; o+tsPacketSize <= len(data); o += tsPacketSize {
+		next := data[o : o+tsPacketSize]
+		if next[0] == 0x47 && packetPID(next) == pid && next[3]&0x10 != 0 {
+			next[3] = next[3]&0xF0 | (next[3]+1)&0x0F
+		}
+	}
+	return slices.Insert(data, last+tsPacketSize, extra...)
+}
+
+// packetPID returns the PID of the TS packet pkt.
+func packetPID(pkt []byte) uint16 {
+	return uint16(pkt[1]&0x1F)<<8 | uint16(pkt[2])
+}
+
+// payloadOffset returns where the payload of the TS packet pkt starts,
+// past its adaptation field.
+func payloadOffset(pkt []byte) int {
+	if pkt[3]&0x20 == 0 {
+		return 4
+	}
+	return 5 + int(pkt[4])
+}
+
+// Stop stops the active pull for streamKey.
+func (p *Puller) Stop(streamKey string) error {
+	p.mu.Lock()
+	ap, ok := p.pulls[streamKey]
+	p.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("no active pull for stream key %q", streamKey)
+	}
+
+	ap.cancel()
+	return nil
+}
+
+// ActivePulls returns the requests of all active pulls.
+func (p *Puller) ActivePulls() []PullRequest {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	out := make([]PullRequest, 0, len(p.pulls))
+	for _, ap := range p.pulls {
+		out = append(out, ap.req)
+	}
+	return out
+}
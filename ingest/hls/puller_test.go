@@ -0,0 +1,245 @@
+package hls
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zsiec/prism/ingest"
+)
+
+// tsSegment returns a segment of three TS packets on one PID, tagged with
+// id. The first starts a PES packet and has an adaptation field.
+func tsSegment(id byte) []byte {
+	seg := make([]byte, 3*tsPacketSize)
+	for i := range 3 {
+		pkt := seg[i*tsPacketSize : (i+1)*tsPacketSize]
+		pkt[0], pkt[1], pkt[2], pkt[3] = 0x47, 0x01, 0x00, 0x10|byte(i)
+		if i == 0 {
+			pkt[1] |= 0x40 // payload_unit_start_indicator
+			pkt[3] |= 0x20 // adaptation field
+			pkt[4], pkt[5] = 1, 0
+		}
+		pkt[len(pkt)-1] = id
+	}
+	return seg
+}
+
+// marked returns seg with the discontinuity_indicator of its first packet
+// set, as the puller marks a segment after a discontinuity.
+func marked(seg []byte) []byte {
+	out := append([]byte(nil), seg...)
+	out[5] |= 0x80
+	return out
+}
+
+// origin is a fake HLS origin. Each playlist request after the first
+// slides a live window of segments forward by one, until the window
+// reaches endAt and the playlist ends.
+type origin struct {
+	mu       sync.Mutex
+	first    uint64 // media sequence of the window's first segment
+	window   uint64
+	endAt    uint64 // first sequence at which the playlist ends; 0 never
+	disco    uint64 // sequence with a discontinuity before it; 0 none
+	requests int
+}
+
+func (o *origin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var id byte
+	if _, err := fmt.Sscanf(r.URL.Path, "/seg%d.ts", &id); err == nil {
+		w.Write(tsSegment(id))
+		return
+	}
+	if r.URL.Path != "/live.m3u8" {
+		http.NotFound(w, r)
+		return
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.requests > 0 && (o.endAt == 0 || o.first < o.endAt) {
+		o.first++
+	}
+	o.requests++
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "#EXTM3U\n#EXT-X-TARGETDURATION:2\n#EXT-X-MEDIA-SEQUENCE:%d\n", o.first)
+	for seq := o.first; seq < o.first+o.window; seq++ {
+		if seq == o.disco && seq != 0 {
+			b.WriteString("#EXT-X-DISCONTINUITY\n")
+		}
+		fmt.Fprintf(&b, "#EXTINF:2.0,\nseg%d.ts\n", seq)
+	}
+	if o.endAt != 0 && o.first >= o.endAt {
+		b.WriteString("#EXT-X-ENDLIST\n")
+	}
+	io.WriteString(w, b.String())
+}
+
+// pull starts pulling the origin's playlist and returns a channel that
+// receives everything the registry is fed once the pull ends.
+func pull(t *testing.T, o *origin) (*Puller, <-chan []byte) {
+	t.Helper()
+	srv := httptest.NewServer(o)
+	t.Cleanup(srv.Close)
+
+	got := make(chan []byte, 1)
+	registry := ingest.NewRegistry(func(_ string, input io.Reader, _ ingest.InputFormat, _ string) {
+		data, _ := io.ReadAll(input)
+		got <- data
+	})
+	p := NewPuller(registry, srv.Client(), nil)
+	p.reloadWait = 5 * time.Millisecond
+	if err := p.Pull(context.Background(), PullRequest{URL: srv.URL + "/live.m3u8", StreamKey: "hls"}); err != nil {
+		t.Fatal(err)
+	}
+	return p, got
+}
+
+func receive(t *testing.T, got <-chan []byte) []byte {
+	t.Helper()
+	select {
+	case data := <-got:
+		return data
+	case <-time.After(5 * time.Second):
+		t.Fatal("pull did not end")
+		return nil
+	}
+}
+
+func TestPullerFinishedPlaylist(t *testing.T) {
+	t.Parallel()
+
+	// A playlist that has already ended is pulled from its start.
+	o := &origin{first: 10, window: 3, endAt: 10, disco: 12}
+	_, got := pull(t, o)
+
+	want := bytes.Join([][]byte{tsSegment(10), tsSegment(11), marked(tsSegment(12))}, nil)
+	if data := receive(t, got); !bytes.Equal(data, want) {
+		t.Errorf("got %d bytes, want %d: segments 10, 11 and 12 marked discontinuous", len(data), len(want))
+	}
+}
+
+func TestPullerLivePlaylist(t *testing.T) {
+	t.Parallel()
+
+	// Five segments in the window, starting three from the end: 2, 3
+	// and 4, then one more per reload until the window ends at 4-8.
+	o := &origin{window: 5, endAt: 4}
+	p, got := pull(t, o)
+	if pulls := p.ActivePulls(); len(pulls) != 1 || pulls[0].StreamKey != "hls" {
+		t.Errorf("ActivePulls = %+v, want the hls pull", pulls)
+	}
+
+	var want []byte
+	for id := byte(2); id <= 8; id++ {
+		want = append(want, tsSegment(id)...)
+	}
+	if data := receive(t, got); !bytes.Equal(data, want) {
+		t.Errorf("got %d bytes, want segments 2 through 8 (%d bytes)", len(data), len(want))
+	}
+}
+
+func TestPullerStop(t *testing.T) {
+	t.Parallel()
+
+	p, got := pull(t, &origin{window: 4})
+	if err := p.Stop("hls"); err != nil {
+		t.Fatal(err)
+	}
+	receive(t, got)
+	if err := p.Stop("other"); err == nil {
+		t.Error("Stop of an unknown key succeeded")
+	}
+}
+
+func TestMarkDiscontinuity(t *testing.T) {
+	t.Parallel()
+
+	seg := append(tsSegment(1), tsSegment(2)...)
+	seg = markDiscontinuity(seg)
+	if seg[5]&0x80 == 0 {
+		t.Error("first packet of the PID not marked")
+	}
+	if seg[3*tsPacketSize+5]&0x80 != 0 {
+		t.Error("later packet of the same PID marked")
+	}
+}
+
+func TestMarkDiscontinuityWithoutAdaptationField(t *testing.T) {
+	t.Parallel()
+
+	// packet returns a packet on PID 0x100 whose payload of n bytes
+	// counts up from first, after an adaptation field of stuffing.
+	packet := func(pusi bool, cc, first byte, n int) []byte {
+		pkt := make([]byte, tsPacketSize)
+		pkt[0], pkt[1], pkt[2], pkt[3] = 0x47, 0x01, 0x00, 0x10|cc
+		if pusi {
+			pkt[1] |= 0x40
+		}
+		start := tsPacketSize - n
+		if start > 4 {
+			pkt[3] |= 0x20
+			pkt[4] = byte(start - 5)
+			for i := 6; i < start; i++ {
+				pkt[i] = 0xFF
+			}
+		}
+		for i := range n {
+			pkt[start+i] = first + byte(i)
+		}
+		return pkt
+	}
+
+	tests := []struct {
+		name    string
+		packets [][]byte
+		want    int // packets after marking
+	}{
+		{"empty field", [][]byte{packet(true, 0, 0, 183), packet(false, 1, 183, 100)}, 2},
+		{"stuffing absorbs", [][]byte{packet(true, 0, 0, 184), packet(false, 1, 184, 184), packet(false, 2, 112, 100)}, 3},
+		{"packet inserted", [][]byte{packet(true, 0, 0, 184), packet(false, 1, 184, 184), packet(true, 2, 0, 184)}, 4},
+		{"empty field inserted", [][]byte{packet(true, 0, 0, 183)}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			seg := bytes.Join(tt.packets, nil)
+			want := payloads(seg)
+			seg = markDiscontinuity(seg)
+
+			if n := len(seg) / tsPacketSize; n != tt.want {
+				t.Fatalf("got %d packets, want %d", n, tt.want)
+			}
+			if seg[3]&0x20 == 0 || seg[4] == 0 || seg[5]&0x80 == 0 {
+				t.Fatal("first packet not marked")
+			}
+			if got := payloads(seg); !bytes.Equal(got, want) {
+				t.Errorf("payload changed:\n got %x\nwant %x", got, want)
+			}
+			for i := range len(seg) / tsPacketSize {
+				if cc := seg[i*tsPacketSize+3] & 0x0F; cc != byte(i) {
+					t.Errorf("packet %d: continuity counter %d", i, cc)
+				}
+			}
+		})
+	}
+}
+
+// payloads returns the payloads of the TS packets in seg, concatenated.
+func payloads(seg []byte) []byte {
+	var out []byte
+	for off := 0; off < len(seg); off += tsPacketSize {
+		pkt := seg[off : off+tsPacketSize]
+		out = append(out, pkt[payloadOffset(pkt):]...)
+	}
+	return out
+}
@@ -4,6 +4,7 @@ package ingest
 
 import (
 	"io"
+	"slices"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -17,6 +18,13 @@ const (
 	FormatMPEGTS InputFormat = iota
 )
 
+// Ingest protocol names, reported with a stream's stats so a viewer can
+// tell how the source reached the server.
+const (
+	ProtocolSRT = "SRT"
+	ProtocolHLS = "HLS"
+)
+
 // IngestStats captures connection-level metrics for an ingest stream,
 // exposed via the debug API for monitoring source health.
 type IngestStats struct {
@@ -25,6 +33,14 @@ type IngestStats struct {
 	ConnectedAt   int64  `json:"connectedAt"`
 	UptimeMs      int64  `json:"uptimeMs"`
 	RemoteAddr    string `json:"remoteAddr"`
+
+	// Read failures recorded by InstrumentReader. ReadErrors counts every
+	// non-EOF failure, including the timeouts and resets broken out below.
+	ReadErrors   int64  `json:"readErrors"`
+	ReadTimeouts int64  `json:"readTimeouts"`
+	ReadResets   int64  `json:"readResets"`
+	LastError    string `json:"lastError,omitempty"`
+	EndReason    string `json:"endReason,omitempty"`
 }
 
 // Stream represents an active ingest connection, coupling the raw byte
@@ -34,6 +50,7 @@ type Stream struct {
 	Key       string
 	StartedAt time.Time
 	Format    InputFormat
+	Protocol  string
 	input     io.ReadCloser
 	pw        io.WriteCloser
 	done      chan struct{}
@@ -41,10 +58,17 @@ type Stream struct {
 	bytesReceived atomic.Int64
 	readCount     atomic.Int64
 	remoteAddr    atomic.Value
+
+	readErrors   atomic.Int64
+	readTimeouts atomic.Int64
+	readResets   atomic.Int64
+	lastError    atomic.Value // string
+	endReason    atomic.Value // string, one of the ReadEnd constants
 }
 
-// RecordRead increments the byte and read counters, called by the SRT
-// receiver after each successful socket read.
+// RecordRead increments the byte and read counters. Readers wrapped with
+// InstrumentReader call it after each successful read; sources not read
+// through one, like HLS pulls, call it for each chunk they receive.
 func (s *Stream) RecordRead(n int) {
 	s.bytesReceived.Add(int64(n))
 	s.readCount.Add(1)
@@ -59,79 +83,119 @@ func (s *Stream) SetRemoteAddr(addr string) {
 // IngestStats returns a snapshot of ingest connection metrics.
 func (s *Stream) IngestStats() IngestStats {
 	addr, _ := s.remoteAddr.Load().(string)
+	lastErr, _ := s.lastError.Load().(string)
+	endReason, _ := s.endReason.Load().(string)
 	return IngestStats{
 		BytesReceived: s.bytesReceived.Load(),
 		ReadCount:     s.readCount.Load(),
 		ConnectedAt:   s.StartedAt.UnixMilli(),
 		UptimeMs:      time.Since(s.StartedAt).Milliseconds(),
 		RemoteAddr:    addr,
+		ReadErrors:    s.readErrors.Load(),
+		ReadTimeouts:  s.readTimeouts.Load(),
+		ReadResets:    s.readResets.Load(),
+		LastError:     lastErr,
+		EndReason:     endReason,
 	}
 }
 
 // Registry tracks active ingest streams by key and dispatches new streams
 // to the onStream callback for pipeline setup. It is the rendezvous point
 // between the SRT ingest layer and the demux/distribution pipeline.
+//
+// More than one publisher can connect with the same key; whether the
+// later ones are rejected, replace the first or run under another key is
+// decided by the onStream callback. Until they are released, the registry
+// holds them all, in connection order.
 type Registry struct {
 	mu      sync.RWMutex
-	streams map[string]*Stream
+	streams map[string][]*Stream
 
-	onStream func(key string, input io.Reader, format InputFormat)
+	onStream func(key string, input io.Reader, format InputFormat, protocol string)
 }
 
 // NewRegistry creates a Registry. The onStream callback is invoked
 // asynchronously whenever a new stream is registered.
-func NewRegistry(onStream func(key string, input io.Reader, format InputFormat)) *Registry {
+func NewRegistry(onStream func(key string, input io.Reader, format InputFormat, protocol string)) *Registry {
 	return &Registry{
-		streams:  make(map[string]*Stream),
+		streams:  make(map[string][]*Stream),
 		onStream: onStream,
 	}
 }
 
 // Register creates a new ingest stream with the given key and format,
-// returning the Stream and a Writer that the SRT receiver should write into.
-// If OnStream is set, the callback is invoked asynchronously.
-func (r *Registry) Register(key string, format InputFormat) (*Stream, io.Writer) {
+// received over protocol, returning the Stream and a Writer that the
+// receiver should write into. If OnStream is set, the callback is invoked
+// asynchronously.
+func (r *Registry) Register(key string, format InputFormat, protocol string) (*Stream, io.Writer) {
 	pr, pw := io.Pipe()
 
 	stream := &Stream{
 		Key:       key,
 		StartedAt: time.Now(),
 		Format:    format,
+		Protocol:  protocol,
 		input:     pr,
 		pw:        pw,
 		done:      make(chan struct{}),
 	}
 
 	r.mu.Lock()
-	r.streams[key] = stream
+	r.streams[key] = append(r.streams[key], stream)
 	r.mu.Unlock()
 
 	if r.onStream != nil {
-		go r.onStream(key, pr, format)
+		go r.onStream(key, pr, format, protocol)
 	}
 
 	return stream, pw
 }
 
-// Unregister removes a stream by key, closing its pipe and signaling Done.
+// Unregister removes the oldest stream registered under key, closing its
+// pipe and signaling Done.
 func (r *Registry) Unregister(key string) {
 	r.mu.Lock()
-	stream, ok := r.streams[key]
-	if ok {
-		delete(r.streams, key)
+	streams := r.streams[key]
+	if len(streams) > 0 {
+		r.removeLocked(streams[0])
 	}
 	r.mu.Unlock()
+}
+
+// Release removes stream, closing its pipe and signaling Done, if it is
+// still registered. Ingest connections release their own stream when they
+// end, which leaves any other publisher on the same key registered.
+func (r *Registry) Release(stream *Stream) {
+	r.mu.Lock()
+	r.removeLocked(stream)
+	r.mu.Unlock()
+}
 
-	if ok {
-		stream.pw.Close()
-		close(stream.done)
+// removeLocked removes and closes stream if it is registered. The caller
+// must hold r.mu.
+func (r *Registry) removeLocked(stream *Stream) {
+	streams := r.streams[stream.Key]
+	i := slices.Index(streams, stream)
+	if i < 0 {
+		return
+	}
+	if streams = slices.Delete(streams, i, i+1); len(streams) == 0 {
+		delete(r.streams, stream.Key)
+	} else {
+		r.streams[stream.Key] = streams
 	}
+	stream.pw.Close()
+	close(stream.done)
 }
 
-// Get returns the Stream for the given key, or false if not found.
+// Get returns the oldest Stream registered under key, or false if there is
+// none.
 func (r *Registry) Get(key string) (*Stream, bool) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
-	s, ok := r.streams[key]
-	return s, ok
+	streams := r.streams[key]
+	if len(streams) == 0 {
+		return nil, false
+	}
+	return streams[0], true
 }
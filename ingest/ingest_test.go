@@ -1,8 +1,15 @@
 package ingest
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
 	"io"
+	"os"
+	"slices"
+	"strings"
 	"sync"
+	"syscall"
 	"testing"
 	"time"
 )
@@ -11,7 +18,7 @@ func TestRegistryRegisterAndGet(t *testing.T) {
 	t.Parallel()
 
 	r := NewRegistry(nil)
-	stream, w := r.Register("test-stream", FormatMPEGTS)
+	stream, w := r.Register("test-stream", FormatMPEGTS, ProtocolSRT)
 
 	if stream.Key != "test-stream" {
 		t.Fatalf("got key %q, want %q", stream.Key, "test-stream")
@@ -46,7 +53,7 @@ func TestRegistryUnregister(t *testing.T) {
 	t.Parallel()
 
 	r := NewRegistry(nil)
-	r.Register("stream1", FormatMPEGTS)
+	r.Register("stream1", FormatMPEGTS, ProtocolSRT)
 
 	r.Unregister("stream1")
 
@@ -68,7 +75,7 @@ func TestRegistryUnregisterClosesPipe(t *testing.T) {
 	t.Parallel()
 
 	r := NewRegistry(nil)
-	stream, _ := r.Register("stream1", FormatMPEGTS)
+	stream, _ := r.Register("stream1", FormatMPEGTS, ProtocolSRT)
 	r.Unregister("stream1")
 
 	// Reading from the input side should return EOF after pipe is closed.
@@ -79,23 +86,53 @@ func TestRegistryUnregisterClosesPipe(t *testing.T) {
 	}
 }
 
+func TestRegistryReleaseSharedKey(t *testing.T) {
+	t.Parallel()
+
+	r := NewRegistry(nil)
+	first, _ := r.Register("stream1", FormatMPEGTS, ProtocolSRT)
+	second, _ := r.Register("stream1", FormatMPEGTS, ProtocolSRT)
+
+	if got, _ := r.Get("stream1"); got != first {
+		t.Fatal("Get should return the first publisher")
+	}
+
+	r.Release(first)
+	if got, ok := r.Get("stream1"); !ok || got != second {
+		t.Fatal("releasing the first publisher should leave the second registered")
+	}
+	select {
+	case <-second.done:
+		t.Fatal("releasing the first publisher closed the second")
+	default:
+	}
+
+	r.Release(first) // already released: no-op
+	r.Release(second)
+	if _, ok := r.Get("stream1"); ok {
+		t.Fatal("stream still found after releasing every publisher")
+	}
+}
+
 func TestRegistryOnStreamCallback(t *testing.T) {
 	t.Parallel()
 
 	var mu sync.Mutex
 	var calledKey string
 	var calledFormat InputFormat
+	var calledProtocol string
 
 	done := make(chan struct{})
-	r := NewRegistry(func(key string, _ io.Reader, format InputFormat) {
+	r := NewRegistry(func(key string, _ io.Reader, format InputFormat, protocol string) {
 		mu.Lock()
 		calledKey = key
 		calledFormat = format
+		calledProtocol = protocol
 		mu.Unlock()
 		close(done)
 	})
 
-	r.Register("cb-stream", FormatMPEGTS)
+	r.Register("cb-stream", FormatMPEGTS, ProtocolHLS)
 
 	select {
 	case <-done:
@@ -111,13 +148,16 @@ func TestRegistryOnStreamCallback(t *testing.T) {
 	if calledFormat != FormatMPEGTS {
 		t.Fatalf("callback got format %d, want %d", calledFormat, FormatMPEGTS)
 	}
+	if calledProtocol != ProtocolHLS {
+		t.Fatalf("callback got protocol %q, want %q", calledProtocol, ProtocolHLS)
+	}
 }
 
 func TestStreamRecordRead(t *testing.T) {
 	t.Parallel()
 
 	r := NewRegistry(nil)
-	stream, _ := r.Register("s1", FormatMPEGTS)
+	stream, _ := r.Register("s1", FormatMPEGTS, ProtocolSRT)
 
 	stream.RecordRead(100)
 	stream.RecordRead(200)
@@ -131,11 +171,125 @@ func TestStreamRecordRead(t *testing.T) {
 	}
 }
 
+type timeoutErr struct{}
+
+func (timeoutErr) Error() string   { return "i/o timeout" }
+func (timeoutErr) Timeout() bool   { return true }
+func (timeoutErr) Temporary() bool { return true }
+
+func TestClassifyReadError(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"nil", nil, ""},
+		{"eof", io.EOF, ReadEndEOF},
+		{"wrapped eof", fmt.Errorf("srt: %w", io.EOF), ReadEndEOF},
+		{"deadline", os.ErrDeadlineExceeded, ReadEndTimeout},
+		{"net timeout", timeoutErr{}, ReadEndTimeout},
+		{"conn reset", syscall.ECONNRESET, ReadEndReset},
+		{"broken pipe", fmt.Errorf("read: %w", syscall.EPIPE), ReadEndReset},
+		{"unexpected eof", io.ErrUnexpectedEOF, ReadEndReset},
+		{"other", errors.New("boom"), ReadEndError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := ClassifyReadError(tt.err); got != tt.want {
+				t.Fatalf("ClassifyReadError(%v) = %q, want %q", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+// scriptedReader returns each chunk in turn, then err.
+type scriptedReader struct {
+	chunks []string
+	err    error
+}
+
+func (r *scriptedReader) Read(p []byte) (int, error) {
+	if len(r.chunks) == 0 {
+		return 0, r.err
+	}
+	n := copy(p, r.chunks[0])
+	r.chunks = r.chunks[1:]
+	return n, nil
+}
+
+func TestStreamInstrumentReader(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		err          error
+		wantErrors   int64
+		wantTimeouts int64
+		wantResets   int64
+		wantEnd      string
+	}{
+		{"clean eof", io.EOF, 0, 0, 0, ReadEndEOF},
+		{"timeout", os.ErrDeadlineExceeded, 1, 1, 0, ReadEndTimeout},
+		{"reset", syscall.ECONNRESET, 1, 0, 1, ReadEndReset},
+		{"other", errors.New("boom"), 1, 0, 0, ReadEndError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := NewRegistry(nil)
+			stream, _ := r.Register("s1", FormatMPEGTS, ProtocolSRT)
+			src := stream.InstrumentReader(&scriptedReader{
+				chunks: []string{"abcd", "efghij"},
+				err:    tt.err,
+			})
+
+			data, err := io.ReadAll(src)
+			if tt.err == io.EOF {
+				if err != nil {
+					t.Fatalf("ReadAll: %v", err)
+				}
+			} else if !errors.Is(err, tt.err) {
+				t.Fatalf("ReadAll error = %v, want %v", err, tt.err)
+			}
+			if string(data) != "abcdefghij" {
+				t.Fatalf("data = %q", data)
+			}
+
+			stats := stream.IngestStats()
+			if stats.BytesReceived != 10 || stats.ReadCount != 2 {
+				t.Fatalf("bytes/reads = %d/%d, want 10/2", stats.BytesReceived, stats.ReadCount)
+			}
+			if stats.ReadErrors != tt.wantErrors {
+				t.Fatalf("ReadErrors = %d, want %d", stats.ReadErrors, tt.wantErrors)
+			}
+			if stats.ReadTimeouts != tt.wantTimeouts {
+				t.Fatalf("ReadTimeouts = %d, want %d", stats.ReadTimeouts, tt.wantTimeouts)
+			}
+			if stats.ReadResets != tt.wantResets {
+				t.Fatalf("ReadResets = %d, want %d", stats.ReadResets, tt.wantResets)
+			}
+			if stats.EndReason != tt.wantEnd {
+				t.Fatalf("EndReason = %q, want %q", stats.EndReason, tt.wantEnd)
+			}
+			if tt.wantErrors > 0 && !strings.Contains(stats.LastError, tt.err.Error()) {
+				t.Fatalf("LastError = %q, want %q", stats.LastError, tt.err.Error())
+			}
+			if tt.wantErrors == 0 && stats.LastError != "" {
+				t.Fatalf("LastError = %q, want empty", stats.LastError)
+			}
+		})
+	}
+}
+
 func TestStreamSetRemoteAddr(t *testing.T) {
 	t.Parallel()
 
 	r := NewRegistry(nil)
-	stream, _ := r.Register("s1", FormatMPEGTS)
+	stream, _ := r.Register("s1", FormatMPEGTS, ProtocolSRT)
 
 	stream.SetRemoteAddr("192.168.1.1:5000")
 
@@ -149,7 +303,7 @@ func TestStreamIngestStatsUptime(t *testing.T) {
 	t.Parallel()
 
 	r := NewRegistry(nil)
-	stream, _ := r.Register("s1", FormatMPEGTS)
+	stream, _ := r.Register("s1", FormatMPEGTS, ProtocolSRT)
 
 	// Sleep briefly to ensure uptime is measurable.
 	time.Sleep(10 * time.Millisecond)
@@ -174,7 +328,7 @@ func TestRegistryConcurrentAccess(t *testing.T) {
 		go func(n int) {
 			defer wg.Done()
 			key := "stream-" + string(rune('A'+n%26))
-			r.Register(key, FormatMPEGTS)
+			r.Register(key, FormatMPEGTS, ProtocolSRT)
 			r.Get(key)
 			r.Unregister(key)
 		}(i)
@@ -182,3 +336,58 @@ func TestRegistryConcurrentAccess(t *testing.T) {
 
 	wg.Wait()
 }
+
+// tsPackets returns n null-payload TS packets.
+func tsPackets(n int) []byte {
+	out := make([]byte, 0, n*tsPacketSize)
+	for range n {
+		pkt := make([]byte, tsPacketSize)
+		pkt[0], pkt[1], pkt[2], pkt[3] = tsSyncByte, 0x1F, 0xFF, 0x10
+		out = append(out, pkt...)
+	}
+	return out
+}
+
+func TestSniff(t *testing.T) {
+	t.Parallel()
+
+	strayPacket := append(tsPackets(1), make([]byte, 2*tsPacketSize)...)
+	var m2ts []byte
+	for pkt := range slices.Chunk(tsPackets(10), tsPacketSize) {
+		m2ts = append(append(m2ts, 0, 0, 0, 0), pkt...)
+	}
+	tests := []struct {
+		name  string
+		input []byte
+		ok    bool
+	}{
+		{"aligned TS", tsPackets(10), true},
+		{"TS joined mid-packet", append(make([]byte, 100), tsPackets(10)...), true},
+		{"short TS", tsPackets(1), true},
+		{"M2TS", m2ts, true},
+		{"raw H.264", append([]byte{0, 0, 0, 1, 0x67, 0x42}, make([]byte, 1000)...), false},
+		{"FLV", append([]byte("FLV\x01\x05"), make([]byte, 1000)...), false},
+		{"one sync byte", strayPacket, false},
+		{"empty", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			format, r, err := Sniff(bytes.NewReader(tt.input))
+			if !tt.ok {
+				if !errors.Is(err, ErrUnknownFormat) {
+					t.Fatalf("Sniff() err = %v, want ErrUnknownFormat", err)
+				}
+				return
+			}
+			if err != nil || format != FormatMPEGTS {
+				t.Fatalf("Sniff() = %v, %v; want mpegts", format, err)
+			}
+			got, err := io.ReadAll(r)
+			if err != nil || !bytes.Equal(got, tt.input) {
+				t.Errorf("reader returned %d bytes (err %v), want all %d of the input", len(got), err, len(tt.input))
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package ingest
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"syscall"
+)
+
+// Read end reasons reported in IngestStats.EndReason, distinguishing a
+// publisher that disconnected cleanly from a link that dropped.
+const (
+	ReadEndEOF     = "eof"
+	ReadEndTimeout = "timeout"
+	ReadEndReset   = "reset"
+	ReadEndError   = "error"
+)
+
+// ClassifyReadError maps an ingest read error to one of the ReadEnd
+// reasons. It returns "" for a nil error.
+func ClassifyReadError(err error) string {
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, io.EOF):
+		return ReadEndEOF
+	case errors.Is(err, os.ErrDeadlineExceeded):
+		return ReadEndTimeout
+	case errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, syscall.ECONNABORTED),
+		errors.Is(err, syscall.EPIPE),
+		errors.Is(err, io.ErrUnexpectedEOF):
+		return ReadEndReset
+	}
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return ReadEndTimeout
+	}
+	return ReadEndError
+}
+
+// countingReader records every read from an ingest source on its Stream.
+type countingReader struct {
+	r io.Reader
+	s *Stream
+}
+
+// InstrumentReader wraps the raw ingest source r so that bytes, reads and
+// read errors are recorded on the stream and surfaced by IngestStats. The
+// SRT receivers read the socket through it.
+func (s *Stream) InstrumentReader(r io.Reader) io.Reader {
+	return &countingReader{r: r, s: s}
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if n > 0 {
+		c.s.RecordRead(n)
+	}
+	if err != nil {
+		c.s.recordReadError(err)
+	}
+	return n, err
+}
+
+// RecordEnd records err as the reason the stream ended, as a failed read
+// of an instrumented reader does. A nil err is a clean end.
+func (s *Stream) RecordEnd(err error) {
+	if err == nil {
+		err = io.EOF
+	}
+	s.recordReadError(err)
+}
+
+// recordReadError counts a failed read. Clean EOF is not an error but is
+// still recorded as the end reason.
+func (s *Stream) recordReadError(err error) {
+	reason := ClassifyReadError(err)
+	s.endReason.Store(reason)
+	if reason == ReadEndEOF {
+		return
+	}
+	s.readErrors.Add(1)
+	s.lastError.Store(err.Error())
+	switch reason {
+	case ReadEndTimeout:
+		s.readTimeouts.Add(1)
+	case ReadEndReset:
+		s.readResets.Add(1)
+	}
+}
@@ -0,0 +1,77 @@
+package ingest
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrUnknownFormat is returned by Sniff for input in no supported format.
+var ErrUnknownFormat = errors.New("ingest: unrecognized input format")
+
+const (
+	tsPacketSize = 188
+	tsSyncByte   = 0x47
+
+	// m2tsPacketSize and rsPacketSize are the packet sizes of M2TS, with
+	// a 4-byte timestamp before each TS packet, and of TS with 16 bytes of
+	// Reed-Solomon parity after each.
+	m2tsPacketSize = 192
+	rsPacketSize   = 204
+
+	// sniffPackets is how many sync bytes, one packet apart, identify
+	// MPEG-TS. A single 0x47 is common in other data; three in a row at
+	// the packet stride are not.
+	sniffPackets = 3
+
+	// sniffLen covers sniffPackets packets of the largest size from any
+	// offset in the first packet, so a stream joined mid-packet is still
+	// recognized.
+	sniffLen = sniffPackets*rsPacketSize + rsPacketSize - 1
+)
+
+// String returns the format's name.
+func (f InputFormat) String() string {
+	switch f {
+	case FormatMPEGTS:
+		return "mpegts"
+	}
+	return fmt.Sprintf("InputFormat(%d)", int(f))
+}
+
+// Sniff identifies the container format of r from its first bytes,
+// blocking until enough have arrived or r ends. It returns a reader that
+// yields all of r, including the bytes inspected. Input in no supported
+// format fails with ErrUnknownFormat, so it can be rejected up front
+// rather than demuxed into a flood of corruption errors.
+func Sniff(r io.Reader) (InputFormat, io.Reader, error) {
+	br := bufio.NewReaderSize(r, sniffLen)
+	head, err := br.Peek(sniffLen)
+	switch {
+	case len(head) == 0:
+		return 0, br, fmt.Errorf("%w: no data: %w", ErrUnknownFormat, err)
+	case isMPEGTS(head):
+		return FormatMPEGTS, br, nil
+	}
+	return 0, br, fmt.Errorf("%w: starts with % x", ErrUnknownFormat, head[:min(len(head), 8)])
+}
+
+// isMPEGTS reports whether head looks like a transport stream of 188-,
+// 192- or 204-byte packets: from some offset in the first packet, a sync
+// byte starts each of sniffPackets packets, or each complete packet of a
+// stream shorter than that.
+func isMPEGTS(head []byte) bool {
+	for _, size := range []int{tsPacketSize, m2tsPacketSize, rsPacketSize} {
+		for off := range min(size, len(head)) {
+			n := 0
+			for p := off; p < len(head) && head[p] == tsSyncByte; p += size {
+				n++
+			}
+			if n >= sniffPackets || n > 0 && off+n*size >= len(head) && off+size <= len(head) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"math/rand/v2"
 	"sync"
 	"time"
 
@@ -18,22 +19,92 @@ import (
 type PullRequest struct {
 	Address   string `json:"address"`
 	StreamKey string `json:"streamKey"`
-	StreamID  string `json:"streamId,omitempty"`
+
+	// StreamID is sent verbatim when set, overriding Resource and User.
+	StreamID string `json:"streamId,omitempty"`
+
+	// Resource and User, when either is set, build an access control
+	// stream ID in request mode ("#!::r=...,m=request,u=..."), which
+	// standards-compliant listeners require of callers. Resource
+	// defaults to "live/" + StreamKey.
+	Resource string `json:"resource,omitempty"`
+	User     string `json:"user,omitempty"`
+}
+
+// streamID returns the stream ID to send: StreamID if set, a request-mode
+// access control stream ID if Resource or User is set, and otherwise the
+// plain "live/" + StreamKey the bundled tools use.
+func (r PullRequest) streamID() string {
+	if r.StreamID != "" {
+		return r.StreamID
+	}
+	resource := r.Resource
+	if resource == "" {
+		resource = "live/" + r.StreamKey
+	}
+	if r.Resource == "" && r.User == "" {
+		return resource
+	}
+	return StreamID{Resource: resource, Mode: ModeRequest, User: r.User}.String()
+}
+
+// Reconnect defaults: how long a pull waits between dials when the policy
+// leaves it unset, the fraction of that wait added at random, and how long
+// a connection must last for the pull to count as healthy again.
+const (
+	defaultReconnectInterval = 2 * time.Second
+	reconnectJitter          = 0.25
+	stableConnection         = time.Minute
+	dialTimeout              = 10 * time.Second
+)
+
+// ReconnectPolicy controls how a pull whose connection drops is redialed,
+// so that a flapping source is not hammered with connection attempts.
+type ReconnectPolicy struct {
+	// MaxAttempts is how many redials in a row may fail, or connect only
+	// to drop again within a minute, before the pull is given up on and
+	// removed. Zero never redials: the pull ends with its connection.
+	MaxAttempts int
+
+	// MinInterval is the least time between two dials of one pull. Up to
+	// a quarter of it again is added at random to each wait, so pulls
+	// from one failed remote do not redial it in step. Zero uses two
+	// seconds.
+	MinInterval time.Duration
+}
+
+// PullStatus is an active pull with the state of its reconnection.
+type PullStatus struct {
+	PullRequest
+
+	// Attempts counts the redials since the pull's connection was last
+	// healthy, and NextRetry is when it is next redialed; it is zero
+	// while the pull is connected or dialing.
+	Attempts  int
+	NextRetry time.Time
 }
 
 type activePull struct {
 	req    PullRequest
 	cancel context.CancelFunc
+
+	// attempts and nextRetry are guarded by Caller.mu.
+	attempts  int
+	nextRetry time.Time
 }
 
 // Caller manages SRT pull connections, dialing remote SRT sources
 // and streaming their data into the ingest registry.
 type Caller struct {
-	log      *slog.Logger
-	registry *ingest.Registry
+	log       *slog.Logger
+	registry  *ingest.Registry
+	reconnect ReconnectPolicy
 
 	mu    sync.Mutex
 	pulls map[string]*activePull
+
+	// dial connects to a pull's source; it is dialSRT except in tests.
+	dial func(ctx context.Context, req PullRequest) (io.ReadCloser, error)
 }
 
 // NewCaller creates a Caller that uses the given registry to register
@@ -42,16 +113,25 @@ func NewCaller(registry *ingest.Registry, log *slog.Logger) *Caller {
 	if log == nil {
 		log = slog.Default()
 	}
-	return &Caller{
+	c := &Caller{
 		log:      log.With("component", "srt-caller"),
 		registry: registry,
 		pulls:    make(map[string]*activePull),
 	}
+	c.dial = c.dialSRT
+	return c
+}
+
+// SetReconnect sets how pulls whose connection drops are redialed. By
+// default they are not. Call it before Pull.
+func (c *Caller) SetReconnect(p ReconnectPolicy) {
+	c.reconnect = p
 }
 
 // Pull dials the remote SRT listener synchronously (with a timeout),
 // returning an error if the connection fails. On success, streaming
-// continues in a background goroutine.
+// continues in a background goroutine, redialing the source under the
+// reconnect policy if the connection drops.
 func (c *Caller) Pull(ctx context.Context, req PullRequest) error {
 	if req.Address == "" {
 		return fmt.Errorf("address is required")
@@ -67,15 +147,19 @@ func (c *Caller) Pull(ctx context.Context, req PullRequest) error {
 	}
 	c.mu.Unlock()
 
-	c.log.Info("dialing", "address", req.Address, "stream_key", req.StreamKey)
+	conn, err := c.dial(ctx, req)
+	if err != nil {
+		return err
+	}
+	return c.startStreaming(ctx, req, conn)
+}
 
-	cfg := srtgo.DefaultConfig()
-	cfg.Latency = srtLatencyNs
+// dialSRT dials the source of req, giving up after dialTimeout.
+func (c *Caller) dialSRT(ctx context.Context, req PullRequest) (io.ReadCloser, error) {
+	streamID := req.streamID()
+	c.log.Info("dialing", "address", req.Address, "stream_key", req.StreamKey, "stream_id", streamID)
 
-	streamID := req.StreamID
-	if streamID == "" {
-		streamID = "live/" + req.StreamKey
-	}
+	cfg := DefaultConfig()
 	cfg.StreamID = streamID
 
 	type dialResult struct {
@@ -88,16 +172,15 @@ func (c *Caller) Pull(ctx context.Context, req PullRequest) error {
 		ch <- dialResult{conn, err}
 	}()
 
-	dialTimeout := 10 * time.Second
 	timer := time.NewTimer(dialTimeout)
 	defer timer.Stop()
 
 	select {
 	case res := <-ch:
 		if res.err != nil {
-			return fmt.Errorf("SRT dial failed: %w", res.err)
+			return nil, fmt.Errorf("SRT dial failed: %w", res.err)
 		}
-		return c.startStreaming(ctx, req, res.conn)
+		return res.conn, nil
 	case <-timer.C:
 		// Drain the dial result in the background and close any leaked connection.
 		go func() {
@@ -105,7 +188,7 @@ func (c *Caller) Pull(ctx context.Context, req PullRequest) error {
 				res.conn.Close()
 			}
 		}()
-		return fmt.Errorf("SRT dial timed out after %s", dialTimeout)
+		return nil, fmt.Errorf("SRT dial timed out after %s", dialTimeout)
 	case <-ctx.Done():
 		// Drain the dial result in the background and close any leaked connection.
 		go func() {
@@ -113,12 +196,13 @@ func (c *Caller) Pull(ctx context.Context, req PullRequest) error {
 				res.conn.Close()
 			}
 		}()
-		return ctx.Err()
+		return nil, ctx.Err()
 	}
 }
 
-func (c *Caller) startStreaming(ctx context.Context, req PullRequest, conn *srtgo.Conn) error {
+func (c *Caller) startStreaming(ctx context.Context, req PullRequest, conn io.ReadCloser) error {
 	pullCtx, cancel := context.WithCancel(ctx)
+	ap := &activePull{req: req, cancel: cancel}
 
 	c.mu.Lock()
 	if _, exists := c.pulls[req.StreamKey]; exists {
@@ -127,48 +211,124 @@ func (c *Caller) startStreaming(ctx context.Context, req PullRequest, conn *srtg
 		conn.Close()
 		return fmt.Errorf("pull already active for stream key %q", req.StreamKey)
 	}
-	c.pulls[req.StreamKey] = &activePull{req: req, cancel: cancel}
+	c.pulls[req.StreamKey] = ap
 	c.mu.Unlock()
 
 	c.log.Info("connected", "address", req.Address, "stream_key", req.StreamKey)
 
-	stream, writer := c.registry.Register(req.StreamKey, ingest.FormatMPEGTS)
+	stream, writer := c.registry.Register(req.StreamKey, ingest.FormatMPEGTS, ingest.ProtocolSRT)
 	stream.SetRemoteAddr(req.Address)
 
 	go func() {
 		defer func() {
-			conn.Close()
+			cancel()
 			stats := stream.IngestStats()
-			c.registry.Unregister(req.StreamKey)
+			c.registry.Release(stream)
 			c.mu.Lock()
 			delete(c.pulls, req.StreamKey)
 			c.mu.Unlock()
 			c.log.Info("pull ended", "stream_key", req.StreamKey,
 				"bytes", stats.BytesReceived, "reads", stats.ReadCount,
-				"uptime_ms", stats.UptimeMs)
+				"uptime_ms", stats.UptimeMs, "end", stats.EndReason)
 		}()
+		c.run(pullCtx, ap, stream, writer, conn)
+	}()
+
+	return nil
+}
+
+// run streams conn, and each connection redialed after it drops, into w
+// until the pull is stopped, the pipeline stops reading or the reconnect
+// policy gives up on the source. The stream stays registered throughout,
+// so the pipeline carries on across reconnects.
+func (c *Caller) run(ctx context.Context, ap *activePull, stream *ingest.Stream, w io.Writer, conn io.ReadCloser) {
+	key := ap.req.StreamKey
+	lastDial := time.Now()
+	attempts := 0
+	for {
+		connected := time.Now()
+		if !c.receive(ctx, key, stream, w, conn) {
+			return
+		}
+		if time.Since(connected) >= stableConnection {
+			attempts = 0
+		}
 
-		buf := make([]byte, srtReadBufferSize)
-		for {
-			if pullCtx.Err() != nil {
-				break
+		for conn = nil; conn == nil; {
+			if attempts >= c.reconnect.MaxAttempts {
+				if attempts > 0 {
+					c.log.Warn("pull failed, giving up reconnecting", "stream_key", key, "attempts", attempts)
+				}
+				return
 			}
-			n, err := conn.Read(buf)
-			if err != nil {
-				if !errors.Is(err, io.EOF) {
-					c.log.Debug("read error", "stream_key", req.StreamKey, "error", err)
+			attempts++
+			wait := c.reconnectWait(lastDial)
+			c.setReconnectState(ap, attempts, time.Now().Add(wait))
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+			c.setReconnectState(ap, attempts, time.Time{})
+
+			lastDial = time.Now()
+			var err error
+			if conn, err = c.dial(ctx, ap.req); err != nil {
+				if ctx.Err() != nil {
+					return
 				}
-				break
+				c.log.Warn("reconnect failed", "stream_key", key, "attempt", attempts, "error", err)
 			}
-			stream.RecordRead(n)
-			if _, err := writer.Write(buf[:n]); err != nil {
-				c.log.Debug("pipe write error", "stream_key", req.StreamKey, "error", err)
-				break
+		}
+		c.log.Info("reconnected", "address", ap.req.Address, "stream_key", key, "attempt", attempts)
+	}
+}
+
+// receive copies conn into w until either fails or ctx is done, then
+// closes conn. It reports whether the source dropped, as opposed to the
+// pull being stopped or the pipeline no longer reading.
+func (c *Caller) receive(ctx context.Context, key string, stream *ingest.Stream, w io.Writer, conn io.ReadCloser) bool {
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	src := stream.InstrumentReader(conn)
+	buf := make([]byte, srtReadBufferSize)
+	for {
+		n, err := src.Read(buf)
+		if ctx.Err() != nil {
+			return false
+		}
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				c.log.Debug("read error", "stream_key", key, "error", err)
 			}
+			return true
 		}
-	}()
+		if _, err := w.Write(buf[:n]); err != nil {
+			c.log.Debug("pipe write error", "stream_key", key, "error", err)
+			return false
+		}
+	}
+}
 
-	return nil
+// reconnectWait returns how long to wait before redialing a pull last
+// dialed at lastDial: the rest of the minimum interval, plus jitter.
+func (c *Caller) reconnectWait(lastDial time.Time) time.Duration {
+	interval := c.reconnect.MinInterval
+	if interval <= 0 {
+		interval = defaultReconnectInterval
+	}
+	wait := max(time.Until(lastDial.Add(interval)), 0)
+	return wait + time.Duration(rand.Int64N(int64(float64(interval)*reconnectJitter)+1))
+}
+
+func (c *Caller) setReconnectState(ap *activePull, attempts int, next time.Time) {
+	c.mu.Lock()
+	ap.attempts, ap.nextRetry = attempts, next
+	c.mu.Unlock()
 }
 
 func (c *Caller) Stop(streamKey string) error {
@@ -184,13 +344,14 @@ func (c *Caller) Stop(streamKey string) error {
 	return nil
 }
 
-func (c *Caller) ActivePulls() []PullRequest {
+// ActivePulls returns the pulls that are connected or reconnecting.
+func (c *Caller) ActivePulls() []PullStatus {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	out := make([]PullRequest, 0, len(c.pulls))
+	out := make([]PullStatus, 0, len(c.pulls))
 	for _, ap := range c.pulls {
-		out = append(out, ap.req)
+		out = append(out, PullStatus{PullRequest: ap.req, Attempts: ap.attempts, NextRetry: ap.nextRetry})
 	}
 	return out
 }
@@ -0,0 +1,168 @@
+package srt
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zsiec/prism/ingest"
+)
+
+func TestPullRequestStreamID(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		req  PullRequest
+		want string
+	}{
+		{
+			name: "default",
+			req:  PullRequest{StreamKey: "cam1"},
+			want: "live/cam1",
+		},
+		{
+			name: "raw override",
+			req:  PullRequest{StreamKey: "cam1", StreamID: "#!::r=x,m=request", Resource: "y", User: "z"},
+			want: "#!::r=x,m=request",
+		},
+		{
+			name: "resource",
+			req:  PullRequest{StreamKey: "cam1", Resource: "studio/a"},
+			want: "#!::r=studio/a,m=request",
+		},
+		{
+			name: "resource and user",
+			req:  PullRequest{StreamKey: "cam1", Resource: "studio/a", User: "prism"},
+			want: "#!::r=studio/a,m=request,u=prism",
+		},
+		{
+			name: "user defaults resource",
+			req:  PullRequest{StreamKey: "cam1", User: "prism"},
+			want: "#!::r=live/cam1,m=request,u=prism",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			if got := tc.req.streamID(); got != tc.want {
+				t.Errorf("streamID() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+// newTestCaller returns a Caller whose pulls dial with dial and whose
+// streams are drained.
+func newTestCaller(dial func(context.Context, PullRequest) (io.ReadCloser, error)) *Caller {
+	reg := ingest.NewRegistry(func(_ string, input io.Reader, _ ingest.InputFormat, _ string) {
+		io.Copy(io.Discard, input)
+	})
+	c := NewCaller(reg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	c.dial = dial
+	return c
+}
+
+// waitForPulls polls c until cond holds for its active pulls.
+func waitForPulls(t *testing.T, c *Caller, what string, cond func([]PullStatus) bool) {
+	t.Helper()
+	deadline := time.After(5 * time.Second)
+	for !cond(c.ActivePulls()) {
+		select {
+		case <-deadline:
+			t.Fatalf("timed out waiting for %s; pulls %+v", what, c.ActivePulls())
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
+
+func TestCallerReconnect(t *testing.T) {
+	t.Parallel()
+
+	const interval = 20 * time.Millisecond
+	tests := []struct {
+		name      string
+		policy    ReconnectPolicy
+		wantDials int
+	}{
+		{"no policy", ReconnectPolicy{}, 1},
+		{"gives up", ReconnectPolicy{MaxAttempts: 3, MinInterval: interval}, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			// Every connection delivers a byte and drops; the second redial
+			// is refused outright.
+			var mu sync.Mutex
+			var dials []time.Time
+			c := newTestCaller(func(context.Context, PullRequest) (io.ReadCloser, error) {
+				mu.Lock()
+				defer mu.Unlock()
+				dials = append(dials, time.Now())
+				if len(dials) == 3 {
+					return nil, errors.New("connection refused")
+				}
+				return io.NopCloser(strings.NewReader("x")), nil
+			})
+			c.SetReconnect(tt.policy)
+
+			if err := c.Pull(context.Background(), PullRequest{Address: "src:6000", StreamKey: "cam1"}); err != nil {
+				t.Fatal(err)
+			}
+			waitForPulls(t, c, "the pull to end", func(p []PullStatus) bool { return len(p) == 0 })
+
+			mu.Lock()
+			defer mu.Unlock()
+			if len(dials) != tt.wantDials {
+				t.Fatalf("dialed %d times, want %d", len(dials), tt.wantDials)
+			}
+			for i := 1; i < len(dials); i++ {
+				if gap := dials[i].Sub(dials[i-1]); gap < interval {
+					t.Errorf("dial %d came %v after the last, want at least %v", i, gap, interval)
+				}
+			}
+		})
+	}
+}
+
+func TestCallerReconnectStatusAndStop(t *testing.T) {
+	t.Parallel()
+
+	var dials int
+	c := newTestCaller(func(context.Context, PullRequest) (io.ReadCloser, error) {
+		dials++
+		return io.NopCloser(strings.NewReader("")), nil
+	})
+	c.SetReconnect(ReconnectPolicy{MaxAttempts: 5, MinInterval: time.Hour})
+
+	start := time.Now()
+	if err := c.Pull(context.Background(), PullRequest{Address: "src:6000", StreamKey: "cam1"}); err != nil {
+		t.Fatal(err)
+	}
+	waitForPulls(t, c, "a scheduled retry", func(p []PullStatus) bool {
+		return len(p) == 1 && !p[0].NextRetry.IsZero()
+	})
+	p := c.ActivePulls()[0]
+	if p.Attempts != 1 || p.StreamKey != "cam1" {
+		t.Errorf("status = %+v, want attempt 1 of cam1", p)
+	}
+	if wait := p.NextRetry.Sub(start); wait < time.Hour || wait > time.Hour*5/4+time.Second {
+		t.Errorf("next retry in %v, want an hour plus at most a quarter", wait)
+	}
+
+	// Stopping a pull waiting to redial ends it at once.
+	if err := c.Stop("cam1"); err != nil {
+		t.Fatal(err)
+	}
+	waitForPulls(t, c, "the pull to end", func(p []PullStatus) bool { return len(p) == 0 })
+	if dials != 1 {
+		t.Errorf("dialed %d times, want 1", dials)
+	}
+}
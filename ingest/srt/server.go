@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
-	"strings"
 
 	srtgo "github.com/zsiec/srtgo"
 
@@ -20,6 +19,14 @@ const srtReadBufferSize = 1316 * 10
 // srtLatencyNs is the SRT latency setting in nanoseconds (120ms).
 const srtLatencyNs = 120_000_000
 
+// DefaultConfig returns the SRT configuration Prism uses for connections
+// it accepts and dials: srtgo's defaults with a 120ms latency.
+func DefaultConfig() srtgo.Config {
+	cfg := srtgo.DefaultConfig()
+	cfg.Latency = srtLatencyNs
+	return cfg
+}
+
 // Server accepts incoming SRT publish connections and registers them
 // with the ingest registry for demuxing.
 type Server struct {
@@ -44,21 +51,13 @@ func NewServer(addr string, registry *ingest.Registry, log *slog.Logger) *Server
 // Start begins accepting SRT publish connections. It blocks until the
 // context is cancelled.
 func (s *Server) Start(ctx context.Context) error {
-	cfg := srtgo.DefaultConfig()
-	cfg.Latency = srtLatencyNs
-
-	l, err := srtgo.Listen(s.addr, cfg)
+	l, err := srtgo.Listen(s.addr, DefaultConfig())
 	if err != nil {
 		return fmt.Errorf("SRT listen on %s: %w", s.addr, err)
 	}
 	s.log.Info("listening", "addr", s.addr)
 
-	l.SetAcceptRejectFunc(func(req srtgo.ConnRequest) srtgo.RejectReason {
-		if req.StreamID == "" {
-			return srtgo.RejPeer
-		}
-		return 0
-	})
+	l.SetAcceptRejectFunc(s.accept)
 
 	go func() {
 		<-ctx.Done()
@@ -75,32 +74,54 @@ func (s *Server) Start(ctx context.Context) error {
 			continue
 		}
 
-		streamKey := extractStreamKey(conn.StreamID())
-		s.log.Info("publish", "stream_key", streamKey, "remote", conn.RemoteAddr())
+		// The accept callback already rejected stream IDs that fail to
+		// parse.
+		id, _ := ParseStreamID(conn.StreamID())
+		streamKey := id.StreamKey()
+		s.log.Info("publish", "stream_key", streamKey, "user", id.User, "remote", conn.RemoteAddr())
 
 		go s.handleConnection(ctx, conn, streamKey)
 	}
 }
 
+// accept is the listener's accept callback. It rejects connections
+// without a valid publish stream ID.
+func (s *Server) accept(req srtgo.ConnRequest) srtgo.RejectReason {
+	if req.StreamID == "" {
+		return srtgo.RejPeer
+	}
+	id, err := ParseStreamID(req.StreamID)
+	if err != nil {
+		s.log.Warn("rejecting connection", "stream_id", req.StreamID, "error", err)
+		return srtgo.RejPeer
+	}
+	if id.Mode == ModeRequest {
+		// This listener only accepts publishers.
+		s.log.Warn("rejecting request-mode connection", "stream_id", req.StreamID)
+		return srtgo.RejPeer
+	}
+	return 0
+}
+
 func (s *Server) handleConnection(ctx context.Context, conn *srtgo.Conn, streamKey string) {
 	defer conn.Close()
 
-	stream, writer := s.registry.Register(streamKey, ingest.FormatMPEGTS)
+	stream, writer := s.registry.Register(streamKey, ingest.FormatMPEGTS, ingest.ProtocolSRT)
 	stream.SetRemoteAddr(conn.RemoteAddr().String())
 
+	src := stream.InstrumentReader(conn)
 	buf := make([]byte, srtReadBufferSize)
 	for {
 		if ctx.Err() != nil {
 			break
 		}
-		n, err := conn.Read(buf)
+		n, err := src.Read(buf)
 		if err != nil {
 			if !errors.Is(err, io.EOF) {
 				s.log.Debug("read error", "stream_key", streamKey, "error", err)
 			}
 			break
 		}
-		stream.RecordRead(n)
 		if _, err := writer.Write(buf[:n]); err != nil {
 			s.log.Debug("pipe write error", "stream_key", streamKey, "error", err)
 			break
@@ -108,17 +129,8 @@ func (s *Server) handleConnection(ctx context.Context, conn *srtgo.Conn, streamK
 	}
 
 	stats := stream.IngestStats()
-	s.registry.Unregister(streamKey)
+	s.registry.Release(stream)
 	s.log.Info("connection closed", "stream_key", streamKey,
 		"bytes", stats.BytesReceived, "reads", stats.ReadCount,
-		"uptime_ms", stats.UptimeMs)
-}
-
-func extractStreamKey(streamID string) string {
-	streamID = strings.TrimPrefix(streamID, "/")
-	streamID = strings.TrimPrefix(streamID, "live/")
-	if streamID == "" {
-		return "default"
-	}
-	return streamID
+		"uptime_ms", stats.UptimeMs, "end", stats.EndReason)
 }
@@ -1,32 +1,32 @@
 package srt
 
-import "testing"
+import (
+	"testing"
 
-func TestExtractStreamKey(t *testing.T) {
+	srtgo "github.com/zsiec/srtgo"
+)
+
+func TestServerAccept(t *testing.T) {
 	t.Parallel()
 
 	tests := []struct {
 		name     string
 		streamID string
-		want     string
+		reject   bool
 	}{
-		{name: "simple key", streamID: "camera1", want: "camera1"},
-		{name: "leading slash", streamID: "/camera1", want: "camera1"},
-		{name: "live prefix", streamID: "live/camera1", want: "camera1"},
-		{name: "slash and live prefix", streamID: "/live/camera1", want: "camera1"},
-		{name: "empty returns default", streamID: "", want: "default"},
-		{name: "just slash returns default", streamID: "/", want: "default"},
-		{name: "just live/ returns default", streamID: "live/", want: "default"},
-		{name: "nested path preserved", streamID: "studio/camera1", want: "studio/camera1"},
-		{name: "live in name preserved", streamID: "liveshow", want: "liveshow"},
+		{name: "plain key", streamID: "camera1"},
+		{name: "publish mode", streamID: "#!::r=camera2,m=publish"},
+		{name: "empty", streamID: "", reject: true},
+		{name: "request mode", streamID: "#!::r=camera1,m=request", reject: true},
+		{name: "malformed", streamID: "#!::bad", reject: true},
 	}
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
 			t.Parallel()
-			got := extractStreamKey(tc.streamID)
-			if got != tc.want {
-				t.Errorf("extractStreamKey(%q) = %q, want %q", tc.streamID, got, tc.want)
+			s := NewServer(":0", nil, nil)
+			if got := s.accept(srtgo.ConnRequest{StreamID: tc.streamID}); (got != 0) != tc.reject {
+				t.Errorf("accept(%q) = %v, want reject %v", tc.streamID, got, tc.reject)
 			}
 		})
 	}
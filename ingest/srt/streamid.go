@@ -0,0 +1,102 @@
+package srt
+
+import (
+	"fmt"
+	"strings"
+)
+
+// streamIDPrefix introduces a stream ID in the SRT access control syntax
+// (https://github.com/Haivision/srt/blob/master/docs/features/access-control.md).
+const streamIDPrefix = "#!::"
+
+// Stream ID connection modes.
+const (
+	ModeRequest       = "request"
+	ModePublish       = "publish"
+	ModeBidirectional = "bidirectional"
+)
+
+// StreamID is a parsed SRT stream ID. A stream ID in the access control
+// syntax, such as "#!::r=live/camera1,m=publish,u=alice", fills the fields
+// from its keys; any other stream ID is a plain resource name.
+type StreamID struct {
+	// Resource names the stream (key r, or the whole plain stream ID).
+	Resource string
+
+	// Mode is the connection mode (key m): ModeRequest, ModePublish or
+	// ModeBidirectional. It is empty when m is absent, which the
+	// specification treats as request but publishers commonly omit.
+	Mode string
+
+	// User (key u) and Token (key token, a common extension) identify
+	// the client for deployments that authenticate publishers.
+	User  string
+	Token string
+}
+
+// ParseStreamID parses an SRT stream ID in either the access control
+// syntax or the plain-key form. It returns an error for a malformed
+// access control stream ID or an unknown mode.
+func ParseStreamID(s string) (StreamID, error) {
+	body, ok := strings.CutPrefix(s, streamIDPrefix)
+	if !ok {
+		return StreamID{Resource: s}, nil
+	}
+
+	var id StreamID
+	for _, pair := range strings.Split(body, ",") {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || key == "" {
+			return StreamID{}, fmt.Errorf("srt: malformed stream ID entry %q", pair)
+		}
+		switch key {
+		case "r":
+			id.Resource = value
+		case "m":
+			switch value {
+			case ModeRequest, ModePublish, ModeBidirectional:
+				id.Mode = value
+			default:
+				return StreamID{}, fmt.Errorf("srt: unknown stream ID mode %q", value)
+			}
+		case "u":
+			id.User = value
+		case "token":
+			id.Token = value
+		}
+	}
+	return id, nil
+}
+
+// String formats the stream ID for a caller to send: a plain resource
+// name when Resource is the only field set, and the access control syntax
+// otherwise. The syntax has no escaping, so values must not contain ','.
+func (id StreamID) String() string {
+	if id.Mode == "" && id.User == "" && id.Token == "" {
+		return id.Resource
+	}
+	var entries []string
+	for _, e := range [...]struct{ key, value string }{
+		{"r", id.Resource},
+		{"m", id.Mode},
+		{"u", id.User},
+		{"token", id.Token},
+	} {
+		if e.value != "" {
+			entries = append(entries, e.key+"="+e.value)
+		}
+	}
+	return streamIDPrefix + strings.Join(entries, ",")
+}
+
+// StreamKey derives the ingest stream key from the resource, dropping a
+// leading "/" and the "live/" prefix used by the bundled tools. An empty
+// resource maps to "default".
+func (id StreamID) StreamKey() string {
+	key := strings.TrimPrefix(id.Resource, "/")
+	key = strings.TrimPrefix(key, "live/")
+	if key == "" {
+		return "default"
+	}
+	return key
+}
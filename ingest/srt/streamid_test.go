@@ -0,0 +1,155 @@
+package srt
+
+import "testing"
+
+func TestStreamKeyLegacy(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		streamID string
+		want     string
+	}{
+		{name: "simple key", streamID: "camera1", want: "camera1"},
+		{name: "leading slash", streamID: "/camera1", want: "camera1"},
+		{name: "live prefix", streamID: "live/camera1", want: "camera1"},
+		{name: "slash and live prefix", streamID: "/live/camera1", want: "camera1"},
+		{name: "empty returns default", streamID: "", want: "default"},
+		{name: "just slash returns default", streamID: "/", want: "default"},
+		{name: "just live/ returns default", streamID: "live/", want: "default"},
+		{name: "nested path preserved", streamID: "studio/camera1", want: "studio/camera1"},
+		{name: "live in name preserved", streamID: "liveshow", want: "liveshow"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			id, err := ParseStreamID(tc.streamID)
+			if err != nil {
+				t.Fatalf("ParseStreamID(%q): %v", tc.streamID, err)
+			}
+			if id.Mode != "" {
+				t.Errorf("ParseStreamID(%q).Mode = %q, want empty", tc.streamID, id.Mode)
+			}
+			if got := id.StreamKey(); got != tc.want {
+				t.Errorf("ParseStreamID(%q).StreamKey() = %q, want %q", tc.streamID, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseStreamIDAccessControl(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		streamID string
+		want     StreamID
+		wantKey  string
+		wantErr  bool
+	}{
+		{
+			name:     "resource and mode",
+			streamID: "#!::r=camera1,m=publish",
+			want:     StreamID{Resource: "camera1", Mode: ModePublish},
+			wantKey:  "camera1",
+		},
+		{
+			name:     "live prefix in resource",
+			streamID: "#!::m=publish,r=live/camera1",
+			want:     StreamID{Resource: "live/camera1", Mode: ModePublish},
+			wantKey:  "camera1",
+		},
+		{
+			name:     "user and token",
+			streamID: "#!::u=alice,r=studio,token=s3cr=t,m=publish",
+			want:     StreamID{Resource: "studio", Mode: ModePublish, User: "alice", Token: "s3cr=t"},
+			wantKey:  "studio",
+		},
+		{
+			name:     "request mode",
+			streamID: "#!::r=camera1,m=request",
+			want:     StreamID{Resource: "camera1", Mode: ModeRequest},
+			wantKey:  "camera1",
+		},
+		{
+			name:     "mode omitted",
+			streamID: "#!::r=camera1",
+			want:     StreamID{Resource: "camera1"},
+			wantKey:  "camera1",
+		},
+		{
+			name:     "unknown keys ignored",
+			streamID: "#!::r=camera1,h=example.com,s=abc123",
+			want:     StreamID{Resource: "camera1"},
+			wantKey:  "camera1",
+		},
+		{
+			name:     "no resource",
+			streamID: "#!::m=publish",
+			want:     StreamID{Mode: ModePublish},
+			wantKey:  "default",
+		},
+		{name: "unknown mode", streamID: "#!::r=camera1,m=watch", wantErr: true},
+		{name: "entry without value", streamID: "#!::r=camera1,publish", wantErr: true},
+		{name: "empty body", streamID: "#!::", wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			id, err := ParseStreamID(tc.streamID)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("ParseStreamID(%q) = %+v, want error", tc.streamID, id)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseStreamID(%q): %v", tc.streamID, err)
+			}
+			if id != tc.want {
+				t.Errorf("ParseStreamID(%q) = %+v, want %+v", tc.streamID, id, tc.want)
+			}
+			if got := id.StreamKey(); got != tc.wantKey {
+				t.Errorf("StreamKey() = %q, want %q", got, tc.wantKey)
+			}
+		})
+	}
+}
+
+func TestStreamIDString(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		id   StreamID
+		want string
+	}{
+		{name: "plain resource", id: StreamID{Resource: "live/camera1"}, want: "live/camera1"},
+		{name: "request mode", id: StreamID{Resource: "camera1", Mode: ModeRequest}, want: "#!::r=camera1,m=request"},
+		{
+			name: "all fields",
+			id:   StreamID{Resource: "studio", Mode: ModePublish, User: "alice", Token: "s3cr=t"},
+			want: "#!::r=studio,m=publish,u=alice,token=s3cr=t",
+		},
+		{name: "user without resource", id: StreamID{User: "alice"}, want: "#!::u=alice"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			got := tc.id.String()
+			if got != tc.want {
+				t.Fatalf("String() = %q, want %q", got, tc.want)
+			}
+			parsed, err := ParseStreamID(got)
+			if err != nil {
+				t.Fatalf("ParseStreamID(%q): %v", got, err)
+			}
+			if parsed != tc.id {
+				t.Errorf("ParseStreamID(%q) = %+v, want %+v", got, parsed, tc.id)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package media
+
+import (
+	"math/bits"
+	"sync"
+	"sync/atomic"
+)
+
+// Frame buffers are pooled in power-of-two size classes from 1 KiB to
+// 4 MiB. Larger buffers are allocated on demand and left to the garbage
+// collector.
+const (
+	minBufferShift = 10
+	maxBufferShift = 22
+)
+
+var bufferPools [maxBufferShift - minBufferShift + 1]sync.Pool
+
+// FrameBuffer is a pooled, reference-counted byte buffer holding a frame's
+// serialized payload, so the relay can share one copy among every viewer
+// and recycle it once the last of them is done. A new buffer holds one
+// reference; each further holder calls Retain, and every holder calls
+// Release exactly once. The buffer returns to the pool when the count
+// reaches zero, so its bytes must not be read after the caller's Release.
+// A holder that never releases only costs the pool a buffer: the garbage
+// collector reclaims it as usual.
+type FrameBuffer struct {
+	buf   []byte
+	class int
+	refs  atomic.Int32
+}
+
+// NewFrameBuffer returns a buffer of length size holding one reference.
+// Its contents are unspecified.
+func NewFrameBuffer(size int) *FrameBuffer {
+	class := max(bits.Len(uint(max(size, 1)-1)), minBufferShift) - minBufferShift
+	var b *FrameBuffer
+	if class < len(bufferPools) {
+		b, _ = bufferPools[class].Get().(*FrameBuffer)
+	}
+	if b == nil {
+		capacity := size
+		if class < len(bufferPools) {
+			capacity = 1 << (class + minBufferShift)
+		}
+		b = &FrameBuffer{buf: make([]byte, capacity), class: class}
+	}
+	b.buf = b.buf[:size]
+	b.refs.Store(1)
+	return b
+}
+
+// Bytes returns the buffer's contents, valid until the caller's Release.
+func (b *FrameBuffer) Bytes() []byte {
+	return b.buf
+}
+
+// Retain adds a reference. It panics if the buffer was already released,
+// since its bytes may belong to another frame by then.
+func (b *FrameBuffer) Retain() {
+	for {
+		n := b.refs.Load()
+		if n <= 0 {
+			panic("media: retain of released frame buffer")
+		}
+		if b.refs.CompareAndSwap(n, n+1) {
+			return
+		}
+	}
+}
+
+// Release drops a reference, returning the buffer to the pool when it was
+// the last one.
+func (b *FrameBuffer) Release() {
+	switch n := b.refs.Add(-1); {
+	case n < 0:
+		panic("media: frame buffer released too many times")
+	case n == 0 && b.class < len(bufferPools):
+		bufferPools[b.class].Put(b)
+	}
+}
+
+// Retain takes a reference to the frame's pooled wire buffer, if it has
+// one, for a holder that reads WireData after the relay may have moved on.
+func (f *VideoFrame) Retain() {
+	if f.WireBuffer != nil {
+		f.WireBuffer.Retain()
+	}
+}
+
+// Release drops a reference taken by Retain, or the relay's own.
+func (f *VideoFrame) Release() {
+	if f.WireBuffer != nil {
+		f.WireBuffer.Release()
+	}
+}
+
+// ReleaseVideo releases every frame in frames.
+func ReleaseVideo(frames []*VideoFrame) {
+	for _, f := range frames {
+		f.Release()
+	}
+}
@@ -0,0 +1,69 @@
+package media
+
+import "testing"
+
+func TestFrameBufferSizes(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		size    int
+		wantCap int
+	}{
+		{0, 1 << 10},
+		{1, 1 << 10},
+		{1 << 10, 1 << 10},
+		{1<<10 + 1, 1 << 11},
+		{1 << 22, 1 << 22},
+		{1<<22 + 1, 1<<22 + 1},
+	}
+
+	for _, tt := range tests {
+		b := NewFrameBuffer(tt.size)
+		if len(b.Bytes()) != tt.size {
+			t.Errorf("NewFrameBuffer(%d): len = %d", tt.size, len(b.Bytes()))
+		}
+		if cap(b.Bytes()) < tt.size || cap(b.Bytes()) > max(tt.wantCap, tt.size) {
+			t.Errorf("NewFrameBuffer(%d): cap = %d, want %d", tt.size, cap(b.Bytes()), tt.wantCap)
+		}
+		b.Release()
+	}
+}
+
+func TestFrameBufferRefs(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		use  func(b *FrameBuffer)
+	}{
+		{"retain after release", func(b *FrameBuffer) { b.Release(); b.Retain() }},
+		{"release twice", func(b *FrameBuffer) { b.Release(); b.Release() }},
+		{"unbalanced retain", func(b *FrameBuffer) { b.Retain(); b.Release(); b.Release(); b.Release() }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			// An unpooled buffer, so no other test can draw it from the
+			// pool once released.
+			b := &FrameBuffer{class: len(bufferPools)}
+			b.refs.Store(1)
+			defer func() {
+				if recover() == nil {
+					t.Error("misuse did not panic")
+				}
+			}()
+			tt.use(b)
+		})
+	}
+}
+
+func TestVideoFrameRetainWithoutBuffer(t *testing.T) {
+	t.Parallel()
+
+	// Frames whose WireData is ordinary memory ignore reference counting.
+	f := &VideoFrame{WireData: []byte{0, 0, 0, 1, 0x65}}
+	f.Retain()
+	f.Release()
+	f.Release()
+}
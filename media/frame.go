@@ -2,6 +2,13 @@
 // processing pipeline, from demuxing through distribution.
 package media
 
+import (
+	"fmt"
+	"time"
+
+	"github.com/zsiec/ccx"
+)
+
 // Channel buffer sizes used by both the demuxer (producer) and viewer sessions
 // (consumer) to decouple frame production from consumption. Sized to absorb
 // jitter without excessive memory: ~2 seconds of video, ~2.5s of audio.
@@ -13,7 +20,8 @@ const (
 
 // VideoFrame represents a single decoded video access unit (one picture) ready
 // for relay to viewers. It carries the raw NAL units in Annex B format along
-// with parameter sets needed by decoders to initialize or reconfigure.
+// with parameter sets needed by decoders to initialize or reconfigure. The
+// parameter sets may be shared between frames and must not be modified.
 type VideoFrame struct {
 	PTS        int64
 	DTS        int64
@@ -25,15 +33,93 @@ type VideoFrame struct {
 	Codec      string // "h264" or "h265"
 	GroupID    uint32
 	WireData   []byte // pre-serialized AVC1 (length-prefixed) NALUs for distribution
+
+	// WireBuffer is the pooled storage behind WireData when the relay
+	// serialized it, or nil when WireData is ordinary memory. Holders
+	// that read WireData pair Retain with Release; see FrameBuffer.
+	WireBuffer *FrameBuffer
+
+	// ArrivedAt is when the frame's data reached the demuxer, on the
+	// monotonic clock, for measuring server-side latency. It is process
+	// local and never serialized; zero when unknown.
+	ArrivedAt time.Time
+
+	// Timecode is the SMPTE time address the source attached to this
+	// frame, or nil if it carried none.
+	Timecode *Timecode
+
+	// Discontinuity marks the keyframe that resumes video after the
+	// source's timestamps jumped backward, as at a splice point. Clients
+	// should reset their decoder and timeline before decoding it.
+	Discontinuity bool
+
+	// Disposable marks a picture no other picture predicts from, such as
+	// a non-reference B-frame, so it can be dropped without damaging the
+	// rest of its group.
+	Disposable bool
+
+	// PTS90k and DTS90k are the frame's timestamps exactly as the source
+	// carried them, in 33-bit 90kHz ticks, where PTS and DTS are converted
+	// to microseconds and rounded down. Has90k reports whether they are
+	// set; it is false when the source carried none or uses another
+	// clock. Zero is a valid tick count.
+	PTS90k int64
+	DTS90k int64
+	Has90k bool
+}
+
+// Timecode is a SMPTE 12M time address (HH:MM:SS:FF).
+type Timecode struct {
+	Hours   int
+	Minutes int
+	Seconds int
+	Frames  int
+}
+
+// String formats the timecode as HH:MM:SS:FF.
+func (tc Timecode) String() string {
+	return fmt.Sprintf("%02d:%02d:%02d:%02d", tc.Hours, tc.Minutes, tc.Seconds, tc.Frames)
+}
+
+// CaptionFrame is one decoded caption update: the whole caption now shown
+// on one caption channel, with its CEA-708 window styling if it has any.
+type CaptionFrame struct {
+	PTS     int64
+	Text    string
+	Channel int // CC1 to CC4 as 1 to 4, then CEA-708 services as the demuxer maps them
+	Regions []ccx.CaptionRegion
+
+	// Service is the CEA-708 service number, 1 to 6, the caption was
+	// decoded from, and Label the label the demuxer's caption channel
+	// mapping gives it. Both are zero for CEA-608 captions.
+	Service int
+	Label   string
 }
 
-// AudioFrame represents a single AAC audio frame (ADTS-wrapped) belonging
-// to a specific audio track. Multi-track streams produce separate AudioFrames
-// with distinct TrackIndex values.
+// Audio codecs an AudioFrame can carry, named by their MoQ catalog codec
+// strings where those are fixed.
+const (
+	AudioCodecAAC  = "aac"
+	AudioCodecAC3  = "ac-3"
+	AudioCodecEAC3 = "ec-3"
+)
+
+// AudioFrame represents a single audio frame belonging to a specific audio
+// track: an ADTS-wrapped AAC frame, or an AC-3 or E-AC-3 sync frame.
+// Multi-track streams produce separate AudioFrames with distinct
+// TrackIndex values.
 type AudioFrame struct {
 	PTS        int64
 	Data       []byte
 	SampleRate int
 	Channels   int
 	TrackIndex int
+	Codec      string // AudioCodecAAC, AudioCodecAC3 or AudioCodecEAC3; empty means AAC
+
+	// PTS90k is the frame's PTS in 33-bit 90kHz ticks, set if Has90k is,
+	// as for VideoFrame.PTS90k. A frame after the first in its PES is
+	// offset from the PES PTS by the samples before it, rounded down to a
+	// tick.
+	PTS90k int64
+	Has90k bool
 }
@@ -5,6 +5,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
+	"time"
 
 	"github.com/quic-go/quic-go/quicvarint"
 )
@@ -15,21 +16,69 @@ const (
 	MsgSubscribeOK    uint64 = 0x04
 	MsgSubscribeError uint64 = 0x05
 	MsgUnsubscribe    uint64 = 0x0a
+	MsgSubscribeDone  uint64 = 0x0b
 	MsgGoAway         uint64 = 0x10
 	MsgMaxRequestID   uint64 = 0x15
+	MsgFetch          uint64 = 0x16
+	MsgFetchCancel    uint64 = 0x17
+	MsgFetchOK        uint64 = 0x18
+	MsgFetchError     uint64 = 0x19
 	MsgClientSetup    uint64 = 0x20
 	MsgServerSetup    uint64 = 0x21
 )
 
+// Namespace discovery message type IDs. Later drafts rename ANNOUNCE to
+// PUBLISH_NAMESPACE and SUBSCRIBE_ANNOUNCES to SUBSCRIBE_NAMESPACE; the
+// IDs and payloads used here are the same.
+const (
+	MsgAnnounce                uint64 = 0x06
+	MsgAnnounceOK              uint64 = 0x07
+	MsgAnnounceError           uint64 = 0x08
+	MsgUnannounce              uint64 = 0x09
+	MsgSubscribeAnnounces      uint64 = 0x11
+	MsgSubscribeAnnouncesOK    uint64 = 0x12
+	MsgSubscribeAnnouncesError uint64 = 0x13
+	MsgUnsubscribeAnnounces    uint64 = 0x14
+)
+
 // Version is the MoQ Transport version: draft-15 uses 0xff000000 + draft number.
 const Version uint64 = 0xff00000f
 
 // Setup parameter keys (draft-15 §6.2).
 const (
-	ParamPath         uint64 = 0x01 // odd → length-prefixed byte string
-	ParamMaxRequestID uint64 = 0x02 // even → varint value
+	ParamPath           uint64 = 0x01 // odd → length-prefixed byte string
+	ParamMaxRequestID   uint64 = 0x02 // even → varint value
+	ParamAuthority      uint64 = 0x05
+	ParamImplementation uint64 = 0x07 // MOQT_IMPLEMENTATION
+)
+
+// Setup parameter keys Prism adds for hints the draft has no setup
+// parameter for. Peers that do not know them ignore them as unknown
+// parameters.
+const (
+	ParamDeliveryTimeout uint64 = 0x7f02 // varint, milliseconds
+	ParamMaxObjectSize   uint64 = 0x7f04 // varint, bytes
+
+	// ParamObjectDatagrams, nonzero in CLIENT_SETUP, says the client
+	// reads OBJECT_DATAGRAMs; nonzero in SERVER_SETUP, that the server
+	// will send audio and small caption objects as datagrams.
+	ParamObjectDatagrams uint64 = 0x7f08 // varint, boolean
 )
 
+// ParamAuthorizationToken is the AUTHORIZATION TOKEN message parameter
+// (draft-15 §9.2.1.1), a byte string starting with an alias type.
+const ParamAuthorizationToken uint64 = 0x03
+
+// AuthTokenUseValue is the alias type of an AUTHORIZATION TOKEN that
+// carries its token type and value inline. Prism keeps no token aliases,
+// so the other alias types are ignored.
+const AuthTokenUseValue uint64 = 0x03
+
+// ParamLiveEdge is a SUBSCRIBE parameter Prism adds: a nonzero varint asks
+// for a video subscription to start at the next live keyframe instead of
+// with the cached group. See Subscribe.LiveEdge.
+const ParamLiveEdge uint64 = 0x7f06
+
 // Subscribe filter types (draft-15 §6.6).
 const (
 	FilterNextGroupStart uint64 = 0x01
@@ -38,6 +87,15 @@ const (
 	FilterAbsoluteRange  uint64 = 0x04
 )
 
+// Fetch types (draft-15 §9.16). A joining fetch retrieves the objects
+// preceding an existing subscription, so together they deliver a track
+// without a gap at the join point.
+const (
+	FetchStandalone      uint64 = 0x01
+	FetchRelativeJoining uint64 = 0x02
+	FetchAbsoluteJoining uint64 = 0x03
+)
+
 // Group order values (draft-15 §6.6).
 const (
 	GroupOrderDefault    byte = 0x00
@@ -45,18 +103,122 @@ const (
 	GroupOrderDescending byte = 0x02
 )
 
+// SubscribeErrorCode is the error code carried in a SUBSCRIBE_ERROR message.
+type SubscribeErrorCode uint64
+
+// SUBSCRIBE_ERROR codes defined by draft-15.
+const (
+	SubscribeErrorInternal           SubscribeErrorCode = 0x0
+	SubscribeErrorUnauthorized       SubscribeErrorCode = 0x1
+	SubscribeErrorTimeout            SubscribeErrorCode = 0x2
+	SubscribeErrorNotSupported       SubscribeErrorCode = 0x3
+	SubscribeErrorTrackDoesNotExist  SubscribeErrorCode = 0x4
+	SubscribeErrorInvalidRange       SubscribeErrorCode = 0x5
+	SubscribeErrorMalformedAuthToken SubscribeErrorCode = 0x10
+	SubscribeErrorExpiredAuthToken   SubscribeErrorCode = 0x12
+)
+
+// SubscribeErrorTooManyRequests is a SUBSCRIBE_ERROR code Prism adds for a
+// request whose ID is at or above the peer's MAX_REQUEST_ID. The draft
+// closes the session with TOO_MANY_REQUESTS instead; rejecting only the
+// request lets a client that miscounts keep its other subscriptions.
+const SubscribeErrorTooManyRequests SubscribeErrorCode = 0x7f08
+
+// String returns the spec name of the error code.
+func (c SubscribeErrorCode) String() string {
+	switch c {
+	case SubscribeErrorInternal:
+		return "INTERNAL_ERROR"
+	case SubscribeErrorUnauthorized:
+		return "UNAUTHORIZED"
+	case SubscribeErrorTimeout:
+		return "TIMEOUT"
+	case SubscribeErrorNotSupported:
+		return "NOT_SUPPORTED"
+	case SubscribeErrorTrackDoesNotExist:
+		return "TRACK_DOES_NOT_EXIST"
+	case SubscribeErrorInvalidRange:
+		return "INVALID_RANGE"
+	case SubscribeErrorMalformedAuthToken:
+		return "MALFORMED_AUTH_TOKEN"
+	case SubscribeErrorExpiredAuthToken:
+		return "EXPIRED_AUTH_TOKEN"
+	case SubscribeErrorTooManyRequests:
+		return "TOO_MANY_REQUESTS"
+	default:
+		return fmt.Sprintf("0x%x", uint64(c))
+	}
+}
+
+// SubscribeDoneStatus is the status code carried in a SUBSCRIBE_DONE message.
+type SubscribeDoneStatus uint64
+
+// SUBSCRIBE_DONE status codes defined by draft-15.
+const (
+	SubscribeDoneInternal          SubscribeDoneStatus = 0x0
+	SubscribeDoneUnauthorized      SubscribeDoneStatus = 0x1
+	SubscribeDoneTrackEnded        SubscribeDoneStatus = 0x2
+	SubscribeDoneSubscriptionEnded SubscribeDoneStatus = 0x3
+	SubscribeDoneGoingAway         SubscribeDoneStatus = 0x4
+	SubscribeDoneExpired           SubscribeDoneStatus = 0x5
+	SubscribeDoneTooFarBehind      SubscribeDoneStatus = 0x6
+)
+
+// String returns the spec name of the status code.
+func (c SubscribeDoneStatus) String() string {
+	switch c {
+	case SubscribeDoneInternal:
+		return "INTERNAL_ERROR"
+	case SubscribeDoneUnauthorized:
+		return "UNAUTHORIZED"
+	case SubscribeDoneTrackEnded:
+		return "TRACK_ENDED"
+	case SubscribeDoneSubscriptionEnded:
+		return "SUBSCRIPTION_ENDED"
+	case SubscribeDoneGoingAway:
+		return "GOING_AWAY"
+	case SubscribeDoneExpired:
+		return "EXPIRED"
+	case SubscribeDoneTooFarBehind:
+		return "TOO_FAR_BEHIND"
+	default:
+		return fmt.Sprintf("0x%x", uint64(c))
+	}
+}
+
 // ClientSetup is the first message sent by a MoQ client.
 type ClientSetup struct {
 	Versions     []uint64
 	Path         string
 	MaxRequestID uint64
 	HasPath      bool
+
+	// Authority and Implementation carry the AUTHORITY and
+	// MOQT_IMPLEMENTATION parameters, empty if absent.
+	Authority      string
+	Implementation string
+
+	// DeliveryTimeout is how long the client will wait for an object
+	// before it is no longer useful, or zero if not given.
+	DeliveryTimeout time.Duration
+
+	// MaxObjectSize is the largest object the client wants to receive, in
+	// bytes, or zero if not given.
+	MaxObjectSize uint64
+
+	// ObjectDatagrams reports the ParamObjectDatagrams hint: the client
+	// can receive objects as datagrams.
+	ObjectDatagrams bool
 }
 
 // ServerSetup is the response to a ClientSetup.
 type ServerSetup struct {
 	SelectedVersion uint64
 	MaxRequestID    uint64
+
+	// ObjectDatagrams sends ParamObjectDatagrams, telling the client that
+	// audio and small caption objects will arrive as datagrams.
+	ObjectDatagrams bool
 }
 
 // Subscribe requests delivery of a track.
@@ -71,6 +233,16 @@ type Subscribe struct {
 	StartGroup uint64 // only for AbsoluteStart / AbsoluteRange
 	StartObj   uint64 // only for AbsoluteStart / AbsoluteRange
 	EndGroup   uint64 // only for AbsoluteRange
+
+	// LiveEdge reports the ParamLiveEdge hint: the subscriber prefers
+	// the lowest latency over a fast start, so video begins at the next
+	// live keyframe rather than replaying the group in progress.
+	LiveEdge bool
+
+	// AuthToken is the value of the subscription's AUTHORIZATION TOKEN
+	// parameter, or "" if it has none. Only tokens sent by value
+	// (AuthTokenUseValue) are read.
+	AuthToken string
 }
 
 // SubscribeOK confirms a subscription.
@@ -87,10 +259,66 @@ type SubscribeOK struct {
 // SubscribeError rejects a subscription.
 type SubscribeError struct {
 	RequestID    uint64
-	ErrorCode    uint64
+	ErrorCode    SubscribeErrorCode
 	ReasonPhrase string
 }
 
+// SubscribeDone tells the subscriber that the publisher will send no more
+// objects for a subscription.
+type SubscribeDone struct {
+	RequestID    uint64
+	StatusCode   SubscribeDoneStatus
+	StreamCount  uint64
+	ReasonPhrase string
+}
+
+// Fetch requests a range of past objects. Only the fields for its
+// FetchType are set: a standalone fetch names the track and range, a
+// joining fetch refers to an existing subscription.
+type Fetch struct {
+	RequestID  uint64
+	Priority   byte
+	GroupOrder byte
+	FetchType  uint64
+
+	// Standalone fetch.
+	Namespace  []string
+	TrackName  string
+	StartGroup uint64
+	StartObj   uint64
+	EndGroup   uint64
+	EndObj     uint64
+
+	// Joining fetch. JoiningStart is a group count before the
+	// subscription's largest group for a relative joining fetch, or an
+	// absolute group ID for an absolute one.
+	JoiningRequestID uint64
+	JoiningStart     uint64
+}
+
+// FetchOK accepts a fetch. EndGroup/EndObj is the last object the fetch
+// will deliver.
+type FetchOK struct {
+	RequestID  uint64
+	GroupOrder byte
+	EndOfTrack bool
+	EndGroup   uint64
+	EndObj     uint64
+}
+
+// FetchError rejects a fetch. FETCH_ERROR shares the SUBSCRIBE_ERROR codes
+// used here.
+type FetchError struct {
+	RequestID    uint64
+	ErrorCode    SubscribeErrorCode
+	ReasonPhrase string
+}
+
+// FetchCancel abandons an in-progress fetch.
+type FetchCancel struct {
+	RequestID uint64
+}
+
 // Unsubscribe cancels a subscription.
 type Unsubscribe struct {
 	RequestID uint64
@@ -101,6 +329,33 @@ type MaxRequestIDMsg struct {
 	RequestID uint64
 }
 
+// SubscribeAnnounces asks the publisher to announce every namespace that
+// starts with Prefix, now and as they come and go.
+type SubscribeAnnounces struct {
+	RequestID uint64
+	Prefix    []string
+}
+
+// SubscribeAnnouncesError rejects a SUBSCRIBE_ANNOUNCES. It shares the
+// SUBSCRIBE_ERROR codes used here.
+type SubscribeAnnouncesError struct {
+	RequestID    uint64
+	ErrorCode    SubscribeErrorCode
+	ReasonPhrase string
+}
+
+// UnsubscribeAnnounces cancels the SUBSCRIBE_ANNOUNCES for Prefix.
+type UnsubscribeAnnounces struct {
+	Prefix []string
+}
+
+// Announce advertises a namespace the publisher serves. RequestID is
+// allocated from the publisher's own request ID space.
+type Announce struct {
+	RequestID uint64
+	Namespace []string
+}
+
 // GoAway signals a graceful session shutdown.
 type GoAway struct {
 	NewSessionURI string
@@ -150,7 +405,12 @@ func WriteControlMsg(w io.Writer, msgType uint64, payload []byte) error {
 	return err
 }
 
-// ParseClientSetup parses a CLIENT_SETUP payload.
+// maxDeliveryTimeoutMS bounds a parsed delivery timeout so converting it
+// to a time.Duration cannot overflow.
+const maxDeliveryTimeoutMS = 1 << 40
+
+// ParseClientSetup parses a CLIENT_SETUP payload. Parameters it does not
+// know are skipped.
 func ParseClientSetup(data []byte) (ClientSetup, error) {
 	r := newBufReader(data)
 	var cs ClientSetup
@@ -186,9 +446,14 @@ func ParseClientSetup(data []byte) (ClientSetup, error) {
 			if err != nil {
 				return cs, &ParseError{Field: "param_value", Err: err}
 			}
-			if key == ParamPath {
+			switch key {
+			case ParamPath:
 				cs.Path = string(val)
 				cs.HasPath = true
+			case ParamAuthority:
+				cs.Authority = string(val)
+			case ParamImplementation:
+				cs.Implementation = string(val)
 			}
 		} else {
 			// Even key: varint value
@@ -196,8 +461,15 @@ func ParseClientSetup(data []byte) (ClientSetup, error) {
 			if err != nil {
 				return cs, &ParseError{Field: "param_value", Err: err}
 			}
-			if key == ParamMaxRequestID {
+			switch key {
+			case ParamMaxRequestID:
 				cs.MaxRequestID = val
+			case ParamDeliveryTimeout:
+				cs.DeliveryTimeout = time.Duration(min(val, uint64(maxDeliveryTimeoutMS))) * time.Millisecond
+			case ParamMaxObjectSize:
+				cs.MaxObjectSize = val
+			case ParamObjectDatagrams:
+				cs.ObjectDatagrams = val != 0
 			}
 		}
 	}
@@ -275,10 +547,54 @@ func ParseSubscribe(data []byte) (Subscribe, error) {
 		}
 	}
 
-	// Skip remaining params (NumParams + KVPs) — we don't need them.
+	numParams, err := r.readVarint()
+	if err != nil {
+		return s, &ParseError{Field: "num_params", Err: err}
+	}
+	for i := uint64(0); i < numParams; i++ {
+		key, err := r.readVarint()
+		if err != nil {
+			return s, &ParseError{Field: "param_key", Err: err}
+		}
+		if key%2 == 1 {
+			// Odd key: length-prefixed byte string.
+			val, err := r.readVarIntBytes()
+			if err != nil {
+				return s, &ParseError{Field: "param_value", Err: err}
+			}
+			if key == ParamAuthorizationToken {
+				if s.AuthToken, err = parseAuthToken(val); err != nil {
+					return s, &ParseError{Field: "authorization_token", Err: err}
+				}
+			}
+			continue
+		}
+		val, err := r.readVarint()
+		if err != nil {
+			return s, &ParseError{Field: "param_value", Err: err}
+		}
+		if key == ParamLiveEdge {
+			s.LiveEdge = val != 0
+		}
+	}
+
 	return s, nil
 }
 
+// parseAuthToken returns the token value of an AUTHORIZATION TOKEN
+// parameter, or "" if it refers to a token alias.
+func parseAuthToken(data []byte) (string, error) {
+	r := newBufReader(data)
+	aliasType, err := r.readVarint()
+	if err != nil || aliasType != AuthTokenUseValue {
+		return "", err
+	}
+	if _, err := r.readVarint(); err != nil { // token type
+		return "", err
+	}
+	return string(r.data[r.pos:]), nil
+}
+
 // ParseUnsubscribe parses an UNSUBSCRIBE payload.
 func ParseUnsubscribe(data []byte) (Unsubscribe, error) {
 	r := newBufReader(data)
@@ -289,15 +605,123 @@ func ParseUnsubscribe(data []byte) (Unsubscribe, error) {
 	return Unsubscribe{RequestID: reqID}, nil
 }
 
+// ParseFetch parses a FETCH payload.
+func ParseFetch(data []byte) (Fetch, error) {
+	r := newBufReader(data)
+	var f Fetch
+
+	var err error
+	f.RequestID, err = r.readVarint()
+	if err != nil {
+		return f, &ParseError{Field: "request_id", Err: err}
+	}
+	f.Priority, err = r.readByte()
+	if err != nil {
+		return f, &ParseError{Field: "priority", Err: err}
+	}
+	f.GroupOrder, err = r.readByte()
+	if err != nil {
+		return f, &ParseError{Field: "group_order", Err: err}
+	}
+	f.FetchType, err = r.readVarint()
+	if err != nil {
+		return f, &ParseError{Field: "fetch_type", Err: err}
+	}
+
+	switch f.FetchType {
+	case FetchStandalone:
+		f.Namespace, err = parseNamespaceTuple(r)
+		if err != nil {
+			return f, &ParseError{Field: "namespace", Err: err}
+		}
+		trackNameBytes, err := r.readVarIntBytes()
+		if err != nil {
+			return f, &ParseError{Field: "track_name", Err: err}
+		}
+		f.TrackName = string(trackNameBytes)
+		for _, v := range []struct {
+			field string
+			dst   *uint64
+		}{
+			{"start_group", &f.StartGroup},
+			{"start_object", &f.StartObj},
+			{"end_group", &f.EndGroup},
+			{"end_object", &f.EndObj},
+		} {
+			if *v.dst, err = r.readVarint(); err != nil {
+				return f, &ParseError{Field: v.field, Err: err}
+			}
+		}
+	case FetchRelativeJoining, FetchAbsoluteJoining:
+		f.JoiningRequestID, err = r.readVarint()
+		if err != nil {
+			return f, &ParseError{Field: "joining_request_id", Err: err}
+		}
+		f.JoiningStart, err = r.readVarint()
+		if err != nil {
+			return f, &ParseError{Field: "joining_start", Err: err}
+		}
+	default:
+		return f, &ParseError{Field: "fetch_type", Err: fmt.Errorf("unknown fetch type 0x%x", f.FetchType)}
+	}
+
+	// Skip remaining params (NumParams + KVPs) — we don't need them.
+	return f, nil
+}
+
+// ParseFetchCancel parses a FETCH_CANCEL payload.
+func ParseFetchCancel(data []byte) (FetchCancel, error) {
+	r := newBufReader(data)
+	reqID, err := r.readVarint()
+	if err != nil {
+		return FetchCancel{}, &ParseError{Field: "request_id", Err: err}
+	}
+	return FetchCancel{RequestID: reqID}, nil
+}
+
+// ParseSubscribeAnnounces parses a SUBSCRIBE_ANNOUNCES payload.
+func ParseSubscribeAnnounces(data []byte) (SubscribeAnnounces, error) {
+	r := newBufReader(data)
+	var sa SubscribeAnnounces
+
+	var err error
+	sa.RequestID, err = r.readVarint()
+	if err != nil {
+		return sa, &ParseError{Field: "request_id", Err: err}
+	}
+	sa.Prefix, err = parseNamespaceTuple(r)
+	if err != nil {
+		return sa, &ParseError{Field: "namespace_prefix", Err: err}
+	}
+
+	// Skip remaining params (NumParams + KVPs) — we don't need them.
+	return sa, nil
+}
+
+// ParseUnsubscribeAnnounces parses an UNSUBSCRIBE_ANNOUNCES payload.
+func ParseUnsubscribeAnnounces(data []byte) (UnsubscribeAnnounces, error) {
+	prefix, err := parseNamespaceTuple(newBufReader(data))
+	if err != nil {
+		return UnsubscribeAnnounces{}, &ParseError{Field: "namespace_prefix", Err: err}
+	}
+	return UnsubscribeAnnounces{Prefix: prefix}, nil
+}
+
 // SerializeServerSetup serializes a SERVER_SETUP payload.
 func SerializeServerSetup(ss ServerSetup) []byte {
 	var buf []byte
 	buf = quicvarint.Append(buf, ss.SelectedVersion)
-	// NumParams = 1 (MAX_REQUEST_ID)
-	buf = quicvarint.Append(buf, 1)
+	if !ss.ObjectDatagrams {
+		// NumParams = 1 (MAX_REQUEST_ID)
+		buf = quicvarint.Append(buf, 1)
+		buf = quicvarint.Append(buf, ParamMaxRequestID)
+		return quicvarint.Append(buf, ss.MaxRequestID)
+	}
+	buf = quicvarint.Append(buf, 2)
 	buf = quicvarint.Append(buf, ParamMaxRequestID)
 	buf = quicvarint.Append(buf, ss.MaxRequestID)
-	return buf
+	buf = quicvarint.Append(buf, ParamObjectDatagrams)
+	return quicvarint.Append(buf, 1)
 }
 
 // SerializeSubscribeOK serializes a SUBSCRIBE_OK payload.
@@ -325,11 +749,78 @@ func SerializeSubscribeOK(sok SubscribeOK) []byte {
 func SerializeSubscribeError(se SubscribeError) []byte {
 	var buf []byte
 	buf = quicvarint.Append(buf, se.RequestID)
-	buf = quicvarint.Append(buf, se.ErrorCode)
+	buf = quicvarint.Append(buf, uint64(se.ErrorCode))
+	buf = appendVarIntBytes(buf, []byte(se.ReasonPhrase))
+	return buf
+}
+
+// SerializeFetchOK serializes a FETCH_OK payload.
+func SerializeFetchOK(fok FetchOK) []byte {
+	var buf []byte
+	buf = quicvarint.Append(buf, fok.RequestID)
+	buf = append(buf, fok.GroupOrder)
+	if fok.EndOfTrack {
+		buf = append(buf, 1)
+	} else {
+		buf = append(buf, 0)
+	}
+	buf = quicvarint.Append(buf, fok.EndGroup)
+	buf = quicvarint.Append(buf, fok.EndObj)
+	// NumParams = 0
+	buf = quicvarint.Append(buf, 0)
+	return buf
+}
+
+// SerializeFetchError serializes a FETCH_ERROR payload.
+func SerializeFetchError(fe FetchError) []byte {
+	var buf []byte
+	buf = quicvarint.Append(buf, fe.RequestID)
+	buf = quicvarint.Append(buf, uint64(fe.ErrorCode))
+	buf = appendVarIntBytes(buf, []byte(fe.ReasonPhrase))
+	return buf
+}
+
+// SerializeSubscribeDone serializes a SUBSCRIBE_DONE payload.
+func SerializeSubscribeDone(sd SubscribeDone) []byte {
+	var buf []byte
+	buf = quicvarint.Append(buf, sd.RequestID)
+	buf = quicvarint.Append(buf, uint64(sd.StatusCode))
+	buf = quicvarint.Append(buf, sd.StreamCount)
+	buf = appendVarIntBytes(buf, []byte(sd.ReasonPhrase))
+	return buf
+}
+
+// SerializeSubscribeAnnouncesOK serializes a SUBSCRIBE_ANNOUNCES_OK payload.
+func SerializeSubscribeAnnouncesOK(requestID uint64) []byte {
+	return quicvarint.Append(nil, requestID)
+}
+
+// SerializeSubscribeAnnouncesError serializes a SUBSCRIBE_ANNOUNCES_ERROR
+// payload.
+func SerializeSubscribeAnnouncesError(se SubscribeAnnouncesError) []byte {
+	var buf []byte
+	buf = quicvarint.Append(buf, se.RequestID)
+	buf = quicvarint.Append(buf, uint64(se.ErrorCode))
 	buf = appendVarIntBytes(buf, []byte(se.ReasonPhrase))
 	return buf
 }
 
+// SerializeAnnounce serializes an ANNOUNCE payload.
+func SerializeAnnounce(a Announce) []byte {
+	var buf []byte
+	buf = quicvarint.Append(buf, a.RequestID)
+	buf = AppendNamespaceTuple(buf, a.Namespace)
+	// NumParams = 0
+	buf = quicvarint.Append(buf, 0)
+	return buf
+}
+
+// SerializeUnannounce serializes an UNANNOUNCE payload, which withdraws
+// a previously announced namespace.
+func SerializeUnannounce(namespace []string) []byte {
+	return AppendNamespaceTuple(nil, namespace)
+}
+
 // SerializeGoAway serializes a GOAWAY payload.
 func SerializeGoAway(ga GoAway) []byte {
 	var buf []byte
@@ -4,7 +4,9 @@ import (
 	"bytes"
 	"encoding/binary"
 	"io"
+	"reflect"
 	"testing"
+	"time"
 
 	"github.com/quic-go/quic-go/quicvarint"
 )
@@ -162,6 +164,47 @@ func TestParseClientSetupNoParams(t *testing.T) {
 	}
 }
 
+func TestParseClientSetupExtraParams(t *testing.T) {
+	t.Parallel()
+	buf := quicvarint.Append(nil, 1)
+	buf = quicvarint.Append(buf, Version)
+	buf = quicvarint.Append(buf, 8)
+	buf = quicvarint.Append(buf, ParamPath)
+	buf = appendVarIntBytes(buf, []byte("/moq"))
+	buf = quicvarint.Append(buf, ParamAuthority)
+	buf = appendVarIntBytes(buf, []byte("example.com:4443"))
+	buf = quicvarint.Append(buf, ParamImplementation)
+	buf = appendVarIntBytes(buf, []byte("test-client/1.0"))
+	buf = quicvarint.Append(buf, ParamDeliveryTimeout)
+	buf = quicvarint.Append(buf, 1500)
+	buf = quicvarint.Append(buf, ParamMaxObjectSize)
+	buf = quicvarint.Append(buf, 1<<20)
+	buf = quicvarint.Append(buf, ParamObjectDatagrams)
+	buf = quicvarint.Append(buf, 1)
+	buf = quicvarint.Append(buf, 0x3f) // unknown odd: skipped bytes
+	buf = appendVarIntBytes(buf, []byte("ignored"))
+	buf = quicvarint.Append(buf, 0x40) // unknown even: skipped varint
+	buf = quicvarint.Append(buf, 12345)
+
+	cs, err := ParseClientSetup(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ClientSetup{
+		Versions:        []uint64{Version},
+		Path:            "/moq",
+		HasPath:         true,
+		Authority:       "example.com:4443",
+		Implementation:  "test-client/1.0",
+		DeliveryTimeout: 1500 * time.Millisecond,
+		MaxObjectSize:   1 << 20,
+		ObjectDatagrams: true,
+	}
+	if !reflect.DeepEqual(cs, want) {
+		t.Errorf("client setup = %+v, want %+v", cs, want)
+	}
+}
+
 func TestParseClientSetupTruncated(t *testing.T) {
 	t.Parallel()
 	// Just a single byte — not enough for num_versions
@@ -210,6 +253,22 @@ func TestSerializeServerSetup(t *testing.T) {
 	}
 }
 
+func TestSerializeServerSetupObjectDatagrams(t *testing.T) {
+	t.Parallel()
+	payload := SerializeServerSetup(ServerSetup{SelectedVersion: Version, MaxRequestID: 50, ObjectDatagrams: true})
+
+	var want []byte
+	want = quicvarint.Append(want, Version)
+	want = quicvarint.Append(want, 2)
+	want = quicvarint.Append(want, ParamMaxRequestID)
+	want = quicvarint.Append(want, 50)
+	want = quicvarint.Append(want, ParamObjectDatagrams)
+	want = quicvarint.Append(want, 1)
+	if !bytes.Equal(payload, want) {
+		t.Errorf("SERVER_SETUP = % x, want % x", payload, want)
+	}
+}
+
 func buildSubscribePayload(reqID uint64, ns []string, trackName string, filterType uint64) []byte {
 	var buf []byte
 	buf = quicvarint.Append(buf, reqID)
@@ -304,6 +363,98 @@ func TestParseSubscribeAbsoluteRange(t *testing.T) {
 	}
 }
 
+func TestParseSubscribeLiveEdge(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		params func([]byte) []byte
+		want   bool
+	}{
+		{"absent", func(b []byte) []byte { return quicvarint.Append(b, 0) }, false},
+		{"set", func(b []byte) []byte {
+			b = quicvarint.Append(b, 1)
+			b = quicvarint.Append(b, ParamLiveEdge)
+			return quicvarint.Append(b, 1)
+		}, true},
+		{"zero", func(b []byte) []byte {
+			b = quicvarint.Append(b, 1)
+			b = quicvarint.Append(b, ParamLiveEdge)
+			return quicvarint.Append(b, 0)
+		}, false},
+		{"after unknown params", func(b []byte) []byte {
+			b = quicvarint.Append(b, 3)
+			b = quicvarint.Append(b, 0x7f11)
+			b = appendVarIntBytes(b, []byte("opaque"))
+			b = quicvarint.Append(b, 0x7f10)
+			b = quicvarint.Append(b, 42)
+			b = quicvarint.Append(b, ParamLiveEdge)
+			return quicvarint.Append(b, 1)
+		}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			payload := buildSubscribePayload(1, []string{"prism", "test"}, "video", FilterNextGroupStart)
+			payload = tt.params(payload[:len(payload)-1]) // replace NumParams = 0
+			s, err := ParseSubscribe(payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s.LiveEdge != tt.want {
+				t.Errorf("LiveEdge = %v, want %v", s.LiveEdge, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSubscribeAuthToken(t *testing.T) {
+	t.Parallel()
+
+	token := func(alias uint64, rest ...byte) func([]byte) []byte {
+		return func(b []byte) []byte {
+			b = quicvarint.Append(b, 1)
+			b = quicvarint.Append(b, ParamAuthorizationToken)
+			return appendVarIntBytes(b, append(quicvarint.Append(nil, alias), rest...))
+		}
+	}
+
+	tests := []struct {
+		name    string
+		params  func([]byte) []byte
+		want    string
+		wantErr bool
+	}{
+		{"absent", func(b []byte) []byte { return quicvarint.Append(b, 0) }, "", false},
+		{"use value", token(AuthTokenUseValue, append([]byte{0x01}, "s3cret"...)...), "s3cret", false},
+		{"empty value", token(AuthTokenUseValue, 0x01), "", false},
+		{"use alias", token(0x02, 0x07), "", false},
+		{"missing token type", token(AuthTokenUseValue), "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			payload := buildSubscribePayload(1, []string{"prism", "test"}, "video", FilterNextGroupStart)
+			payload = tt.params(payload[:len(payload)-1]) // replace NumParams = 0
+			s, err := ParseSubscribe(payload)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s.AuthToken != tt.want {
+				t.Errorf("AuthToken = %q, want %q", s.AuthToken, tt.want)
+			}
+		})
+	}
+}
+
 func TestSerializeSubscribeOKNoContent(t *testing.T) {
 	t.Parallel()
 	sok := SubscribeOK{
@@ -383,7 +534,7 @@ func TestSerializeSubscribeError(t *testing.T) {
 	t.Parallel()
 	se := SubscribeError{
 		RequestID:    3,
-		ErrorCode:    404,
+		ErrorCode:    SubscribeErrorTrackDoesNotExist,
 		ReasonPhrase: "track not found",
 	}
 	payload := SerializeSubscribeError(se)
@@ -396,7 +547,7 @@ func TestSerializeSubscribeError(t *testing.T) {
 	if reqID != 3 {
 		t.Fatalf("requestID = %d", reqID)
 	}
-	if code != 404 {
+	if SubscribeErrorCode(code) != SubscribeErrorTrackDoesNotExist {
 		t.Fatalf("errorCode = %d", code)
 	}
 	if string(reason) != "track not found" {
@@ -404,6 +555,74 @@ func TestSerializeSubscribeError(t *testing.T) {
 	}
 }
 
+func TestSubscribeErrorCodeString(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		code SubscribeErrorCode
+		want string
+	}{
+		{SubscribeErrorInternal, "INTERNAL_ERROR"},
+		{SubscribeErrorNotSupported, "NOT_SUPPORTED"},
+		{SubscribeErrorTrackDoesNotExist, "TRACK_DOES_NOT_EXIST"},
+		{SubscribeErrorExpiredAuthToken, "EXPIRED_AUTH_TOKEN"},
+		{SubscribeErrorTooManyRequests, "TOO_MANY_REQUESTS"},
+		{SubscribeErrorCode(0x99), "0x99"},
+	}
+	for _, tt := range tests {
+		if got := tt.code.String(); got != tt.want {
+			t.Errorf("SubscribeErrorCode(%d).String() = %q, want %q", uint64(tt.code), got, tt.want)
+		}
+	}
+}
+
+func TestSerializeSubscribeDone(t *testing.T) {
+	t.Parallel()
+	sd := SubscribeDone{
+		RequestID:    7,
+		StatusCode:   SubscribeDoneInternal,
+		StreamCount:  12,
+		ReasonPhrase: "stream open failed",
+	}
+	payload := SerializeSubscribeDone(sd)
+	r := newBufReader(payload)
+
+	reqID, _ := r.readVarint()
+	status, _ := r.readVarint()
+	count, _ := r.readVarint()
+	reason, _ := r.readVarIntBytes()
+
+	if reqID != 7 {
+		t.Fatalf("requestID = %d", reqID)
+	}
+	if SubscribeDoneStatus(status) != SubscribeDoneInternal {
+		t.Fatalf("status = %d", status)
+	}
+	if count != 12 {
+		t.Fatalf("streamCount = %d", count)
+	}
+	if string(reason) != "stream open failed" {
+		t.Fatalf("reason = %q", reason)
+	}
+}
+
+func TestSubscribeDoneStatusString(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		code SubscribeDoneStatus
+		want string
+	}{
+		{SubscribeDoneInternal, "INTERNAL_ERROR"},
+		{SubscribeDoneTrackEnded, "TRACK_ENDED"},
+		{SubscribeDoneSubscriptionEnded, "SUBSCRIPTION_ENDED"},
+		{SubscribeDoneStatus(0x99), "0x99"},
+	}
+	for _, tt := range tests {
+		if got := tt.code.String(); got != tt.want {
+			t.Errorf("SubscribeDoneStatus(%d).String() = %q, want %q", uint64(tt.code), got, tt.want)
+		}
+	}
+}
+
 func TestParseUnsubscribe(t *testing.T) {
 	t.Parallel()
 	var payload []byte
@@ -509,3 +728,181 @@ func TestVarIntBytesRoundTrip(t *testing.T) {
 		t.Fatalf("decoded = %q, want %q", decoded, data)
 	}
 }
+
+func TestParseFetchJoining(t *testing.T) {
+	t.Parallel()
+	var buf []byte
+	buf = quicvarint.Append(buf, 6)
+	buf = append(buf, 64)                  // priority
+	buf = append(buf, GroupOrderAscending) // group order
+	buf = quicvarint.Append(buf, FetchRelativeJoining)
+	buf = quicvarint.Append(buf, 4) // joining request ID
+	buf = quicvarint.Append(buf, 2) // joining start
+	buf = quicvarint.Append(buf, 0) // NumParams
+
+	f, err := ParseFetch(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.RequestID != 6 || f.Priority != 64 || f.GroupOrder != GroupOrderAscending {
+		t.Fatalf("fetch = %+v", f)
+	}
+	if f.FetchType != FetchRelativeJoining || f.JoiningRequestID != 4 || f.JoiningStart != 2 {
+		t.Fatalf("joining fields = %+v", f)
+	}
+}
+
+func TestParseFetchStandalone(t *testing.T) {
+	t.Parallel()
+	var buf []byte
+	buf = quicvarint.Append(buf, 8)
+	buf = append(buf, 128, GroupOrderAscending)
+	buf = quicvarint.Append(buf, FetchStandalone)
+	buf = AppendNamespaceTuple(buf, []string{"prism", "test"})
+	buf = appendVarIntBytes(buf, []byte("video"))
+	for _, v := range []uint64{3, 0, 5, 7} {
+		buf = quicvarint.Append(buf, v)
+	}
+	buf = quicvarint.Append(buf, 0)
+
+	f, err := ParseFetch(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.TrackName != "video" || len(f.Namespace) != 2 {
+		t.Fatalf("track = %v/%q", f.Namespace, f.TrackName)
+	}
+	if f.StartGroup != 3 || f.StartObj != 0 || f.EndGroup != 5 || f.EndObj != 7 {
+		t.Fatalf("range = (%d,%d)-(%d,%d)", f.StartGroup, f.StartObj, f.EndGroup, f.EndObj)
+	}
+}
+
+func TestParseFetchUnknownType(t *testing.T) {
+	t.Parallel()
+	var buf []byte
+	buf = quicvarint.Append(buf, 1)
+	buf = append(buf, 128, GroupOrderAscending)
+	buf = quicvarint.Append(buf, 9)
+	if _, err := ParseFetch(buf); err == nil {
+		t.Fatal("expected error for unknown fetch type")
+	}
+}
+
+func TestSerializeFetchOK(t *testing.T) {
+	t.Parallel()
+	payload := SerializeFetchOK(FetchOK{
+		RequestID:  6,
+		GroupOrder: GroupOrderAscending,
+		EndGroup:   12,
+		EndObj:     29,
+	})
+	r := newBufReader(payload)
+
+	reqID, _ := r.readVarint()
+	order, _ := r.readByte()
+	eot, _ := r.readByte()
+	endGroup, _ := r.readVarint()
+	endObj, _ := r.readVarint()
+	numParams, _ := r.readVarint()
+
+	if reqID != 6 || order != GroupOrderAscending || eot != 0 {
+		t.Fatalf("reqID=%d order=%d endOfTrack=%d", reqID, order, eot)
+	}
+	if endGroup != 12 || endObj != 29 {
+		t.Fatalf("end location = (%d, %d), want (12, 29)", endGroup, endObj)
+	}
+	if numParams != 0 {
+		t.Fatalf("numParams = %d", numParams)
+	}
+}
+
+func TestSerializeFetchError(t *testing.T) {
+	t.Parallel()
+	payload := SerializeFetchError(FetchError{
+		RequestID:    6,
+		ErrorCode:    SubscribeErrorInvalidRange,
+		ReasonPhrase: "nothing to fetch",
+	})
+	r := newBufReader(payload)
+
+	reqID, _ := r.readVarint()
+	code, _ := r.readVarint()
+	reason, _ := r.readVarIntBytes()
+
+	if reqID != 6 || SubscribeErrorCode(code) != SubscribeErrorInvalidRange {
+		t.Fatalf("reqID=%d code=%d", reqID, code)
+	}
+	if string(reason) != "nothing to fetch" {
+		t.Fatalf("reason = %q", reason)
+	}
+}
+
+func TestParseSubscribeAnnounces(t *testing.T) {
+	t.Parallel()
+	var payload []byte
+	payload = quicvarint.Append(payload, 9)
+	payload = AppendNamespaceTuple(payload, []string{"prism"})
+	payload = quicvarint.Append(payload, 0) // no params
+
+	sa, err := ParseSubscribeAnnounces(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sa.RequestID != 9 || len(sa.Prefix) != 1 || sa.Prefix[0] != "prism" {
+		t.Fatalf("got %+v", sa)
+	}
+
+	if _, err := ParseSubscribeAnnounces(payload[:1]); err == nil {
+		t.Fatal("expected error for truncated prefix")
+	}
+
+	unsub, err := ParseUnsubscribeAnnounces(AppendNamespaceTuple(nil, []string{"prism"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(unsub.Prefix) != 1 || unsub.Prefix[0] != "prism" {
+		t.Fatalf("unsubscribe prefix = %v", unsub.Prefix)
+	}
+}
+
+func TestSerializeAnnounce(t *testing.T) {
+	t.Parallel()
+	r := newBufReader(SerializeAnnounce(Announce{RequestID: 3, Namespace: []string{"prism", "live"}}))
+
+	reqID, _ := r.readVarint()
+	ns, err := parseNamespaceTuple(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	numParams, _ := r.readVarint()
+	if reqID != 3 || len(ns) != 2 || ns[1] != "live" || numParams != 0 {
+		t.Fatalf("reqID=%d ns=%v params=%d", reqID, ns, numParams)
+	}
+
+	ns, err = parseNamespaceTuple(newBufReader(SerializeUnannounce([]string{"prism", "live"})))
+	if err != nil || len(ns) != 2 || ns[1] != "live" {
+		t.Fatalf("unannounce ns=%v err=%v", ns, err)
+	}
+}
+
+func TestSerializeSubscribeAnnouncesError(t *testing.T) {
+	t.Parallel()
+	payload := SerializeSubscribeAnnouncesError(SubscribeAnnouncesError{
+		RequestID:    4,
+		ErrorCode:    SubscribeErrorTrackDoesNotExist,
+		ReasonPhrase: "unknown namespace",
+	})
+	r := newBufReader(payload)
+
+	reqID, _ := r.readVarint()
+	code, _ := r.readVarint()
+	reason, _ := r.readVarIntBytes()
+	if reqID != 4 || SubscribeErrorCode(code) != SubscribeErrorTrackDoesNotExist || string(reason) != "unknown namespace" {
+		t.Fatalf("reqID=%d code=%d reason=%q", reqID, code, reason)
+	}
+
+	r = newBufReader(SerializeSubscribeAnnouncesOK(4))
+	if reqID, _ := r.readVarint(); reqID != 4 {
+		t.Fatalf("OK reqID = %d", reqID)
+	}
+}
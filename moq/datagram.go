@@ -0,0 +1,93 @@
+package moq
+
+import (
+	"fmt"
+
+	"github.com/quic-go/quic-go/quicvarint"
+)
+
+// OBJECT_DATAGRAM type bits (draft-15 §10.3). Types 0x00 through 0x03
+// carry a payload; the others, such as those carrying an object status
+// instead, are not used.
+const (
+	datagramExtensions uint64 = 0x01 // extension headers are present
+	datagramEndOfGroup uint64 = 0x02 // the object is the last of its group
+)
+
+// ObjectDatagram is an object sent as a QUIC datagram rather than on a
+// stream (OBJECT_DATAGRAM). With no stream header before it, it carries
+// its track alias, location and priority itself. Datagrams avoid
+// head-of-line blocking behind lost packets but are not retransmitted,
+// so they suit small objects that are useless once late, such as audio.
+type ObjectDatagram struct {
+	TrackAlias        uint64
+	GroupID           uint64
+	ObjectID          uint64
+	PublisherPriority byte
+
+	// Extensions are the object's extension headers, already encoded;
+	// nil sends none.
+	Extensions []byte
+
+	// EndOfGroup marks the object as the last of its group.
+	EndOfGroup bool
+
+	Payload []byte
+}
+
+// AppendObjectDatagram appends the OBJECT_DATAGRAM encoding of d to dst.
+func AppendObjectDatagram(dst []byte, d ObjectDatagram) []byte {
+	var typ uint64
+	if len(d.Extensions) > 0 {
+		typ |= datagramExtensions
+	}
+	if d.EndOfGroup {
+		typ |= datagramEndOfGroup
+	}
+	dst = quicvarint.Append(dst, typ)
+	dst = quicvarint.Append(dst, d.TrackAlias)
+	dst = quicvarint.Append(dst, d.GroupID)
+	dst = quicvarint.Append(dst, d.ObjectID)
+	dst = append(dst, d.PublisherPriority)
+	if typ&datagramExtensions != 0 {
+		dst = appendVarIntBytes(dst, d.Extensions)
+	}
+	// The payload runs to the end of the datagram.
+	return append(dst, d.Payload...)
+}
+
+// ParseObjectDatagram parses an OBJECT_DATAGRAM. The extensions and
+// payload alias data.
+func ParseObjectDatagram(data []byte) (ObjectDatagram, error) {
+	r := newBufReader(data)
+	var d ObjectDatagram
+
+	typ, err := r.readVarint()
+	if err != nil {
+		return d, &ParseError{Field: "datagram_type", Err: err}
+	}
+	if typ > datagramExtensions|datagramEndOfGroup {
+		return d, &ParseError{Field: "datagram_type", Err: fmt.Errorf("unsupported type 0x%x", typ)}
+	}
+	d.EndOfGroup = typ&datagramEndOfGroup != 0
+
+	if d.TrackAlias, err = r.readVarint(); err != nil {
+		return d, &ParseError{Field: "track_alias", Err: err}
+	}
+	if d.GroupID, err = r.readVarint(); err != nil {
+		return d, &ParseError{Field: "group_id", Err: err}
+	}
+	if d.ObjectID, err = r.readVarint(); err != nil {
+		return d, &ParseError{Field: "object_id", Err: err}
+	}
+	if d.PublisherPriority, err = r.readByte(); err != nil {
+		return d, &ParseError{Field: "publisher_priority", Err: err}
+	}
+	if typ&datagramExtensions != 0 {
+		if d.Extensions, err = r.readVarIntBytes(); err != nil {
+			return d, &ParseError{Field: "extensions", Err: err}
+		}
+	}
+	d.Payload = data[r.pos:]
+	return d, nil
+}
@@ -0,0 +1,73 @@
+package moq
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestObjectDatagramRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		d    ObjectDatagram
+		typ  byte
+	}{
+		{
+			name: "payload only",
+			d:    ObjectDatagram{TrackAlias: 2, GroupID: 0, ObjectID: 300, PublisherPriority: 1, Payload: []byte{0x21, 0x10}},
+			typ:  0x00,
+		},
+		{
+			name: "extensions",
+			d:    ObjectDatagram{TrackAlias: 2, ObjectID: 7, PublisherPriority: 1, Extensions: []byte{0x02, 0x44, 0x00}, Payload: []byte{0x21}},
+			typ:  0x01,
+		},
+		{
+			name: "end of group",
+			d:    ObjectDatagram{TrackAlias: 5, GroupID: 1 << 20, PublisherPriority: 3, Extensions: []byte{0x02, 0x01}, EndOfGroup: true, Payload: []byte("HELLO")},
+			typ:  0x03,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			data := AppendObjectDatagram(nil, tt.d)
+			if data[0] != tt.typ {
+				t.Errorf("type = 0x%02x, want 0x%02x", data[0], tt.typ)
+			}
+			got, err := ParseObjectDatagram(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.d) {
+				t.Errorf("ParseObjectDatagram = %+v, want %+v", got, tt.d)
+			}
+		})
+	}
+}
+
+func TestParseObjectDatagramErrors(t *testing.T) {
+	t.Parallel()
+
+	valid := AppendObjectDatagram(nil, ObjectDatagram{TrackAlias: 2, ObjectID: 1, Extensions: []byte{0x02, 0x05}, Payload: []byte{1}})
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"status type", []byte{0x20, 0x02, 0x00, 0x01, 0x00, 0x00}},
+		{"truncated header", valid[:4]},
+		{"truncated extensions", valid[:7]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if d, err := ParseObjectDatagram(tt.data); err == nil {
+				t.Errorf("ParseObjectDatagram = %+v, want error", d)
+			}
+		})
+	}
+}
@@ -11,7 +11,9 @@ var (
 	ErrVersionMismatch   = errors.New("moq: no compatible version")
 	ErrUnknownTrack      = errors.New("moq: unknown track")
 	ErrUnsupportedFilter = errors.New("moq: unsupported filter type")
+	ErrInvalidRange      = errors.New("moq: invalid subscribe range")
 	ErrUnknownNamespace  = errors.New("moq: unknown namespace")
+	ErrTooManyRequests   = errors.New("moq: request ID exceeds MAX_REQUEST_ID")
 )
 
 // ParseError indicates a failure to parse a MoQ control message field.
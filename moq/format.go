@@ -10,21 +10,27 @@ import (
 // format (4-byte big-endian length prefixed). Each NALU in the input slice
 // is expected to start with a 4-byte start code (0x00 0x00 0x00 0x01).
 func AnnexBToAVC1(nalus [][]byte) []byte {
+	return AppendAVC1(make([]byte, 0, AVC1Size(nalus)), nalus)
+}
+
+// AVC1Size returns the length of the AVC1 form of nalus.
+func AVC1Size(nalus [][]byte) int {
 	var total int
 	for _, nalu := range nalus {
-		raw := stripStartCode(nalu)
-		total += 4 + len(raw)
+		total += 4 + len(stripStartCode(nalu))
 	}
+	return total
+}
 
-	out := make([]byte, 0, total)
+// AppendAVC1 appends the AVC1 form of nalus to dst, letting callers
+// serialize into a buffer they own, such as a pooled media.FrameBuffer.
+func AppendAVC1(dst []byte, nalus [][]byte) []byte {
 	for _, nalu := range nalus {
 		raw := stripStartCode(nalu)
-		var lenBuf [4]byte
-		binary.BigEndian.PutUint32(lenBuf[:], uint32(len(raw)))
-		out = append(out, lenBuf[:]...)
-		out = append(out, raw...)
+		dst = binary.BigEndian.AppendUint32(dst, uint32(len(raw)))
+		dst = append(dst, raw...)
 	}
-	return out
+	return dst
 }
 
 // stripStartCode removes a 3-byte or 4-byte Annex B start code prefix.
@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"encoding/binary"
 	"testing"
+
+	"github.com/zsiec/prism/demux"
 )
 
 func TestAnnexBToAVC1Single(t *testing.T) {
@@ -94,6 +96,70 @@ func TestAnnexBToAVC1NoStartCode(t *testing.T) {
 	}
 }
 
+// rbsp decodes a NAL unit to its RBSP as a decoder does, dropping every
+// byte 0x03 that follows two zero bytes. It is independent of the demuxer's
+// own unescaping so the two check each other.
+func rbsp(nal []byte) []byte {
+	var out []byte
+	zeros := 0
+	for _, b := range nal {
+		if zeros >= 2 && b == 3 {
+			zeros = 0
+			continue
+		}
+		out = append(out, b)
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+	}
+	return out
+}
+
+// TestAppendAVC1PreservesRBSP checks that the AVC1 payload sent to viewers
+// decodes to the same RBSP as the source NAL units, for byte sequences
+// that exercise emulation prevention.
+func TestAppendAVC1PreservesRBSP(t *testing.T) {
+	t.Parallel()
+
+	sources := [][]byte{
+		// Every escaped sequence.
+		{0, 0, 0, 1, 0x65, 0x00, 0x00, 0x03, 0x00, 0x00, 0x03, 0x01, 0x00, 0x00, 0x03, 0x02, 0x00, 0x00, 0x03, 0x03, 0x80},
+		// A run of zeros, escaped every two bytes.
+		{0, 0, 0, 1, 0x41, 0x9A, 0x00, 0x00, 0x03, 0x00, 0x00, 0x03, 0x00, 0x00, 0x03, 0x00, 0x80},
+		// cabac_zero_words ending the NAL unit.
+		{0, 0, 0, 1, 0x65, 0x88, 0x80, 0x00, 0x00, 0x03, 0x00, 0x00, 0x03},
+		// A 3-byte start code before an escape straight after the header.
+		{0, 0, 1, 0x06, 0x00, 0x00, 0x03, 0x01, 0x80},
+		// An H.265 header whose first byte is zero.
+		{0, 0, 0, 1, 0x00, 0x01, 0x00, 0x00, 0x03, 0x00, 0xD0},
+	}
+
+	payload := AnnexBToAVC1(sources)
+	for i, src := range sources {
+		if len(payload) < 4 {
+			t.Fatalf("payload ends before NAL unit %d", i)
+		}
+		n := int(binary.BigEndian.Uint32(payload))
+		if len(payload) < 4+n {
+			t.Fatalf("NAL unit %d: length %d overruns payload of %d bytes", i, n, len(payload)-4)
+		}
+		nal := payload[4 : 4+n]
+		payload = payload[4+n:]
+
+		if !demux.ValidEmulationPrevention(nal) {
+			t.Errorf("NAL unit %d: % x is not correctly escaped", i, nal)
+		}
+		if got, want := rbsp(nal), rbsp(stripStartCode(src)); !bytes.Equal(got, want) {
+			t.Errorf("NAL unit %d: RBSP = % x, want % x", i, got, want)
+		}
+	}
+	if len(payload) != 0 {
+		t.Errorf("%d bytes left after the last NAL unit", len(payload))
+	}
+}
+
 func TestStripADTS7Byte(t *testing.T) {
 	t.Parallel()
 	// 7-byte ADTS header (protection absent = 1, no CRC)
@@ -1,9 +1,11 @@
 package mpegts
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"io"
+	"time"
 )
 
 // Demuxer reads MPEG-TS packets from a reader and produces DemuxerData
@@ -16,9 +18,23 @@ type Demuxer struct {
 	programMap    *programMap
 	dataBuffer    []*DemuxerData
 	packetsParser PacketsParser
+	onCorrupt     func(error)
 	pktSize       int
 	eof           bool
 	eofData       []*DemuxerData
+
+	// detectSize is set until the packet size is detected from the first
+	// bytes read, if DemuxerOptDetectPacketSize asked for it.
+	detectSize   bool
+	onPacketSize func(int)
+
+	// reorder is nil unless a reorder window is set; ready is its output
+	// buffer, reused across packets.
+	reorder       *reorderBuffer
+	reorderWindow int
+	reorderWait   time.Duration
+	onReordered   func()
+	ready         []*Packet
 }
 
 // NewDemuxer creates a new MPEG-TS demuxer reading from r.
@@ -35,16 +51,33 @@ func NewDemuxer(ctx context.Context, r io.Reader, opts ...func(*Demuxer)) *Demux
 		opt(d)
 	}
 	d.readBuf = make([]byte, d.pktSize)
+	if d.reorderWindow > 0 {
+		d.reorder = newReorderBuffer(d.reorderWindow, d.reorderWait)
+		d.reorder.onReordered = d.onReordered
+	}
 	return d
 }
 
-// DemuxerOptPacketSize sets the TS packet size (default 188).
+// DemuxerOptPacketSize sets the packet size (default 188): PacketSizeTS,
+// or PacketSizeM2TS or PacketSizeRS, whose extra bytes are stripped.
 func DemuxerOptPacketSize(size int) func(*Demuxer) {
 	return func(d *Demuxer) {
 		d.pktSize = size
 	}
 }
 
+// DemuxerOptDetectPacketSize detects the packet size from the spacing of
+// sync bytes in the first bytes read, before the first packet is parsed,
+// skipping any partial packet before the first whole one. fn, if not nil,
+// is called with the size. A stream in which no size fits is read as
+// 188-byte packets.
+func DemuxerOptDetectPacketSize(fn func(size int)) func(*Demuxer) {
+	return func(d *Demuxer) {
+		d.detectSize = true
+		d.onPacketSize = fn
+	}
+}
+
 // DemuxerOptPacketsParser sets a custom packet parser callback.
 func DemuxerOptPacketsParser(p PacketsParser) func(*Demuxer) {
 	return func(d *Demuxer) {
@@ -52,6 +85,34 @@ func DemuxerOptPacketsParser(p PacketsParser) func(*Demuxer) {
 	}
 }
 
+// DemuxerOptCorruptHandler sets a callback invoked with the parse error of
+// each packet or section NextData skips as corrupt.
+func DemuxerOptCorruptHandler(fn func(error)) func(*Demuxer) {
+	return func(d *Demuxer) {
+		d.onCorrupt = fn
+	}
+}
+
+// DemuxerOptReorderWindow puts payload packets that arrive slightly out
+// of order back in continuity counter order before PES assembly. Up to
+// packets packets per PID, at most 7, are held for at most wait while
+// waiting for the ones before them; after that the gap is treated as a
+// loss. Reordering is off by default and when packets is 0.
+func DemuxerOptReorderWindow(packets int, wait time.Duration) func(*Demuxer) {
+	return func(d *Demuxer) {
+		d.reorderWindow = packets
+		d.reorderWait = wait
+	}
+}
+
+// DemuxerOptReorderHandler sets a callback invoked for each packet the
+// reorder window put back ahead of a later packet of its PID.
+func DemuxerOptReorderHandler(fn func()) func(*Demuxer) {
+	return func(d *Demuxer) {
+		d.onReordered = fn
+	}
+}
+
 // NextData returns the next parsed unit from the stream. Returns io.EOF
 // when all data has been consumed.
 func (d *Demuxer) NextData() (*DemuxerData, error) {
@@ -78,53 +139,108 @@ func (d *Demuxer) NextData() (*DemuxerData, error) {
 			return nil, d.ctx.Err()
 		}
 
+		if d.detectSize {
+			if err := d.detectPacketSize(); err != nil {
+				return nil, err
+			}
+		}
+
 		// Read next packet.
 		_, err := io.ReadFull(d.reader, d.readBuf)
 		if err != nil {
 			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
 				d.eof = true
+				if d.reorder != nil {
+					for _, p := range d.reorder.flush(d.ready[:0]) {
+						d.accumulate(p)
+					}
+				}
 				d.drainPool()
 				continue
 			}
 			return nil, err
 		}
 
-		pkt, err := parsePacket(d.readBuf)
+		buf := d.readBuf
+		if prefix := packetPrefix(d.pktSize); len(buf) >= prefix+packetSize {
+			buf = buf[prefix : prefix+packetSize]
+		}
+		pkt, err := parsePacket(buf)
 		if err != nil {
+			d.corrupt(err)
 			continue // skip corrupt packets
 		}
 
-		flushed := d.pool.add(pkt)
-		if flushed == nil {
+		if d.reorder == nil {
+			d.accumulate(pkt)
 			continue
 		}
+		d.ready = d.reorder.add(pkt, d.ready[:0])
+		for _, p := range d.ready {
+			d.accumulate(p)
+		}
+	}
+}
 
-		results, err := d.processPackets(flushed)
-		if err != nil {
-			continue // skip corrupt sections
+// detectPacketSize reads the first bytes of the stream until their packet
+// size is known, or detectLen have been read, and sets it, then puts them
+// back ahead of the rest from the first whole packet.
+func (d *Demuxer) detectPacketSize() error {
+	d.detectSize = false
+	head := make([]byte, 0, detectLen)
+	for {
+		n, err := d.reader.Read(head[len(head):cap(head)])
+		head = head[:len(head)+n]
+		if size, start, ok := detectPacketSize(head); ok {
+			d.pktSize = size
+			d.readBuf = make([]byte, size)
+			head = head[start:]
+			break
 		}
-		if len(results) == 0 {
-			continue
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
 		}
+		if err != nil || len(head) == cap(head) {
+			break
+		}
+	}
+	d.reader = io.MultiReader(bytes.NewReader(head), d.reader)
+	if d.onPacketSize != nil {
+		d.onPacketSize(d.pktSize)
+	}
+	return nil
+}
 
-		// Update program map from PAT results.
-		for _, r := range results {
-			if r.PAT != nil {
-				for _, p := range r.PAT.Programs {
-					d.programMap.addPMTPID(p.ProgramMapID)
-				}
+// accumulate adds a packet to its PID's accumulator, queueing whatever
+// the unit it completes parses to.
+func (d *Demuxer) accumulate(pkt *Packet) {
+	flushed := d.pool.add(pkt)
+	if flushed == nil {
+		return
+	}
+
+	results, err := d.processPackets(flushed)
+	if err != nil {
+		d.corrupt(err)
+		return // skip corrupt sections
+	}
+
+	// Update program map from PAT results.
+	for _, r := range results {
+		if r.PAT != nil {
+			for _, p := range r.PAT.Programs {
+				d.programMap.addPMTPID(p.ProgramMapID)
 			}
 		}
-
-		d.dataBuffer = results[1:]
-		return results[0], nil
 	}
+	d.dataBuffer = append(d.dataBuffer, results...)
 }
 
 func (d *Demuxer) drainPool() {
 	for _, packets := range d.pool.dump() {
 		results, err := d.processPackets(packets)
 		if err != nil {
+			d.corrupt(err)
 			continue
 		}
 		// Update program map from PAT results so subsequent PMT
@@ -140,6 +256,13 @@ func (d *Demuxer) drainPool() {
 	}
 }
 
+// corrupt reports a skipped packet or section to the corrupt handler.
+func (d *Demuxer) corrupt(err error) {
+	if d.onCorrupt != nil {
+		d.onCorrupt(err)
+	}
+}
+
 func (d *Demuxer) processPackets(packets []*Packet) ([]*DemuxerData, error) {
 	if len(packets) == 0 {
 		return nil, nil
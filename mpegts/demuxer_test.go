@@ -225,7 +225,10 @@ func TestDemuxer_CorruptPacketSkipped(t *testing.T) {
 	stream.Write(buildTSPacket(0x0000, 1, true, patPayload))
 
 	ctx := context.Background()
-	dmx := NewDemuxer(ctx, &stream)
+	var corruptErrs []error
+	dmx := NewDemuxer(ctx, &stream, DemuxerOptCorruptHandler(func(err error) {
+		corruptErrs = append(corruptErrs, err)
+	}))
 
 	gotPAT := 0
 	for {
@@ -244,6 +247,9 @@ func TestDemuxer_CorruptPacketSkipped(t *testing.T) {
 	if gotPAT == 0 {
 		t.Error("should have parsed at least one PAT despite corrupt packet")
 	}
+	if len(corruptErrs) != 1 {
+		t.Errorf("corrupt handler called %d times, want 1: %v", len(corruptErrs), corruptErrs)
+	}
 }
 
 // TestDemuxer_GoldenVectors parses a real TS file and verifies PMT streams
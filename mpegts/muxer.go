@@ -0,0 +1,270 @@
+package mpegts
+
+import (
+	"errors"
+	"io"
+)
+
+// Elementary stream types written in the PMT.
+const (
+	StreamTypeAAC  uint8 = 0x0F // ADTS
+	StreamTypeH264 uint8 = 0x1B
+	StreamTypeH265 uint8 = 0x24
+	StreamTypeAC3  uint8 = 0x81 // ATSC A/52
+	StreamTypeEAC3 uint8 = 0x87 // ATSC A/52 Annex G
+
+	// StreamTypeSCTE35 lists a PID carrying SCTE-35 splice_info_sections.
+	// Write the sections with scte35.PacketizerState, not WriteAccessUnit.
+	StreamTypeSCTE35 uint8 = 0x86
+)
+
+const (
+	tsPacketSize = 188
+	tsSyncByte   = 0x47
+
+	// muxPMTPID carries the single program's PMT.
+	muxPMTPID uint16 = 0x1000
+
+	// pcrDelay is how far the PCR runs behind the DTS of the access unit
+	// that carries it (100ms at 90kHz), giving decoders buffering headroom.
+	pcrDelay = 9000
+
+	// ptsMask keeps timestamps within the 33-bit PTS/DTS/PCR base.
+	ptsMask = 1<<33 - 1
+)
+
+// ErrUnknownPID is returned when writing to a PID the Muxer was not
+// configured with.
+var ErrUnknownPID = errors.New("mpegts: unknown PID")
+
+// MuxStream describes one elementary stream of a Muxer's program.
+type MuxStream struct {
+	PID        uint16
+	StreamType uint8
+
+	// Descriptors are written as the stream's ES_info descriptor loop.
+	Descriptors []byte
+}
+
+// Muxer writes access units as a single-program MPEG-TS byte stream: PAT
+// and PMT, then one PES packet per access unit. The first stream carries
+// the PCR. Not safe for concurrent use.
+type Muxer struct {
+	w           io.Writer
+	streams     []MuxStream
+	programInfo []byte
+	cc          map[uint16]uint8
+	pkt         [tsPacketSize]byte
+	af          [tsPacketSize]byte
+	pes         []byte
+}
+
+// NewMuxer returns a Muxer writing a program made of streams to w. The
+// first stream carries the PCR, so it should be the video stream when
+// there is one.
+func NewMuxer(w io.Writer, streams ...MuxStream) *Muxer {
+	return &Muxer{
+		w:       w,
+		streams: streams,
+		cc:      make(map[uint16]uint8),
+	}
+}
+
+// SetProgramDescriptors sets the program_info descriptor loop written in
+// the PMT, such as a CA_descriptor.
+func (m *Muxer) SetProgramDescriptors(descriptors []byte) {
+	m.programInfo = descriptors
+}
+
+// WritePSI writes the PAT and PMT. Call it before the first access unit
+// and again before each random access point, so a reader joining
+// mid-stream can find the program.
+func (m *Muxer) WritePSI() error {
+	pat := []byte{
+		0x00, 0x01, // transport_stream_id
+		0xC1,       // version 0, current_next
+		0x00, 0x00, // section_number, last_section_number
+		0x00, 0x01, // program_number
+		0xE0 | byte(muxPMTPID>>8), byte(muxPMTPID & 0xFF),
+	}
+	if err := m.writeSection(pidPAT, tableIDPAT, pat); err != nil {
+		return err
+	}
+
+	var pcrPID uint16 = 0x1FFF
+	if len(m.streams) > 0 {
+		pcrPID = m.streams[0].PID
+	}
+	pmt := []byte{
+		0x00, 0x01, // program_number
+		0xC1,       // version 0, current_next
+		0x00, 0x00, // section_number, last_section_number
+		0xE0 | byte(pcrPID>>8), byte(pcrPID),
+		0xF0 | byte(len(m.programInfo)>>8), byte(len(m.programInfo)),
+	}
+	pmt = append(pmt, m.programInfo...)
+	for _, s := range m.streams {
+		n := len(s.Descriptors)
+		pmt = append(pmt, s.StreamType, 0xE0|byte(s.PID>>8), byte(s.PID), 0xF0|byte(n>>8), byte(n))
+		pmt = append(pmt, s.Descriptors...)
+	}
+	return m.writeSection(muxPMTPID, tableIDPMT, pmt)
+}
+
+// writeSection wraps body in a long-form PSI section with its CRC and
+// writes it as one packet.
+func (m *Muxer) writeSection(pid uint16, tableID byte, body []byte) error {
+	length := len(body) + 4 // CRC32
+	section := make([]byte, 0, 3+length)
+	section = append(section, tableID, 0xB0|byte(length>>8), byte(length))
+	section = append(section, body...)
+	crc := computeCRC32(section)
+	section = append(section, byte(crc>>24), byte(crc>>16), byte(crc>>8), byte(crc))
+
+	pkt := m.header(pid, true, false)
+	pkt = append(pkt, 0x00) // pointer_field
+	pkt = append(pkt, section...)
+	for len(pkt) < tsPacketSize {
+		pkt = append(pkt, 0xFF)
+	}
+	_, err := m.w.Write(pkt)
+	return err
+}
+
+// WriteAccessUnit writes data as one PES packet on pid. pts and dts are in
+// 90kHz units; a dts equal to pts is omitted from the header. randomAccess
+// sets the random_access_indicator, which readers use to find keyframes.
+// Access units on the PCR stream also carry the PCR.
+func (m *Muxer) WriteAccessUnit(pid uint16, pts, dts int64, randomAccess bool, data []byte) error {
+	idx := -1
+	for i, s := range m.streams {
+		if s.PID == pid {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 {
+		return ErrUnknownPID
+	}
+
+	streamID := byte(0xC0) // audio stream 0
+	switch m.streams[idx].StreamType {
+	case StreamTypeH264, StreamTypeH265:
+		streamID = 0xE0 // video stream 0
+	case StreamTypeAC3, StreamTypeEAC3:
+		streamID = 0xBD // private_stream_1, as ATSC A/52 requires
+	}
+
+	pts &= ptsMask
+	dts &= ptsMask
+	hdrLen := 5
+	flags := byte(0x80) // PTS only
+	if dts != pts {
+		hdrLen = 10
+		flags = 0xC0 // PTS and DTS
+	}
+	// PES_packet_length may be zero (unbounded) only for video.
+	pesLen := 3 + hdrLen + len(data)
+	if pesLen > 0xFFFF || streamID == 0xE0 {
+		pesLen = 0
+	}
+
+	pes := append(m.pes[:0], 0x00, 0x00, 0x01, streamID, byte(pesLen>>8), byte(pesLen),
+		0x80, flags, byte(hdrLen))
+	if dts != pts {
+		pes = appendTimestamp(pes, 0x30, pts)
+		pes = appendTimestamp(pes, 0x10, dts)
+	} else {
+		pes = appendTimestamp(pes, 0x20, pts)
+	}
+	pes = append(pes, data...)
+	m.pes = pes
+
+	pcr := int64(-1)
+	if idx == 0 {
+		pcr = max(dts-pcrDelay, 0)
+	}
+	return m.writePES(pid, pes, pcr, randomAccess)
+}
+
+// appendTimestamp appends a 33-bit PTS or DTS in the 5-byte PES form with
+// the given 4-bit prefix.
+func appendTimestamp(b []byte, prefix byte, ts int64) []byte {
+	return append(b,
+		prefix|byte(ts>>29)&0x0E|0x01,
+		byte(ts>>22),
+		byte(ts>>14)|0x01,
+		byte(ts>>7),
+		byte(ts<<1)|0x01)
+}
+
+// writePES splits a PES packet across TS packets. The first packet carries
+// the adaptation field for the PCR (if pcr >= 0) and random access flag;
+// the last is padded with adaptation field stuffing.
+func (m *Muxer) writePES(pid uint16, pes []byte, pcr int64, randomAccess bool) error {
+	for first := true; first || len(pes) > 0; first = false {
+		hasAF := false
+		af := m.af[:0] // adaptation field after its length byte
+		if first && (pcr >= 0 || randomAccess) {
+			hasAF = true
+			var flags byte
+			if randomAccess {
+				flags |= 0x40
+			}
+			af = append(af, flags)
+			if pcr >= 0 {
+				af[0] |= 0x10
+				af = append(af,
+					byte(pcr>>25), byte(pcr>>17), byte(pcr>>9), byte(pcr>>1),
+					byte(pcr<<7)|0x7E, 0x00) // reserved bits, zero extension
+			}
+		}
+
+		room := tsPacketSize - 4
+		if hasAF {
+			room -= 1 + len(af)
+		}
+		if stuff := room - len(pes); stuff > 0 {
+			if !hasAF {
+				hasAF = true
+				stuff-- // length byte
+				if stuff > 0 {
+					af = append(af, 0x00) // no flags
+					stuff--
+				}
+			}
+			for ; stuff > 0; stuff-- {
+				af = append(af, 0xFF)
+			}
+		}
+
+		pkt := m.header(pid, first, hasAF)
+		if hasAF {
+			pkt = append(pkt, byte(len(af)))
+			pkt = append(pkt, af...)
+		}
+		n := tsPacketSize - len(pkt)
+		pkt = append(pkt, pes[:n]...)
+		pes = pes[n:]
+		if _, err := m.w.Write(pkt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// header starts a payload-bearing TS packet on pid in the scratch buffer,
+// advancing the PID's continuity counter.
+func (m *Muxer) header(pid uint16, unitStart, hasAF bool) []byte {
+	b1 := byte(pid>>8) & 0x1F
+	if unitStart {
+		b1 |= 0x40
+	}
+	ctl := byte(0x10) // payload only
+	if hasAF {
+		ctl = 0x30
+	}
+	cc := m.cc[pid]
+	m.cc[pid] = (cc + 1) & 0x0F
+	return append(m.pkt[:0], tsSyncByte, b1, byte(pid), ctl|cc)
+}
@@ -0,0 +1,110 @@
+package mpegts
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestMuxerRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	const videoPID, audioPID = 0x100, 0x101
+	type au struct {
+		pid      uint16
+		pts, dts int64
+		data     []byte
+	}
+	aus := []au{
+		{videoPID, 900_000, 897_000, bytes.Repeat([]byte{0xAB}, 1000)}, // spans packets
+		{audioPID, 899_000, 899_000, bytes.Repeat([]byte{0xCD}, 200)},
+		{videoPID, 903_000, 903_000, []byte{0, 0, 0, 1, 0x41}}, // stuffed
+		{videoPID, 1<<33 + 10, 1<<33 + 10, []byte{0x01}},       // wraps to 10
+	}
+
+	var buf bytes.Buffer
+	m := NewMuxer(&buf,
+		MuxStream{PID: videoPID, StreamType: StreamTypeH264},
+		MuxStream{PID: audioPID, StreamType: StreamTypeAAC})
+	if err := m.WritePSI(); err != nil {
+		t.Fatal(err)
+	}
+	for i, a := range aus {
+		if err := m.WriteAccessUnit(a.pid, a.pts, a.dts, i == 0, a.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.WriteAccessUnit(0x200, 0, 0, false, nil); !errors.Is(err, ErrUnknownPID) {
+		t.Errorf("unknown PID error = %v, want ErrUnknownPID", err)
+	}
+
+	out := buf.Bytes()
+	if len(out)%tsPacketSize != 0 {
+		t.Fatalf("output is %d bytes, not a whole number of packets", len(out))
+	}
+	cc := make(map[uint16]int)
+	for off := 0; off < len(out); off += tsPacketSize {
+		pkt := out[off : off+tsPacketSize]
+		if pkt[0] != tsSyncByte {
+			t.Fatalf("packet at %d: sync byte %#x", off, pkt[0])
+		}
+		pid := uint16(pkt[1]&0x1F)<<8 | uint16(pkt[2])
+		if want, ok := cc[pid]; ok && int(pkt[3]&0x0F) != want {
+			t.Errorf("packet at %d: PID %#x continuity counter %d, want %d", off, pid, pkt[3]&0x0F, want)
+		}
+		cc[pid] = int(pkt[3]+1) & 0x0F
+	}
+	// The first video packet carries the PCR and random access flag.
+	first := out[2*tsPacketSize:]
+	if first[3]&0x20 == 0 || first[5]&0x50 != 0x50 {
+		t.Errorf("first video packet adaptation flags = %#x, want PCR and random access", first[5])
+	}
+
+	d := NewDemuxer(context.Background(), bytes.NewReader(out))
+	var pes []*PESData
+	for {
+		data, err := d.NextData()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch {
+		case data.PAT != nil:
+			if len(data.PAT.Programs) != 1 || data.PAT.Programs[0].ProgramMapID != muxPMTPID {
+				t.Errorf("PAT programs = %+v, want PMT on %#x", data.PAT.Programs, muxPMTPID)
+			}
+		case data.PMT != nil:
+			es := data.PMT.ElementaryStreams
+			if len(es) != 2 || es[0].StreamType != StreamTypeH264 || es[1].ElementaryPID != audioPID {
+				t.Errorf("PMT streams = %+v", es)
+			}
+		case data.PES != nil:
+			pes = append(pes, data.PES)
+		}
+	}
+
+	if len(pes) != len(aus) {
+		t.Fatalf("demuxed %d PES packets, want %d", len(pes), len(aus))
+	}
+	byPID := map[uint8][]au{0xE0: {aus[0], aus[2], aus[3]}, 0xC0: {aus[1]}}
+	for _, p := range pes {
+		want := byPID[p.Header.StreamID][0]
+		byPID[p.Header.StreamID] = byPID[p.Header.StreamID][1:]
+		if !bytes.Equal(p.Data, want.data) {
+			t.Errorf("stream %#x: payload %d bytes, want %d", p.Header.StreamID, len(p.Data), len(want.data))
+		}
+		oh := p.Header.OptionalHeader
+		if got := oh.PTS.Base; got != want.pts&ptsMask {
+			t.Errorf("stream %#x: PTS = %d, want %d", p.Header.StreamID, got, want.pts&ptsMask)
+		}
+		if want.dts != want.pts {
+			if oh.DTS == nil || oh.DTS.Base != want.dts {
+				t.Errorf("stream %#x: DTS = %v, want %d", p.Header.StreamID, oh.DTS, want.dts)
+			}
+		}
+	}
+}
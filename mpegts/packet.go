@@ -1,6 +1,9 @@
 package mpegts
 
-import "fmt"
+import (
+	"bytes"
+	"fmt"
+)
 
 const (
 	packetSize = 188
@@ -32,6 +35,7 @@ func parsePacket(buf []byte) (*Packet, error) {
 		afLen := int(buf[offset])
 		if afLen > 0 && offset+1 < packetSize {
 			p.Header.DiscontinuityIndicator = buf[offset+1]&0x80 != 0
+			p.PrivateData = transportPrivateData(buf[offset+1 : min(offset+1+afLen, packetSize)])
 		}
 		offset += 1 + afLen
 		if offset > packetSize {
@@ -46,3 +50,32 @@ func parsePacket(buf []byte) (*Packet, error) {
 
 	return p, nil
 }
+
+// transportPrivateData returns a copy of the transport_private_data in an
+// adaptation field body (the bytes after adaptation_field_length), or nil
+// if there is none or it overruns the field.
+func transportPrivateData(af []byte) []byte {
+	flags := af[0]
+	if flags&0x02 == 0 {
+		return nil
+	}
+	pos := 1
+	if flags&0x10 != 0 { // PCR
+		pos += 6
+	}
+	if flags&0x08 != 0 { // OPCR
+		pos += 6
+	}
+	if flags&0x04 != 0 { // splice_countdown
+		pos++
+	}
+	if pos >= len(af) {
+		return nil
+	}
+	n := int(af[pos])
+	pos++
+	if pos+n > len(af) {
+		return nil
+	}
+	return bytes.Clone(af[pos : pos+n])
+}
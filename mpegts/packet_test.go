@@ -1,6 +1,7 @@
 package mpegts
 
 import (
+	"bytes"
 	"testing"
 )
 
@@ -138,6 +139,40 @@ func TestParsePacket_AdaptationField(t *testing.T) {
 	}
 }
 
+func TestParsePacket_PrivateData(t *testing.T) {
+	t.Parallel()
+	private := []byte{0xA0, 0x04, 0x10, 0x20, 0x30, 0x12}
+	tests := []struct {
+		name string
+		af   []byte // adaptation field body, after the length byte
+		want []byte
+	}{
+		{"none", []byte{0x00}, nil},
+		{"private only", append([]byte{0x02, byte(len(private))}, private...), private},
+		{
+			"after PCR and splice countdown",
+			append([]byte{0x16, 0, 0, 0, 0, 0, 0, 0x05, byte(len(private))}, private...),
+			private,
+		},
+		{"overrunning length", []byte{0x02, 0x20, 0x01}, nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			buf := makePacketWithAF(0x100, 0, len(tc.af), []byte{0xAA})
+			copy(buf[5:], tc.af)
+			p, err := parsePacket(buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(p.PrivateData, tc.want) {
+				t.Errorf("PrivateData = % x, want % x", p.PrivateData, tc.want)
+			}
+		})
+	}
+}
+
 func TestParsePacket_BadSyncByte(t *testing.T) {
 	t.Parallel()
 	buf := make([]byte, packetSize)
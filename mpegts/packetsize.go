@@ -0,0 +1,59 @@
+package mpegts
+
+// Packet sizes of the transport stream variants the demuxer reads. Each
+// carries a 188-byte TS packet: M2TS (Blu-ray, some IP cameras) prefixes
+// it with a 4-byte arrival timestamp, and DVB-ASI or broadcast captures
+// may append 16 bytes of Reed-Solomon parity.
+const (
+	PacketSizeTS   = packetSize
+	PacketSizeM2TS = 192
+	PacketSizeRS   = 204
+)
+
+// detectPackets is how many sync bytes, one packet apart, identify a
+// packet size. A stray 0x47 is common in payload; five in a row at the
+// stride are not.
+const detectPackets = 5
+
+// detectLen covers detectPackets packets of the largest size from any
+// offset in the first packet.
+const detectLen = (detectPackets + 1) * PacketSizeRS
+
+// packetPrefix returns how many bytes precede the TS packet in a packet
+// of size bytes.
+func packetPrefix(size int) int {
+	if size == PacketSizeM2TS {
+		return 4
+	}
+	return 0
+}
+
+// detectPacketSize finds the packet size of a transport stream from its
+// first bytes, trying 188, 192 and 204 in turn, and the offset in head of
+// its first whole packet. A head shorter than detectLen, all that has
+// arrived so far, is accepted if a sync byte starts each of its packets,
+// at least two, so a live stream is not held up waiting for more. It
+// returns false if no size fits.
+func detectPacketSize(head []byte) (size, start int, ok bool) {
+	for _, size := range []int{PacketSizeTS, PacketSizeM2TS, PacketSizeRS} {
+		prefix := packetPrefix(size)
+		for off := range min(size, len(head)) {
+			n := 0
+			for p := off; p < len(head) && head[p] == syncByte; p += size {
+				n++
+			}
+			short := len(head) < detectLen && n >= 2 && off+n*size >= len(head)
+			if n < detectPackets && !short {
+				continue
+			}
+			start = off - prefix
+			if start < 0 {
+				// The first sync byte's prefix was cut off; start at the
+				// next packet.
+				start += size
+			}
+			return size, start, true
+		}
+	}
+	return 0, 0, false
+}
@@ -0,0 +1,125 @@
+package mpegts
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"slices"
+	"testing"
+)
+
+// repacket rewraps 188-byte TS packets as size-byte ones: with a 4-byte
+// arrival timestamp before each for M2TS, or 16 parity bytes after each
+// for Reed-Solomon.
+func repacket(ts []byte, size int) []byte {
+	var out []byte
+	for i := 0; i+packetSize <= len(ts); i += packetSize {
+		if size == PacketSizeM2TS {
+			out = append(out, 0x00, 0x12, 0x34, byte(i))
+		}
+		out = append(out, ts[i:i+packetSize]...)
+		if size == PacketSizeRS {
+			out = append(out, bytes.Repeat([]byte{0xA5}, 16)...)
+		}
+	}
+	return out
+}
+
+func TestDetectPacketSize(t *testing.T) {
+	t.Parallel()
+
+	ts := bytes.Repeat(makePacket(0x100, 0, false, nil), 8)
+	tests := []struct {
+		name  string
+		head  []byte
+		size  int
+		start int
+		ok    bool
+	}{
+		{"TS", ts, 188, 0, true},
+		{"M2TS", repacket(ts, 192), 192, 0, true},
+		{"Reed-Solomon", repacket(ts, 204), 204, 0, true},
+		{"TS joined mid-packet", ts[100:], 188, 88, true},
+		{"M2TS joined mid-packet", repacket(ts, 192)[100:], 192, 92, true},
+		// The first sync byte's timestamp was cut off.
+		{"M2TS joined in timestamp", repacket(ts, 192)[2:], 192, 190, true},
+		{"short TS", ts[:2*188], 188, 0, true},
+		{"one packet", ts[:188], 0, 0, false},
+		{"no sync bytes", make([]byte, detectLen), 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			size, start, ok := detectPacketSize(tt.head)
+			if size != tt.size || start != tt.start || ok != tt.ok {
+				t.Errorf("detectPacketSize() = %d, %d, %v; want %d, %d, %v", size, start, ok, tt.size, tt.start, tt.ok)
+			}
+		})
+	}
+}
+
+func TestDemuxer_PacketSize(t *testing.T) {
+	t.Parallel()
+
+	var ts bytes.Buffer
+	ts.Write(buildTSPacket(0x0000, 0, true, buildPATPayload(1, []struct{ num, pid uint16 }{{1, 0x1000}})))
+	ts.Write(buildTSPacket(0x1000, 0, true, buildPMTPayload(1, 0x100, []struct {
+		streamType uint8
+		pid        uint16
+	}{{0x1B, 0x100}})))
+	for i, pts := range []int64{90000, 93003, 96006} {
+		pes := buildPESPayload(0xE0, pts, true, []byte{0x00, 0x00, 0x00, 0x01, 0x65})
+		ts.Write(buildTSPacket(0x100, uint8(i), true, pes))
+	}
+
+	tests := []struct {
+		name   string
+		size   int
+		detect bool
+	}{
+		{"TS detected", PacketSizeTS, true},
+		{"M2TS detected", PacketSizeM2TS, true},
+		{"Reed-Solomon detected", PacketSizeRS, true},
+		{"M2TS set", PacketSizeM2TS, false},
+		{"Reed-Solomon set", PacketSizeRS, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			in := ts.Bytes()
+			if tt.size != PacketSizeTS {
+				in = repacket(in, tt.size)
+			}
+			var detected int
+			opt := DemuxerOptPacketSize(tt.size)
+			if tt.detect {
+				opt = DemuxerOptDetectPacketSize(func(size int) { detected = size })
+			}
+			dmx := NewDemuxer(context.Background(), bytes.NewReader(in), opt,
+				DemuxerOptCorruptHandler(func(err error) { t.Errorf("corrupt: %v", err) }))
+
+			var pts []int64
+			for {
+				data, err := dmx.NextData()
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				if data.PES != nil {
+					pts = append(pts, data.PES.Header.OptionalHeader.PTS.Base)
+				}
+			}
+			if tt.detect && detected != tt.size {
+				t.Errorf("detected packet size %d, want %d", detected, tt.size)
+			}
+			if want := []int64{90000, 93003, 96006}; !slices.Equal(pts, want) {
+				t.Errorf("video PTS = %v, want %v", pts, want)
+			}
+		})
+	}
+}
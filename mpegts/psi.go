@@ -145,10 +145,17 @@ func parsePMTSection(data []byte) (*PMTData, error) {
 	sectionLength := int(data[1]&0x0F)<<8 | int(data[2])
 	sectionEnd := 3 + sectionLength
 
+	// descriptors returns the descriptor loop of length n at offset,
+	// cut short at the CRC if n overruns it.
+	descriptorEnd := min(sectionEnd, len(data)) - 4
+	descriptors := func(offset, n int) []byte {
+		return data[min(offset, descriptorEnd):min(offset+n, descriptorEnd)]
+	}
+
 	programInfoLength := int(data[10]&0x0F)<<8 | int(data[11])
 	offset := 12 + programInfoLength
 
-	pmt := &PMTData{}
+	pmt := &PMTData{CA: parseCADescriptors(descriptors(12, programInfoLength))}
 	// Parse elementary stream entries until 4 bytes before section end (CRC).
 	for offset+5 <= sectionEnd-4 {
 		streamType := data[offset]
@@ -158,6 +165,7 @@ func parsePMTSection(data []byte) (*PMTData, error) {
 		pmt.ElementaryStreams = append(pmt.ElementaryStreams, &PMTElementaryStream{
 			ElementaryPID: elementaryPID,
 			StreamType:    streamType,
+			CA:            parseCADescriptors(descriptors(offset+5, esInfoLength)),
 		})
 
 		offset += 5 + esInfoLength
@@ -165,3 +173,28 @@ func parsePMTSection(data []byte) (*PMTData, error) {
 
 	return pmt, nil
 }
+
+// descriptorTagCA is the tag of a CA_descriptor.
+const descriptorTagCA = 0x09
+
+// parseCADescriptors returns the CA descriptors of a PMT descriptor loop,
+// ignoring the others.
+func parseCADescriptors(loop []byte) []CADescriptor {
+	var cas []CADescriptor
+	for len(loop) >= 2 {
+		tag, n := loop[0], int(loop[1])
+		if 2+n > len(loop) {
+			break
+		}
+		// CA_system_ID, then reserved(3) and CA_PID(13), then private
+		// data.
+		if d := loop[2 : 2+n]; tag == descriptorTagCA && n >= 4 {
+			cas = append(cas, CADescriptor{
+				SystemID: uint16(d[0])<<8 | uint16(d[1]),
+				PID:      uint16(d[2]&0x1F)<<8 | uint16(d[3]),
+			})
+		}
+		loop = loop[2+n:]
+	}
+	return cas
+}
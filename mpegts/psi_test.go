@@ -1,7 +1,9 @@
 package mpegts
 
 import (
+	"bytes"
 	"encoding/binary"
+	"slices"
 	"testing"
 )
 
@@ -168,6 +170,45 @@ func TestParsePMTSection_H264_AAC(t *testing.T) {
 	}
 }
 
+func TestParsePMTSection_CADescriptors(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	m := NewMuxer(&buf,
+		MuxStream{PID: 0x100, StreamType: StreamTypeH264, Descriptors: []byte{
+			0x0A, 4, 'e', 'n', 'g', 0, // ISO_639_language_descriptor
+			0x09, 4, 0x0B, 0x00, 0xE1, 0x02, // CA_descriptor
+		}},
+		MuxStream{PID: 0x101, StreamType: StreamTypeAAC},
+	)
+	m.SetProgramDescriptors([]byte{0x09, 6, 0x06, 0x04, 0xE1, 0x01, 0xAA, 0xBB})
+	if err := m.WritePSI(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The PMT packet follows the PAT's; its section follows the pointer
+	// field.
+	section := buf.Bytes()[tsPacketSize+5:]
+	sectionLength := int(section[1]&0x0F)<<8 | int(section[2])
+	pmt, err := parsePMTSection(section[:3+sectionLength])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []CADescriptor{{SystemID: 0x0604, PID: 0x101}}; !slices.Equal(pmt.CA, want) {
+		t.Errorf("program CA = %+v, want %+v", pmt.CA, want)
+	}
+	if len(pmt.ElementaryStreams) != 2 {
+		t.Fatalf("expected 2 streams, got %d", len(pmt.ElementaryStreams))
+	}
+	if want := []CADescriptor{{SystemID: 0x0B00, PID: 0x102}}; !slices.Equal(pmt.ElementaryStreams[0].CA, want) {
+		t.Errorf("stream 0 CA = %+v, want %+v", pmt.ElementaryStreams[0].CA, want)
+	}
+	if es := pmt.ElementaryStreams[1]; es.CA != nil || es.StreamType != StreamTypeAAC {
+		t.Errorf("stream 1 = %+v, want AAC in the clear", es)
+	}
+}
+
 func TestParsePMTSection_BadCRC(t *testing.T) {
 	t.Parallel()
 	streams := []struct {
@@ -0,0 +1,156 @@
+package mpegts
+
+import (
+	"slices"
+	"time"
+)
+
+// maxReorderWindow caps the reorder window. The continuity counter has
+// only 16 values, so a packet further ahead than this cannot be told
+// apart from one left behind.
+const maxReorderWindow = 7
+
+// reorderBuffer puts back in order packets that arrive slightly out of
+// order, as SRT can deliver them after recovering a loss. A packet whose
+// continuity counter is a little ahead of the next one expected on its
+// PID is held until the packets before it arrive. The gap is given up as
+// lost once more than window packets of the PID are held or the oldest
+// has waited wait, and the held packets are released in order.
+type reorderBuffer struct {
+	window int
+	wait   time.Duration
+	now    func() time.Time
+
+	// onReordered is called for each packet that arrived after a later
+	// packet of its PID and was put back ahead of it.
+	onReordered func()
+
+	pids map[uint16]*pidReorder
+	held int // packets held across all PIDs
+}
+
+// pidReorder is the reorder state of one PID.
+type pidReorder struct {
+	next uint8 // continuity counter expected next
+	held []heldPacket
+}
+
+type heldPacket struct {
+	pkt *Packet
+	at  time.Time
+}
+
+func newReorderBuffer(window int, wait time.Duration) *reorderBuffer {
+	return &reorderBuffer{
+		window: min(window, maxReorderWindow),
+		wait:   wait,
+		now:    time.Now,
+		pids:   make(map[uint16]*pidReorder),
+	}
+}
+
+// add takes the next packet read and appends to out the packets now
+// ready for the accumulator, each PID's in continuity order.
+func (rb *reorderBuffer) add(p *Packet, out []*Packet) []*Packet {
+	now := rb.now()
+	out = rb.expire(now, out)
+
+	// Only packets with a payload advance the continuity counter.
+	if !p.Header.HasPayload || p.Header.TransportErrorIndicator {
+		return append(out, p)
+	}
+
+	cc := p.Header.ContinuityCounter
+	pr := rb.pids[p.Header.PID]
+	if pr == nil {
+		pr = &pidReorder{}
+		rb.pids[p.Header.PID] = pr
+	} else if !p.Header.DiscontinuityIndicator {
+		switch ahead := int((cc - pr.next) & 0x0F); {
+		case ahead == 0:
+			if len(pr.held) > 0 && rb.onReordered != nil {
+				rb.onReordered()
+			}
+			pr.next = (cc + 1) & 0x0F
+			return rb.drain(pr, append(out, p))
+		case ahead == 15:
+			// A repeat of the last packet, which the accumulator drops.
+			return append(out, p)
+		case ahead <= rb.window:
+			if slices.ContainsFunc(pr.held, func(h heldPacket) bool { return h.pkt.Header.ContinuityCounter == cc }) {
+				return out
+			}
+			pr.held = append(pr.held, heldPacket{pkt: p, at: now})
+			rb.held++
+			if len(pr.held) > rb.window {
+				out = rb.release(pr, out)
+			}
+			return out
+		case ahead >= 16-maxReorderWindow:
+			// Behind: a packet whose gap was already given up. Passing
+			// it on would break the PES assembled since.
+			return out
+		}
+	}
+
+	// The first packet of the PID, a signaled discontinuity or a jump
+	// too far to be reordering restarts the sequence.
+	out = rb.release(pr, out)
+	pr.next = (cc + 1) & 0x0F
+	return append(out, p)
+}
+
+// drain appends the held packets that follow on from pr.next.
+func (rb *reorderBuffer) drain(pr *pidReorder, out []*Packet) []*Packet {
+	for {
+		i := slices.IndexFunc(pr.held, func(h heldPacket) bool { return h.pkt.Header.ContinuityCounter == pr.next })
+		if i < 0 {
+			return out
+		}
+		out = append(out, pr.held[i].pkt)
+		pr.held = slices.Delete(pr.held, i, i+1)
+		rb.held--
+		pr.next = (pr.next + 1) & 0x0F
+	}
+}
+
+// release gives up on the gaps before pr's held packets, appending them
+// in continuity order.
+func (rb *reorderBuffer) release(pr *pidReorder, out []*Packet) []*Packet {
+	if len(pr.held) == 0 {
+		return out
+	}
+	next := pr.next
+	slices.SortFunc(pr.held, func(a, b heldPacket) int {
+		return int((a.pkt.Header.ContinuityCounter-next)&0x0F) - int((b.pkt.Header.ContinuityCounter-next)&0x0F)
+	})
+	for _, h := range pr.held {
+		out = append(out, h.pkt)
+	}
+	pr.next = (pr.held[len(pr.held)-1].pkt.Header.ContinuityCounter + 1) & 0x0F
+	rb.held -= len(pr.held)
+	pr.held = pr.held[:0]
+	return out
+}
+
+// expire releases the packets of every PID whose oldest held packet has
+// waited wait.
+func (rb *reorderBuffer) expire(now time.Time, out []*Packet) []*Packet {
+	if rb.held == 0 {
+		return out
+	}
+	for _, pr := range rb.pids {
+		if len(pr.held) > 0 && now.Sub(pr.held[0].at) >= rb.wait {
+			out = rb.release(pr, out)
+		}
+	}
+	return out
+}
+
+// flush releases every held packet, at the end of the stream.
+func (rb *reorderBuffer) flush(out []*Packet) []*Packet {
+	for _, pr := range rb.pids {
+		out = rb.release(pr, out)
+	}
+	return out
+}
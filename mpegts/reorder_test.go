@@ -0,0 +1,130 @@
+package mpegts
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestReorderBuffer(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		in        []uint8 // continuity counters of PID 0x100
+		window    int
+		want      []uint8
+		reordered int
+	}{
+		{"in order", []uint8{0, 1, 2, 3}, 3, []uint8{0, 1, 2, 3}, 0},
+		{"swapped pair", []uint8{0, 2, 1, 3}, 3, []uint8{0, 1, 2, 3}, 1},
+		{"late by two", []uint8{0, 2, 3, 1, 4}, 3, []uint8{0, 1, 2, 3, 4}, 1},
+		{"across wrap", []uint8{14, 0, 15, 1}, 3, []uint8{14, 15, 0, 1}, 1},
+		{"repeat passed on", []uint8{0, 1, 1, 2}, 3, []uint8{0, 1, 1, 2}, 0},
+		{"held duplicate dropped", []uint8{0, 2, 2, 1}, 3, []uint8{0, 1, 2}, 1},
+		// Holding a third packet exceeds the window: the gap at 1 is a
+		// loss, and 1 arriving after is dropped.
+		{"window exceeded", []uint8{0, 2, 3, 4, 1, 5}, 2, []uint8{0, 2, 3, 4, 5}, 0},
+		{"jump resyncs", []uint8{0, 1, 9, 10}, 3, []uint8{0, 1, 9, 10}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			rb := newReorderBuffer(tt.window, time.Hour)
+			reordered := 0
+			rb.onReordered = func() { reordered++ }
+
+			var got []uint8
+			for _, cc := range tt.in {
+				p := &Packet{Header: PacketHeader{PID: 0x100, HasPayload: true, ContinuityCounter: cc}}
+				for _, out := range rb.add(p, nil) {
+					got = append(got, out.Header.ContinuityCounter)
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("output = %v, want %v", got, tt.want)
+			}
+			if reordered != tt.reordered {
+				t.Errorf("reordered = %d, want %d", reordered, tt.reordered)
+			}
+		})
+	}
+}
+
+func TestReorderBufferWait(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+	rb := newReorderBuffer(3, 50*time.Millisecond)
+	rb.now = func() time.Time { return now }
+	pkt := func(pid uint16, cc uint8) *Packet {
+		return &Packet{Header: PacketHeader{PID: pid, HasPayload: true, ContinuityCounter: cc}}
+	}
+
+	rb.add(pkt(0x100, 0), nil)
+	if out := rb.add(pkt(0x100, 2), nil); len(out) != 0 {
+		t.Fatalf("packet ahead of a gap released at once: %d packets", len(out))
+	}
+
+	// A packet of another PID after the wait gives up the gap.
+	now = now.Add(50 * time.Millisecond)
+	out := rb.add(pkt(0x101, 0), nil)
+	if len(out) != 2 || out[0].Header.PID != 0x100 || out[0].Header.ContinuityCounter != 2 {
+		t.Fatalf("after the wait: %d packets, want the held one then the new one", len(out))
+	}
+	if out := rb.add(pkt(0x100, 3), nil); len(out) != 1 {
+		t.Errorf("after the gap was given up: %d packets, want 1", len(out))
+	}
+}
+
+func TestDemuxer_ReorderWindow(t *testing.T) {
+	t.Parallel()
+
+	// A video PES spanning three packets whose last two arrive swapped,
+	// then the start of the next PES to flush it.
+	data := bytes.Repeat([]byte{0xAB}, 400)
+	pes := buildPESPayload(0xE0, 90000, true, data)
+	var stream bytes.Buffer
+	stream.Write(buildTSPacket(0x0000, 0, true, buildPATPayload(1, []struct{ num, pid uint16 }{{1, 0x1000}})))
+	stream.Write(buildTSPacket(0x1000, 0, true, buildPMTPayload(1, 0x100, []struct {
+		streamType uint8
+		pid        uint16
+	}{{0x1B, 0x100}})))
+	stream.Write(buildTSPacket(0x100, 0, true, pes[:184]))
+	stream.Write(buildTSPacket(0x100, 2, false, pes[368:]))
+	stream.Write(buildTSPacket(0x100, 1, false, pes[184:368]))
+	stream.Write(buildTSPacket(0x100, 3, true, buildPESPayload(0xE0, 93003, true, []byte{1})))
+
+	for _, window := range []int{0, 3} {
+		reordered := 0
+		dmx := NewDemuxer(context.Background(), bytes.NewReader(stream.Bytes()),
+			DemuxerOptReorderWindow(window, time.Second),
+			DemuxerOptReorderHandler(func() { reordered++ }))
+
+		var first *PESData
+		for {
+			d, err := dmx.NextData()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d.PES != nil && first == nil {
+				first = d.PES
+			}
+		}
+
+		complete := first != nil && bytes.HasPrefix(first.Data, data)
+		if want := window > 0; complete != want {
+			t.Errorf("window %d: first PES complete = %v, want %v", window, complete, want)
+		}
+		if want := min(window, 1); reordered != want {
+			t.Errorf("window %d: reordered = %d, want %d", window, reordered, want)
+		}
+	}
+}
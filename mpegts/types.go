@@ -1,12 +1,17 @@
 // Package mpegts implements MPEG-TS demuxing for transport stream parsing.
 // It supports PAT/PMT discovery, PES reassembly with PTS/DTS extraction,
 // and a custom packet parser callback for intercepting raw packet data.
+// A minimal single-program Muxer writes transport streams back out.
 package mpegts
 
 // Packet is a parsed 188-byte MPEG-TS transport stream packet.
 type Packet struct {
 	Header  PacketHeader
 	Payload []byte
+
+	// PrivateData is the adaptation field's transport_private_data, or
+	// nil if the packet carries none.
+	PrivateData []byte
 }
 
 // PacketHeader contains the parsed header fields of a transport stream packet.
@@ -42,6 +47,9 @@ type PATProgram struct {
 
 // PMTData contains the parsed Program Map Table.
 type PMTData struct {
+	// CA lists the conditional access descriptors of the program info,
+	// which apply to all of its streams.
+	CA                []CADescriptor
 	ElementaryStreams []*PMTElementaryStream
 }
 
@@ -49,6 +57,17 @@ type PMTData struct {
 type PMTElementaryStream struct {
 	ElementaryPID uint16
 	StreamType    uint8
+
+	// CA lists the conditional access descriptors of this stream alone.
+	CA []CADescriptor
+}
+
+// CADescriptor is a conditional access descriptor: the CA system that
+// scrambles a program or stream, such as a DRM, and the PID of its ECM
+// or EMM stream.
+type CADescriptor struct {
+	SystemID uint16
+	PID      uint16
 }
 
 // PESData contains a reassembled Packetized Elementary Stream.
@@ -0,0 +1,159 @@
+package pipeline
+
+import (
+	"sync"
+
+	"github.com/zsiec/prism/demux"
+	"github.com/zsiec/prism/scte35"
+)
+
+// adBreakKey identifies a break by the cue that opened it. splice_insert
+// event IDs and segmentation event IDs are independent ID spaces.
+type adBreakKey struct {
+	segmentation bool
+	id           uint32
+}
+
+// adBreak is one cue-out. Times are video PTS in microseconds.
+type adBreak struct {
+	startType uint32 // segmentation type that opened it; 0 for splice_insert
+	start     int64
+	end       int64 // hard end: auto-return, segmentation duration, or cue-in; 0 if open
+	expected  int64 // end implied by a duration a cue-in must still confirm; 0 if unknown
+}
+
+// adBreakTracker turns SCTE-35 cue-outs and cue-ins into an "in an ad
+// break" signal, evaluated against the stream's current PTS. Breaks are
+// tracked per event ID, so overlapping cues such as a provider ad inside
+// a network break each close on their own; the stream is in a break while
+// any of them is active. Repeated cues for an open break are ignored.
+// It is safe for concurrent use.
+type adBreakTracker struct {
+	mu     sync.Mutex
+	breaks map[adBreakKey]*adBreak
+}
+
+func newAdBreakTracker() *adBreakTracker {
+	return &adBreakTracker{breaks: make(map[adBreakKey]*adBreak)}
+}
+
+// observe applies event at the current PTS now, in microseconds. A cue
+// with a splice time takes effect at that PTS rather than on arrival. A
+// cancel aborts the break its event ID opened, whether or not it has
+// started.
+func (t *adBreakTracker) observe(event *demux.SCTE35Event, now int64) {
+	at := now
+	if event.PTS > 0 && !event.Immediate {
+		at = event.PTS
+	}
+	duration := int64(event.Duration * 1_000_000)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.expireLocked(now)
+
+	segType := event.SegmentationTypeID
+	switch {
+	case event.Cancel:
+		delete(t.breaks, adBreakKey{
+			segmentation: event.CommandTypeID != scte35.SpliceInsertType,
+			id:           event.EventID,
+		})
+	case isBreakStart(segType):
+		if b, ok := t.openLocked(adBreakKey{segmentation: true, id: event.EventID}, segType, at); ok && duration > 0 {
+			b.end = at + duration
+		}
+	case isBreakStart(segType - 1):
+		t.closeLocked(adBreakKey{segmentation: true, id: event.EventID}, segType-1, at)
+	case event.CommandTypeID == scte35.SpliceInsertType && event.OutOfNetwork:
+		b, ok := t.openLocked(adBreakKey{id: event.EventID}, 0, at)
+		if !ok || duration <= 0 {
+			break
+		}
+		if event.AutoReturn {
+			b.end = at + duration
+		} else {
+			b.expected = at + duration
+		}
+	case event.CommandTypeID == scte35.SpliceInsertType:
+		t.closeLocked(adBreakKey{id: event.EventID}, 0, at)
+	}
+}
+
+// openLocked starts a break for key at start. It reports false, leaving
+// the break as it was, if key is already open.
+func (t *adBreakTracker) openLocked(key adBreakKey, startType uint32, start int64) (*adBreak, bool) {
+	if _, ok := t.breaks[key]; ok {
+		return nil, false
+	}
+	b := &adBreak{startType: startType, start: start}
+	t.breaks[key] = b
+	return b, true
+}
+
+// closeLocked ends the break opened under key at end. A segmentation
+// cue-in whose event ID matches no break closes the latest break opened by
+// the matching start type instead, since encoders do not always reuse the
+// cue-out's ID.
+func (t *adBreakTracker) closeLocked(key adBreakKey, startType uint32, end int64) {
+	b := t.breaks[key]
+	if b == nil && startType != 0 {
+		for k, candidate := range t.breaks {
+			if k.segmentation && candidate.startType == startType && (b == nil || candidate.start > b.start) {
+				b = candidate
+			}
+		}
+	}
+	if b != nil && (b.end == 0 || end < b.end) {
+		b.end = end
+	}
+}
+
+// expireLocked forgets breaks that have ended by now.
+func (t *adBreakTracker) expireLocked(now int64) {
+	for k, b := range t.breaks {
+		if b.end != 0 && b.end <= now {
+			delete(t.breaks, k)
+		}
+	}
+}
+
+// state reports whether the stream is in a break at now, and the time
+// left until the last active break is due to end. remainingMs is 0 when
+// no active break declared a duration.
+func (t *adBreakTracker) state(now int64) (inBreak bool, remainingMs int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.expireLocked(now)
+
+	for _, b := range t.breaks {
+		if b.start > now {
+			continue
+		}
+		inBreak = true
+		end := b.end
+		if end == 0 {
+			end = b.expected
+		}
+		if end > now {
+			remainingMs = max(remainingMs, (end-now)/1000)
+		}
+	}
+	return inBreak, remainingMs
+}
+
+// isBreakStart reports whether a segmentation type opens an ad break. The
+// matching end type is always the start type plus one.
+func isBreakStart(segType uint32) bool {
+	switch segType {
+	case scte35.SegmentationTypeBreakStart,
+		scte35.SegmentationTypeProviderAdStart,
+		scte35.SegmentationTypeDistributorAdStart,
+		scte35.SegmentationTypeProviderPOStart,
+		scte35.SegmentationTypeDistributorPOStart,
+		scte35.SegmentationTypeProviderAdBlockStart,
+		scte35.SegmentationTypeDistributorAdBlockStart:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,135 @@
+package pipeline
+
+import (
+	"testing"
+
+	"github.com/zsiec/prism/demux"
+	"github.com/zsiec/prism/scte35"
+)
+
+func TestAdBreakTracker(t *testing.T) {
+	t.Parallel()
+
+	spliceOut := func(id uint32, duration float64, autoReturn bool) *demux.SCTE35Event {
+		return &demux.SCTE35Event{
+			CommandTypeID: scte35.SpliceInsertType, EventID: id, OutOfNetwork: true,
+			Immediate: true, Duration: duration, AutoReturn: autoReturn,
+		}
+	}
+	spliceIn := func(id uint32) *demux.SCTE35Event {
+		return &demux.SCTE35Event{CommandTypeID: scte35.SpliceInsertType, EventID: id, Immediate: true}
+	}
+	segment := func(segType, id uint32, ptsSec int64, duration float64) *demux.SCTE35Event {
+		return &demux.SCTE35Event{
+			CommandTypeID: scte35.TimeSignalType, PTS: ptsSec * 1_000_000,
+			EventID: id, SegmentationTypeID: segType, Duration: duration,
+		}
+	}
+
+	cancel := func(commandType, id uint32) *demux.SCTE35Event {
+		return &demux.SCTE35Event{CommandTypeID: commandType, EventID: id, Cancel: true}
+	}
+
+	type step struct {
+		nowSec        int64
+		event         *demux.SCTE35Event
+		wantIn        bool
+		wantRemaining int64
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "auto return",
+			steps: []step{
+				{10, spliceOut(1, 30, true), true, 30_000},
+				{20, nil, true, 20_000},
+				{40, nil, false, 0},
+			},
+		},
+		{
+			name: "duration without auto return waits for cue-in",
+			steps: []step{
+				{10, spliceOut(1, 30, false), true, 30_000},
+				{50, nil, true, 0},
+				{55, spliceIn(1), false, 0},
+			},
+		},
+		{
+			name: "future splice time",
+			steps: []step{
+				{10, segment(scte35.SegmentationTypeBreakStart, 7, 12, 60), false, 0},
+				{12, nil, true, 60_000},
+				{72, nil, false, 0},
+			},
+		},
+		{
+			name: "overlapping breaks",
+			steps: []step{
+				{10, segment(scte35.SegmentationTypeBreakStart, 1, 10, 0), true, 0},
+				{20, segment(scte35.SegmentationTypeProviderAdStart, 2, 20, 15), true, 15_000},
+				{30, nil, true, 5_000},
+				{36, nil, true, 0},
+				{40, segment(scte35.SegmentationTypeBreakEnd, 99, 40, 0), false, 0},
+			},
+		},
+		{
+			name: "repeated cue-out keeps first start",
+			steps: []step{
+				{10, spliceOut(1, 30, true), true, 30_000},
+				{20, spliceOut(1, 30, true), true, 20_000},
+				{40, nil, false, 0},
+			},
+		},
+		{
+			name: "cue-in for another event",
+			steps: []step{
+				{10, spliceOut(1, 0, false), true, 0},
+				{20, spliceIn(2), true, 0},
+				{30, spliceIn(1), false, 0},
+			},
+		},
+		{
+			name: "splice insert cancel aborts break",
+			steps: []step{
+				{10, spliceOut(1, 30, false), true, 30_000},
+				{20, cancel(scte35.SpliceInsertType, 1), false, 0},
+			},
+		},
+		{
+			name: "segmentation cancel aborts pending break",
+			steps: []step{
+				{10, segment(scte35.SegmentationTypeProviderAdStart, 5, 12, 30), false, 0},
+				{11, cancel(scte35.TimeSignalType, 5), false, 0},
+				{12, nil, false, 0},
+			},
+		},
+		{
+			name: "cancel leaves other breaks",
+			steps: []step{
+				{10, spliceOut(1, 0, false), true, 0},
+				{15, cancel(scte35.TimeSignalType, 1), true, 0},
+				{20, cancel(scte35.SpliceInsertType, 1), false, 0},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			tr := newAdBreakTracker()
+			for i, s := range tt.steps {
+				now := s.nowSec * 1_000_000
+				if s.event != nil {
+					tr.observe(s.event, now)
+				}
+				in, remaining := tr.state(now)
+				if in != s.wantIn || remaining != s.wantRemaining {
+					t.Errorf("step %d at %ds: state = (%v, %d), want (%v, %d)",
+						i, s.nowSec, in, remaining, s.wantIn, s.wantRemaining)
+				}
+			}
+		})
+	}
+}
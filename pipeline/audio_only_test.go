@@ -0,0 +1,123 @@
+package pipeline
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/zsiec/prism/distribution"
+	"github.com/zsiec/prism/test/tools/tsutil"
+)
+
+const (
+	testPMTPID   = 0x1000
+	testAudioPID = 0x101
+)
+
+// buildAudioOnlyTS returns an MPEG-TS stream whose PMT declares a single
+// AAC elementary stream and no video, followed by n ADTS frames.
+func buildAudioOnlyTS(n int) []byte {
+	pat := []byte{
+		0x00,       // table_id
+		0xB0, 0x0D, // section_syntax_indicator, section_length=13
+		0x00, 0x01, // transport_stream_id
+		0xC1,       // version 0, current_next
+		0x00, 0x00, // section_number, last_section_number
+		0x00, 0x01, // program_number 1
+		0xE0 | byte(testPMTPID>>8), byte(testPMTPID & 0xFF),
+	}
+	pmt := []byte{
+		0x02,       // table_id
+		0xB0, 0x12, // section_length=18
+		0x00, 0x01, // program_number
+		0xC1,
+		0x00, 0x00,
+		0xE0 | byte(testAudioPID>>8), byte(testAudioPID & 0xFF), // PCR PID
+		0xF0, 0x00, // program_info_length=0
+		0x0F, // stream_type AAC
+		0xE0 | byte(testAudioPID>>8), byte(testAudioPID & 0xFF),
+		0xF0, 0x00, // ES_info_length=0
+	}
+
+	var out []byte
+	var patCC, pmtCC, audioCC byte
+	for i := 0; i < n; i++ {
+		out = append(out, tsutil.PSIPacket(pat, 0, &patCC)...)
+		out = append(out, tsutil.PSIPacket(pmt, testPMTPID, &pmtCC)...)
+
+		payload := make([]byte, 32)
+		frameLen := 7 + len(payload)
+		adts := []byte{
+			0xFF, 0xF1,
+			(1 << 6) | (3 << 2), // AAC-LC, 48 kHz
+			(2 << 6) | byte(frameLen>>11&0x03),
+			byte(frameLen >> 3),
+			byte(frameLen&0x07)<<5 | 0x1F,
+			0xFC,
+		}
+		es := append(adts, payload...)
+
+		pts := uint64(i) * 1920 // 1024 samples at 48 kHz in 90 kHz ticks
+		pesHdr := []byte{
+			0x00, 0x00, 0x01, 0xC0, 0x00, 0x00,
+			0x80, 0x80, 0x05,
+			0x21 | byte(pts>>29&0x0E),
+			byte(pts >> 22),
+			byte(pts>>14) | 0x01,
+			byte(pts >> 7),
+			byte(pts<<1) | 0x01,
+		}
+		out = append(out, tsutil.Packetize(tsutil.BuildPES(pesHdr, es), testAudioPID, &audioCC)...)
+	}
+	return out
+}
+
+func TestAudioOnlyStream(t *testing.T) {
+	t.Parallel()
+
+	// Keep the input open after the data so the pipeline behaves like a
+	// live audio-only feed rather than a file that hits EOF.
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	go func() { _, _ = pw.Write(buildAudioOnlyTS(20)) }()
+
+	relay := distribution.NewRelay()
+	p := New("radio", pr, relay)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	runDone := make(chan error, 1)
+	go func() { runDone <- p.Run(ctx) }()
+	defer func() {
+		cancel()
+		pw.Close()
+		<-runDone
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for p.PipelineDebug().AudioForwarded == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for audio frames to be forwarded")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if relay.HasVideo() {
+		t.Error("relay.HasVideo() = true for audio-only PMT")
+	}
+	if p.DemuxStats().HasVideo() {
+		t.Error("DemuxStats.HasVideo() = true for audio-only PMT")
+	}
+	if snap := p.StreamSnapshot(); snap.HasVideo || snap.Video.Codec != "" {
+		t.Errorf("snapshot HasVideo=%v codec=%q, want false/empty", snap.HasVideo, snap.Video.Codec)
+	}
+
+	// A viewer must not stall for the video info timeout.
+	waitCtx, waitCancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer waitCancel()
+	start := time.Now()
+	relay.WaitVideoInfo(waitCtx)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("WaitVideoInfo blocked for %v on audio-only stream", elapsed)
+	}
+}
@@ -0,0 +1,81 @@
+package pipeline
+
+import (
+	"sync"
+	"time"
+
+	"github.com/zsiec/prism/distribution"
+)
+
+// defaultAudioSkewThreshold is how far an audio track's latest PTS may
+// drift from its reference before the track is flagged as out of sync.
+// Muxers commonly interleave audio a few hundred milliseconds ahead of
+// video, so the default leaves room for that.
+const defaultAudioSkewThreshold = 500 * time.Millisecond
+
+// audioSyncTracker records the latest forwarded PTS of each audio track so
+// that their alignment with video, and with each other, can be checked
+// when a snapshot is taken. It is safe for concurrent use.
+type audioSyncTracker struct {
+	mu        sync.Mutex
+	threshold time.Duration
+	lastPTS   map[int]int64 // by track index, in microseconds
+}
+
+func newAudioSyncTracker() *audioSyncTracker {
+	return &audioSyncTracker{
+		threshold: defaultAudioSkewThreshold,
+		lastPTS:   make(map[int]int64),
+	}
+}
+
+// setThreshold sets the skew beyond which a track is flagged; zero
+// disables flagging.
+func (t *audioSyncTracker) setThreshold(threshold time.Duration) {
+	t.mu.Lock()
+	t.threshold = threshold
+	t.mu.Unlock()
+}
+
+// observe records pts, in microseconds, as the latest on track.
+func (t *audioSyncTracker) observe(track int, pts int64) {
+	t.mu.Lock()
+	t.lastPTS[track] = pts
+	t.mu.Unlock()
+}
+
+// apply sets the skew and out-of-sync flag of each track in tracks and
+// returns the widest PTS spread between any two audio tracks, in
+// milliseconds. Skew is measured against videoPTS or, for audio-only
+// streams where it is 0, against the lowest-numbered track.
+func (t *audioSyncTracker) apply(tracks []distribution.AudioTrackStats, videoPTS int64) int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ref, lowest := videoPTS, -1
+	var minPTS, maxPTS int64
+	first := true
+	for track, pts := range t.lastPTS {
+		if videoPTS == 0 && (lowest < 0 || track < lowest) {
+			lowest, ref = track, pts
+		}
+		if first || pts < minPTS {
+			minPTS = pts
+		}
+		if first || pts > maxPTS {
+			maxPTS = pts
+		}
+		first = false
+	}
+
+	for i := range tracks {
+		pts, ok := t.lastPTS[tracks[i].TrackIndex]
+		if !ok || ref == 0 {
+			continue
+		}
+		skew := pts - ref
+		tracks[i].SkewMs = skew / 1000
+		tracks[i].OutOfSync = t.threshold > 0 && max(skew, -skew) > t.threshold.Microseconds()
+	}
+	return (maxPTS - minPTS) / 1000
+}
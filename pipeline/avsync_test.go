@@ -0,0 +1,89 @@
+package pipeline
+
+import (
+	"testing"
+	"time"
+
+	"github.com/zsiec/prism/distribution"
+)
+
+func TestAudioSyncTracker(t *testing.T) {
+	t.Parallel()
+
+	type want struct {
+		skewMs    int64
+		outOfSync bool
+	}
+	tests := []struct {
+		name      string
+		threshold time.Duration
+		trackPTS  map[int]int64 // microseconds
+		videoPTS  int64
+		want      map[int]want
+		wantSkew  int64
+	}{
+		{
+			name:      "aligned with video",
+			threshold: 500 * time.Millisecond,
+			trackPTS:  map[int]int64{0: 10_020_000, 1: 10_010_000},
+			videoPTS:  10_000_000,
+			want:      map[int]want{0: {20, false}, 1: {10, false}},
+			wantSkew:  10,
+		},
+		{
+			name:      "second track behind",
+			threshold: 500 * time.Millisecond,
+			trackPTS:  map[int]int64{0: 10_000_000, 1: 9_400_000},
+			videoPTS:  10_000_000,
+			want:      map[int]want{0: {0, false}, 1: {-600, true}},
+			wantSkew:  600,
+		},
+		{
+			name:      "audio only against first track",
+			threshold: 500 * time.Millisecond,
+			trackPTS:  map[int]int64{0: 5_000_000, 1: 5_700_000, 2: 5_100_000},
+			want:      map[int]want{0: {0, false}, 1: {700, true}, 2: {100, false}},
+			wantSkew:  700,
+		},
+		{
+			name:     "flagging disabled",
+			trackPTS: map[int]int64{0: 10_000_000, 1: 12_000_000},
+			videoPTS: 10_000_000,
+			want:     map[int]want{0: {0, false}, 1: {2000, false}},
+			wantSkew: 2000,
+		},
+		{
+			name:      "track without frames",
+			threshold: 500 * time.Millisecond,
+			trackPTS:  map[int]int64{0: 10_000_000},
+			videoPTS:  11_000_000,
+			want:      map[int]want{0: {-1000, true}, 1: {0, false}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			tracker := newAudioSyncTracker()
+			tracker.setThreshold(tt.threshold)
+			for track, pts := range tt.trackPTS {
+				tracker.observe(track, pts)
+			}
+			var tracks []distribution.AudioTrackStats
+			for track := range tt.want {
+				tracks = append(tracks, distribution.AudioTrackStats{TrackIndex: track})
+			}
+
+			if got := tracker.apply(tracks, tt.videoPTS); got != tt.wantSkew {
+				t.Errorf("inter-track skew = %dms, want %dms", got, tt.wantSkew)
+			}
+			for _, track := range tracks {
+				w := tt.want[track.TrackIndex]
+				if track.SkewMs != w.skewMs || track.OutOfSync != w.outOfSync {
+					t.Errorf("track %d: skew %dms, out of sync %v; want %dms, %v",
+						track.TrackIndex, track.SkewMs, track.OutOfSync, w.skewMs, w.outOfSync)
+				}
+			}
+		})
+	}
+}
@@ -1,16 +1,16 @@
 // Package pipeline orchestrates the demux-to-distribution data flow for a
-// single stream, forwarding video, audio, and caption frames from the
+// single stream, forwarding video, audio, caption, and SCTE-35 data from the
 // Demuxer to the Relay while collecting telemetry.
 package pipeline
 
 import (
+	"bytes"
 	"context"
 	"io"
 	"log/slog"
 	"sync/atomic"
 	"time"
 
-	"github.com/zsiec/ccx"
 	"github.com/zsiec/prism/demux"
 	"github.com/zsiec/prism/distribution"
 	"github.com/zsiec/prism/media"
@@ -23,11 +23,14 @@ import (
 type Broadcaster interface {
 	BroadcastVideo(frame *media.VideoFrame)
 	BroadcastAudio(frame *media.AudioFrame)
-	BroadcastCaptions(frame *ccx.CaptionFrame)
+	BroadcastCaptions(frame *media.CaptionFrame)
+	BroadcastSCTE35(event *demux.SCTE35Event)
 	SetVideoInfo(info distribution.VideoInfo)
+	RefreshCatalog()
+	SetHasVideo(has bool)
 	SetAudioTrackCount(count int)
 	AudioTrackCount() int
-	SetAudioInfo(info distribution.AudioInfo)
+	SetAudioInfo(track int, info distribution.AudioInfo)
 	ViewerCount() int
 	ViewerStatsAll() []distribution.ViewerStats
 }
@@ -41,13 +44,17 @@ type Pipeline struct {
 	relay      Broadcaster
 	streamKey  string
 	demuxStats *distribution.DemuxStats
+	ingestRate *distribution.IngestRateMonitor
 	startTime  time.Time
 	protocol   string
+	adBreaks   *adBreakTracker
+	audioSync  *audioSyncTracker
 
 	videoForwarded  atomic.Int64
 	audioForwarded  atomic.Int64
+	videoInfo       distribution.VideoInfo // last VideoInfo sent to the relay
 	videoInfoSent   bool
-	audioInfoSent   bool
+	audioInfo       map[int]distribution.AudioInfo // last AudioInfo sent to the relay, by track
 	captionFwd      atomic.Int64
 	lastVideoFwdPTS atomic.Int64
 	lastAudioFwdPTS atomic.Int64
@@ -62,11 +69,17 @@ func New(streamKey string, input io.Reader, relay Broadcaster) *Pipeline {
 		log:       slog.With("stream", streamKey),
 		relay:     relay,
 		streamKey: streamKey,
+		audioInfo: make(map[int]distribution.AudioInfo),
 	}
 
+	p.ingestRate = distribution.NewIngestRateMonitor()
+	input = &countingReader{r: input, rate: p.ingestRate}
+
 	p.demuxer = demux.NewDemuxer(input, slog.With("component", "demuxer", "stream", streamKey))
 	p.demuxStats = distribution.NewDemuxStats()
 	p.demuxer.SetStats(p.demuxStats)
+	p.adBreaks = newAdBreakTracker()
+	p.audioSync = newAudioSyncTracker()
 	p.startTime = time.Now()
 
 	return p
@@ -78,22 +91,132 @@ func (p *Pipeline) SetProtocol(proto string) {
 	p.protocol = proto
 }
 
+// SetCorruptLogSampler sets how often the demuxer logs corrupt packets on
+// a lossy feed. Every corrupt packet is still counted in the PTS debug
+// stats regardless of sampling.
+func (p *Pipeline) SetCorruptLogSampler(s demux.LogSampler) {
+	p.demuxer.SetCorruptLogSampler(s)
+}
+
+// DemuxEvents returns the demuxer's channel of discrete anomalies, such as
+// corrupt packets and parse failures, for monitoring. It need not be read;
+// events are dropped when it is full.
+func (p *Pipeline) DemuxEvents() <-chan demux.DemuxEvent {
+	return p.demuxer.Events()
+}
+
+// SetDiscontinuityThreshold sets how far video PTS must jump backward
+// before the stream is treated as spliced: a new group is started at the
+// next keyframe and the catalog is re-sent. Zero disables detection.
+func (p *Pipeline) SetDiscontinuityThreshold(threshold time.Duration) {
+	p.demuxer.SetDiscontinuityThreshold(threshold)
+}
+
+// SetReorderWindow has the demuxer hold up to packets TS packets per PID,
+// for at most wait, when they arrive ahead of a continuity counter gap,
+// putting packets that SRT delivers slightly out of order back in order.
+// Zero packets, the default, disables it.
+func (p *Pipeline) SetReorderWindow(packets int, wait time.Duration) {
+	p.demuxer.SetReorderWindow(packets, wait)
+}
+
+// SetCaptionChannels sets the caption channel each CEA-708 service's
+// captions are emitted on, in place of demux.DefaultCaptionChannel.
+func (p *Pipeline) SetCaptionChannels(fn demux.CaptionChannelFunc) {
+	p.demuxer.SetCaptionChannels(fn)
+}
+
+// SetSCTE35PTSOffset sets an offset added to the PTS of every SCTE-35
+// event, for sources whose cues lead or lag the frames they mark. The
+// cue's own pts_adjustment is always applied.
+func (p *Pipeline) SetSCTE35PTSOffset(offset time.Duration) {
+	p.demuxer.SetSCTE35PTSOffset(offset)
+}
+
+// SetAACChannelCorrection sets whether AAC channel counts are corrected
+// from the program config element, as for dual-mono tracks, rather than
+// taken from the ADTS header as-is. It is on by default.
+func (p *Pipeline) SetAACChannelCorrection(on bool) {
+	p.demuxer.SetAACChannelCorrection(on)
+}
+
+// SetPrivateDataTimecode reads timecode from the data field tagged tag in
+// the video packets' adaptation field private data when an access unit
+// has no SEI timecode. Zero, the default, disables it.
+func (p *Pipeline) SetPrivateDataTimecode(tag uint8) {
+	p.demuxer.SetPrivateDataTimecode(tag)
+}
+
+// SetEmulationPreventionRepair sets whether video NAL units missing
+// emulation prevention bytes, or trailing zero bytes, are repaired before
+// they reach viewers. It is off by default.
+func (p *Pipeline) SetEmulationPreventionRepair(on bool) {
+	p.demuxer.SetEmulationPreventionRepair(on)
+}
+
+// SetAudioSkewThreshold sets how far an audio track's latest PTS may drift
+// from video's (or, without video, the first audio track's) before the
+// snapshot flags it as out of sync. Zero disables flagging; skew is still
+// reported.
+func (p *Pipeline) SetAudioSkewThreshold(threshold time.Duration) {
+	p.audioSync.setThreshold(threshold)
+}
+
+// SetGOPLimits sets the shortest and longest GOP, in frames, the stats
+// count as normal; GOPs outside them are counted in the snapshot's
+// Video.AbnormalGOPs. Zero disables a limit.
+func (p *Pipeline) SetGOPLimits(minFrames, maxFrames int) {
+	p.demuxStats.SetGOPLimits(minFrames, maxFrames)
+}
+
+// SetIngestThresholds configures the expected ingest bitrate range. When
+// the smoothed ingest bitrate falls outside it, the snapshot's IngestHealth
+// reports "low" or "high" and IngestBreaches is incremented. Invalid
+// thresholds are rejected and leave the previous range in place.
+func (p *Pipeline) SetIngestThresholds(th distribution.IngestThresholds) error {
+	return p.ingestRate.SetThresholds(th)
+}
+
 // StreamSnapshot returns a point-in-time snapshot of stream health metrics,
 // suitable for JSON serialization and delivery to viewers via the control stream.
 func (p *Pipeline) StreamSnapshot() distribution.StreamSnapshot {
 	video, audio, captions, scte35 := p.demuxStats.Snapshot()
+	now := time.Now()
+	ingest := p.ingestRate.Current()
+	inAdBreak, adBreakRemaining := p.adBreaks.state(p.currentPTS())
+	audioSkew := p.audioSync.apply(audio, p.lastVideoFwdPTS.Load())
 
 	return distribution.StreamSnapshot{
-		Timestamp:   time.Now().UnixMilli(),
-		UptimeMs:    time.Since(p.startTime).Milliseconds(),
-		Protocol:    p.protocol,
-		Video:       video,
-		Audio:       audio,
-		Captions:    captions,
-		SCTE35:      scte35,
-		ViewerCount: p.relay.ViewerCount(),
-		Viewers:     p.relay.ViewerStatsAll(),
+		Timestamp:      now.UnixMilli(),
+		UptimeMs:       now.Sub(p.startTime).Milliseconds(),
+		Protocol:       p.protocol,
+		IngestBytes:    ingest.Bytes,
+		IngestKbps:     ingest.Kbps,
+		IngestHealth:   ingest.Health,
+		IngestBreaches: ingest.Breaches,
+		HasVideo:       p.demuxStats.HasVideo(),
+		Video:          video,
+		Audio:          audio,
+		Captions:       captions,
+		SCTE35:         scte35,
+		ViewerCount:    p.relay.ViewerCount(),
+		Viewers:        p.relay.ViewerStatsAll(),
+
+		ConditionalAccess: p.demuxStats.ConditionalAccess(),
+
+		InAdBreak:          inAdBreak,
+		AdBreakRemainingMs: adBreakRemaining,
+		AudioSkewMs:        audioSkew,
+	}
+}
+
+// currentPTS returns the PTS of the latest forwarded video frame, or of
+// the latest audio frame for audio-only streams, in microseconds.
+func (p *Pipeline) currentPTS() int64 {
+	if pts := p.lastVideoFwdPTS.Load(); pts != 0 {
+		return pts
 	}
+	return p.lastAudioFwdPTS.Load()
 }
 
 // PipelineDebug returns low-level forwarding counters and channel depths
@@ -125,11 +248,13 @@ func (p *Pipeline) Run(ctx context.Context) error {
 		demuxErr <- err
 	}()
 
+	sampleCtx, stopSampling := context.WithCancel(ctx)
+	defer stopSampling()
+	go p.sampleIngestLoop(sampleCtx)
+
 	select {
 	case <-p.demuxer.PMTReady():
-		audioTracks := p.demuxer.AudioTrackChannels()
-		p.relay.SetAudioTrackCount(len(audioTracks))
-		p.log.Info("audio tracks", "count", len(audioTracks))
+		p.updateTracks()
 	case err := <-demuxErr:
 		p.log.Info("demuxer finished before PMT", "error", err)
 		return nil
@@ -137,11 +262,10 @@ func (p *Pipeline) Run(ctx context.Context) error {
 		return nil
 	}
 
-	lastTrackCount := p.relay.AudioTrackCount()
-
 	videoCh := p.demuxer.Video()
 	audioCh := p.demuxer.Audio()
 	captionCh := p.demuxer.Captions()
+	scte35Ch := p.demuxer.SCTE35()
 
 	for {
 		p.videoChanDepth.Store(int32(len(videoCh)))
@@ -165,6 +289,9 @@ func (p *Pipeline) Run(ctx context.Context) error {
 		case <-ctx.Done():
 			return nil
 
+		case <-p.demuxer.TracksChanged():
+			p.updateTracks()
+
 		case frame, ok := <-videoCh:
 			if !ok {
 				p.log.Info("video channel closed")
@@ -177,23 +304,11 @@ func (p *Pipeline) Run(ctx context.Context) error {
 				p.log.Info("audio channel closed")
 				return nil
 			}
-			newCount := len(p.demuxer.AudioTrackChannels())
-			if newCount > lastTrackCount {
-				p.relay.SetAudioTrackCount(newCount)
-				p.log.Info("audio tracks updated", "count", newCount)
-				lastTrackCount = newCount
-			}
-			if !p.audioInfoSent && frame.SampleRate > 0 {
-				p.relay.SetAudioInfo(distribution.AudioInfo{
-					Codec:      "mp4a.40.02",
-					SampleRate: frame.SampleRate,
-					Channels:   frame.Channels,
-				})
-				p.audioInfoSent = true
-			}
+			p.updateAudioInfo(frame)
 			p.relay.BroadcastAudio(frame)
 			p.audioForwarded.Add(1)
 			p.lastAudioFwdPTS.Store(frame.PTS)
+			p.audioSync.observe(frame.TrackIndex, frame.PTS)
 
 		case frame, ok := <-captionCh:
 			if !ok {
@@ -203,6 +318,14 @@ func (p *Pipeline) Run(ctx context.Context) error {
 			p.relay.BroadcastCaptions(frame)
 			p.captionFwd.Add(1)
 
+		case event, ok := <-scte35Ch:
+			if !ok {
+				p.log.Info("scte35 channel closed")
+				return nil
+			}
+			p.adBreaks.observe(event, p.currentPTS())
+			p.relay.BroadcastSCTE35(event)
+
 		case err := <-demuxErr:
 			p.log.Info("demuxer finished", "error", err)
 			return nil
@@ -210,20 +333,109 @@ func (p *Pipeline) Run(ctx context.Context) error {
 	}
 }
 
+// updateTracks passes the demuxer's current track layout to the relay,
+// which pushes an updated catalog to viewers when it changed.
+func (p *Pipeline) updateTracks() {
+	p.relay.SetHasVideo(p.demuxer.HasVideo())
+	count := len(p.demuxer.AudioTrackChannels())
+	if count != p.relay.AudioTrackCount() {
+		p.log.Info("audio tracks", "count", count)
+	}
+	p.relay.SetAudioTrackCount(count)
+}
+
+// updateAudioInfo passes the codec parameters of each audio track's first
+// frame to the relay, then those of its later frames whenever they change,
+// so a mid-stream sample rate, channel layout or AAC profile change
+// reaches the catalog.
+func (p *Pipeline) updateAudioInfo(frame *media.AudioFrame) {
+	if frame.SampleRate <= 0 {
+		return
+	}
+	prev, sent := p.audioInfo[frame.TrackIndex]
+	info := distribution.AudioInfo{
+		Codec:      frame.Codec,
+		SampleRate: frame.SampleRate,
+		Channels:   frame.Channels,
+	}
+	switch frame.Codec {
+	case media.AudioCodecAC3, media.AudioCodecEAC3:
+		// Described by the codec alone; no decoder configuration.
+	default:
+		// AAC is described by the AudioSpecificConfig derived from its
+		// ADTS header, and named by the object type it signals.
+		info.Codec = "mp4a.40.02"
+		if hdr, err := demux.ParseADTSHeader(frame.Data); err == nil {
+			info.Config = hdr.AudioSpecificConfig()
+			if codec, err := demux.AACCodecString(info.Config); err == nil {
+				info.Codec = codec
+			}
+		}
+	}
+	if sent && info.Codec == prev.Codec && info.SampleRate == prev.SampleRate &&
+		info.Channels == prev.Channels && bytes.Equal(info.Config, prev.Config) {
+		return
+	}
+	p.relay.SetAudioInfo(frame.TrackIndex, info)
+	p.audioInfo[frame.TrackIndex] = info
+}
+
 // forwardVideo extracts video codec info on the first keyframe, then
 // broadcasts the frame to all viewers via the relay.
 func (p *Pipeline) forwardVideo(frame *media.VideoFrame) {
-	if !p.videoInfoSent && frame.IsKeyframe && frame.SPS != nil {
-		if vi, ok := p.buildVideoInfo(frame); ok {
+	// Re-derive codec parameters on every keyframe so a mid-stream
+	// resolution or profile change from an adaptive source reaches the
+	// relay, which pushes an updated catalog to viewers.
+	changed := false
+	if frame.IsKeyframe && frame.SPS != nil {
+		if vi, ok := p.buildVideoInfo(frame); ok && (!p.videoInfoSent || !vi.Equal(p.videoInfo)) {
 			p.relay.SetVideoInfo(vi)
+			p.videoInfo = vi
 			p.videoInfoSent = true
+			changed = true
 		}
 	}
+	// A splice re-sends the catalog even if the parameters survived it,
+	// so clients resynchronize at the discontinuity.
+	if frame.Discontinuity && !changed {
+		p.relay.RefreshCatalog()
+	}
 	p.relay.BroadcastVideo(frame)
 	p.videoForwarded.Add(1)
 	p.lastVideoFwdPTS.Store(frame.PTS)
 }
 
+// sampleIngestLoop advances the ingest bitrate average on a fixed cadence,
+// independent of whether any viewer or API client requests snapshots.
+func (p *Pipeline) sampleIngestLoop(ctx context.Context) {
+	ticker := time.NewTicker(distribution.IngestSampleInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			p.ingestRate.Sample(now)
+		}
+	}
+}
+
+// countingReader feeds the number of bytes read from the ingest source
+// into the pipeline's ingest rate monitor.
+type countingReader struct {
+	r    io.Reader
+	rate *distribution.IngestRateMonitor
+}
+
+func (c *countingReader) Read(b []byte) (int, error) {
+	n, err := c.r.Read(b)
+	if n > 0 {
+		c.rate.Record(n)
+	}
+	return n, err
+}
+
 // buildVideoInfo parses the SPS from a keyframe and builds the VideoInfo
 // including decoder configuration record for the catalog.
 func (p *Pipeline) buildVideoInfo(frame *media.VideoFrame) (distribution.VideoInfo, bool) {
@@ -8,7 +8,7 @@ import (
 	"testing"
 	"time"
 
-	"github.com/zsiec/ccx"
+	"github.com/zsiec/prism/demux"
 	"github.com/zsiec/prism/distribution"
 	"github.com/zsiec/prism/media"
 )
@@ -19,7 +19,7 @@ type testViewer struct {
 	mu       sync.Mutex
 	videos   []*media.VideoFrame
 	audios   []*media.AudioFrame
-	captions []*ccx.CaptionFrame
+	captions []*media.CaptionFrame
 
 	videoSent      atomic.Int64
 	audioSent      atomic.Int64
@@ -45,13 +45,15 @@ func (v *testViewer) SendAudio(frame *media.AudioFrame) {
 	v.audioSent.Add(1)
 }
 
-func (v *testViewer) SendCaptions(frame *ccx.CaptionFrame) {
+func (v *testViewer) SendCaptions(frame *media.CaptionFrame) {
 	v.mu.Lock()
 	v.captions = append(v.captions, frame)
 	v.mu.Unlock()
 	v.captionSent.Add(1)
 }
 
+func (v *testViewer) SendSCTE35(_ *demux.SCTE35Event) {}
+
 func (v *testViewer) Stats() distribution.ViewerStats {
 	return distribution.ViewerStats{
 		ID:             v.id,
@@ -142,6 +144,9 @@ func TestIntegration_TSFileToViewer(t *testing.T) {
 	if snap.Video.TotalFrames == 0 {
 		t.Error("StreamSnapshot.Video.TotalFrames should be > 0")
 	}
+	if fi, err := f.Stat(); err == nil && snap.IngestBytes != fi.Size() {
+		t.Errorf("StreamSnapshot.IngestBytes: got %d, want file size %d", snap.IngestBytes, fi.Size())
+	}
 }
 
 // TestIntegration_LateJoinGOPReplay feeds a TS file through the pipeline,
@@ -1,11 +1,14 @@
 package pipeline
 
 import (
+	"bytes"
 	"context"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/zsiec/prism/distribution"
+	"github.com/zsiec/prism/media"
 )
 
 func TestNew(t *testing.T) {
@@ -29,6 +32,48 @@ func TestStreamSnapshotBeforeRun(t *testing.T) {
 	if snap.ViewerCount != 0 {
 		t.Errorf("ViewerCount: got %d, want 0", snap.ViewerCount)
 	}
+	if snap.IngestHealth != "" {
+		t.Errorf("IngestHealth without thresholds: got %q, want empty", snap.IngestHealth)
+	}
+}
+
+func TestStreamSnapshotIngest(t *testing.T) {
+	t.Parallel()
+
+	const size = 188 * 100
+	relay := distribution.NewRelay()
+	p := New("test-stream", bytes.NewReader(make([]byte, size)), relay)
+
+	if err := p.SetIngestThresholds(distribution.IngestThresholds{LowKbps: 5000, HighKbps: 1000}); err == nil {
+		t.Error("SetIngestThresholds accepted low >= high")
+	}
+	if err := p.SetIngestThresholds(distribution.IngestThresholds{LowKbps: 500, HighKbps: 2000}); err != nil {
+		t.Fatalf("SetIngestThresholds: %v", err)
+	}
+	if snap := p.StreamSnapshot(); snap.IngestHealth != distribution.IngestHealthOK {
+		t.Errorf("IngestHealth before first sample: got %q, want ok", snap.IngestHealth)
+	}
+
+	if err := p.Run(context.Background()); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	// 18.8 KB over a second is ~150 kbps, well under the 500 kbps floor.
+	p.ingestRate.Sample(time.Now().Add(time.Second))
+
+	snap := p.StreamSnapshot()
+	if snap.IngestBytes != size {
+		t.Errorf("IngestBytes: got %d, want %d", snap.IngestBytes, size)
+	}
+	if snap.IngestKbps <= 0 {
+		t.Errorf("IngestKbps: got %.2f, want > 0", snap.IngestKbps)
+	}
+	if snap.IngestHealth != distribution.IngestHealthLow {
+		t.Errorf("IngestHealth: got %q, want %q", snap.IngestHealth, distribution.IngestHealthLow)
+	}
+	if snap.IngestBreaches != 1 {
+		t.Errorf("IngestBreaches: got %d, want 1", snap.IngestBreaches)
+	}
 }
 
 func TestRunWithEOFReader(t *testing.T) {
@@ -71,3 +116,118 @@ func TestDemuxStats(t *testing.T) {
 		t.Fatal("expected non-nil DemuxStats")
 	}
 }
+
+func TestForwardVideoResolutionChange(t *testing.T) {
+	t.Parallel()
+
+	sps720 := []byte{
+		0x67, 0x64, 0x00, 0x1f, 0xac, 0xd9, 0x40, 0x50,
+		0x05, 0xbb, 0xff, 0x00, 0x03, 0x00, 0x04, 0x6a,
+		0x02, 0x02, 0x02, 0x80, 0x00, 0x01, 0xf4, 0x80,
+		0x00, 0x5d, 0xc0, 0x07, 0x8c, 0x18, 0xcb,
+	}
+	sps192 := []byte{
+		0x67, 0x4d, 0x40, 0x1f, 0xb9, 0x08, 0x08, 0x0c,
+		0xd8, 0x0b, 0x50, 0x10, 0x10, 0x14, 0x00, 0x00,
+		0x0f, 0xa4, 0x00, 0x02, 0xee, 0x03, 0x81, 0x80,
+		0x04, 0x93, 0xc0, 0x02, 0x49, 0xe8, 0xa0, 0xc0,
+		0x3a, 0x8e, 0x18, 0xc9,
+	}
+	pps := []byte{0x68, 0xee, 0x3c, 0x80}
+
+	relay := distribution.NewRelay()
+	p := New("test-stream", strings.NewReader(""), relay)
+
+	keyframe := func(sps []byte, group uint32) *media.VideoFrame {
+		return &media.VideoFrame{IsKeyframe: true, SPS: sps, PPS: pps, Codec: "h264", GroupID: group}
+	}
+
+	p.forwardVideo(keyframe(sps720, 1))
+	if vi := relay.VideoInfo(); vi.Width != 1280 || vi.Height != 720 {
+		t.Fatalf("initial resolution = %dx%d, want 1280x720", vi.Width, vi.Height)
+	}
+	seq, changed := relay.CatalogUpdates()
+
+	p.forwardVideo(keyframe(sps720, 2))
+	if got, _ := relay.CatalogUpdates(); got != seq {
+		t.Errorf("unchanged parameters bumped catalog sequence %d -> %d", seq, got)
+	}
+
+	p.forwardVideo(keyframe(sps192, 3))
+	if vi := relay.VideoInfo(); vi.Width != 256 || vi.Height != 192 {
+		t.Errorf("resolution after switch = %dx%d, want 256x192", vi.Width, vi.Height)
+	}
+	select {
+	case <-changed:
+	default:
+		t.Error("resolution change should signal a catalog update")
+	}
+	if got, _ := relay.CatalogUpdates(); got != seq+1 {
+		t.Errorf("catalog sequence = %d, want %d", got, seq+1)
+	}
+}
+
+func TestForwardVideoDiscontinuityRefreshesCatalog(t *testing.T) {
+	t.Parallel()
+
+	sps := []byte{
+		0x67, 0x64, 0x00, 0x1f, 0xac, 0xd9, 0x40, 0x50,
+		0x05, 0xbb, 0xff, 0x00, 0x03, 0x00, 0x04, 0x6a,
+		0x02, 0x02, 0x02, 0x80, 0x00, 0x01, 0xf4, 0x80,
+		0x00, 0x5d, 0xc0, 0x07, 0x8c, 0x18, 0xcb,
+	}
+	pps := []byte{0x68, 0xee, 0x3c, 0x80}
+
+	relay := distribution.NewRelay()
+	p := New("test-stream", strings.NewReader(""), relay)
+
+	p.forwardVideo(&media.VideoFrame{IsKeyframe: true, SPS: sps, PPS: pps, Codec: "h264", GroupID: 1})
+	seq, changed := relay.CatalogUpdates()
+
+	p.forwardVideo(&media.VideoFrame{IsKeyframe: true, SPS: sps, PPS: pps, Codec: "h264", GroupID: 2, Discontinuity: true})
+	select {
+	case <-changed:
+	default:
+		t.Error("discontinuity should signal a catalog update")
+	}
+	if got, _ := relay.CatalogUpdates(); got != seq+1 {
+		t.Errorf("catalog sequence = %d, want %d", got, seq+1)
+	}
+}
+
+func TestUpdateAudioInfoProfileChange(t *testing.T) {
+	t.Parallel()
+
+	// adts returns a 48kHz stereo ADTS frame of the given profile
+	// (object type minus one) with an empty payload.
+	adts := func(profile byte) []byte {
+		const frameLen = 7
+		return []byte{0xFF, 0xF1, profile<<6 | 3<<2, 2 << 6, frameLen >> 3, frameLen&0x07<<5 | 0x1F, 0xFC}
+	}
+
+	relay := distribution.NewRelay()
+	p := New("test-stream", strings.NewReader(""), relay)
+	frame := func(profile byte) *media.AudioFrame {
+		return &media.AudioFrame{Data: adts(profile), SampleRate: 48000, Channels: 2, Codec: media.AudioCodecAAC}
+	}
+
+	p.updateAudioInfo(frame(1))
+	if got := relay.AudioInfo(0); got.Codec != "mp4a.40.02" || !bytes.Equal(got.Config, []byte{0x11, 0x90}) {
+		t.Fatalf("AAC-LC audio info = %+v, want mp4a.40.02 with config 11 90", got)
+	}
+	seq, _ := relay.CatalogUpdates()
+
+	p.updateAudioInfo(frame(1))
+	if got, _ := relay.CatalogUpdates(); got != seq {
+		t.Errorf("unchanged parameters bumped catalog sequence %d -> %d", seq, got)
+	}
+
+	// Only the profile changes, and with it the AudioSpecificConfig.
+	p.updateAudioInfo(frame(0))
+	if got := relay.AudioInfo(0); got.Codec != "mp4a.40.01" || !bytes.Equal(got.Config, []byte{0x09, 0x90}) {
+		t.Errorf("AAC Main audio info = %+v, want mp4a.40.01 with config 09 90", got)
+	}
+	if got, _ := relay.CatalogUpdates(); got != seq+1 {
+		t.Errorf("catalog sequence = %d, want %d", got, seq+1)
+	}
+}
@@ -58,6 +58,15 @@ const (
 	SegmentationTypeNetworkEnd                uint32 = 0x51
 )
 
+// Device restriction constants per SCTE-35 Table 21: the device groups a
+// restricted segment may not be delivered to.
+const (
+	DeviceRestrictGroup0 uint32 = 0x00
+	DeviceRestrictGroup1 uint32 = 0x01
+	DeviceRestrictGroup2 uint32 = 0x02
+	DeviceRestrictNone   uint32 = 0x03
+)
+
 // SegmentationDescriptor carries segmentation information per SCTE-35 10.3.3.
 type SegmentationDescriptor struct {
 	SegmentationEventID  uint32
@@ -65,6 +74,19 @@ type SegmentationDescriptor struct {
 	SegmentationDuration *uint64
 	SegmentNum           uint32
 	SegmentsExpected     uint32
+
+	// SegmentationEventCancelIndicator cancels a previously sent event
+	// with the same SegmentationEventID. A cancel carries no other fields.
+	SegmentationEventCancelIndicator bool
+
+	// DeliveryRestricted clears the delivery_not_restricted_flag, so that
+	// the restriction flags below apply to the segment. Without it they
+	// are ignored and encoded as reserved bits.
+	DeliveryRestricted bool
+	WebDeliveryAllowed bool
+	NoRegionalBlackout bool
+	ArchiveAllowed     bool
+	DeviceRestrictions uint32 // one of the DeviceRestrict constants
 }
 
 // Tag returns the splice_descriptor_tag.
@@ -178,17 +200,20 @@ func (sd *SegmentationDescriptor) decode(data []byte) error {
 	r.skip(8)  // descriptor_length
 	r.skip(32) // identifier (CUEI)
 	sd.SegmentationEventID = r.readUint32(32)
-	cancelIndicator := r.readBit()
+	sd.SegmentationEventCancelIndicator = r.readBit()
 	r.skip(1) // segmentation_event_id_compliance_indicator
 	r.skip(6) // reserved
 
-	if !cancelIndicator {
+	if !sd.SegmentationEventCancelIndicator {
 		programSegmentationFlag := r.readBit()
 		durationFlag := r.readBit()
-		deliveryNotRestricted := r.readBit()
+		sd.DeliveryRestricted = !r.readBit() // delivery_not_restricted_flag
 
-		if !deliveryNotRestricted {
-			r.skip(5) // restriction flags
+		if sd.DeliveryRestricted {
+			sd.WebDeliveryAllowed = r.readBit()
+			sd.NoRegionalBlackout = r.readBit()
+			sd.ArchiveAllowed = r.readBit()
+			sd.DeviceRestrictions = r.readUint32(2)
 		} else {
 			r.skip(5) // reserved
 		}
@@ -230,14 +255,24 @@ func (sd *SegmentationDescriptor) encode() ([]byte, error) {
 	w.putUint32(8, uint32(length))
 	w.putUint32(32, CUEIdentifier)
 	w.putUint32(32, sd.SegmentationEventID)
-	w.putBit(false)      // segmentation_event_cancel_indicator = 0
+	w.putBit(sd.SegmentationEventCancelIndicator)
 	w.putBit(true)       // segmentation_event_id_compliance_indicator (inverted: false → bit 1)
 	w.putUint32(6, 0x3F) // reserved
+	if sd.SegmentationEventCancelIndicator {
+		return w.bytes(), nil
+	}
 
 	w.putBit(true)                           // program_segmentation_flag = 1
 	w.putBit(sd.SegmentationDuration != nil) // segmentation_duration_flag
-	w.putBit(true)                           // delivery_not_restricted_flag = 1
-	w.putUint32(5, 0x1F)                     // reserved
+	w.putBit(!sd.DeliveryRestricted)         // delivery_not_restricted_flag
+	if sd.DeliveryRestricted {
+		w.putBit(sd.WebDeliveryAllowed)
+		w.putBit(sd.NoRegionalBlackout)
+		w.putBit(sd.ArchiveAllowed)
+		w.putUint32(2, sd.DeviceRestrictions)
+	} else {
+		w.putUint32(5, 0x1F) // reserved
+	}
 
 	if sd.SegmentationDuration != nil {
 		w.putUint64(40, *sd.SegmentationDuration)
@@ -259,11 +294,15 @@ func (sd *SegmentationDescriptor) descriptorLength() int {
 	bits += 1  // compliance_indicator
 	bits += 6  // reserved
 
-	// cancel=false, so remaining fields are present:
+	if sd.SegmentationEventCancelIndicator {
+		return bits / 8
+	}
+
+	// Remaining fields are only present when the event is not cancelled.
 	bits += 1 // program_segmentation_flag
 	bits += 1 // segmentation_duration_flag
 	bits += 1 // delivery_not_restricted_flag
-	bits += 5 // reserved (delivery_not_restricted=true)
+	bits += 5 // restriction flags, or reserved when not restricted
 
 	if sd.SegmentationDuration != nil {
 		bits += 40
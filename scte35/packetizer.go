@@ -0,0 +1,66 @@
+package scte35
+
+const (
+	tsPacketSize  = 188
+	tsSyncByte    = 0x47
+	tsPayloadSize = tsPacketSize - 4
+)
+
+// PacketizerState wraps encoded splice_info_sections in MPEG-TS packets on
+// one PID. It keeps the continuity counter between calls, so sections
+// packetized one at a time form a continuous PID. To stay continuous
+// across a restart or reconnect, save ContinuityCounter and restore it
+// with SetContinuityCounter. A PacketizerState is not safe for concurrent
+// use.
+type PacketizerState struct {
+	pid uint16
+	cc  uint8
+}
+
+// NewPacketizerState returns a PacketizerState for pid whose first packet
+// has continuity counter 0.
+func NewPacketizerState(pid uint16) *PacketizerState {
+	return &PacketizerState{pid: pid & 0x1FFF}
+}
+
+// ContinuityCounter returns the continuity counter the next packet will
+// carry.
+func (p *PacketizerState) ContinuityCounter() uint8 {
+	return p.cc
+}
+
+// SetContinuityCounter sets the continuity counter of the next packet.
+// Only the low four bits are used.
+func (p *PacketizerState) SetContinuityCounter(cc uint8) {
+	p.cc = cc & 0x0F
+}
+
+// Packetize returns section, as produced by SpliceInfoSection.Encode, as
+// one or more TS packets. The first packet starts the section after a
+// zero pointer_field; the last is padded with 0xFF stuffing.
+func (p *PacketizerState) Packetize(section []byte) []byte {
+	payload := make([]byte, 0, len(section)+1)
+	payload = append(payload, 0x00) // pointer_field
+	payload = append(payload, section...)
+
+	n := (len(payload) + tsPayloadSize - 1) / tsPayloadSize
+	out := make([]byte, n*tsPacketSize)
+	for i := range n {
+		pkt := out[i*tsPacketSize : (i+1)*tsPacketSize]
+		pkt[0] = tsSyncByte
+		pkt[1] = byte(p.pid >> 8)
+		if i == 0 {
+			pkt[1] |= 0x40 // payload_unit_start_indicator
+		}
+		pkt[2] = byte(p.pid)
+		pkt[3] = 0x10 | p.cc // payload only
+		p.cc = (p.cc + 1) & 0x0F
+
+		c := copy(pkt[4:], payload)
+		payload = payload[c:]
+		for j := 4 + c; j < tsPacketSize; j++ {
+			pkt[j] = 0xFF
+		}
+	}
+	return out
+}
@@ -0,0 +1,55 @@
+package scte35
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPacketizerStateContinuity(t *testing.T) {
+	t.Parallel()
+
+	const pid = 500
+	p := NewPacketizerState(pid)
+	small := bytes.Repeat([]byte{0xFC}, 30)
+	large := bytes.Repeat([]byte{0xAB}, 300) // spans two packets
+
+	var out []byte
+	out = append(out, p.Packetize(small)...)
+	out = append(out, p.Packetize(large)...)
+	p.SetContinuityCounter(15)
+	out = append(out, p.Packetize(small)...)
+	out = append(out, p.Packetize(small)...)
+
+	if len(out)%tsPacketSize != 0 {
+		t.Fatalf("output is %d bytes, not a whole number of packets", len(out))
+	}
+	wantCC := []uint8{0, 1, 2, 15, 0}
+	wantStart := []bool{true, true, false, true, true}
+	if got := len(out) / tsPacketSize; got != len(wantCC) {
+		t.Fatalf("got %d packets, want %d", got, len(wantCC))
+	}
+	for i := range wantCC {
+		pkt := out[i*tsPacketSize : (i+1)*tsPacketSize]
+		if pkt[0] != tsSyncByte {
+			t.Fatalf("packet %d: sync byte %#x", i, pkt[0])
+		}
+		if got := uint16(pkt[1]&0x1F)<<8 | uint16(pkt[2]); got != pid {
+			t.Errorf("packet %d: PID %d, want %d", i, got, pid)
+		}
+		if got := pkt[3] & 0x0F; got != wantCC[i] {
+			t.Errorf("packet %d: continuity counter %d, want %d", i, got, wantCC[i])
+		}
+		if got := pkt[1]&0x40 != 0; got != wantStart[i] {
+			t.Errorf("packet %d: unit start %v, want %v", i, got, wantStart[i])
+		}
+	}
+	if p.ContinuityCounter() != 1 {
+		t.Errorf("ContinuityCounter = %d, want 1", p.ContinuityCounter())
+	}
+
+	// The large section reassembles from packets 1 and 2.
+	section := append(append([]byte{}, out[tsPacketSize+5:2*tsPacketSize]...), out[2*tsPacketSize+4:]...)
+	if !bytes.Equal(section[:len(large)], large) || section[len(large)] != 0xFF {
+		t.Error("large section did not survive packetization")
+	}
+}
@@ -23,6 +23,9 @@ var goldenVectors = map[string]string{
 	"UnscheduledEventEnd":   "fc302700000000000000fff00506fe000dbba00011020f435545490000000e7fbf00004100003b85a241",
 	"ProviderPOStart":       "fc302c00000000000000fff00506fe000dbba000160214435545490000000f7fff00005265c0000034010288c9acbd",
 	"ProviderPOEnd":         "fc302700000000000000fff00506fe000dbba00011020f43554549000000107fbf000035010213993e41",
+	"SegmentationCancel":    "fc302100000000000000fff00506fe000dbba0000b02094355454900000011ffea8e5955",
+	"SpliceInsertCancel":    "fc301600000000000000fff0050500000012ff0000228b1c5b",
+	"RestrictedAdStart":     "fc302700000000000000fff00506fe000dbba00011020f43554549000000137f8d00003201011f60634d",
 }
 
 type testScenario struct {
@@ -247,6 +250,44 @@ var testScenarios = []testScenario{
 			}
 		},
 	},
+	{
+		name: "SegmentationCancel",
+		build: func(eventID uint32) SpliceInfoSection {
+			pts := uint64(900000)
+			return SpliceInfoSection{
+				SAPType: 3, Tier: 0xFFF,
+				SpliceCommand: &TimeSignal{SpliceTime: SpliceTime{PTSTime: &pts}},
+				SpliceDescriptors: SpliceDescriptors{
+					&SegmentationDescriptor{SegmentationEventID: eventID, SegmentationEventCancelIndicator: true},
+				},
+			}
+		},
+	},
+	{
+		name: "SpliceInsertCancel",
+		build: func(eventID uint32) SpliceInfoSection {
+			return SpliceInfoSection{
+				SAPType: 3, Tier: 0xFFF,
+				SpliceCommand: &SpliceInsert{SpliceEventID: eventID, SpliceEventCancelIndicator: true},
+			}
+		},
+	},
+	{
+		name: "RestrictedAdStart",
+		build: func(eventID uint32) SpliceInfoSection {
+			pts := uint64(900000)
+			return SpliceInfoSection{
+				SAPType: 3, Tier: 0xFFF,
+				SpliceCommand: &TimeSignal{SpliceTime: SpliceTime{PTSTime: &pts}},
+				SpliceDescriptors: SpliceDescriptors{
+					&SegmentationDescriptor{
+						SegmentationEventID: eventID, SegmentationTypeID: SegmentationTypeDistributorAdStart, SegmentNum: 1, SegmentsExpected: 1,
+						DeliveryRestricted: true, NoRegionalBlackout: true, ArchiveAllowed: true, DeviceRestrictions: DeviceRestrictGroup1,
+					},
+				},
+			}
+		},
+	},
 }
 
 func TestGoldenVectors(t *testing.T) {
@@ -315,6 +356,9 @@ func TestRoundTrip(t *testing.T) {
 			if decCmd.SpliceEventID != origCmd.SpliceEventID {
 				t.Errorf("%s: SpliceEventID = %d, want %d", tc.name, decCmd.SpliceEventID, origCmd.SpliceEventID)
 			}
+			if decCmd.SpliceEventCancelIndicator != origCmd.SpliceEventCancelIndicator {
+				t.Errorf("%s: SpliceEventCancelIndicator = %v, want %v", tc.name, decCmd.SpliceEventCancelIndicator, origCmd.SpliceEventCancelIndicator)
+			}
 			if decCmd.OutOfNetworkIndicator != origCmd.OutOfNetworkIndicator {
 				t.Errorf("%s: OutOfNetworkIndicator = %v, want %v", tc.name, decCmd.OutOfNetworkIndicator, origCmd.OutOfNetworkIndicator)
 			}
@@ -347,6 +391,9 @@ func TestRoundTrip(t *testing.T) {
 			if decSD.SegmentationEventID != origSD.SegmentationEventID {
 				t.Errorf("%s: desc EventID = %d, want %d", tc.name, decSD.SegmentationEventID, origSD.SegmentationEventID)
 			}
+			if decSD.SegmentationEventCancelIndicator != origSD.SegmentationEventCancelIndicator {
+				t.Errorf("%s: desc Cancel = %v, want %v", tc.name, decSD.SegmentationEventCancelIndicator, origSD.SegmentationEventCancelIndicator)
+			}
 			if decSD.SegmentationTypeID != origSD.SegmentationTypeID {
 				t.Errorf("%s: desc TypeID = 0x%02X, want 0x%02X", tc.name, decSD.SegmentationTypeID, origSD.SegmentationTypeID)
 			}
@@ -363,6 +410,15 @@ func TestRoundTrip(t *testing.T) {
 			if decSD.SegmentsExpected != origSD.SegmentsExpected {
 				t.Errorf("%s: desc SegmentsExpected = %d, want %d", tc.name, decSD.SegmentsExpected, origSD.SegmentsExpected)
 			}
+			if decSD.DeliveryRestricted != origSD.DeliveryRestricted ||
+				decSD.WebDeliveryAllowed != origSD.WebDeliveryAllowed ||
+				decSD.NoRegionalBlackout != origSD.NoRegionalBlackout ||
+				decSD.ArchiveAllowed != origSD.ArchiveAllowed ||
+				decSD.DeviceRestrictions != origSD.DeviceRestrictions {
+				t.Errorf("%s: desc restrictions = %v web %v blackout %v archive %v devices %d, want %v web %v blackout %v archive %v devices %d",
+					tc.name, decSD.DeliveryRestricted, decSD.WebDeliveryAllowed, decSD.NoRegionalBlackout, decSD.ArchiveAllowed, decSD.DeviceRestrictions,
+					origSD.DeliveryRestricted, origSD.WebDeliveryAllowed, origSD.NoRegionalBlackout, origSD.ArchiveAllowed, origSD.DeviceRestrictions)
+			}
 		}
 	}
 }
@@ -472,3 +528,71 @@ func TestSpliceNullEncodeDecode(t *testing.T) {
 		t.Errorf("expected SpliceNull, got %T", decoded.SpliceCommand)
 	}
 }
+
+func TestSpliceInsertSpliceTime(t *testing.T) {
+	t.Parallel()
+
+	t.Run("program", func(t *testing.T) {
+		t.Parallel()
+		pts := uint64(1<<33 - 1)
+		sis := SpliceInfoSection{
+			SAPType: 3, Tier: 0xFFF,
+			SpliceCommand: &SpliceInsert{
+				SpliceEventID: 9, OutOfNetworkIndicator: true,
+				SpliceTime:    SpliceTime{PTSTime: &pts},
+				BreakDuration: &BreakDuration{AutoReturn: true, Duration: 30 * 90000},
+				AvailNum:      1, AvailsExpected: 2,
+			},
+		}
+		encoded, err := sis.Encode()
+		if err != nil {
+			t.Fatalf("Encode failed: %v", err)
+		}
+		decoded, err := DecodeBytes(encoded)
+		if err != nil {
+			t.Fatalf("DecodeBytes failed: %v", err)
+		}
+		cmd := decoded.SpliceCommand.(*SpliceInsert)
+		if cmd.SpliceTime.PTSTime == nil || *cmd.SpliceTime.PTSTime != pts {
+			t.Errorf("PTSTime = %v, want %d", cmd.SpliceTime.PTSTime, pts)
+		}
+		if cmd.BreakDuration == nil || cmd.BreakDuration.Duration != 30*90000 || cmd.AvailsExpected != 2 {
+			t.Errorf("fields after the splice time decoded as %+v", cmd)
+		}
+	})
+
+	t.Run("component", func(t *testing.T) {
+		t.Parallel()
+		w := newBitWriter(19)
+		w.putUint32(32, 9)   // splice_event_id
+		w.putBit(false)      // splice_event_cancel_indicator
+		w.putUint32(7, 0x7F) // reserved
+		w.putBit(true)       // out_of_network_indicator
+		w.putBit(false)      // program_splice_flag
+		w.putBit(false)      // duration_flag
+		w.putBit(false)      // splice_immediate_flag
+		w.putUint32(4, 0x0F) // reserved
+		w.putUint32(8, 2)    // component_count
+		w.putUint32(8, 1)    // component_tag
+		w.putBit(false)      // time_specified_flag
+		w.putUint32(7, 0x7F) // reserved
+		w.putUint32(8, 2)    // component_tag
+		w.putBit(true)       // time_specified_flag
+		w.putUint32(6, 0x3F) // reserved
+		w.putUint64(33, 900000)
+		w.putUint32(16, 1) // unique_program_id
+		w.putUint32(8, 1)  // avail_num
+		w.putUint32(8, 1)  // avails_expected
+
+		var cmd SpliceInsert
+		if err := cmd.decode(w.bytes()); err != nil {
+			t.Fatalf("decode failed: %v", err)
+		}
+		if cmd.SpliceTime.PTSTime == nil || *cmd.SpliceTime.PTSTime != 900000 {
+			t.Errorf("PTSTime = %v, want 900000 from the second component", cmd.SpliceTime.PTSTime)
+		}
+		if cmd.UniqueProgramID != 1 {
+			t.Errorf("UniqueProgramID = %d, want 1", cmd.UniqueProgramID)
+		}
+	})
+}
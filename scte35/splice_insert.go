@@ -10,6 +10,11 @@ type SpliceInsert struct {
 	UniqueProgramID            uint32
 	AvailNum                   uint32
 	AvailsExpected             uint32
+
+	// SpliceTime is when the splice occurs, unless SpliceImmediateFlag is
+	// set. A component splice decodes to the time of its first component
+	// that gives one. It is encoded as a program splice.
+	SpliceTime SpliceTime
 }
 
 func (cmd *SpliceInsert) Type() uint32 { return SpliceInsertType }
@@ -31,8 +36,9 @@ func (cmd *SpliceInsert) decode(data []byte) error {
 			if !cmd.SpliceImmediateFlag {
 				timeSpecifiedFlag := r.readBit()
 				if timeSpecifiedFlag {
-					r.skip(6)  // reserved
-					r.skip(33) // pts_time (not stored)
+					r.skip(6) // reserved
+					pts := r.readUint64(33)
+					cmd.SpliceTime.PTSTime = &pts
 				} else {
 					r.skip(7) // reserved
 				}
@@ -44,8 +50,11 @@ func (cmd *SpliceInsert) decode(data []byte) error {
 				if !cmd.SpliceImmediateFlag {
 					tsf := r.readBit()
 					if tsf {
-						r.skip(6)  // reserved
-						r.skip(33) // pts_time
+						r.skip(6) // reserved
+						pts := r.readUint64(33)
+						if cmd.SpliceTime.PTSTime == nil {
+							cmd.SpliceTime.PTSTime = &pts
+						}
 					} else {
 						r.skip(7) // reserved
 					}
@@ -75,13 +84,20 @@ func (cmd *SpliceInsert) encode() ([]byte, error) {
 	w.putUint32(7, 0x7F) // reserved
 
 	if !cmd.SpliceEventCancelIndicator {
+		timed := cmd.hasSpliceTime()
 		w.putBit(cmd.OutOfNetworkIndicator)
-		w.putBit(false) // program_splice_flag = 0 (component mode with 0 components)
+		w.putBit(timed) // program_splice_flag; component mode with 0 components otherwise
 		w.putBit(cmd.BreakDuration != nil)
 		w.putBit(cmd.SpliceImmediateFlag)
 		w.putUint32(4, 0x0F) // reserved
 
-		w.putUint32(8, 0) // component_count = 0
+		if timed {
+			w.putBit(true)       // time_specified_flag
+			w.putUint32(6, 0x3F) // reserved
+			w.putUint64(33, *cmd.SpliceTime.PTSTime)
+		} else {
+			w.putUint32(8, 0) // component_count = 0
+		}
 
 		if cmd.BreakDuration != nil {
 			w.putBit(cmd.BreakDuration.AutoReturn)
@@ -101,7 +117,11 @@ func (cmd *SpliceInsert) commandLength() int {
 
 	if !cmd.SpliceEventCancelIndicator {
 		bits += 1 + 1 + 1 + 1 + 4 // out_of_network + program_splice + duration_flag + immediate + reserved
-		bits += 8                 // component_count (program_splice_flag=0)
+		if cmd.hasSpliceTime() {
+			bits += 1 + 6 + 33 // splice_time (program_splice_flag=1)
+		} else {
+			bits += 8 // component_count (program_splice_flag=0)
+		}
 
 		if cmd.BreakDuration != nil {
 			bits += 1 + 6 + 33 // auto_return + reserved + duration
@@ -110,3 +130,9 @@ func (cmd *SpliceInsert) commandLength() int {
 	}
 	return bits / 8
 }
+
+// hasSpliceTime reports whether the command carries a splice time to
+// encode.
+func (cmd *SpliceInsert) hasSpliceTime() bool {
+	return !cmd.SpliceImmediateFlag && cmd.SpliceTime.PTSTime != nil
+}
@@ -3,16 +3,144 @@
 package stream
 
 import (
+	"context"
+	"fmt"
+	"io"
 	"log/slog"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// defaultSweepInterval is how often the idle sweeper scans for streams
+// when no explicit interval is configured.
+const defaultSweepInterval = 10 * time.Second
+
 // Stream represents a live stream.
 type Stream struct {
 	Key       string
 	StartedAt time.Time
 	done      chan struct{}
+
+	lastActivity atomic.Int64 // unix nanoseconds
+}
+
+// Done returns a channel that is closed when the stream is removed from
+// its manager, whether by Remove, idle eviction or a replacing publisher.
+func (s *Stream) Done() <-chan struct{} {
+	return s.done
+}
+
+// Touch records ingest activity on the stream, deferring idle eviction.
+func (s *Stream) Touch() {
+	s.lastActivity.Store(time.Now().UnixNano())
+}
+
+// LastActivity returns the time of the most recent ingest activity, or
+// StartedAt if none has been recorded.
+func (s *Stream) LastActivity() time.Time {
+	return time.Unix(0, s.lastActivity.Load())
+}
+
+// TrackReads wraps r so that every successful read touches the stream.
+func (s *Stream) TrackReads(r io.Reader) io.Reader {
+	return &activityReader{r: r, s: s}
+}
+
+type activityReader struct {
+	r io.Reader
+	s *Stream
+}
+
+func (a *activityReader) Read(p []byte) (int, error) {
+	n, err := a.r.Read(p)
+	if n > 0 {
+		a.s.Touch()
+	}
+	return n, err
+}
+
+// DuplicatePolicy decides what Create does when a stream with the
+// requested key already exists.
+type DuplicatePolicy int
+
+// Duplicate key policies.
+const (
+	// DuplicateReject refuses the new stream, keeping the existing one.
+	DuplicateReject DuplicatePolicy = iota
+
+	// DuplicateReplace removes the existing stream and creates the new
+	// one in its place, for publisher failover.
+	DuplicateReplace
+
+	// DuplicateAlias creates the new stream under the key with the first
+	// free numeric suffix: "key-2", then "key-3" and so on.
+	DuplicateAlias
+)
+
+// ParseDuplicatePolicy parses a policy name: "reject", "replace" or
+// "alias".
+func ParseDuplicatePolicy(s string) (DuplicatePolicy, error) {
+	switch s {
+	case "reject":
+		return DuplicateReject, nil
+	case "replace":
+		return DuplicateReplace, nil
+	case "alias":
+		return DuplicateAlias, nil
+	}
+	return 0, fmt.Errorf("unknown duplicate stream policy %q", s)
+}
+
+func (p DuplicatePolicy) String() string {
+	switch p {
+	case DuplicateReject:
+		return "reject"
+	case DuplicateReplace:
+		return "replace"
+	case DuplicateAlias:
+		return "alias"
+	}
+	return fmt.Sprintf("DuplicatePolicy(%d)", int(p))
+}
+
+// Option configures a Manager.
+type Option func(*Manager)
+
+// WithIdleTTL enables idle eviction: streams with no ingest activity for
+// ttl are removed by the sweeper started with Run. Zero disables eviction.
+func WithIdleTTL(ttl time.Duration) Option {
+	return func(m *Manager) { m.idleTTL = ttl }
+}
+
+// WithSweepInterval sets how often Run scans for idle streams.
+func WithSweepInterval(d time.Duration) Option {
+	return func(m *Manager) {
+		if d > 0 {
+			m.sweepInterval = d
+		}
+	}
+}
+
+// WithOnEvict registers a callback invoked, outside the manager's lock,
+// with the key of each stream removed for being idle. It lets callers
+// release resources held for the stream elsewhere.
+func WithOnEvict(fn func(key string)) Option {
+	return func(m *Manager) { m.onEvict = fn }
+}
+
+// WithDuplicatePolicy sets how Create handles a key that is already in
+// use. The default is DuplicateReject.
+func WithDuplicatePolicy(p DuplicatePolicy) Option {
+	return func(m *Manager) { m.duplicates = p }
+}
+
+// WithOnReplace registers a callback invoked, outside the manager's lock,
+// with each stream removed under DuplicateReplace, before Create returns
+// its replacement. It lets callers release the old stream's resources
+// before the new one claims them.
+func WithOnReplace(fn func(old *Stream)) Option {
+	return func(m *Manager) { m.onReplace = fn }
 }
 
 // Manager manages the lifecycle of active streams.
@@ -20,37 +148,75 @@ type Manager struct {
 	log     *slog.Logger
 	mu      sync.RWMutex
 	streams map[string]*Stream
+
+	idleTTL       time.Duration
+	sweepInterval time.Duration
+	onEvict       func(key string)
+
+	duplicates DuplicatePolicy
+	onReplace  func(old *Stream)
 }
 
 // NewManager creates a new stream manager. If log is nil, slog.Default() is used.
-func NewManager(log *slog.Logger) *Manager {
+func NewManager(log *slog.Logger, opts ...Option) *Manager {
 	if log == nil {
 		log = slog.Default()
 	}
-	return &Manager{
-		log:     log.With("component", "stream-manager"),
-		streams: make(map[string]*Stream),
+	m := &Manager{
+		log:           log.With("component", "stream-manager"),
+		streams:       make(map[string]*Stream),
+		sweepInterval: defaultSweepInterval,
+	}
+	for _, opt := range opts {
+		opt(m)
 	}
+	return m
 }
 
 // Create registers a new stream. Returns the stream and true if created,
-// or nil and false if a stream with this key already exists.
+// or nil and false if a stream with this key already exists and the
+// duplicate policy rejects it. Under DuplicateAlias the stream's Key may
+// differ from key.
 func (m *Manager) Create(key string) (*Stream, bool) {
 	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	if _, ok := m.streams[key]; ok {
-		m.log.Warn("stream already exists, rejecting duplicate", "key", key)
-		return nil, false
+	var replaced *Stream
+	if old, ok := m.streams[key]; ok {
+		switch m.duplicates {
+		case DuplicateReplace:
+			delete(m.streams, key)
+			replaced = old
+		case DuplicateAlias:
+			alias := key
+			for n := 2; m.streams[alias] != nil; n++ {
+				alias = fmt.Sprintf("%s-%d", key, n)
+			}
+			m.log.Info("stream key in use, aliasing duplicate", "key", key, "alias", alias)
+			key = alias
+		default:
+			m.mu.Unlock()
+			m.log.Warn("stream already exists, rejecting duplicate", "key", key)
+			return nil, false
+		}
 	}
 
+	now := time.Now()
 	s := &Stream{
 		Key:       key,
-		StartedAt: time.Now(),
+		StartedAt: now,
 		done:      make(chan struct{}),
 	}
+	s.lastActivity.Store(now.UnixNano())
 
 	m.streams[key] = s
+	m.mu.Unlock()
+
+	if replaced != nil {
+		close(replaced.done)
+		m.log.Info("stream replaced by new publisher", "key", key)
+		if m.onReplace != nil {
+			m.onReplace(replaced)
+		}
+	}
 	m.log.Info("stream created", "key", key)
 	return s, true
 }
@@ -70,6 +236,24 @@ func (m *Manager) Remove(key string) {
 	}
 }
 
+// RemoveStream removes s if it is still the stream registered under its
+// key, reporting whether it was. A publisher tearing down after being
+// replaced thus leaves its replacement in place.
+func (m *Manager) RemoveStream(s *Stream) bool {
+	m.mu.Lock()
+	ok := m.streams[s.Key] == s
+	if ok {
+		delete(m.streams, s.Key)
+	}
+	m.mu.Unlock()
+
+	if ok {
+		close(s.done)
+		m.log.Info("stream removed", "key", s.Key)
+	}
+	return ok
+}
+
 // List returns all active streams.
 func (m *Manager) List() []*Stream {
 	m.mu.RLock()
@@ -81,3 +265,50 @@ func (m *Manager) List() []*Stream {
 	}
 	return streams
 }
+
+// Run sweeps for idle streams until ctx is cancelled. It returns
+// immediately if no idle TTL is configured.
+func (m *Manager) Run(ctx context.Context) {
+	if m.idleTTL <= 0 {
+		return
+	}
+	ticker := time.NewTicker(m.sweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			m.sweep(now)
+		}
+	}
+}
+
+// sweep removes every stream whose last activity is older than the idle
+// TTL relative to now.
+func (m *Manager) sweep(now time.Time) {
+	if m.idleTTL <= 0 {
+		return
+	}
+	var evicted []*Stream
+	m.mu.Lock()
+	for key, s := range m.streams {
+		if now.Sub(s.LastActivity()) > m.idleTTL {
+			delete(m.streams, key)
+			evicted = append(evicted, s)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, s := range evicted {
+		close(s.done)
+		m.log.Warn("evicting idle stream",
+			"key", s.Key,
+			"idle", now.Sub(s.LastActivity()).Round(time.Second),
+			"ttl", m.idleTTL,
+		)
+		if m.onEvict != nil {
+			m.onEvict(s.Key)
+		}
+	}
+}
@@ -1,7 +1,12 @@
 package stream
 
 import (
+	"bytes"
+	"context"
+	"io"
+	"slices"
 	"testing"
+	"time"
 )
 
 func TestManagerCreateAndGet(t *testing.T) {
@@ -46,6 +51,70 @@ func TestManagerCreateDuplicate(t *testing.T) {
 	}
 }
 
+func TestManagerCreateDuplicateReplace(t *testing.T) {
+	t.Parallel()
+	var replaced []*Stream
+	m := NewManager(nil,
+		WithDuplicatePolicy(DuplicateReplace),
+		WithOnReplace(func(old *Stream) { replaced = append(replaced, old) }),
+	)
+
+	old, _ := m.Create("test")
+	s, ok := m.Create("test")
+	if !ok || s == nil || s == old || s.Key != "test" {
+		t.Fatalf("replacing Create = %v, %v; want a new stream under the same key", s, ok)
+	}
+	select {
+	case <-old.Done():
+	default:
+		t.Error("replaced stream's Done not closed")
+	}
+	if len(replaced) != 1 || replaced[0] != old {
+		t.Errorf("OnReplace called with %v, want the old stream", replaced)
+	}
+	if streams := m.List(); len(streams) != 1 || streams[0] != s {
+		t.Errorf("List = %v, want only the replacement", streams)
+	}
+
+	// The replaced publisher tearing down must not remove its successor.
+	if m.RemoveStream(old) {
+		t.Error("RemoveStream of the replaced stream = true")
+	}
+	if !m.RemoveStream(s) || len(m.List()) != 0 {
+		t.Error("RemoveStream of the current stream did not remove it")
+	}
+}
+
+func TestManagerCreateDuplicateAlias(t *testing.T) {
+	t.Parallel()
+	m := NewManager(nil, WithDuplicatePolicy(DuplicateAlias))
+
+	var keys []string
+	for range 3 {
+		s, ok := m.Create("test")
+		if !ok {
+			t.Fatal("aliasing Create returned not-ok")
+		}
+		keys = append(keys, s.Key)
+	}
+	if want := []string{"test", "test-2", "test-3"}; !slices.Equal(keys, want) {
+		t.Errorf("keys = %v, want %v", keys, want)
+	}
+}
+
+func TestParseDuplicatePolicy(t *testing.T) {
+	t.Parallel()
+	for _, p := range []DuplicatePolicy{DuplicateReject, DuplicateReplace, DuplicateAlias} {
+		got, err := ParseDuplicatePolicy(p.String())
+		if err != nil || got != p {
+			t.Errorf("ParseDuplicatePolicy(%q) = %v, %v; want %v", p.String(), got, err, p)
+		}
+	}
+	if _, err := ParseDuplicatePolicy("failover"); err == nil {
+		t.Error("ParseDuplicatePolicy accepted an unknown name")
+	}
+}
+
 func TestManagerRemove(t *testing.T) {
 	t.Parallel()
 	m := NewManager(nil)
@@ -92,3 +161,82 @@ func TestManagerRemoveNonexistent(t *testing.T) {
 	// Should not panic
 	m.Remove("nonexistent")
 }
+
+func TestManagerSweepEvictsIdle(t *testing.T) {
+	t.Parallel()
+	var evicted []string
+	m := NewManager(nil, WithIdleTTL(time.Minute), WithOnEvict(func(key string) {
+		evicted = append(evicted, key)
+	}))
+
+	idle, _ := m.Create("idle")
+	active, _ := m.Create("active")
+
+	now := time.Now().Add(2 * time.Minute)
+	active.lastActivity.Store(now.Add(-time.Second).UnixNano())
+	m.sweep(now)
+
+	streams := m.List()
+	if len(streams) != 1 || streams[0].Key != "active" {
+		t.Fatalf("expected only active stream to remain, got %d streams", len(streams))
+	}
+	if len(evicted) != 1 || evicted[0] != "idle" {
+		t.Errorf("evicted: got %v, want [idle]", evicted)
+	}
+	select {
+	case <-idle.done:
+	default:
+		t.Error("evicted stream's done channel should be closed")
+	}
+
+	// A later explicit Remove of the evicted key must be a no-op.
+	m.Remove("idle")
+}
+
+func TestManagerSweepDisabledWithoutTTL(t *testing.T) {
+	t.Parallel()
+	m := NewManager(nil)
+	m.Create("test")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	m.Run(ctx)
+	m.sweep(time.Now().Add(24 * time.Hour))
+
+	if len(m.List()) != 1 {
+		t.Error("stream should not be evicted when no idle TTL is configured")
+	}
+}
+
+func TestManagerRunEvicts(t *testing.T) {
+	t.Parallel()
+	m := NewManager(nil, WithIdleTTL(time.Millisecond), WithSweepInterval(5*time.Millisecond))
+	m.Create("test")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go m.Run(ctx)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(m.List()) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("idle stream was not evicted by Run")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestStreamTrackReads(t *testing.T) {
+	t.Parallel()
+	m := NewManager(nil)
+	s, _ := m.Create("test")
+	s.lastActivity.Store(0)
+
+	r := s.TrackReads(bytes.NewReader([]byte("payload")))
+	if _, err := io.ReadAll(r); err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if time.Since(s.LastActivity()) > time.Minute {
+		t.Errorf("LastActivity not updated by reads: %v", s.LastActivity())
+	}
+}
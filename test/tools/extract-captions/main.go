@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/zsiec/prism/demux"
+	"github.com/zsiec/prism/distribution"
+)
+
+func main() {
+	channelFlag := flag.String("channel", "cc1", "Caption channel: cc1-cc4 (CEA-608) or service1-service6 (CEA-708)")
+	maxFlag := flag.Duration("max-duration", 10*time.Second, "Longest a cue lasts when no later caption ends it")
+	absoluteFlag := flag.Bool("absolute", false, "Time cues by source PTS instead of from the first video frame")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: extract-captions [flags] <input.ts> [output.srt]\n")
+		fmt.Fprintf(os.Stderr, "Demuxes a TS, decodes one CEA-608/708 caption channel and writes it as SRT\n")
+		fmt.Fprintf(os.Stderr, "(to stdout if no output is given), for diffing against the SRT given to\n")
+		fmt.Fprintf(os.Stderr, "inject-captions.\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() < 1 || flag.NArg() > 2 {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	channel, err := distribution.ParseCaptionChannel(*channelFlag, nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+
+	in, err := os.Open(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "open input: %v\n", err)
+		os.Exit(1)
+	}
+	defer in.Close()
+
+	cues, firstVideoPTS, err := extract(in, channel, max(*maxFlag, time.Millisecond).Microseconds())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "demux: %v\n", err)
+		os.Exit(1)
+	}
+	origin := firstVideoPTS
+	if *absoluteFlag {
+		origin = 0
+	}
+	fmt.Fprintf(os.Stderr, "Channel %s: %d cues\n", *channelFlag, len(cues))
+
+	out := io.Writer(os.Stdout)
+	if flag.NArg() == 2 {
+		f, err := os.Create(flag.Arg(1))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "create output: %v\n", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		out = f
+	}
+	if err := writeSRT(out, cues, origin); err != nil {
+		fmt.Fprintf(os.Stderr, "write SRT: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// extract demuxes r and returns the cues of caption channel channel, with
+// the PTS of the first video frame, in decode order, to time them from.
+// Every output of the demuxer is drained so it never blocks.
+func extract(r io.Reader, channel int, maxDurUS int64) ([]distribution.CaptionCue, int64, error) {
+	d := demux.NewDemuxer(r, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	type videoTimes struct{ first, last int64 }
+	videoDone := make(chan videoTimes)
+	go func() {
+		var vt videoTimes
+		seen := false
+		for f := range d.Video() {
+			if !seen {
+				vt.first, seen = f.PTS, true
+			}
+			vt.last = max(vt.last, f.PTS)
+		}
+		videoDone <- vt
+	}()
+	go func() {
+		for range d.Audio() {
+		}
+	}()
+	go func() {
+		for range d.SCTE35() {
+		}
+	}()
+	go func() {
+		for range d.Events() {
+		}
+	}()
+
+	b := distribution.CaptionCueBuilder{MaxDurationUS: maxDurUS}
+	var cues []distribution.CaptionCue
+	captionsDone := make(chan struct{})
+	go func() {
+		defer close(captionsDone)
+		for f := range d.Captions() {
+			if f.Channel == channel {
+				if c, ok := b.Add(f.PTS, f.Text); ok {
+					cues = append(cues, c)
+				}
+			}
+		}
+	}()
+
+	err := d.Run(context.Background())
+	<-captionsDone
+	vt := <-videoDone
+	if err != nil {
+		return nil, 0, err
+	}
+	if c, ok := b.Flush(vt.last); ok {
+		cues = append(cues, c)
+	}
+	return cues, vt.first, nil
+}
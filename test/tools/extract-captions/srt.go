@@ -0,0 +1,33 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/zsiec/prism/distribution"
+)
+
+// writeSRT writes cues as SubRip, timed from originUS.
+func writeSRT(w io.Writer, cues []distribution.CaptionCue, originUS int64) error {
+	bw := bufio.NewWriter(w)
+	for i, c := range cues {
+		fmt.Fprintf(bw, "%d\n%s --> %s\n", i+1, srtTime(c.StartUS-originUS), srtTime(c.EndUS-originUS))
+		for line := range strings.SplitSeq(c.Text, "\n") {
+			// A blank line would end the entry early.
+			if line = strings.TrimRight(line, " \r"); line != "" {
+				fmt.Fprintf(bw, "%s\n", line)
+			}
+		}
+		bw.WriteString("\n")
+	}
+	return bw.Flush()
+}
+
+// srtTime formats a time in microseconds as an SRT timestamp,
+// hh:mm:ss,mmm.
+func srtTime(us int64) string {
+	ms := max(us, 0) / 1000
+	return fmt.Sprintf("%02d:%02d:%02d,%03d", ms/3_600_000, ms/60_000%60, ms/1000%60, ms%1000)
+}
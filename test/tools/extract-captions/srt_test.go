@@ -0,0 +1,24 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/zsiec/prism/distribution"
+)
+
+func TestWriteSRT(t *testing.T) {
+	cues := []distribution.CaptionCue{
+		{StartUS: 1_500_000, EndUS: 3_250_000, Text: "HELLO\n\nWORLD"},
+		{StartUS: 3_723_004_000, EndUS: 3_724_000_000, Text: "LATER"},
+	}
+	var buf bytes.Buffer
+	if err := writeSRT(&buf, cues, 500_000); err != nil {
+		t.Fatal(err)
+	}
+	want := "1\n00:00:01,000 --> 00:00:02,750\nHELLO\nWORLD\n\n" +
+		"2\n01:02:02,504 --> 01:02:03,500\nLATER\n\n"
+	if got := buf.String(); got != want {
+		t.Errorf("SRT =\n%s\nwant\n%s", got, want)
+	}
+}
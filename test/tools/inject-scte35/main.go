@@ -5,6 +5,7 @@ import (
 	"os"
 
 	"github.com/zsiec/prism/scte35"
+	"github.com/zsiec/prism/test/tools/tsutil"
 )
 
 const tsPacketSize = 188
@@ -356,6 +357,26 @@ var adBreakScenarios = []scte35Scenario{
 			}
 		},
 	},
+	{
+		label:       "Segmentation Event Cancel (PO Start)",
+		commandType: "time_signal",
+		build: func(eventID uint32) scte35.SpliceInfoSection {
+			pts := uint64(900000)
+			return scte35.SpliceInfoSection{
+				SAPType: 3,
+				Tier:    0xFFF,
+				SpliceCommand: &scte35.TimeSignal{
+					SpliceTime: scte35.SpliceTime{PTSTime: &pts},
+				},
+				SpliceDescriptors: scte35.SpliceDescriptors{
+					&scte35.SegmentationDescriptor{
+						SegmentationEventID:              eventID - 1,
+						SegmentationEventCancelIndicator: true,
+					},
+				},
+			}
+		},
+	},
 	{
 		label:       "Provider Placement Opportunity End",
 		commandType: "time_signal",
@@ -419,7 +440,7 @@ func main() {
 	lastInsertPCR := int64(-intervalTicks)
 	scenarioIdx := 0
 	eventID := uint32(1)
-	cc := byte(0)
+	packetizer := scte35.NewPacketizerState(scte35PID)
 	injected := 0
 
 	var output []byte
@@ -452,9 +473,7 @@ func main() {
 				os.Exit(1)
 			}
 
-			tsPkt := wrapInTSPacket(scte35PID, cc, payload)
-			cc = (cc + 1) & 0x0F
-			output = append(output, tsPkt...)
+			output = append(output, packetizer.Packetize(payload)...)
 			injected++
 
 			fmt.Printf("  [%2d] %-45s cmd=%-12s eventID=%d  PCR=%.2fs\n",
@@ -473,29 +492,6 @@ func main() {
 	fmt.Printf("Done: %s (%d packets, %d SCTE-35 events)\n", outputPath, len(output)/tsPacketSize, injected)
 }
 
-func wrapInTSPacket(pid uint16, cc byte, payload []byte) []byte {
-	section := make([]byte, 0, len(payload)+1)
-	section = append(section, 0x00)
-	section = append(section, payload...)
-
-	pkt := make([]byte, tsPacketSize)
-	pkt[0] = 0x47
-	pkt[1] = 0x40 | byte(pid>>8)
-	pkt[2] = byte(pid & 0xFF)
-	pkt[3] = 0x10 | (cc & 0x0F)
-
-	if len(section) < tsPacketSize-4 {
-		copy(pkt[4:], section)
-		for i := 4 + len(section); i < tsPacketSize; i++ {
-			pkt[i] = 0xFF
-		}
-	} else {
-		copy(pkt[4:], section[:tsPacketSize-4])
-	}
-
-	return pkt
-}
-
 func findPMTPID(data []byte) uint16 {
 	for i := 0; i < len(data); i += tsPacketSize {
 		pkt := data[i : i+tsPacketSize]
@@ -611,7 +607,7 @@ func addSCTE35ToPMT(pkt []byte, scte35PID uint16) []byte {
 	newSection[1] = (newSection[1] & 0xF0) | byte(newSectionLen>>8)
 	newSection[2] = byte(newSectionLen & 0xFF)
 
-	crc := crc32MPEG2(newSection)
+	crc := tsutil.CRC32MPEG2(newSection)
 	newSection = append(newSection, byte(crc>>24), byte(crc>>16), byte(crc>>8), byte(crc))
 
 	result := make([]byte, tsPacketSize)
@@ -639,18 +635,3 @@ func extractPCR(pkt []byte) int64 {
 	base := int64(pkt[6])<<25 | int64(pkt[7])<<17 | int64(pkt[8])<<9 | int64(pkt[9])<<1 | int64(pkt[10]>>7)
 	return base
 }
-
-func crc32MPEG2(data []byte) uint32 {
-	crc := uint32(0xFFFFFFFF)
-	for _, b := range data {
-		crc ^= uint32(b) << 24
-		for i := 0; i < 8; i++ {
-			if crc&0x80000000 != 0 {
-				crc = (crc << 1) ^ 0x04C11DB7
-			} else {
-				crc <<= 1
-			}
-		}
-	}
-	return crc
-}
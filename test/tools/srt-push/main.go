@@ -188,6 +188,9 @@ func streamLoop(conn *srt.Conn, data []byte, bytesPerSec float64, chunkSize int,
 			if loopPTSDelta > 0 && len(tsEntries) > 0 {
 				addTimestampOffset(data, tsEntries, loopPTSDelta)
 			}
+			// Likewise continue every PID's continuity counter, so players
+			// do not see a discontinuity at the seam.
+			advanceContinuity(data)
 		}
 
 		for i := 0; i < len(data); i += chunkSize {
@@ -103,6 +103,33 @@ func addTimestampOffset(data []byte, entries []ptsEntry, delta int64) {
 	}
 }
 
+// advanceContinuity shifts the continuity counter of every payload-bearing
+// packet by the number of such packets its PID has in data, so a replay of
+// data continues each PID's counter where the previous pass left off
+// instead of restarting it. Call this once per loop iteration, like
+// addTimestampOffset.
+func advanceContinuity(data []byte) {
+	var counts [0x2000]int
+	forEachPayloadPacket(data, func(pid uint16, _ []byte) { counts[pid]++ })
+	forEachPayloadPacket(data, func(pid uint16, pkt []byte) {
+		cc := (int(pkt[3]&0x0F) + counts[pid]) & 0x0F
+		pkt[3] = pkt[3]&0xF0 | byte(cc)
+	})
+}
+
+// forEachPayloadPacket calls fn for each packet in data that carries a
+// payload, skipping null packets.
+func forEachPayloadPacket(data []byte, fn func(pid uint16, pkt []byte)) {
+	for off := 0; off+tsutil.TSPacketSize <= len(data); off += tsutil.TSPacketSize {
+		pkt := data[off : off+tsutil.TSPacketSize]
+		pid := uint16(pkt[1]&0x1F)<<8 | uint16(pkt[2])
+		if pkt[0] != 0x47 || pkt[3]&0x10 == 0 || pid == 0x1FFF {
+			continue
+		}
+		fn(pid, pkt)
+	}
+}
+
 // decodePTS extracts a 33-bit PTS/DTS from the 5-byte PES timestamp encoding.
 func decodePTS(b []byte) int64 {
 	return int64(b[0]>>1&0x07)<<30 |
@@ -111,3 +111,33 @@ func TestAddTimestampOffset(t *testing.T) {
 		t.Errorf("after restore: firstPTS = %d, want %d", restored, firstPTS)
 	}
 }
+
+func TestAdvanceContinuity(t *testing.T) {
+	t.Parallel()
+
+	type pkt struct {
+		pid  uint16
+		ctl  byte // adaptation_field_control and continuity_counter
+		want byte
+	}
+	pkts := []pkt{
+		{0x100, 0x10, 0x13},
+		{0x101, 0x1F, 0x10}, // wraps
+		{0x100, 0x11, 0x14},
+		{0x100, 0x20, 0x20}, // adaptation field only: no payload, unchanged
+		{0x1FFF, 0x10, 0x10},
+		{0x100, 0x12, 0x15},
+	}
+	data := make([]byte, len(pkts)*tsutil.TSPacketSize)
+	for i, p := range pkts {
+		b := data[i*tsutil.TSPacketSize:]
+		b[0], b[1], b[2], b[3] = 0x47, byte(p.pid>>8), byte(p.pid), p.ctl
+	}
+
+	advanceContinuity(data)
+	for i, p := range pkts {
+		if got := data[i*tsutil.TSPacketSize+3]; got != p.want {
+			t.Errorf("packet %d (PID %#x): byte 3 = %#x, want %#x", i, p.pid, got, p.want)
+		}
+	}
+}
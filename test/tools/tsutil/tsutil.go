@@ -206,6 +206,30 @@ func Packetize(pesData []byte, pid uint16, cc *byte) []byte {
 	return result
 }
 
+// CRC32MPEG2 computes the MPEG-2 CRC32 that ends a PSI section.
+func CRC32MPEG2(data []byte) uint32 {
+	crc := uint32(0xFFFFFFFF)
+	for _, b := range data {
+		crc ^= uint32(b) << 24
+		for i := 0; i < 8; i++ {
+			if crc&0x80000000 != 0 {
+				crc = (crc << 1) ^ 0x04C11DB7
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// PSIPacket appends the CRC to a PSI section, which starts at its
+// table_id, and packetizes it after a pointer field on the given PID.
+func PSIPacket(section []byte, pid uint16, cc *byte) []byte {
+	crc := CRC32MPEG2(section)
+	section = append(section[:len(section):len(section)], byte(crc>>24), byte(crc>>16), byte(crc>>8), byte(crc))
+	return Packetize(append([]byte{0x00}, section...), pid, cc)
+}
+
 // EncodeSEIMessage encodes an H.264 SEI message with the given payload type
 // and payload bytes, using the multi-byte size encoding when needed.
 func EncodeSEIMessage(payloadType int, payload []byte) []byte {
@@ -0,0 +1,75 @@
+package testpattern
+
+// AAC parameters of the tone track.
+const (
+	aacSampleRate      = 48000
+	aacSampleRateIndex = 3 // 48 kHz
+	aacFrameSamples    = 1024
+	aacFrameTicks      = aacFrameSamples * 90000 / aacSampleRate
+
+	// toneBand is the scale factor band carrying the tone. Its first MDCT
+	// coefficient at 48 kHz is 40, at (40 + 0.5) * 48000 / 2048, about
+	// 949 Hz.
+	toneBand = 10
+
+	// toneGain is the global_gain of the tone's scale factor band,
+	// setting its level to about -24 dBFS.
+	toneGain = 184
+)
+
+// toneFrame returns an ADTS-framed mono AAC-LC frame whose spectrum is a
+// single coefficient. Repeated, it decodes to a steady tone. Without
+// an encoder, only the two Huffman codewords it needs are written.
+func toneFrame() []byte {
+	var w bitWriter
+	w.u(3, 0) // id_syn_ele: SCE
+	w.u(4, 0) // element_instance_tag
+	w.u(8, toneGain)
+
+	// ics_info
+	w.u(1, 0) // ics_reserved_bit
+	w.u(2, 0) // window_sequence: ONLY_LONG_SEQUENCE
+	w.u(1, 0) // window_shape: sine
+	w.u(6, toneBand+1)
+	w.u(1, 0) // predictor_data_present
+
+	// section_data: the bands below the tone's are all zero, and its band
+	// uses spectrum codebook 1.
+	w.u(4, 0)
+	w.u(5, toneBand)
+	w.u(4, 1)
+	w.u(5, 1)
+
+	// scale_factor_data: the tone's band has the global gain, a delta of
+	// zero.
+	w.u(1, 0)
+
+	w.u(1, 0) // pulse_data_present
+	w.u(1, 0) // tns_data_present
+	w.u(1, 0) // gain_control_data_present
+
+	// spectral_data: the band's two quads, (-1, 0, 0, 0) and zeros, in
+	// codebook 1.
+	w.u(5, 0x11)
+	w.u(1, 0)
+
+	w.u(3, 7) // id_syn_ele: END
+	w.align()
+	return adts(w.buf)
+}
+
+// adts prefixes a mono AAC-LC raw data block with an ADTS header without
+// CRC.
+func adts(raw []byte) []byte {
+	n := 7 + len(raw)
+	h := []byte{
+		0xFF,
+		0xF1,                         // MPEG-4, layer 0, no CRC
+		1<<6 | aacSampleRateIndex<<2, // AAC LC; channel_configuration high bit 0
+		1<<6 | byte(n>>11),           // channel_configuration 1
+		byte(n >> 3),
+		byte(n<<5) | 0x1F, // buffer fullness 0x7FF: variable rate
+		0xFC,
+	}
+	return append(h, raw...)
+}
@@ -0,0 +1,147 @@
+package testpattern
+
+import (
+	"math/bits"
+	"slices"
+	"strings"
+)
+
+// CEA-608 control codes on channel CC1, each sent twice as is customary
+// so a decoder survives losing one.
+var (
+	ccResumeCaptionLoading = [2]byte{0x14, 0x20}
+	ccEndOfCaption         = [2]byte{0x14, 0x2F}
+	ccEraseDisplayed       = [2]byte{0x14, 0x2C}
+)
+
+// ccPAC are the preamble address codes for rows 1 to 15 of CC1, placing the
+// cursor at column 0 in white.
+var ccPAC = [16][2]byte{
+	1: {0x11, 0x40}, 2: {0x11, 0x60}, 3: {0x12, 0x40}, 4: {0x12, 0x60},
+	5: {0x15, 0x40}, 6: {0x15, 0x60}, 7: {0x16, 0x40}, 8: {0x16, 0x60},
+	9: {0x17, 0x40}, 10: {0x17, 0x60}, 11: {0x10, 0x40}, 12: {0x13, 0x40},
+	13: {0x13, 0x60}, 14: {0x14, 0x40}, 15: {0x14, 0x60},
+}
+
+// maxCaptionRows and maxCaptionColumns bound a pop-on caption.
+const (
+	maxCaptionRows    = 4
+	maxCaptionColumns = 32
+)
+
+// popOnPairs returns the byte pairs that load text as a pop-on caption,
+// bottom-aligned, and display it with the last pair.
+func popOnPairs(text string) [][2]byte {
+	rows := strings.Split(text, "\n")
+	if len(rows) > maxCaptionRows {
+		rows = rows[len(rows)-maxCaptionRows:]
+	}
+	pairs := [][2]byte{ccResumeCaptionLoading, ccResumeCaptionLoading}
+	for i, row := range rows {
+		pac := ccPAC[15-len(rows)+1+i]
+		pairs = append(pairs, pac, pac)
+		chars := []byte(ccChars(row))
+		for len(chars) > 0 {
+			p := [2]byte{chars[0], 0x80} // a second character of null
+			if len(chars) > 1 {
+				p[1] = chars[1]
+			}
+			pairs = append(pairs, p)
+			chars = chars[min(2, len(chars)):]
+		}
+	}
+	return append(pairs, ccEndOfCaption, ccEndOfCaption)
+}
+
+// ccChars returns row in the CEA-608 basic character set, up to
+// maxCaptionColumns long. The few ASCII characters the set replaces with
+// accented letters, and anything outside it, become spaces.
+func ccChars(row string) string {
+	b := make([]byte, 0, len(row))
+	for _, r := range row {
+		if len(b) == maxCaptionColumns {
+			break
+		}
+		if r < 0x20 || r > 0x7E || strings.ContainsRune("*\\^_`{|}~", r) {
+			r = ' '
+		}
+		b = append(b, byte(r))
+	}
+	return string(b)
+}
+
+// withParity sets the odd parity bit of each byte of a pair.
+func withParity(p [2]byte) [2]byte {
+	for i, c := range p {
+		c &= 0x7F
+		if bits.OnesCount8(c)%2 == 0 {
+			c |= 0x80
+		}
+		p[i] = c
+	}
+	return p
+}
+
+// scheduleCaptions lays the captions out as one CC1 byte pair per video
+// frame, so that each caption appears at its start frame and is erased at
+// its end frame. A caption whose pairs cannot all be sent before its start
+// appears late, as does one crowded by the caption before it; an erase
+// that would fall after the next caption has started loading is left out,
+// as that caption replaces it anyway.
+func scheduleCaptions(captions []Caption, fps int) map[int][2]byte {
+	sorted := slices.Clone(captions)
+	slices.SortFunc(sorted, func(a, b Caption) int { return int(a.Start - b.Start) })
+
+	type burst struct {
+		frame int
+		pairs [][2]byte
+	}
+	var bursts []burst
+	for i, c := range sorted {
+		pairs := popOnPairs(c.Text)
+		load := burst{frame: frameAt(c.Start, fps) - len(pairs) + 2, pairs: pairs}
+		bursts = append(bursts, load)
+		if c.End <= c.Start {
+			continue
+		}
+		erase := burst{frame: frameAt(c.End, fps), pairs: [][2]byte{ccEraseDisplayed, ccEraseDisplayed}}
+		if i+1 < len(sorted) {
+			next := popOnPairs(sorted[i+1].Text)
+			if erase.frame+len(erase.pairs) > frameAt(sorted[i+1].Start, fps)-len(next)+2 {
+				continue
+			}
+		}
+		bursts = append(bursts, erase)
+	}
+
+	out := make(map[int][2]byte)
+	next := 0
+	for _, b := range bursts {
+		frame := max(b.frame, next)
+		for _, p := range b.pairs {
+			out[frame] = withParity(p)
+			frame++
+		}
+		next = frame
+	}
+	return out
+}
+
+// captionSEI returns the RBSP of an SEI message carrying pair as ATSC A/53
+// cc_data for field 1.
+func captionSEI(pair [2]byte) []byte {
+	payload := []byte{
+		0xB5,       // itu_t_t35_country_code: United States
+		0x00, 0x31, // itu_t_t35_provider_code: ATSC
+		'G', 'A', '9', '4',
+		0x03,     // user_data_type_code: cc_data
+		0x40 | 1, // process_cc_data_flag, cc_count
+		0xFF,     // em_data
+		0xFC,     // cc_valid, cc_type 0: NTSC field 1
+		pair[0], pair[1],
+		0xFF, // marker_bits
+	}
+	sei := []byte{0x04, byte(len(payload))} // user_data_registered_itu_t_t35
+	sei = append(sei, payload...)
+	return append(sei, 0x80) // rbsp_trailing_bits
+}
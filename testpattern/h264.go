@@ -0,0 +1,238 @@
+package testpattern
+
+import "math/bits"
+
+// bitWriter writes an H.264 or AAC bitstream most significant bit first.
+type bitWriter struct {
+	buf  []byte
+	used uint // bits used in the last byte; 0 means it is full
+}
+
+// u writes the low n bits of v.
+func (w *bitWriter) u(n int, v uint64) {
+	for i := n - 1; i >= 0; i-- {
+		if w.used == 0 {
+			w.buf = append(w.buf, 0)
+		}
+		if v>>uint(i)&1 != 0 {
+			w.buf[len(w.buf)-1] |= 0x80 >> w.used
+		}
+		w.used = (w.used + 1) % 8
+	}
+}
+
+// ue writes v as an unsigned Exp-Golomb code.
+func (w *bitWriter) ue(v uint64) {
+	n := bits.Len64(v + 1)
+	w.u(n-1, 0)
+	w.u(n, v+1)
+}
+
+// se writes v as a signed Exp-Golomb code.
+func (w *bitWriter) se(v int64) {
+	if v > 0 {
+		w.ue(uint64(2*v - 1))
+	} else {
+		w.ue(uint64(-2 * v))
+	}
+}
+
+// align pads with zero bits to the next byte boundary.
+func (w *bitWriter) align() {
+	w.used = 0
+}
+
+// trailing writes the rbsp_trailing_bits: a one bit, then zero bits to the
+// next byte boundary.
+func (w *bitWriter) trailing() {
+	w.u(1, 1)
+	w.align()
+}
+
+// H.264 NAL unit headers: nal_ref_idc and nal_unit_type.
+const (
+	nalSlice = 0x41 // non-IDR slice, nal_ref_idc 2
+	nalIDR   = 0x65 // IDR slice, nal_ref_idc 3
+	nalSEI   = 0x06
+	nalSPS   = 0x67
+	nalPPS   = 0x68
+	nalAUD   = 0x09
+)
+
+// log2MaxFrameNum is log2_max_frame_num in the SPS; frame_num counts the
+// pictures since the last IDR modulo 1<<log2MaxFrameNum.
+const log2MaxFrameNum = 4
+
+// appendNAL appends a NAL unit with a 4-byte start code, inserting
+// emulation prevention bytes into rbsp.
+func appendNAL(b []byte, header byte, rbsp []byte) []byte {
+	b = append(b, 0x00, 0x00, 0x00, 0x01, header)
+	zeros := 0
+	for _, c := range rbsp {
+		if zeros >= 2 && c <= 0x03 {
+			b = append(b, 0x03)
+			zeros = 0
+		}
+		b = append(b, c)
+		if c == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+	}
+	return b
+}
+
+// spsRBSP returns a Constrained Baseline SPS for a picture of mbW by mbH
+// macroblocks with frame-only coding, POC type 2 (output in decode order,
+// as there are no B-frames) and VUI timing for fps frames per second.
+func spsRBSP(mbW, mbH, fps int) []byte {
+	var w bitWriter
+	w.u(8, 66)   // profile_idc: Baseline
+	w.u(8, 0xC0) // constraint_set0_flag, constraint_set1_flag
+	w.u(8, 40)   // level_idc 4.0
+	w.ue(0)      // seq_parameter_set_id
+	w.ue(log2MaxFrameNum - 4)
+	w.ue(2)   // pic_order_cnt_type
+	w.ue(1)   // max_num_ref_frames
+	w.u(1, 0) // gaps_in_frame_num_value_allowed_flag
+	w.ue(uint64(mbW - 1))
+	w.ue(uint64(mbH - 1))
+	w.u(1, 1) // frame_mbs_only_flag
+	w.u(1, 1) // direct_8x8_inference_flag
+	w.u(1, 0) // frame_cropping_flag
+	w.u(1, 1) // vui_parameters_present_flag
+	w.u(4, 0) // aspect ratio, overscan, video signal type, chroma location
+	w.u(1, 1) // timing_info_present_flag
+	w.u(32, 1)
+	w.u(32, uint64(2*fps)) // time_scale counts field ticks
+	w.u(1, 1)              // fixed_frame_rate_flag
+	w.u(4, 0)              // HRD, pic_struct, bitstream restriction
+	w.trailing()
+	return w.buf
+}
+
+// ppsRBSP returns a CAVLC PPS whose slices may disable deblocking.
+func ppsRBSP() []byte {
+	var w bitWriter
+	w.ue(0)   // pic_parameter_set_id
+	w.ue(0)   // seq_parameter_set_id
+	w.u(1, 0) // entropy_coding_mode_flag: CAVLC
+	w.u(1, 0) // bottom_field_pic_order_in_frame_present_flag
+	w.ue(0)   // num_slice_groups_minus1
+	w.ue(0)   // num_ref_idx_l0_default_active_minus1
+	w.ue(0)   // num_ref_idx_l1_default_active_minus1
+	w.u(1, 0) // weighted_pred_flag
+	w.u(2, 0) // weighted_bipred_idc
+	w.se(0)   // pic_init_qp_minus26
+	w.se(0)   // pic_init_qs_minus26
+	w.se(0)   // chroma_qp_index_offset
+	w.u(1, 1) // deblocking_filter_control_present_flag
+	w.u(1, 0) // constrained_intra_pred_flag
+	w.u(1, 0) // redundant_pic_cnt_present_flag
+	w.trailing()
+	return w.buf
+}
+
+// idrRBSP returns an IDR slice coding pic, a 4:2:0 picture of mbW by mbH
+// macroblocks, losslessly as I_PCM macroblocks, so no transform or
+// entropy coding of samples is needed.
+func idrRBSP(pic *picture, idrID int) []byte {
+	var w bitWriter
+	w.ue(0) // first_mb_in_slice
+	w.ue(7) // slice_type: I, as are all slices of the picture
+	w.ue(0) // pic_parameter_set_id
+	w.u(log2MaxFrameNum, 0)
+	w.ue(uint64(idrID))
+	w.u(1, 0) // no_output_of_prior_pics_flag
+	w.u(1, 0) // long_term_reference_flag
+	w.se(0)   // slice_qp_delta
+	w.ue(1)   // disable_deblocking_filter_idc
+
+	for my := range pic.mbH {
+		for mx := range pic.mbW {
+			w.ue(25) // mb_type: I_PCM
+			w.align()
+			for y := range 16 {
+				w.buf = append(w.buf, pic.y[(my*16+y)*pic.stride()+mx*16:][:16]...)
+			}
+			for _, plane := range [][]byte{pic.cb, pic.cr} {
+				for y := range 8 {
+					w.buf = append(w.buf, plane[(my*8+y)*pic.stride()/2+mx*8:][:8]...)
+				}
+			}
+		}
+	}
+	w.trailing()
+	return w.buf
+}
+
+// skipRBSP returns a P slice that skips every macroblock, repeating the
+// previous picture.
+func skipRBSP(mbs, frameNum int) []byte {
+	var w bitWriter
+	w.ue(0) // first_mb_in_slice
+	w.ue(5) // slice_type: P, as are all slices of the picture
+	w.ue(0) // pic_parameter_set_id
+	w.u(log2MaxFrameNum, uint64(frameNum%(1<<log2MaxFrameNum)))
+	w.u(1, 0) // num_ref_idx_active_override_flag
+	w.u(1, 0) // ref_pic_list_modification_flag_l0
+	w.u(1, 0) // adaptive_ref_pic_marking_mode_flag
+	w.se(0)   // slice_qp_delta
+	w.ue(1)   // disable_deblocking_filter_idc
+	w.ue(uint64(mbs))
+	w.trailing()
+	return w.buf
+}
+
+// picture is a 4:2:0 picture with 8-bit samples.
+type picture struct {
+	mbW, mbH  int
+	y, cb, cr []byte
+}
+
+func (p *picture) stride() int { return p.mbW * 16 }
+
+// barColors are 75% colour bars as BT.601 Y, Cb, Cr.
+var barColors = [][3]byte{
+	{180, 128, 128}, // white
+	{162, 44, 142},  // yellow
+	{131, 156, 44},  // cyan
+	{112, 72, 58},   // green
+	{84, 184, 198},  // magenta
+	{65, 100, 212},  // red
+	{35, 212, 114},  // blue
+}
+
+// testPicture draws colour bars over the top three quarters of the
+// picture and, below them, a white block on black that moves along with
+// step, so that successive keyframes differ.
+func testPicture(mbW, mbH, step int) *picture {
+	w, h := mbW*16, mbH*16
+	p := &picture{
+		mbW: mbW,
+		mbH: mbH,
+		y:   make([]byte, w*h),
+		cb:  make([]byte, w*h/4),
+		cr:  make([]byte, w*h/4),
+	}
+	block := w / 8
+	blockX := step * block % w
+	for y := range h {
+		for x := range w {
+			c := [3]byte{16, 128, 128} // black
+			switch {
+			case y < h*3/4:
+				c = barColors[x*len(barColors)/w]
+			case x >= blockX && x < blockX+block:
+				c = [3]byte{235, 128, 128}
+			}
+			p.y[y*w+x] = c[0]
+			if x%2 == 0 && y%2 == 0 {
+				p.cb[y/2*w/2+x/2] = c[1]
+				p.cr[y/2*w/2+x/2] = c[2]
+			}
+		}
+	}
+	return p
+}
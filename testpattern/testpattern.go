@@ -0,0 +1,228 @@
+// Package testpattern generates synthetic MPEG-TS streams in pure Go, for
+// tests and demos that need a real stream without ffmpeg or source
+// media. A stream carries H.264 colour bars, a mono AAC tone and,
+// optionally, CEA-608 captions and SCTE-35 splice_insert cues.
+//
+// The video is Constrained Baseline: each keyframe codes the pattern
+// losslessly with I_PCM macroblocks and the frames between repeat it with
+// skipped macroblocks, so no encoder is needed. Keyframes are therefore
+// large, about 1.5 bytes per pixel.
+package testpattern
+
+import (
+	"bytes"
+	"io"
+	"time"
+
+	"github.com/zsiec/prism/mpegts"
+	"github.com/zsiec/prism/scte35"
+)
+
+// PIDs of the generated program. The SCTE-35 PID is the one the demuxer
+// reads cues from.
+const (
+	VideoPID  uint16 = 0x100
+	AudioPID  uint16 = 0x101
+	SCTE35PID uint16 = 500
+)
+
+// basePTS is the PTS of the first video frame, leaving room for the PCR
+// to run behind it.
+const basePTS = 10 * 90000
+
+// Config describes a generated stream. The zero value is a 320x240,
+// 30 fps stream with a keyframe every second that never ends.
+type Config struct {
+	// Width and Height are the picture size in pixels, rounded up to a
+	// multiple of 16. Zero uses 320x240.
+	Width, Height int
+
+	// FrameRate is the video frame rate in frames per second. Zero uses
+	// 30.
+	FrameRate int
+
+	// GOP is the number of frames from one keyframe to the next. Zero
+	// uses one second of frames.
+	GOP int
+
+	// Duration is how much of the stream to generate. Zero generates it
+	// without end.
+	Duration time.Duration
+
+	// NoAudio leaves out the AAC tone track.
+	NoAudio bool
+
+	// Captions are shown as CEA-608 pop-on captions on CC1.
+	Captions []Caption
+
+	// Splices are sent as SCTE-35 splice_insert commands.
+	Splices []Splice
+}
+
+// Caption is a caption shown from Start to End, measured from the start
+// of the stream. A zero End leaves it up until the next caption replaces
+// it. Text is up to four rows of 32 characters, separated by newlines.
+type Caption struct {
+	Start, End time.Duration
+	Text       string
+}
+
+// Splice is an immediate SCTE-35 splice_insert sent At into the stream.
+// It leaves the network for Duration, or returns to it if Duration is
+// zero.
+type Splice struct {
+	At       time.Duration
+	EventID  uint32
+	Duration time.Duration
+}
+
+// Reader is an io.Reader of a generated MPEG-TS stream. It produces the
+// stream as it is read, a video frame interval at a time.
+type Reader struct {
+	cfg      Config
+	mbW, mbH int
+	frames   int // total, or -1 without end
+
+	mux      *mpegts.Muxer
+	scte35   *scte35.PacketizerState
+	buf      bytes.Buffer
+	sps, pps []byte
+	tone     []byte
+	captions map[int][2]byte
+
+	frame    int
+	audioPTS int64
+	err      error
+}
+
+// NewReader returns a Reader generating the stream cfg describes.
+func NewReader(cfg Config) *Reader {
+	if cfg.Width <= 0 || cfg.Height <= 0 {
+		cfg.Width, cfg.Height = 320, 240
+	}
+	if cfg.FrameRate <= 0 {
+		cfg.FrameRate = 30
+	}
+	if cfg.GOP <= 0 {
+		cfg.GOP = cfg.FrameRate
+	}
+
+	r := &Reader{
+		cfg:      cfg,
+		mbW:      (cfg.Width + 15) / 16,
+		mbH:      (cfg.Height + 15) / 16,
+		frames:   -1,
+		tone:     toneFrame(),
+		captions: scheduleCaptions(cfg.Captions, cfg.FrameRate),
+		audioPTS: basePTS,
+	}
+	if cfg.Duration > 0 {
+		r.frames = max(frameAt(cfg.Duration, cfg.FrameRate), 1)
+	}
+	r.sps = spsRBSP(r.mbW, r.mbH, cfg.FrameRate)
+	r.pps = ppsRBSP()
+
+	streams := []mpegts.MuxStream{{PID: VideoPID, StreamType: mpegts.StreamTypeH264}}
+	if !cfg.NoAudio {
+		streams = append(streams, mpegts.MuxStream{PID: AudioPID, StreamType: mpegts.StreamTypeAAC})
+	}
+	if len(cfg.Splices) > 0 {
+		streams = append(streams, mpegts.MuxStream{PID: SCTE35PID, StreamType: mpegts.StreamTypeSCTE35})
+		r.scte35 = scte35.NewPacketizerState(SCTE35PID)
+	}
+	r.mux = mpegts.NewMuxer(&r.buf, streams...)
+	return r
+}
+
+// Read reads the next bytes of the stream, returning io.EOF after the
+// last frame.
+func (r *Reader) Read(p []byte) (int, error) {
+	for r.buf.Len() == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.frames >= 0 && r.frame >= r.frames {
+			return 0, io.EOF
+		}
+		r.err = r.writeFrame()
+	}
+	return r.buf.Read(p)
+}
+
+// writeFrame writes the next video frame with the audio, PSI and cues due
+// up to the frame after it.
+func (r *Reader) writeFrame() error {
+	i := r.frame
+	r.frame++
+	pts := framePTS(i, r.cfg.FrameRate)
+	key := i%r.cfg.GOP == 0
+
+	if key {
+		if err := r.mux.WritePSI(); err != nil {
+			return err
+		}
+	}
+	for _, s := range r.cfg.Splices {
+		if frameAt(s.At, r.cfg.FrameRate) == i {
+			section, err := spliceSection(s)
+			if err != nil {
+				return err
+			}
+			r.buf.Write(r.scte35.Packetize(section))
+		}
+	}
+
+	au := appendNAL(nil, nalAUD, []byte{0xF0})
+	if key {
+		au = appendNAL(au, nalSPS, r.sps)
+		au = appendNAL(au, nalPPS, r.pps)
+	}
+	if pair, ok := r.captions[i]; ok {
+		au = appendNAL(au, nalSEI, captionSEI(pair))
+	}
+	if key {
+		au = appendNAL(au, nalIDR, idrRBSP(testPicture(r.mbW, r.mbH, i/r.cfg.GOP), i/r.cfg.GOP%65536))
+	} else {
+		au = appendNAL(au, nalSlice, skipRBSP(r.mbW*r.mbH, i%r.cfg.GOP))
+	}
+	if err := r.mux.WriteAccessUnit(VideoPID, pts, pts, key, au); err != nil {
+		return err
+	}
+
+	if r.cfg.NoAudio {
+		return nil
+	}
+	for next := framePTS(i+1, r.cfg.FrameRate); r.audioPTS < next; r.audioPTS += aacFrameTicks {
+		if err := r.mux.WriteAccessUnit(AudioPID, r.audioPTS, r.audioPTS, true, r.tone); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// spliceSection encodes s as a splice_info_section.
+func spliceSection(s Splice) ([]byte, error) {
+	cmd := &scte35.SpliceInsert{
+		SpliceEventID:         s.EventID,
+		OutOfNetworkIndicator: s.Duration > 0,
+		SpliceImmediateFlag:   true,
+	}
+	if s.Duration > 0 {
+		cmd.BreakDuration = &scte35.BreakDuration{
+			AutoReturn: true,
+			Duration:   uint64(s.Duration * 90000 / time.Second),
+		}
+	}
+	sis := scte35.SpliceInfoSection{SAPType: 3, Tier: 0xFFF, SpliceCommand: cmd}
+	return sis.Encode()
+}
+
+// frameAt returns the index of the frame shown at d into the stream.
+func frameAt(d time.Duration, fps int) int {
+	return int(d * time.Duration(fps) / time.Second)
+}
+
+// framePTS returns the PTS of frame i in 90kHz units.
+func framePTS(i, fps int) int64 {
+	return basePTS + int64(i)*90000/int64(fps)
+}
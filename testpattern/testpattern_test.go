@@ -0,0 +1,125 @@
+package testpattern
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zsiec/prism/demux"
+	"github.com/zsiec/prism/media"
+)
+
+func TestReaderThroughDemuxer(t *testing.T) {
+	t.Parallel()
+
+	r := NewReader(Config{
+		Width:     176,
+		Height:    144,
+		FrameRate: 25,
+		Duration:  2 * time.Second,
+		Captions: []Caption{
+			{Start: 500 * time.Millisecond, End: 1500 * time.Millisecond, Text: "HELLO\nWORLD"},
+		},
+		Splices: []Splice{{At: time.Second, EventID: 7, Duration: 30 * time.Second}},
+	})
+	d := demux.NewDemuxer(r, nil)
+
+	var (
+		wg       sync.WaitGroup
+		video    []*media.VideoFrame
+		audio    []*media.AudioFrame
+		captions []*media.CaptionFrame
+		splices  []*demux.SCTE35Event
+	)
+	wg.Add(5)
+	go func() {
+		defer wg.Done()
+		for f := range d.Video() {
+			video = append(video, f)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for f := range d.Audio() {
+			audio = append(audio, f)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for f := range d.Captions() {
+			captions = append(captions, f)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for e := range d.SCTE35() {
+			splices = append(splices, e)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for range d.Events() {
+		}
+	}()
+	if err := d.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+
+	if len(video) != 50 {
+		t.Fatalf("video frames = %d, want 50", len(video))
+	}
+	for i, f := range video {
+		if want := i%25 == 0; f.IsKeyframe != want {
+			t.Errorf("frame %d: keyframe = %v, want %v", i, f.IsKeyframe, want)
+		}
+		if want := int64(i) * 40_000; f.PTS-video[0].PTS != want {
+			t.Errorf("frame %d: PTS offset = %d, want %d", i, f.PTS-video[0].PTS, want)
+		}
+	}
+	sps, err := demux.ParseSPS(video[0].SPS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sps.Width != 176 || sps.Height != 144 {
+		t.Errorf("SPS size = %dx%d, want 176x144", sps.Width, sps.Height)
+	}
+
+	// Audio covers the video: 2s of 1024-sample frames at 48kHz.
+	if len(audio) != 94 {
+		t.Errorf("audio frames = %d, want 94", len(audio))
+	}
+	if len(audio) > 0 && (audio[0].SampleRate != 48000 || audio[0].Channels != 1) {
+		t.Errorf("audio = %d Hz, %d channels; want 48000 Hz mono", audio[0].SampleRate, audio[0].Channels)
+	}
+
+	var shown []string
+	for _, c := range captions {
+		if c.Channel == 1 {
+			shown = append(shown, c.Text)
+		}
+	}
+	if !strings.Contains(strings.Join(shown, "|"), "HELLO\nWORLD") {
+		t.Errorf("CC1 captions = %q, want HELLO\\nWORLD shown", shown)
+	}
+
+	if len(splices) != 1 {
+		t.Fatalf("SCTE-35 events = %d, want 1", len(splices))
+	}
+	if e := splices[0]; e.EventID != 7 || !e.OutOfNetwork || e.Duration != 30 {
+		t.Errorf("SCTE-35 event = %+v, want event 7 out of network for 30s", e)
+	}
+}
+
+func TestReaderEndless(t *testing.T) {
+	t.Parallel()
+
+	// Without a duration the stream does not end; read the first MiB.
+	n, err := io.Copy(io.Discard, io.LimitReader(NewReader(Config{Width: 64, Height: 64, NoAudio: true}), 1<<20))
+	if err != nil || n != 1<<20 {
+		t.Fatalf("read %d bytes, %v; want %d", n, err, 1<<20)
+	}
+}
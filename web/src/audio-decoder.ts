@@ -100,8 +100,14 @@ export class PrismAudioDecoder {
 	private _diagInputPtsWraps = 0;
 	private _ptsEpochReset = false;
 	private _configuredCodec = "";
-
-	async configure(codec: string, sampleRate: number, channels: number, ctx?: AudioContext): Promise<void> {
+	private _description: Uint8Array | undefined;
+
+	/**
+	 * Configure the decoder. description is the codec's decoder config
+	 * (the AAC AudioSpecificConfig from the catalog), when the server
+	 * provides one.
+	 */
+	async configure(codec: string, sampleRate: number, channels: number, ctx?: AudioContext, description?: Uint8Array): Promise<void> {
 		this.reset();
 		this.sampleRate = sampleRate;
 		this.numChannels = channels;
@@ -151,6 +157,7 @@ export class PrismAudioDecoder {
 		});
 
 		this._configuredCodec = codec;
+		this._description = description;
 		this.createDecoder(codec, channels, sampleRate);
 	}
 
@@ -169,7 +176,7 @@ export class PrismAudioDecoder {
 				this.recoverDecoder();
 			},
 		});
-		this.decoder.configure({ codec, numberOfChannels: channels, sampleRate });
+		this.decoder.configure({ codec, numberOfChannels: channels, sampleRate, description: this._description });
 	}
 
 	private recoverDecoder(): void {
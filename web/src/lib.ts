@@ -32,6 +32,7 @@ export type {
   TrackInfo,
   ServerAudioTrackStats,
   ServerViewerStats,
+  ServerRelayStats,
   ServerSCTE35Event,
   ServerStats,
 } from "./transport";
@@ -30,6 +30,8 @@ interface StreamListEntry {
 	hasCaptions?: boolean;
 	captionChannels?: number[];
 	hasScte35?: boolean;
+	ingestHealth?: "ok" | "low" | "high";
+	ingestBreaches?: number;
 	width?: number;
 	height?: number;
 }
@@ -5,6 +5,7 @@ export const MOQ_MSG_SUBSCRIBE = 0x03;
 export const MOQ_MSG_SUBSCRIBE_OK = 0x04;
 export const MOQ_MSG_SUBSCRIBE_ERROR = 0x05;
 export const MOQ_MSG_UNSUBSCRIBE = 0x0a;
+export const MOQ_MSG_SUBSCRIBE_DONE = 0x0b;
 export const MOQ_MSG_GOAWAY = 0x10;
 export const MOQ_MSG_MAX_REQUEST_ID = 0x15;
 export const MOQ_MSG_CLIENT_SETUP = 0x20;
@@ -17,19 +18,71 @@ export const MOQ_VERSION = 0xff00000f;
 export const MOQ_PARAM_PATH = 0x01; // odd = length-prefixed byte string
 export const MOQ_PARAM_MAX_REQUEST_ID = 0x02; // even = varint value
 
+// SUBSCRIBE_ERROR codes (draft-15). Must match SubscribeErrorCode in moq/control.go.
+export const MOQ_SUBSCRIBE_ERROR_NAMES: Record<number, string> = {
+	0x0: "INTERNAL_ERROR",
+	0x1: "UNAUTHORIZED",
+	0x2: "TIMEOUT",
+	0x3: "NOT_SUPPORTED",
+	0x4: "TRACK_DOES_NOT_EXIST",
+	0x5: "INVALID_RANGE",
+	0x10: "MALFORMED_AUTH_TOKEN",
+	0x12: "EXPIRED_AUTH_TOKEN",
+};
+
+/** Return the spec name for a SUBSCRIBE_ERROR code, or its hex value if unknown. */
+export function subscribeErrorName(code: number): string {
+	return MOQ_SUBSCRIBE_ERROR_NAMES[code] ?? `0x${code.toString(16)}`;
+}
+
+// SUBSCRIBE_DONE status codes (draft-15). Must match SubscribeDoneStatus in moq/control.go.
+export const MOQ_SUBSCRIBE_DONE_SUBSCRIPTION_ENDED = 0x3;
+export const MOQ_SUBSCRIBE_DONE_NAMES: Record<number, string> = {
+	0x0: "INTERNAL_ERROR",
+	0x1: "UNAUTHORIZED",
+	0x2: "TRACK_ENDED",
+	0x3: "SUBSCRIPTION_ENDED",
+	0x4: "GOING_AWAY",
+	0x5: "EXPIRED",
+	0x6: "TOO_FAR_BEHIND",
+};
+
+/** Return the spec name for a SUBSCRIBE_DONE status, or its hex value if unknown. */
+export function subscribeDoneName(code: number): string {
+	return MOQ_SUBSCRIBE_DONE_NAMES[code] ?? `0x${code.toString(16)}`;
+}
+
 // Subscribe filter types (draft-15 section 6.6).
 export const MOQ_FILTER_NEXT_GROUP_START = 0x01;
 
+// Prism SUBSCRIBE parameter: a nonzero varint starts video at the next
+// live keyframe instead of replaying the group in progress.
+export const MOQ_PARAM_LIVE_EDGE = 0x7f06;
+
+// AUTHORIZATION TOKEN parameter (draft-15 section 9.2.1.1), sent with the
+// USE_VALUE alias type and an unspecified (0) token type.
+export const MOQ_PARAM_AUTH_TOKEN = 0x03;
+export const MOQ_AUTH_TOKEN_USE_VALUE = 0x03;
+
 // Group order values.
 export const MOQ_GROUP_ORDER_DESCENDING = 0x02;
 
 // MoQ stream type for subgroup with SID extension.
 export const MOQ_STREAM_TYPE_SUBGROUP_SID_EXT = 0x0d;
 
+// Object status, sent in place of a payload on zero-length objects (draft-15).
+export const MOQ_OBJECT_STATUS_DOES_NOT_EXIST = 0x1;
+export const MOQ_OBJECT_STATUS_END_OF_GROUP = 0x3;
+
 // LOC header extension IDs (draft-ietf-moq-loc-01).
 export const LOC_EXT_CAPTURE_TIMESTAMP = 2;
 export const LOC_EXT_VIDEO_FRAME_MARKING = 4;
 export const LOC_EXT_VIDEO_CONFIG = 13;
+// Prism extension: SMPTE timecode packed as hh<<24 | mm<<16 | ss<<8 | ff.
+export const LOC_EXT_TIMECODE = 62;
+// Prism extension: the size and timestamp offset of each frame of an
+// audio object carrying several frames back to back.
+export const LOC_EXT_AUDIO_FRAMES = 67;
 
 // RFC 9626 Video Frame Marking flags.
 export const VFM_KEYFRAME = 0xe0;
@@ -228,6 +281,8 @@ export function serializeSubscribe(
 	trackName: string,
 	priority: number,
 	filterType: number,
+	liveEdge = false,
+	authToken = "",
 ): Uint8Array {
 	const parts: Uint8Array[] = [];
 	appendVarint(parts, requestID);
@@ -237,7 +292,19 @@ export function serializeSubscribe(
 	parts.push(new Uint8Array([MOQ_GROUP_ORDER_DESCENDING])); // group order
 	parts.push(new Uint8Array([0])); // forward
 	appendVarint(parts, filterType);
-	appendVarint(parts, 0); // NumParams = 0
+	appendVarint(parts, (liveEdge ? 1 : 0) + (authToken ? 1 : 0)); // NumParams
+	if (liveEdge) {
+		appendVarint(parts, MOQ_PARAM_LIVE_EDGE);
+		appendVarint(parts, 1);
+	}
+	if (authToken) {
+		const token: Uint8Array[] = [];
+		appendVarint(token, MOQ_AUTH_TOKEN_USE_VALUE);
+		appendVarint(token, 0); // token type
+		token.push(new TextEncoder().encode(authToken));
+		appendVarint(parts, MOQ_PARAM_AUTH_TOKEN);
+		appendVarIntBytes(parts, concatBuffers(token));
+	}
 	return concatBuffers(parts);
 }
 
@@ -318,6 +385,36 @@ export function parseSubscribeError(data: Uint8Array): SubscribeErrorResult {
 	};
 }
 
+export interface SubscribeDoneResult {
+	requestID: number;
+	statusCode: number;
+	streamCount: number;
+	reasonPhrase: string;
+}
+
+/** Parse a SUBSCRIBE_DONE payload. */
+export function parseSubscribeDone(data: Uint8Array): SubscribeDoneResult {
+	let offset = 0;
+	const reqID = readVarint(data, offset);
+	offset += reqID.bytesRead;
+	const status = readVarint(data, offset);
+	offset += status.bytesRead;
+	const count = readVarint(data, offset);
+	offset += count.bytesRead;
+	const reasonLen = readVarint(data, offset);
+	offset += reasonLen.bytesRead;
+	const reason = new TextDecoder().decode(
+		data.subarray(offset, offset + reasonLen.value),
+	);
+
+	return {
+		requestID: reqID.value,
+		statusCode: status.value,
+		streamCount: count.value,
+		reasonPhrase: reason,
+	};
+}
+
 /** Parse a SERVER_SETUP payload. Returns { selectedVersion, maxRequestID }. */
 export function parseServerSetup(data: Uint8Array): {
 	selectedVersion: number;
@@ -352,10 +449,33 @@ export function parseServerSetup(data: Uint8Array): {
 
 // --- LOC Extension Parsing ---
 
+/** One frame of an audio object carrying several (LOC_EXT_AUDIO_FRAMES). */
+export interface AudioSubFrame {
+	size: number;
+	/** Microseconds after the object's capture timestamp. */
+	offset: number;
+}
+
 export interface LOCExtensions {
 	captureTimestamp: number;
 	isKeyframe: boolean;
 	videoConfig: Uint8Array | null;
+	timecode: number | null;
+	audioFrames: AudioSubFrame[] | null;
+}
+
+/** Parse the frame index of LOC_EXT_AUDIO_FRAMES: size and offset varints per frame. */
+function parseAudioFrames(data: Uint8Array): AudioSubFrame[] {
+	const frames: AudioSubFrame[] = [];
+	let offset = 0;
+	while (offset < data.length) {
+		const size = readVarint(data, offset);
+		offset += size.bytesRead;
+		const ts = readVarint(data, offset);
+		offset += ts.bytesRead;
+		frames.push({ size: size.value, offset: ts.value });
+	}
+	return frames;
 }
 
 /** Parse LOC extensions from a byte buffer. */
@@ -364,6 +484,8 @@ export function parseExtensions(data: Uint8Array): LOCExtensions {
 		captureTimestamp: 0,
 		isKeyframe: false,
 		videoConfig: null,
+		timecode: null,
+		audioFrames: null,
 	};
 	let offset = 0;
 	while (offset < data.length) {
@@ -379,6 +501,8 @@ export function parseExtensions(data: Uint8Array): LOCExtensions {
 
 			if (id.value === LOC_EXT_VIDEO_CONFIG) {
 				result.videoConfig = bytes;
+			} else if (id.value === LOC_EXT_AUDIO_FRAMES) {
+				result.audioFrames = parseAudioFrames(bytes);
 			}
 		} else {
 			// Even ID: varint value
@@ -389,6 +513,8 @@ export function parseExtensions(data: Uint8Array): LOCExtensions {
 				result.captureTimestamp = val.value;
 			} else if (id.value === LOC_EXT_VIDEO_FRAME_MARKING) {
 				result.isKeyframe = (val.value & 0x20) !== 0; // I bit
+			} else if (id.value === LOC_EXT_TIMECODE) {
+				result.timecode = val.value;
 			}
 		}
 	}
@@ -1,4 +1,4 @@
-import { TrackInfo, ServerStats, ServerViewerStats } from "./transport";
+import { TrackInfo, ServerStats, ServerViewerStats, ServerRelayStats } from "./transport";
 import { StreamBuffer } from "./stream-buffer";
 import { parseCaptionData, CaptionData, ProtocolDiagnostics } from "./protocol";
 import { fetchServerInfo, wtBaseURL, connectWebTransport } from "./transport-utils";
@@ -10,10 +10,15 @@ import {
 	MOQ_MSG_SUBSCRIBE_OK,
 	MOQ_MSG_SUBSCRIBE_ERROR,
 	MOQ_MSG_UNSUBSCRIBE,
+	MOQ_MSG_SUBSCRIBE_DONE,
 	MOQ_MSG_MAX_REQUEST_ID,
 	MOQ_MSG_GOAWAY,
 	MOQ_STREAM_TYPE_SUBGROUP_SID_EXT,
+	MOQ_OBJECT_STATUS_DOES_NOT_EXIST,
 	MOQ_FILTER_NEXT_GROUP_START,
+	MOQ_SUBSCRIBE_DONE_SUBSCRIPTION_ENDED,
+	subscribeErrorName,
+	subscribeDoneName,
 	readVarint,
 	writeControlMsg,
 	readControlMsgFromBuffer,
@@ -22,8 +27,10 @@ import {
 	serializeUnsubscribe,
 	parseSubscribeOK,
 	parseSubscribeError,
+	parseSubscribeDone,
 	parseServerSetup,
 	parseExtensions,
+	LOCExtensions,
 	readVarintFromBuffer,
 } from "./moq-constants";
 
@@ -46,10 +53,18 @@ export interface MoQTransportCallbacks {
 	onCaptionFrame: (caption: CaptionData, timestamp: number) => void;
 	onServerStats: (stats: ServerStats) => void;
 	onViewerStats?: (stats: ServerViewerStats) => void;
+	onRelayStats?: (stats: ServerRelayStats) => void;
+	/** Called when the server pushes a refreshed catalog, e.g. after a resolution change. */
+	onCatalogUpdate?: (tracks: TrackInfo[]) => void;
 	onClose: () => void;
 	onError: (err: string) => void;
 }
 
+/** Subscriber priority for a track: video first, then audio, then data tracks. */
+function trackPriority(name: string): number {
+	return name === "video" ? 0 : name.startsWith("audio") ? 64 : 128;
+}
+
 interface PendingSubscribe {
 	trackName: string;
 	resolve: (alias: number) => void;
@@ -65,6 +80,8 @@ interface MoQCatalog {
 	version: number;
 	streamingFormat: number;
 	streamingFormatVersion: string;
+	/** Increases whenever the server pushes a changed catalog. */
+	sequence?: number;
 	commonTrackFields: { namespace: string; packaging: string };
 	tracks: {
 		name: string;
@@ -75,6 +92,7 @@ interface MoQCatalog {
 			initData?: string;
 			samplerate?: number;
 			channelConfig?: string;
+			configHash?: string;
 		};
 	}[];
 }
@@ -100,11 +118,25 @@ export class MoQTransport {
 	private namespace: string[] = [];
 	private catalogTracks: MoQCatalog["tracks"] = [];
 
+	/**
+	 * Start video at the next live keyframe instead of the cached group.
+	 * Latency is lowest from the first frame, but the picture appears up
+	 * to one GOP later. Set before connect().
+	 */
+	liveEdge = false;
+
+	/**
+	 * Token sent with every SUBSCRIBE for servers that require one
+	 * (SUBSCRIBE_TOKENS). Empty sends none. Set before connect().
+	 */
+	authToken = "";
+
 	// Diagnostics counters (matches ProtocolDiagnostics)
 	private _diagStreamsOpened = 0;
 	private _diagBytesReceived = 0;
 	private _diagVideoFrames = 0;
 	private _diagAudioFrames = 0;
+	private _diagObjectsLost = 0;
 	private _diagLastVideoArrival = 0;
 	private _diagVideoArrivalSum = 0;
 	private _diagVideoArrivalMax = 0;
@@ -197,8 +229,7 @@ export class MoQTransport {
 		const mediaSubscriptions: Promise<number>[] = [];
 		for (const track of catalog.tracks) {
 			if (track.name === "catalog") continue;
-			const priority = track.name === "video" ? 0 : track.name.startsWith("audio") ? 64 : 128;
-			mediaSubscriptions.push(this.subscribe(this.namespace, track.name, priority));
+			mediaSubscriptions.push(this.subscribe(this.namespace, track.name, trackPriority(track.name)));
 		}
 		await Promise.all(mediaSubscriptions);
 	}
@@ -222,6 +253,7 @@ export class MoQTransport {
 			bytesReceived: this._diagBytesReceived,
 			videoFramesReceived: this._diagVideoFrames,
 			audioFramesReceived: this._diagAudioFrames,
+			objectsLost: this._diagObjectsLost,
 			avgVideoArrivalMs: this._diagVideoArrivalCount > 0
 				? this._diagVideoArrivalSum / this._diagVideoArrivalCount : 0,
 			maxVideoArrivalMs: this._diagVideoArrivalMax,
@@ -263,12 +295,24 @@ export class MoQTransport {
 		await this.subscribeAudio(audioIndices);
 	}
 
+	/** Reports whether trackName is subscribed or has a SUBSCRIBE in flight. */
+	private hasSubscription(trackName: string): boolean {
+		if (this.activeSubscriptions.has(trackName)) return true;
+		for (const pending of this.pendingSubscribes.values()) {
+			if (pending.trackName === trackName) return true;
+		}
+		return false;
+	}
+
 	private async subscribe(namespace: string[], trackName: string, priority: number): Promise<number> {
 		const requestID = this.nextRequestID++;
 		if (requestID > this.serverMaxRequestID) {
 			throw new Error(`Request ID ${requestID} exceeds server max ${this.serverMaxRequestID}`);
 		}
-		const payload = serializeSubscribe(requestID, namespace, trackName, priority, MOQ_FILTER_NEXT_GROUP_START);
+		const payload = serializeSubscribe(
+			requestID, namespace, trackName, priority, MOQ_FILTER_NEXT_GROUP_START,
+			this.liveEdge && trackName === "video", this.authToken,
+		);
 		await writeControlMsg(this.controlWriter!, MOQ_MSG_SUBSCRIBE, payload);
 
 		return new Promise<number>((resolve, reject) => {
@@ -370,10 +414,15 @@ export class MoQTransport {
 						const pending = this.pendingSubscribes.get(se.requestID);
 						if (pending) {
 							this.pendingSubscribes.delete(se.requestID);
-							pending.reject(new Error(`Subscribe error ${se.errorCode}: ${se.reasonPhrase}`));
+							pending.reject(new Error(`Subscribe error ${subscribeErrorName(se.errorCode)}: ${se.reasonPhrase}`));
 						}
 						break;
 					}
+					case MOQ_MSG_SUBSCRIBE_DONE: {
+						const sd = parseSubscribeDone(msg.payload);
+						this.handleSubscribeDone(sd.requestID, sd.statusCode, sd.reasonPhrase);
+						break;
+					}
 					case MOQ_MSG_MAX_REQUEST_ID: {
 						const result = readVarint(msg.payload, 0);
 						this.serverMaxRequestID = result.value;
@@ -392,6 +441,25 @@ export class MoQTransport {
 		this.rejectPendingSubscribes("control stream closed");
 	}
 
+	/**
+	 * Drop a subscription the server ended. Tracks that ended abnormally are
+	 * resubscribed so a failed server-side write loop does not leave the
+	 * track stalled for the rest of the session.
+	 */
+	private handleSubscribeDone(requestID: number, statusCode: number, reason: string): void {
+		for (const [name, sub] of this.activeSubscriptions) {
+			if (sub.requestID !== requestID) continue;
+			this.trackAliasMap.delete(sub.trackAlias);
+			this.activeSubscriptions.delete(name);
+			if (this.closed || statusCode === MOQ_SUBSCRIBE_DONE_SUBSCRIPTION_ENDED) return;
+			console.warn(`[MoQ] ${name} ended (${subscribeDoneName(statusCode)}: ${reason}), resubscribing`);
+			this.subscribe(this.namespace, name, trackPriority(name)).catch((err) => {
+				console.warn(`[MoQ] resubscribe ${name} failed:`, err);
+			});
+			return;
+		}
+	}
+
 	private rejectPendingSubscribes(reason: string): void {
 		for (const [, pending] of this.pendingSubscribes) {
 			pending.reject(new Error(reason));
@@ -468,7 +536,7 @@ export class MoQTransport {
 				const extLen = await readVarintFromBuffer(buffer);
 				if (extLen === null) break;
 
-				let extensions = { captureTimestamp: 0, isKeyframe: false, videoConfig: null as Uint8Array | null };
+				let extensions: LOCExtensions = { captureTimestamp: 0, isKeyframe: false, videoConfig: null, timecode: null, audioFrames: null };
 				if (extLen > 0) {
 					const extData = await buffer.read(extLen);
 					if (!extData) break;
@@ -478,7 +546,16 @@ export class MoQTransport {
 				const payloadLen = await readVarintFromBuffer(buffer);
 				if (payloadLen === null) break;
 
-				if (payloadLen === 0) continue;
+				// A zero-length object carries a status instead of a
+				// payload: a dropped object, or the end of a group cut short.
+				if (payloadLen === 0) {
+					const status = await readVarintFromBuffer(buffer);
+					if (status === null) break;
+					if (status === MOQ_OBJECT_STATUS_DOES_NOT_EXIST) {
+						this._diagObjectsLost++;
+					}
+					continue;
+				}
 
 				const payload = await buffer.read(payloadLen);
 				if (!payload) break;
@@ -506,12 +583,32 @@ export class MoQTransport {
 						extensions.videoConfig,
 					);
 				} else if (trackName.startsWith("audio")) {
-					this._diagAudioFrames++;
 					const idx = parseInt(trackName.replace("audio", ""), 10) || 0;
-					this.callbacks.onAudioFrame(payload, timestamp, groupID, idx);
+					const frames = extensions.audioFrames ?? [{ size: payload.byteLength, offset: 0 }];
+					let pos = 0;
+					for (const f of frames) {
+						this._diagAudioFrames++;
+						this.callbacks.onAudioFrame(payload.subarray(pos, pos + f.size), timestamp + f.offset, groupID, idx);
+						pos += f.size;
+					}
 				} else if (trackName === "captions") {
 					const caption = parseCaptionData(payload);
 					this.callbacks.onCaptionFrame(caption, timestamp);
+				} else if (trackName === "catalog") {
+					try {
+						const catalog: MoQCatalog = JSON.parse(new TextDecoder().decode(payload));
+						this.catalogTracks = catalog.tracks;
+						this.callbacks.onCatalogUpdate?.(this.catalogToTrackInfo(catalog));
+						// An audio-first server advertises video only once its
+						// parameters are known; pick it up when it appears.
+						if (catalog.tracks.some(t => t.name === "video") && !this.hasSubscription("video")) {
+							this.subscribe(this.namespace, "video", trackPriority("video")).catch((err) => {
+								console.warn("[MoQ] subscribe video failed:", err);
+							});
+						}
+					} catch {
+						// malformed catalog JSON
+					}
 				} else if (trackName === "stats") {
 					try {
 						const msg = JSON.parse(new TextDecoder().decode(payload));
@@ -521,6 +618,9 @@ export class MoQTransport {
 						if (msg.viewerStats && this.callbacks.onViewerStats) {
 							this.callbacks.onViewerStats(msg.viewerStats as ServerViewerStats);
 						}
+						if (msg.relay && this.callbacks.onRelayStats) {
+							this.callbacks.onRelayStats(msg.relay as ServerRelayStats);
+						}
 					} catch {
 						// malformed stats JSON
 					}
@@ -552,6 +652,7 @@ export class MoQTransport {
 					trackIndex: 0,
 					label: "",
 					initData: sp.initData,
+					configHash: sp.configHash,
 				});
 			} else if (t.name.startsWith("audio")) {
 				const idx = parseInt(t.name.replace("audio", ""), 10) || audioIndex;
@@ -565,6 +666,7 @@ export class MoQTransport {
 					channels: sp.channelConfig ? parseInt(sp.channelConfig, 10) : 0,
 					trackIndex: idx,
 					label: `Audio ${idx + 1}`,
+					initData: sp.initData,
 				});
 				audioIndex++;
 			} else if (t.name === "captions") {
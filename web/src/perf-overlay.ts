@@ -23,6 +23,7 @@ interface TransportDiagnostics {
 	bytesReceived: number;
 	videoFramesReceived: number;
 	audioFramesReceived: number;
+	objectsLost: number;
 	avgVideoArrivalMs: number;
 	maxVideoArrivalMs: number;
 }
@@ -259,6 +260,7 @@ export class PerfOverlay {
 <tr><td>Bytes received</td><td align="right">${(t.bytesReceived / 1024).toFixed(0)} KB</td></tr>
 <tr><td>Video frames rx</td><td align="right">${t.videoFramesReceived}</td></tr>
 <tr><td>Audio frames rx</td><td align="right">${t.audioFramesReceived}</td></tr>
+<tr><td>Objects lost</td><td align="right">${t.objectsLost}</td></tr>
 <tr><td>Video arrival interval</td><td align="right">${f(t.avgVideoArrivalMs)}ms avg / ${f(t.maxVideoArrivalMs)}ms max</td></tr>
 </table>
 `;
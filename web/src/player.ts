@@ -262,6 +262,7 @@ export class PrismPlayer {
 								videoTrack.width,
 								videoTrack.height,
 								desc.buffer as ArrayBuffer,
+								videoTrack.configHash,
 							);
 						} else {
 							// Defer configuration until the first keyframe with description.
@@ -386,6 +387,7 @@ export class PrismPlayer {
 					videoTrack.width,
 					videoTrack.height,
 					desc.buffer as ArrayBuffer,
+					videoTrack.configHash,
 				);
 			} else if (deferVideoConfig) {
 				// Defer configuration until the first keyframe with description.
@@ -673,7 +675,7 @@ export class PrismPlayer {
 		const videoDiag = await this.videoDecoder.getDiagnostics();
 		const transportDiag = this.moqTransport
 			? this.moqTransport.getDiagnostics()
-			: { streamsOpened: 0, bytesReceived: 0, videoFramesReceived: 0, audioFramesReceived: 0, avgVideoArrivalMs: 0, maxVideoArrivalMs: 0 };
+			: { streamsOpened: 0, bytesReceived: 0, videoFramesReceived: 0, audioFramesReceived: 0, objectsLost: 0, avgVideoArrivalMs: 0, maxVideoArrivalMs: 0 };
 
 		return {
 			timestamp: new Date().toISOString(),
@@ -808,7 +810,8 @@ export class PrismPlayer {
 			const decoder = new PrismAudioDecoder();
 			const isMuted = track.trackIndex !== this.activeAudioTrack;
 			decoder.setMuted(isMuted);
-			await decoder.configure(track.codec, track.sampleRate, track.channels, this.sharedAudioContext!);
+			const desc = track.initData ? Uint8Array.from(atob(track.initData), c => c.charCodeAt(0)) : undefined;
+			await decoder.configure(track.codec, track.sampleRate, track.channels, this.sharedAudioContext!, desc);
 			this.audioDecoders.set(track.trackIndex, decoder);
 		}));
 
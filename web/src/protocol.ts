@@ -203,6 +203,8 @@ export interface ProtocolDiagnostics {
 	bytesReceived: number;
 	videoFramesReceived: number;
 	audioFramesReceived: number;
+	/** Objects the server dropped before delivery, reported via object status. */
+	objectsLost: number;
 	avgVideoArrivalMs: number;
 	maxVideoArrivalMs: number;
 }
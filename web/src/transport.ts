@@ -9,7 +9,8 @@ export interface TrackInfo {
 	channels: number;
 	trackIndex: number;
 	label: string;
-	initData?: string; // base64-encoded decoder config record (avcC / hvcC)
+	initData?: string; // base64-encoded decoder config record (avcC / hvcC / AudioSpecificConfig)
+	configHash?: string; // stable hash of the video initData; unchanged parameter sets keep it
 }
 
 /** Server-side video track statistics received periodically on the control channel. */
@@ -26,6 +27,21 @@ interface ServerVideoStats {
 	ptsErrors: number;
 	totalBytes: number;
 	timecode?: string;
+	discontinuities: number;
+	keyframeBytes: number;
+	deltaBytes: number;
+	avgKeyframeBytes: number;
+	colorSpace?: string; // e.g. "bt2020/pq"; absent when the SPS has no colour description
+	colorPrimaries?: VideoColorPrimaries;
+	colorTransfer?: VideoTransferCharacteristics;
+	colorMatrix?: VideoMatrixCoefficients;
+	fullRange?: boolean;
+	hdr?: boolean;
+	interlaced?: boolean; // pictures are fields or two-field frames
+	fieldRate?: number; // fields per second; present with interlaced
+	afd?: number; // Active Format Description code of the latest AFD SEI
+	activeFormat?: string; // e.g. "4:3 center"
+	bars?: { topEnd: number; bottomStart: number; leftEnd: number; rightStart: number }; // A/53 bar data; -1 for a bar not signalled
 }
 
 /** Per-audio-track server-side statistics. */
@@ -38,6 +54,10 @@ export interface ServerAudioTrackStats {
 	bitrateKbps: number;
 	ptsErrors: number;
 	totalBytes: number;
+	/** Latest PTS relative to video's (or the first audio track's), negative when behind. */
+	skewMs: number;
+	/** Set when skewMs exceeds the server's threshold. */
+	outOfSync?: boolean;
 }
 
 /** Server-side caption track statistics. */
@@ -56,19 +76,51 @@ export interface ServerViewerStats {
 	audioDropped: number;
 	captionDropped: number;
 	bytesSent: number;
+	/** Objects dropped because this viewer could not accept them in time. */
+	writeTimeouts?: number;
+	/** Time the latest live video frame spent in the server before being written. */
+	serverLatencyMs?: number;
+	/** MoQ group of the latest video frame written to this viewer. */
+	lastVideoGroup?: number;
+}
+
+/** Relay-wide delivery health reported alongside the stats snapshot. */
+export interface ServerRelayStats {
+	viewerCount: number;
+	videoSent: number;
+	audioSent: number;
+	videoDropped: number;
+	audioDropped: number;
+	/** Fraction of video and audio frames dropped across all viewers, 0 to 1. */
+	dropRate: number;
+	/** The GOP cached for late-joining viewers. */
+	gop: {
+		groupId: number;
+		frames: number;
+		bytes: number;
+		durationMs: number;
+	};
+	/** Group of the newest video frame broadcast. */
+	liveGroupId: number;
+	/** GOPs held for joining or seeking viewers. */
+	cachedGroups: number;
+	/** Lowest last-delivered group across viewers with video, or 0. */
+	oldestViewerGroup: number;
 }
 
 /** A single SCTE-35 ad insertion event reported by the server. */
 export interface ServerSCTE35Event {
-	pts: number;
+	pts: number; // splice time in microseconds, in the video PTS domain; 0 when the cue has none
 	commandType: string;
 	commandTypeId: number;
 	eventId?: number;
 	segmentationType?: string;
 	segmentationTypeId?: number;
 	duration?: number;
+	autoReturn?: boolean;
 	outOfNetwork?: boolean;
 	immediate?: boolean;
+	cancel?: boolean;
 	description: string;
 	receivedAt: number;
 }
@@ -77,6 +129,7 @@ export interface ServerSCTE35Event {
 interface ServerSCTE35Stats {
 	totalEvents: number;
 	recent?: ServerSCTE35Event[];
+	duplicates: number;
 }
 
 /** Aggregate server-side statistics for a stream, sent periodically over the control channel. */
@@ -86,10 +139,21 @@ export interface ServerStats {
 	protocol: string;
 	ingestBytes: number;
 	ingestKbps: number;
+	ingestHealth?: "ok" | "low" | "high";
+	ingestBreaches?: number;
+	hasVideo?: boolean;
 	video: ServerVideoStats;
 	audio: ServerAudioTrackStats[];
 	captions: ServerCaptionStats;
 	scte35: ServerSCTE35Stats;
 	viewerCount: number;
 	viewers?: ServerViewerStats[];
+	/** Whether the PMT declares conditional access: the feed is DRM protected and cannot be played. */
+	conditionalAccess?: boolean;
+	/** Whether SCTE-35 cues place the stream inside an ad break. */
+	inAdBreak?: boolean;
+	/** Time left until the current ad break is due to end, when its cue gave a duration. */
+	adBreakRemainingMs?: number;
+	/** Widest gap between the latest PTS of any two audio tracks. */
+	audioSkewMs: number;
 }
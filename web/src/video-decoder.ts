@@ -32,6 +32,7 @@ export class PrismVideoDecoder {
 	private renderBuffer: VideoRenderBuffer;
 	private onFrameReceived: (() => void) | null;
 	private configured = false;
+	private configHash: string | null = null;
 	private _lastDiag: VideoDecoderDiagnostics | null = null;
 	private _diagResolve: ((d: VideoDecoderDiagnostics) => void) | null = null;
 	private _bufferDropped = 0;
@@ -50,7 +51,11 @@ export class PrismVideoDecoder {
 		this.worker.onmessage = (e) => this.handleWorkerMessage(e);
 	}
 
-	configure(codec: string, width: number, height: number, description?: ArrayBuffer): void {
+	configure(codec: string, width: number, height: number, description?: ArrayBuffer, configHash?: string): void {
+		// A catalog refresh with the same parameter sets needs no new decoder.
+		if (this.configured && configHash && configHash === this.configHash) return;
+		this.configHash = configHash ?? null;
+
 		if (this.configured) {
 			// Already configured — reconfigure the existing worker
 			if (this.worker) {
@@ -49,6 +49,7 @@ type Server struct {
 	initErr  error
 
 	conns *sessionManager
+	stats *connStatsRegistry
 }
 
 func (s *Server) initialize() error {
@@ -74,6 +75,15 @@ func (s *Server) init() error {
 		s.CheckOrigin = checkSameOrigin
 	}
 
+	// trace connections for Session.ConnectionStats
+	s.stats = newConnStatsRegistry()
+	quicConf := &quic.Config{}
+	if s.H3.QUICConfig != nil {
+		quicConf = s.H3.QUICConfig.Clone()
+	}
+	quicConf.Tracer = s.stats.tracer(quicConf.Tracer)
+	s.H3.QUICConfig = quicConf
+
 	// configure the http3.Server
 	if s.H3.AdditionalSettings == nil {
 		s.H3.AdditionalSettings = make(map[uint64]uint64, 1)
@@ -190,7 +200,8 @@ func (s *Server) Upgrade(w http.ResponseWriter, r *http.Request) (*Session, erro
 
 	str := w.(http3.HTTPStreamer).HTTPStream()
 	sessID := sessionID(str.StreamID())
-	return s.conns.AddSession(conn, sessID, str), nil
+	connTracingID := conn.Context().Value(quic.ConnectionTracingKey).(quic.ConnectionTracingID)
+	return s.conns.AddSession(conn, sessID, str, s.stats.lookup(connTracingID)), nil
 }
 
 func checkSameOrigin(r *http.Request) bool {
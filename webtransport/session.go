@@ -80,9 +80,11 @@ type Session struct {
 
 	// TODO: garbage collect streams from when they are closed
 	streams streamsMap
+
+	stats *connStats // nil if the connection is not traced
 }
 
-func newSession(sessionID sessionID, qconn http3.Connection, requestStr http3.Stream) *Session {
+func newSession(sessionID sessionID, qconn http3.Connection, requestStr http3.Stream, stats *connStats) *Session {
 	tracingID := qconn.Context().Value(quic.ConnectionTracingKey).(quic.ConnectionTracingID)
 	ctx, ctxCancel := context.WithCancel(context.WithValue(context.Background(), quic.ConnectionTracingKey, tracingID))
 	c := &Session{
@@ -94,6 +96,7 @@ func newSession(sessionID sessionID, qconn http3.Connection, requestStr http3.St
 		bidiAcceptQueue: *newAcceptQueue[Stream](),
 		uniAcceptQueue:  *newAcceptQueue[ReceiveStream](),
 		streams:         *newStreamsMap(),
+		stats:           stats,
 	}
 	// precompute the headers for unidirectional streams
 	c.uniStreamHdr = make([]byte, 0, 2+quicvarint.Len(uint64(c.sessionID)))
@@ -424,3 +427,14 @@ func (s *Session) closeWithError(code SessionErrorCode, msg string) (bool /* fir
 func (s *Session) ConnectionState() quic.ConnectionState {
 	return s.qconn.ConnectionState()
 }
+
+// ConnectionStats returns the RTT, congestion and loss stats of the QUIC
+// connection carrying the session. They are zero for a connection the
+// server did not trace, such as one passed to ServeQUICConn, and keep
+// their last values once the connection closes.
+func (s *Session) ConnectionStats() ConnectionStats {
+	if s.stats == nil {
+		return ConnectionStats{}
+	}
+	return s.stats.load()
+}
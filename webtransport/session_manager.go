@@ -164,8 +164,8 @@ func (m *sessionManager) handleUniStream(str quic.ReceiveStream, sess *session)
 }
 
 // AddSession adds a new WebTransport session.
-func (m *sessionManager) AddSession(qconn http3.Connection, id sessionID, requestStr http3.Stream) *Session {
-	conn := newSession(id, qconn, requestStr)
+func (m *sessionManager) AddSession(qconn http3.Connection, id sessionID, requestStr http3.Stream, stats *connStats) *Session {
+	conn := newSession(id, qconn, requestStr, stats)
 	connTracingID := qconn.Context().Value(quic.ConnectionTracingKey).(quic.ConnectionTracingID)
 
 	m.mx.Lock()
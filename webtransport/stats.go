@@ -0,0 +1,113 @@
+package webtransport
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/logging"
+)
+
+// ConnectionStats is the transport-level state of the QUIC connection
+// carrying a session, as last reported by its congestion controller.
+// Sessions sharing a connection report the same stats.
+type ConnectionStats struct {
+	// LatestRTT is the most recent round-trip time sample, SmoothedRTT
+	// the exponentially weighted average of the samples and MinRTT the
+	// lowest seen. All are zero until the first sample.
+	LatestRTT   time.Duration
+	SmoothedRTT time.Duration
+	MinRTT      time.Duration
+
+	// BytesInFlight is the data sent but not yet acknowledged or
+	// declared lost, and CongestionWindow how much may be in flight.
+	// A connection whose BytesInFlight stays near its CongestionWindow
+	// is congestion limited.
+	BytesInFlight    int64
+	CongestionWindow int64
+
+	// PacketsLost counts the packets declared lost since the connection
+	// started.
+	PacketsLost int64
+}
+
+// connStats accumulates the ConnectionStats of one connection. The
+// connection's tracer updates it from the connection's goroutine.
+type connStats struct {
+	latestRTT     atomic.Int64
+	smoothedRTT   atomic.Int64
+	minRTT        atomic.Int64
+	bytesInFlight atomic.Int64
+	cwnd          atomic.Int64
+	packetsLost   atomic.Int64
+}
+
+func (c *connStats) load() ConnectionStats {
+	return ConnectionStats{
+		LatestRTT:        time.Duration(c.latestRTT.Load()),
+		SmoothedRTT:      time.Duration(c.smoothedRTT.Load()),
+		MinRTT:           time.Duration(c.minRTT.Load()),
+		BytesInFlight:    c.bytesInFlight.Load(),
+		CongestionWindow: c.cwnd.Load(),
+		PacketsLost:      c.packetsLost.Load(),
+	}
+}
+
+// connStatsRegistry holds the connStats of the server's open
+// connections, keyed by their tracing ID so that a session can find its
+// connection's.
+type connStatsRegistry struct {
+	mx    sync.Mutex
+	conns map[quic.ConnectionTracingID]*connStats
+}
+
+func newConnStatsRegistry() *connStatsRegistry {
+	return &connStatsRegistry{conns: make(map[quic.ConnectionTracingID]*connStats)}
+}
+
+// tracer returns a quic.Config.Tracer that records each connection's
+// stats in the registry until the connection closes, alongside the
+// tracer next, if any.
+func (r *connStatsRegistry) tracer(next func(context.Context, logging.Perspective, quic.ConnectionID) *logging.ConnectionTracer) func(context.Context, logging.Perspective, quic.ConnectionID) *logging.ConnectionTracer {
+	return func(ctx context.Context, p logging.Perspective, connID quic.ConnectionID) *logging.ConnectionTracer {
+		id, _ := ctx.Value(quic.ConnectionTracingKey).(quic.ConnectionTracingID)
+		stats := &connStats{}
+		r.mx.Lock()
+		r.conns[id] = stats
+		r.mx.Unlock()
+
+		t := &logging.ConnectionTracer{
+			UpdatedMetrics: func(rtt *logging.RTTStats, cwnd, bytesInFlight logging.ByteCount, _ int) {
+				stats.latestRTT.Store(int64(rtt.LatestRTT()))
+				stats.smoothedRTT.Store(int64(rtt.SmoothedRTT()))
+				stats.minRTT.Store(int64(rtt.MinRTT()))
+				stats.cwnd.Store(int64(cwnd))
+				stats.bytesInFlight.Store(int64(bytesInFlight))
+			},
+			LostPacket: func(logging.EncryptionLevel, logging.PacketNumber, logging.PacketLossReason) {
+				stats.packetsLost.Add(1)
+			},
+			Close: func() {
+				r.mx.Lock()
+				delete(r.conns, id)
+				r.mx.Unlock()
+			},
+		}
+		if next != nil {
+			if nt := next(ctx, p, connID); nt != nil {
+				return logging.NewMultiplexedConnectionTracer(nt, t)
+			}
+		}
+		return t
+	}
+}
+
+// lookup returns the stats of the connection with the given tracing ID,
+// or nil if it is not traced.
+func (r *connStatsRegistry) lookup(id quic.ConnectionTracingID) *connStats {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	return r.conns[id]
+}